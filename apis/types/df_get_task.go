@@ -52,12 +52,26 @@ type DfGetTask struct {
 	//
 	PeerID string `json:"peerID,omitempty"`
 
+	// the order in which the client prefers the pieces to be assigned.
+	// The pieces least distributed among the peers are assigned first with rarest-first by default,
+	// in the order of their numbers with sequential for the streaming consumers,
+	// and in random order with random.
+	//
+	// Enum: [rarest-first sequential random]
+	PieceOrder string `json:"pieceOrder,omitempty"`
+
 	// The size of pieces which is calculated as per the following strategy
 	// 1. If file's total size is less than 200MB, then the piece size is 4MB by default.
 	// 2. Otherwise, it equals to the smaller value between totalSize/100MB + 2 MB and 15MB.
 	//
 	PieceSize int32 `json:"pieceSize,omitempty"`
 
+	// the range of the file in bytes which the client requires, such as "0-1048575".
+	// The client is finished once the pieces covering the range are downloaded
+	// if the completion policy of the task is partial.
+	//
+	RequiredRange string `json:"requiredRange,omitempty"`
+
 	// The status of Dfget download process.
 	//
 	// Enum: [WAITING RUNNING FAILED SUCCESS]
@@ -78,6 +92,10 @@ func (m *DfGetTask) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validatePieceOrder(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validateStatus(formats); err != nil {
 		res = append(res, err)
 	}
@@ -101,6 +119,52 @@ func (m *DfGetTask) validateCallSystem(formats strfmt.Registry) error {
 	return nil
 }
 
+var dfGetTaskTypePieceOrderPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["rarest-first","sequential","random"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		dfGetTaskTypePieceOrderPropEnum = append(dfGetTaskTypePieceOrderPropEnum, v)
+	}
+}
+
+const (
+
+	// DfGetTaskPieceOrderRarestFirst captures enum value "rarest-first"
+	DfGetTaskPieceOrderRarestFirst string = "rarest-first"
+
+	// DfGetTaskPieceOrderSequential captures enum value "sequential"
+	DfGetTaskPieceOrderSequential string = "sequential"
+
+	// DfGetTaskPieceOrderRandom captures enum value "random"
+	DfGetTaskPieceOrderRandom string = "random"
+)
+
+// prop value enum
+func (m *DfGetTask) validatePieceOrderEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, dfGetTaskTypePieceOrderPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *DfGetTask) validatePieceOrder(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.PieceOrder) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validatePieceOrderEnum("pieceOrder", "body", m.PieceOrder); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 var dfGetTaskTypeStatusPropEnum []interface{}
 
 func init() {
@@ -6,6 +6,8 @@ package types
 // Editing this file might prove futile when you re-run the swagger generate command
 
 import (
+	"encoding/json"
+
 	strfmt "github.com/go-openapi/strfmt"
 
 	"github.com/go-openapi/errors"
@@ -28,15 +30,30 @@ type PeerInfo struct {
 	// Format: ipv4
 	IP strfmt.IPv4 `json:"IP,omitempty"`
 
+	// whether the peer is excluded from serving the other peers, since its service is down
+	// or has failed too many times.
+	//
+	Blacklisted bool `json:"blacklisted,omitempty"`
+
 	// the time to join the P2P network
 	// Format: date-time
 	Created strfmt.DateTime `json:"created,omitempty"`
 
+	// the bytes of the pieces that the peer downloaded from the other peers and supernode
+	ConsumedBytes int64 `json:"consumedBytes,omitempty"`
+
 	// host name of peer client node, as a valid RFC 1123 hostname.
 	// Min Length: 1
 	// Format: hostname
 	HostName strfmt.Hostname `json:"hostName,omitempty"`
 
+	// the time when a client of the peer registered or reported its progress last time
+	// Format: date-time
+	LastSeen strfmt.DateTime `json:"lastSeen,omitempty"`
+
+	// the number of the pieces being downloaded from the peer by the other peers
+	Load int32 `json:"load,omitempty"`
+
 	// when registering, dfget will setup one uploader process.
 	// This one acts as a server for peer pulling tasks.
 	// This port is which this server listens on.
@@ -45,6 +62,14 @@ type PeerInfo struct {
 	// Minimum: 15000
 	Port int32 `json:"port,omitempty"`
 
+	// the role of the peer, which is seed for supernode and normal for the others.
+	//
+	// Enum: [seed normal]
+	Role string `json:"role,omitempty"`
+
+	// the bytes of the pieces that the other peers downloaded from the peer
+	ServedBytes int64 `json:"servedBytes,omitempty"`
+
 	// version number of dfget binary
 	Version string `json:"version,omitempty"`
 }
@@ -65,10 +90,18 @@ func (m *PeerInfo) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateLastSeen(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validatePort(formats); err != nil {
 		res = append(res, err)
 	}
 
+	if err := m.validateRole(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -118,6 +151,19 @@ func (m *PeerInfo) validateHostName(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *PeerInfo) validateLastSeen(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.LastSeen) { // not required
+		return nil
+	}
+
+	if err := validate.FormatOf("lastSeen", "body", "date-time", m.LastSeen.String(), formats); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (m *PeerInfo) validatePort(formats strfmt.Registry) error {
 
 	if swag.IsZero(m.Port) { // not required
@@ -135,6 +181,49 @@ func (m *PeerInfo) validatePort(formats strfmt.Registry) error {
 	return nil
 }
 
+var peerInfoTypeRolePropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["seed","normal"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		peerInfoTypeRolePropEnum = append(peerInfoTypeRolePropEnum, v)
+	}
+}
+
+const (
+
+	// PeerInfoRoleSeed captures enum value "seed"
+	PeerInfoRoleSeed string = "seed"
+
+	// PeerInfoRoleNormal captures enum value "normal"
+	PeerInfoRoleNormal string = "normal"
+)
+
+// prop value enum
+func (m *PeerInfo) validateRoleEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, peerInfoTypeRolePropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *PeerInfo) validateRole(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Role) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateRoleEnum("role", "body", m.Role); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *PeerInfo) MarshalBinary() ([]byte, error) {
 	if m == nil {
@@ -6,6 +6,9 @@ package types
 // Editing this file might prove futile when you re-run the swagger generate command
 
 import (
+	"encoding/json"
+	"strconv"
+
 	strfmt "github.com/go-openapi/strfmt"
 
 	"github.com/go-openapi/errors"
@@ -31,12 +34,42 @@ type TaskCreateRequest struct {
 	// Min Length: 1
 	CallSystem string `json:"callSystem,omitempty"`
 
+	// the stable identity of the client provided by dfget, which is kept the same when the client
+	// reconnects. Supernode will resume the progress of the previous client with the same identity
+	// for the task if it has been seen within the TTL, rather than treating it as a new client.
+	//
+	ClientIdentity string `json:"clientIdentity,omitempty"`
+
+	// the completion policy of the task which is set when the task is created.
+	// The client of the task with the policy full is finished when it has downloaded all the pieces,
+	// and the one with the policy partial is finished as soon as it has downloaded the pieces
+	// covering its requiredRange, while the rest of the task continues in the background.
+	//
+	// Enum: [full partial]
+	CompletionPolicy string `json:"completionPolicy,omitempty"`
+
+	// the consistency level of the content which the client requires.
+	// The cached content is served as long as it's fresh with cached-ok by default,
+	// the cached content is revalidated with the source by the conditional request before being served
+	// with revalidate, and the content is always downloaded from the source again with always-fresh.
+	//
+	// Enum: [cached-ok revalidate always-fresh]
+	Consistency string `json:"consistency,omitempty"`
+
 	// tells whether it is a call from dfdaemon. dfdaemon is a long running
 	// process which works for container engines. It translates the image
 	// pulling request into raw requests into those dfget recognizes.
 	//
 	Dfdaemon bool `json:"dfdaemon,omitempty"`
 
+	// the algorithm of the digest of the whole content which is set when the task is created,
+	// and the default algorithm of supernode is used if it's empty.
+	// The digest is computed by supernode with it while downloading the file from the source,
+	// and recorded with the algorithm in the task.
+	//
+	// Enum: [md5 sha256 sha512]
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+
 	// filter is used to filter request queries in URL.
 	// For example, when a user wants to start to download a task which has a remote URL of
 	// a.b.com/fileA?user=xxx&auth=yyy, user can add a filter parameter ["user", "auth"]
@@ -77,15 +110,35 @@ type TaskCreateRequest struct {
 	//
 	PeerID string `json:"peerID,omitempty"`
 
+	// the order in which the client prefers the pieces to be assigned.
+	// The pieces least distributed among the peers are assigned first with rarest-first by default,
+	// in the order of their numbers with sequential for the streaming consumers,
+	// and in random order with random.
+	//
+	// Enum: [rarest-first sequential random]
+	PieceOrder string `json:"pieceOrder,omitempty"`
+
 	// The is the resource's URL which user uses dfget to download. The location of URL can be anywhere, LAN or WAN.
 	// For image distribution, this is image layer's URL in image registry.
 	// The resource url is provided by command line parameter.
 	//
 	RawURL string `json:"rawURL,omitempty"`
 
+	// the range of the file in bytes which the client requires, such as "0-1048575".
+	// It only takes effect if the completion policy of the task is partial,
+	// and the client is finished once the pieces covering the range are downloaded.
+	//
+	RequiredRange string `json:"requiredRange,omitempty"`
+
 	// IP address of supernode which the peer connects to
 	SupernodeIP string `json:"supernodeIP,omitempty"`
 
+	// the tags of the task, which group the related tasks such as all the artifacts of one deployment.
+	// The tags are added to the task when it's registered, and the tasks sharing a tag can be
+	// listed, purged, preheated and canceled together.
+	//
+	Tags []string `json:"tags"`
+
 	// taskURL is generated from rawURL. rawURL may contains some queries or parameter, dfget will filter some queries via
 	// --filter parameter of dfget. The usage of it is that different rawURL may generate the same taskID.
 	//
@@ -100,6 +153,26 @@ func (m *TaskCreateRequest) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateCompletionPolicy(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateConsistency(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateDigestAlgorithm(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validatePieceOrder(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateTags(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -119,6 +192,204 @@ func (m *TaskCreateRequest) validateCallSystem(formats strfmt.Registry) error {
 	return nil
 }
 
+var taskCreateRequestTypeCompletionPolicyPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["full","partial"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskCreateRequestTypeCompletionPolicyPropEnum = append(taskCreateRequestTypeCompletionPolicyPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskCreateRequestCompletionPolicyFull captures enum value "full"
+	TaskCreateRequestCompletionPolicyFull string = "full"
+
+	// TaskCreateRequestCompletionPolicyPartial captures enum value "partial"
+	TaskCreateRequestCompletionPolicyPartial string = "partial"
+)
+
+// prop value enum
+func (m *TaskCreateRequest) validateCompletionPolicyEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskCreateRequestTypeCompletionPolicyPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskCreateRequest) validateCompletionPolicy(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.CompletionPolicy) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateCompletionPolicyEnum("completionPolicy", "body", m.CompletionPolicy); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var taskCreateRequestTypeConsistencyPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["cached-ok","revalidate","always-fresh"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskCreateRequestTypeConsistencyPropEnum = append(taskCreateRequestTypeConsistencyPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskCreateRequestConsistencyCachedOk captures enum value "cached-ok"
+	TaskCreateRequestConsistencyCachedOk string = "cached-ok"
+
+	// TaskCreateRequestConsistencyRevalidate captures enum value "revalidate"
+	TaskCreateRequestConsistencyRevalidate string = "revalidate"
+
+	// TaskCreateRequestConsistencyAlwaysFresh captures enum value "always-fresh"
+	TaskCreateRequestConsistencyAlwaysFresh string = "always-fresh"
+)
+
+// prop value enum
+func (m *TaskCreateRequest) validateConsistencyEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskCreateRequestTypeConsistencyPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskCreateRequest) validateConsistency(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Consistency) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateConsistencyEnum("consistency", "body", m.Consistency); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var taskCreateRequestTypeDigestAlgorithmPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["md5","sha256","sha512"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskCreateRequestTypeDigestAlgorithmPropEnum = append(taskCreateRequestTypeDigestAlgorithmPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskCreateRequestDigestAlgorithmMd5 captures enum value "md5"
+	TaskCreateRequestDigestAlgorithmMd5 string = "md5"
+
+	// TaskCreateRequestDigestAlgorithmSha256 captures enum value "sha256"
+	TaskCreateRequestDigestAlgorithmSha256 string = "sha256"
+
+	// TaskCreateRequestDigestAlgorithmSha512 captures enum value "sha512"
+	TaskCreateRequestDigestAlgorithmSha512 string = "sha512"
+)
+
+// prop value enum
+func (m *TaskCreateRequest) validateDigestAlgorithmEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskCreateRequestTypeDigestAlgorithmPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskCreateRequest) validateDigestAlgorithm(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.DigestAlgorithm) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateDigestAlgorithmEnum("digestAlgorithm", "body", m.DigestAlgorithm); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var taskCreateRequestTypePieceOrderPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["rarest-first","sequential","random"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskCreateRequestTypePieceOrderPropEnum = append(taskCreateRequestTypePieceOrderPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskCreateRequestPieceOrderRarestFirst captures enum value "rarest-first"
+	TaskCreateRequestPieceOrderRarestFirst string = "rarest-first"
+
+	// TaskCreateRequestPieceOrderSequential captures enum value "sequential"
+	TaskCreateRequestPieceOrderSequential string = "sequential"
+
+	// TaskCreateRequestPieceOrderRandom captures enum value "random"
+	TaskCreateRequestPieceOrderRandom string = "random"
+)
+
+// prop value enum
+func (m *TaskCreateRequest) validatePieceOrderEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskCreateRequestTypePieceOrderPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskCreateRequest) validatePieceOrder(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.PieceOrder) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validatePieceOrderEnum("pieceOrder", "body", m.PieceOrder); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *TaskCreateRequest) validateTags(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Tags) { // not required
+		return nil
+	}
+
+	for i := 0; i < len(m.Tags); i++ {
+
+		if err := validate.MinLength("tags"+"."+strconv.Itoa(i), "body", string(m.Tags[i]), 1); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *TaskCreateRequest) MarshalBinary() ([]byte, error) {
 	if m == nil {
@@ -22,16 +22,57 @@ type TaskInfo struct {
 	// ID of the task.
 	ID string `json:"ID,omitempty"`
 
+	// the number of the times that the task was registered in supernode.
+	AccessCount int64 `json:"accessCount,omitempty"`
+
+	// the counts of the results of looking up the cache of the task.
+	CacheStats *TaskCacheStats `json:"cacheStats,omitempty"`
+
 	// The status of the created task related to CDN functionality.
 	//
 	// Enum: [WAITING RUNNING FAILED SUCCESS SOURCE_ERROR]
 	CdnStatus string `json:"cdnStatus,omitempty"`
 
+	// the completion policy of the task, and the clients of the task with the policy partial
+	// are finished as soon as they have downloaded the pieces covering their required ranges.
+	//
+	// Enum: [full partial]
+	CompletionPolicy string `json:"completionPolicy,omitempty"`
+
+	// the consistency level required by the registration which triggers the CDN of the task.
+	// The cache is reused as long as it's fresh with cached-ok, revalidated with the source
+	// regardless of its freshness with revalidate, and never reused with always-fresh.
+	//
+	// Enum: [cached-ok revalidate always-fresh]
+	Consistency string `json:"consistency,omitempty"`
+
+	// the time when the task was registered in supernode.
+	// Format: date-time
+	CreateTime strfmt.DateTime `json:"createTime,omitempty"`
+
+	// The digest of the whole content computed by supernode in hex,
+	// which is set when supernode has downloaded the file successfully.
+	//
+	Digest string `json:"digest,omitempty"`
+
+	// The algorithm of the digest of the whole content, which is set when the task is created,
+	// so that the clients know how to verify the content with the digest.
+	//
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+
 	// The length of the file dfget requests to download in bytes
 	// which including the header and the trailer of each piece.
 	//
 	FileLength int64 `json:"fileLength,omitempty"`
 
+	// the time when supernode finished downloading the whole file from the source.
+	// Format: date-time
+	FinishTime strfmt.DateTime `json:"finishTime,omitempty"`
+
+	// the time when the first piece of the task became available on supernode.
+	// Format: date-time
+	FirstPieceTime strfmt.DateTime `json:"firstPieceTime,omitempty"`
+
 	// extra HTTP headers sent to the rawURL.
 	// This field is carried with the request to supernode.
 	// Supernode will extract these HTTP headers, and set them in HTTP downloading requests
@@ -57,6 +98,17 @@ type TaskInfo struct {
 	//
 	Md5 string `json:"md5,omitempty"`
 
+	// the metadata of the task captured from the headers responded by the source when it's downloaded,
+	// which contains the headers configured by originMetadataHeaders of supernode keyed by their canonical names.
+	//
+	OriginMetadata map[string]string `json:"originMetadata,omitempty"`
+
+	// the md5 sum of the content served by the source location before being normalized.
+	// It's set only when supernode decodes the content encoding of the source file and stores
+	// the content in the identity form, and then the realMd5 is the md5 sum of the decoded content.
+	//
+	OriginalMd5 string `json:"originalMd5,omitempty"`
+
 	// The size of pieces which is calculated as per the following strategy
 	// 1. If file's total size is less than 200MB, then the piece size is 4MB by default.
 	// 2. Otherwise, it equals to the smaller value between totalSize/100MB + 2 MB and 15MB.
@@ -78,6 +130,9 @@ type TaskInfo struct {
 	//
 	RealMd5 string `json:"realMd5,omitempty"`
 
+	// the tags of the task, which group the related tasks such as all the artifacts of one deployment.
+	Tags []string `json:"tags"`
+
 	// taskURL is generated from rawURL. rawURL may contains some queries or parameter, dfget will filter some queries via
 	// --filter parameter of dfget. The usage of it is that different rawURL may generate the same taskID.
 	//
@@ -88,16 +143,58 @@ type TaskInfo struct {
 func (m *TaskInfo) Validate(formats strfmt.Registry) error {
 	var res []error
 
+	if err := m.validateCacheStats(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validateCdnStatus(formats); err != nil {
 		res = append(res, err)
 	}
 
+	if err := m.validateCompletionPolicy(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateConsistency(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateCreateTime(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateFinishTime(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateFirstPieceTime(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
 	return nil
 }
 
+func (m *TaskInfo) validateCacheStats(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.CacheStats) { // not required
+		return nil
+	}
+
+	if m.CacheStats != nil {
+		if err := m.CacheStats.Validate(formats); err != nil {
+			if ve, ok := err.(*errors.Validation); ok {
+				return ve.ValidateName("cacheStats")
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
 var taskInfoTypeCdnStatusPropEnum []interface{}
 
 func init() {
@@ -150,6 +247,134 @@ func (m *TaskInfo) validateCdnStatus(formats strfmt.Registry) error {
 	return nil
 }
 
+var taskInfoTypeCompletionPolicyPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["full","partial"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskInfoTypeCompletionPolicyPropEnum = append(taskInfoTypeCompletionPolicyPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskInfoCompletionPolicyFull captures enum value "full"
+	TaskInfoCompletionPolicyFull string = "full"
+
+	// TaskInfoCompletionPolicyPartial captures enum value "partial"
+	TaskInfoCompletionPolicyPartial string = "partial"
+)
+
+// prop value enum
+func (m *TaskInfo) validateCompletionPolicyEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskInfoTypeCompletionPolicyPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskInfo) validateCompletionPolicy(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.CompletionPolicy) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateCompletionPolicyEnum("completionPolicy", "body", m.CompletionPolicy); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var taskInfoTypeConsistencyPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["cached-ok","revalidate","always-fresh"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskInfoTypeConsistencyPropEnum = append(taskInfoTypeConsistencyPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskInfoConsistencyCachedOk captures enum value "cached-ok"
+	TaskInfoConsistencyCachedOk string = "cached-ok"
+
+	// TaskInfoConsistencyRevalidate captures enum value "revalidate"
+	TaskInfoConsistencyRevalidate string = "revalidate"
+
+	// TaskInfoConsistencyAlwaysFresh captures enum value "always-fresh"
+	TaskInfoConsistencyAlwaysFresh string = "always-fresh"
+)
+
+// prop value enum
+func (m *TaskInfo) validateConsistencyEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskInfoTypeConsistencyPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskInfo) validateConsistency(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Consistency) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateConsistencyEnum("consistency", "body", m.Consistency); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *TaskInfo) validateCreateTime(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.CreateTime) { // not required
+		return nil
+	}
+
+	if err := validate.FormatOf("createTime", "body", "date-time", m.CreateTime.String(), formats); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *TaskInfo) validateFinishTime(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.FinishTime) { // not required
+		return nil
+	}
+
+	if err := validate.FormatOf("finishTime", "body", "date-time", m.FinishTime.String(), formats); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *TaskInfo) validateFirstPieceTime(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.FirstPieceTime) { // not required
+		return nil
+	}
+
+	if err := validate.FormatOf("firstPieceTime", "body", "date-time", m.FirstPieceTime.String(), formats); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *TaskInfo) MarshalBinary() ([]byte, error) {
 	if m == nil {
@@ -6,6 +6,9 @@ package types
 // Editing this file might prove futile when you re-run the swagger generate command
 
 import (
+	"encoding/json"
+	"strconv"
+
 	strfmt "github.com/go-openapi/strfmt"
 
 	"github.com/go-openapi/errors"
@@ -21,6 +24,12 @@ type TaskRegisterRequest struct {
 	// Format: ipv4
 	IP strfmt.IPv4 `json:"IP,omitempty"`
 
+	// tells whether the client is able to download the file from the source directly.
+	// Supernode may tell the client to do that rather than registering the task
+	// when it's overloaded, so that the client doesn't wait for it.
+	//
+	AllowPassthrough bool `json:"allowPassthrough,omitempty"`
+
 	// CID means the client ID. It maps to the specific dfget process.
 	// When user wishes to download an image/file, user would start a dfget process to do this.
 	// This dfget is treated a client and carries a client ID.
@@ -35,12 +44,42 @@ type TaskRegisterRequest struct {
 	// Min Length: 1
 	CallSystem string `json:"callSystem,omitempty"`
 
+	// the stable identity of the client provided by dfget, which is kept the same when the client
+	// reconnects. Supernode will resume the progress of the previous client with the same identity
+	// for the task if it has been seen within the TTL, rather than treating it as a new client.
+	//
+	ClientIdentity string `json:"clientIdentity,omitempty"`
+
+	// the completion policy of the task which is set when the task is created.
+	// The client of the task with the policy full is finished when it has downloaded all the pieces,
+	// and the one with the policy partial is finished as soon as it has downloaded the pieces
+	// covering its requiredRange, while the rest of the task continues in the background.
+	//
+	// Enum: [full partial]
+	CompletionPolicy string `json:"completionPolicy,omitempty"`
+
+	// the consistency level of the content which the client requires.
+	// The cached content is served as long as it's fresh with cached-ok by default,
+	// the cached content is revalidated with the source by the conditional request before being served
+	// with revalidate, and the content is always downloaded from the source again with always-fresh.
+	//
+	// Enum: [cached-ok revalidate always-fresh]
+	Consistency string `json:"consistency,omitempty"`
+
 	// tells whether it is a call from dfdaemon. dfdaemon is a long running
 	// process which works for container engines. It translates the image
 	// pulling request into raw requests into those dfget recognizes.
 	//
 	Dfdaemon bool `json:"dfdaemon,omitempty"`
 
+	// the algorithm of the digest of the whole content which is set when the task is created,
+	// and the default algorithm of supernode is used if it's empty.
+	// The digest is computed by supernode with it while downloading the file from the source,
+	// and recorded with the algorithm in the task.
+	//
+	// Enum: [md5 sha256 sha512]
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+
 	// extra HTTP headers sent to the rawURL.
 	// This field is carried with the request to supernode.
 	// Supernode will extract these HTTP headers, and set them in HTTP downloading requests
@@ -76,6 +115,14 @@ type TaskRegisterRequest struct {
 	//
 	Path string `json:"path,omitempty"`
 
+	// the order in which the client prefers the pieces to be assigned.
+	// The pieces least distributed among the peers are assigned first with rarest-first by default,
+	// in the order of their numbers with sequential for the streaming consumers,
+	// and in random order with random.
+	//
+	// Enum: [rarest-first sequential random]
+	PieceOrder string `json:"pieceOrder,omitempty"`
+
 	// when registering, dfget will setup one uploader process.
 	// This one acts as a server for peer pulling tasks.
 	// This port is which this server listens on.
@@ -90,6 +137,12 @@ type TaskRegisterRequest struct {
 	//
 	RawURL string `json:"rawURL,omitempty"`
 
+	// the range of the file in bytes which the client requires, such as "0-1048575".
+	// It only takes effect if the completion policy of the task is partial,
+	// and the client is finished once the pieces covering the range are downloaded.
+	//
+	RequiredRange string `json:"requiredRange,omitempty"`
+
 	// The root ca cert from client used to download the remote source file.
 	//
 	RootCAs []strfmt.Base64 `json:"rootCAs"`
@@ -97,6 +150,12 @@ type TaskRegisterRequest struct {
 	// The address of supernode that the client can connect to
 	SuperNodeIP string `json:"superNodeIp,omitempty"`
 
+	// the tags of the task, which group the related tasks such as all the artifacts of one deployment.
+	// The tags are added to the task when it's registered, and the tasks sharing a tag can be
+	// listed, purged, preheated and canceled together.
+	//
+	Tags []string `json:"tags"`
+
 	// taskURL is generated from rawURL. rawURL may contains some queries or parameter, dfget will filter some queries via
 	// --filter parameter of dfget. The usage of it is that different rawURL may generate the same taskID.
 	//
@@ -118,10 +177,26 @@ func (m *TaskRegisterRequest) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateCompletionPolicy(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateConsistency(formats); err != nil {
+		res = append(res, err)
+	}
+
+	if err := m.validateDigestAlgorithm(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validateHostName(formats); err != nil {
 		res = append(res, err)
 	}
 
+	if err := m.validatePieceOrder(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validatePort(formats); err != nil {
 		res = append(res, err)
 	}
@@ -130,6 +205,10 @@ func (m *TaskRegisterRequest) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateTags(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -162,6 +241,141 @@ func (m *TaskRegisterRequest) validateCallSystem(formats strfmt.Registry) error
 	return nil
 }
 
+var taskRegisterRequestTypeCompletionPolicyPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["full","partial"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskRegisterRequestTypeCompletionPolicyPropEnum = append(taskRegisterRequestTypeCompletionPolicyPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskRegisterRequestCompletionPolicyFull captures enum value "full"
+	TaskRegisterRequestCompletionPolicyFull string = "full"
+
+	// TaskRegisterRequestCompletionPolicyPartial captures enum value "partial"
+	TaskRegisterRequestCompletionPolicyPartial string = "partial"
+)
+
+// prop value enum
+func (m *TaskRegisterRequest) validateCompletionPolicyEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskRegisterRequestTypeCompletionPolicyPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskRegisterRequest) validateCompletionPolicy(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.CompletionPolicy) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateCompletionPolicyEnum("completionPolicy", "body", m.CompletionPolicy); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var taskRegisterRequestTypeConsistencyPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["cached-ok","revalidate","always-fresh"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskRegisterRequestTypeConsistencyPropEnum = append(taskRegisterRequestTypeConsistencyPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskRegisterRequestConsistencyCachedOk captures enum value "cached-ok"
+	TaskRegisterRequestConsistencyCachedOk string = "cached-ok"
+
+	// TaskRegisterRequestConsistencyRevalidate captures enum value "revalidate"
+	TaskRegisterRequestConsistencyRevalidate string = "revalidate"
+
+	// TaskRegisterRequestConsistencyAlwaysFresh captures enum value "always-fresh"
+	TaskRegisterRequestConsistencyAlwaysFresh string = "always-fresh"
+)
+
+// prop value enum
+func (m *TaskRegisterRequest) validateConsistencyEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskRegisterRequestTypeConsistencyPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskRegisterRequest) validateConsistency(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Consistency) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateConsistencyEnum("consistency", "body", m.Consistency); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var taskRegisterRequestTypeDigestAlgorithmPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["md5","sha256","sha512"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskRegisterRequestTypeDigestAlgorithmPropEnum = append(taskRegisterRequestTypeDigestAlgorithmPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskRegisterRequestDigestAlgorithmMd5 captures enum value "md5"
+	TaskRegisterRequestDigestAlgorithmMd5 string = "md5"
+
+	// TaskRegisterRequestDigestAlgorithmSha256 captures enum value "sha256"
+	TaskRegisterRequestDigestAlgorithmSha256 string = "sha256"
+
+	// TaskRegisterRequestDigestAlgorithmSha512 captures enum value "sha512"
+	TaskRegisterRequestDigestAlgorithmSha512 string = "sha512"
+)
+
+// prop value enum
+func (m *TaskRegisterRequest) validateDigestAlgorithmEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskRegisterRequestTypeDigestAlgorithmPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskRegisterRequest) validateDigestAlgorithm(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.DigestAlgorithm) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateDigestAlgorithmEnum("digestAlgorithm", "body", m.DigestAlgorithm); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (m *TaskRegisterRequest) validateHostName(formats strfmt.Registry) error {
 
 	if swag.IsZero(m.HostName) { // not required
@@ -175,6 +389,52 @@ func (m *TaskRegisterRequest) validateHostName(formats strfmt.Registry) error {
 	return nil
 }
 
+var taskRegisterRequestTypePieceOrderPropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["rarest-first","sequential","random"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		taskRegisterRequestTypePieceOrderPropEnum = append(taskRegisterRequestTypePieceOrderPropEnum, v)
+	}
+}
+
+const (
+
+	// TaskRegisterRequestPieceOrderRarestFirst captures enum value "rarest-first"
+	TaskRegisterRequestPieceOrderRarestFirst string = "rarest-first"
+
+	// TaskRegisterRequestPieceOrderSequential captures enum value "sequential"
+	TaskRegisterRequestPieceOrderSequential string = "sequential"
+
+	// TaskRegisterRequestPieceOrderRandom captures enum value "random"
+	TaskRegisterRequestPieceOrderRandom string = "random"
+)
+
+// prop value enum
+func (m *TaskRegisterRequest) validatePieceOrderEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, taskRegisterRequestTypePieceOrderPropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *TaskRegisterRequest) validatePieceOrder(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.PieceOrder) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validatePieceOrderEnum("pieceOrder", "body", m.PieceOrder); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (m *TaskRegisterRequest) validatePort(formats strfmt.Registry) error {
 
 	if swag.IsZero(m.Port) { // not required
@@ -207,6 +467,23 @@ func (m *TaskRegisterRequest) validateRootCAs(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *TaskRegisterRequest) validateTags(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Tags) { // not required
+		return nil
+	}
+
+	for i := 0; i < len(m.Tags); i++ {
+
+		if err := validate.MinLength("tags"+"."+strconv.Itoa(i), "body", string(m.Tags[i]), 1); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *TaskRegisterRequest) MarshalBinary() ([]byte, error) {
 	if m == nil {
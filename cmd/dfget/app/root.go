@@ -210,6 +210,8 @@ func initFlags() {
 
 	flagSet.StringVar(&cfg.CallSystem, "callsystem", "",
 		"The name of dfget caller which is for debugging. Once set, it will be passed to all components around the request to make debugging easy")
+	flagSet.StringVar(&cfg.ClientIdentity, "clientidentity", "",
+		"The stable identity of dfget with which supernode resumes the progress when it reconnects, the client ID is used by default")
 	flagSet.StringSliceVar(&cfg.Cacerts, "cacerts", nil,
 		"The cacert file which is used to verify remote server when supernode interact with the source.")
 	flagSet.StringVarP(&cfg.Pattern, "pattern", "p", "p2p",
@@ -228,6 +230,14 @@ func initFlags() {
 		"identify whether the request is from dfdaemon")
 	flagSet.BoolVar(&cfg.Insecure, "insecure", false,
 		"identify whether supernode should skip secure verify when interact with the source.")
+	flagSet.StringSliceVar(&cfg.Tags, "tag", nil,
+		"attach a tag to the task, so that the tasks sharing a tag can be operated together, eg: --tag=release-1.0")
+	flagSet.StringVar(&cfg.RequiredRange, "required-range", "",
+		"finish as soon as the range of the file in bytes is downloaded while the rest continues on supernode, eg: --required-range=0-1048575")
+	flagSet.StringVar(&cfg.PieceOrder, "piece-order", "",
+		"the order in which the pieces are preferred to be assigned: rarest-first, sequential or random, eg: --piece-order=sequential")
+	flagSet.StringVar(&cfg.Consistency, "consistency", "",
+		"the consistency level of the content required from supernode: cached-ok, revalidate or always-fresh, eg: --consistency=revalidate")
 	flagSet.IntVar(&cfg.ClientQueueSize, "clientqueue", config.DefaultClientQueueSize,
 		"specify the size of client queue which controls the number of pieces that can be processed simultaneously")
 
@@ -19,8 +19,10 @@ package app
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
 	"reflect"
+	"syscall"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/dflog"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
@@ -70,6 +72,21 @@ func setupFlags(cmd *cobra.Command, opt *Options) {
 	flagSet.IntVar(&opt.ListenPort, "port", opt.ListenPort,
 		"ListenPort is the port supernode server listens on")
 
+	flagSet.IntVar(&opt.MaxConcurrentConnections, "max-concurrent-connections", opt.MaxConcurrentConnections,
+		"max number of client connections served at the same time, and it will be disabled if the value is not greater than 0")
+
+	flagSet.DurationVar(&opt.RetryAfterBase, "retry-after-base", opt.RetryAfterBase,
+		"least duration that the clients rejected by the connection limit or responded with 503 are told to wait before retrying")
+
+	flagSet.DurationVar(&opt.RetryAfterJitter, "retry-after-jitter", opt.RetryAfterJitter,
+		"range of the random duration added to the retry-after-base for each rejected client to spread their retries out")
+
+	flagSet.IntVar(&opt.PassthroughConnections, "passthrough-connections", opt.PassthroughConnections,
+		"number of client connections reaching which the clients registering are told to download from the sources directly, and it will be disabled if the value is not greater than 0")
+
+	flagSet.IntVar(&opt.PassthroughQueueDepth, "passthrough-queue-depth", opt.PassthroughQueueDepth,
+		"number of downloads from the sources waiting for the concurrency limits reaching which the clients registering are told to download from the sources directly, and it will be disabled if the value is not greater than 0")
+
 	flagSet.IntVar(&opt.DownloadPort, "download-port", opt.DownloadPort,
 		"DownloadPort is the port for download files from supernode")
 
@@ -102,6 +119,240 @@ func setupFlags(cmd *cobra.Command, opt *Options) {
 
 	flagSet.StringVar(&opt.AdvertiseIP, "advertise-ip", "",
 		"the supernode ip that we advertise to other peer in the p2p-network")
+
+	flagSet.StringVar(&opt.TLSCertFile, "tls-cert-file", opt.TLSCertFile,
+		"the certificate file of supernode HTTPS server, which enables HTTP/2 together with the tls-key-file")
+
+	flagSet.StringVar(&opt.TLSKeyFile, "tls-key-file", opt.TLSKeyFile,
+		"the private key file of supernode HTTPS server")
+
+	flagSet.BoolVar(&opt.EnableH2C, "enable-h2c", opt.EnableH2C,
+		"Set if supernode HTTP server accepts HTTP/2 over plaintext connections")
+
+	flagSet.IntVar(&opt.HTTP2MaxConcurrentStreams, "http2-max-concurrent-streams", opt.HTTP2MaxConcurrentStreams,
+		"the max number of concurrent streams of each HTTP/2 connection")
+
+	flagSet.DurationVar(&opt.ServerReadTimeout, "server-read-timeout", opt.ServerReadTimeout,
+		"the max duration for supernode server to read an entire request")
+
+	flagSet.DurationVar(&opt.ServerReadHeaderTimeout, "server-read-header-timeout", opt.ServerReadHeaderTimeout,
+		"the max duration for supernode server to read the headers of a request")
+
+	flagSet.DurationVar(&opt.ServerWriteTimeout, "server-write-timeout", opt.ServerWriteTimeout,
+		"the max duration for supernode server to write a response, 0 means no timeout")
+
+	flagSet.DurationVar(&opt.ServerIdleTimeout, "server-idle-timeout", opt.ServerIdleTimeout,
+		"the max duration that a client connection kept alive can be idle")
+
+	flagSet.DurationVar(&opt.MaxConnectionLifetime, "max-connection-lifetime", opt.MaxConnectionLifetime,
+		"the max duration that a HTTP/1 client connection can be reused, 0 means no limit")
+
+	flagSet.IntVar(&opt.SlowStartInitialLimit, "slow-start-initial-limit", opt.SlowStartInitialLimit,
+		"the upload limit of a newly registered peer before it ramps up to the full limit")
+
+	flagSet.IntVar(&opt.SlowStartWarmupPieces, "slow-start-warmup-pieces", opt.SlowStartWarmupPieces,
+		"the number of pieces a new peer should serve successfully to finish the slow start warmup")
+
+	flagSet.BoolVar(&opt.FailOnMissingCache, "fail-on-missing-cache", opt.FailOnMissingCache,
+		"Set if supernode fails the task rather than downloads it again when the source is not modified but the cache is missing")
+
+	flagSet.StringVar(&opt.SchedulerStrategy, "scheduler-strategy", opt.SchedulerStrategy,
+		"the name of the strategy which decides the peers that a piece should be downloaded from")
+
+	flagSet.Float64Var(&opt.SchedulerTemperature, "scheduler-temperature", opt.SchedulerTemperature,
+		"temperature of the weighted-random strategy, the lower one prefers the least loaded peers more")
+
+	flagSet.Int64Var(&opt.MaxRequestBodySize, "max-request-body-size", opt.MaxRequestBodySize,
+		"the max size in bytes of the request body that supernode accepts")
+
+	flagSet.IntVar(&opt.MaxRegisterHeaders, "max-register-headers", opt.MaxRegisterHeaders,
+		"the max number of the headers carried by a registration")
+
+	flagSet.IntVar(&opt.MaxRegisterRootCAs, "max-register-root-cas", opt.MaxRegisterRootCAs,
+		"the max number of the root CAs carried by a registration")
+
+	flagSet.IntVar(&opt.MaxTaskTags, "max-task-tags", opt.MaxTaskTags,
+		"the max number of the tags carried by a registration and kept for a task")
+
+	flagSet.StringVar(&opt.HeadUncachedPolicy, "head-uncached-policy", opt.HeadUncachedPolicy,
+		"the response to the HEAD requests on the uncached tasks, not-cached or origin")
+
+	flagSet.DurationVar(&opt.PartialContentWait, "partial-content-wait", opt.PartialContentWait,
+		"max duration that a range request on the content of a task being downloaded waits for the range to become available")
+
+	flagSet.IntVar(&opt.MaxSubscribers, "max-subscribers", opt.MaxSubscribers,
+		"max number of the subscribers of the task changes, and it will be disabled if the value is not greater than 0")
+
+	flagSet.IntVar(&opt.MaxTaskSubscribers, "max-task-subscribers", opt.MaxTaskSubscribers,
+		"max number of the subscribers of the changes of each task, and it will be disabled if the value is not greater than 0")
+
+	flagSet.DurationVar(&opt.ProgressRecomputeInterval, "progress-recompute-interval", opt.ProgressRecomputeInterval,
+		"min interval between the computations of the progress of each task pushed to its subscribers, and the changes within it are coalesced")
+
+	flagSet.StringVar(&opt.ContentServingPolicy, "content-serving-policy", opt.ContentServingPolicy,
+		"when the content of a task is served, verified or first-byte which serves it before the whole content is verified")
+
+	flagSet.StringVar(&opt.DigestAlgorithm, "digest-algorithm", opt.DigestAlgorithm,
+		"default algorithm of the digest of the whole content of the tasks, md5, sha256 or sha512")
+
+	flagSet.BoolVar(&opt.EnableDigestTrailer, "enable-digest-trailer", opt.EnableDigestTrailer,
+		"send the digest of the whole content in the trailer of the content streamed by the first-byte policy")
+
+	flagSet.BoolVar(&opt.EnableReadThroughProxy, "enable-read-through-proxy", opt.EnableReadThroughProxy,
+		"serve the files of the sources as a caching proxy, which downloads and caches the file in the GET request on it")
+
+	flagSet.BoolVar(&opt.NormalizeContentEncoding, "normalize-content-encoding", opt.NormalizeContentEncoding,
+		"decode the content encoding of the source file and store the content in the identity form")
+
+	flagSet.BoolVar(&opt.RejectCaptivePortal, "reject-captive-portal", opt.RejectCaptivePortal,
+		"reject the responses of the sources which look like the login pages of the captive portals instead of caching them")
+
+	flagSet.StringSliceVar(&opt.CaptivePortalPatterns, "captive-portal-patterns", opt.CaptivePortalPatterns,
+		"the substrings of the URLs of the known captive portals, and the responses redirected to them are rejected")
+
+	flagSet.IntVar(&opt.CDNSeedMinPeers, "cdn-seed-min-peers", opt.CDNSeedMinPeers,
+		"the min number of peers which should hold a piece before the piece is preferred to be downloaded from peers rather than supernode")
+
+	flagSet.IntVar(&opt.CDNSeedMaxLoad, "cdn-seed-max-load", opt.CDNSeedMaxLoad,
+		"the max number of pieces seeded by supernode at the same time which could have been downloaded from peers")
+
+	flagSet.StringVar(&opt.StartupDiagnosticFile, "startup-diagnostic-file", opt.StartupDiagnosticFile,
+		"the path of the file which the diagnostic record will be written to when supernode fails to start")
+
+	flagSet.Float64Var(&opt.FairnessFactor, "fairness-factor", opt.FairnessFactor,
+		"the weight from 0 to 1 of the ratio of the bytes a peer served to the bytes it consumed when scheduling the peer")
+
+	flagSet.DurationVar(&opt.AssignmentFairnessWindow, "assignment-fairness-window", opt.AssignmentFairnessWindow,
+		"the window in which the assignments of the pieces from the peers are counted for each client to share the scarce peers fairly")
+
+	flagSet.BoolVar(&opt.TolerateContentLengthMismatch, "tolerate-content-length-mismatch", opt.TolerateContentLengthMismatch,
+		"Set if supernode trusts the bytes actually received rather than fails the task when they don't match the Content-Length of the source")
+
+	flagSet.StringVar(&opt.PartialDownloadPolicy, "partial-download-policy", opt.PartialDownloadPolicy,
+		"what happens to the pieces committed when the download from the source fails, keep-for-resume or discard-on-failure")
+
+	flagSet.DurationVar(&opt.PartialDownloadTTL, "partial-download-ttl", opt.PartialDownloadTTL,
+		"duration that the pieces kept for resume are reused since the download failed, and they never expire if it's not greater than 0")
+
+	flagSet.IntVar(&opt.OriginConcurrencyLimit, "origin-concurrency-limit", opt.OriginConcurrencyLimit,
+		"max number of files downloaded from all the sources at the same time, and it will be disabled if the value is not greater than 0")
+
+	flagSet.IntVar(&opt.OriginHostConcurrencyLimit, "origin-host-concurrency-limit", opt.OriginHostConcurrencyLimit,
+		"max number of files downloaded from one host of the sources at the same time if the host is not specified in origin-host-concurrency-limits")
+
+	flagSet.StringToIntVar(&opt.OriginHostConcurrencyLimits, "origin-host-concurrency-limits", opt.OriginHostConcurrencyLimits,
+		"concurrency limits of the specified hosts of the sources, such as example.com=2,example.org:8080=4")
+
+	flagSet.IntVar(&opt.WarmHandoffClients, "warm-handoff-clients", opt.WarmHandoffClients,
+		"max number of the waiting clients which are assigned the pieces held by no peer when CDN finishes, and it will be disabled if the value is not greater than 0")
+
+	flagSet.StringSliceVar(&opt.TaskIDHeaders, "task-id-headers", opt.TaskIDHeaders,
+		"the request header names whose values are taken into account when generating the taskID")
+
+	flagSet.IntVar(&opt.PieceSize, "piece-size", opt.PieceSize,
+		"piece size of the new tasks whose files are not larger than 200MB, and the tasks downloaded partially keep their own piece sizes")
+
+	flagSet.IntVar(&opt.MaxPiecesPerTask, "max-pieces-per-task", opt.MaxPiecesPerTask,
+		"max number of pieces a file is split into, beyond which the piece size grows, and it's unlimited if not greater than 0")
+
+	flagSet.IntVar(&opt.OriginMaxHedges, "origin-max-hedges", opt.OriginMaxHedges,
+		"max number of the hedged requests to the sources in flight when originHedgeDelay is configured")
+
+	flagSet.Int64Var(&opt.OriginMaxHeaderBytes, "origin-max-header-bytes", opt.OriginMaxHeaderBytes,
+		"max size in bytes of the response headers of the sources, beyond which the request fails with a bad response")
+
+	flagSet.StringVar(&opt.SchedulerTiebreaker, "scheduler-tiebreaker", opt.SchedulerTiebreaker,
+		"tiebreaker which orders the equally good sources of a piece, which can be random, round-robin or least-recently-assigned")
+
+	flagSet.Int64Var(&opt.SchedulerSeed, "scheduler-seed", opt.SchedulerSeed,
+		"seed of the random decisions of the scheduler to reproduce the assignments, and the current time is used if it's 0")
+
+	flagSet.IntVar(&opt.OriginHostTaskLimit, "origin-host-task-limit", opt.OriginHostTaskLimit,
+		"max number of distinct tasks downloaded from one host of the sources at the same time")
+
+	flagSet.BoolVar(&opt.OriginCookieJar, "origin-cookie-jar", opt.OriginCookieJar,
+		"carry the cookies set by the source into the following requests of the same task")
+
+	flagSet.DurationVar(&opt.OriginRedirectCacheTTL, "origin-redirect-cache-ttl", opt.OriginRedirectCacheTTL,
+		"max duration to cache the final URL which the source redirects the requests of a task to, and it's disabled if not greater than 0")
+
+	flagSet.IntVar(&opt.OriginIgnoreConditionalThreshold, "origin-ignore-conditional-threshold", opt.OriginIgnoreConditionalThreshold,
+		"number of the conditional requests in a row responded 200 with the unchanged validator to recognize a host ignoring them")
+
+	flagSet.DurationVar(&opt.OriginIgnoreConditionalPeriod, "origin-ignore-conditional-period", opt.OriginIgnoreConditionalPeriod,
+		"duration to stop revalidating the files of the host ignoring the conditional requests, and it's disabled if not greater than 0")
+
+	flagSet.DurationVar(&opt.OriginIgnoreConditionalTTL, "origin-ignore-conditional-ttl", opt.OriginIgnoreConditionalTTL,
+		"duration to reuse the file of the host ignoring the conditional requests without revalidation since it was downloaded")
+
+	flagSet.StringToStringVar(&opt.OriginUnixSockets, "origin-unix-sockets", opt.OriginUnixSockets,
+		"paths of the unix domain sockets dialed for the requests to the hosts of the sources, e.g. registry.local=/var/run/registry.sock")
+
+	flagSet.StringSliceVar(&opt.OriginH2CHosts, "origin-h2c-hosts", opt.OriginH2CHosts,
+		"hosts of the sources which are requested over HTTP/2 cleartext with prior knowledge, e.g. origin.internal:8080")
+
+	flagSet.StringVar(&opt.OriginMinTLSVersion, "origin-min-tls-version", opt.OriginMinTLSVersion,
+		"min version of TLS negotiated with the sources over https, which is one of 1.0, 1.1, 1.2 and 1.3")
+
+	flagSet.StringSliceVar(&opt.OriginCipherSuites, "origin-cipher-suites", opt.OriginCipherSuites,
+		"names of the cipher suites allowed to be negotiated with the sources over TLS 1.2 and below, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+
+	flagSet.BoolVar(&opt.OriginRequireVerifiedCerts, "origin-require-verified-certs", opt.OriginRequireVerifiedCerts,
+		"always verify the certificates of the sources and refuse the insecure registrations of the tasks")
+
+	flagSet.StringSliceVar(&opt.OriginNonRetryable, "origin-non-retryable", opt.OriginNonRetryable,
+		"hosts or hosts followed by path prefixes of the sources whose requests are never retried, e.g. metered.example.com/api/")
+
+	flagSet.StringSliceVar(&opt.OriginMetadataHeaders, "origin-metadata-headers", opt.OriginMetadataHeaders,
+		"names of the headers responded by the sources which are captured into the metadata of the tasks, e.g. Content-Type,X-Content-Class")
+
+	flagSet.StringSliceVar(&opt.PinnedOriginMetadata, "pinned-origin-metadata", opt.PinnedOriginMetadata,
+		"origin metadata in the form of Name=value of the tasks which are never evicted by the purges, e.g. X-Content-Class=golden")
+
+	flagSet.Int64Var(&opt.TaskBandwidthBudget, "task-bandwidth-budget", opt.TaskBandwidthBudget,
+		"max bytes served by supernode and all peers for a task, and it's unlimited if not greater than 0")
+
+	flagSet.StringSliceVar(&opt.ReplicationPeers, "replication-peers", opt.ReplicationPeers,
+		"addresses of the peer supernodes whose cached files are replicated to serve as a warm standby")
+
+	flagSet.StringVar(&opt.ReplicationPolicy, "replication-policy", opt.ReplicationPolicy,
+		"policy of the replication which can be all, or hot which replicates the tasks registered no less than replication-min-access-count times")
+
+	flagSet.Int64Var(&opt.ReplicationMinAccessCount, "replication-min-access-count", opt.ReplicationMinAccessCount,
+		"min times of the registrations of a task on the peer supernode to replicate it with the hot policy")
+
+	flagSet.DurationVar(&opt.ReplicationInterval, "replication-interval", opt.ReplicationInterval,
+		"interval to pull the cached files from the peer supernodes")
+
+	flagSet.DurationVar(&opt.PieceDownloadTimeout, "piece-download-timeout", opt.PieceDownloadTimeout,
+		"max duration to download a piece assigned to a client before it's reassigned from an alternate source, and it's disabled if not greater than 0")
+
+	flagSet.DurationVar(&opt.ClientProgressTimeout, "client-progress-timeout", opt.ClientProgressTimeout,
+		"max duration that a client can stay without pulling or reporting the pieces before it's detached from the task, and it's disabled if not greater than 0")
+
+	flagSet.BoolVar(&opt.VerifyOnRead, "verify-on-read", opt.VerifyOnRead,
+		"verify the stored pieces against the recorded piece md5s while serving them, and evict the task whose pieces are corrupted")
+
+	flagSet.DurationVar(&opt.ScrubInterval, "scrub-interval", opt.ScrubInterval,
+		"interval to verify the cached files of the idle tasks and evict the corrupted ones, and it's disabled if not greater than 0")
+
+	flagSet.Int64Var(&opt.PieceBufferMemoryLimit, "piece-buffer-memory-limit", opt.PieceBufferMemoryLimit,
+		"max bytes of the pieces downloaded from the sources and buffered before being written, and it's disabled if not greater than 0")
+
+	flagSet.DurationVar(&opt.OrphanReclaimInterval, "orphan-reclaim-interval", opt.OrphanReclaimInterval,
+		"interval to reclaim the files in the storage which are no longer referenced by any task, and it's disabled if not greater than 0")
+
+	flagSet.DurationVar(&opt.OrphanGracePeriod, "orphan-grace-period", opt.OrphanGracePeriod,
+		"duration that an orphaned file is kept after it's modified last time before it's reclaimed")
+
+	flagSet.BoolVar(&opt.SchedulerExplain, "scheduler-explain", opt.SchedulerExplain,
+		"record how the scheduler chose the source of each piece, which can be queried for debugging")
+
+	flagSet.IntVar(&opt.TaskEventHistorySize, "task-event-history-size", opt.TaskEventHistorySize,
+		"max number of the events kept in the history of each task, and nothing is recorded if it's not greater than 0")
+
+	flagSet.DurationVar(&opt.TaskEventRetention, "task-event-retention", opt.TaskEventRetention,
+		"duration that the history of a task is kept after the task is evicted, and it's deleted with the task if not greater than 0")
 }
 
 // runSuperNode prepares configs, setups essential details and runs supernode daemon.
@@ -140,9 +391,29 @@ func runSuperNode() error {
 		return err
 	}
 
+	go reloadOnSignal(d)
+
 	return d.Run()
 }
 
+// reloadOnSignal reloads the config file when receiving SIGHUP,
+// and applies the properties which can be changed at runtime to the daemon.
+func reloadOnSignal(d *daemon.Daemon) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		newCfg := config.NewConfig()
+		if err := newCfg.Load(configFilePath); err != nil {
+			logrus.Errorf("failed to reload config file %s: %v", configFilePath, err)
+			continue
+		}
+		choosePropValue(getPureOptionFromCLI().BaseProperties, newCfg.BaseProperties)
+
+		d.Reload(newCfg)
+		logrus.Infof("success to reload config file %s", configFilePath)
+	}
+}
+
 // initLog initializes log Level and log format of daemon.
 func initLog() error {
 	logPath := path.Join(options.HomeDir, "logs", "app.log")
@@ -200,6 +471,8 @@ func choosePropValue(cliProp, cfgProp *config.BaseProperties) {
 			return v.Bool()
 		case reflect.Int:
 			return v.Int() != 0
+		case reflect.Slice, reflect.Map:
+			return v.Len() != 0
 		}
 		return false
 	}
@@ -163,6 +163,11 @@ type Config struct {
 	// CallSystem system name that executes dfget.
 	CallSystem string `json:"callSystem,omitempty"`
 
+	// ClientIdentity is the stable identity of dfget which is kept the same when it reconnects,
+	// with which supernode resumes the progress of the previous connection.
+	// The Cid will be used if it's empty.
+	ClientIdentity string `json:"clientIdentity,omitempty"`
+
 	// Pattern download pattern, must be 'p2p' or 'cdn' or 'source',
 	// default:`p2p`.
 	Pattern string `json:"pattern,omitempty"`
@@ -191,6 +196,26 @@ type Config struct {
 	// Insecure indicates whether skip secure verify when supernode interact with the source.
 	Insecure bool `json:"insecure,omitempty"`
 
+	// Tags are the labels attached to the task, so that the tasks sharing
+	// a tag can be operated together on supernode.
+	Tags []string `json:"tags,omitempty"`
+
+	// RequiredRange is the range of the file in bytes which is required, such as "0-1048575".
+	// If it's not empty, the task is registered with the partial completion policy, and
+	// dfget finishes as soon as the pieces covering the range are downloaded, without
+	// checking the md5 of the whole file.
+	RequiredRange string `json:"requiredRange,omitempty"`
+
+	// PieceOrder is the order in which the pieces are preferred to be assigned by supernode,
+	// and it's one of rarest-first, sequential and random. Supernode assigns the rarest
+	// pieces first if it's empty.
+	PieceOrder string `json:"pieceOrder,omitempty"`
+
+	// Consistency is the consistency level of the content required from supernode,
+	// and it's one of cached-ok, revalidate and always-fresh. Supernode serves the
+	// cached content as long as it's fresh if it's empty.
+	Consistency string `json:"consistency,omitempty"`
+
 	// Version show version.
 	Version bool `json:"version,omitempty"`
 
@@ -32,6 +32,7 @@ const (
 	BackSourceReasonHostSysError  = 7
 	BackSourceReasonNodeEmpty     = 8
 	BackSourceReasonSourceError   = 10
+	BackSourceReasonPassthrough   = 11
 	BackSourceReasonUserSpecified = 100
 	ForceNotBackSourceAddition    = 1000
 )
@@ -43,6 +44,12 @@ const (
 	PatternSource = "source"
 )
 
+/* completion policy of the task */
+const (
+	CompletionPolicyFull    = "full"
+	CompletionPolicyPartial = "partial"
+)
+
 /* properties */
 const (
 	DefaultYamlConfigFile  = "/etc/dragonfly/dfget.yml"
@@ -35,6 +35,7 @@ const (
 	peerReportPiecePath   = "/peer/piece/suc"
 	peerClientErrorPath   = "/peer/piece/error"
 	peerServiceDownPath   = "/peer/service/down"
+	peerLeasePath         = "/peer/lease"
 )
 
 // NewSupernodeAPI creates a new instance of SupernodeAPI with default value.
@@ -53,6 +54,7 @@ type SupernodeAPI interface {
 	ReportPiece(node string, req *types.ReportPieceRequest) (resp *types.BaseResponse, e error)
 	ServiceDown(node string, taskID string, cid string) (resp *types.BaseResponse, e error)
 	ReportClientError(node string, req *types.ClientErrorRequest) (resp *types.BaseResponse, e error)
+	RenewLease(node string, taskID string, cid string) (resp *types.BaseResponse, e error)
 }
 
 type supernodeAPI struct {
@@ -149,6 +151,25 @@ func (api *supernodeAPI) ReportClientError(node string, req *types.ClientErrorRe
 	return
 }
 
+// RenewLease renews the lease of the local client on the task to keep it
+// attached to supernode while it makes no download progress.
+func (api *supernodeAPI) RenewLease(node string, taskID string, cid string) (
+	resp *types.BaseResponse, e error) {
+
+	url := fmt.Sprintf("%s://%s%s?taskId=%s&cid=%s",
+		api.Scheme, node, peerLeasePath, taskID, cid)
+
+	resp = new(types.BaseResponse)
+	if e = api.get(url, resp); e != nil {
+		logrus.Errorf("failed to renew the lease of taskID(%s),err: %v", taskID, e)
+		return nil, e
+	}
+	if resp != nil && resp.Code != constants.CodeLeaseRenewed {
+		logrus.Warnf("failed to renew the lease of taskID(%s): api response code is %d not equal to %d", taskID, resp.Code, constants.CodeLeaseRenewed)
+	}
+	return
+}
+
 func (api *supernodeAPI) get(url string, resp interface{}) error {
 	var (
 		code int
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/dfget/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
@@ -128,6 +129,20 @@ func (s *SupernodeAPITestSuite) TestSupernodeAPI_ReportClientError(c *check.C) {
 	c.Check(r.Code, check.Equals, 700)
 }
 
+func (s *SupernodeAPITestSuite) TestSupernodeAPI_RenewLease(c *check.C) {
+	ip := "127.0.0.1"
+
+	var url string
+	s.mock.GetFunc = func(u string, timeout time.Duration) (int, []byte, error) {
+		url = u
+		return 200, []byte(`{"Code":622}`), nil
+	}
+	r, e := s.api.RenewLease(ip, "task", "cid")
+	c.Check(e, check.IsNil)
+	c.Check(r.Code, check.Equals, constants.CodeLeaseRenewed)
+	c.Check(url, check.Equals, "http://127.0.0.1/peer/lease?taskId=task&cid=cid")
+}
+
 func (s *SupernodeAPITestSuite) TestSupernodeAPI_get(c *check.C) {
 	type testRes struct {
 		A int
@@ -156,6 +156,11 @@ func registerToSuperNode(cfg *config.Config, register regist.SupernodeRegister)
 		if e.Code == constants.CodeNeedAuth {
 			return nil, e
 		}
+		if e.Code == constants.CodeSourcePassthrough && result != nil {
+			cfg.BackSourceReason = config.BackSourceReasonPassthrough
+			logrus.Warnf("register fail but download from source as told, reason:%d(%v)", cfg.BackSourceReason, e)
+			return result, nil
+		}
 		cfg.BackSourceReason = config.BackSourceReasonRegisterFail
 		panic(e.Error())
 	}
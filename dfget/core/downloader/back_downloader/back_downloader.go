@@ -47,6 +47,10 @@ type BackDownloader struct {
 	// Md5 is the expected file md5 to prevent files from being tampered with.
 	Md5 string
 
+	// Headers are the headers to download the file from the source with,
+	// and the headers of the config are used if it's nil.
+	Headers map[string]string
+
 	// TaskID a string which represents a unique task.
 	TaskID string
 
@@ -61,17 +65,25 @@ var _ downloader.Downloader = &BackDownloader{}
 // NewBackDownloader create BackDownloader
 func NewBackDownloader(cfg *config.Config, result *regist.RegisterResult) *BackDownloader {
 	var (
-		taskID string
+		taskID  string
+		url     = cfg.URL
+		headers map[string]string
 	)
 	if result != nil {
 		taskID = result.TaskID
+		// the supernodes may tell where to download the file from the source
+		if result.URL != "" {
+			url = result.URL
+		}
+		headers = result.Headers
 	}
 	return &BackDownloader{
-		cfg:    cfg,
-		URL:    cfg.URL,
-		Target: cfg.RV.RealTarget,
-		Md5:    cfg.Md5,
-		TaskID: taskID,
+		cfg:     cfg,
+		URL:     url,
+		Target:  cfg.RV.RealTarget,
+		Md5:     cfg.Md5,
+		TaskID:  taskID,
+		Headers: headers,
 	}
 }
 
@@ -101,7 +113,11 @@ func (bd *BackDownloader) Run() error {
 	bd.tempFileName = f.Name()
 	defer f.Close()
 
-	if resp, err = httputils.HTTPGet(bd.URL, netutils.ConvertHeaders(bd.cfg.Header)); err != nil {
+	headers := bd.Headers
+	if headers == nil {
+		headers = netutils.ConvertHeaders(bd.cfg.Header)
+	}
+	if resp, err = httputils.HTTPGet(bd.URL, headers); err != nil {
 		return err
 	}
 	defer resp.Body.Close()
@@ -0,0 +1,88 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/core/api"
+)
+
+// leaseRenewInterval is the interval to renew the lease of the client on the task,
+// which should be less than the ClientProgressTimeout of supernode.
+const leaseRenewInterval = 10 * time.Second
+
+// leaseRenewer renews the lease of the client on the task periodically while downloading,
+// so that the client is kept attached to supernode even if it makes no download progress
+// for a while, such as waiting for the pieces to be written to a slow disk.
+type leaseRenewer struct {
+	api      api.SupernodeAPI
+	cid      string
+	interval time.Duration
+
+	mu sync.Mutex
+	// node and taskID are changed by the downloader if the supernode is switched.
+	node   string
+	taskID string
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newLeaseRenewer(api api.SupernodeAPI, cid string, interval time.Duration) *leaseRenewer {
+	return &leaseRenewer{
+		api:      api,
+		cid:      cid,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// update sets the supernode and the task to renew the lease on.
+func (lr *leaseRenewer) update(node, taskID string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.node = node
+	lr.taskID = taskID
+}
+
+// run renews the lease every interval until it's stopped.
+func (lr *leaseRenewer) run() {
+	ticker := time.NewTicker(lr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lr.done:
+			return
+		case <-ticker.C:
+			lr.mu.Lock()
+			node, taskID := lr.node, lr.taskID
+			lr.mu.Unlock()
+			// the failure is logged by the api and the lease will be renewed next time.
+			lr.api.RenewLease(node, taskID, lr.cid)
+		}
+	}
+}
+
+// stop stops renewing the lease.
+func (lr *leaseRenewer) stop() {
+	lr.stopOnce.Do(func() {
+		close(lr.done)
+	})
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package downloader
+
+import (
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+
+	"github.com/go-check/check"
+)
+
+type LeaseRenewerTestSuite struct{}
+
+func init() {
+	check.Suite(&LeaseRenewerTestSuite{})
+}
+
+func (s *LeaseRenewerTestSuite) TestRenewLeaseUntilStopped(c *check.C) {
+	renewed := make(chan string, 10)
+	mockAPI := &helper.MockSupernodeAPI{
+		RenewLeaseFunc: func(ip string, taskID string, cid string) (*types.BaseResponse, error) {
+			renewed <- ip + "/" + taskID + "/" + cid
+			return &types.BaseResponse{Code: constants.CodeLeaseRenewed}, nil
+		},
+	}
+
+	lr := newLeaseRenewer(mockAPI, "cid", 10*time.Millisecond)
+	lr.update("node1", "task1")
+	go lr.run()
+
+	c.Assert(waitRenewed(renewed), check.Equals, "node1/task1/cid")
+
+	// the lease is renewed on the switched supernode.
+	lr.update("node2", "task2")
+	var target string
+	for i := 0; i < 3 && target != "node2/task2/cid"; i++ {
+		target = waitRenewed(renewed)
+	}
+	c.Assert(target, check.Equals, "node2/task2/cid")
+
+	lr.stop()
+	lr.stop()
+	// drain the renewal which may be in flight while stopping.
+	time.Sleep(30 * time.Millisecond)
+	for len(renewed) > 0 {
+		<-renewed
+	}
+	time.Sleep(30 * time.Millisecond)
+	c.Assert(len(renewed), check.Equals, 0)
+}
+
+func waitRenewed(renewed chan string) string {
+	select {
+	case target := <-renewed:
+		return target
+	case <-time.After(time.Second):
+		return ""
+	}
+}
@@ -18,6 +18,7 @@ package downloader
 
 import (
 	"bytes"
+	"fmt"
 	"math/rand"
 	"os"
 	"strconv"
@@ -99,6 +100,9 @@ type P2PDownloader struct {
 	// pullRateTime the time when the pull rate API is called to
 	// control the time interval between two calls to the API.
 	pullRateTime time.Time
+
+	// leaseRenewer renews the lease of the client on the task while downloading.
+	leaseRenewer *leaseRenewer
 }
 
 var _ downloader.Downloader = &P2PDownloader{}
@@ -139,6 +143,9 @@ func (p2p *P2PDownloader) init() {
 
 	p2p.rateLimiter = ratelimiter.NewRateLimiter(int64(p2p.cfg.LocalLimit), 2)
 	p2p.pullRateTime = time.Now().Add(-3 * time.Second)
+
+	p2p.leaseRenewer = newLeaseRenewer(p2p.API, p2p.cfg.RV.Cid, leaseRenewInterval)
+	p2p.leaseRenewer.update(p2p.node, p2p.taskID)
 }
 
 // Run starts to download the file.
@@ -157,6 +164,11 @@ func (p2p *P2PDownloader) Run() error {
 		clientWriter.Run()
 	}()
 
+	// keep the client attached to supernode until the download is done,
+	// including waiting for the client writer to finish.
+	go p2p.leaseRenewer.run()
+	defer p2p.leaseRenewer.stop()
+
 	for {
 		goNext, lastItem = p2p.getItem(lastItem)
 		if !goNext {
@@ -183,6 +195,9 @@ func (p2p *P2PDownloader) Run() error {
 				return nil
 			} else if code == constants.CodePeerWait {
 				continue
+			} else if code == constants.CodeTaskBudgetExceeded || code == constants.CodeTaskCanceled ||
+				code == constants.CodeTaskPoisoned {
+				return fmt.Errorf("failed to download the task: %s", response.Msg)
 			}
 
 			logrus.Warnf("request piece result:%v", response)
@@ -251,7 +266,10 @@ func (p2p *P2PDownloader) pullPieceTask(item *Piece) (
 		res.Code != constants.CodePeerFinish &&
 		res.Code != constants.CodePeerLimited &&
 		res.Code != constants.Success &&
-		res.Code != constants.CodePeerWait) {
+		res.Code != constants.CodePeerWait &&
+		res.Code != constants.CodeTaskBudgetExceeded &&
+		res.Code != constants.CodeTaskCanceled &&
+		res.Code != constants.CodeTaskPoisoned) {
 		return res, err
 	}
 
@@ -441,8 +459,15 @@ func (p2p *P2PDownloader) finishTask(response *types.PullPieceTaskResponse, clie
 		src = p2p.clientFilePath
 	}
 
+	// the md5 of the whole file can't be checked if only the required range is downloaded.
+	expectMd5 := p2p.cfg.Md5
+	if data := response.FinishData(); data != nil && data.Partial {
+		logrus.Infof("the required range %s is downloaded", p2p.cfg.RequiredRange)
+		expectMd5 = ""
+	}
+
 	// move file to the target file path.
-	if err := downloader.MoveFile(src, p2p.targetFile, p2p.cfg.Md5); err != nil {
+	if err := downloader.MoveFile(src, p2p.targetFile, expectMd5); err != nil {
 		return
 	}
 	logrus.Infof("download successfully from dragonfly")
@@ -466,5 +491,6 @@ func (p2p *P2PDownloader) refresh(item *Piece) {
 	if p2p.node != item.SuperNode {
 		p2p.node = item.SuperNode
 		p2p.taskID = item.TaskID
+		p2p.leaseRenewer.update(p2p.node, p2p.taskID)
 	}
 }
@@ -110,6 +110,9 @@ type ServiceDownFuncType func(ip string, taskID string, cid string) (*types.Base
 // ClientErrorFuncType function type of SupernodeAPI#ReportClientError
 type ClientErrorFuncType func(ip string, req *types.ClientErrorRequest) (*types.BaseResponse, error)
 
+// RenewLeaseFuncType function type of SupernodeAPI#RenewLease
+type RenewLeaseFuncType func(ip string, taskID string, cid string) (*types.BaseResponse, error)
+
 // MockSupernodeAPI mock SupernodeAPI
 type MockSupernodeAPI struct {
 	RegisterFunc    RegisterFuncType
@@ -117,6 +120,7 @@ type MockSupernodeAPI struct {
 	ReportFunc      ReportFuncType
 	ServiceDownFunc ServiceDownFuncType
 	ClientErrorFunc ClientErrorFuncType
+	RenewLeaseFunc  RenewLeaseFuncType
 }
 
 var _ api.SupernodeAPI = &MockSupernodeAPI{}
@@ -165,6 +169,15 @@ func (m *MockSupernodeAPI) ReportClientError(ip string, req *types.ClientErrorRe
 	return nil, nil
 }
 
+// RenewLease implements SupernodeAPI#RenewLease
+func (m *MockSupernodeAPI) RenewLease(ip string, taskID string, cid string) (
+	*types.BaseResponse, error) {
+	if m.RenewLeaseFunc != nil {
+		return m.RenewLeaseFunc(ip, taskID, cid)
+	}
+	return nil, nil
+}
+
 // CreateRegisterFunc creates a mock register function
 func CreateRegisterFunc() RegisterFuncType {
 	var newResponse = func(code int, msg string) *types.RegisterResponse {
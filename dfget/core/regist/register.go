@@ -57,11 +57,12 @@ func NewSupernodeRegister(cfg *config.Config, api api.SupernodeAPI) SupernodeReg
 // Register processes the flow of register.
 func (s *supernodeRegister) Register(peerPort int) (*RegisterResult, *errortypes.DfError) {
 	var (
-		resp       *types.RegisterResponse
-		e          error
-		i          int
-		retryTimes = 0
-		start      = time.Now()
+		resp        *types.RegisterResponse
+		passthrough *types.RegisterResponse
+		e           error
+		i           int
+		retryTimes  = 0
+		start       = time.Now()
 	)
 
 	logrus.Infof("do register to one of %v", s.cfg.Node)
@@ -79,6 +80,10 @@ func (s *supernodeRegister) Register(peerPort int) (*RegisterResult, *errortypes
 			resp.Code == constants.CodeURLNotReachable {
 			break
 		}
+		// try the other supernodes before downloading from the source directly
+		if resp.Code == constants.CodeSourcePassthrough && resp.Data != nil && resp.Data.Passthrough != nil {
+			passthrough = resp
+		}
 		if resp.Code == constants.CodeWaitAuth && retryTimes < 3 {
 			i--
 			retryTimes++
@@ -87,6 +92,13 @@ func (s *supernodeRegister) Register(peerPort int) (*RegisterResult, *errortypes
 		}
 	}
 	s.setRemainderNodes(i)
+	if passthrough != nil && (e != nil || resp == nil || resp.Code != constants.Success) {
+		logrus.Warnf("all the supernodes are overloaded, download from the source directly")
+		return &RegisterResult{
+			URL:     passthrough.Data.Passthrough.URL,
+			Headers: passthrough.Data.Passthrough.Headers,
+		}, errortypes.New(passthrough.Code, passthrough.Msg)
+	}
 	if err := s.checkResponse(resp, e); err != nil {
 		logrus.Errorf("register fail:%v", err)
 		return nil, err
@@ -141,6 +153,20 @@ func (s *supernodeRegister) constructRegisterRequest(port int) *types.RegisterRe
 		Headers:    cfg.Header,
 		Dfdaemon:   cfg.DFDaemon,
 		Insecure:   cfg.Insecure,
+		Tags:       cfg.Tags,
+		PieceOrder: cfg.PieceOrder,
+		// dfget is able to download the file from the source directly unless it's not allowed to.
+		AllowPassthrough: !cfg.Notbs,
+		Consistency:      cfg.Consistency,
+	}
+	if cfg.RequiredRange != "" {
+		req.CompletionPolicy = config.CompletionPolicyPartial
+		req.RequiredRange = cfg.RequiredRange
+	}
+	if cfg.ClientIdentity != "" {
+		req.ClientIdentity = cfg.ClientIdentity
+	} else {
+		req.ClientIdentity = cfg.RV.Cid
 	}
 	if cfg.Md5 != "" {
 		req.Md5 = cfg.Md5
@@ -188,6 +214,10 @@ type RegisterResult struct {
 	TaskID         string
 	FileLength     int64
 	PieceSize      int32
+
+	// Headers are the headers to download the file from the source directly,
+	// which are set only if the supernodes tell dfget to do that.
+	Headers map[string]string
 }
 
 func (r *RegisterResult) String() string {
@@ -27,6 +27,7 @@ import (
 
 	"github.com/dragonflyoss/Dragonfly/dfget/config"
 	. "github.com/dragonflyoss/Dragonfly/dfget/core/helper"
+	"github.com/dragonflyoss/Dragonfly/dfget/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/constants"
 
 	"github.com/go-check/check"
@@ -114,6 +115,46 @@ func (s *RegistTestSuite) TestSupernodeRegister_Register(c *check.C) {
 	f(constants.HTTPError, "empty response, unknown error", nil)
 }
 
+func (s *RegistTestSuite) TestSupernodeRegister_Passthrough(c *check.C) {
+	buf := &bytes.Buffer{}
+	cfg := s.createConfig(buf)
+	cfg.URL = "http://lowzj.com"
+	m := new(MockSupernodeAPI)
+	m.RegisterFunc = func(ip string, req *types.RegisterRequest) (*types.RegisterResponse, error) {
+		switch ip {
+		case "busy":
+			return &types.RegisterResponse{
+				BaseResponse: &types.BaseResponse{Code: constants.CodeSourcePassthrough, Msg: "download from source directly"},
+				Data: &types.RegisterResponseData{Passthrough: &types.PassthroughData{
+					URL:     req.RawURL,
+					Headers: map[string]string{"foo": "bar"},
+				}},
+			}, nil
+		case "idle":
+			return CreateRegisterFunc()(ip, req)
+		}
+		return nil, fmt.Errorf("connection refused")
+	}
+	register := NewSupernodeRegister(cfg, m)
+
+	// the other supernodes are tried before downloading from the source directly
+	cfg.Node = []string{"busy", "idle"}
+	result, e := register.Register(0)
+	c.Assert(e, check.IsNil)
+	c.Check(result.Node, check.Equals, "idle")
+	c.Check(result.TaskID, check.Equals, "a")
+
+	for _, nodes := range [][]string{{"busy"}, {"busy", "down"}} {
+		cfg.Node = nodes
+		result, e = register.Register(0)
+		c.Assert(e, check.NotNil)
+		c.Check(e.Code, check.Equals, constants.CodeSourcePassthrough)
+		c.Assert(result, check.NotNil)
+		c.Check(result.URL, check.Equals, cfg.URL)
+		c.Check(result.Headers, check.DeepEquals, map[string]string{"foo": "bar"})
+	}
+}
+
 func (s *RegistTestSuite) TestSupernodeRegister_constructRegisterRequest(c *check.C) {
 	buf := &bytes.Buffer{}
 	cfg := s.createConfig(buf)
@@ -128,6 +169,16 @@ func (s *RegistTestSuite) TestSupernodeRegister_constructRegisterRequest(c *chec
 	req = register.constructRegisterRequest(0)
 	c.Assert(req.Identifier, check.Equals, "")
 	c.Assert(req.Md5, check.Equals, cfg.Md5)
+	c.Assert(req.ClientIdentity, check.Equals, cfg.RV.Cid)
+
+	cfg.ClientIdentity = "identity"
+	req = register.constructRegisterRequest(0)
+	c.Assert(req.ClientIdentity, check.Equals, cfg.ClientIdentity)
+	c.Assert(req.AllowPassthrough, check.Equals, true)
+
+	cfg.Notbs = true
+	req = register.constructRegisterRequest(0)
+	c.Assert(req.AllowPassthrough, check.Equals, false)
 }
 
 // ----------------------------------------------------------------------------
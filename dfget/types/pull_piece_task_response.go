@@ -71,6 +71,8 @@ func (res *PullPieceTaskResponse) ContinueData() []*PullPieceTaskResponseContinu
 type PullPieceTaskResponseFinishData struct {
 	Md5        string `json:"md5"`
 	FileLength int64  `json:"fileLength"`
+	// Partial indicates that only the pieces covering the required range are downloaded.
+	Partial bool `json:"partial,omitempty"`
 }
 
 func (data *PullPieceTaskResponseFinishData) String() string {
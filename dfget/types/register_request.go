@@ -23,22 +23,30 @@ import (
 // RegisterRequest contains all the parameters that need to be passed to the
 // supernode when registering a downloading task.
 type RegisterRequest struct {
-	SupernodeIP string   `json:"superNodeIp"`
-	RawURL      string   `json:"rawUrl"`
-	TaskURL     string   `json:"taskUrl"`
-	Cid         string   `json:"cid"`
-	IP          string   `json:"ip"`
-	HostName    string   `json:"hostName"`
-	Port        int      `json:"port"`
-	Path        string   `json:"path"`
-	Version     string   `json:"version,omitempty"`
-	Md5         string   `json:"md5,omitempty"`
-	Identifier  string   `json:"identifier,omitempty"`
-	CallSystem  string   `json:"callSystem,omitempty"`
-	Headers     []string `json:"headers,omitempty"`
-	Dfdaemon    bool     `json:"dfdaemon,omitempty"`
-	Insecure    bool     `json:"insecure,omitempty"`
-	RootCAs     [][]byte `json:"rootCAs,omitempty"`
+	SupernodeIP    string   `json:"superNodeIp"`
+	RawURL         string   `json:"rawUrl"`
+	TaskURL        string   `json:"taskUrl"`
+	Cid            string   `json:"cid"`
+	IP             string   `json:"ip"`
+	HostName       string   `json:"hostName"`
+	Port           int      `json:"port"`
+	Path           string   `json:"path"`
+	Version        string   `json:"version,omitempty"`
+	Md5            string   `json:"md5,omitempty"`
+	Identifier     string   `json:"identifier,omitempty"`
+	CallSystem     string   `json:"callSystem,omitempty"`
+	ClientIdentity string   `json:"clientIdentity,omitempty"`
+	Headers        []string `json:"headers,omitempty"`
+	Dfdaemon       bool     `json:"dfdaemon,omitempty"`
+	Insecure       bool     `json:"insecure,omitempty"`
+	RootCAs        [][]byte `json:"rootCAs,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+
+	CompletionPolicy string `json:"completionPolicy,omitempty"`
+	RequiredRange    string `json:"requiredRange,omitempty"`
+	PieceOrder       string `json:"pieceOrder,omitempty"`
+	Consistency      string `json:"consistency,omitempty"`
+	AllowPassthrough bool   `json:"allowPassthrough,omitempty"`
 }
 
 func (r *RegisterRequest) String() string {
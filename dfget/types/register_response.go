@@ -38,4 +38,14 @@ type RegisterResponseData struct {
 	TaskID     string `json:"taskId"`
 	FileLength int64  `json:"fileLength"`
 	PieceSize  int32  `json:"pieceSize"`
+
+	// Passthrough tells dfget to download the file from the source directly
+	// since the supernode is overloaded.
+	Passthrough *PassthroughData `json:"passthrough,omitempty"`
+}
+
+// PassthroughData is the directive telling dfget how to download the file from the source.
+type PassthroughData struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
 }
@@ -37,6 +37,16 @@ func init() {
 	cmmap[CodeURLNotReachable] = "url is not reachable"
 	cmmap[CodeNeedAuth] = "need auth"
 	cmmap[CodeWaitAuth] = "wait auth"
+	cmmap[CodeTaskPurged] = "task purged"
+	cmmap[CodeRequestTooLarge] = "request too large"
+	cmmap[CodeTaskExpired] = "task expired"
+	cmmap[CodePieceOutOfRange] = "piece out of range"
+	cmmap[CodeTaskBudgetExceeded] = "task budget exceeded"
+	cmmap[CodeClientInactive] = "client inactive"
+	cmmap[CodeTaskCanceled] = "task canceled"
+	cmmap[CodeSourcePassthrough] = "download from source directly"
+	cmmap[CodeTaskPoisoned] = "task poisoned"
+	cmmap[CodeLeaseRenewed] = "lease renewed"
 }
 
 // GetMsgByCode gets the description of the code.
@@ -61,19 +71,29 @@ const (
 	CodeParamError     = 501
 	CodeTargetNotFound = 502
 
-	CodePeerFinish      = 600
-	CodePeerContinue    = 601
-	CodePeerWait        = 602
-	CodePeerLimited     = 603
-	CodeSuperFail       = 604
-	CodeUnknownError    = 605
-	CodeTaskConflict    = 606
-	CodeURLNotReachable = 607
-	CodeNeedAuth        = 608
-	CodeWaitAuth        = 609
-	CodeSourceError     = 610
-	CodeGetPieceReport  = 611
-	CodeGetPeerDown     = 612
+	CodePeerFinish         = 600
+	CodePeerContinue       = 601
+	CodePeerWait           = 602
+	CodePeerLimited        = 603
+	CodeSuperFail          = 604
+	CodeUnknownError       = 605
+	CodeTaskConflict       = 606
+	CodeURLNotReachable    = 607
+	CodeNeedAuth           = 608
+	CodeWaitAuth           = 609
+	CodeSourceError        = 610
+	CodeGetPieceReport     = 611
+	CodeGetPeerDown        = 612
+	CodeTaskPurged         = 613
+	CodeRequestTooLarge    = 614
+	CodeTaskExpired        = 615
+	CodePieceOutOfRange    = 616
+	CodeTaskBudgetExceeded = 617
+	CodeClientInactive     = 618
+	CodeTaskCanceled       = 619
+	CodeSourcePassthrough  = 620
+	CodeTaskPoisoned       = 621
+	CodeLeaseRenewed       = 622
 )
 
 /* the code of task result that dfget will report to supernode */
@@ -0,0 +1,358 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package delta
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+// The delta is the magic and the uvarint block size followed by the operations,
+// each of which is an op byte and its uvarint arguments:
+//
+//	opCopy start count: copy the count blocks of the base starting from the block start.
+//	opLiteral length data: write the length bytes of data following.
+//	opEnd: the end of the delta.
+const (
+	magic = "DFDELTA1"
+
+	opEnd     byte = 0
+	opCopy    byte = 1
+	opLiteral byte = 2
+)
+
+// maxLiteralSize bounds the unmatched bytes buffered before they are written
+// as a literal, which bounds the memory used by Compute.
+const maxLiteralSize = 256 * 1024
+
+// Stats is the statistics of a delta.
+type Stats struct {
+	// CopiedBytes is the number of bytes copied from the base.
+	CopiedBytes int64
+
+	// LiteralBytes is the number of bytes carried by the delta.
+	LiteralBytes int64
+}
+
+// Compute writes the delta, which reconstructs the target from the base with
+// the signature, into w. The target is read only once, and the delta is all
+// literal if no block of the base matches, e.g. the signature is empty.
+func Compute(sig *Signature, target io.Reader, w io.Writer) (*Stats, error) {
+	if err := sig.Validate(); err != nil {
+		return nil, err
+	}
+
+	bs := sig.BlockSize
+	m := newMatcher(sig)
+	enc := newEncoder(w)
+	if err := enc.header(bs); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReaderSize(target, 64*1024)
+	// data is the pending literal data[:lit] followed by the window data[lit:].
+	data := make([]byte, 0, maxLiteralSize+bs)
+	lit := 0
+	var rs rollingSum
+	// fill refills the window after the pending literal is written.
+	fill := func() error {
+		n, err := io.ReadFull(r, data[:bs])
+		data, lit = data[:n], 0
+		if n == bs {
+			rs = newRollingSum(data)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		return err
+	}
+
+	if err := fill(); err != nil {
+		return nil, err
+	}
+	for len(data)-lit == bs {
+		if index := m.match(rs.sum(), data[lit:]); index >= 0 {
+			if err := enc.literal(data[:lit]); err != nil {
+				return nil, err
+			}
+			if err := enc.copy(index, bs); err != nil {
+				return nil, err
+			}
+			if err := fill(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rs.roll(data[lit], c)
+		data = append(data, c)
+		lit++
+		if lit >= maxLiteralSize {
+			if err := enc.literal(data[:lit]); err != nil {
+				return nil, err
+			}
+			data, lit = data[:copy(data, data[lit:])], 0
+		}
+	}
+
+	// the short rest of the target may match the short last block of the base.
+	if rest := data[lit:]; len(rest) > 0 && len(rest) < bs {
+		if index := m.matchTail(rest); index >= 0 {
+			if err := enc.literal(data[:lit]); err != nil {
+				return nil, err
+			}
+			if err := enc.copy(index, len(rest)); err != nil {
+				return nil, err
+			}
+			data = data[:0]
+		}
+	}
+	if err := enc.literal(data); err != nil {
+		return nil, err
+	}
+	if err := enc.close(); err != nil {
+		return nil, err
+	}
+	return &enc.stats, nil
+}
+
+// Apply reconstructs the target from the base and the delta into w.
+func Apply(base io.ReaderAt, delta io.Reader, w io.Writer) error {
+	r := bufio.NewReader(delta)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return errors.Wrap(err, "failed to read the header of delta")
+	}
+	if string(header) != magic {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "magic of delta: %q", header)
+	}
+	bs, err := binary.ReadUvarint(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the block size of delta")
+	}
+	if bs < MinBlockSize || bs > MaxBlockSize {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "block size of delta: %d", bs)
+	}
+
+	buf := make([]byte, bs)
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return errors.Wrap(err, "failed to read the op of delta")
+		}
+
+		switch op {
+		case opEnd:
+			return nil
+		case opCopy:
+			start, count, err := readUvarints(r)
+			if err != nil {
+				return err
+			}
+			for i := uint64(0); i < count; i++ {
+				n, err := base.ReadAt(buf, int64((start+i)*bs))
+				if n == 0 || (err != nil && err != io.EOF) {
+					return errors.Wrapf(errortypes.ErrInvalidValue, "block %d of base: %v", start+i, err)
+				}
+				if _, err := w.Write(buf[:n]); err != nil {
+					return err
+				}
+			}
+		case opLiteral:
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				return errors.Wrap(err, "failed to read the literal length of delta")
+			}
+			if _, err := io.CopyN(w, r, int64(n)); err != nil {
+				return errors.Wrap(err, "failed to copy the literal of delta")
+			}
+		default:
+			return errors.Wrapf(errortypes.ErrInvalidValue, "op of delta: %d", op)
+		}
+	}
+}
+
+func readUvarints(r io.ByteReader) (uint64, uint64, error) {
+	a, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to read the args of delta")
+	}
+	b, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to read the args of delta")
+	}
+	return a, b, nil
+}
+
+// matcher finds the block of the base matching a window of the target.
+type matcher struct {
+	sig    *Signature
+	blocks map[uint32][]int
+	// tail is the index of the short last block, or -1 if there is none.
+	tail int
+	// next is the block following the last matched one, which is preferred
+	// among the identical blocks to merge the copies.
+	next int
+}
+
+func newMatcher(sig *Signature) *matcher {
+	m := &matcher{
+		sig:    sig,
+		blocks: make(map[uint32][]int, len(sig.Blocks)),
+		tail:   -1,
+	}
+	for i, b := range sig.Blocks {
+		if sig.blockLen(i) < sig.BlockSize {
+			m.tail = i
+			continue
+		}
+		m.blocks[b.Weak] = append(m.blocks[b.Weak], i)
+	}
+	return m
+}
+
+// match returns the index of the full block matching the window, or -1.
+func (m *matcher) match(weak uint32, window []byte) int {
+	candidates, ok := m.blocks[weak]
+	if !ok {
+		return -1
+	}
+
+	strong := strongSum(window)
+	found := -1
+	for _, i := range candidates {
+		if m.sig.Blocks[i].Strong != strong {
+			continue
+		}
+		if found < 0 || i == m.next {
+			found = i
+		}
+	}
+	if found >= 0 {
+		m.next = found + 1
+	}
+	return found
+}
+
+// matchTail returns the index of the short last block matching the rest, or -1.
+func (m *matcher) matchTail(rest []byte) int {
+	if m.tail < 0 || m.sig.blockLen(m.tail) != len(rest) {
+		return -1
+	}
+	b := m.sig.Blocks[m.tail]
+	if weakSum(rest) != b.Weak || strongSum(rest) != b.Strong {
+		return -1
+	}
+	return m.tail
+}
+
+// encoder writes the operations of a delta, and merges the copies of
+// the consecutive blocks into one.
+type encoder struct {
+	w     *bufio.Writer
+	buf   [binary.MaxVarintLen64]byte
+	start int64
+	count int64
+	stats Stats
+}
+
+func newEncoder(w io.Writer) *encoder {
+	return &encoder{w: bufio.NewWriterSize(w, 64*1024)}
+}
+
+func (e *encoder) header(blockSize int) error {
+	if _, err := e.w.WriteString(magic); err != nil {
+		return err
+	}
+	return e.uvarint(uint64(blockSize))
+}
+
+func (e *encoder) copy(index, length int) error {
+	e.stats.CopiedBytes += int64(length)
+	if e.count > 0 && e.start+e.count == int64(index) {
+		e.count++
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.start, e.count = int64(index), 1
+	return nil
+}
+
+func (e *encoder) literal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.stats.LiteralBytes += int64(len(data))
+	if err := e.w.WriteByte(opLiteral); err != nil {
+		return err
+	}
+	if err := e.uvarint(uint64(len(data))); err != nil {
+		return err
+	}
+	_, err := e.w.Write(data)
+	return err
+}
+
+func (e *encoder) flushCopy() error {
+	if e.count == 0 {
+		return nil
+	}
+	if err := e.w.WriteByte(opCopy); err != nil {
+		return err
+	}
+	if err := e.uvarint(uint64(e.start)); err != nil {
+		return err
+	}
+	if err := e.uvarint(uint64(e.count)); err != nil {
+		return err
+	}
+	e.count = 0
+	return nil
+}
+
+func (e *encoder) close() error {
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(opEnd); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *encoder) uvarint(x uint64) error {
+	n := binary.PutUvarint(e.buf[:], x)
+	_, err := e.w.Write(e.buf[:n])
+	return err
+}
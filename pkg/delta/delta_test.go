@@ -0,0 +1,177 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type DeltaTestSuite struct{}
+
+func init() {
+	check.Suite(&DeltaTestSuite{})
+}
+
+const testBlockSize = 64
+
+func (s *DeltaTestSuite) TestRollingSum(c *check.C) {
+	data := randBytes(1, 1000)
+	rs := newRollingSum(data[:testBlockSize])
+	for i := 1; i+testBlockSize <= len(data); i++ {
+		rs.roll(data[i-1], data[i+testBlockSize-1])
+		c.Assert(rs.sum(), check.Equals, weakSum(data[i:i+testBlockSize]), check.Commentf("offset: %d", i))
+	}
+}
+
+func (s *DeltaTestSuite) TestSignature(c *check.C) {
+	sig, err := NewSignature(bytes.NewReader(randBytes(2, 200)), testBlockSize)
+	c.Assert(err, check.IsNil)
+	c.Check(sig.Size, check.Equals, int64(200))
+	c.Check(len(sig.Blocks), check.Equals, 4)
+	c.Check(sig.blockLen(3), check.Equals, 8)
+
+	_, err = NewSignature(bytes.NewReader(nil), MinBlockSize-1)
+	c.Check(err, check.NotNil)
+
+	sig.Blocks = sig.Blocks[:3]
+	c.Check(sig.Validate(), check.NotNil)
+}
+
+func (s *DeltaTestSuite) TestRoundTrip(c *check.C) {
+	base := randBytes(3, 10*testBlockSize+17)
+
+	var cases = []struct {
+		name   string
+		target []byte
+	}{
+		{"same", base},
+		{"modified", replace(base, 3*testBlockSize+5, []byte("modified"))},
+		{"inserted", insert(base, 5*testBlockSize+1, randBytes(4, 100))},
+		{"deleted", append(clone(base[:2*testBlockSize+3]), base[4*testBlockSize:]...)},
+		{"appended", append(clone(base), randBytes(5, 300)...)},
+		{"truncated", base[:7*testBlockSize-9]},
+		{"empty", nil},
+	}
+	for _, tc := range cases {
+		sig, err := NewSignature(bytes.NewReader(base), testBlockSize)
+		c.Assert(err, check.IsNil)
+
+		stats, reconstructed := roundTrip(c, sig, base, tc.target)
+		c.Check(reconstructed, check.DeepEquals, tc.target, check.Commentf("case: %s", tc.name))
+		c.Check(stats.CopiedBytes+stats.LiteralBytes, check.Equals, int64(len(tc.target)),
+			check.Commentf("case: %s", tc.name))
+		if len(tc.target) > 0 {
+			c.Check(stats.LiteralBytes < int64(len(tc.target))/2, check.Equals, true,
+				check.Commentf("case: %s, stats: %+v", tc.name, stats))
+		}
+	}
+}
+
+func (s *DeltaTestSuite) TestSameCopiesAllBlocks(c *check.C) {
+	base := randBytes(6, 4*testBlockSize+10)
+	sig, err := NewSignature(bytes.NewReader(base), testBlockSize)
+	c.Assert(err, check.IsNil)
+
+	var delta bytes.Buffer
+	stats, err := Compute(sig, bytes.NewReader(base), &delta)
+	c.Assert(err, check.IsNil)
+	c.Check(stats.LiteralBytes, check.Equals, int64(0))
+	// the header, a merged copy of all the blocks and the end.
+	c.Check(delta.Len(), check.Equals, len(magic)+1+3+1)
+}
+
+func (s *DeltaTestSuite) TestUnrelatedBase(c *check.C) {
+	base := randBytes(7, 8*testBlockSize)
+	target := randBytes(8, 8*testBlockSize)
+	sig, err := NewSignature(bytes.NewReader(base), testBlockSize)
+	c.Assert(err, check.IsNil)
+
+	stats, reconstructed := roundTrip(c, sig, base, target)
+	c.Check(reconstructed, check.DeepEquals, target)
+	c.Check(stats.CopiedBytes, check.Equals, int64(0))
+	c.Check(stats.LiteralBytes, check.Equals, int64(len(target)))
+}
+
+func (s *DeltaTestSuite) TestEmptySignature(c *check.C) {
+	target := randBytes(9, maxLiteralSize*2+100)
+	sig := &Signature{BlockSize: testBlockSize}
+
+	stats, reconstructed := roundTrip(c, sig, nil, target)
+	c.Check(reconstructed, check.DeepEquals, target)
+	c.Check(stats.LiteralBytes, check.Equals, int64(len(target)))
+}
+
+func (s *DeltaTestSuite) TestApplyInvalidDelta(c *check.C) {
+	var out bytes.Buffer
+	c.Check(Apply(bytes.NewReader(nil), bytes.NewReader([]byte("invalid")), &out), check.NotNil)
+
+	// a copy of the block out of the base
+	sig := &Signature{BlockSize: testBlockSize}
+	enc := newEncoder(&out)
+	c.Assert(enc.header(sig.BlockSize), check.IsNil)
+	c.Assert(enc.copy(3, testBlockSize), check.IsNil)
+	c.Assert(enc.close(), check.IsNil)
+	c.Check(Apply(bytes.NewReader(randBytes(10, testBlockSize)), &out, &bytes.Buffer{}), check.NotNil)
+
+	// a truncated delta
+	var delta bytes.Buffer
+	_, err := Compute(sig, bytes.NewReader(randBytes(11, 100)), &delta)
+	c.Assert(err, check.IsNil)
+	truncated := bytes.NewReader(delta.Bytes()[:delta.Len()-10])
+	c.Check(Apply(bytes.NewReader(nil), truncated, &bytes.Buffer{}), check.NotNil)
+}
+
+func roundTrip(c *check.C, sig *Signature, base, target []byte) (*Stats, []byte) {
+	var delta bytes.Buffer
+	stats, err := Compute(sig, bytes.NewReader(target), &delta)
+	c.Assert(err, check.IsNil)
+
+	var out bytes.Buffer
+	c.Assert(Apply(bytes.NewReader(base), &delta, &out), check.IsNil)
+	if out.Len() == 0 {
+		return stats, nil
+	}
+	return stats, out.Bytes()
+}
+
+func randBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func clone(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
+
+func replace(b []byte, offset int, data []byte) []byte {
+	b = clone(b)
+	copy(b[offset:], data)
+	return b
+}
+
+func insert(b []byte, offset int, data []byte) []byte {
+	return append(append(clone(b[:offset]), data...), b[offset:]...)
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package delta implements the rsync-style delta between two versions of a file.
+// The holder of the old version (the base) sends the signature of its blocks,
+// and gets the delta which copies the matched blocks from the base and carries
+// the unmatched bytes literally to reconstruct the new version (the target).
+package delta
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MinBlockSize is the min size of the blocks of a signature.
+	MinBlockSize = 64
+
+	// MaxBlockSize is the max size of the blocks of a signature.
+	MaxBlockSize = 16 * 1024 * 1024
+)
+
+// BlockSignature is the signature of a block of the base.
+type BlockSignature struct {
+	// Weak is the rolling checksum of the block, which finds the candidates cheaply.
+	Weak uint32
+
+	// Strong is the md5 in hex of the block, which confirms a candidate.
+	Strong string
+}
+
+// Signature is the signature of the base split into blocks of the BlockSize,
+// and the last block may be shorter.
+type Signature struct {
+	BlockSize int
+	Size      int64
+	Blocks    []BlockSignature
+}
+
+// NewSignature computes the signature of the base read from r.
+func NewSignature(r io.Reader, blockSize int) (*Signature, error) {
+	sig := &Signature{BlockSize: blockSize}
+	if err := sig.Validate(); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sig.Blocks = append(sig.Blocks, BlockSignature{
+				Weak:   weakSum(buf[:n]),
+				Strong: strongSum(buf[:n]),
+			})
+			sig.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Validate checks the block size and whether the blocks cover the size exactly.
+func (sig *Signature) Validate() error {
+	if sig.BlockSize < MinBlockSize || sig.BlockSize > MaxBlockSize {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "block size %d out of [%d, %d]",
+			sig.BlockSize, MinBlockSize, MaxBlockSize)
+	}
+	if sig.Size < 0 {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "size %d", sig.Size)
+	}
+	if expected := (sig.Size + int64(sig.BlockSize) - 1) / int64(sig.BlockSize); int64(len(sig.Blocks)) != expected {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "%d blocks for size %d, expected %d",
+			len(sig.Blocks), sig.Size, expected)
+	}
+	for i, b := range sig.Blocks {
+		if len(b.Strong) != md5.Size*2 {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "strong sum of block %d: %q", i, b.Strong)
+		}
+	}
+	return nil
+}
+
+// blockLen returns the length of the block with the index.
+func (sig *Signature) blockLen(index int) int {
+	if rest := sig.Size - int64(index)*int64(sig.BlockSize); rest < int64(sig.BlockSize) {
+		return int(rest)
+	}
+	return sig.BlockSize
+}
+
+func (sig *Signature) String() string {
+	return fmt.Sprintf("{blockSize: %d, size: %d, blocks: %d}", sig.BlockSize, sig.Size, len(sig.Blocks))
+}
+
+// rollingSum is the rolling checksum of rsync, which is updated in constant time
+// when the window slides by one byte. Both halves are kept modulo 2^16 by the mask
+// in sum, and the overflows of uint32 don't matter since 2^16 divides 2^32.
+type rollingSum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRollingSum(block []byte) rollingSum {
+	s := rollingSum{n: uint32(len(block))}
+	for i, x := range block {
+		s.a += uint32(x)
+		s.b += (s.n - uint32(i)) * uint32(x)
+	}
+	return s
+}
+
+// roll slides the window by dropping the byte out and appending the byte in.
+func (s *rollingSum) roll(out, in byte) {
+	s.a = s.a - uint32(out) + uint32(in)
+	s.b = s.b - s.n*uint32(out) + s.a
+}
+
+func (s *rollingSum) sum() uint32 {
+	return s.a&0xffff | s.b<<16
+}
+
+func weakSum(block []byte) uint32 {
+	s := newRollingSum(block)
+	return s.sum()
+}
+
+func strongSum(block []byte) string {
+	sum := md5.Sum(block)
+	return hex.EncodeToString(sum[:])
+}
@@ -17,12 +17,47 @@
 package digest
 
 import (
+	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"hash"
 	"io"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// AlgorithmMD5 is the name of the MD5 algorithm.
+	AlgorithmMD5 = "md5"
+
+	// AlgorithmSHA256 is the name of the SHA-256 algorithm.
+	AlgorithmSHA256 = "sha256"
+
+	// AlgorithmSHA512 is the name of the SHA-512 algorithm.
+	AlgorithmSHA512 = "sha512"
 )
 
+// algorithms maps the name of a supported algorithm to the function creating its hash.
+var algorithms = map[string]func() hash.Hash{
+	AlgorithmMD5:    md5.New,
+	AlgorithmSHA256: sha256.New,
+	AlgorithmSHA512: sha512.New,
+}
+
+// NewHash returns a new hash of the algorithm,
+// and the ErrInvalidValue if the algorithm is not supported.
+func NewHash(algorithm string) (hash.Hash, error) {
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "digest algorithm: %s", algorithm)
+	}
+	return newHash(), nil
+}
+
 // Sha256 returns the SHA-256 checksum of the data.
 func Sha256(value string) string {
 	h := sha256.New()
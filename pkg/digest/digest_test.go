@@ -0,0 +1,57 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package digest
+
+import (
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type DigestTestSuite struct{}
+
+func init() {
+	check.Suite(&DigestTestSuite{})
+}
+
+func (s *DigestTestSuite) TestNewHash(c *check.C) {
+	var cases = []struct {
+		algorithm string
+		expected  string
+	}{
+		{AlgorithmMD5, "7fc8baba8e7696d6c3b286f738245592"},
+		{AlgorithmSHA256, "e2ca6aec52558fcc04311983bad03e38ca5e799c239d202ae7a4f58aff8a6970"},
+	}
+
+	for _, v := range cases {
+		h, err := NewHash(v.algorithm)
+		c.Assert(err, check.IsNil)
+		io.WriteString(h, "dragonfly")
+		c.Check(hex.EncodeToString(h.Sum(nil)), check.Equals, v.expected, check.Commentf(v.algorithm))
+	}
+
+	_, err := NewHash("crc32")
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
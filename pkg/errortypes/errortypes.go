@@ -61,6 +61,27 @@ const (
 	codeURLNotReachable
 	codeTaskIDDuplicate
 	codeAuthenticationRequired
+	codeTaskPurged
+	codeCacheMissing
+	codeRequestTooLarge
+	codeContentLengthMismatch
+	codePieceSizeMismatch
+	codeTaskExpired
+	codePieceOutOfRange
+	codeTaskBudgetExceeded
+	codeContentRangeMismatch
+	codeClientInactive
+	codeTaskCanceled
+	codeTooManyPieces
+	codeMd5Mismatch
+	codeTaskPoisoned
+	codeTooManySubscribers
+	codeSourceBadResponse
+	codeCaptivePortal
+	codeTaskPaused
+	codeContentCorrupted
+	codeTLSPolicyViolation
+	codeTaskBusy
 )
 
 // DfError represents a Dragonfly error.
@@ -45,6 +45,86 @@ var (
 
 	// ErrAuthenticationRequired represents the authentication is required.
 	ErrAuthenticationRequired = DfError{codeAuthenticationRequired, "authentication required"}
+
+	// ErrTaskPurged represents the task has been purged from the cache.
+	ErrTaskPurged = DfError{codeTaskPurged, "task purged"}
+
+	// ErrCacheMissing represents the cached file is missing while its metadata exists.
+	ErrCacheMissing = DfError{codeCacheMissing, "cache missing"}
+
+	// ErrRequestTooLarge represents the request exceeds the size limit of supernode.
+	ErrRequestTooLarge = DfError{codeRequestTooLarge, "request too large"}
+
+	// ErrContentLengthMismatch represents the length of the content received from the source
+	// doesn't match the length it declared.
+	ErrContentLengthMismatch = DfError{codeContentLengthMismatch, "content length mismatch"}
+
+	// ErrPieceSizeMismatch represents the piece size of a task doesn't match
+	// the one recorded when its file was downloaded.
+	ErrPieceSizeMismatch = DfError{codePieceSizeMismatch, "piece size mismatch"}
+
+	// ErrTaskExpired represents the incomplete task is abandoned
+	// since it has made no progress for the max task age.
+	ErrTaskExpired = DfError{codeTaskExpired, "task expired"}
+
+	// ErrPieceOutOfRange represents the piece number requested by a client
+	// is negative or not less than the piece count of the task.
+	ErrPieceOutOfRange = DfError{codePieceOutOfRange, "piece out of range"}
+
+	// ErrTaskBudgetExceeded represents the bytes served for the task
+	// have reached its bandwidth budget.
+	ErrTaskBudgetExceeded = DfError{codeTaskBudgetExceeded, "task budget exceeded"}
+
+	// ErrContentRangeMismatch represents the range of the content responded by the source
+	// doesn't match the range requested to resume the download, which usually means that
+	// the file has been changed by the source since the download was interrupted.
+	ErrContentRangeMismatch = DfError{codeContentRangeMismatch, "content range mismatch"}
+
+	// ErrClientInactive represents the client is detached from the task
+	// since it makes no progress within the ClientProgressTimeout.
+	ErrClientInactive = DfError{codeClientInactive, "client inactive"}
+
+	// ErrTaskCanceled represents the CDN download of the task is canceled
+	// and the task is abandoned.
+	ErrTaskCanceled = DfError{codeTaskCanceled, "task canceled"}
+
+	// ErrTooManyPieces represents the file of a task would be split into more pieces
+	// than the MaxPiecesPerTask with any allowed piece size.
+	ErrTooManyPieces = DfError{codeTooManyPieces, "too many pieces"}
+
+	// ErrMd5Mismatch represents the md5 of the file downloaded from the source
+	// doesn't match the expected one.
+	ErrMd5Mismatch = DfError{codeMd5Mismatch, "md5 mismatch"}
+
+	// ErrTaskPoisoned represents the task whose content was served before it failed
+	// the final verification, and the task is refused until it's purged.
+	ErrTaskPoisoned = DfError{codeTaskPoisoned, "task poisoned"}
+
+	// ErrTooManySubscribers represents the subscribers of the task changes reach the limit.
+	ErrTooManySubscribers = DfError{codeTooManySubscribers, "too many subscribers"}
+
+	// ErrSourceBadResponse represents the response of the source is malformed
+	// or exceeds the limits of supernode, such as the size of its headers.
+	ErrSourceBadResponse = DfError{codeSourceBadResponse, "source bad response"}
+
+	// ErrCaptivePortal represents the response of the source looks like the login page
+	// of a captive portal intercepting the download instead of the file.
+	ErrCaptivePortal = DfError{codeCaptivePortal, "captive portal"}
+
+	// ErrTaskPaused represents the CDN download of the task is paused by the administrator.
+	ErrTaskPaused = DfError{codeTaskPaused, "task paused"}
+
+	// ErrContentCorrupted represents the stored pieces of the task differ from
+	// the piece md5s recorded when they were downloaded.
+	ErrContentCorrupted = DfError{codeContentCorrupted, "content corrupted"}
+
+	// ErrTLSPolicyViolation represents the connection to the source fails since it can't
+	// negotiate the TLS parameters or present the certificate required by the TLS policy of supernode.
+	ErrTLSPolicyViolation = DfError{codeTLSPolicyViolation, "tls policy violation"}
+
+	// ErrTaskBusy represents the task can't be downloaded again for the consistency
+	// required by a registration since other clients are still downloading it.
+	ErrTaskBusy = DfError{codeTaskBusy, "task busy"}
 )
 
 // IsSystemError check the error is a system error or not.
@@ -91,3 +171,108 @@ func IsTaskIDDuplicate(err error) bool {
 func IsAuthenticationRequired(err error) bool {
 	return checkError(err, codeAuthenticationRequired)
 }
+
+// IsTaskPurged check the error is a TaskPurged error or not.
+func IsTaskPurged(err error) bool {
+	return checkError(err, codeTaskPurged)
+}
+
+// IsCacheMissing check the error is a CacheMissing error or not.
+func IsCacheMissing(err error) bool {
+	return checkError(err, codeCacheMissing)
+}
+
+// IsRequestTooLarge check the error is a RequestTooLarge error or not.
+func IsRequestTooLarge(err error) bool {
+	return checkError(err, codeRequestTooLarge)
+}
+
+// IsContentLengthMismatch check the error is a ContentLengthMismatch error or not.
+func IsContentLengthMismatch(err error) bool {
+	return checkError(err, codeContentLengthMismatch)
+}
+
+// IsPieceSizeMismatch check the error is a PieceSizeMismatch error or not.
+func IsPieceSizeMismatch(err error) bool {
+	return checkError(err, codePieceSizeMismatch)
+}
+
+// IsTaskExpired check the error is a TaskExpired error or not.
+func IsTaskExpired(err error) bool {
+	return checkError(err, codeTaskExpired)
+}
+
+// IsPieceOutOfRange check the error is a PieceOutOfRange error or not.
+func IsPieceOutOfRange(err error) bool {
+	return checkError(err, codePieceOutOfRange)
+}
+
+// IsTaskBudgetExceeded check the error is a TaskBudgetExceeded error or not.
+func IsTaskBudgetExceeded(err error) bool {
+	return checkError(err, codeTaskBudgetExceeded)
+}
+
+// IsContentRangeMismatch check the error is a ContentRangeMismatch error or not.
+func IsContentRangeMismatch(err error) bool {
+	return checkError(err, codeContentRangeMismatch)
+}
+
+// IsClientInactive check the error is a ClientInactive error or not.
+func IsClientInactive(err error) bool {
+	return checkError(err, codeClientInactive)
+}
+
+// IsTaskCanceled check the error is a TaskCanceled error or not.
+func IsTaskCanceled(err error) bool {
+	return checkError(err, codeTaskCanceled)
+}
+
+// IsTooManyPieces check the error is a TooManyPieces error or not.
+func IsTooManyPieces(err error) bool {
+	return checkError(err, codeTooManyPieces)
+}
+
+// IsMd5Mismatch check the error is a Md5Mismatch error or not.
+func IsMd5Mismatch(err error) bool {
+	return checkError(err, codeMd5Mismatch)
+}
+
+// IsTaskPoisoned check the error is a TaskPoisoned error or not.
+func IsTaskPoisoned(err error) bool {
+	return checkError(err, codeTaskPoisoned)
+}
+
+// IsTooManySubscribers check the error is a TooManySubscribers error or not.
+func IsTooManySubscribers(err error) bool {
+	return checkError(err, codeTooManySubscribers)
+}
+
+// IsSourceBadResponse check the error is a SourceBadResponse error or not.
+func IsSourceBadResponse(err error) bool {
+	return checkError(err, codeSourceBadResponse)
+}
+
+// IsCaptivePortal check the error is a CaptivePortal error or not.
+func IsCaptivePortal(err error) bool {
+	return checkError(err, codeCaptivePortal)
+}
+
+// IsTaskPaused check the error is a TaskPaused error or not.
+func IsTaskPaused(err error) bool {
+	return checkError(err, codeTaskPaused)
+}
+
+// IsContentCorrupted check the error is a ContentCorrupted error or not.
+func IsContentCorrupted(err error) bool {
+	return checkError(err, codeContentCorrupted)
+}
+
+// IsTLSPolicyViolation check the error is a TLSPolicyViolation error or not.
+func IsTLSPolicyViolation(err error) bool {
+	return checkError(err, codeTLSPolicyViolation)
+}
+
+// IsTaskBusy check the error is a TaskBusy error or not.
+func IsTaskBusy(err error) bool {
+	return checkError(err, codeTaskBusy)
+}
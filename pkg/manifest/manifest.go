@@ -0,0 +1,182 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package manifest implements the piece hash manifest of a task and its compact
+// binary encoding, which is the fixed-width hashes of the pieces ordered by piece number
+// following a small header:
+//
+//	offset  size  field
+//	0       4     magic "DFPM"
+//	4       1     version
+//	5       1     algorithm
+//	6       1     size of a hash in bytes
+//	7       1     reserved
+//	8       4     piece size, big endian
+//	12      4     piece count, big endian
+//	16      -     hashes
+package manifest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ContentType is the content type of the binary encoded manifest.
+	ContentType = "application/vnd.dragonfly.piece-manifest"
+
+	// AlgorithmMD5 represents the hashes of the pieces are md5s.
+	AlgorithmMD5 = "md5"
+
+	version    = 1
+	headerSize = 16
+)
+
+var magic = []byte("DFPM")
+
+// algorithm describes a hash algorithm in the binary encoding.
+type algorithm struct {
+	name string
+	id   byte
+	size int
+}
+
+var algorithms = []algorithm{
+	{name: AlgorithmMD5, id: 1, size: 16},
+}
+
+// Manifest contains the hashes of all pieces of a task.
+type Manifest struct {
+	// Algorithm is the hash algorithm of the pieces.
+	Algorithm string
+
+	// PieceSize is the piece size of the task.
+	PieceSize int32
+
+	// Hashes is the hashes of the pieces ordered by piece number.
+	Hashes [][]byte
+}
+
+// New returns a new Manifest with the hex encoded hashes of the pieces.
+func New(algorithmName string, pieceSize int32, hexHashes []string) (*Manifest, error) {
+	alg, err := getAlgorithmByName(algorithmName)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([][]byte, 0, len(hexHashes))
+	for i, h := range hexHashes {
+		hash, err := hex.DecodeString(h)
+		if err != nil || len(hash) != alg.size {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "%s of pieceNum %d: %s", alg.name, i, h)
+		}
+		hashes = append(hashes, hash)
+	}
+	return &Manifest{
+		Algorithm: alg.name,
+		PieceSize: pieceSize,
+		Hashes:    hashes,
+	}, nil
+}
+
+// HexHashes returns the hex encoded hashes of the pieces.
+func (m *Manifest) HexHashes() []string {
+	result := make([]string, 0, len(m.Hashes))
+	for _, hash := range m.Hashes {
+		result = append(result, hex.EncodeToString(hash))
+	}
+	return result
+}
+
+// MarshalBinary encodes the manifest in the compact binary format.
+func (m *Manifest) MarshalBinary() ([]byte, error) {
+	alg, err := getAlgorithmByName(m.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, headerSize, headerSize+len(m.Hashes)*alg.size)
+	copy(data, magic)
+	data[4] = version
+	data[5] = alg.id
+	data[6] = byte(alg.size)
+	binary.BigEndian.PutUint32(data[8:], uint32(m.PieceSize))
+	binary.BigEndian.PutUint32(data[12:], uint32(len(m.Hashes)))
+	for i, hash := range m.Hashes {
+		if len(hash) != alg.size {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "size of the hash of pieceNum %d: %d", i, len(hash))
+		}
+		data = append(data, hash...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes the manifest from the compact binary format.
+func (m *Manifest) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize || !bytes.Equal(data[:4], magic) {
+		return errors.Wrap(errortypes.ErrInvalidValue, "not a piece manifest")
+	}
+	if data[4] != version {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "version: %d", data[4])
+	}
+	alg, err := getAlgorithmByID(data[5])
+	if err != nil {
+		return err
+	}
+	if int(data[6]) != alg.size {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "size of the %s hash: %d", alg.name, data[6])
+	}
+
+	count := int(binary.BigEndian.Uint32(data[12:]))
+	if len(data)-headerSize != count*alg.size {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "%d bytes of hashes for %d pieces", len(data)-headerSize, count)
+	}
+
+	hashes := make([][]byte, 0, count)
+	for offset := headerSize; offset < len(data); offset += alg.size {
+		hash := make([]byte, alg.size)
+		copy(hash, data[offset:])
+		hashes = append(hashes, hash)
+	}
+
+	m.Algorithm = alg.name
+	m.PieceSize = int32(binary.BigEndian.Uint32(data[8:]))
+	m.Hashes = hashes
+	return nil
+}
+
+func getAlgorithmByName(name string) (algorithm, error) {
+	for _, alg := range algorithms {
+		if alg.name == name {
+			return alg, nil
+		}
+	}
+	return algorithm{}, errors.Wrapf(errortypes.ErrInvalidValue, "algorithm: %s", name)
+}
+
+func getAlgorithmByID(id byte) (algorithm, error) {
+	for _, alg := range algorithms {
+		if alg.id == id {
+			return alg, nil
+		}
+	}
+	return algorithm{}, errors.Wrapf(errortypes.ErrInvalidValue, "algorithm: %d", id)
+}
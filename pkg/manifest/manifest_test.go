@@ -0,0 +1,103 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manifest
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type ManifestTestSuite struct{}
+
+func init() {
+	check.Suite(&ManifestTestSuite{})
+}
+
+func genPieceMD5s(count int) []string {
+	pieceMD5s := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		pieceMD5s = append(pieceMD5s, fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("piece-%d", i)))))
+	}
+	return pieceMD5s
+}
+
+func (s *ManifestTestSuite) TestRoundTrip(c *check.C) {
+	for _, count := range []int{0, 1, 17, 1000} {
+		pieceMD5s := genPieceMD5s(count)
+		m, err := New(AlgorithmMD5, 4*1024*1024, pieceMD5s)
+		c.Assert(err, check.IsNil)
+
+		data, err := m.MarshalBinary()
+		c.Assert(err, check.IsNil)
+		c.Check(data, check.HasLen, headerSize+16*count)
+
+		decoded := &Manifest{}
+		c.Assert(decoded.UnmarshalBinary(data), check.IsNil)
+		c.Check(decoded.Algorithm, check.Equals, AlgorithmMD5)
+		c.Check(decoded.PieceSize, check.Equals, int32(4*1024*1024))
+		c.Check(decoded.HexHashes(), check.DeepEquals, pieceMD5s)
+	}
+}
+
+func (s *ManifestTestSuite) TestSmallerThanJSON(c *check.C) {
+	pieceMD5s := genPieceMD5s(1000)
+	m, err := New(AlgorithmMD5, 4*1024*1024, pieceMD5s)
+	c.Assert(err, check.IsNil)
+
+	data, err := m.MarshalBinary()
+	c.Assert(err, check.IsNil)
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"algorithm":  m.Algorithm,
+		"hashes":     m.HexHashes(),
+		"pieceCount": len(m.Hashes),
+		"pieceSize":  m.PieceSize,
+	})
+	c.Assert(err, check.IsNil)
+	// the raw hashes take half of the bytes of the hex encoded ones at least
+	c.Check(len(data)*2 < len(jsonData), check.Equals, true,
+		check.Commentf("binary: %d, json: %d", len(data), len(jsonData)))
+}
+
+func (s *ManifestTestSuite) TestInvalid(c *check.C) {
+	_, err := New("sha1", 1024, nil)
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+	_, err = New(AlgorithmMD5, 1024, []string{"not a md5"})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+
+	m, err := New(AlgorithmMD5, 1024, genPieceMD5s(2))
+	c.Assert(err, check.IsNil)
+	data, err := m.MarshalBinary()
+	c.Assert(err, check.IsNil)
+
+	decoded := &Manifest{}
+	// truncated hashes
+	c.Check(errortypes.IsInvalidValue(decoded.UnmarshalBinary(data[:len(data)-1])), check.Equals, true)
+	// truncated header
+	c.Check(errortypes.IsInvalidValue(decoded.UnmarshalBinary(data[:headerSize-1])), check.Equals, true)
+	// unknown magic
+	c.Check(errortypes.IsInvalidValue(decoded.UnmarshalBinary(append([]byte("JSON"), data[4:]...))), check.Equals, true)
+}
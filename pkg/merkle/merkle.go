@@ -0,0 +1,175 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package merkle implements a Merkle tree over the hashes of pieces,
+// which allows to verify a piece against the root hash with its proof path
+// and to localize the corrupted pieces by comparing two trees.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// Tree is a Merkle tree whose leaves are the hashes of pieces.
+// The unpaired node of a level is promoted to the upper level directly.
+type Tree struct {
+	// levels[0] is the hashes of leaves and the last level contains the root only.
+	levels [][][]byte
+}
+
+// NewTree builds a Merkle tree with the hashes of pieces ordered by piece number.
+func NewTree(pieceHashes []string) *Tree {
+	if len(pieceHashes) == 0 {
+		return &Tree{}
+	}
+
+	leaves := make([][]byte, len(pieceHashes))
+	for i, h := range pieceHashes {
+		leaves[i] = hashLeaf(h)
+	}
+
+	levels := [][][]byte{leaves}
+	for current := leaves; len(current) > 1; {
+		next := make([][]byte, 0, (len(current)+1)/2)
+		for i := 0; i < len(current); i += 2 {
+			if i+1 < len(current) {
+				next = append(next, hashNode(current[i], current[i+1]))
+			} else {
+				next = append(next, current[i])
+			}
+		}
+		levels = append(levels, next)
+		current = next
+	}
+	return &Tree{levels: levels}
+}
+
+// Root returns the root hash of the tree, and nil if the tree is empty.
+func (t *Tree) Root() []byte {
+	if len(t.levels) == 0 {
+		return nil
+	}
+	return t.levels[len(t.levels)-1][0]
+}
+
+// LeafCount returns the count of pieces in the tree.
+func (t *Tree) LeafCount() int {
+	if len(t.levels) == 0 {
+		return 0
+	}
+	return len(t.levels[0])
+}
+
+// Proof returns the sibling hashes from the leaf of pieceNum up to the root.
+func (t *Tree) Proof(pieceNum int) ([][]byte, error) {
+	if pieceNum < 0 || pieceNum >= t.LeafCount() {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "pieceNum %d out of range [0, %d)", pieceNum, t.LeafCount())
+	}
+
+	var proof [][]byte
+	index := pieceNum
+	for level := 0; level < len(t.levels)-1; level++ {
+		nodes := t.levels[level]
+		if index%2 == 1 {
+			proof = append(proof, nodes[index-1])
+		} else if index+1 < len(nodes) {
+			proof = append(proof, nodes[index+1])
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// Verify returns whether the piece with the pieceHash and pieceNum belongs to
+// the tree with the root and pieceCount according to the proof.
+func Verify(root []byte, pieceHash string, pieceNum, pieceCount int, proof [][]byte) bool {
+	if pieceNum < 0 || pieceNum >= pieceCount {
+		return false
+	}
+
+	h := hashLeaf(pieceHash)
+	index, count := pieceNum, pieceCount
+	for count > 1 {
+		if index%2 == 1 || index+1 < count {
+			if len(proof) == 0 {
+				return false
+			}
+			if index%2 == 1 {
+				h = hashNode(proof[0], h)
+			} else {
+				h = hashNode(h, proof[0])
+			}
+			proof = proof[1:]
+		}
+		index /= 2
+		count = (count + 1) / 2
+	}
+	return len(proof) == 0 && bytes.Equal(h, root)
+}
+
+// Diff returns the piece numbers whose hashes differ between the two trees,
+// which only descends into the subtrees with different hashes.
+// It returns an error if the two trees have different count of pieces.
+func (t *Tree) Diff(other *Tree) ([]int, error) {
+	if t.LeafCount() != other.LeafCount() {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "piece count %d not equals %d", t.LeafCount(), other.LeafCount())
+	}
+
+	var pieceNums []int
+	var walk func(level, index int)
+	walk = func(level, index int) {
+		if bytes.Equal(t.levels[level][index], other.levels[level][index]) {
+			return
+		}
+		if level == 0 {
+			pieceNums = append(pieceNums, index)
+			return
+		}
+		walk(level-1, 2*index)
+		if 2*index+1 < len(t.levels[level-1]) {
+			walk(level-1, 2*index+1)
+		}
+	}
+	if len(t.levels) > 0 {
+		walk(len(t.levels)-1, 0)
+	}
+	return pieceNums, nil
+}
+
+func hashLeaf(pieceHash string) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write([]byte(pieceHash))
+	return h.Sum(nil)
+}
+
+func hashNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
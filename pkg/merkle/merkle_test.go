@@ -0,0 +1,116 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package merkle
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-check/check"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type MerkleTestSuite struct{}
+
+func init() {
+	check.Suite(&MerkleTestSuite{})
+}
+
+func (s *MerkleTestSuite) TestEmptyTree(c *check.C) {
+	tree := NewTree(nil)
+	c.Check(tree.Root(), check.IsNil)
+	c.Check(tree.LeafCount(), check.Equals, 0)
+	_, err := tree.Proof(0)
+	c.Check(err, check.NotNil)
+}
+
+func (s *MerkleTestSuite) TestProofAndVerify(c *check.C) {
+	for pieceCount := 1; pieceCount <= 17; pieceCount++ {
+		pieceMD5s := genPieceMD5s(pieceCount)
+		tree := NewTree(pieceMD5s)
+		c.Assert(tree.LeafCount(), check.Equals, pieceCount)
+
+		for pieceNum := 0; pieceNum < pieceCount; pieceNum++ {
+			proof, err := tree.Proof(pieceNum)
+			c.Assert(err, check.IsNil)
+			c.Check(Verify(tree.Root(), pieceMD5s[pieceNum], pieceNum, pieceCount, proof), check.Equals, true,
+				check.Commentf("pieceCount: %d, pieceNum: %d", pieceCount, pieceNum))
+
+			// a corrupted piece
+			c.Check(Verify(tree.Root(), "corrupted", pieceNum, pieceCount, proof), check.Equals, false)
+			// a piece at the wrong position
+			if pieceCount > 1 {
+				c.Check(Verify(tree.Root(), pieceMD5s[pieceNum], (pieceNum+1)%pieceCount, pieceCount, proof), check.Equals, false)
+			}
+		}
+	}
+}
+
+func (s *MerkleTestSuite) TestVerifyWithInvalidProof(c *check.C) {
+	pieceMD5s := genPieceMD5s(5)
+	tree := NewTree(pieceMD5s)
+	proof, err := tree.Proof(2)
+	c.Assert(err, check.IsNil)
+
+	c.Check(Verify(tree.Root(), pieceMD5s[2], 2, 5, proof[:len(proof)-1]), check.Equals, false)
+	c.Check(Verify(tree.Root(), pieceMD5s[2], 2, 5, append(proof, proof[0])), check.Equals, false)
+	c.Check(Verify(tree.Root(), pieceMD5s[2], 5, 5, proof), check.Equals, false)
+	c.Check(Verify(tree.Root(), pieceMD5s[2], -1, 5, proof), check.Equals, false)
+
+	// the promoted piece has a different path with another pieceCount
+	proof, err = tree.Proof(4)
+	c.Assert(err, check.IsNil)
+	c.Check(Verify(tree.Root(), pieceMD5s[4], 4, 5, proof), check.Equals, true)
+	c.Check(Verify(tree.Root(), pieceMD5s[4], 4, 6, proof), check.Equals, false)
+
+	// the proof of a piece of the prefix tree does not match the tree with more pieces
+	prefixTree := NewTree(pieceMD5s[:4])
+	prefixProof, err := prefixTree.Proof(2)
+	c.Assert(err, check.IsNil)
+	c.Check(Verify(prefixTree.Root(), pieceMD5s[2], 2, 4, prefixProof), check.Equals, true)
+	c.Check(Verify(tree.Root(), pieceMD5s[2], 2, 5, prefixProof), check.Equals, false)
+}
+
+func (s *MerkleTestSuite) TestDiff(c *check.C) {
+	pieceMD5s := genPieceMD5s(11)
+	tree := NewTree(pieceMD5s)
+
+	pieceNums, err := tree.Diff(NewTree(genPieceMD5s(11)))
+	c.Check(err, check.IsNil)
+	c.Check(pieceNums, check.HasLen, 0)
+
+	corrupted := genPieceMD5s(11)
+	corrupted[3] = "corrupted"
+	corrupted[10] = "corrupted"
+	pieceNums, err = tree.Diff(NewTree(corrupted))
+	c.Check(err, check.IsNil)
+	c.Check(pieceNums, check.DeepEquals, []int{3, 10})
+
+	_, err = tree.Diff(NewTree(pieceMD5s[:10]))
+	c.Check(err, check.NotNil)
+}
+
+func genPieceMD5s(count int) []string {
+	pieceMD5s := make([]string, count)
+	for i := 0; i < count; i++ {
+		pieceMD5s[i] = fmt.Sprintf("%032x:%d", i, 4*1024*1024)
+	}
+	return pieceMD5s
+}
@@ -260,6 +260,43 @@ func ConvertTimeIntToString(timestamp int64) (string, error) {
 	return fmt.Sprintf("%s%s", timeString[:len(timeString)-3], layoutGMT), nil
 }
 
+// FreshnessLifetime returns the duration that the response received at responseTime
+// allows itself to be reused without revalidation according to its Cache-Control and Expires,
+// and false if the header carries neither of them.
+// The response with the no-store or no-cache directive is never fresh.
+func FreshnessLifetime(header http.Header, responseTime time.Time) (time.Duration, bool) {
+	if cacheControl := header.Get("Cache-Control"); cacheControl != "" {
+		for _, directive := range strings.Split(cacheControl, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if directive == "no-store" || directive == "no-cache" {
+				return 0, true
+			}
+			if strings.HasPrefix(directive, "max-age=") {
+				seconds, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64)
+				if err != nil || seconds < 0 {
+					return 0, true
+				}
+				return time.Duration(seconds) * time.Second, true
+			}
+		}
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		expireAt, err := http.ParseTime(expires)
+		if err != nil {
+			return 0, true
+		}
+		return expireAt.Sub(responseTime), true
+	}
+	return 0, false
+}
+
+// IsWeakETag returns whether the eTag is a weak validator prefixed with "W/",
+// which can be used to revalidate the whole response but not a range of it.
+func IsWeakETag(eTag string) bool {
+	return strings.HasPrefix(strings.TrimSpace(eTag), "W/")
+}
+
 // slice2Map translate a slice to a map with
 // the value in slice as the key and true as the value.
 func slice2Map(value []string) map[string]bool {
@@ -18,7 +18,9 @@ package netutils
 
 import (
 	"fmt"
+	"net/http"
 	"runtime"
+	"time"
 
 	"github.com/go-check/check"
 )
@@ -216,3 +218,43 @@ func (suite *UtilSuite) TestConvertTimeIntToString(c *check.C) {
 	c.Check(err, check.IsNil)
 	c.Check(result, check.Equals, "Fri, 15 Jun 2018 14:40:41 GMT")
 }
+
+func (suite *UtilSuite) TestFreshnessLifetime(c *check.C) {
+	responseTime := time.Unix(1529073641, 0)
+	var cases = []struct {
+		cacheControl string
+		expires      string
+		lifetime     time.Duration
+		ok           bool
+	}{
+		{lifetime: 0, ok: false},
+		{cacheControl: "public, max-age=60", lifetime: time.Minute, ok: true},
+		{cacheControl: "Max-Age=60", expires: "Fri, 15 Jun 2018 15:40:41 GMT", lifetime: time.Minute, ok: true},
+		{cacheControl: "no-cache, max-age=60", lifetime: 0, ok: true},
+		{cacheControl: "no-store", lifetime: 0, ok: true},
+		{cacheControl: "max-age=foo", lifetime: 0, ok: true},
+		{cacheControl: "public", expires: "Fri, 15 Jun 2018 15:40:41 GMT", lifetime: time.Hour, ok: true},
+		{expires: "0", lifetime: 0, ok: true},
+	}
+
+	for _, v := range cases {
+		header := http.Header{}
+		if v.cacheControl != "" {
+			header.Set("Cache-Control", v.cacheControl)
+		}
+		if v.expires != "" {
+			header.Set("Expires", v.expires)
+		}
+		lifetime, ok := FreshnessLifetime(header, responseTime)
+		c.Check(lifetime, check.Equals, v.lifetime, check.Commentf("%v", v))
+		c.Check(ok, check.Equals, v.ok, check.Commentf("%v", v))
+	}
+}
+
+func (suite *UtilSuite) TestIsWeakETag(c *check.C) {
+	c.Check(IsWeakETag(`W/"foo"`), check.Equals, true)
+	c.Check(IsWeakETag(` W/"foo"`), check.Equals, true)
+	c.Check(IsWeakETag(`"foo"`), check.Equals, false)
+	c.Check(IsWeakETag(`"W/foo"`), check.Equals, false)
+	c.Check(IsWeakETag(""), check.Equals, false)
+}
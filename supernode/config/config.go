@@ -88,21 +88,61 @@ func (c *Config) IsSuperPID(peerID string) bool {
 func NewBaseProperties() *BaseProperties {
 	home := filepath.Join(string(filepath.Separator), "home", "admin", "supernode")
 	return &BaseProperties{
-		ListenPort:              8002,
-		DownloadPort:            8001,
-		HomeDir:                 home,
-		SchedulerCorePoolSize:   10,
-		DownloadPath:            filepath.Join(home, "repo", "download"),
-		PeerUpLimit:             5,
-		PeerDownLimit:           5,
-		EliminationLimit:        5,
-		FailureCountLimit:       5,
-		LinkLimit:               20,
-		SystemReservedBandwidth: 20,
-		MaxBandwidth:            200,
-		EnableProfiler:          false,
-		Debug:                   false,
-		FailAccessInterval:      3,
+		ListenPort:                8002,
+		DownloadPort:              8001,
+		HomeDir:                   home,
+		SchedulerCorePoolSize:     10,
+		DownloadPath:              filepath.Join(home, "repo", "download"),
+		PeerUpLimit:               5,
+		PeerDownLimit:             5,
+		EliminationLimit:          5,
+		FailureCountLimit:         5,
+		LinkLimit:                 20,
+		SystemReservedBandwidth:   20,
+		MaxBandwidth:              200,
+		EnableProfiler:            false,
+		Debug:                     false,
+		RetryAfterBase:            time.Second,
+		RetryAfterJitter:          2 * time.Second,
+		FailAccessInterval:        3,
+		ProgressCompactInterval:   10 * time.Minute,
+		ProgressCompactRatio:      1.0,
+		ProgressMapMetricsSample:  100,
+		HTTP2MaxConcurrentStreams: 256,
+		ServerReadTimeout:         DefaultServerTimeout,
+		ServerReadHeaderTimeout:   DefaultServerTimeout,
+		ServerIdleTimeout:         DefaultServerTimeout,
+		SlowStartInitialLimit:     1,
+		SlowStartWarmupPieces:     10,
+		SchedulerStrategy:         "default",
+		SchedulerTemperature:      1,
+		MaxRequestBodySize:        4 * 1024 * 1024,
+		MaxRegisterHeaders:        128,
+		MaxRegisterRootCAs:        32,
+		MaxTaskTags:               16,
+		HeadUncachedPolicy:        HeadUncachedNotCached,
+		ContentServingPolicy:      ContentServingVerified,
+		MaxSubscribers:            10000,
+		MaxTaskSubscribers:        1000,
+		ProgressRecomputeInterval: 100 * time.Millisecond,
+		ClientIdentityTTL:         5 * time.Minute,
+		PieceSize:                 DefaultPieceSize,
+		OriginMaxHedges:           4,
+		OriginMaxHeaderBytes:      DefaultOriginMaxHeaderBytes,
+		SchedulerTiebreaker:       "least-recently-assigned",
+		ReplicationPolicy:         "all",
+		ReplicationMinAccessCount: 2,
+		ReplicationInterval:       5 * time.Minute,
+		CDNSeedMaxLoad:            50,
+		DigestAlgorithm:           "md5",
+		OrphanGracePeriod:         time.Hour,
+		TaskEventHistorySize:      64,
+		TaskEventRetention:        10 * time.Minute,
+		PartialDownloadPolicy:     PartialDownloadKeepForResume,
+		PartialDownloadTTL:        time.Hour,
+
+		OriginIgnoreConditionalThreshold: 3,
+		OriginIgnoreConditionalTTL:       5 * time.Minute,
 	}
 }
 
@@ -112,6 +152,39 @@ type BaseProperties struct {
 	// default: 8002
 	ListenPort int `yaml:"listenPort"`
 
+	// MaxConcurrentConnections is the max number of client connections that supernode server
+	// serves at the same time. Each connection beyond the limit is held waiting for a free slot for
+	// a while, and then rejected with the status 503 and a Retry-After header.
+	// And the limit will be disabled if the value is not greater than 0.
+	// default: 0
+	MaxConcurrentConnections int `yaml:"maxConcurrentConnections"`
+
+	// RetryAfterBase is the least duration that the clients rejected by the MaxConcurrentConnections
+	// or responded with the status 503 are told to wait before retrying with the Retry-After header,
+	// which is in whole seconds.
+	// default: 1s
+	RetryAfterBase time.Duration `yaml:"retryAfterBase"`
+
+	// RetryAfterJitter is the range of the random duration added to the RetryAfterBase for
+	// each rejection, so that the clients rejected at the same time, e.g. in a registration
+	// storm, spread their retries out instead of retrying together.
+	// And the Retry-After is always the RetryAfterBase if the value is not greater than 0.
+	// default: 2s
+	RetryAfterJitter time.Duration `yaml:"retryAfterJitter"`
+
+	// PassthroughConnections is the number of client connections served at the same time,
+	// reaching which supernode is overloaded and tells the clients registering to download
+	// the files from the sources directly, if they're able to do that.
+	// And it will be disabled if the value is not greater than 0.
+	// default: 0
+	PassthroughConnections int `yaml:"passthroughConnections"`
+
+	// PassthroughQueueDepth is the number of downloads from the sources waiting for
+	// the concurrency limits, reaching which supernode is overloaded just like the PassthroughConnections.
+	// And it will be disabled if the value is not greater than 0.
+	// default: 0
+	PassthroughQueueDepth int `yaml:"passthroughQueueDepth"`
+
 	// DownloadPort is the port for download files from supernode.
 	// default: 8001
 	DownloadPort int `yaml:"downloadPort"`
@@ -186,10 +259,628 @@ type BaseProperties struct {
 	AdvertiseIP string `yaml:"advertiseIP"`
 
 	// FailAccessInterval is the interval time after failed to access the URL.
+	// The URL responded with 404 or 410 by the source is remembered during the interval,
+	// and the registrations of it fail fast without re-querying the source.
+	// And the negative caching will be disabled if the value is not greater than 0.
 	// unit: minutes
 	// default: 3
 	FailAccessInterval time.Duration `yaml:"failAccessInterval"`
 
+	// ProgressCompactInterval is the interval to check whether the progress maps
+	// need to be compacted to reclaim the memory held by the removed entries.
+	// A random jitter will be added to avoid all maps being compacted at the same time.
+	// And the compaction will be disabled if the value is not greater than 0.
+	// default: 10m
+	ProgressCompactInterval time.Duration `yaml:"progressCompactInterval"`
+
+	// ProgressCompactRatio is the ratio of the removed entries to the live entries
+	// that triggers the compaction of a progress map.
+	// default: 1.0
+	ProgressCompactRatio float64 `yaml:"progressCompactRatio"`
+
+	// ProgressMapMetricsSample is the number of the operations on the progress maps
+	// from which one is sampled to record its latency and lock wait into the metrics.
+	// The errors of the operations are always counted while the instrumentation is enabled,
+	// and the instrumentation will be disabled if the value is not greater than 0.
+	// default: 100
+	ProgressMapMetricsSample int `yaml:"progressMapMetricsSample"`
+
+	// TaskIDHeaders is the list of request header names whose values will be taken
+	// into account when generating the taskID, which works like the Vary header of HTTP.
+	// Requests of the same url with different values of these headers will be treated
+	// as different tasks, such as a tenant header to isolate the cache of tenants.
+	// And the other headers, such as Accept-Encoding, never split the cache.
+	// The header names are case-insensitive.
+	// default: [], which means that only the url, md5 and identifier make up the taskID.
+	TaskIDHeaders []string `yaml:"taskIDHeaders,omitempty"`
+
+	// TaskIDQueryRules decides which query params of the urls are taken into account
+	// when generating the taskID, so that the urls differing only in the cache-busting
+	// or tracking params share one task. The first rule whose pattern matches the host
+	// and path of the url applies: only the listed params matter with the mode allow,
+	// and the listed params are ignored with the mode deny. The pattern and the param
+	// names ending with "*" match all the ones with the prefix before it.
+	// And the urls matching no rule are kept as they are.
+	// e.g. [{"pattern": "cdn.example.com/images/*", "mode": "deny", "params": ["utm_*", "t"]}]
+	// default: []
+	TaskIDQueryRules []QueryRule `yaml:"taskIDQueryRules,omitempty"`
+
+	// TLSCertFile and TLSKeyFile are the paths of the certificate and the private key
+	// for the supernode server. The server will serve HTTPS and negotiate HTTP/2
+	// with the clients when both of them are set.
+	// default: "", which means that the server serves the plaintext HTTP.
+	TLSCertFile string `yaml:"tlsCertFile"`
+	TLSKeyFile  string `yaml:"tlsKeyFile"`
+
+	// EnableH2C indicates whether to accept HTTP/2 over plaintext TCP connections,
+	// which allows a client to multiplex the requests on one connection without TLS.
+	// default: false
+	EnableH2C bool `yaml:"enableH2C"`
+
+	// HTTP2MaxConcurrentStreams is the max number of concurrent streams
+	// that each HTTP/2 client connection may have open at a time.
+	// It should be large enough for a client to fetch the pieces of a task in parallel.
+	// default: 256
+	HTTP2MaxConcurrentStreams int `yaml:"http2MaxConcurrentStreams"`
+
+	// ServerReadTimeout is the max duration for supernode server to read an entire request
+	// including the body, and ServerReadHeaderTimeout is the one to read the request headers.
+	// default: 10m
+	ServerReadTimeout       time.Duration `yaml:"serverReadTimeout"`
+	ServerReadHeaderTimeout time.Duration `yaml:"serverReadHeaderTimeout"`
+
+	// ServerWriteTimeout is the max duration for supernode server to write a response,
+	// which should be long enough to serve the content of a file.
+	// default: 0, which means no timeout.
+	ServerWriteTimeout time.Duration `yaml:"serverWriteTimeout"`
+
+	// ServerIdleTimeout is the max duration that a client connection kept alive
+	// can be idle before it's closed by supernode server.
+	// default: 10m
+	ServerIdleTimeout time.Duration `yaml:"serverIdleTimeout"`
+
+	// MaxConnectionLifetime is the max duration that a HTTP/1 client connection can be reused.
+	// The connection which has lived longer is closed once it becomes idle,
+	// so that the clients reconnect and are rebalanced across the supernodes behind a load balancer.
+	// default: 0, which means the connections are reused until they're idle for the ServerIdleTimeout.
+	MaxConnectionLifetime time.Duration `yaml:"maxConnectionLifetime"`
+
+	// SlowStartInitialLimit is the upload limit of a newly registered peer,
+	// which means that how many pieces can be scheduled to download from the peer at the same time.
+	// The limit of the peer will ramp up to the PeerUpLimit gradually as the peer serves pieces successfully.
+	// And the slow start will be disabled if the value is not greater than 0.
+	// default: 1
+	SlowStartInitialLimit int `yaml:"slowStartInitialLimit"`
+
+	// SlowStartWarmupPieces is the number of pieces that a new peer should serve successfully
+	// before its upload limit reaches the PeerUpLimit. A failure during the warmup
+	// will reset the progress of the warmup and the limit goes back to the SlowStartInitialLimit.
+	// default: 10
+	SlowStartWarmupPieces int `yaml:"slowStartWarmupPieces"`
+
+	// FailOnMissingCache indicates whether to fail the task when the source replies
+	// that the file is not modified but the cached file has been missing on supernode.
+	// Supernode will download the file from the source again without the conditional
+	// headers by default.
+	// default: false
+	FailOnMissingCache bool `yaml:"failOnMissingCache"`
+
+	// SchedulerStrategy is the name of the strategy which decides the peers
+	// that a piece should be downloaded from. It can be default, or weighted-random
+	// which prefers the peers randomly in proportion to their remaining upload capacity.
+	// default: default
+	SchedulerStrategy string `yaml:"schedulerStrategy"`
+
+	// SchedulerTemperature is the temperature of the weighted-random strategy, and the weight
+	// of a peer is its remaining upload capacity raised to the power of 1/SchedulerTemperature.
+	// The lower temperature sharpens the distribution towards the least loaded peers,
+	// and the higher one flattens it towards the uniform distribution.
+	// default: 1
+	SchedulerTemperature float64 `yaml:"schedulerTemperature"`
+
+	// MaxRequestBodySize is the max size of the request body that supernode accepts.
+	// The request with a larger body will be rejected with 413 Request Entity Too Large.
+	// And the limit will be disabled if the value is not greater than 0.
+	// unit: byte
+	// default: 4194304
+	MaxRequestBodySize int64 `yaml:"maxRequestBodySize"`
+
+	// MaxRegisterHeaders is the max number of the headers carried by a registration.
+	// And the limit will be disabled if the value is not greater than 0.
+	// default: 128
+	MaxRegisterHeaders int `yaml:"maxRegisterHeaders"`
+
+	// MaxRegisterRootCAs is the max number of the root CAs carried by a registration.
+	// And the limit will be disabled if the value is not greater than 0.
+	// default: 32
+	MaxRegisterRootCAs int `yaml:"maxRegisterRootCAs"`
+
+	// MaxTaskTags is the max number of the tags carried by a registration,
+	// as well as the max number of the tags kept for a task.
+	// And the limit will be disabled if the value is not greater than 0.
+	// default: 16
+	MaxTaskTags int `yaml:"maxTaskTags"`
+
+	// HeadUncachedPolicy decides the response to the HEAD requests on the tasks
+	// whose files haven't been cached by supernode. It can be not-cached which responds
+	// 404 Not Found, or origin which gets the length of the file from the source
+	// without downloading it.
+	// default: not-cached
+	HeadUncachedPolicy string `yaml:"headUncachedPolicy"`
+
+	// PartialContentWait is the max duration that a range request on the content of a task
+	// being downloaded waits for the first byte of the range to become available on supernode.
+	// The available bytes of the range are responded with 206 Partial Content, and 503
+	// Service Unavailable with Retry-After is responded if none is available after the wait.
+	// And the range request doesn't wait if the value is not greater than 0.
+	// default: 0
+	PartialContentWait time.Duration `yaml:"partialContentWait"`
+
+	// MaxSubscribers is the max number of the subscribers of the task changes on supernode,
+	// such as the progress streams and the range requests waiting for the pieces.
+	// The subscriptions beyond the limit are rejected with 503 and a Retry-After header,
+	// and the clients should fall back to polling.
+	// And the limit will be disabled if the value is not greater than 0.
+	// default: 10000
+	MaxSubscribers int `yaml:"maxSubscribers"`
+
+	// MaxTaskSubscribers is the max number of the subscribers of the changes of each task,
+	// which works like the MaxSubscribers.
+	// default: 1000
+	MaxTaskSubscribers int `yaml:"maxTaskSubscribers"`
+
+	// ProgressRecomputeInterval is the min interval between the computations of the progress
+	// of each task pushed to its subscribers. The progress of a task is computed once per change
+	// and shared by all the subscribers of it, and the changes within the interval are coalesced
+	// into the next computation, so that the cost doesn't grow with the number of the subscribers.
+	// And the changes are not coalesced if the value is not greater than 0.
+	// default: 100ms
+	ProgressRecomputeInterval time.Duration `yaml:"progressRecomputeInterval"`
+
+	// ContentServingPolicy decides when the content of a task is served by the content API.
+	// It can be verified, which serves the content only after the whole content has been
+	// verified, or first-byte which streams the content as soon as the pieces are committed.
+	// The pieces can be verified by the client with the piece manifest of the task meanwhile.
+	// With first-byte, the task whose whole content fails the verification is poisoned,
+	// so its clients are detached and the registrations are refused until it's purged.
+	// It trades the safety for the latency explicitly.
+	// default: verified
+	ContentServingPolicy string `yaml:"contentServingPolicy"`
+
+	// EnableDigestTrailer indicates whether to send the Digest of the whole content in the HTTP
+	// trailer of the content streamed by the first-byte ContentServingPolicy, which is unknown
+	// until the download finishes, so that the client could verify the content after reading it.
+	// The Content-Length is not declared with the trailer, so the response is chunked in HTTP/1.1.
+	// default: false
+	EnableDigestTrailer bool `yaml:"enableDigestTrailer"`
+
+	// EnableReadThroughProxy indicates whether to serve the files of the sources as a caching proxy,
+	// which registers the task of the source url in the GET request, downloads the file from the source
+	// and serves it in the same request, so that the file is cached for the later downloads.
+	// The proxy fetches any url it's given, so it should only be enabled for the trusted clients.
+	// default: false
+	EnableReadThroughProxy bool `yaml:"enableReadThroughProxy"`
+
+	// NormalizeContentEncoding indicates whether to decode the content encoding
+	// of the source file, such as gzip and deflate, and store the content in the identity form.
+	// It makes the same content served in different encodings share the same md5,
+	// at the cost of the CPU to decode the content.
+	// default: false
+	NormalizeContentEncoding bool `yaml:"normalizeContentEncoding"`
+
+	// RejectCaptivePortal indicates whether to reject the responses of the sources which look like
+	// the login pages of the captive portals intercepting the downloads, such as a small HTML page
+	// responded for a file which isn't HTML, or a redirect to the URL matching the CaptivePortalPatterns.
+	// The task fails with a captive portal error instead of caching the page.
+	// default: false
+	RejectCaptivePortal bool `yaml:"rejectCaptivePortal"`
+
+	// CaptivePortalPatterns contains the substrings of the URLs of the known captive portals,
+	// and the response redirected to a URL containing any of them is rejected
+	// if the RejectCaptivePortal is enabled.
+	// default: []
+	CaptivePortalPatterns []string `yaml:"captivePortalPatterns,omitempty"`
+
+	// CDNSeedMinPeers is the min number of peers which should hold a piece
+	// before the piece is preferred to be downloaded from peers rather than supernode.
+	// Until then, some clients will still be scheduled to download the piece from supernode
+	// to accelerate the initial spread, and fewer as more peers hold the piece.
+	// And it will be disabled if the value is not greater than 0.
+	// default: 0
+	CDNSeedMinPeers int `yaml:"cdnSeedMinPeers"`
+
+	// CDNSeedMaxLoad is the max number of pieces being downloaded from supernode at the same time
+	// which could have been downloaded from the peers but are seeded by supernode as per
+	// the CDNSeedMinPeers. The pieces are downloaded from the peers once it's reached.
+	// And the load will be unlimited if the value is not greater than 0.
+	// default: 50
+	CDNSeedMaxLoad int `yaml:"cdnSeedMaxLoad"`
+
+	// DigestAlgorithm is the default algorithm of the digest of the whole content of the tasks,
+	// which is used if the algorithm isn't specified when the task is created.
+	// It can be md5, sha256 or sha512, and the digest is recorded in the task with its algorithm.
+	// default: md5
+	DigestAlgorithm string `yaml:"digestAlgorithm"`
+
+	// SafeMode indicates whether to disable the P2P transfers for the incident response,
+	// and all the pieces of all the tasks are scheduled from supernode only while it's enabled.
+	// It can be changed at runtime by the API /scheduler/safe-mode, or by sending SIGHUP
+	// to supernode to reload the config file, which applies it only if it's changed in the file
+	// so that the safe mode toggled by the API isn't reset by the reload for the other properties.
+	// default: false
+	SafeMode bool `yaml:"safeMode"`
+
+	// SafeModeCutPeerTransfers indicates whether the pieces being downloaded from the peers
+	// are cancelled and scheduled again from supernode once the SafeMode is enabled,
+	// otherwise they are allowed to finish.
+	// default: false
+	SafeModeCutPeerTransfers bool `yaml:"safeModeCutPeerTransfers"`
+
+	// StartupDiagnosticFile is the path of the file which the diagnostic record will be written to
+	// when supernode fails to start, which helps the orchestration systems to classify the failure.
+	// The record will always be logged whether the file is set or not.
+	// default: ""
+	StartupDiagnosticFile string `yaml:"startupDiagnosticFile"`
+
+	// FairnessFactor is the weight of the ratio of the bytes a peer served to the bytes it consumed
+	// when deciding how many pieces the peer can download at the same time, which ranges from 0 to 1.
+	// A peer that consumes more than it serves will get fewer pieces scheduled at a time,
+	// and a peer which never serves will only get one piece at a time with the factor 1.
+	// And the fairness scheduling will be disabled if the value is not greater than 0.
+	// default: 0
+	FairnessFactor float64 `yaml:"fairnessFactor"`
+
+	// AssignmentFairnessWindow is the window in which the assignments of the pieces of a task
+	// from the peers are counted for each client. When the free upload slots of the peers holding
+	// a piece are not enough for the contending clients, they are left to the clients assigned
+	// fewer pieces within the window, and the others download the piece from supernode instead,
+	// which shares the scarce peers among the clients with max-min fairness.
+	// And the fairness window will be disabled if the value is not greater than 0.
+	// default: 0
+	AssignmentFairnessWindow time.Duration `yaml:"assignmentFairnessWindow"`
+
+	// TolerateContentLengthMismatch indicates whether to trust the bytes actually received
+	// from the source when they don't match the Content-Length declared by the source.
+	// The task fails with the content length mismatch error by default, otherwise
+	// the file length and the pieces of the task will be recomputed with the actual bytes.
+	// default: false
+	TolerateContentLengthMismatch bool `yaml:"tolerateContentLengthMismatch"`
+
+	// PartialDownloadPolicy decides what happens to the pieces committed to the storage
+	// when the download of a task from the source fails halfway. It can be keep-for-resume,
+	// which keeps the pieces and their offsets so that the next download of the task resumes
+	// from them with a range request, or discard-on-failure which deletes the files of the task
+	// so that the next download starts from the beginning. The download aborted by the cancellation
+	// or the pause of the task is always kept, while the content truncated by the source or changed
+	// since the pieces were downloaded is never resumed.
+	// default: keep-for-resume
+	PartialDownloadPolicy string `yaml:"partialDownloadPolicy"`
+
+	// PartialDownloadTTL is the duration that the pieces kept for resume by the PartialDownloadPolicy
+	// are reused since the download failed. The next download after that starts from the beginning.
+	// And the pieces never expire if the value is not greater than 0.
+	// default: 1h
+	PartialDownloadTTL time.Duration `yaml:"partialDownloadTTL"`
+
+	// OriginConcurrencyLimit is the max number of files that supernode downloads
+	// from all the sources at the same time.
+	// It can be changed at runtime by the API /origin/concurrency, or by sending SIGHUP
+	// to supernode to reload the config file.
+	// And the limit will be disabled if the value is not greater than 0.
+	// default: 0
+	OriginConcurrencyLimit int `yaml:"originConcurrencyLimit"`
+
+	// OriginHostConcurrencyLimit is the max number of files that supernode downloads
+	// from one host of the sources at the same time, which applies to the hosts
+	// not configured in OriginHostConcurrencyLimits.
+	// The downloads beyond the limit of a host wait for the host only, before taking
+	// a slot of the OriginConcurrencyLimit.
+	// And the limit will be disabled if the value is not greater than 0.
+	// default: 0
+	OriginHostConcurrencyLimit int `yaml:"originHostConcurrencyLimit"`
+
+	// OriginHostConcurrencyLimits contains the concurrency limits of the specified hosts,
+	// which override the OriginHostConcurrencyLimit.
+	// The key is the host of the source url with or without the port, such as "example.com:8080".
+	// default: nil
+	OriginHostConcurrencyLimits map[string]int `yaml:"originHostConcurrencyLimits,omitempty"`
+
+	// OriginHostTaskLimit is the max number of distinct tasks that supernode downloads
+	// from one host of the sources at the same time, which protects the sources limiting
+	// the objects downloaded by a client. The downloads of the same task share one slot,
+	// and the tasks beyond the limit wait in queue before the OriginHostConcurrencyLimit.
+	// And the limit will be disabled if the value is not greater than 0.
+	// default: 0
+	OriginHostTaskLimit int `yaml:"originHostTaskLimit"`
+
+	// OriginCookieJar enables the cookie jar of each task, which carries the cookies
+	// set by the source in the responses into the following requests of the same task,
+	// such as the range requests to resume the download. The cookies are never shared
+	// with the other tasks and are discarded when the CDN of the task finishes.
+	// default: false
+	OriginCookieJar bool `yaml:"originCookieJar"`
+
+	// OriginRedirectCacheTTL is the max duration that supernode caches the final URL which
+	// the source redirects the requests of a task to, so that the following requests of the task,
+	// such as the range requests to resume the download, go to the final URL directly.
+	// The final URL is cached no longer than the max-age or Expires of the redirect responses,
+	// never cached with no-store or no-cache, and resolved again once a request to it fails.
+	// The cache is discarded when the CDN of the task finishes.
+	// And the cache will be disabled if the value is not greater than 0.
+	// default: 0
+	OriginRedirectCacheTTL time.Duration `yaml:"originRedirectCacheTTL"`
+
+	// OriginIgnoreConditionalThreshold is the number of the conditional requests in a row
+	// which a host of the sources responds 200 with the unchanged ETag or Last-Modified,
+	// after which the host is recognized as ignoring the conditional requests.
+	// default: 3
+	OriginIgnoreConditionalThreshold int `yaml:"originIgnoreConditionalThreshold"`
+
+	// OriginIgnoreConditionalPeriod is the duration that supernode stops revalidating the files
+	// of the host ignoring the conditional requests, which wastes the revalidation by downloading
+	// the whole file. The file of the host is reused within the OriginIgnoreConditionalTTL
+	// since it was downloaded instead, and downloaded again after that.
+	// And the detection will be disabled if the value is not greater than 0.
+	// default: 0
+	OriginIgnoreConditionalPeriod time.Duration `yaml:"originIgnoreConditionalPeriod"`
+
+	// OriginIgnoreConditionalTTL is the duration that the file of the host ignoring the conditional
+	// requests is reused without revalidation since it was downloaded.
+	// default: 5m
+	OriginIgnoreConditionalTTL time.Duration `yaml:"originIgnoreConditionalTTL"`
+
+	// OriginDigestAuth contains the credentials of the specified hosts of the sources
+	// which require the HTTP Digest authentication. When such a host challenges a request
+	// with the Digest scheme, the request is retried once with the digest response computed
+	// from the credential, and the challenge is kept to authorize the following requests
+	// to the host, such as the range requests to resume the download.
+	// It can only be configured in the config file to keep the passwords out of the command line.
+	// e.g. {"example.com": {"username": "foo", "password": "bar"}}
+	OriginDigestAuth map[string]OriginCredential `yaml:"originDigestAuth,omitempty"`
+
+	// OriginUnixSockets contains the paths of the unix domain sockets of the specified hosts
+	// of the sources, such as a local registry or a sidecar, which are dialed instead of TCP
+	// for the requests to the hosts. The URLs of the tasks keep the hosts, and the http scheme
+	// should be used since TLS doesn't apply to the sockets.
+	// e.g. {"registry.local": "/var/run/registry.sock"}
+	OriginUnixSockets map[string]string `yaml:"originUnixSockets,omitempty"`
+
+	// OriginH2CHosts contains the specified hosts of the sources which speak HTTP/2 cleartext (h2c)
+	// without TLS, such as the internal origins. The requests to them are sent over HTTP/2 with
+	// prior knowledge, and multiplexed on one connection. The URLs of the tasks keep the http scheme.
+	// And the proxy from the environment is ignored for them.
+	// e.g. ["origin.internal:8080"]
+	OriginH2CHosts []string `yaml:"originH2CHosts,omitempty"`
+
+	// OriginClientCerts contains the client certificates of the specified hosts of the sources
+	// which require the mutual TLS, and the certificate is presented when the host requests it.
+	// The certificate is loaded again after its files are modified, so it can be rotated
+	// without restarting supernode.
+	// It can only be configured in the config file.
+	// e.g. {"example.com": {"cert": "/etc/dragonfly/client.crt", "key": "/etc/dragonfly/client.key"}}
+	OriginClientCerts map[string]OriginClientCert `yaml:"originClientCerts,omitempty"`
+
+	// OriginMinTLSVersion is the min version of TLS negotiated with the sources over https,
+	// which is one of 1.0, 1.1, 1.2 and 1.3. The request to the source which can't negotiate it
+	// fails with the ErrTLSPolicyViolation, and the default of Go is used if it's empty.
+	// default: ""
+	OriginMinTLSVersion string `yaml:"originMinTLSVersion"`
+
+	// OriginCipherSuites contains the names of the cipher suites allowed to be negotiated with
+	// the sources over TLS 1.0 to 1.2, and the request to the source which supports none of them
+	// fails with the ErrTLSPolicyViolation. The suites of TLS 1.3 are not configurable.
+	// And the defaults of Go are allowed if it's empty.
+	// e.g. ["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"]
+	OriginCipherSuites []string `yaml:"originCipherSuites,omitempty"`
+
+	// OriginRequireVerifiedCerts makes the certificates of the sources always verified,
+	// and the insecure registrations of the tasks skipping the verification are refused,
+	// so the request to the source with an untrusted certificate fails with the ErrTLSPolicyViolation.
+	// default: false
+	OriginRequireVerifiedCerts bool `yaml:"originRequireVerifiedCerts"`
+
+	// OriginNonRetryable contains the sources whose requests are never sent more than once,
+	// such as the metered or stateful origins, each of which is a host or a host followed by
+	// a path prefix. The download requests to them are never hedged, and the failures of the
+	// requests to their cached final URLs are returned at once instead of resolving the redirects
+	// again. And the requests other than GET and HEAD are never sent more than once either.
+	// e.g. ["metered.example.com", "origin.internal:8080/api/"]
+	OriginNonRetryable []string `yaml:"originNonRetryable,omitempty"`
+
+	// OriginMetadataHeaders contains the names of the headers responded by the sources which are
+	// captured into the metadata of the tasks when they're downloaded, such as the Content-Type or
+	// the custom classification headers. The metadata is recorded with the cached files and shown
+	// in the task info, so that the tasks can be listed and pinned by it.
+	// e.g. ["Content-Type", "X-Content-Class"]
+	OriginMetadataHeaders []string `yaml:"originMetadataHeaders,omitempty"`
+
+	// PinnedOriginMetadata contains the origin metadata of the tasks which are never evicted by
+	// the purges, each of which is in the form of Name=value. The task is pinned if any of its
+	// captured metadata matches, while the corrupted tasks are still evicted since they can't be served.
+	// e.g. ["X-Content-Class=golden"]
+	PinnedOriginMetadata []string `yaml:"pinnedOriginMetadata,omitempty"`
+
+	// WarmHandoffClients is the max number of the clients waiting for a task which are
+	// assigned the pieces held by no peer when the CDN of the task finishes.
+	// The pieces are spread among the clients to be downloaded from supernode first,
+	// so that the clients become the sources of the whole file for the other clients quickly.
+	// And the warm handoff will be disabled if the value is not greater than 0.
+	// default: 0
+	WarmHandoffClients int `yaml:"warmHandoffClients"`
+
+	// ClientIdentityTTL is the duration that supernode keeps the progress of a client
+	// for its stable identity after it's seen last time. When a client reconnects with
+	// the same identity within the TTL, it resumes the progress of the previous one,
+	// otherwise it starts fresh. And the expired identities will be garbage collected.
+	// The identities will be ignored if the value is not greater than 0.
+	// default: 5m
+	ClientIdentityTTL time.Duration `yaml:"clientIdentityTTL"`
+
+	// PieceSize is the piece size of the files not larger than 200MB,
+	// and the piece size of a larger file grows from it by 1MB per 100MB up to 15MB.
+	// It's only used by the new tasks, and a task which has been downloaded partially
+	// always keeps its own piece size recorded in the meta data when it's resumed.
+	// default: 4194304
+	PieceSize int `yaml:"pieceSize"`
+
+	// MaxPiecesPerTask is the max number of pieces a file is split into, which bounds
+	// the memory to track the pieces and the cost to schedule them. The piece size
+	// of a new task grows beyond the computed one to keep the pieces under the limit,
+	// and the task is rejected if the piece size would exceed 15MB or the recorded
+	// piece size of the task can't be changed.
+	// And the limit will be disabled if the value is not greater than 0.
+	// default: 0
+	MaxPiecesPerTask int `yaml:"maxPiecesPerTask"`
+
+	// OriginHedgeDelay is the delay after which supernode issues a hedged request
+	// in parallel if the source has not responded to the download request yet.
+	// Whichever request responds first is used and the other one is canceled.
+	// And the hedging will be disabled if the value is not greater than 0.
+	// default: 0
+	OriginHedgeDelay time.Duration `yaml:"originHedgeDelay"`
+
+	// OriginMaxHedges is the max number of the hedged requests in flight.
+	// No more hedged request will be issued when the limit is reached.
+	// default: 4
+	OriginMaxHedges int `yaml:"originMaxHedges"`
+
+	// OriginMaxHeaderBytes is the max size in bytes of the response headers of the sources.
+	// The request to a source responding larger headers fails with a bad response,
+	// and the limit of the http transport, 10MB, is used if the value is not greater than 0.
+	// default: 1MB
+	OriginMaxHeaderBytes int64 `yaml:"originMaxHeaderBytes"`
+
+	// MaxTaskAge is the max duration that an incomplete CDN download of a task
+	// can make no progress since the task was registered or the last bytes were received.
+	// The task will be abandoned after that: the download is aborted, the downloaded file
+	// and the progress are removed, and the clients attached to it are failed.
+	// And it will be disabled if the value is not greater than 0.
+	// default: 0
+	MaxTaskAge time.Duration `yaml:"maxTaskAge"`
+
+	// SchedulerTiebreaker is the name of the tiebreaker which orders the equally good
+	// sources of a piece to avoid assigning the pieces to the same peer deterministically.
+	// It can be random, round-robin or least-recently-assigned.
+	// default: least-recently-assigned
+	SchedulerTiebreaker string `yaml:"schedulerTiebreaker"`
+
+	// SchedulerSeed seeds the random decisions of the scheduler, such as the random tiebreaker,
+	// the weighted-random strategy and the random piece order, so that the same assignments
+	// are reproduced with the same seed, e.g. for tests and debugging.
+	// And they're seeded with the current time if the value is 0.
+	// default: 0
+	SchedulerSeed int64 `yaml:"schedulerSeed"`
+
+	// TaskBandwidthBudget is the max bytes that supernode and all peers serve for a task,
+	// which caps the cost of distributing an expensive artifact. The scheduler throttles
+	// the clients of the task to one piece at a time when the budget is nearly exhausted,
+	// and stops assigning the sources with a budget exceeded status once it's exhausted.
+	// And the budget will be disabled if the value is not greater than 0.
+	// unit: byte
+	// default: 0
+	TaskBandwidthBudget int64 `yaml:"taskBandwidthBudget"`
+
+	// ReplicationPeers is the list of the addresses of the peer supernodes whose cached files
+	// are replicated to the local store, so that the supernode serves as a warm standby of them
+	// and the failover doesn't cause a mass cold start. The address is in the form of host:port
+	// or a url with the scheme, such as https://host:port.
+	// default: [], which means that the replication is disabled.
+	ReplicationPeers []string `yaml:"replicationPeers,omitempty"`
+
+	// ReplicationPolicy decides which cached files of the peer supernodes are replicated.
+	// It can be all, or hot which only replicates the files of the tasks registered
+	// no less than ReplicationMinAccessCount times on the peer supernodes.
+	// default: all
+	ReplicationPolicy string `yaml:"replicationPolicy"`
+
+	// ReplicationMinAccessCount is the min times of the registrations of a task
+	// on the peer supernode to replicate its file with the hot replication policy.
+	// default: 2
+	ReplicationMinAccessCount int64 `yaml:"replicationMinAccessCount"`
+
+	// ReplicationInterval is the interval to pull the cached files from the peer supernodes.
+	// default: 5m
+	ReplicationInterval time.Duration `yaml:"replicationInterval"`
+
+	// WarmupTasks is the list of the files which are downloaded from the sources in the background
+	// once supernode starts, so that the hot files are cached before the clients request them
+	// after a deployment. The failures are logged without failing the start, and the downloads
+	// are bounded by the OriginConcurrencyLimit as the others.
+	// It can only be configured in the config file.
+	// default: []
+	WarmupTasks []WarmupTask `yaml:"warmupTasks,omitempty"`
+
+	// PieceDownloadTimeout is the max duration that a client can take to download a piece
+	// assigned by the scheduler. The assignment exceeding it is cancelled as a failure of
+	// the source, which releases the load of the source and penalizes it, and the piece
+	// will be reassigned to the client from an alternate source.
+	// And the timeout will be disabled if the value is not greater than 0.
+	// default: 0
+	PieceDownloadTimeout time.Duration `yaml:"pieceDownloadTimeout"`
+
+	// ClientProgressTimeout is the max duration that a client registered for a task can stay
+	// without pulling or reporting the pieces. The client exceeding it is detached from the task,
+	// its running pieces are released from their sources and its progress is cleaned up.
+	// And the timeout will be disabled if the value is not greater than 0.
+	// default: 0
+	ClientProgressTimeout time.Duration `yaml:"clientProgressTimeout"`
+
+	// VerifyOnRead indicates whether to verify the stored pieces against the piece md5s
+	// recorded when they were downloaded while serving them. The read of a corrupted piece
+	// fails, and the task is evicted so that the next registration downloads it from source again.
+	// Each piece is hashed once per file opened for reading.
+	// default: false
+	VerifyOnRead bool `yaml:"verifyOnRead"`
+
+	// ScrubInterval is the interval to verify the cached files of the successful tasks
+	// which haven't been accessed within the interval against the recorded piece md5s
+	// in the background, and the corrupted tasks are evicted.
+	// And the scrubbing will be disabled if the value is not greater than 0.
+	// default: 0
+	ScrubInterval time.Duration `yaml:"scrubInterval"`
+
+	// PieceBufferMemoryLimit is the max bytes of the buffers of the pieces downloaded from the sources
+	// which haven't been written to the storage, across all the tasks. The downloads stop reading
+	// from the sources while it's reached, and continue as the buffered pieces are written.
+	// A piece is always buffered if no other piece is, even if it's larger than the limit.
+	// And the limit will be disabled if the value is not greater than 0.
+	// unit: byte
+	// default: 0
+	PieceBufferMemoryLimit int64 `yaml:"pieceBufferMemoryLimit"`
+
+	// OrphanReclaimInterval is the interval to reclaim the orphaned files in the storage
+	// in the background, which are stored for the tasks that are no longer known by supernode
+	// and can't be reused either, such as the file without its metadata left over by a crash.
+	// And the reclaiming will be disabled if the value is not greater than 0.
+	// default: 0
+	OrphanReclaimInterval time.Duration `yaml:"orphanReclaimInterval"`
+
+	// OrphanGracePeriod is the duration that an orphaned file is kept after it's modified
+	// last time before it's reclaimed, to avoid racing with the writes in progress.
+	// default: 1h
+	OrphanGracePeriod time.Duration `yaml:"orphanGracePeriod"`
+
+	// SchedulerExplain indicates whether the scheduler records how it chose the source of
+	// each piece assigned to the clients, including the candidates it considered with their
+	// load and capacity, which can be queried by the API /tasks/{id}/pieces/{pieceNum}/explain
+	// for debugging. Only the most recent decisions are kept.
+	// default: false
+	SchedulerExplain bool `yaml:"schedulerExplain"`
+
+	// TaskEventHistorySize is the max number of the events kept in the history of each task,
+	// such as the task being registered, the first piece, the reassignments of the pieces and
+	// the download completing, which can be queried by the API /tasks/{id}/events for auditing
+	// and debugging. The oldest event is overwritten once the history is full, and nothing is
+	// recorded if it's not greater than 0.
+	// default: 64
+	TaskEventHistorySize int `yaml:"taskEventHistorySize"`
+
+	// TaskEventRetention is the duration that the history of a task is kept after the task
+	// is evicted, so that the events leading to the eviction can still be queried.
+	// And the history is deleted with the task if the value is not greater than 0.
+	// default: 10m
+	TaskEventRetention time.Duration `yaml:"taskEventRetention"`
+
 	// cIDPrefix s a prefix string used to indicate that the CID is supernode.
 	cIDPrefix string
 
@@ -197,6 +888,41 @@ type BaseProperties struct {
 	superNodePID string
 }
 
+// OriginCredential is the credential used by supernode to authenticate to a source.
+type OriginCredential struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// OriginClientCert is the client certificate presented by supernode to a source requiring the mutual TLS.
+type OriginClientCert struct {
+	// Cert is the path of the PEM encoded certificate.
+	Cert string `yaml:"cert"`
+	// Key is the path of the PEM encoded private key of the certificate.
+	Key string `yaml:"key"`
+	// CA is the path of the PEM encoded certificates to verify the source with,
+	// and the system roots are used if it's empty.
+	CA string `yaml:"ca,omitempty"`
+}
+
+// WarmupTask is a file downloaded by supernode on start.
+type WarmupTask struct {
+	// URL is the url of the file to download.
+	URL string `yaml:"url"`
+	// Headers are the headers of the requests to the source, such as the Authorization.
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// QueryRule decides which query params of the urls matching the pattern
+// are taken into account when generating the taskID.
+type QueryRule struct {
+	// Pattern matches the host and path of the urls, such as "example.com/images/*".
+	Pattern string `yaml:"pattern"`
+	// Mode is either allow or deny.
+	Mode   string   `yaml:"mode"`
+	Params []string `yaml:"params"`
+}
+
 // TransLimit trans rateLimit from MB/s to B/s.
 func TransLimit(rateLimit int) int {
 	return rateLimit * 1024 * 1024
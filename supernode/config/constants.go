@@ -16,6 +16,8 @@
 
 package config
 
+import "time"
+
 const (
 	// DefaultSupernodeConfigFilePath the default supernode config path.
 	DefaultSupernodeConfigFilePath = "/etc/dragonfly/supernode.yml"
@@ -54,6 +56,9 @@ const (
 	// DefaultPieceSizeLimit 15M
 	DefaultPieceSizeLimit = 15 * 1024 * 1024
 
+	// DefaultOriginMaxHeaderBytes 1M
+	DefaultOriginMaxHeaderBytes = 1024 * 1024
+
 	// PieceHeadSize 4 bytes
 	PieceHeadSize = 4
 
@@ -69,6 +74,48 @@ const (
 	CDNWriterRoutineLimit = 4
 )
 
+const (
+	// DefaultServerTimeout 10m
+	DefaultServerTimeout = 10 * time.Minute
+)
+
+const (
+	// HeadUncachedNotCached responds 404 Not Found to the HEAD requests on the uncached tasks.
+	HeadUncachedNotCached = "not-cached"
+
+	// HeadUncachedOrigin gets the metadata of the uncached tasks from the source
+	// to respond to the HEAD requests on them.
+	HeadUncachedOrigin = "origin"
+)
+
+const (
+	// ContentServingVerified serves the content of a task only after the whole content
+	// has been verified.
+	ContentServingVerified = "verified"
+
+	// ContentServingFirstByte serves the content of a task as soon as the pieces are committed,
+	// and poisons the task if the whole content fails the verification later.
+	ContentServingFirstByte = "first-byte"
+)
+
+const (
+	// PartialDownloadKeepForResume keeps the pieces committed before the download of a task
+	// from the source fails, so that the next download of the task resumes from them.
+	PartialDownloadKeepForResume = "keep-for-resume"
+
+	// PartialDownloadDiscardOnFailure discards the pieces committed before the download
+	// of a task from the source fails, so that the next download starts from the beginning.
+	PartialDownloadDiscardOnFailure = "discard-on-failure"
+)
+
+const (
+	// QueryRuleModeAllow takes only the params of the rule into account when generating the taskID.
+	QueryRuleModeAllow = "allow"
+
+	// QueryRuleModeDeny ignores the params of the rule when generating the taskID.
+	QueryRuleModeDeny = "deny"
+)
+
 const (
 	// SubsystemSupernode represents metrics from supernode
 	SubsystemSupernode = "supernode"
@@ -79,6 +79,11 @@ func (d *Daemon) RegisterSuperNode() error {
 	return nil
 }
 
+// Reload applies the properties of cfg which can be changed at runtime to the daemon.
+func (d *Daemon) Reload(cfg *config.Config) {
+	d.server.Reload(cfg)
+}
+
 // Run runs the daemon.
 func (d *Daemon) Run() error {
 	if err := d.server.Start(); err != nil {
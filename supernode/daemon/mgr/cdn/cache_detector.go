@@ -18,23 +18,31 @@ package cdn
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 type cacheDetector struct {
+	cfg             *config.Config
 	cacheStore      *store.Store
 	metaDataManager *fileMetaDataManager
 	OriginClient    httpclient.OriginHTTPClient
 }
 
-func newCacheDetector(cacheStore *store.Store, metaDataManager *fileMetaDataManager, originClient httpclient.OriginHTTPClient) *cacheDetector {
+func newCacheDetector(cfg *config.Config, cacheStore *store.Store, metaDataManager *fileMetaDataManager, originClient httpclient.OriginHTTPClient) *cacheDetector {
 	return &cacheDetector{
+		cfg:             cfg,
 		cacheStore:      cacheStore,
 		metaDataManager: metaDataManager,
 		OriginClient:    originClient,
@@ -46,54 +54,169 @@ func newCacheDetector(cacheStore *store.Store, metaDataManager *fileMetaDataMana
 //
 // If so, return the md5 of task file and return startPieceNum as -1.
 // And if not, return the latest piece num that has been downloaded.
-func (cd *cacheDetector) detectCache(ctx context.Context, task *types.TaskInfo) (int, *fileMetaData, error) {
+// The revalidated is whether the source responded that the file is not modified
+// to the conditional request.
+func (cd *cacheDetector) detectCache(ctx context.Context, task *types.TaskInfo) (int, *fileMetaData, bool, error) {
 	var breakNum int
+	var revalidated bool
 	var metaData *fileMetaData
 	var err error
 
-	if metaData, err = cd.metaDataManager.readFileMetaData(ctx, task.ID); err == nil &&
-		checkSameFile(task, metaData) {
-		breakNum = cd.parseBreakNum(ctx, task, metaData)
+	// the cache is never reused if the content is required to be always fresh.
+	if task.Consistency == types.TaskInfoConsistencyAlwaysFresh {
+		logrus.Infof("taskID: %s, skip detecting cache with the consistency %s", task.ID, task.Consistency)
+	} else if metaData, err = cd.metaDataManager.readFileMetaData(ctx, task.ID); err == nil {
+		if err = checkPieceSize(task, metaData); err != nil {
+			return 0, nil, false, err
+		}
+		if checkSameFile(task, metaData) {
+			if breakNum, revalidated, err = cd.parseBreakNum(ctx, task, metaData); err != nil {
+				return 0, nil, false, err
+			}
+		}
 	}
 	logrus.Infof("taskID: %s, detect cache breakNum: %d", task.ID, breakNum)
 
 	if breakNum == 0 {
 		if metaData, err = cd.resetRepo(ctx, task); err != nil {
-			return 0, nil, err
+			return 0, nil, false, err
 		}
 	}
 
 	// TODO: update the access time of task meta file for GC module
-	return breakNum, metaData, nil
+	return breakNum, metaData, revalidated, nil
 }
 
-func (cd *cacheDetector) parseBreakNum(ctx context.Context, task *types.TaskInfo, metaData *fileMetaData) int {
-	expired, err := cd.OriginClient.IsExpired(task.RawURL, task.Headers, metaData.LastModified, metaData.ETag)
-	if err != nil {
-		logrus.Errorf("failed to check whether the task(%s) has expired: %v", task.ID, err)
-	}
+func (cd *cacheDetector) parseBreakNum(ctx context.Context, task *types.TaskInfo, metaData *fileMetaData) (breakNum int, revalidated bool, err error) {
+	// the source is always revalidated if the task requires it regardless of the freshness.
+	mustRevalidate := task.Consistency == types.TaskInfoConsistencyRevalidate
 
-	logrus.Debugf("success to get expired result: %t for taskID(%s)", expired, task.ID)
-	if expired {
-		return 0
+	// the source is not revalidated within the freshness lifetime it allows.
+	if !mustRevalidate && isFresh(metaData) {
+		logrus.Debugf("taskID: %s, skip revalidating the source within the freshness lifetime of Cache-Control(%s) Expires(%s)",
+			task.ID, metaData.CacheControl, metaData.Expires)
+	} else if !mustRevalidate && httpclient.ForTask(cd.OriginClient, task.ID).IgnoresConditional(task.RawURL) {
+		// the source ignoring the conditional requests can't be revalidated without downloading the whole file,
+		// so the file is reused within the OriginIgnoreConditionalTTL since it was downloaded instead.
+		if !isFreshWithin(metaData, cd.cfg.OriginIgnoreConditionalTTL) {
+			logrus.Infof("taskID: %s, download again since the source ignores the conditional requests", task.ID)
+			return 0, false, nil
+		}
+		logrus.Debugf("taskID: %s, skip revalidating the source ignoring the conditional requests", task.ID)
+	} else {
+		expired, err := httpclient.ForTask(cd.OriginClient, task.ID).IsExpired(task.RawURL, task.Headers, metaData.LastModified, metaData.ETag)
+		if err != nil {
+			logrus.Errorf("failed to check whether the task(%s) has expired: %v", task.ID, err)
+		}
+
+		logrus.Debugf("success to get expired result: %t for taskID(%s)", expired, task.ID)
+		if expired {
+			return 0, false, nil
+		}
+		revalidated = err == nil
 	}
 
 	if metaData.Finish {
-		if metaData.Success {
-			return -1
+		if !metaData.Success {
+			return 0, false, nil
 		}
-		return 0
+
+		// The source is not modified, but there is nothing to serve
+		// if the cached file has been evicted while its metadata survived.
+		if cd.isCacheMissing(ctx, task.ID) {
+			logrus.Warnf("taskID: %s, the cached file is missing while the source is not modified "+
+				"since LastModified(%d) ETag(%s), the metadata diverges from the content",
+				task.ID, metaData.LastModified, metaData.ETag)
+			if cd.cfg != nil && cd.cfg.FailOnMissingCache {
+				return 0, false, errors.Wrapf(errortypes.ErrCacheMissing, "taskID: %s", task.ID)
+			}
+			return 0, false, nil
+		}
+		return -1, revalidated, nil
 	}
 
-	supportRange, err := cd.OriginClient.IsSupportRange(task.TaskURL, task.Headers)
+	// the pieces kept for resume are discarded once they expire.
+	if cd.isPartialDownloadExpired(metaData) {
+		logrus.Infof("taskID: %s, download again since the pieces kept for resume have expired", task.ID)
+		return 0, false, nil
+	}
+
+	// the decoded content can't be resumed with the range of the encoded content.
+	if !stringutils.IsEmptyStr(metaData.ContentEncoding) {
+		return 0, false, nil
+	}
+
+	// the pieces downloaded can't be resumed safely without a strong validator for the If-Range.
+	if getIfRange(metaData) == "" {
+		return 0, false, nil
+	}
+
+	supportRange, err := httpclient.ForTask(cd.OriginClient, task.ID).IsSupportRange(task.TaskURL, task.Headers)
 	if err != nil {
 		logrus.Errorf("failed to check whether the task(%s) supports partial requests: %v", task.ID, err)
 	}
 	if !supportRange || task.FileLength < 0 {
-		return 0
+		return 0, false, nil
+	}
+
+	return cd.parseBreakNumByCheckFile(ctx, task.ID), revalidated, nil
+}
+
+// revalidate revalidates the file of the task with the source by the conditional request
+// regardless of its freshness, and returns whether the source responded that it's not modified.
+func (cd *cacheDetector) revalidate(ctx context.Context, task *types.TaskInfo) (bool, error) {
+	metaData, err := cd.metaDataManager.readFileMetaData(ctx, task.ID)
+	if err != nil {
+		return false, err
+	}
+
+	expired, err := httpclient.ForTask(cd.OriginClient, task.ID).IsExpired(task.RawURL, task.Headers, metaData.LastModified, metaData.ETag)
+	if err != nil {
+		return false, err
 	}
+	logrus.Debugf("success to revalidate taskID(%s) with the expired result: %t", task.ID, expired)
+	return !expired, nil
+}
 
-	return cd.parseBreakNumByCheckFile(ctx, task.ID)
+// isFresh returns whether the source file is still fresh according to
+// the cache directives responded by the source when it was downloaded.
+func isFresh(metaData *fileMetaData) bool {
+	return isFreshWithin(metaData, 0)
+}
+
+// isFreshWithin returns whether the source file is still fresh according to the cache directives
+// responded by the source when it was downloaded, or within the defaultTTL since then
+// if the source responded none of them.
+func isFreshWithin(metaData *fileMetaData, defaultTTL time.Duration) bool {
+	if metaData.ResponseTime <= 0 {
+		return false
+	}
+
+	header := http.Header{}
+	if metaData.CacheControl != "" {
+		header.Set("Cache-Control", metaData.CacheControl)
+	}
+	if metaData.Expires != "" {
+		header.Set("Expires", metaData.Expires)
+	}
+	responseTime := time.Unix(0, metaData.ResponseTime*int64(time.Millisecond))
+	lifetime, ok := netutils.FreshnessLifetime(header, responseTime)
+	if !ok {
+		lifetime = defaultTTL
+	}
+	return time.Since(responseTime) < lifetime
+}
+
+// isCacheMissing returns whether the downloaded file of taskID does not exist.
+func (cd *cacheDetector) isCacheMissing(ctx context.Context, taskID string) bool {
+	_, err := cd.cacheStore.Stat(ctx, getDownloadRawFunc(taskID))
+	if err == nil {
+		return false
+	}
+	if !store.IsKeyNotFound(err) {
+		logrus.Errorf("taskID: %s, failed to stat the download file: %v", taskID, err)
+	}
+	return true
 }
 
 func (cd *cacheDetector) parseBreakNumByCheckFile(ctx context.Context, taskID string) int {
@@ -137,6 +260,27 @@ func checkSameFile(task *types.TaskInfo, metaData *fileMetaData) (result bool) {
 		return false
 	}
 
+	return checkSameSource(task, metaData)
+}
+
+// checkPieceSize returns an error if the task resumes the same file
+// which has been downloaded with another piece size,
+// because the offsets of the downloaded pieces will be corrupted.
+func checkPieceSize(task *types.TaskInfo, metaData *fileMetaData) error {
+	if !checkSameSource(task, metaData) || metaData.PieceSize == task.PieceSize {
+		return nil
+	}
+	return errors.Wrapf(errortypes.ErrPieceSizeMismatch, "taskID: %s, recorded: %d, requested: %d",
+		task.ID, metaData.PieceSize, task.PieceSize)
+}
+
+// checkSameSource returns whether the metaData is recorded for the same file of task
+// regardless of the piece size.
+func checkSameSource(task *types.TaskInfo, metaData *fileMetaData) bool {
+	if task == nil || metaData == nil {
+		return false
+	}
+
 	if metaData.TaskID != task.ID {
 		return false
 	}
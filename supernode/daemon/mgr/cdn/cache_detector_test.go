@@ -0,0 +1,409 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const testETag = `"foo-etag"`
+
+type CacheDetectorTestSuite struct {
+	cdnFixture
+
+	mu              sync.Mutex
+	conditionalReqs int
+	fullReqs        int
+	server          *httptest.Server
+}
+
+func init() {
+	check.Suite(&CacheDetectorTestSuite{})
+}
+
+func (s *CacheDetectorTestSuite) SetUpSuite(c *check.C) {
+	s.setUpFixture(c, "CacheDetectorTestSuite")
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.Header.Get("If-None-Match") == testETag {
+			s.conditionalReqs++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		s.fullReqs++
+		w.Header().Set("ETag", testETag)
+		fmt.Fprint(w, "hello world")
+	}))
+}
+
+func (s *CacheDetectorTestSuite) TearDownSuite(c *check.C) {
+	s.server.Close()
+	s.tearDownFixture(c)
+}
+
+func (s *CacheDetectorTestSuite) SetUpTest(c *check.C) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conditionalReqs, s.fullReqs = 0, 0
+}
+
+// prepareEvictedCache writes the metadata of a successful download with the ETag,
+// but without the downloaded file which has been evicted.
+func (s *CacheDetectorTestSuite) prepareEvictedCache(c *check.C, taskID string) *types.TaskInfo {
+	ctx := context.TODO()
+	task := &types.TaskInfo{
+		ID:             taskID,
+		RawURL:         s.server.URL,
+		TaskURL:        s.server.URL,
+		PieceSize:      4 * 1024,
+		HTTPFileLength: 11,
+		Headers:        map[string]string{"foo": "bar"},
+	}
+	metaDataManager := newFileMetaDataManager(s.cacheStore)
+	_, err := metaDataManager.writeFileMetaDataByTask(ctx, task)
+	c.Assert(err, check.IsNil)
+	c.Assert(metaDataManager.updateLastModifiedAndETag(ctx, taskID, 0, testETag), check.IsNil)
+	c.Assert(metaDataManager.updateStatusAndResult(ctx, taskID, &fileMetaData{
+		Finish:     true,
+		Success:    true,
+		RealMd5:    "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		FileLength: 11,
+	}), check.IsNil)
+
+	_, err = s.cacheStore.Stat(ctx, getDownloadRawFunc(taskID))
+	c.Assert(store.IsKeyNotFound(err), check.Equals, true)
+	return task
+}
+
+func (s *CacheDetectorTestSuite) TestRefetchOnMissingCache(c *check.C) {
+	task := s.prepareEvictedCache(c, "cacheDetectorTaskID1")
+
+	cm := s.newManager(c, config.NewConfig())
+
+	updateTaskInfo, err := cm.TriggerCDN(context.TODO(), task)
+	c.Assert(err, check.IsNil)
+	c.Check(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	c.Check(updateTaskInfo.RealMd5, check.Equals, "5eb63bbbe01eeed093cb22bb8f5acdc3")
+	c.Check(s.conditionalReqs, check.Equals, 1)
+	c.Check(s.fullReqs, check.Equals, 1)
+
+	// the headers of task should not be polluted by the conditional headers
+	c.Check(task.Headers, check.DeepEquals, map[string]string{"foo": "bar"})
+
+	_, err = s.cacheStore.Stat(context.TODO(), getDownloadRawFunc(task.ID))
+	c.Check(err, check.IsNil)
+}
+
+func (s *CacheDetectorTestSuite) TestFailOnMissingCache(c *check.C) {
+	task := s.prepareEvictedCache(c, "cacheDetectorTaskID2")
+
+	cfg := config.NewConfig()
+	cfg.FailOnMissingCache = true
+	detector := newCacheDetector(cfg, s.cacheStore, newFileMetaDataManager(s.cacheStore), httpclient.NewOriginClient())
+	_, _, _, err := detector.detectCache(context.TODO(), task)
+	c.Check(errortypes.IsCacheMissing(err), check.Equals, true)
+	c.Check(s.fullReqs, check.Equals, 0)
+}
+
+func (s *CacheDetectorTestSuite) TestRejectPieceSizeMismatch(c *check.C) {
+	task := s.prepareEvictedCache(c, "cacheDetectorTaskID3")
+
+	cm, err := NewManager(config.NewConfig(), s.cacheStore, mock.NewMockProgressMgr(gomock.NewController(c)),
+		httpclient.NewOriginClient(), prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	pieceSize, err := cm.GetPieceSize(context.TODO(), task)
+	c.Assert(err, check.IsNil)
+	c.Check(pieceSize, check.Equals, task.PieceSize)
+
+	// no piece size is recorded for another file
+	pieceSize, err = cm.GetPieceSize(context.TODO(), &types.TaskInfo{ID: task.ID, TaskURL: "http://aa.bb.com/other"})
+	c.Assert(err, check.IsNil)
+	c.Check(pieceSize, check.Equals, int32(0))
+
+	task.PieceSize = 2 * task.PieceSize
+	updateTaskInfo, err := cm.TriggerCDN(context.TODO(), task)
+	c.Check(errortypes.IsPieceSizeMismatch(err), check.Equals, true)
+	c.Check(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusFAILED)
+	c.Check(s.fullReqs, check.Equals, 0)
+}
+
+func (s *CacheDetectorTestSuite) TestIsFresh(c *check.C) {
+	now := getCurrentTimeMillisFunc()
+	var cases = []struct {
+		metaData *fileMetaData
+		expected bool
+	}{
+		{metaData: &fileMetaData{}, expected: false},
+		{metaData: &fileMetaData{CacheControl: "max-age=60"}, expected: false},
+		{metaData: &fileMetaData{CacheControl: "max-age=60", ResponseTime: now - 1000}, expected: true},
+		{metaData: &fileMetaData{CacheControl: "max-age=60", ResponseTime: now - 61000}, expected: false},
+		{metaData: &fileMetaData{CacheControl: "no-cache", ResponseTime: now - 1000}, expected: false},
+		{metaData: &fileMetaData{ResponseTime: now - 1000}, expected: false},
+		{metaData: &fileMetaData{Expires: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat),
+			ResponseTime: now - 1000}, expected: true},
+	}
+
+	for _, v := range cases {
+		c.Check(isFresh(v.metaData), check.Equals, v.expected, check.Commentf("%+v", v.metaData))
+	}
+}
+
+func (s *CacheDetectorTestSuite) TestSkipRevalidationWhenFresh(c *check.C) {
+	ctx := context.TODO()
+	task := &types.TaskInfo{
+		ID:             "cacheDetectorFreshTaskID",
+		RawURL:         s.server.URL,
+		TaskURL:        s.server.URL,
+		PieceSize:      4 * 1024,
+		HTTPFileLength: 11,
+	}
+	metaDataManager := newFileMetaDataManager(s.cacheStore)
+	_, err := metaDataManager.writeFileMetaDataByTask(ctx, task)
+	c.Assert(err, check.IsNil)
+	c.Assert(metaDataManager.updateLastModifiedAndETag(ctx, task.ID, 0, testETag), check.IsNil)
+	c.Assert(metaDataManager.updateCacheDirectives(ctx, task.ID, "max-age=60", "", getCurrentTimeMillisFunc()), check.IsNil)
+	metaData, err := metaDataManager.readFileMetaData(ctx, task.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(metaData.CacheControl, check.Equals, "max-age=60")
+	detector := newCacheDetector(config.NewConfig(), s.cacheStore, metaDataManager, httpclient.NewOriginClient())
+
+	// the source is not revalidated within the max-age
+	_, _, err = detector.parseBreakNum(ctx, task, metaData)
+	c.Assert(err, check.IsNil)
+	s.mu.Lock()
+	c.Check(s.conditionalReqs, check.Equals, 0)
+	s.mu.Unlock()
+
+	// but revalidated after that
+	metaData.ResponseTime -= 61 * 1000
+	_, _, err = detector.parseBreakNum(ctx, task, metaData)
+	c.Assert(err, check.IsNil)
+	s.mu.Lock()
+	c.Check(s.conditionalReqs, check.Equals, 1)
+	s.mu.Unlock()
+}
+
+func (s *CacheDetectorTestSuite) TestDetectCacheWithConsistency(c *check.C) {
+	ctx := context.TODO()
+	task := &types.TaskInfo{
+		ID:             "cacheDetectorConsistencyTaskID",
+		RawURL:         s.server.URL,
+		TaskURL:        s.server.URL,
+		PieceSize:      4 * 1024,
+		HTTPFileLength: 11,
+	}
+	metaDataManager := newFileMetaDataManager(s.cacheStore)
+	_, err := metaDataManager.writeFileMetaDataByTask(ctx, task)
+	c.Assert(err, check.IsNil)
+	c.Assert(metaDataManager.updateLastModifiedAndETag(ctx, task.ID, 0, testETag), check.IsNil)
+	c.Assert(metaDataManager.updateCacheDirectives(ctx, task.ID, "max-age=60", "", getCurrentTimeMillisFunc()), check.IsNil)
+	c.Assert(metaDataManager.updateStatusAndResult(ctx, task.ID, &fileMetaData{
+		Finish:     true,
+		Success:    true,
+		RealMd5:    "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		FileLength: 11,
+	}), check.IsNil)
+	c.Assert(s.cacheStore.PutBytes(ctx, getDownloadRawFunc(task.ID), []byte("hello world")), check.IsNil)
+	detector := newCacheDetector(config.NewConfig(), s.cacheStore, metaDataManager, httpclient.NewOriginClient())
+
+	var cases = []struct {
+		consistency     string
+		breakNum        int
+		revalidated     bool
+		conditionalReqs int
+	}{
+		// the fresh cache is reused without contacting the source
+		{consistency: "", breakNum: -1, revalidated: false, conditionalReqs: 0},
+		{consistency: types.TaskInfoConsistencyCachedOk, breakNum: -1, revalidated: false, conditionalReqs: 0},
+		// the source is revalidated even if the cache is fresh
+		{consistency: types.TaskInfoConsistencyRevalidate, breakNum: -1, revalidated: true, conditionalReqs: 1},
+		// the cache is never reused, so the whole file is downloaded again
+		{consistency: types.TaskInfoConsistencyAlwaysFresh, breakNum: 0, revalidated: false, conditionalReqs: 0},
+	}
+	for _, v := range cases {
+		s.SetUpTest(c)
+		task.Consistency = v.consistency
+		breakNum, _, revalidated, err := detector.detectCache(ctx, task)
+		c.Assert(err, check.IsNil)
+		c.Check(breakNum, check.Equals, v.breakNum, check.Commentf("%+v", v))
+		c.Check(revalidated, check.Equals, v.revalidated, check.Commentf("%+v", v))
+		s.mu.Lock()
+		c.Check(s.conditionalReqs, check.Equals, v.conditionalReqs, check.Commentf("%+v", v))
+		s.mu.Unlock()
+	}
+	// and the cache is reset for the download
+	c.Check(detector.isCacheMissing(ctx, task.ID), check.Equals, true)
+}
+
+func (s *CacheDetectorTestSuite) TestRevalidate(c *check.C) {
+	ctx := context.TODO()
+	task := s.prepareEvictedCache(c, "cacheDetectorRevalidateTaskID")
+	cm, err := NewManager(config.NewConfig(), s.cacheStore, mock.NewMockProgressMgr(gomock.NewController(c)),
+		httpclient.NewOriginClient(), prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	// the source responds that the file is not modified since the ETag
+	notModified, err := cm.Revalidate(ctx, task)
+	c.Assert(err, check.IsNil)
+	c.Check(notModified, check.Equals, true)
+	s.mu.Lock()
+	c.Check(s.conditionalReqs, check.Equals, 1)
+	s.mu.Unlock()
+
+	// there is nothing to revalidate without the metadata
+	_, err = cm.Revalidate(ctx, &types.TaskInfo{ID: "cacheDetectorUnknownTaskID", RawURL: s.server.URL})
+	c.Check(err, check.NotNil)
+}
+
+func (s *CacheDetectorTestSuite) TestResumeOnlyWithStrongValidator(c *check.C) {
+	ctx := context.TODO()
+	var eTag string
+	var rangeReqs int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&rangeReqs, 1)
+		}
+		w.Header().Set("ETag", eTag)
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader("hello world"))
+	}))
+	defer server.Close()
+
+	var cases = []struct {
+		eTag         string
+		lastModified int64
+		weak         bool
+		resumed      bool
+	}{
+		{eTag: `"strong"`, weak: false, resumed: true},
+		{eTag: `W/"weak"`, weak: true, resumed: false},
+		{eTag: `W/"weak"`, lastModified: 1500000000000, weak: true, resumed: true},
+	}
+
+	metaDataManager := newFileMetaDataManager(s.cacheStore)
+	detector := newCacheDetector(config.NewConfig(), s.cacheStore, metaDataManager, httpclient.NewOriginClient())
+	for i, v := range cases {
+		task := &types.TaskInfo{
+			ID:             fmt.Sprintf("cacheDetectorResumeTaskID%d", i),
+			RawURL:         server.URL,
+			TaskURL:        server.URL,
+			PieceSize:      4 * 1024,
+			HTTPFileLength: 11,
+			FileLength:     11,
+		}
+		eTag = v.eTag
+		atomic.StoreInt32(&rangeReqs, 0)
+		_, err := metaDataManager.writeFileMetaDataByTask(ctx, task)
+		c.Assert(err, check.IsNil)
+		c.Assert(metaDataManager.updateLastModifiedAndETag(ctx, task.ID, v.lastModified, v.eTag), check.IsNil)
+		metaData, err := metaDataManager.readFileMetaData(ctx, task.ID)
+		c.Assert(err, check.IsNil)
+		c.Check(metaData.WeakETag, check.Equals, v.weak)
+
+		// the unfinished download is resumed only if it can be validated with the If-Range,
+		// which checks whether the source supports the range at first.
+		_, _, err = detector.parseBreakNum(ctx, task, metaData)
+		c.Assert(err, check.IsNil)
+		c.Check(atomic.LoadInt32(&rangeReqs) > 0, check.Equals, v.resumed, check.Commentf("%+v", v))
+	}
+}
+
+func (s *CacheDetectorTestSuite) TestAdaptToSourceIgnoringConditional(c *check.C) {
+	ctx := context.TODO()
+	var conditionalReqs int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			atomic.AddInt32(&conditionalReqs, 1)
+		}
+		// the source always responds the whole file with the unchanged ETag
+		w.Header().Set("ETag", testETag)
+		fmt.Fprint(w, "hello world")
+	}))
+	defer server.Close()
+
+	task := &types.TaskInfo{
+		ID:             "cacheDetectorIgnoreConditionalTaskID",
+		RawURL:         server.URL,
+		TaskURL:        server.URL,
+		PieceSize:      4 * 1024,
+		HTTPFileLength: 11,
+	}
+	metaDataManager := newFileMetaDataManager(s.cacheStore)
+	_, err := metaDataManager.writeFileMetaDataByTask(ctx, task)
+	c.Assert(err, check.IsNil)
+	c.Assert(metaDataManager.updateLastModifiedAndETag(ctx, task.ID, 0, testETag), check.IsNil)
+	c.Assert(metaDataManager.updateCacheDirectives(ctx, task.ID, "", "", getCurrentTimeMillisFunc()), check.IsNil)
+	c.Assert(metaDataManager.updateStatusAndResult(ctx, task.ID, &fileMetaData{
+		Finish:     true,
+		Success:    true,
+		RealMd5:    "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		FileLength: 11,
+	}), check.IsNil)
+	c.Assert(s.cacheStore.PutBytes(ctx, getDownloadRawFunc(task.ID), []byte("hello world")), check.IsNil)
+	metaData, err := metaDataManager.readFileMetaData(ctx, task.ID)
+	c.Assert(err, check.IsNil)
+
+	cfg := config.NewConfig()
+	cfg.OriginIgnoreConditionalThreshold = 2
+	cfg.OriginIgnoreConditionalPeriod = time.Minute
+	cfg.OriginIgnoreConditionalTTL = time.Minute
+	detector := newCacheDetector(cfg, s.cacheStore, metaDataManager,
+		httpclient.NewOriginClientWithConfig(cfg, prometheus.NewRegistry()))
+
+	// the cached file is reused since the ETag responded is unchanged,
+	// and the source is recognized as ignoring the conditional requests.
+	for i := 0; i < cfg.OriginIgnoreConditionalThreshold; i++ {
+		breakNum, revalidated, err := detector.parseBreakNum(ctx, task, metaData)
+		c.Assert(err, check.IsNil)
+		c.Check(breakNum, check.Equals, -1)
+		c.Check(revalidated, check.Equals, true)
+	}
+	c.Check(atomic.LoadInt32(&conditionalReqs), check.Equals, int32(cfg.OriginIgnoreConditionalThreshold))
+
+	// the source is not revalidated any more within the TTL since the file was downloaded
+	breakNum, revalidated, err := detector.parseBreakNum(ctx, task, metaData)
+	c.Assert(err, check.IsNil)
+	c.Check(breakNum, check.Equals, -1)
+	c.Check(revalidated, check.Equals, false)
+	c.Check(atomic.LoadInt32(&conditionalReqs), check.Equals, int32(cfg.OriginIgnoreConditionalThreshold))
+
+	// and the file is downloaded again without revalidation after that
+	metaData.ResponseTime -= 61 * 1000
+	breakNum, _, err = detector.parseBreakNum(ctx, task, metaData)
+	c.Assert(err, check.IsNil)
+	c.Check(breakNum, check.Equals, 0)
+	c.Check(atomic.LoadInt32(&conditionalReqs), check.Equals, int32(cfg.OriginIgnoreConditionalThreshold))
+}
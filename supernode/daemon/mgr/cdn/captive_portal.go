@@ -0,0 +1,97 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	netUrl "net/url"
+	"path"
+	"strings"
+
+	errorType "github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+)
+
+// captivePortalMaxPageSize is the max size of the HTML page regarded as the login page
+// of a captive portal, which is usually a few KB.
+const captivePortalMaxPageSize = 64 * 1024
+
+// htmlExtensions contains the extensions of the files expected to be HTML.
+var htmlExtensions = map[string]bool{
+	".htm":   true,
+	".html":  true,
+	".xhtml": true,
+}
+
+// checkCaptivePortal returns the ErrCaptivePortal if the response of the url looks like
+// the login page of a captive portal, which is redirected to the URL containing any of the patterns,
+// or a small HTML page while the file of the url isn't HTML as per its extension.
+// The file of the url without an extension may be a page as well, unless the expected
+// httpFileLength got at the registration is larger than a page.
+func checkCaptivePortal(url string, httpFileLength int64, resp *http.Response, patterns []string) error {
+	if resp.Request != nil && resp.Request.URL != nil {
+		if finalURL := resp.Request.URL.String(); finalURL != url {
+			for _, pattern := range patterns {
+				if pattern != "" && strings.Contains(finalURL, pattern) {
+					return errors.Wrapf(errorType.ErrCaptivePortal, "redirected to %s matching %q", finalURL, pattern)
+				}
+			}
+		}
+	}
+
+	if !isHTML(resp.Header.Get("Content-Type")) {
+		return nil
+	}
+	ext, err := getExtension(url)
+	if err != nil || htmlExtensions[ext] || ext == "" && httpFileLength <= captivePortalMaxPageSize {
+		return nil
+	}
+	// the length of the page generated on the fly is usually unknown.
+	if resp.ContentLength > captivePortalMaxPageSize {
+		return nil
+	}
+	return errors.Wrapf(errorType.ErrCaptivePortal, "the source of %s responded an HTML page of %s",
+		url, describeLength(resp.ContentLength))
+}
+
+// isHTML returns whether the media type of the contentType is HTML.
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// getExtension returns the extension in lower case of the path of the url.
+func getExtension(url string) (string, error) {
+	u, err := netUrl.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(path.Ext(u.Path)), nil
+}
+
+func describeLength(length int64) string {
+	if length < 0 {
+		return "unknown length"
+	}
+	return fmt.Sprintf("%d bytes", length)
+}
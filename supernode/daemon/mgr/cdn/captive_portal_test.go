@@ -0,0 +1,117 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const captivePortalPage = "<html><body><form action=\"/login\">Sign in to the network</form></body></html>"
+
+type CaptivePortalTestSuite struct{}
+
+func init() {
+	check.Suite(&CaptivePortalTestSuite{})
+}
+
+// newCaptivePortalServer returns a source which responds the file at /legit/*,
+// the login page at /portal/login and /intercepted/* and redirects /redirected/* to the login page.
+func newCaptivePortalServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/legit/"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("dragonfly"))
+		case strings.HasPrefix(r.URL.Path, "/redirected/"):
+			http.Redirect(w, r, "/portal/login", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(captivePortalPage))
+		}
+	}))
+}
+
+func (s *CaptivePortalTestSuite) download(c *check.C, cfg *config.Config, url string, httpFileLength int64) (string, error) {
+	cm, err := NewManager(cfg, nil, nil, httpclient.NewOriginClient(), prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	resp, err := cm.download(context.Background(), "taskID", url, nil, 0, httpFileLength, 0, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	return string(data), nil
+}
+
+func (s *CaptivePortalTestSuite) TestRejectCaptivePortal(c *check.C) {
+	server := newCaptivePortalServer()
+	defer server.Close()
+
+	cfg := config.NewConfig()
+	cfg.RejectCaptivePortal = true
+	cfg.CaptivePortalPatterns = []string{"/portal/"}
+
+	// the legitimate download
+	data, err := s.download(c, cfg, server.URL+"/legit/file.tar.gz", 9)
+	c.Assert(err, check.IsNil)
+	c.Check(data, check.Equals, "dragonfly")
+
+	// the login page responded for a file which isn't HTML
+	_, err = s.download(c, cfg, server.URL+"/intercepted/file.tar.gz", -1)
+	c.Check(errortypes.IsCaptivePortal(err), check.Equals, true)
+
+	// and for a large file without an extension
+	_, err = s.download(c, cfg, server.URL+"/intercepted/file", 100*1024*1024)
+	c.Check(errortypes.IsCaptivePortal(err), check.Equals, true)
+
+	// the redirect to the known portal
+	_, err = s.download(c, cfg, server.URL+"/redirected/file", -1)
+	c.Check(errortypes.IsCaptivePortal(err), check.Equals, true)
+
+	// the HTML files are downloaded as they are
+	data, err = s.download(c, cfg, server.URL+"/intercepted/index.html", -1)
+	c.Assert(err, check.IsNil)
+	c.Check(data, check.Equals, captivePortalPage)
+	data, err = s.download(c, cfg, server.URL+"/intercepted/page", int64(len(captivePortalPage)))
+	c.Assert(err, check.IsNil)
+	c.Check(data, check.Equals, captivePortalPage)
+}
+
+func (s *CaptivePortalTestSuite) TestCaptivePortalDetectionDisabled(c *check.C) {
+	server := newCaptivePortalServer()
+	defer server.Close()
+
+	cfg := config.NewConfig()
+	cfg.CaptivePortalPatterns = []string{"/portal/"}
+	for _, path := range []string{"/intercepted/file.tar.gz", "/redirected/file"} {
+		data, err := s.download(c, cfg, server.URL+path, -1)
+		c.Assert(err, check.IsNil)
+		c.Check(data, check.Equals, captivePortalPage)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// getDigestAlgorithm returns the algorithm of the digest of the whole content of the task.
+func getDigestAlgorithm(task *types.TaskInfo) string {
+	if stringutils.IsEmptyStr(task.DigestAlgorithm) {
+		return digest.AlgorithmMD5
+	}
+	return task.DigestAlgorithm
+}
+
+// newContentDigest returns the hash to compute the digest of the whole content of the task
+// while downloading it, or nil if the algorithm is md5 which is computed anyway.
+// The content cached before the startPieceNum is hashed in advance to resume the download.
+func (cm *Manager) newContentDigest(ctx context.Context, task *types.TaskInfo, startPieceNum int, pieceContSize int32) (hash.Hash, error) {
+	algorithm := getDigestAlgorithm(task)
+	if algorithm == digest.AlgorithmMD5 {
+		return nil, nil
+	}
+
+	h, err := digest.NewHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if startPieceNum <= 0 {
+		return h, nil
+	}
+
+	content, err := cm.OpenPartialContent(ctx, task.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	length := int64(startPieceNum) * int64(pieceContSize)
+	if _, err := io.Copy(h, io.NewSectionReader(content, 0, length)); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// setContentDigest records the digest of the whole content downloaded in the updateTaskInfo,
+// which is the realMD5 if the algorithm is md5, or the sum of the contentDigest otherwise.
+func (cm *Manager) setContentDigest(ctx context.Context, task *types.TaskInfo, updateTaskInfo *types.TaskInfo, contentDigest hash.Hash) {
+	algorithm := getDigestAlgorithm(task)
+	updateTaskInfo.DigestAlgorithm = algorithm
+	if contentDigest == nil {
+		updateTaskInfo.Digest = updateTaskInfo.RealMd5
+		return
+	}
+
+	updateTaskInfo.Digest = fmt.Sprintf("%x", contentDigest.Sum(nil))
+	if err := cm.metaDataManager.updateDigest(ctx, task.ID, algorithm, updateTaskInfo.Digest); err != nil {
+		logrus.Errorf("failed to update the %s digest of taskID %s: %v", algorithm, task.ID, err)
+	}
+}
+
+// setCachedDigest records the digest of the whole content cached in the updateTaskInfo,
+// which is computed by reading the cached content if it's not recorded with the algorithm.
+// The digest is left empty if it fails to be computed, without failing the task.
+func (cm *Manager) setCachedDigest(ctx context.Context, task *types.TaskInfo, metaData *fileMetaData, updateTaskInfo *types.TaskInfo) {
+	algorithm := getDigestAlgorithm(task)
+	if algorithm == digest.AlgorithmMD5 {
+		cm.setContentDigest(ctx, task, updateTaskInfo, nil)
+		return
+	}
+	if metaData.DigestAlgorithm == algorithm && !stringutils.IsEmptyStr(metaData.Digest) {
+		updateTaskInfo.DigestAlgorithm = algorithm
+		updateTaskInfo.Digest = metaData.Digest
+		return
+	}
+
+	h, err := digest.NewHash(algorithm)
+	if err != nil {
+		logrus.Errorf("failed to compute the %s digest of the cached taskID %s: %v", algorithm, task.ID, err)
+		return
+	}
+	content, err := cm.OpenContent(ctx, task.ID)
+	if err != nil {
+		logrus.Errorf("failed to compute the %s digest of the cached taskID %s: %v", algorithm, task.ID, err)
+		return
+	}
+	defer content.Close()
+	if _, err := io.Copy(h, content); err != nil {
+		logrus.Errorf("failed to compute the %s digest of the cached taskID %s: %v", algorithm, task.ID, err)
+		return
+	}
+	cm.setContentDigest(ctx, task, updateTaskInfo, h)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/md5"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// contentDecoders contains the decoders of the content encodings which supernode can normalize.
+// key:content encoding,value:the function to create a reader of the decoded content
+var contentDecoders = map[string]func(io.Reader) (io.Reader, error){
+	"gzip": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	"x-gzip": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	// the deflate content encoding of HTTP is the zlib format.
+	"deflate": func(r io.Reader) (io.Reader, error) {
+		return zlib.NewReader(r)
+	},
+}
+
+// getNormalizedEncoding returns the content encoding of the response which should be
+// decoded to store the content in the identity form, and returns "" if no need to decode.
+//
+// The content will be normalized only when it's downloaded from the beginning,
+// because a range of the encoded content can't be decoded independently.
+func (cm *Manager) getNormalizedEncoding(header http.Header, startPieceNum int) string {
+	if cm.cfg == nil || !cm.cfg.NormalizeContentEncoding || startPieceNum > 0 {
+		return ""
+	}
+
+	contentEncoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding")))
+	if _, ok := contentDecoders[contentEncoding]; !ok {
+		return ""
+	}
+	return contentEncoding
+}
+
+// normalize returns a reader of the content decoded from the reader with contentEncoding,
+// and a hash which calculates the md5 of the original content while reading.
+func (cm *Manager) normalize(ctx context.Context, taskID string, reader io.Reader, contentEncoding string) (io.Reader, hash.Hash, error) {
+	// record the content encoding in advance to avoid resuming
+	// the download of the decoded content with the range of the encoded content.
+	if err := cm.metaDataManager.updateContentEncoding(ctx, taskID, contentEncoding); err != nil {
+		return nil, nil, err
+	}
+
+	originalMD5 := md5.New()
+	decoded, err := contentDecoders[contentEncoding](io.TeeReader(reader, originalMD5))
+	if err != nil {
+		return nil, nil, err
+	}
+	logrus.Infof("start to normalize the content encoding %s to identity for taskID: %s", contentEncoding, taskID)
+	return decoded, originalMD5, nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+
+	"github.com/go-check/check"
+)
+
+type ContentEncodingTestSuite struct {
+	cdnFixture
+	server *httptest.Server
+
+	content []byte
+	encoded []byte
+}
+
+func init() {
+	check.Suite(&ContentEncodingTestSuite{})
+}
+
+func (s *ContentEncodingTestSuite) SetUpSuite(c *check.C) {
+	s.setUpFixture(c, "ContentEncodingTestSuite")
+
+	s.content = []byte(strings.Repeat("hello dragonfly, ", 1024))
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err := gw.Write(s.content)
+	c.Assert(err, check.IsNil)
+	c.Assert(gw.Close(), check.IsNil)
+	s.encoded = buf.Bytes()
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.URL.Path != "/chunked" {
+			w.Write(s.encoded)
+			return
+		}
+		// send the encoded content with the chunked Transfer-Encoding
+		half := len(s.encoded) / 2
+		w.Write(s.encoded[:half])
+		w.(http.Flusher).Flush()
+		w.Write(s.encoded[half:])
+	}))
+}
+
+func (s *ContentEncodingTestSuite) TearDownSuite(c *check.C) {
+	s.server.Close()
+	s.tearDownFixture(c)
+}
+
+func (s *ContentEncodingTestSuite) triggerCDN(c *check.C, cfg *config.Config, taskID string) *types.TaskInfo {
+	// ask for the encoded content explicitly
+	return s.triggerCDNWithHeaders(c, cfg, taskID, "", map[string]string{"Accept-Encoding": "gzip"})
+}
+
+func (s *ContentEncodingTestSuite) triggerCDNWithHeaders(c *check.C, cfg *config.Config, taskID, path string,
+	headers map[string]string) *types.TaskInfo {
+	updateTaskInfo, err := s.trigger(c, cfg, &types.TaskInfo{
+		ID:             taskID,
+		RawURL:         s.server.URL + path,
+		TaskURL:        s.server.URL + path,
+		PieceSize:      1024 * 1024,
+		HTTPFileLength: int64(len(s.encoded)),
+		Headers:        headers,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	return updateTaskInfo
+}
+
+// readStoredMd5 returns the md5 of the content stored for taskID without the piece wrappers.
+func (s *ContentEncodingTestSuite) readStoredMd5(c *check.C, taskID string) string {
+	reader, err := s.cacheStore.Get(context.TODO(), getDownloadRawFunc(taskID))
+	c.Assert(err, check.IsNil)
+	result, err := newSuperReader().readFile(context.TODO(), reader, true, true)
+	c.Assert(err, check.IsNil)
+	return fmt.Sprintf("%x", result.fileMd5.Sum(nil))
+}
+
+func (s *ContentEncodingTestSuite) TestNormalizeGzipToIdentity(c *check.C) {
+	taskID := "contentEncodingTaskID1"
+	cfg := config.NewConfig()
+	cfg.NormalizeContentEncoding = true
+
+	updateTaskInfo := s.triggerCDN(c, cfg, taskID)
+	contentMd5 := fmt.Sprintf("%x", md5.Sum(s.content))
+	c.Check(updateTaskInfo.RealMd5, check.Equals, contentMd5)
+	c.Check(updateTaskInfo.OriginalMd5, check.Equals, fmt.Sprintf("%x", md5.Sum(s.encoded)))
+	c.Check(s.readStoredMd5(c, taskID), check.Equals, contentMd5)
+
+	metaData, err := newFileMetaDataManager(s.cacheStore).readFileMetaData(context.TODO(), taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(metaData.ContentEncoding, check.Equals, "gzip")
+	c.Check(metaData.RealMd5, check.Equals, updateTaskInfo.RealMd5)
+	c.Check(metaData.OriginalMd5, check.Equals, updateTaskInfo.OriginalMd5)
+}
+
+func (s *ContentEncodingTestSuite) TestStoreEncodedContentByDefault(c *check.C) {
+	taskID := "contentEncodingTaskID2"
+
+	updateTaskInfo := s.triggerCDN(c, config.NewConfig(), taskID)
+	encodedMd5 := fmt.Sprintf("%x", md5.Sum(s.encoded))
+	c.Check(updateTaskInfo.RealMd5, check.Equals, encodedMd5)
+	c.Check(updateTaskInfo.OriginalMd5, check.Equals, "")
+	c.Check(s.readStoredMd5(c, taskID), check.Equals, encodedMd5)
+}
+
+func (s *ContentEncodingTestSuite) TestNeverDecodeContentEncoding(c *check.C) {
+	encodedMd5 := fmt.Sprintf("%x", md5.Sum(s.encoded))
+	originClient := httpclient.NewOriginClient()
+
+	// the length of the source is the length of the encoded entity
+	// even if the Accept-Encoding is not specified.
+	fileLength, code, err := originClient.GetContentLength(s.server.URL, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusOK)
+	c.Check(fileLength, check.Equals, int64(len(s.encoded)))
+
+	for i, path := range []string{"", "/chunked"} {
+		taskID := fmt.Sprintf("contentEncodingTaskID%d", i+3)
+		updateTaskInfo := s.triggerCDNWithHeaders(c, config.NewConfig(), taskID, path, nil)
+		c.Check(updateTaskInfo.RealMd5, check.Equals, encodedMd5, check.Commentf("path: %s", path))
+		c.Check(updateTaskInfo.FileLength, check.Equals, int64(len(s.encoded))+config.PieceWrapSize)
+		c.Check(s.readStoredMd5(c, taskID), check.Equals, encodedMd5)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"io"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/pkg/errors"
+)
+
+// OpenContent opens the content of the file of taskID which has been downloaded successfully.
+func (cm *Manager) OpenContent(ctx context.Context, taskID string) (*mgr.Content, error) {
+	return cm.openContent(ctx, taskID, false)
+}
+
+// OpenPartialContent opens the content of the file of taskID which is being downloaded
+// or has been downloaded successfully.
+func (cm *Manager) OpenPartialContent(ctx context.Context, taskID string) (*mgr.Content, error) {
+	return cm.openContent(ctx, taskID, true)
+}
+
+func (cm *Manager) openContent(ctx context.Context, taskID string, partial bool) (*mgr.Content, error) {
+	metaData, err := cm.metaDataManager.readFileMetaData(ctx, taskID)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return nil, errors.Wrapf(errortypes.ErrDataNotFound, "meta data of taskID: %s", taskID)
+		}
+		return nil, err
+	}
+	// only the file being downloaded can be opened partially
+	if metaData.Finish && !metaData.Success || !metaData.Finish && !partial {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "taskID %s has not been downloaded successfully", taskID)
+	}
+
+	file, err := cm.OpenFile(ctx, taskID)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return nil, errors.Wrapf(errortypes.ErrDataNotFound, "file of taskID: %s", taskID)
+		}
+		return nil, err
+	}
+	var content *contentFile
+	if partial && !metaData.Finish {
+		content, err = newPartialContentFile(file, metaData.PieceSize)
+	} else {
+		content, err = newContentFile(file, metaData.PieceSize)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &mgr.Content{
+		File:         content,
+		LastModified: metaData.LastModified,
+		ETag:         metaData.ETag,
+		CacheControl: metaData.CacheControl,
+		Expires:      metaData.Expires,
+		ResponseTime: metaData.ResponseTime,
+	}, nil
+}
+
+// contentFile reads the file stored in pieces as the content without
+// the header and the trailer of each piece.
+type contentFile struct {
+	store.File
+
+	pieceSize     int64
+	pieceContSize int64
+	// size is the length of the content.
+	size int64
+	// offset is the offset of the content to read next.
+	offset int64
+}
+
+func newContentFile(file store.File, pieceSize int32) (*contentFile, error) {
+	if pieceSize <= config.PieceWrapSize {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "piece size: %d", pieceSize)
+	}
+
+	fileLength, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	pieceCount := (fileLength + int64(pieceSize) - 1) / int64(pieceSize)
+	size := fileLength - pieceCount*config.PieceWrapSize
+	if size < 0 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "file length %d with piece size %d", fileLength, pieceSize)
+	}
+
+	return &contentFile{
+		File:          file,
+		pieceSize:     int64(pieceSize),
+		pieceContSize: int64(pieceSize - config.PieceWrapSize),
+		size:          size,
+	}, nil
+}
+
+// newPartialContentFile returns the content of the file being downloaded, whose size
+// counts the piece being written at the end. The pieces may be written out of order,
+// so only the pieces known to be downloaded should be read.
+func newPartialContentFile(file store.File, pieceSize int32) (*contentFile, error) {
+	if pieceSize <= config.PieceWrapSize {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "piece size: %d", pieceSize)
+	}
+
+	fileLength, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	pieceContSize := int64(pieceSize - config.PieceWrapSize)
+	size := fileLength / int64(pieceSize) * pieceContSize
+	if rest := fileLength%int64(pieceSize) - config.PieceWrapSize; rest > 0 {
+		size += rest
+	}
+
+	return &contentFile{
+		File:          file,
+		pieceSize:     int64(pieceSize),
+		pieceContSize: pieceContSize,
+		size:          size,
+	}, nil
+}
+
+// ReadAt reads the content at the offset, which skips the headers and the trailers of the pieces.
+func (cf *contentFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.Wrapf(errortypes.ErrInvalidValue, "offset: %d", off)
+	}
+
+	var n int
+	for n < len(p) {
+		if off >= cf.size {
+			return n, io.EOF
+		}
+
+		// read the rest of the piece where the offset is at most
+		pieceNum, pieceOffset := off/cf.pieceContSize, off%cf.pieceContSize
+		length := cf.pieceContSize - pieceOffset
+		if remaining := cf.size - off; remaining < length {
+			length = remaining
+		}
+		if remaining := int64(len(p) - n); remaining < length {
+			length = remaining
+		}
+
+		fileOffset := pieceNum*cf.pieceSize + config.PieceHeadSize + pieceOffset
+		read, err := cf.File.ReadAt(p[n:n+int(length)], fileOffset)
+		n += read
+		off += int64(read)
+		if err != nil && !(err == io.EOF && int64(read) == length) {
+			if err == io.EOF {
+				return n, io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Read reads the content from the current offset.
+func (cf *contentFile) Read(p []byte) (int, error) {
+	n, err := cf.ReadAt(p, cf.offset)
+	cf.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		return n, nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the content to read next.
+func (cf *contentFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += cf.offset
+	case io.SeekEnd:
+		offset += cf.size
+	default:
+		return 0, errors.Wrapf(errortypes.ErrInvalidValue, "whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.Wrapf(errortypes.ErrInvalidValue, "offset: %d", offset)
+	}
+
+	cf.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+type ContentFileTestSuite struct{}
+
+func init() {
+	check.Suite(&ContentFileTestSuite{})
+}
+
+// bytesFile is a store.File of the bytes in memory.
+type bytesFile struct {
+	*bytes.Reader
+}
+
+func (f *bytesFile) Close() error {
+	return nil
+}
+
+// wrapPieces wraps the content with the header and the trailer of each piece.
+func wrapPieces(content []byte, pieceSize int32) []byte {
+	pieceContSize := int(pieceSize - config.PieceWrapSize)
+	var buf bytes.Buffer
+	for start := 0; start < len(content); start += pieceContSize {
+		end := start + pieceContSize
+		if end > len(content) {
+			end = len(content)
+		}
+		header := make([]byte, config.PieceHeadSize)
+		binary.BigEndian.PutUint32(header, getPieceHeader(int32(end-start), pieceSize))
+		buf.Write(header)
+		buf.Write(content[start:end])
+		buf.WriteByte(config.PieceTailChar)
+	}
+	return buf.Bytes()
+}
+
+func (s *ContentFileTestSuite) TestContentFile(c *check.C) {
+	var pieceSize = int32(10 + config.PieceWrapSize)
+	content := []byte("hello dragonfly, the content is stored in pieces")
+	file := &bytesFile{bytes.NewReader(wrapPieces(content, pieceSize))}
+
+	cf, err := newContentFile(file, pieceSize)
+	c.Assert(err, check.IsNil)
+
+	// the whole content is read without the headers and trailers
+	data, err := ioutil.ReadAll(cf)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, string(content))
+
+	// the size is got by seeking to the end
+	size, err := cf.Seek(0, io.SeekEnd)
+	c.Assert(err, check.IsNil)
+	c.Check(size, check.Equals, int64(len(content)))
+
+	// the content across the pieces is read at random offsets
+	for _, v := range []struct {
+		off    int64
+		length int
+	}{
+		{off: 0, length: 10},
+		{off: 7, length: 6},
+		{off: 9, length: 25},
+		{off: 40, length: int(size) - 40},
+	} {
+		buf := make([]byte, v.length)
+		n, err := cf.ReadAt(buf, v.off)
+		c.Check(err, check.IsNil)
+		c.Check(string(buf[:n]), check.Equals, string(content[v.off:v.off+int64(v.length)]))
+	}
+
+	// the read beyond the content ends with EOF
+	buf := make([]byte, 10)
+	n, err := cf.ReadAt(buf, size-3)
+	c.Check(err, check.Equals, io.EOF)
+	c.Check(string(buf[:n]), check.Equals, string(content[size-3:]))
+
+	// the read continues from the offset seeked to
+	_, err = cf.Seek(12, io.SeekStart)
+	c.Assert(err, check.IsNil)
+	n, err = cf.Read(buf)
+	c.Check(err, check.IsNil)
+	c.Check(string(buf[:n]), check.Equals, string(content[12:22]))
+}
+
+func (s *ContentFileTestSuite) TestContentFileWithInvalidPieceSize(c *check.C) {
+	file := &bytesFile{bytes.NewReader(nil)}
+	_, err := newContentFile(file, config.PieceWrapSize)
+	c.Check(err, check.NotNil)
+}
+
+func (s *ContentFileTestSuite) TestPartialContentFile(c *check.C) {
+	var pieceSize = int32(10 + config.PieceWrapSize)
+	content := []byte("hello dragonfly, the content is stored in pieces")
+	wrapped := wrapPieces(content, pieceSize)
+
+	for _, v := range []struct {
+		fileLength int
+		size       int64
+	}{
+		{fileLength: 0, size: 0},
+		{fileLength: 2 * int(pieceSize), size: 20},
+		// the header of the piece being written
+		{fileLength: 2*int(pieceSize) + 3, size: 20},
+		// the piece being written, whose size is counted without the trailer to come
+		{fileLength: 2*int(pieceSize) + config.PieceHeadSize + 6, size: 25},
+		{fileLength: len(wrapped), size: int64(len(content))},
+	} {
+		cf, err := newPartialContentFile(&bytesFile{bytes.NewReader(wrapped[:v.fileLength])}, pieceSize)
+		c.Assert(err, check.IsNil)
+		size, err := cf.Seek(0, io.SeekEnd)
+		c.Assert(err, check.IsNil)
+		c.Check(size, check.Equals, v.size, check.Commentf("file length: %d", v.fileLength))
+
+		buf := make([]byte, size)
+		n, err := cf.ReadAt(buf, 0)
+		c.Check(n, check.Equals, int(size))
+		c.Check(string(buf[:n]), check.Equals, string(content[:size]))
+	}
+
+	_, err := newPartialContentFile(&bytesFile{bytes.NewReader(nil)}, config.PieceWrapSize)
+	c.Check(err, check.NotNil)
+}
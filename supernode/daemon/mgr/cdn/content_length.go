@@ -0,0 +1,69 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"io"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// contentLengthReader counts the bytes read from the response body of the source
+// and reports the body which is shorter than the declared Content-Length.
+type contentLengthReader struct {
+	reader   io.Reader
+	taskID   string
+	declared int64
+	received int64
+	tolerant bool
+}
+
+// newContentLengthReader creates a reader of the response body which declares contentLength.
+func (cm *Manager) newContentLengthReader(taskID string, body io.Reader, contentLength int64) *contentLengthReader {
+	return &contentLengthReader{
+		reader:   body,
+		taskID:   taskID,
+		declared: contentLength,
+		tolerant: cm.tolerateContentLengthMismatch(),
+	}
+}
+
+// Read reads the body and converts the unexpected EOF caused by the truncated body
+// to the end of the content if the mismatch is tolerated.
+func (r *contentLengthReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.received += int64(n)
+	if err != io.ErrUnexpectedEOF {
+		return n, err
+	}
+
+	logrus.Warnf("taskID: %s the source declares Content-Length %d but only %d bytes are received",
+		r.taskID, r.declared, r.received)
+	if r.tolerant {
+		return n, io.EOF
+	}
+	return n, errors.Wrapf(errortypes.ErrContentLengthMismatch, "declared: %d received: %d", r.declared, r.received)
+}
+
+// tolerateContentLengthMismatch returns whether to trust the bytes actually received
+// when they don't match the Content-Length declared by the source.
+func (cm *Manager) tolerateContentLengthMismatch() bool {
+	return cm.cfg != nil && cm.cfg.BaseProperties != nil && cm.cfg.TolerateContentLengthMismatch
+}
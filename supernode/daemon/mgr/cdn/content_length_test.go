@@ -0,0 +1,93 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/pkg/errors"
+)
+
+type ContentLengthTestSuite struct {
+	cdnFixture
+	server *httptest.Server
+
+	content []byte
+}
+
+func init() {
+	check.Suite(&ContentLengthTestSuite{})
+}
+
+func (s *ContentLengthTestSuite) SetUpSuite(c *check.C) {
+	s.setUpFixture(c, "ContentLengthTestSuite")
+
+	s.content = []byte(strings.Repeat("hello dragonfly, ", 1024))
+	// the source declares more bytes than it sends
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.content)+100))
+		w.Write(s.content)
+	}))
+}
+
+func (s *ContentLengthTestSuite) TearDownSuite(c *check.C) {
+	s.server.Close()
+	s.tearDownFixture(c)
+}
+
+func (s *ContentLengthTestSuite) triggerCDN(c *check.C, cfg *config.Config, taskID string) (*types.TaskInfo, error) {
+	return s.trigger(c, cfg, &types.TaskInfo{
+		ID:             taskID,
+		RawURL:         s.server.URL,
+		TaskURL:        s.server.URL,
+		PieceSize:      1024 * 1024,
+		HTTPFileLength: int64(len(s.content) + 100),
+	})
+}
+
+func (s *ContentLengthTestSuite) TestFailOnMismatchByDefault(c *check.C) {
+	taskID := "contentLengthTaskID1"
+
+	updateTaskInfo, err := s.triggerCDN(c, config.NewConfig(), taskID)
+	c.Assert(err, check.NotNil)
+	c.Check(errortypes.IsContentLengthMismatch(errors.Cause(err)), check.Equals, true)
+	c.Assert(updateTaskInfo, check.NotNil)
+	c.Check(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusFAILED)
+}
+
+func (s *ContentLengthTestSuite) TestTolerateMismatch(c *check.C) {
+	taskID := "contentLengthTaskID2"
+	cfg := config.NewConfig()
+	cfg.TolerateContentLengthMismatch = true
+
+	updateTaskInfo, err := s.triggerCDN(c, cfg, taskID)
+	c.Assert(err, check.IsNil)
+	c.Assert(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	c.Check(updateTaskInfo.HTTPFileLength, check.Equals, int64(len(s.content)))
+	c.Check(updateTaskInfo.FileLength, check.Equals, int64(len(s.content))+config.PieceWrapSize)
+	c.Check(updateTaskInfo.RealMd5, check.Equals, fmt.Sprintf("%x", md5.Sum(s.content)))
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/pkg/errors"
+)
+
+// pieceMD5Lookup returns the piece md5 recorded for the pieceNum, or "" if there is none.
+type pieceMD5Lookup func(pieceNum int) string
+
+// VerifyFile verifies each piece of the downloaded file of taskID against the piece md5
+// recorded when it was downloaded, and returns the ErrContentCorrupted if any differs.
+// The pieces without the recorded piece md5s are skipped.
+func (cm *Manager) VerifyFile(ctx context.Context, taskID string) error {
+	metaData, err := cm.metaDataManager.readFileMetaData(ctx, taskID)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return errors.Wrapf(errortypes.ErrDataNotFound, "meta data of taskID: %s", taskID)
+		}
+		return err
+	}
+	file, err := cm.cacheStore.Open(ctx, getDownloadRawFunc(taskID))
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return errors.Wrapf(errortypes.ErrDataNotFound, "file of taskID: %s", taskID)
+		}
+		return err
+	}
+	defer file.Close()
+
+	fileLength, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	lookup := cm.newPieceMD5Lookup(ctx, taskID, metaData)
+	pieceSize := int64(metaData.PieceSize)
+	for pieceNum := 0; int64(pieceNum)*pieceSize < fileLength; pieceNum++ {
+		if err := verifyPiece(file, pieceSize, pieceNum, lookup(pieceNum)); err != nil {
+			return errors.Wrapf(err, "taskID: %s", taskID)
+		}
+	}
+	return nil
+}
+
+// openVerifiedFile opens the downloaded file of taskID whose pieces are verified
+// against the recorded piece md5s when they're read.
+func (cm *Manager) openVerifiedFile(ctx context.Context, taskID string) (store.File, error) {
+	file, err := cm.cacheStore.Open(ctx, getDownloadRawFunc(taskID))
+	if err != nil {
+		return nil, err
+	}
+	// the file without the meta data has no recorded piece md5s to be verified against.
+	metaData, err := cm.metaDataManager.readFileMetaData(ctx, taskID)
+	if err != nil || metaData.PieceSize <= 0 {
+		return file, nil
+	}
+	return newVerifiedFile(file, metaData.PieceSize, cm.newPieceMD5Lookup(ctx, taskID, metaData)), nil
+}
+
+// newPieceMD5Lookup returns the lookup of the piece md5s of taskID, which are recorded in memory
+// while the pieces are being downloaded, or in the md5 file once the file is downloaded successfully.
+func (cm *Manager) newPieceMD5Lookup(ctx context.Context, taskID string, metaData *fileMetaData) pieceMD5Lookup {
+	var recorded []string
+	if metaData.Finish && metaData.Success && !stringutils.IsEmptyStr(metaData.RealMd5) {
+		recorded, _ = cm.metaDataManager.readPieceMD5s(ctx, taskID, metaData.RealMd5)
+	}
+	return func(pieceNum int) string {
+		if pieceMD5, err := cm.pieceMD5Manager.getPieceMD5(taskID, pieceNum); err == nil {
+			return pieceMD5
+		}
+		if pieceNum < len(recorded) {
+			return recorded[pieceNum]
+		}
+		return ""
+	}
+}
+
+// verifyPiece verifies the piece of the file, including its header and trailer, against
+// the expected piece md5 in the form of md5:length. The piece is not verified if it's empty.
+func verifyPiece(file io.ReaderAt, pieceSize int64, pieceNum int, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	index := strings.LastIndex(expected, ":")
+	if index < 0 {
+		return nil
+	}
+	pieceLength, err := strconv.ParseInt(expected[index+1:], 10, 32)
+	if err != nil || pieceLength <= 0 || pieceLength > pieceSize {
+		return nil
+	}
+
+	buf := make([]byte, pieceLength)
+	n, err := file.ReadAt(buf, int64(pieceNum)*pieceSize)
+	if int64(n) < pieceLength {
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return errors.Wrapf(errortypes.ErrContentCorrupted, "piece %d is truncated to %d bytes", pieceNum, n)
+	}
+	realMD5 := getPieceMd5Value(fmt.Sprintf("%x", md5.Sum(buf)), int32(pieceLength))
+	if realMD5 != expected {
+		return errors.Wrapf(errortypes.ErrContentCorrupted, "piece %d md5 expected: %s, real: %s", pieceNum, expected, realMD5)
+	}
+	return nil
+}
+
+// verifiedFile is the file stored in pieces whose pieces are verified against the recorded
+// piece md5s the first time they're read, and the read of a corrupted piece fails
+// with the ErrContentCorrupted.
+type verifiedFile struct {
+	store.File
+
+	pieceSize int64
+	lookup    pieceMD5Lookup
+
+	mu       sync.Mutex
+	verified map[int]bool
+	// offset is the offset of the file to read next.
+	offset int64
+}
+
+func newVerifiedFile(file store.File, pieceSize int32, lookup pieceMD5Lookup) *verifiedFile {
+	return &verifiedFile{
+		File:      file,
+		pieceSize: int64(pieceSize),
+		lookup:    lookup,
+		verified:  make(map[int]bool),
+	}
+}
+
+// verify verifies the pieces overlapping the length bytes at the offset which haven't been verified.
+func (vf *verifiedFile) verify(off int64, length int) error {
+	if length <= 0 {
+		return nil
+	}
+
+	vf.mu.Lock()
+	defer vf.mu.Unlock()
+	for pieceNum := int(off / vf.pieceSize); int64(pieceNum)*vf.pieceSize < off+int64(length); pieceNum++ {
+		if vf.verified[pieceNum] {
+			continue
+		}
+		if err := verifyPiece(vf.File, vf.pieceSize, pieceNum, vf.lookup(pieceNum)); err != nil {
+			return err
+		}
+		vf.verified[pieceNum] = true
+	}
+	return nil
+}
+
+// ReadAt reads the file at the offset after verifying the pieces to be read.
+func (vf *verifiedFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := vf.verify(off, len(p)); err != nil {
+		return 0, err
+	}
+	return vf.File.ReadAt(p, off)
+}
+
+// Read reads the file from the current offset after verifying the pieces to be read.
+func (vf *verifiedFile) Read(p []byte) (int, error) {
+	n, err := vf.ReadAt(p, vf.offset)
+	vf.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		return n, nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the file to read next.
+func (vf *verifiedFile) Seek(offset int64, whence int) (int64, error) {
+	off, err := vf.File.Seek(offset, whence)
+	if err != nil {
+		return off, err
+	}
+	vf.offset = off
+	return off, nil
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type ContentVerifyTestSuite struct {
+	cdnFixture
+}
+
+func init() {
+	check.Suite(&ContentVerifyTestSuite{})
+}
+
+func (s *ContentVerifyTestSuite) SetUpSuite(c *check.C) {
+	s.setUpFixture(c, "ContentVerifyTestSuite")
+}
+
+func (s *ContentVerifyTestSuite) TearDownSuite(c *check.C) {
+	s.tearDownFixture(c)
+}
+
+// pieceMD5sOf returns the piece md5s of the file stored in pieces.
+func pieceMD5sOf(file []byte, pieceSize int32) []string {
+	var pieceMD5s []string
+	for start := 0; start < len(file); start += int(pieceSize) {
+		end := start + int(pieceSize)
+		if end > len(file) {
+			end = len(file)
+		}
+		pieceMD5s = append(pieceMD5s, getPieceMd5Value(fmt.Sprintf("%x", md5.Sum(file[start:end])), int32(end-start)))
+	}
+	return pieceMD5s
+}
+
+// corrupt returns a copy of the file whose byte at the offset is flipped.
+func corrupt(file []byte, off int) []byte {
+	corrupted := append([]byte(nil), file...)
+	corrupted[off] ^= 0xff
+	return corrupted
+}
+
+func (s *ContentVerifyTestSuite) TestVerifiedFile(c *check.C) {
+	var pieceSize = int32(10 + config.PieceWrapSize)
+	wrapped := wrapPieces([]byte("hello dragonfly, the content is stored in pieces"), pieceSize)
+	pieceMD5s := pieceMD5sOf(wrapped, pieceSize)
+	lookup := func(pieceNum int) string {
+		if pieceNum < len(pieceMD5s) {
+			return pieceMD5s[pieceNum]
+		}
+		return ""
+	}
+
+	// the intact file is read as it is
+	vf := newVerifiedFile(&bytesFile{bytes.NewReader(wrapped)}, pieceSize, lookup)
+	data, err := ioutil.ReadAll(vf)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, string(wrapped))
+
+	// the corrupted piece fails the read, while the others are still read
+	corrupted := corrupt(wrapped, int(pieceSize)+config.PieceHeadSize+3)
+	vf = newVerifiedFile(&bytesFile{bytes.NewReader(corrupted)}, pieceSize, lookup)
+	buf := make([]byte, pieceSize)
+	n, err := vf.ReadAt(buf, 0)
+	c.Check(err, check.IsNil)
+	c.Check(n, check.Equals, int(pieceSize))
+	_, err = vf.ReadAt(buf[:2], int64(pieceSize)+5)
+	c.Check(errortypes.IsContentCorrupted(err), check.Equals, true)
+	_, err = ioutil.ReadAll(vf)
+	c.Check(errortypes.IsContentCorrupted(err), check.Equals, true)
+
+	// the truncated piece is corrupted as well
+	vf = newVerifiedFile(&bytesFile{bytes.NewReader(wrapped[:len(wrapped)-2])}, pieceSize, lookup)
+	_, err = ioutil.ReadAll(vf)
+	c.Check(errortypes.IsContentCorrupted(err), check.Equals, true)
+
+	// the content read from the corrupted file fails as well
+	cf, err := newContentFile(newVerifiedFile(&bytesFile{bytes.NewReader(corrupted)}, pieceSize, lookup), pieceSize)
+	c.Assert(err, check.IsNil)
+	_, err = ioutil.ReadAll(cf)
+	c.Check(errortypes.IsContentCorrupted(err), check.Equals, true)
+}
+
+func (s *ContentVerifyTestSuite) TestVerifyStoredFile(c *check.C) {
+	ctx := context.TODO()
+	var pieceSize = int32(10 + config.PieceWrapSize)
+	taskID := "contentVerifyTaskID"
+	wrapped := wrapPieces([]byte("hello dragonfly, the content is stored in pieces"), pieceSize)
+
+	cfg := config.NewConfig()
+	cfg.VerifyOnRead = true
+	cm, err := NewManager(cfg, s.cacheStore, nil, nil, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	c.Assert(s.cacheStore.PutBytes(ctx, getDownloadRawFunc(taskID), wrapped), check.IsNil)
+	c.Assert(cm.metaDataManager.writeFileMetaData(ctx, &fileMetaData{
+		TaskID:    taskID,
+		PieceSize: pieceSize,
+		RealMd5:   "fileMD5",
+		Finish:    true,
+		Success:   true,
+	}), check.IsNil)
+	c.Assert(cm.metaDataManager.writePieceMD5s(ctx, taskID, "fileMD5", pieceMD5sOf(wrapped, pieceSize)), check.IsNil)
+	c.Check(cm.VerifyFile(ctx, taskID), check.IsNil)
+
+	// the stored bytes are corrupted on disk
+	c.Assert(s.cacheStore.PutBytes(ctx, getDownloadRawFunc(taskID), corrupt(wrapped, 3*int(pieceSize)+config.PieceHeadSize)), check.IsNil)
+	c.Check(errortypes.IsContentCorrupted(cm.VerifyFile(ctx, taskID)), check.Equals, true)
+
+	// the corruption is detected on read as well
+	content, err := cm.OpenContent(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	defer content.Close()
+	buf := make([]byte, 10)
+	_, err = content.ReadAt(buf, 0)
+	c.Check(err, check.IsNil)
+	_, err = content.ReadAt(buf, 30)
+	c.Check(errortypes.IsContentCorrupted(err), check.Equals, true)
+
+	c.Check(errortypes.IsDataNotFound(cm.VerifyFile(ctx, "unknownTaskID")), check.Equals, true)
+}
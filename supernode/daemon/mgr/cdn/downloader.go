@@ -18,10 +18,15 @@ package cdn
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	errorType "github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
 	"github.com/dragonflyoss/Dragonfly/supernode/util"
 
 	"github.com/pkg/errors"
@@ -30,12 +35,19 @@ import (
 
 // download downloads the file from the original address and
 // sets the "Range" header to the undownloaded file range.
+// The "If-Range" header is set to ifRange if it's not empty, so that the source
+// responds the whole file instead of the range if the file has been changed.
 //
 // If the returned error is nil, the Response will contain a non-nil
 // Body which the caller is expected to close.
 func (cm *Manager) download(ctx context.Context, taskID, url string, headers map[string]string,
-	startPieceNum int, httpFileLength int64, pieceContSize int32) (*http.Response, error) {
+	startPieceNum int, httpFileLength int64, pieceContSize int32, ifRange string) (*http.Response, error) {
 	var checkCode = http.StatusOK
+	var rangeStart int64
+
+	// always send an unconditional request to get the content of the file,
+	// and never modify the headers of the task.
+	headers = getUnconditionalHeaders(headers)
 
 	if startPieceNum > 0 {
 		breakRange, err := util.CalculateBreakRange(startPieceNum, int(pieceContSize), httpFileLength)
@@ -43,13 +55,118 @@ func (cm *Manager) download(ctx context.Context, taskID, url string, headers map
 			return nil, errors.Wrapf(errorType.ErrInvalidValue, "failed to calculate the breakRange: %v", err)
 		}
 
-		if headers == nil {
-			headers = make(map[string]string)
-		}
 		headers["Range"] = httputils.ConstructRangeStr(breakRange)
+		if ifRange != "" {
+			headers["If-Range"] = ifRange
+		}
 		checkCode = http.StatusPartialContent
+		rangeStart = int64(startPieceNum) * int64(pieceContSize)
 	}
 
 	logrus.Infof("start to download for taskId(%s) with fileUrl: %s header: %v checkCode: %d", taskID, url, headers, checkCode)
-	return cm.originClient.Download(url, headers, checkCode)
+	resp, err := httpclient.ForTask(cm.originClient, taskID).Download(url, headers, checkCode)
+	if err != nil {
+		return nil, err
+	}
+
+	// the login page of a captive portal is never cached as the file
+	if cm.cfg.RejectCaptivePortal {
+		if err := checkCaptivePortal(url, httpFileLength, resp, cm.cfg.CaptivePortalPatterns); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	if checkCode != http.StatusPartialContent {
+		return resp, nil
+	}
+
+	// the resumed content must continue the pieces downloaded before
+	if err := validateContentRange(resp.Header.Get("Content-Range"), rangeStart, httpFileLength); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// getIfRange returns the validator of the file to resume its download with the If-Range,
+// or "" if there is none. The weak ETag is never used since the bytes of the files sharing
+// a weak ETag may differ, and the Last-Modified is used instead.
+func getIfRange(metaData *fileMetaData) string {
+	if metaData == nil {
+		return ""
+	}
+	// the metadata written by the older versions doesn't mark the weak ETag
+	if metaData.ETag != "" && !metaData.WeakETag && !netutils.IsWeakETag(metaData.ETag) {
+		return metaData.ETag
+	}
+	if metaData.LastModified > 0 {
+		lastModified, _ := netutils.ConvertTimeIntToString(metaData.LastModified)
+		return lastModified
+	}
+	return ""
+}
+
+// validateContentRange checks that the Content-Range of the partial content responded by
+// the source starts at the start offset of the file whose length is fileLength.
+// Otherwise the file may have been changed since the download was interrupted.
+func validateContentRange(contentRange string, start, fileLength int64) error {
+	rangeStart, _, total, err := parseContentRange(contentRange)
+	if err != nil {
+		return errors.Wrapf(errorType.ErrContentRangeMismatch, "%v", err)
+	}
+	if rangeStart != start {
+		return errors.Wrapf(errorType.ErrContentRangeMismatch, "Content-Range %q starts at %d, expected %d",
+			contentRange, rangeStart, start)
+	}
+	if total != fileLength {
+		return errors.Wrapf(errorType.ErrContentRangeMismatch, "Content-Range %q has the total length %d, expected %d",
+			contentRange, total, fileLength)
+	}
+	return nil
+}
+
+// parseContentRange parses the Content-Range in the form of "bytes start-end/total",
+// and the total length must be known.
+func parseContentRange(contentRange string) (start, end, total int64, err error) {
+	const prefix = "bytes "
+	if !strings.HasPrefix(contentRange, prefix) {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+	rangeStr := strings.TrimPrefix(contentRange, prefix)
+	slash := strings.IndexByte(rangeStr, '/')
+	if slash < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+	dash := strings.IndexByte(rangeStr[:slash], '-')
+	if dash < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+
+	if start, err = strconv.ParseInt(rangeStr[:dash], 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid start of Content-Range %q", contentRange)
+	}
+	if end, err = strconv.ParseInt(rangeStr[dash+1:slash], 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid end of Content-Range %q", contentRange)
+	}
+	if total, err = strconv.ParseInt(rangeStr[slash+1:], 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid total length of Content-Range %q", contentRange)
+	}
+	if start < 0 || start > end || end >= total {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+	return start, end, total, nil
+}
+
+// getUnconditionalHeaders returns a copy of the headers without the conditional headers,
+// otherwise the source may reply 304 Not Modified without the content.
+func getUnconditionalHeaders(headers map[string]string) map[string]string {
+	result := make(map[string]string, len(headers))
+	for k, v := range headers {
+		switch http.CanonicalHeaderKey(k) {
+		case "If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range":
+			continue
+		}
+		result[k] = v
+	}
+	return result
 }
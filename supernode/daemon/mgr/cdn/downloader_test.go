@@ -22,7 +22,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
@@ -31,6 +33,8 @@ import (
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
 
 	"github.com/go-check/check"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func Test(t *testing.T) {
@@ -45,7 +49,7 @@ func init() {
 }
 
 func (s *CDNDownloadTestSuite) TestDownload(c *check.C) {
-	cm, _ := NewManager(config.NewConfig(), nil, nil, httpclient.NewOriginClient())
+	cm, _ := NewManager(config.NewConfig(), nil, nil, httpclient.NewOriginClient(), prometheus.NewRegistry())
 	bytes := []byte("hello world")
 	bytesLength := int64(len(bytes))
 
@@ -67,6 +71,7 @@ func (s *CDNDownloadTestSuite) TestDownload(c *check.C) {
 			return
 		}
 
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeStruct[0].StartIndex, rangeStruct[0].EndIndex, bytesLength))
 		w.WriteHeader(http.StatusPartialContent)
 		fmt.Fprint(w, string(bytes[rangeStruct[0].StartIndex:rangeStruct[0].EndIndex+1]))
 	}))
@@ -103,7 +108,7 @@ func (s *CDNDownloadTestSuite) TestDownload(c *check.C) {
 	}
 
 	for _, v := range cases {
-		resp, err := cm.download(context.TODO(), "", ts.URL, v.headers, v.startPieceNum, v.httpFileLength, v.pieceContSize)
+		resp, err := cm.download(context.TODO(), "", ts.URL, v.headers, v.startPieceNum, v.httpFileLength, v.pieceContSize, "")
 		c.Check(v.errCheck(err), check.Equals, true)
 
 		c.Check(resp.StatusCode, check.Equals, v.exceptedStatusCode)
@@ -113,3 +118,118 @@ func (s *CDNDownloadTestSuite) TestDownload(c *check.C) {
 		c.Check(string(result), check.Equals, string(v.exceptedBody))
 	}
 }
+
+func (s *CDNDownloadTestSuite) TestDownloadWithContentRange(c *check.C) {
+	cm, _ := NewManager(config.NewConfig(), nil, nil, httpclient.NewOriginClient(), prometheus.NewRegistry())
+	var contentRange string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentRange != "" {
+			w.Header().Set("Content-Range", contentRange)
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		fmt.Fprint(w, "world")
+	}))
+	defer ts.Close()
+
+	var cases = []struct {
+		contentRange string
+		errCheck     func(error) bool
+	}{
+		// the range continues the downloaded pieces
+		{contentRange: "bytes 6-10/11", errCheck: errortypes.IsNilError},
+		// the source responds another range
+		{contentRange: "bytes 0-10/11", errCheck: errortypes.IsContentRangeMismatch},
+		// the source file has been changed
+		{contentRange: "bytes 6-12/13", errCheck: errortypes.IsContentRangeMismatch},
+		{contentRange: "bytes 6-10/*", errCheck: errortypes.IsContentRangeMismatch},
+		{contentRange: "", errCheck: errortypes.IsContentRangeMismatch},
+	}
+
+	for _, v := range cases {
+		contentRange = v.contentRange
+		resp, err := cm.download(context.TODO(), "", ts.URL, nil, 2, 11, 3, "")
+		c.Check(v.errCheck(errors.Cause(err)), check.Equals, true, check.Commentf("%q: %v", v.contentRange, err))
+		if err == nil {
+			result, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			c.Check(string(result), check.Equals, "world")
+		}
+	}
+}
+
+func (s *CDNDownloadTestSuite) TestDownloadWithIfRange(c *check.C) {
+	cm, _ := NewManager(config.NewConfig(), nil, nil, httpclient.NewOriginClient(), prometheus.NewRegistry())
+	var ifRanges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "file", time.Unix(1500000000, 0), strings.NewReader("hello world"))
+	}))
+	defer ts.Close()
+
+	// the source file is not changed
+	resp, err := cm.download(context.TODO(), "", ts.URL, nil, 2, 11, 3, `"v2"`)
+	c.Assert(err, check.IsNil)
+	result, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusPartialContent)
+	c.Check(string(result), check.Equals, "world")
+
+	// the source file has been changed, so the whole file is responded
+	_, err = cm.download(context.TODO(), "", ts.URL, nil, 2, 11, 3, `"v1"`)
+	c.Check(errortypes.IsContentRangeMismatch(errors.Cause(err)), check.Equals, true, check.Commentf("%v", err))
+
+	// the If-Range is only sent to resume the download
+	resp, err = cm.download(context.TODO(), "", ts.URL, map[string]string{"If-Range": `"v1"`}, 0, 11, 3, `"v1"`)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(ifRanges, check.DeepEquals, []string{`"v2"`, `"v1"`, ""})
+}
+
+func (s *CDNDownloadTestSuite) TestGetIfRange(c *check.C) {
+	var cases = []struct {
+		metaData *fileMetaData
+		expected string
+	}{
+		{metaData: nil, expected: ""},
+		{metaData: &fileMetaData{}, expected: ""},
+		{metaData: &fileMetaData{ETag: `"foo"`, LastModified: 1500000000000}, expected: `"foo"`},
+		{metaData: &fileMetaData{ETag: `W/"foo"`, WeakETag: true}, expected: ""},
+		{metaData: &fileMetaData{ETag: `W/"foo"`, WeakETag: true, LastModified: 1500000000000},
+			expected: "Fri, 14 Jul 2017 02:40:00 GMT"},
+		// the weak ETag recorded by the older versions
+		{metaData: &fileMetaData{ETag: `W/"foo"`}, expected: ""},
+		{metaData: &fileMetaData{LastModified: 1500000000000}, expected: "Fri, 14 Jul 2017 02:40:00 GMT"},
+	}
+
+	for _, v := range cases {
+		c.Check(getIfRange(v.metaData), check.Equals, v.expected, check.Commentf("%+v", v.metaData))
+	}
+}
+
+func (s *CDNDownloadTestSuite) TestParseContentRange(c *check.C) {
+	var cases = []struct {
+		contentRange string
+		expected     []int64
+		hasErr       bool
+	}{
+		{contentRange: "bytes 0-0/1", expected: []int64{0, 0, 1}},
+		{contentRange: "bytes 6-10/11", expected: []int64{6, 10, 11}},
+		{contentRange: "bytes */11", hasErr: true},
+		{contentRange: "bytes 6-10/*", hasErr: true},
+		{contentRange: "bytes 10-6/11", hasErr: true},
+		{contentRange: "bytes 6-11/11", hasErr: true},
+		{contentRange: "6-10/11", hasErr: true},
+		{contentRange: "", hasErr: true},
+	}
+
+	for _, v := range cases {
+		start, end, total, err := parseContentRange(v.contentRange)
+		if v.hasErr {
+			c.Check(err, check.NotNil, check.Commentf(v.contentRange))
+			continue
+		}
+		c.Check(err, check.IsNil, check.Commentf(v.contentRange))
+		c.Check([]int64{start, end, total}, check.DeepEquals, v.expected)
+	}
+}
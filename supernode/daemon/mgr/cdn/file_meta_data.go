@@ -23,6 +23,7 @@ import (
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
@@ -47,6 +48,35 @@ type fileMetaData struct {
 	ETag         string `json:"eTag"`
 	Finish       bool   `json:"finish"`
 	Success      bool   `json:"success"`
+
+	// WeakETag indicates the ETag is a weak validator, which can revalidate
+	// the whole file but not the range to resume the download.
+	WeakETag bool `json:"weakETag,omitempty"`
+
+	// ContentEncoding is the content encoding of the source file
+	// which has been decoded to store the content in the identity form.
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	// OriginalMd5 is the md5 of the source file before being decoded.
+	OriginalMd5 string `json:"originalMd5,omitempty"`
+
+	// Digest is the digest of the content computed with the DigestAlgorithm,
+	// which is only recorded if the algorithm is not md5 since the RealMd5 is the md5 digest.
+	Digest          string `json:"digest,omitempty"`
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+
+	// CacheControl and Expires are the cache directives of the source file,
+	// which are responded by the source at ResponseTime in milliseconds.
+	CacheControl string `json:"cacheControl,omitempty"`
+	Expires      string `json:"expires,omitempty"`
+	ResponseTime int64  `json:"responseTime,omitempty"`
+
+	// OriginMetadata contains the values of the OriginMetadataHeaders
+	// responded by the source keyed by their canonical names.
+	OriginMetadata map[string]string `json:"originMetadata,omitempty"`
+
+	// InterruptedTime is the time in milliseconds when the download of the file failed halfway,
+	// and the pieces committed before are kept to be resumed within the PartialDownloadTTL.
+	InterruptedTime int64 `json:"interruptedTime,omitempty"`
 }
 
 // fileMetaDataManager manages the meta file and md5 file of each taskID.
@@ -143,6 +173,80 @@ func (mm *fileMetaDataManager) updateLastModifiedAndETag(ctx context.Context, ta
 
 	originMetaData.LastModified = lastModified
 	originMetaData.ETag = eTag
+	originMetaData.WeakETag = netutils.IsWeakETag(eTag)
+
+	return mm.writeFileMetaData(ctx, originMetaData)
+}
+
+func (mm *fileMetaDataManager) updateCacheDirectives(ctx context.Context, taskID, cacheControl, expires string, responseTime int64) error {
+	mm.locker.GetLock(taskID, false)
+	defer mm.locker.ReleaseLock(taskID, false)
+
+	originMetaData, err := mm.readFileMetaData(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	originMetaData.CacheControl = cacheControl
+	originMetaData.Expires = expires
+	originMetaData.ResponseTime = responseTime
+
+	return mm.writeFileMetaData(ctx, originMetaData)
+}
+
+func (mm *fileMetaDataManager) updateOriginMetadata(ctx context.Context, taskID string, originMetadata map[string]string) error {
+	mm.locker.GetLock(taskID, false)
+	defer mm.locker.ReleaseLock(taskID, false)
+
+	originMetaData, err := mm.readFileMetaData(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	originMetaData.OriginMetadata = originMetadata
+
+	return mm.writeFileMetaData(ctx, originMetaData)
+}
+
+func (mm *fileMetaDataManager) updateContentEncoding(ctx context.Context, taskID, contentEncoding string) error {
+	mm.locker.GetLock(taskID, false)
+	defer mm.locker.ReleaseLock(taskID, false)
+
+	originMetaData, err := mm.readFileMetaData(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	originMetaData.ContentEncoding = contentEncoding
+
+	return mm.writeFileMetaData(ctx, originMetaData)
+}
+
+func (mm *fileMetaDataManager) updateDigest(ctx context.Context, taskID, algorithm, digest string) error {
+	mm.locker.GetLock(taskID, false)
+	defer mm.locker.ReleaseLock(taskID, false)
+
+	originMetaData, err := mm.readFileMetaData(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	originMetaData.Digest = digest
+	originMetaData.DigestAlgorithm = algorithm
+
+	return mm.writeFileMetaData(ctx, originMetaData)
+}
+
+func (mm *fileMetaDataManager) updateInterruptedTime(ctx context.Context, taskID string, interruptedTime int64) error {
+	mm.locker.GetLock(taskID, false)
+	defer mm.locker.ReleaseLock(taskID, false)
+
+	originMetaData, err := mm.readFileMetaData(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	originMetaData.InterruptedTime = interruptedTime
 
 	return mm.writeFileMetaData(ctx, originMetaData)
 }
@@ -163,6 +267,9 @@ func (mm *fileMetaDataManager) updateStatusAndResult(ctx context.Context, taskID
 		if !stringutils.IsEmptyStr(metaData.RealMd5) {
 			originMetaData.RealMd5 = metaData.RealMd5
 		}
+		if !stringutils.IsEmptyStr(metaData.OriginalMd5) {
+			originMetaData.OriginalMd5 = metaData.OriginalMd5
+		}
 	}
 
 	return mm.writeFileMetaData(ctx, originMetaData)
@@ -0,0 +1,81 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cdnFixture is shared by the suites of the CDN, which is embedded into them.
+// It stores the files in a temporary work home, and the managers created by it
+// report the progress of the downloads to the mock ProgressMgr.
+type cdnFixture struct {
+	workHome   string
+	cacheStore *store.Store
+}
+
+// setUpFixture creates the cache store in a temporary work home named after the suite.
+func (f *cdnFixture) setUpFixture(c *check.C, suite string) {
+	workHome, err := ioutil.TempDir("/tmp", "supernode-cdn-"+suite+"-")
+	c.Assert(err, check.IsNil)
+	f.workHome = workHome
+	f.cacheStore, err = store.NewStore(store.LocalStorageDriver, store.NewLocalStorage, "baseDir: "+workHome)
+	c.Assert(err, check.IsNil)
+}
+
+// tearDownFixture removes the work home.
+func (f *cdnFixture) tearDownFixture(c *check.C) {
+	if f.workHome != "" {
+		c.Check(os.RemoveAll(f.workHome), check.IsNil)
+	}
+}
+
+// newProgressMgr returns the mock ProgressMgr accepting the pieces and the cache results
+// reported by the CDN. The mock is controlled by the c of the test so that the unexpected
+// calls fail the test rather than the suite.
+func (f *cdnFixture) newProgressMgr(c *check.C) *mock.MockProgressMgr {
+	mockProgressMgr := mock.NewMockProgressMgr(gomock.NewController(c))
+	mockProgressMgr.EXPECT().UpdateSuperPieceMD5(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockProgressMgr.EXPECT().UpdateProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+		gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockProgressMgr.EXPECT().RecordCacheResult(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	return mockProgressMgr
+}
+
+// newManager creates the manager with cfg which stores the files in the cache store.
+func (f *cdnFixture) newManager(c *check.C, cfg *config.Config) *Manager {
+	cm, err := NewManager(cfg, f.cacheStore, f.newProgressMgr(c), httpclient.NewOriginClient(), prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	return cm
+}
+
+// trigger triggers the CDN of the task with a new manager with cfg.
+func (f *cdnFixture) trigger(c *check.C, cfg *config.Config, task *types.TaskInfo) (*types.TaskInfo, error) {
+	return f.newManager(c, cfg).TriggerCDN(context.TODO(), task)
+}
@@ -19,19 +19,27 @@ package cdn
 import (
 	"context"
 	"crypto/md5"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
 	"path"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/limitreader"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/ratelimiter"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	"github.com/dragonflyoss/Dragonfly/supernode/store"
 	"github.com/dragonflyoss/Dragonfly/supernode/util"
 
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
@@ -51,10 +59,18 @@ type Manager struct {
 	originClient    httpclient.OriginHTTPClient
 	pieceMD5Manager *pieceMD5Mgr
 	writer          *superWriter
+	originLimiter   *originLimiter
+	// cancels contains the functions to cancel the CDN downloads in progress.
+	// key:taskID,value:context.CancelFunc
+	cancels *syncmap.SyncMap
+	// pauses contains the tasks whose CDN downloads are aborted by Pause.
+	// key:taskID,value:bool
+	pauses *syncmap.SyncMap
 }
 
 // NewManager returns a new Manager.
-func NewManager(cfg *config.Config, cacheStore *store.Store, progressManager mgr.ProgressMgr, originClient httpclient.OriginHTTPClient) (*Manager, error) {
+func NewManager(cfg *config.Config, cacheStore *store.Store, progressManager mgr.ProgressMgr,
+	originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (*Manager, error) {
 	rateLimiter := ratelimiter.NewRateLimiter(ratelimiter.TransRate(config.TransLimit(cfg.MaxBandwidth-cfg.SystemReservedBandwidth)), 2)
 	metaDataManager := newFileMetaDataManager(cacheStore)
 	pieceMD5Manager := newpieceMD5Mgr()
@@ -68,33 +84,62 @@ func NewManager(cfg *config.Config, cacheStore *store.Store, progressManager mgr
 		metaDataManager: metaDataManager,
 		pieceMD5Manager: pieceMD5Manager,
 		cdnReporter:     cdnReporter,
-		detector:        newCacheDetector(cacheStore, metaDataManager, originClient),
+		detector:        newCacheDetector(cfg, cacheStore, metaDataManager, originClient),
 		originClient:    originClient,
-		writer:          newSuperWriter(cacheStore, cdnReporter),
+		writer:          newSuperWriter(cacheStore, cdnReporter, newPieceBufferBudget(cfg, register)),
+		originLimiter:   newOriginLimiter(cfg, register),
+		cancels:         syncmap.NewSyncMap(),
+		pauses:          syncmap.NewSyncMap(),
 	}, nil
 }
 
 // TriggerCDN will trigger CDN to download the file from sourceUrl.
 func (cm *Manager) TriggerCDN(ctx context.Context, task *types.TaskInfo) (*types.TaskInfo, error) {
+	cm.cdnLocker.GetLock(task.ID, false)
+	defer cm.cdnLocker.ReleaseLock(task.ID, false)
+
+	updateTaskInfo, err := cm.triggerCDN(ctx, task)
+	// the download aborted by Pause leaves the meta data unfinished to be resumed.
+	if cm.takePause(task.ID) && errortypes.IsTaskCanceled(errors.Cause(err)) {
+		return nil, errors.Wrapf(errortypes.ErrTaskPaused, "taskID: %s", task.ID)
+	}
+	return updateTaskInfo, err
+}
+
+func (cm *Manager) triggerCDN(ctx context.Context, task *types.TaskInfo) (*types.TaskInfo, error) {
 	httpFileLength := task.HTTPFileLength
 	if httpFileLength == 0 {
 		httpFileLength = -1
 	}
 
-	cm.cdnLocker.GetLock(task.ID, false)
-	defer cm.cdnLocker.ReleaseLock(task.ID, false)
+	// the cookies of the task are discarded when the CDN finishes
+	defer httpclient.ReleaseTask(cm.originClient, task.ID)
+
+	// the download can be canceled until the CDN of the task finishes
+	cancelCtx, cancel := cm.startCancelable(task.ID)
+	defer cancel()
+
 	// detect Cache
-	startPieceNum, metaData, err := cm.detector.detectCache(ctx, task)
+	startPieceNum, metaData, revalidated, err := cm.detector.detectCache(ctx, task)
 	if err != nil {
 		logrus.Errorf("failed to detect cache for task %s: %v", task.ID, err)
+		if errortypes.IsCacheMissing(err) || errortypes.IsPieceSizeMismatch(err) {
+			return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
+		}
 	}
 	fileMD5, updateTaskInfo, err := cm.cdnReporter.reportCache(ctx, task.ID, metaData, startPieceNum)
 	if err != nil {
 		logrus.Errorf("failed to report cache for taskId: %s : %v", task.ID, err)
 	}
+	cm.recordCacheResult(ctx, task.ID, startPieceNum, revalidated)
 
 	if startPieceNum == -1 {
 		logrus.Infof("cache full hit for taskId:%s on local", task.ID)
+		if updateTaskInfo != nil && metaData != nil {
+			updateTaskInfo.OriginalMd5 = metaData.OriginalMd5
+			updateTaskInfo.OriginMetadata = metaData.OriginMetadata
+			cm.setCachedDigest(ctx, task, metaData, updateTaskInfo)
+		}
 		return updateTaskInfo, nil
 	}
 
@@ -105,28 +150,126 @@ func (cm *Manager) TriggerCDN(ctx context.Context, task *types.TaskInfo) (*types
 	// get piece content size which not including the piece header and trailer
 	pieceContSize := task.PieceSize - config.PieceWrapSize
 
+	// compute the digest with the algorithm of the task while downloading
+	contentDigest, err := cm.newContentDigest(ctx, task, startPieceNum, pieceContSize)
+	if err != nil {
+		logrus.Errorf("failed to init the digest of the content for task %s: %v", task.ID, err)
+		return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
+	}
+
+	// wait for the concurrency limits of the source.
+	// The ctx of the request which triggers CDN may be canceled before the download starts,
+	// so it's not used to wait.
+	release, err := cm.originLimiter.acquire(cancelCtx, task.ID, task.RawURL)
+	if err != nil {
+		if cancelCtx.Err() != nil {
+			err = errors.Wrapf(errortypes.ErrTaskCanceled, "taskID: %s", task.ID)
+		}
+		return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
+	}
+	defer release()
+
 	// start to download the source file
-	resp, err := cm.download(ctx, task.ID, task.RawURL, task.Headers, startPieceNum, httpFileLength, pieceContSize)
+	resp, err := cm.download(ctx, task.ID, task.RawURL, task.Headers, startPieceNum, httpFileLength, pieceContSize, getIfRange(metaData))
 	if err != nil {
+		// the pieces downloaded before can't be resumed if the source has changed,
+		// so the file will be downloaded from the beginning next time.
+		if errortypes.IsContentRangeMismatch(errors.Cause(err)) {
+			logrus.Errorf("failed to resume the download for task %s: %v", task.ID, err)
+			if err := cm.metaDataManager.updateStatusAndResult(ctx, task.ID, &fileMetaData{
+				Finish:  true,
+				Success: false,
+			}); err != nil {
+				logrus.Errorf("failed to update the meta data of task %s: %v", task.ID, err)
+			}
+		} else {
+			cm.handlePartialDownload(ctx, task, err)
+		}
 		return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
 	}
-	defer resp.Body.Close()
+	respBody := newCancelableReader(cancelCtx, task.ID, cm.newTaskAgeReader(task, resp.Body))
+	defer respBody.Close()
 
 	cm.updateLastModifiedAndETag(ctx, task.ID, resp.Header.Get("Last-Modified"), resp.Header.Get("Etag"))
-	reader := limitreader.NewLimitReaderWithLimiterAndMD5Sum(resp.Body, cm.limiter, fileMD5)
+	cm.updateCacheDirectives(ctx, task.ID, resp.Header.Get("Cache-Control"), resp.Header.Get("Expires"))
+	originMetadata := cm.captureOriginMetadata(resp.Header)
+	cm.updateOriginMetadata(ctx, task.ID, originMetadata)
+
+	// decode the content to store it in the identity form if necessary
+	var body io.Reader = cm.newContentLengthReader(task.ID, respBody, resp.ContentLength)
+	var originalMD5 hash.Hash
+	if contentEncoding := cm.getNormalizedEncoding(resp.Header, startPieceNum); contentEncoding != "" {
+		if body, originalMD5, err = cm.normalize(ctx, task.ID, body, contentEncoding); err != nil {
+			logrus.Errorf("failed to normalize the content encoding %s for task %s: %v", contentEncoding, task.ID, err)
+			return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
+		}
+		// the length of the decoded content is unknown until it's downloaded completely.
+		httpFileLength = -1
+	}
+
+	if contentDigest != nil {
+		body = io.TeeReader(body, contentDigest)
+	}
+	reader := limitreader.NewLimitReaderWithLimiterAndMD5Sum(body, cm.limiter, fileMD5)
 	downloadMetadata, err := cm.writer.startWriter(ctx, cm.cfg, reader, task, startPieceNum, httpFileLength, pieceContSize)
 	if err != nil {
 		logrus.Errorf("failed to write for task %s: %v", task.ID, err)
+		// the download aborted by the cancellation is always kept to be resumed.
+		if errortypes.IsTaskCanceled(errors.Cause(err)) {
+			return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
+		}
+		// the truncated content can't be resumed since the source may have changed,
+		// so the file will be downloaded from the beginning next time.
+		if errortypes.IsContentLengthMismatch(errors.Cause(err)) {
+			if err := cm.metaDataManager.updateStatusAndResult(ctx, task.ID, &fileMetaData{
+				Finish:  true,
+				Success: false,
+			}); err != nil {
+				logrus.Errorf("failed to update the meta data of task %s: %v", task.ID, err)
+			}
+			return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
+		}
+		cm.handlePartialDownload(ctx, task, err)
+		if errortypes.IsTaskExpired(errors.Cause(err)) {
+			return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
+		}
 		return nil, err
 	}
 
 	realMD5 := reader.Md5()
-	success, err := cm.handleCDNResult(ctx, task, realMD5, httpFileLength, downloadMetadata.realHTTPFileLength, downloadMetadata.realFileLength)
+	var originalMD5Value string
+	if originalMD5 != nil {
+		originalMD5Value = fmt.Sprintf("%x", originalMD5.Sum(nil))
+	}
+	success, err := cm.handleCDNResult(ctx, task, realMD5, originalMD5Value, httpFileLength, downloadMetadata.realHTTPFileLength, downloadMetadata.realFileLength)
 	if err != nil || success == false {
 		return getUpdateTaskInfoWithStatusOnly(types.TaskInfoCdnStatusFAILED), err
 	}
 
-	return getUpdateTaskInfo(types.TaskInfoCdnStatusSUCCESS, realMD5, downloadMetadata.realFileLength), nil
+	updateTaskInfo = getUpdateTaskInfo(types.TaskInfoCdnStatusSUCCESS, realMD5, downloadMetadata.realFileLength)
+	updateTaskInfo.OriginalMd5 = originalMD5Value
+	updateTaskInfo.OriginMetadata = originMetadata
+	cm.setContentDigest(ctx, task, updateTaskInfo, contentDigest)
+	if httpFileLength >= 0 && httpFileLength != downloadMetadata.realHTTPFileLength {
+		// the mismatch is tolerated, so trust the bytes actually received.
+		updateTaskInfo.HTTPFileLength = downloadMetadata.realHTTPFileLength
+	}
+	return updateTaskInfo, nil
+}
+
+// recordCacheResult records whether the task is served from the cache
+// as per the startPieceNum detected, or downloaded from the source.
+func (cm *Manager) recordCacheResult(ctx context.Context, taskID string, startPieceNum int, revalidated bool) {
+	result := mgr.CacheMiss
+	if startPieceNum == -1 {
+		result = mgr.CacheHit
+		if revalidated {
+			result = mgr.CacheRevalidationHit
+		}
+	}
+	if err := cm.progressManager.RecordCacheResult(ctx, taskID, result); err != nil {
+		logrus.Warnf("failed to record the cache result %s for taskID %s: %v", result, taskID, err)
+	}
 }
 
 // GetHTTPPath returns the http download path of taskID.
@@ -136,41 +279,136 @@ func (cm *Manager) GetHTTPPath(ctx context.Context, taskID string) (string, erro
 	return path.Join("/", raw.Bucket, raw.Key), nil
 }
 
-// GetStatus get the status of the file.
+// OpenFile opens the downloaded file of taskID for reading at random offsets.
+// The pieces are verified against the recorded piece md5s when they're read if VerifyOnRead is enabled.
+func (cm *Manager) OpenFile(ctx context.Context, taskID string) (store.File, error) {
+	if cm.cfg != nil && cm.cfg.BaseProperties != nil && cm.cfg.VerifyOnRead {
+		return cm.openVerifiedFile(ctx, taskID)
+	}
+	return cm.cacheStore.Open(ctx, getDownloadRawFunc(taskID))
+}
+
+// GetPieceSize returns the piece size recorded in the meta data of the task,
+// or 0 if the same file of the task has never been downloaded.
+func (cm *Manager) GetPieceSize(ctx context.Context, task *types.TaskInfo) (int32, error) {
+	metaData, err := cm.metaDataManager.readFileMetaData(ctx, task.ID)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if !checkSameSource(task, metaData) {
+		return 0, nil
+	}
+	return metaData.PieceSize, nil
+}
+
+// GetOriginConcurrency returns the global limit of the downloads from the sources
+// and the number of the downloads holding it.
+func (cm *Manager) GetOriginConcurrency(ctx context.Context) (limit, inFlight int) {
+	return cm.originLimiter.getGlobalLimit()
+}
+
+// GetOriginQueueDepth returns the number of the downloads waiting for the concurrency limits of the sources.
+func (cm *Manager) GetOriginQueueDepth(ctx context.Context) int {
+	return cm.originLimiter.getWaiting()
+}
+
+// SetOriginConcurrency changes the global limit of the downloads from the sources at runtime.
+func (cm *Manager) SetOriginConcurrency(ctx context.Context, limit int) {
+	cm.originLimiter.setGlobalLimit(limit)
+	logrus.Infof("success to set the origin concurrency limit to %d", limit)
+}
+
+// GetStorageDriver returns the name of the storage driver of the cache store.
+func (cm *Manager) GetStorageDriver(ctx context.Context) string {
+	return cm.cacheStore.Name()
+}
+
+// GetStatus gets the status of the file according to its meta data.
 func (cm *Manager) GetStatus(ctx context.Context, taskID string) (cdnStatus string, err error) {
-	return "", nil
+	metaData, err := cm.metaDataManager.readFileMetaData(ctx, taskID)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return "", errors.Wrapf(errortypes.ErrDataNotFound, "meta data of taskID: %s", taskID)
+		}
+		return "", err
+	}
+
+	if !metaData.Finish {
+		return types.TaskInfoCdnStatusRUNNING, nil
+	}
+	if !metaData.Success {
+		return types.TaskInfoCdnStatusFAILED, nil
+	}
+	return types.TaskInfoCdnStatusSUCCESS, nil
 }
 
 // Delete the file from disk with specified taskID.
+// It will wait for the running CDN download of the task to finish.
 func (cm *Manager) Delete(ctx context.Context, taskID string) error {
+	cm.cdnLocker.GetLock(taskID, false)
+	defer cm.cdnLocker.ReleaseLock(taskID, false)
+
+	if err := deleteTaskFiles(ctx, cm.cacheStore, taskID, true); err != nil {
+		return err
+	}
+	cm.pieceMD5Manager.removePieceMD5sByTaskID(taskID)
 	return nil
 }
 
-func (cm *Manager) handleCDNResult(ctx context.Context, task *types.TaskInfo, realMd5 string, httpFileLength, realHTTPFileLength, realFileLength int64) (bool, error) {
+// Revalidate revalidates the file of the task with the source by the conditional request
+// with the validators recorded when it was downloaded, regardless of its freshness.
+// It will wait for the running CDN download of the task to finish.
+func (cm *Manager) Revalidate(ctx context.Context, task *types.TaskInfo) (bool, error) {
+	cm.cdnLocker.GetLock(task.ID, true)
+	defer cm.cdnLocker.ReleaseLock(task.ID, true)
+
+	// the cookies of the task are discarded when the revalidation finishes
+	defer httpclient.ReleaseTask(cm.originClient, task.ID)
+	return cm.detector.revalidate(ctx, task)
+}
+
+// handleCDNResult validates the downloaded file and updates the result to the meta data.
+// The originalMd5 is the md5 of the content before being normalized, which is empty
+// if the content is stored as it is. The expected md5 can match either of them.
+func (cm *Manager) handleCDNResult(ctx context.Context, task *types.TaskInfo, realMd5, originalMd5 string, httpFileLength, realHTTPFileLength, realFileLength int64) (bool, error) {
 	var isSuccess = true
-	if !stringutils.IsEmptyStr(task.Md5) && task.Md5 != realMd5 {
-		logrus.Errorf("taskId:%s url:%s file md5 not match expected:%s real:%s", task.ID, task.TaskURL, task.Md5, realMd5)
+	var resultErr error
+	if !stringutils.IsEmptyStr(task.Md5) && task.Md5 != realMd5 &&
+		(stringutils.IsEmptyStr(originalMd5) || task.Md5 != originalMd5) {
+		logrus.Errorf("taskId:%s url:%s file md5 not match expected:%s real:%s original:%s", task.ID, task.TaskURL, task.Md5, realMd5, originalMd5)
+		resultErr = errors.Wrapf(errortypes.ErrMd5Mismatch, "expected: %s real: %s", task.Md5, realMd5)
 		isSuccess = false
 	}
 	if isSuccess && httpFileLength >= 0 && httpFileLength != realHTTPFileLength {
-		logrus.Errorf("taskId:%s url:%s file length not match expected:%d real:%d", task.ID, task.TaskURL, httpFileLength, realHTTPFileLength)
-		isSuccess = false
+		if cm.tolerateContentLengthMismatch() {
+			logrus.Warnf("taskId:%s url:%s file length not match expected:%d real:%d, trust the real length",
+				task.ID, task.TaskURL, httpFileLength, realHTTPFileLength)
+		} else {
+			logrus.Errorf("taskId:%s url:%s file length not match expected:%d real:%d", task.ID, task.TaskURL, httpFileLength, realHTTPFileLength)
+			resultErr = errors.Wrapf(errortypes.ErrContentLengthMismatch, "expected: %d real: %d", httpFileLength, realHTTPFileLength)
+			isSuccess = false
+		}
 	}
 
 	if !isSuccess {
 		realFileLength = 0
 	}
 	if err := cm.metaDataManager.updateStatusAndResult(ctx, task.ID, &fileMetaData{
-		Finish:     true,
-		Success:    isSuccess,
-		RealMd5:    realMd5,
-		FileLength: realFileLength,
+		Finish:      true,
+		Success:     isSuccess,
+		RealMd5:     realMd5,
+		OriginalMd5: originalMd5,
+		FileLength:  realFileLength,
 	}); err != nil {
 		return false, err
 	}
 
 	if !isSuccess {
-		return false, nil
+		return false, resultErr
 	}
 
 	logrus.Infof("success to get taskID: %s fileLength: %d realMd5: %s", task.ID, realFileLength, realMd5)
@@ -193,3 +431,32 @@ func (cm *Manager) updateLastModifiedAndETag(ctx context.Context, taskID, lastMo
 	}
 	logrus.Infof("success to update LastModified(%s) and ETag(%s) for taskID: %s", lastModified, eTag, taskID)
 }
+
+func (cm *Manager) updateCacheDirectives(ctx context.Context, taskID, cacheControl, expires string) {
+	if err := cm.metaDataManager.updateCacheDirectives(ctx, taskID, cacheControl, expires, getCurrentTimeMillisFunc()); err != nil {
+		logrus.Errorf("failed to update Cache-Control(%s) and Expires(%s) for taskID %s: %v", cacheControl, expires, taskID, err)
+	}
+}
+
+func (cm *Manager) updateOriginMetadata(ctx context.Context, taskID string, originMetadata map[string]string) {
+	if err := cm.metaDataManager.updateOriginMetadata(ctx, taskID, originMetadata); err != nil {
+		logrus.Errorf("failed to update the origin metadata %v for taskID %s: %v", originMetadata, taskID, err)
+	}
+}
+
+// captureOriginMetadata returns the values of the OriginMetadataHeaders in the header responded
+// by the source keyed by their canonical names, or nil if none of them is responded.
+func (cm *Manager) captureOriginMetadata(header http.Header) map[string]string {
+	var originMetadata map[string]string
+	for _, name := range cm.cfg.OriginMetadataHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if originMetadata == nil {
+			originMetadata = make(map[string]string)
+		}
+		originMetadata[http.CanonicalHeaderKey(name)] = value
+	}
+	return originMetadata
+}
@@ -0,0 +1,340 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// originLimiter limits the number of files downloaded from the sources at the same time,
+// both in total and for each host of the sources.
+//
+// A download waits for the slot of its host before taking a global slot,
+// so the downloads from a saturated host never hold the global slots
+// which the downloads from the other hosts are waiting for.
+// And the number of the distinct tasks downloaded from a host is limited
+// before that, where the downloads of the same task share one slot.
+type originLimiter struct {
+	// global is the global limit which can be resized at runtime.
+	global           *resizableSlots
+	defaultHostLimit int
+	hostLimits       map[string]int
+	hostTaskLimit    int
+
+	mu sync.Mutex
+	// hosts contains the slots of the hosts which have been downloaded from.
+	// key:host,value:the slots of the host or nil if the host is unlimited
+	hosts map[string]chan struct{}
+	// hostTasks contains the tasks downloaded from the hosts if the hostTaskLimit is enabled.
+	// key:host,value:*hostTasks
+	hostTasks map[string]*hostTasks
+
+	// waiting is the number of the downloads waiting for the slots,
+	// which should be accessed atomically.
+	waiting int32
+
+	queueDepth     *prometheus.GaugeVec
+	taskQueueDepth *prometheus.GaugeVec
+	globalLimit    *prometheus.GaugeVec
+	globalInFlight *prometheus.GaugeVec
+}
+
+// hostTasks maintains the distinct tasks downloaded from a host,
+// and it's protected by the lock of the originLimiter.
+type hostTasks struct {
+	slots chan struct{}
+	// running contains the number of the downloads of the tasks holding the slots.
+	// key:taskID,value:the number of the downloads
+	running map[string]int
+}
+
+func newOriginLimiter(cfg *config.Config, register prometheus.Registerer) *originLimiter {
+	ol := &originLimiter{
+		hosts:     make(map[string]chan struct{}),
+		hostTasks: make(map[string]*hostTasks),
+		queueDepth: metricsutils.NewGauge(config.SubsystemSupernode, "origin_host_queue_depth",
+			"Current number of downloads waiting for the concurrency limit of the source host", []string{"host"}, register),
+		taskQueueDepth: metricsutils.NewGauge(config.SubsystemSupernode, "origin_host_task_queue_depth",
+			"Current number of tasks waiting for the distinct task limit of the source host", []string{"host"}, register),
+		globalLimit: metricsutils.NewGauge(config.SubsystemSupernode, "origin_concurrency_limit",
+			"Current max number of files downloaded from all the sources at the same time, 0 if unlimited", []string{}, register),
+		globalInFlight: metricsutils.NewGauge(config.SubsystemSupernode, "origin_concurrency_in_flight",
+			"Current number of files being downloaded from all the sources", []string{}, register),
+	}
+	ol.global = newResizableSlots(0, func(limit, inFlight int) {
+		ol.globalLimit.WithLabelValues().Set(float64(limit))
+		ol.globalInFlight.WithLabelValues().Set(float64(inFlight))
+	})
+	if cfg == nil || cfg.BaseProperties == nil {
+		return ol
+	}
+
+	ol.global.resize(cfg.OriginConcurrencyLimit)
+	ol.defaultHostLimit = cfg.OriginHostConcurrencyLimit
+	ol.hostLimits = cfg.OriginHostConcurrencyLimits
+	ol.hostTaskLimit = cfg.OriginHostTaskLimit
+	return ol
+}
+
+// acquire blocks until the download of taskID from rawURL is allowed or ctx is done,
+// and returns the function to release the slots taken by the download.
+func (ol *originLimiter) acquire(ctx context.Context, taskID, rawURL string) (func(), error) {
+	atomic.AddInt32(&ol.waiting, 1)
+	defer atomic.AddInt32(&ol.waiting, -1)
+
+	host := getOriginHost(rawURL)
+	releaseTask, err := ol.acquireTask(ctx, host, taskID)
+	if err != nil {
+		return nil, err
+	}
+	hostSlots := ol.getHostSlots(host)
+
+	if hostSlots != nil {
+		select {
+		case hostSlots <- struct{}{}:
+		default:
+			ol.queueDepth.WithLabelValues(host).Inc()
+			err := takeSlot(ctx, hostSlots)
+			ol.queueDepth.WithLabelValues(host).Dec()
+			if err != nil {
+				releaseTask()
+				return nil, err
+			}
+		}
+	}
+
+	if err := ol.global.take(ctx); err != nil {
+		releaseSlot(hostSlots)
+		releaseTask()
+		return nil, err
+	}
+
+	return func() {
+		ol.global.release()
+		releaseSlot(hostSlots)
+		releaseTask()
+	}, nil
+}
+
+// getWaiting returns the number of the downloads waiting for the slots.
+func (ol *originLimiter) getWaiting() int {
+	return int(atomic.LoadInt32(&ol.waiting))
+}
+
+// acquireTask blocks until taskID is allowed to be downloaded from the host
+// by the distinct task limit or ctx is done, and returns the function to release it.
+// The task which is being downloaded from the host already is allowed immediately.
+func (ol *originLimiter) acquireTask(ctx context.Context, host, taskID string) (func(), error) {
+	if ol.hostTaskLimit <= 0 {
+		return func() {}, nil
+	}
+
+	ol.mu.Lock()
+	ht, ok := ol.hostTasks[host]
+	if !ok {
+		ht = &hostTasks{
+			slots:   make(chan struct{}, ol.hostTaskLimit),
+			running: make(map[string]int),
+		}
+		ol.hostTasks[host] = ht
+	}
+	running := ht.running[taskID] > 0
+	if running {
+		ht.running[taskID]++
+	}
+	ol.mu.Unlock()
+
+	release := func() {
+		ol.mu.Lock()
+		defer ol.mu.Unlock()
+		ht.running[taskID]--
+		if ht.running[taskID] == 0 {
+			delete(ht.running, taskID)
+			releaseSlot(ht.slots)
+		}
+	}
+	if running {
+		return release, nil
+	}
+
+	select {
+	case ht.slots <- struct{}{}:
+	default:
+		ol.taskQueueDepth.WithLabelValues(host).Inc()
+		err := takeSlot(ctx, ht.slots)
+		ol.taskQueueDepth.WithLabelValues(host).Dec()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+	ht.running[taskID]++
+	// the other download of the task has taken a slot while waiting
+	if ht.running[taskID] > 1 {
+		releaseSlot(ht.slots)
+	}
+	return release, nil
+}
+
+// getHostSlots returns the slots of the host, or nil if the host is unlimited.
+func (ol *originLimiter) getHostSlots(host string) chan struct{} {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+
+	if slots, ok := ol.hosts[host]; ok {
+		return slots
+	}
+
+	var slots chan struct{}
+	if limit := ol.getHostLimit(host); limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+	ol.hosts[host] = slots
+	return slots
+}
+
+// getHostLimit returns the concurrency limit of the host,
+// which is matched with the port first and then without the port.
+func (ol *originLimiter) getHostLimit(host string) int {
+	if limit, ok := ol.hostLimits[host]; ok {
+		return limit
+	}
+	u := &url.URL{Host: host}
+	if limit, ok := ol.hostLimits[u.Hostname()]; ok {
+		return limit
+	}
+	return ol.defaultHostLimit
+}
+
+// setGlobalLimit changes the global limit at runtime, which is disabled if the limit
+// is not greater than 0. The downloads in flight are never interrupted, and no more
+// download is allowed until they drain below the new limit if it's reduced.
+func (ol *originLimiter) setGlobalLimit(limit int) {
+	ol.global.resize(limit)
+}
+
+// getGlobalLimit returns the global limit and the number of the downloads holding the global slots.
+func (ol *originLimiter) getGlobalLimit() (limit, inFlight int) {
+	return ol.global.get()
+}
+
+// resizableSlots is a semaphore whose capacity can be changed while the slots are taken.
+type resizableSlots struct {
+	mu sync.Mutex
+	// limit is the capacity, and the slots are unlimited if it's not greater than 0.
+	limit    int
+	inFlight int
+	// changed is closed and replaced when a slot is released or the limit changes,
+	// to wake up the waiters.
+	changed chan struct{}
+	// onChange is called with the limit and the inFlight when either of them changes.
+	onChange func(limit, inFlight int)
+}
+
+func newResizableSlots(limit int, onChange func(limit, inFlight int)) *resizableSlots {
+	rs := &resizableSlots{
+		limit:    limit,
+		changed:  make(chan struct{}),
+		onChange: onChange,
+	}
+	rs.onChange(rs.limit, rs.inFlight)
+	return rs
+}
+
+// take blocks until a slot is taken or ctx is done.
+func (rs *resizableSlots) take(ctx context.Context) error {
+	for {
+		rs.mu.Lock()
+		if rs.limit <= 0 || rs.inFlight < rs.limit {
+			rs.inFlight++
+			rs.onChange(rs.limit, rs.inFlight)
+			rs.mu.Unlock()
+			return nil
+		}
+		changed := rs.changed
+		rs.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release releases a slot taken.
+func (rs *resizableSlots) release() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.inFlight--
+	rs.notify()
+}
+
+// resize changes the capacity without affecting the slots taken.
+func (rs *resizableSlots) resize(limit int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.limit = limit
+	rs.notify()
+}
+
+func (rs *resizableSlots) get() (limit, inFlight int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.limit, rs.inFlight
+}
+
+// notify wakes up the waiters, and it should be called with the lock held.
+func (rs *resizableSlots) notify() {
+	close(rs.changed)
+	rs.changed = make(chan struct{})
+	rs.onChange(rs.limit, rs.inFlight)
+}
+
+// getOriginHost returns the host of rawURL with the port if any.
+func getOriginHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func takeSlot(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func releaseSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
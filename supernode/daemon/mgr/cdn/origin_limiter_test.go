@@ -0,0 +1,235 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type OriginLimiterTestSuite struct{}
+
+func init() {
+	check.Suite(&OriginLimiterTestSuite{})
+}
+
+func (s *OriginLimiterTestSuite) newOriginLimiter(global, defaultHost int, hosts map[string]int) *originLimiter {
+	cfg := config.NewConfig()
+	cfg.OriginConcurrencyLimit = global
+	cfg.OriginHostConcurrencyLimit = defaultHost
+	cfg.OriginHostConcurrencyLimits = hosts
+	return newOriginLimiter(cfg, prometheus.NewRegistry())
+}
+
+func (s *OriginLimiterTestSuite) TestSaturatedHostNotBlockOthers(c *check.C) {
+	ol := s.newOriginLimiter(2, 1, nil)
+
+	releaseA, err := ol.acquire(context.Background(), "taskA1", "http://a.example.com/1")
+	c.Assert(err, check.IsNil)
+
+	// the second download from host a queues behind host a only
+	acquired := make(chan func())
+	go func() {
+		release, err := ol.acquire(context.Background(), "taskA2", "http://a.example.com/2")
+		c.Check(err, check.IsNil)
+		acquired <- release
+	}()
+	for prom_testutil.ToFloat64(ol.queueDepth.WithLabelValues("a.example.com")) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	releaseB, err := ol.acquire(ctx, "taskB1", "http://b.example.com/1")
+	c.Assert(err, check.IsNil)
+
+	releaseA()
+	releaseA2 := <-acquired
+	c.Check(prom_testutil.ToFloat64(ol.queueDepth.WithLabelValues("a.example.com")), check.Equals, float64(0))
+	releaseA2()
+	releaseB()
+}
+
+func (s *OriginLimiterTestSuite) TestGlobalLimit(c *check.C) {
+	ol := s.newOriginLimiter(1, 0, nil)
+
+	release, err := ol.acquire(context.Background(), "taskA1", "http://a.example.com/1")
+	c.Assert(err, check.IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ol.acquire(ctx, "taskB1", "http://b.example.com/1")
+	c.Check(err, check.Equals, context.DeadlineExceeded)
+
+	release()
+	release, err = ol.acquire(context.Background(), "taskB1", "http://b.example.com/1")
+	c.Assert(err, check.IsNil)
+	release()
+}
+
+func (s *OriginLimiterTestSuite) TestHostLimitReleasedOnGlobalTimeout(c *check.C) {
+	ol := s.newOriginLimiter(1, 1, nil)
+
+	release, err := ol.acquire(context.Background(), "taskA1", "http://a.example.com/1")
+	c.Assert(err, check.IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ol.acquire(ctx, "taskB1", "http://b.example.com/1")
+	c.Check(err, check.Equals, context.DeadlineExceeded)
+	c.Check(len(ol.getHostSlots("b.example.com")), check.Equals, 0)
+	release()
+}
+
+func (s *OriginLimiterTestSuite) TestGetHostLimit(c *check.C) {
+	ol := s.newOriginLimiter(0, 4, map[string]int{
+		"a.example.com":      1,
+		"a.example.com:8080": 2,
+	})
+
+	c.Check(ol.getHostLimit("a.example.com"), check.Equals, 1)
+	c.Check(ol.getHostLimit("a.example.com:8080"), check.Equals, 2)
+	c.Check(ol.getHostLimit("a.example.com:8081"), check.Equals, 1)
+	c.Check(ol.getHostLimit("b.example.com"), check.Equals, 4)
+
+	ol = s.newOriginLimiter(0, 0, nil)
+	c.Check(ol.getHostSlots("b.example.com"), check.IsNil)
+	release, err := ol.acquire(context.Background(), "taskB1", "http://b.example.com/1")
+	c.Assert(err, check.IsNil)
+	release()
+}
+
+func (s *OriginLimiterTestSuite) TestHostTaskLimit(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.OriginHostTaskLimit = 2
+	ol := newOriginLimiter(cfg, prometheus.NewRegistry())
+
+	release1, err := ol.acquire(context.Background(), "task1", "http://a.example.com/1")
+	c.Assert(err, check.IsNil)
+	release2, err := ol.acquire(context.Background(), "task2", "http://a.example.com/2")
+	c.Assert(err, check.IsNil)
+
+	// the download of the running task shares its slot
+	release1Again, err := ol.acquire(context.Background(), "task1", "http://a.example.com/1")
+	c.Assert(err, check.IsNil)
+
+	// the other hosts are not limited by the host
+	releaseB, err := ol.acquire(context.Background(), "task4", "http://b.example.com/4")
+	c.Assert(err, check.IsNil)
+	releaseB()
+
+	// the third distinct task of the host is queued
+	acquired := make(chan func())
+	go func() {
+		release, err := ol.acquire(context.Background(), "task3", "http://a.example.com/3")
+		c.Check(err, check.IsNil)
+		acquired <- release
+	}()
+	for i := 0; i < 100 && prom_testutil.ToFloat64(ol.taskQueueDepth.WithLabelValues("a.example.com")) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(prom_testutil.ToFloat64(ol.taskQueueDepth.WithLabelValues("a.example.com")), check.Equals, float64(1))
+
+	// until the slot of a task is released by all its downloads
+	release1()
+	select {
+	case <-acquired:
+		c.Fatal("the task is allowed before the slot is released")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release1Again()
+	release3 := <-acquired
+	c.Check(prom_testutil.ToFloat64(ol.taskQueueDepth.WithLabelValues("a.example.com")), check.Equals, float64(0))
+
+	// and the waiting task gives up when ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = ol.acquire(ctx, "task5", "http://a.example.com/5")
+	c.Check(err, check.Equals, context.DeadlineExceeded)
+
+	release2()
+	release3()
+	c.Check(len(ol.hostTasks["a.example.com"].slots), check.Equals, 0)
+	c.Check(len(ol.hostTasks["a.example.com"].running), check.Equals, 0)
+}
+
+func (s *OriginLimiterTestSuite) TestResizeGlobalLimit(c *check.C) {
+	ol := s.newOriginLimiter(3, 0, nil)
+	checkGlobal := func(limit, inFlight int) {
+		l, n := ol.getGlobalLimit()
+		c.Check([]int{l, n}, check.DeepEquals, []int{limit, inFlight})
+		c.Check(prom_testutil.ToFloat64(ol.globalLimit.WithLabelValues()), check.Equals, float64(limit))
+		c.Check(prom_testutil.ToFloat64(ol.globalInFlight.WithLabelValues()), check.Equals, float64(inFlight))
+	}
+	tryAcquire := func(taskID string) (func(), error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		return ol.acquire(ctx, taskID, "http://a.example.com/"+taskID)
+	}
+
+	var releases []func()
+	for _, taskID := range []string{"task1", "task2", "task3"} {
+		release, err := tryAcquire(taskID)
+		c.Assert(err, check.IsNil)
+		releases = append(releases, release)
+	}
+	checkGlobal(3, 3)
+
+	// the downloads in flight are kept when the limit shrinks,
+	// and no more is allowed until they drain below the new limit
+	ol.setGlobalLimit(1)
+	checkGlobal(1, 3)
+	releases[0]()
+	releases[1]()
+	_, err := tryAcquire("task4")
+	c.Check(err, check.Equals, context.DeadlineExceeded)
+	releases[2]()
+	checkGlobal(1, 0)
+	release4, err := tryAcquire("task4")
+	c.Assert(err, check.IsNil)
+	_, err = tryAcquire("task5")
+	c.Check(err, check.Equals, context.DeadlineExceeded)
+
+	// and the waiting download is allowed once the limit grows
+	acquired := make(chan func())
+	go func() {
+		release, err := ol.acquire(context.Background(), "task5", "http://a.example.com/task5")
+		c.Check(err, check.IsNil)
+		acquired <- release
+	}()
+	ol.setGlobalLimit(2)
+	release5 := <-acquired
+	checkGlobal(2, 2)
+	_, err = tryAcquire("task6")
+	c.Check(err, check.Equals, context.DeadlineExceeded)
+
+	// and the limit is disabled with 0
+	ol.setGlobalLimit(0)
+	release6, err := tryAcquire("task6")
+	c.Assert(err, check.IsNil)
+	checkGlobal(0, 3)
+	release4()
+	release5()
+	release6()
+	checkGlobal(0, 0)
+}
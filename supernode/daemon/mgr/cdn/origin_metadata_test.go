@@ -0,0 +1,95 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+type OriginMetadataTestSuite struct {
+	cdnFixture
+	server *httptest.Server
+}
+
+func init() {
+	check.Suite(&OriginMetadataTestSuite{})
+}
+
+func (s *OriginMetadataTestSuite) SetUpSuite(c *check.C) {
+	s.setUpFixture(c, "OriginMetadataTestSuite")
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Class", "golden")
+		w.Header().Set("X-Owner", "team-a")
+		w.Header().Set("X-Request-Id", "abc")
+		w.Write([]byte("hello dragonfly"))
+	}))
+}
+
+func (s *OriginMetadataTestSuite) TearDownSuite(c *check.C) {
+	s.server.Close()
+	s.tearDownFixture(c)
+}
+
+func (s *OriginMetadataTestSuite) triggerCDN(c *check.C, cfg *config.Config, taskID string) *types.TaskInfo {
+	updateTaskInfo, err := s.trigger(c, cfg, &types.TaskInfo{
+		ID:             taskID,
+		RawURL:         s.server.URL,
+		TaskURL:        s.server.URL,
+		PieceSize:      1024 * 1024,
+		HTTPFileLength: int64(len("hello dragonfly")),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	return updateTaskInfo
+}
+
+func (s *OriginMetadataTestSuite) TestCaptureOriginMetadata(c *check.C) {
+	taskID := "originMetadataTaskID1"
+	cfg := config.NewConfig()
+	cfg.OriginMetadataHeaders = []string{"x-content-class", "X-Owner", "X-Missing"}
+	expected := map[string]string{"X-Content-Class": "golden", "X-Owner": "team-a"}
+
+	updateTaskInfo := s.triggerCDN(c, cfg, taskID)
+	c.Check(updateTaskInfo.OriginMetadata, check.DeepEquals, expected)
+
+	metaData, err := newFileMetaDataManager(s.cacheStore).readFileMetaData(context.TODO(), taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(metaData.OriginMetadata, check.DeepEquals, expected)
+
+	// the origin metadata of the cached file is restored as well
+	updateTaskInfo = s.triggerCDN(c, cfg, taskID)
+	c.Check(updateTaskInfo.OriginMetadata, check.DeepEquals, expected)
+}
+
+func (s *OriginMetadataTestSuite) TestNoOriginMetadataByDefault(c *check.C) {
+	taskID := "originMetadataTaskID2"
+
+	updateTaskInfo := s.triggerCDN(c, config.NewConfig(), taskID)
+	c.Check(updateTaskInfo.OriginMetadata, check.IsNil)
+
+	metaData, err := newFileMetaDataManager(s.cacheStore).readFileMetaData(context.TODO(), taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(metaData.OriginMetadata, check.IsNil)
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/sirupsen/logrus"
+)
+
+// linkTempSuffix is the suffix of the temporary file created aside while
+// linking the file of a task, which is left over if supernode crashes.
+const linkTempSuffix = ".link"
+
+// taskFiles contains the files stored for a task.
+type taskFiles struct {
+	keys    []string
+	modTime time.Time
+	hasData bool
+	hasMeta bool
+}
+
+func (tf *taskFiles) add(key string, info *store.StorageInfo) {
+	tf.keys = append(tf.keys, key)
+	if info.ModTime.After(tf.modTime) {
+		tf.modTime = info.ModTime
+	}
+}
+
+// ReclaimOrphans removes the files stored for the tasks which are neither known by isKnown
+// nor complete with both the downloaded file and its metadata, which could be reused by the
+// task registered again. The files modified within the gracePeriod are kept to avoid racing
+// with the writes in progress. And the temporary files left over by the link are removed as well.
+func (cm *Manager) ReclaimOrphans(ctx context.Context, gracePeriod time.Duration, isKnown func(taskID string) bool) (files int, bytes int64, err error) {
+	tasks := make(map[string]*taskFiles)
+	var links []*taskFiles
+	err = cm.cacheStore.Walk(ctx, &store.Raw{Bucket: config.DownloadHome}, func(key string, info *store.StorageInfo) error {
+		taskID, suffix, ok := parseTaskFileKey(key)
+		if !ok {
+			return nil
+		}
+		if suffix == linkTempSuffix {
+			link := &taskFiles{}
+			link.add(key, info)
+			links = append(links, link)
+			return nil
+		}
+
+		tf, ok := tasks[taskID]
+		if !ok {
+			tf = &taskFiles{}
+			tasks[taskID] = tf
+		}
+		tf.add(key, info)
+		switch suffix {
+		case "":
+			tf.hasData = true
+		case ".meta":
+			tf.hasMeta = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	modifiedAfter := time.Now().Add(-gracePeriod)
+	for _, link := range links {
+		if link.modTime.After(modifiedAfter) {
+			continue
+		}
+		files, bytes = cm.removeOrphan(ctx, link, files, bytes)
+	}
+	for taskID, tf := range tasks {
+		if (tf.hasData && tf.hasMeta) || tf.modTime.After(modifiedAfter) || isKnown(taskID) {
+			continue
+		}
+
+		// lock the task to avoid racing with its CDN download triggered just now
+		cm.cdnLocker.GetLock(taskID, false)
+		if !isKnown(taskID) {
+			logrus.Infof("reclaim the orphaned files %v of taskID(%s)", tf.keys, taskID)
+			files, bytes = cm.removeOrphan(ctx, tf, files, bytes)
+		}
+		cm.cdnLocker.ReleaseLock(taskID, false)
+	}
+	return files, bytes, nil
+}
+
+func (cm *Manager) removeOrphan(ctx context.Context, tf *taskFiles, files int, bytes int64) (int, int64) {
+	for _, key := range tf.keys {
+		info, err := cm.cacheStore.Stat(ctx, &store.Raw{Bucket: config.DownloadHome, Key: key})
+		if err != nil {
+			continue
+		}
+		if err := cm.cacheStore.Remove(ctx, &store.Raw{Bucket: config.DownloadHome, Key: key}); err != nil {
+			logrus.Warnf("failed to remove the orphaned file %s: %v", key, err)
+			continue
+		}
+		files++
+		bytes += info.Size
+	}
+	return files, bytes
+}
+
+// parseTaskFileKey parses the key of a file stored for a task, which is
+// in the form of getDownloadKey(taskID) followed by an optional suffix.
+// The files which are not stored for the tasks are not recognized.
+func parseTaskFileKey(key string) (taskID, suffix string, ok bool) {
+	dir, name := path.Split(key)
+	for _, s := range []string{".meta", ".md5", linkTempSuffix} {
+		if strings.HasSuffix(name, s) {
+			name, suffix = strings.TrimSuffix(name, s), s
+			break
+		}
+	}
+	if name == "" || path.Clean(dir) != stringutils.SubString(name, 0, 3) {
+		return "", "", false
+	}
+	return name, suffix, true
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type OrphanReclaimTestSuite struct {
+	cdnFixture
+}
+
+func init() {
+	check.Suite(&OrphanReclaimTestSuite{})
+}
+
+func (s *OrphanReclaimTestSuite) SetUpSuite(c *check.C) {
+	s.setUpFixture(c, "OrphanReclaimTestSuite")
+}
+
+func (s *OrphanReclaimTestSuite) TearDownSuite(c *check.C) {
+	s.tearDownFixture(c)
+}
+
+// putFile stores the data with the key in the download bucket and sets its modification time.
+func (s *OrphanReclaimTestSuite) putFile(c *check.C, key, data string, modTime time.Time) {
+	raw := &store.Raw{Bucket: config.DownloadHome, Key: key}
+	c.Assert(s.cacheStore.PutBytes(context.TODO(), raw, []byte(data)), check.IsNil)
+	s.touch(c, key, modTime)
+}
+
+func (s *OrphanReclaimTestSuite) touch(c *check.C, key string, modTime time.Time) {
+	c.Assert(os.Chtimes(filepath.Join(s.workHome, config.DownloadHome, key), modTime, modTime), check.IsNil)
+}
+
+func (s *OrphanReclaimTestSuite) exists(key string) bool {
+	_, err := s.cacheStore.Stat(context.TODO(), &store.Raw{Bucket: config.DownloadHome, Key: key})
+	return err == nil
+}
+
+func (s *OrphanReclaimTestSuite) TestReclaimOrphans(c *check.C) {
+	cm, err := NewManager(config.NewConfig(), s.cacheStore, nil, nil, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	old := time.Now().Add(-2 * time.Hour)
+
+	// the file whose metadata was lost is orphaned, and so are the md5s of a deleted file
+	s.putFile(c, getDownloadKey("orphanedTask"), "orphaned", old)
+	s.putFile(c, getMd5DataKey("orphanedTask"), "md5s", old)
+	s.putFile(c, getMetaDataKey("deletedTask"), "meta", old)
+	// the cached file with its metadata can be reused by the task registered again
+	s.putFile(c, getDownloadKey("cachedTask"), "cached", old)
+	s.putFile(c, getMetaDataKey("cachedTask"), "meta", old)
+	// the file of the known task is being downloaded
+	s.putFile(c, getDownloadKey("knownTask"), "known", old)
+	// the link was interrupted by a crash
+	s.putFile(c, getDownloadKey("cachedTask")+linkTempSuffix, "link", old)
+	// the file was written just now
+	s.putFile(c, getDownloadKey("freshTask"), "fresh", time.Now())
+	// and the file is not stored for a task
+	s.putFile(c, "unknown/file", "unknown", old)
+
+	isKnown := func(taskID string) bool {
+		return taskID == "knownTask"
+	}
+	files, bytes, err := cm.ReclaimOrphans(context.TODO(), time.Hour, isKnown)
+	c.Assert(err, check.IsNil)
+	c.Check(files, check.Equals, 4)
+	c.Check(bytes, check.Equals, int64(len("orphaned")+len("md5s")+len("meta")+len("link")))
+	for _, key := range []string{getDownloadKey("orphanedTask"), getMd5DataKey("orphanedTask"),
+		getMetaDataKey("deletedTask"), getDownloadKey("cachedTask") + linkTempSuffix} {
+		c.Check(s.exists(key), check.Equals, false, check.Commentf("key: %s", key))
+	}
+	for _, key := range []string{getDownloadKey("cachedTask"), getMetaDataKey("cachedTask"),
+		getDownloadKey("knownTask"), getDownloadKey("freshTask"), "unknown/file"} {
+		c.Check(s.exists(key), check.Equals, true, check.Commentf("key: %s", key))
+	}
+
+	// the fresh file is reclaimed once the grace period elapses
+	s.touch(c, getDownloadKey("freshTask"), old)
+	files, bytes, err = cm.ReclaimOrphans(context.TODO(), time.Hour, isKnown)
+	c.Assert(err, check.IsNil)
+	c.Check(files, check.Equals, 1)
+	c.Check(bytes, check.Equals, int64(len("fresh")))
+	c.Check(s.exists(getDownloadKey("freshTask")), check.Equals, false)
+	c.Check(s.exists(getDownloadKey("knownTask")), check.Equals, true)
+}
+
+func (s *OrphanReclaimTestSuite) TestParseTaskFileKey(c *check.C) {
+	var cases = []struct {
+		key    string
+		taskID string
+		suffix string
+		ok     bool
+	}{
+		{key: "abc/abcdef", taskID: "abcdef", suffix: "", ok: true},
+		{key: "abc/abcdef.meta", taskID: "abcdef", suffix: ".meta", ok: true},
+		{key: "abc/abcdef.md5", taskID: "abcdef", suffix: ".md5", ok: true},
+		{key: "abc/abcdef.link", taskID: "abcdef", suffix: ".link", ok: true},
+		{key: "abd/abcdef", ok: false},
+		{key: "abcdef", ok: false},
+		{key: "abc/.meta", ok: false},
+	}
+	for _, tc := range cases {
+		taskID, suffix, ok := parseTaskFileKey(tc.key)
+		c.Check(ok, check.Equals, tc.ok, check.Commentf("key: %s", tc.key))
+		c.Check(taskID, check.Equals, tc.taskID, check.Commentf("key: %s", tc.key))
+		c.Check(suffix, check.Equals, tc.suffix, check.Commentf("key: %s", tc.key))
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// handlePartialDownload handles the pieces of the task committed to the storage before
+// its download from the source failed with cause according to the PartialDownloadPolicy.
+// They are kept to be resumed by the next download of the task by default,
+// or the files of the task are deleted so that the next download starts from the beginning.
+func (cm *Manager) handlePartialDownload(ctx context.Context, task *types.TaskInfo, cause error) {
+	if cm.discardPartialDownload() {
+		logrus.Infof("taskID: %s, discard the pieces downloaded before the failure: %v", task.ID, cause)
+		if _, err := cm.detector.resetRepo(ctx, task); err != nil {
+			logrus.Errorf("failed to discard the pieces downloaded for task %s: %v", task.ID, err)
+		}
+		return
+	}
+
+	logrus.Infof("taskID: %s, keep the pieces downloaded before the failure for resume: %v", task.ID, cause)
+	if err := cm.metaDataManager.updateInterruptedTime(ctx, task.ID, getCurrentTimeMillisFunc()); err != nil {
+		logrus.Errorf("failed to update the interrupted time of task %s: %v", task.ID, err)
+	}
+}
+
+// discardPartialDownload returns whether the pieces committed before the download fails are discarded.
+func (cm *Manager) discardPartialDownload() bool {
+	return cm.cfg != nil && cm.cfg.BaseProperties != nil &&
+		cm.cfg.PartialDownloadPolicy == config.PartialDownloadDiscardOnFailure
+}
+
+// isPartialDownloadExpired returns whether the pieces kept for resume since the download
+// of the file failed have been kept longer than the PartialDownloadTTL.
+func (cd *cacheDetector) isPartialDownloadExpired(metaData *fileMetaData) bool {
+	if cd.cfg == nil || cd.cfg.BaseProperties == nil || cd.cfg.PartialDownloadTTL <= 0 || metaData.InterruptedTime <= 0 {
+		return false
+	}
+	interruptedTime := time.Unix(0, metaData.InterruptedTime*int64(time.Millisecond))
+	return time.Since(interruptedTime) >= cd.cfg.PartialDownloadTTL
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+	"github.com/pkg/errors"
+)
+
+const (
+	// partialPieceSize is the size of the pieces of the tasks downloaded from the partial source.
+	partialPieceSize = 1024 * 1024
+	// partialCommittedPieces is the number of the pieces committed before the partial source fails.
+	partialCommittedPieces = 2
+	// partialMaxTaskAge is the max task age after which the download from the stalled source fails.
+	partialMaxTaskAge = 200 * time.Millisecond
+)
+
+type PartialDownloadTestSuite struct {
+	cdnFixture
+	server *httptest.Server
+
+	content []byte
+
+	mu sync.Mutex
+	// fail indicates whether the next download of the whole file fails halfway,
+	// where the source truncates the content of /truncated and stalls for the others.
+	fail bool
+	// ranges contains the ranges requested to download the file.
+	ranges []string
+}
+
+func init() {
+	check.Suite(&PartialDownloadTestSuite{})
+}
+
+func (s *PartialDownloadTestSuite) SetUpSuite(c *check.C) {
+	s.setUpFixture(c, "PartialDownloadTestSuite")
+
+	s.content = []byte(strings.Repeat("hello dragonfly, ", 3*partialPieceSize/17))
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"partial"`)
+		rangeHeader := r.Header.Get("Range")
+		conditional := r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+
+		s.mu.Lock()
+		fail := s.fail && rangeHeader == "" && !conditional
+		if fail {
+			s.fail = false
+		}
+		if rangeHeader != "" && rangeHeader != "bytes=0-0" {
+			s.ranges = append(s.ranges, rangeHeader)
+		}
+		s.mu.Unlock()
+
+		// the source fails halfway through the third piece
+		if fail {
+			w.Header().Set("Content-Length", strconv.Itoa(len(s.content)))
+			w.Write(s.content[:partialCommittedPieces*(partialPieceSize-config.PieceWrapSize)+100])
+			if r.URL.Path == "/truncated" {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(s.content))
+	}))
+}
+
+func (s *PartialDownloadTestSuite) TearDownSuite(c *check.C) {
+	s.server.Close()
+	s.tearDownFixture(c)
+}
+
+func (s *PartialDownloadTestSuite) SetUpTest(c *check.C) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = true
+	s.ranges = nil
+}
+
+// newConfig returns the config with which the download from the stalled source fails.
+func (s *PartialDownloadTestSuite) newConfig() *config.Config {
+	cfg := config.NewConfig()
+	cfg.MaxTaskAge = partialMaxTaskAge
+	return cfg
+}
+
+func (s *PartialDownloadTestSuite) newTask(taskID, path string) *types.TaskInfo {
+	return &types.TaskInfo{
+		ID:             taskID,
+		RawURL:         s.server.URL + path,
+		TaskURL:        s.server.URL + path,
+		PieceSize:      partialPieceSize,
+		HTTPFileLength: int64(len(s.content)),
+	}
+}
+
+// failHalfway triggers the CDN of the task which fails after committing the partialCommittedPieces,
+// and returns the error.
+func (s *PartialDownloadTestSuite) failHalfway(c *check.C, cm *Manager, task *types.TaskInfo) error {
+	updateTaskInfo, err := cm.TriggerCDN(context.TODO(), task)
+	c.Assert(err, check.NotNil)
+	c.Assert(updateTaskInfo, check.NotNil)
+	c.Check(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusFAILED)
+	return err
+}
+
+// retry triggers the CDN of the task again which succeeds, and returns the ranges requested by it.
+func (s *PartialDownloadTestSuite) retry(c *check.C, cm *Manager, task *types.TaskInfo) []string {
+	updateTaskInfo, err := cm.TriggerCDN(context.TODO(), task)
+	c.Assert(err, check.IsNil)
+	c.Assert(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	c.Check(updateTaskInfo.RealMd5, check.Equals, fmt.Sprintf("%x", md5.Sum(s.content)))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ranges
+}
+
+func (s *PartialDownloadTestSuite) TestKeepForResume(c *check.C) {
+	cm := s.newManager(c, s.newConfig())
+	task := s.newTask("partialDownloadTaskID1", "/stalled")
+	c.Check(errortypes.IsTaskExpired(errors.Cause(s.failHalfway(c, cm, task))), check.Equals, true)
+
+	// the committed pieces survive the failure
+	metaData, err := cm.metaDataManager.readFileMetaData(context.TODO(), task.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(metaData.Finish, check.Equals, false)
+	c.Check(metaData.InterruptedTime > 0, check.Equals, true)
+	c.Check(cm.detector.parseBreakNumByCheckFile(context.TODO(), task.ID), check.Equals, partialCommittedPieces)
+
+	// and the retry resumes from them
+	ranges := s.retry(c, cm, task)
+	c.Check(ranges, check.DeepEquals, []string{
+		fmt.Sprintf("bytes=%d-%d", partialCommittedPieces*(partialPieceSize-config.PieceWrapSize), len(s.content)-1),
+	})
+}
+
+func (s *PartialDownloadTestSuite) TestDiscardOnFailure(c *check.C) {
+	cfg := s.newConfig()
+	cfg.PartialDownloadPolicy = config.PartialDownloadDiscardOnFailure
+	cm := s.newManager(c, cfg)
+	task := s.newTask("partialDownloadTaskID2", "/stalled")
+	s.failHalfway(c, cm, task)
+
+	// the committed pieces are discarded with the failure
+	_, err := s.cacheStore.Stat(context.TODO(), getDownloadRawFunc(task.ID))
+	c.Check(store.IsKeyNotFound(err), check.Equals, true)
+	metaData, err := cm.metaDataManager.readFileMetaData(context.TODO(), task.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(metaData.ETag, check.Equals, "")
+
+	// and the retry starts from the beginning
+	c.Check(s.retry(c, cm, task), check.HasLen, 0)
+}
+
+func (s *PartialDownloadTestSuite) TestExpireKeptPieces(c *check.C) {
+	cfg := s.newConfig()
+	cfg.PartialDownloadTTL = time.Minute
+	cm := s.newManager(c, cfg)
+	task := s.newTask("partialDownloadTaskID3", "/stalled")
+	s.failHalfway(c, cm, task)
+
+	// the pieces kept beyond the PartialDownloadTTL are not resumed
+	interruptedTime := getCurrentTimeMillisFunc() - 2*time.Minute.Nanoseconds()/time.Millisecond.Nanoseconds()
+	c.Assert(cm.metaDataManager.updateInterruptedTime(context.TODO(), task.ID, interruptedTime), check.IsNil)
+	c.Check(s.retry(c, cm, task), check.HasLen, 0)
+}
+
+func (s *PartialDownloadTestSuite) TestNotResumeTruncatedContent(c *check.C) {
+	cm := s.newManager(c, s.newConfig())
+	task := s.newTask("partialDownloadTaskID4", "/truncated")
+	err := s.failHalfway(c, cm, task)
+	c.Check(errortypes.IsContentLengthMismatch(errors.Cause(err)), check.Equals, true, check.Commentf("%v", err))
+
+	// the truncated download is marked as failed rather than kept for resume
+	metaData, err := cm.metaDataManager.readFileMetaData(context.TODO(), task.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(metaData.Finish, check.Equals, true)
+	c.Check(metaData.Success, check.Equals, false)
+	c.Check(metaData.InterruptedTime, check.Equals, int64(0))
+
+	// and the retry starts from the beginning
+	c.Check(s.retry(c, cm, task), check.HasLen, 0)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pieceBufferBudget accounts the memory of the buffers of the pieces downloaded from the sources
+// which haven't been written to the storage, and bounds it across all the tasks.
+// A buffer is reserved before the piece is read from the source and released once it's written,
+// so the downloads wait for the pieces of the others to be written while the limit is reached.
+type pieceBufferBudget struct {
+	limit int64
+
+	mu   sync.Mutex
+	used int64
+	// released is closed and replaced whenever the reserved bytes are released,
+	// which wakes up the downloads waiting for the budget.
+	released chan struct{}
+
+	bufferedBytes *prometheus.GaugeVec
+	limitBytes    *prometheus.GaugeVec
+	waits         *prometheus.CounterVec
+}
+
+func newPieceBufferBudget(cfg *config.Config, register prometheus.Registerer) *pieceBufferBudget {
+	b := &pieceBufferBudget{
+		released: make(chan struct{}),
+		bufferedBytes: metricsutils.NewGauge(config.SubsystemSupernode, "piece_buffer_bytes",
+			"Current bytes of the pieces downloaded from the sources and buffered before being written", []string{}, register),
+		limitBytes: metricsutils.NewGauge(config.SubsystemSupernode, "piece_buffer_limit_bytes",
+			"Max bytes of the pieces buffered before being written, 0 if unlimited", []string{}, register),
+		waits: metricsutils.NewCounter(config.SubsystemSupernode, "piece_buffer_waits_total",
+			"Total times of the downloads waiting for the buffered pieces to be written", []string{}, register),
+	}
+	if cfg != nil && cfg.BaseProperties != nil && cfg.PieceBufferMemoryLimit > 0 {
+		b.limit = cfg.PieceBufferMemoryLimit
+	}
+	b.limitBytes.WithLabelValues().Set(float64(b.limit))
+	return b
+}
+
+// acquire reserves n bytes for the buffer of a piece, and blocks until the budget
+// allows it or ctx is done. The piece is always allowed if nothing is reserved.
+func (b *pieceBufferBudget) acquire(ctx context.Context, n int64) error {
+	if b == nil {
+		return nil
+	}
+
+	waited := false
+	for {
+		b.mu.Lock()
+		if b.limit <= 0 || b.used == 0 || b.used+n <= b.limit {
+			b.used += n
+			b.bufferedBytes.WithLabelValues().Set(float64(b.used))
+			b.mu.Unlock()
+			return nil
+		}
+		released := b.released
+		b.mu.Unlock()
+
+		if !waited {
+			waited = true
+			b.waits.WithLabelValues().Inc()
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release releases the n bytes reserved for the buffer of a piece which has been written.
+func (b *pieceBufferBudget) release(n int64) {
+	if b == nil || n <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.bufferedBytes.WithLabelValues().Set(float64(b.used))
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// getUsed returns the bytes reserved for the buffers of the pieces.
+func (b *pieceBufferBudget) getUsed() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
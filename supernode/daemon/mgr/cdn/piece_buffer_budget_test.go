@@ -0,0 +1,137 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type PieceBufferBudgetTestSuite struct {
+	cdnFixture
+}
+
+func init() {
+	check.Suite(&PieceBufferBudgetTestSuite{})
+}
+
+func (s *PieceBufferBudgetTestSuite) SetUpSuite(c *check.C) {
+	s.setUpFixture(c, "PieceBufferBudgetTestSuite")
+}
+
+func (s *PieceBufferBudgetTestSuite) TearDownSuite(c *check.C) {
+	s.tearDownFixture(c)
+}
+
+func newTestPieceBufferBudget(limit int64) *pieceBufferBudget {
+	cfg := config.NewConfig()
+	cfg.PieceBufferMemoryLimit = limit
+	return newPieceBufferBudget(cfg, prometheus.NewRegistry())
+}
+
+func (s *PieceBufferBudgetTestSuite) TestBackpressure(c *check.C) {
+	b := newTestPieceBufferBudget(20)
+	ctx := context.TODO()
+	c.Check(int64(prom_testutil.ToFloat64(b.limitBytes.WithLabelValues())), check.Equals, int64(20))
+
+	c.Assert(b.acquire(ctx, 10), check.IsNil)
+	c.Assert(b.acquire(ctx, 10), check.IsNil)
+	c.Check(int64(prom_testutil.ToFloat64(b.bufferedBytes.WithLabelValues())), check.Equals, int64(20))
+
+	// the piece exceeding the budget waits for the buffered pieces to be written
+	acquired := make(chan error)
+	go func() {
+		acquired <- b.acquire(ctx, 10)
+	}()
+	select {
+	case <-acquired:
+		c.Fatal("the budget is exceeded")
+	case <-time.After(100 * time.Millisecond):
+	}
+	c.Check(int(prom_testutil.ToFloat64(b.waits.WithLabelValues())), check.Equals, 1)
+
+	// and continues once a piece is written
+	b.release(10)
+	select {
+	case err := <-acquired:
+		c.Check(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("the piece waits for the budget after the release")
+	}
+	c.Check(b.getUsed(), check.Equals, int64(20))
+
+	// the waiting piece gives up once the download is canceled
+	cancelCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		acquired <- b.acquire(cancelCtx, 10)
+	}()
+	cancel()
+	c.Check(<-acquired, check.Equals, context.Canceled)
+	c.Check(b.getUsed(), check.Equals, int64(20))
+
+	b.release(20)
+	c.Check(b.getUsed(), check.Equals, int64(0))
+	c.Check(int64(prom_testutil.ToFloat64(b.bufferedBytes.WithLabelValues())), check.Equals, int64(0))
+
+	// the piece larger than the budget is allowed if nothing is buffered
+	c.Assert(b.acquire(ctx, 30), check.IsNil)
+	b.release(30)
+
+	// the budget is unlimited if it's disabled
+	b = newTestPieceBufferBudget(0)
+	for i := 0; i < 10; i++ {
+		c.Assert(b.acquire(ctx, 10), check.IsNil)
+	}
+	c.Check(b.getUsed(), check.Equals, int64(100))
+}
+
+func (s *PieceBufferBudgetTestSuite) TestWriteWithinBudget(c *check.C) {
+	var pieceContSize = int32(10)
+	budget := newTestPieceBufferBudget(int64(pieceContSize))
+	writer := newSuperWriter(s.cacheStore, nil, budget)
+
+	content := strings.Repeat("hello dragonfly", 10)
+	task := &types.TaskInfo{
+		ID:        "5826501cbcc3bb92f0b645918c5a4b15495a63259e3e0363008f97e186509e9e",
+		PieceSize: pieceContSize + config.PieceWrapSize,
+	}
+	downloadMetadata, err := writer.startWriter(context.TODO(), nil, strings.NewReader(content), task,
+		0, int64(len(content)), pieceContSize)
+	c.Assert(err, check.IsNil)
+	c.Check(downloadMetadata.pieceCount, check.Equals, len(content)/int(pieceContSize))
+
+	// the buffers are released as the pieces are written
+	c.Check(budget.getUsed(), check.Equals, int64(0))
+	c.Check(int64(prom_testutil.ToFloat64(budget.bufferedBytes.WithLabelValues())), check.Equals, int64(0))
+	file, err := s.cacheStore.Open(context.TODO(), getDownloadRawFunc(task.ID))
+	c.Assert(err, check.IsNil)
+	defer file.Close()
+	cf, err := newContentFile(file, task.PieceSize)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadAll(cf)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, content)
+}
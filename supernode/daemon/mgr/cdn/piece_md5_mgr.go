@@ -77,3 +77,8 @@ func (pmm *pieceMD5Mgr) getPieceMD5sByTaskID(taskID string) (pieceMD5s []string,
 	}
 	return pieceMD5s, nil
 }
+
+// removePieceMD5sByTaskID removes all pieceMD5s of taskID.
+func (pmm *pieceMD5Mgr) removePieceMD5sByTaskID(taskID string) {
+	pmm.taskPieceMD5s.Delete(taskID)
+}
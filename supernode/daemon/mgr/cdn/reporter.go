@@ -173,7 +173,10 @@ func (re *reporter) reportPieceStatus(ctx context.Context, taskID string, pieceN
 		if err := re.pieceMD5Manager.setPieceMD5(taskID, pieceNum, md5); err != nil {
 			return err
 		}
+		if err := re.progressManager.UpdateSuperPieceMD5(ctx, taskID, pieceNum, md5); err != nil {
+			return err
+		}
 	}
 
-	return re.progressManager.UpdateProgress(ctx, taskID, re.cfg.GetSuperCID(taskID), re.cfg.GetSuperPID(), "", pieceNum, pieceStatus)
+	return re.progressManager.UpdateProgress(ctx, taskID, re.cfg.GetSuperCID(taskID), re.cfg.GetSuperPID(), "", pieceNum, pieceStatus, 0)
 }
@@ -35,6 +35,8 @@ type protocolContent struct {
 	pieceSize        int32
 	pieceContentSize int32
 	pieceContent     *bytes.Buffer
+	// reserved is the bytes reserved in the pieceBufferBudget for the piece content.
+	reserved int64
 }
 
 type downloadMetadata struct {
@@ -44,14 +46,16 @@ type downloadMetadata struct {
 }
 
 type superWriter struct {
-	cdnStore    *store.Store
-	cdnReporter *reporter
+	cdnStore     *store.Store
+	cdnReporter  *reporter
+	bufferBudget *pieceBufferBudget
 }
 
-func newSuperWriter(cdnStore *store.Store, cdnReporter *reporter) *superWriter {
+func newSuperWriter(cdnStore *store.Store, cdnReporter *reporter, bufferBudget *pieceBufferBudget) *superWriter {
 	return &superWriter{
-		cdnStore:    cdnStore,
-		cdnReporter: cdnReporter,
+		cdnStore:     cdnStore,
+		cdnReporter:  cdnReporter,
+		bufferBudget: bufferBudget,
 	}
 }
 
@@ -69,6 +73,19 @@ func (cw *superWriter) startWriter(ctx context.Context, cfg *config.Config, read
 
 	buf := make([]byte, pieceContSize)
 	var bb = &bytes.Buffer{}
+	// reserved is the bytes reserved for the buffer of the piece being read,
+	// which stops reading from the source until the budget allows it.
+	var reserved int64
+	reserve := func() error {
+		if err := cw.bufferBudget.acquire(ctx, int64(pieceContSize)); err != nil {
+			return err
+		}
+		reserved = int64(pieceContSize)
+		return nil
+	}
+	if err := reserve(); err != nil {
+		return nil, err
+	}
 
 	// start writer pool
 	routineCount := calculateRoutineCount(httpFileLength, task.PieceSize)
@@ -90,8 +107,10 @@ func (cw *superWriter) startWriter(ctx context.Context, cfg *config.Config, read
 					pieceSize:        task.PieceSize,
 					pieceContentSize: pieceContSize,
 					pieceContent:     bb,
+					reserved:         reserved,
 				}
 				jobCh <- pc
+				reserved = 0
 				logrus.Debugf("send the protocolContent taskID: %s pieceNum: %d", task.ID, curPieceNum)
 
 				realFileLength += config.PieceWrapSize
@@ -100,6 +119,11 @@ func (cw *superWriter) startWriter(ctx context.Context, cfg *config.Config, read
 				// write the data left to a new buffer
 				// TODO: recycling bytes.Buffer
 				bb = bytes.NewBuffer([]byte{})
+				if err := reserve(); err != nil {
+					close(jobCh)
+					wg.Wait()
+					return nil, err
+				}
 				n -= int(pieceContLeft)
 				if n > 0 {
 					bb.Write(buf[pieceContLeft : int(pieceContLeft)+n])
@@ -119,16 +143,22 @@ func (cw *superWriter) startWriter(ctx context.Context, cfg *config.Config, read
 					pieceSize:        task.PieceSize,
 					pieceContentSize: int32(bb.Len()),
 					pieceContent:     bb,
+					reserved:         reserved,
 				}
+				reserved = 0
 				logrus.Debugf("send the protocolContent taskID: %s pieceNum: %d", task.ID, curPieceNum)
 
 				realFileLength += config.PieceWrapSize
 			}
+			cw.bufferBudget.release(reserved)
 			logrus.Infof("send all protocolContents with realFileLength(%d) and wait for superwriter", realFileLength)
 			break
 		}
 		if e != nil {
+			cw.bufferBudget.release(reserved)
+			// the pieces read before the failure are committed before it's returned
 			close(jobCh)
+			wg.Wait()
 			return nil, e
 		}
 	}
@@ -46,7 +46,7 @@ func (s *SuperWriterTestSuite) SetUpSuite(c *check.C) {
 	s.config = "baseDir: " + s.workHome
 	fileStore, err := store.NewStore(store.LocalStorageDriver, store.NewLocalStorage, s.config)
 	c.Check(err, check.IsNil)
-	s.writer = newSuperWriter(fileStore, nil)
+	s.writer = newSuperWriter(fileStore, nil, nil)
 }
 
 func (s *SuperWriterTestSuite) TearDownSuite(c *check.C) {
@@ -58,7 +58,10 @@ func (cw *superWriter) writerPool(ctx context.Context, wg *sync.WaitGroup, n int
 		go func(i int) {
 			for job := range jobCh {
 				var pieceMd5 = md5.New()
-				if err := cw.writeToFile(ctx, job.pieceContent, job.taskID, job.pieceNum, job.pieceContentSize, job.pieceSize, pieceMd5); err != nil {
+				err := cw.writeToFile(ctx, job.pieceContent, job.taskID, job.pieceNum, job.pieceContentSize, job.pieceSize, pieceMd5)
+				// the buffer of the piece is released once it's written
+				cw.bufferBudget.release(job.reserved)
+				if err != nil {
 					logrus.Errorf("failed to write taskID %s pieceNum %d file: %v", job.taskID, job.pieceNum, err)
 					// NOTE: should we redo the job?
 					continue
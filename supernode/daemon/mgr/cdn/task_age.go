@@ -0,0 +1,110 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// taskAgeReader aborts the download from the source when the task
+// has made no progress for the max task age since it was registered
+// or the last bytes were received from the source.
+type taskAgeReader struct {
+	reader io.ReadCloser
+	taskID string
+	maxAge time.Duration
+
+	// lastProgress is the unix nano time of the last progress.
+	lastProgress int64
+	expired      int32
+	done         chan struct{}
+}
+
+// newTaskAgeReader creates a reader of the response body of the source for task,
+// or returns the body itself if the max task age is disabled.
+// The caller should call stop after reading if a taskAgeReader is returned.
+func (cm *Manager) newTaskAgeReader(task *types.TaskInfo, body io.ReadCloser) io.ReadCloser {
+	if cm.cfg == nil || cm.cfg.BaseProperties == nil || cm.cfg.MaxTaskAge <= 0 {
+		return body
+	}
+
+	lastProgress := time.Time(task.CreateTime)
+	if lastProgress.IsZero() {
+		lastProgress = time.Now()
+	}
+	r := &taskAgeReader{
+		reader:       body,
+		taskID:       task.ID,
+		maxAge:       cm.cfg.MaxTaskAge,
+		lastProgress: lastProgress.UnixNano(),
+		done:         make(chan struct{}),
+	}
+	go r.watch()
+	return r
+}
+
+// Read reads the body and resets the age of the task when any bytes are received.
+func (r *taskAgeReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		atomic.StoreInt64(&r.lastProgress, time.Now().UnixNano())
+	}
+	if err != nil && err != io.EOF && atomic.LoadInt32(&r.expired) == 1 {
+		return n, errors.Wrapf(errortypes.ErrTaskExpired, "taskID: %s, no progress for %v", r.taskID, r.maxAge)
+	}
+	return n, err
+}
+
+// Close stops watching the age of the task and closes the body.
+func (r *taskAgeReader) Close() error {
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	return r.reader.Close()
+}
+
+// watch closes the body to abort the read blocking on the source
+// once the task has made no progress for the max task age.
+func (r *taskAgeReader) watch() {
+	for {
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&r.lastProgress)))
+		if idle >= r.maxAge {
+			logrus.Warnf("taskID: %s has made no progress for %v, abandon the download", r.taskID, idle)
+			atomic.StoreInt32(&r.expired, 1)
+			r.reader.Close()
+			return
+		}
+
+		timer := time.NewTimer(r.maxAge - idle)
+		select {
+		case <-r.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	strfmt "github.com/go-openapi/strfmt"
+)
+
+const taskAgeChunk = "hello dragonfly, "
+
+type TaskAgeTestSuite struct {
+	cdnFixture
+	server *httptest.Server
+}
+
+func init() {
+	check.Suite(&TaskAgeTestSuite{})
+}
+
+func (s *TaskAgeTestSuite) SetUpSuite(c *check.C) {
+	s.setUpFixture(c, "TaskAgeTestSuite")
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(10*len(taskAgeChunk)))
+		for i := 0; i < 10; i++ {
+			// the stuck source stops sending after the first chunk
+			if r.URL.Path == "/stuck" && i == 1 {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+				return
+			}
+			fmt.Fprint(w, taskAgeChunk)
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+}
+
+func (s *TaskAgeTestSuite) TearDownSuite(c *check.C) {
+	s.server.Close()
+	s.tearDownFixture(c)
+}
+
+func (s *TaskAgeTestSuite) triggerCDN(c *check.C, taskID, path string) (*types.TaskInfo, error) {
+	cfg := config.NewConfig()
+	cfg.MaxTaskAge = 200 * time.Millisecond
+	return s.trigger(c, cfg, &types.TaskInfo{
+		ID:             taskID,
+		RawURL:         s.server.URL + path,
+		TaskURL:        s.server.URL + path,
+		PieceSize:      1024 * 1024,
+		HTTPFileLength: int64(10 * len(taskAgeChunk)),
+		CreateTime:     strfmt.DateTime(time.Now()),
+	})
+}
+
+func (s *TaskAgeTestSuite) TestAbandonStuckTask(c *check.C) {
+	start := time.Now()
+	updateTaskInfo, err := s.triggerCDN(c, "taskAgeTaskID1", "/stuck")
+	c.Assert(errortypes.IsTaskExpired(err), check.Equals, true)
+	c.Check(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusFAILED)
+	c.Check(time.Since(start) < 5*time.Second, check.Equals, true)
+}
+
+func (s *TaskAgeTestSuite) TestProgressResetsTaskAge(c *check.C) {
+	// the download takes longer than the max task age but keeps advancing
+	updateTaskInfo, err := s.triggerCDN(c, "taskAgeTaskID2", "/slow")
+	c.Assert(err, check.IsNil)
+	c.Check(updateTaskInfo.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	c.Check(updateTaskInfo.FileLength, check.Equals, int64(10*len(taskAgeChunk))+config.PieceWrapSize)
+}
+
+func (s *TaskAgeTestSuite) TestDisabled(c *check.C) {
+	cm := &Manager{cfg: config.NewConfig()}
+	body := ioutil.NopCloser(strings.NewReader(taskAgeChunk))
+	c.Check(cm.newTaskAgeReader(&types.TaskInfo{ID: "taskAgeTaskID3"}, body), check.Equals, body)
+}
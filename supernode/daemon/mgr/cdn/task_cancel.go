@@ -0,0 +1,104 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"io"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Cancel aborts the CDN download of the task in progress.
+func (cm *Manager) Cancel(ctx context.Context, taskID string) error {
+	v, err := cm.cancels.Get(taskID)
+	if err != nil {
+		return err
+	}
+	cancel, ok := v.(context.CancelFunc)
+	if !ok {
+		return errors.Wrapf(errortypes.ErrConvertFailed, "taskID %s: %v", taskID, v)
+	}
+
+	cancel()
+	logrus.Infof("success to cancel the CDN download of taskID: %s", taskID)
+	return nil
+}
+
+// startCancelable returns the context of the CDN download of the task
+// which is canceled by Cancel, and the function to call when the download finishes.
+func (cm *Manager) startCancelable(taskID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cm.cancels.Add(taskID, cancel)
+	return ctx, func() {
+		cm.cancels.Delete(taskID)
+		cancel()
+	}
+}
+
+// cancelableReader aborts the download from the source when its context is canceled.
+type cancelableReader struct {
+	reader io.ReadCloser
+	taskID string
+	ctx    context.Context
+	done   chan struct{}
+}
+
+// newCancelableReader creates a reader of the response body of the source for the task
+// which is aborted once ctx is canceled. The caller should close it after reading.
+func newCancelableReader(ctx context.Context, taskID string, body io.ReadCloser) io.ReadCloser {
+	r := &cancelableReader{
+		reader: body,
+		taskID: taskID,
+		ctx:    ctx,
+		done:   make(chan struct{}),
+	}
+	go r.watch()
+	return r
+}
+
+// Read reads the body and returns ErrTaskCanceled if the read is aborted by the cancellation.
+func (r *cancelableReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF && r.ctx.Err() != nil {
+		return n, errors.Wrapf(errortypes.ErrTaskCanceled, "taskID: %s", r.taskID)
+	}
+	return n, err
+}
+
+// Close stops watching the cancellation and closes the body.
+func (r *cancelableReader) Close() error {
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	return r.reader.Close()
+}
+
+// watch closes the body to abort the read blocking on the source once ctx is canceled.
+func (r *cancelableReader) watch() {
+	select {
+	case <-r.done:
+	case <-r.ctx.Done():
+		logrus.Warnf("taskID: %s is canceled, abort the download", r.taskID)
+		r.reader.Close()
+	}
+}
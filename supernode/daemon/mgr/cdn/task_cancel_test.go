@@ -0,0 +1,56 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
+
+	"github.com/go-check/check"
+)
+
+type TaskCancelTestSuite struct{}
+
+func init() {
+	check.Suite(&TaskCancelTestSuite{})
+}
+
+func (s *TaskCancelTestSuite) TestCancel(c *check.C) {
+	cm := &Manager{cancels: syncmap.NewSyncMap()}
+	taskID := "taskCancelTaskID"
+
+	// the task whose CDN isn't running can't be canceled
+	c.Check(errortypes.IsDataNotFound(cm.Cancel(context.TODO(), taskID)), check.Equals, true)
+
+	ctx, done := cm.startCancelable(taskID)
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	reader := newCancelableReader(ctx, taskID, pr)
+	defer reader.Close()
+
+	// the read blocking on the source is aborted by the cancellation
+	c.Assert(cm.Cancel(context.TODO(), taskID), check.IsNil)
+	_, err := ioutil.ReadAll(reader)
+	c.Check(errortypes.IsTaskCanceled(err), check.Equals, true)
+
+	done()
+	c.Check(errortypes.IsDataNotFound(cm.Cancel(context.TODO(), taskID)), check.Equals, true)
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Merge replaces the downloaded file of the task with a link to the one of
+// the canonical task, so that the content is stored only once and the task
+// keeps its own meta data and piece md5s.
+// The readers which have opened the file of the task are not affected.
+func (cm *Manager) Merge(ctx context.Context, taskID, canonicalTaskID string) error {
+	if taskID == canonicalTaskID {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "taskID %s is merged into itself", taskID)
+	}
+
+	cm.cdnLocker.GetLock(canonicalTaskID, true)
+	defer cm.cdnLocker.ReleaseLock(canonicalTaskID, true)
+	cm.cdnLocker.GetLock(taskID, false)
+	defer cm.cdnLocker.ReleaseLock(taskID, false)
+
+	metaData, err := cm.metaDataManager.readFileMetaData(ctx, taskID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read meta data of taskID %s", taskID)
+	}
+	canonicalMetaData, err := cm.metaDataManager.readFileMetaData(ctx, canonicalTaskID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read meta data of taskID %s", canonicalTaskID)
+	}
+	if !isSameContent(metaData, canonicalMetaData) {
+		return errors.Wrapf(errortypes.ErrInvalidValue,
+			"content of taskID %s differs from the one of taskID %s", taskID, canonicalTaskID)
+	}
+
+	if err := cm.cacheStore.Link(ctx, getDownloadRawFunc(canonicalTaskID), getDownloadRawFunc(taskID)); err != nil {
+		return err
+	}
+	logrus.Infof("success to merge the file of taskID %s into taskID %s", taskID, canonicalTaskID)
+	return nil
+}
+
+// isSameContent returns whether the files of the meta data are downloaded
+// successfully and stored in the same layout of pieces.
+func isSameContent(metaData, canonicalMetaData *fileMetaData) bool {
+	return metaData.Finish && metaData.Success &&
+		canonicalMetaData.Finish && canonicalMetaData.Success &&
+		!stringutils.IsEmptyStr(metaData.RealMd5) &&
+		metaData.RealMd5 == canonicalMetaData.RealMd5 &&
+		metaData.FileLength == canonicalMetaData.FileLength &&
+		metaData.PieceSize == canonicalMetaData.PieceSize
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Pause aborts the CDN download of the task in progress and keeps the pieces downloaded.
+// The origin concurrency held by the download is released once it's aborted.
+func (cm *Manager) Pause(ctx context.Context, taskID string) error {
+	cm.pauses.Add(taskID, true)
+	if err := cm.Cancel(ctx, taskID); err != nil {
+		cm.pauses.Delete(taskID)
+		return err
+	}
+	logrus.Infof("success to pause the CDN download of taskID: %s", taskID)
+	return nil
+}
+
+// takePause returns whether the CDN download of the task has been paused,
+// and clears the pause so that the next download of the task isn't affected.
+func (cm *Manager) takePause(taskID string) bool {
+	if _, err := cm.pauses.Get(taskID); err != nil {
+		return false
+	}
+	cm.pauses.Delete(taskID)
+	return true
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdn
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
+
+	"github.com/go-check/check"
+)
+
+type TaskPauseTestSuite struct{}
+
+func init() {
+	check.Suite(&TaskPauseTestSuite{})
+}
+
+func (s *TaskPauseTestSuite) TestPause(c *check.C) {
+	cm := &Manager{cancels: syncmap.NewSyncMap(), pauses: syncmap.NewSyncMap()}
+	taskID := "taskPauseTaskID"
+
+	// the task whose CDN isn't running can't be paused
+	c.Check(errortypes.IsDataNotFound(cm.Pause(context.TODO(), taskID)), check.Equals, true)
+	c.Check(cm.takePause(taskID), check.Equals, false)
+
+	ctx, done := cm.startCancelable(taskID)
+	defer done()
+	c.Assert(cm.Pause(context.TODO(), taskID), check.IsNil)
+	c.Check(ctx.Err(), check.NotNil)
+
+	// the pause is taken only once
+	c.Check(cm.takePause(taskID), check.Equals, true)
+	c.Check(cm.takePause(taskID), check.Equals, false)
+}
@@ -18,10 +18,32 @@ package mgr
 
 import (
 	"context"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
 )
 
+// Content is the content of a file downloaded by supernode, which is the same as the source file.
+type Content struct {
+	store.File
+
+	// LastModified is the Last-Modified of the source file in milliseconds.
+	LastModified int64
+
+	// ETag is the ETag of the source file.
+	ETag string
+
+	// CacheControl is the Cache-Control of the source file.
+	CacheControl string
+
+	// Expires is the Expires of the source file.
+	Expires string
+
+	// ResponseTime is the time in milliseconds when the source responded the file.
+	ResponseTime int64
+}
+
 // CDNMgr as an interface defines all operations against CDN and
 // operates on the underlying files stored on the local disk, etc.
 type CDNMgr interface {
@@ -38,9 +60,76 @@ type CDNMgr interface {
 	// GetHTTPPath returns the http download path of taskID.
 	GetHTTPPath(ctx context.Context, taskID string) (path string, err error)
 
+	// OpenFile opens the downloaded file of taskID for reading at random offsets,
+	// which is in the same form as the file served with the http download path.
+	// The caller should close the file after reading.
+	OpenFile(ctx context.Context, taskID string) (store.File, error)
+
+	// OpenContent opens the content of the file of taskID without the header and the trailer
+	// of each piece for reading at random offsets, which is the same as the source file.
+	// Only the file which has been downloaded successfully can be opened.
+	// The caller should close the content after reading.
+	OpenContent(ctx context.Context, taskID string) (*Content, error)
+
+	// OpenPartialContent opens the content of the file of taskID like OpenContent, and the file
+	// being downloaded can be opened as well, whose pieces known to be downloaded can be read.
+	// The caller should close the content after reading.
+	OpenPartialContent(ctx context.Context, taskID string) (*Content, error)
+
+	// GetPieceSize returns the piece size recorded for the task whose file
+	// has been downloaded before, or 0 if there is no record of the same file.
+	// A task should always keep its recorded piece size to resume the downloaded pieces.
+	GetPieceSize(ctx context.Context, task *types.TaskInfo) (int32, error)
+
 	// GetStatus get the status of the file.
 	GetStatus(ctx context.Context, taskID string) (cdnStatus string, err error)
 
 	// Delete the file from disk with specified taskID.
 	Delete(ctx context.Context, taskID string) error
+
+	// Revalidate revalidates the file of the task which has been downloaded successfully
+	// with the source by the conditional request regardless of its freshness,
+	// and returns whether the source responded that it's not modified.
+	Revalidate(ctx context.Context, task *types.TaskInfo) (bool, error)
+
+	// Cancel aborts the CDN download of the task in progress, and the TriggerCDN
+	// of the task fails with ErrTaskCanceled. The ErrDataNotFound is returned
+	// if the task is not being downloaded.
+	Cancel(ctx context.Context, taskID string) error
+
+	// Pause aborts the CDN download of the task in progress like Cancel, but keeps
+	// the pieces downloaded so that the download is resumed by the next TriggerCDN.
+	// The TriggerCDN of the task fails with ErrTaskPaused.
+	Pause(ctx context.Context, taskID string) error
+
+	// VerifyFile verifies the downloaded file of the task against the piece md5s recorded
+	// when the pieces were downloaded, and returns the ErrContentCorrupted if any piece differs.
+	VerifyFile(ctx context.Context, taskID string) error
+
+	// ReclaimOrphans removes the files stored for the tasks which are not known by isKnown and
+	// can't be reused either, such as the file without its metadata left over by a crash.
+	// The files modified within the gracePeriod are kept, and it returns the number
+	// of the files removed and their bytes.
+	ReclaimOrphans(ctx context.Context, gracePeriod time.Duration, isKnown func(taskID string) bool) (files int, bytes int64, err error)
+
+	// Merge makes the downloaded file of the task share the one of the canonical task
+	// whose content is the same, so that only one copy of the content is stored.
+	// Both of the tasks should have been downloaded successfully.
+	Merge(ctx context.Context, taskID, canonicalTaskID string) error
+
+	// GetOriginConcurrency returns the max number of files downloaded from all the sources
+	// at the same time, which is 0 if unlimited, and the number of files being downloaded.
+	GetOriginConcurrency(ctx context.Context) (limit, inFlight int)
+
+	// GetOriginQueueDepth returns the number of the downloads waiting for
+	// the concurrency limits of the sources.
+	GetOriginQueueDepth(ctx context.Context) int
+
+	// SetOriginConcurrency changes the max number of files downloaded from all the sources
+	// at the same time, and the limit is disabled if it's not greater than 0.
+	// The downloads in flight are never interrupted by a reduced limit.
+	SetOriginConcurrency(ctx context.Context, limit int)
+
+	// GetStorageDriver returns the name of the storage driver which the files are stored in.
+	GetStorageDriver(ctx context.Context) string
 }
@@ -120,8 +120,25 @@ func (dtm *Manager) GetCIDByPeerIDAndTaskID(ctx context.Context, peerID, taskID
 }
 
 // List returns the list of dfgetTask.
+// The filter supports the keys "taskID" and "status" which should be equal to
+// the corresponding fields of the returned dfgetTasks, and it returns all if the filter is empty.
 func (dtm *Manager) List(ctx context.Context, filter map[string]string) (dfgetTaskList []*types.DfGetTask, err error) {
-	return nil, nil
+	dfgetTaskList = make([]*types.DfGetTask, 0)
+	for _, v := range dtm.dfgetTaskStore.List() {
+		dfgetTask, ok := v.(*types.DfGetTask)
+		if !ok {
+			return nil, errors.Wrapf(errortypes.ErrConvertFailed, "value: %v", v)
+		}
+
+		if taskID, ok := filter["taskID"]; ok && dfgetTask.TaskID != taskID {
+			continue
+		}
+		if status, ok := filter["status"]; ok && dfgetTask.Status != status {
+			continue
+		}
+		dfgetTaskList = append(dfgetTaskList, dfgetTask)
+	}
+	return dfgetTaskList, nil
 }
 
 // Delete a dfgetTask with clientID and taskID.
@@ -233,3 +233,30 @@ func (s *DfgetTaskMgrTestSuite) TestDfgetTaskDelete(c *check.C) {
 		c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
 	}
 }
+
+func (s *DfgetTaskMgrTestSuite) TestDfgetTaskList(c *check.C) {
+	manager, _ := NewManager(s.cfg, prometheus.NewRegistry())
+	for _, dfgetTask := range []*types.DfGetTask{
+		{CID: "foo", CallSystem: "foo", Path: "/peer/file/1", PieceSize: 4 * 1024 * 1024, TaskID: "test1", PeerID: "peer1"},
+		{CID: "bar", CallSystem: "foo", Path: "/peer/file/1", PieceSize: 4 * 1024 * 1024, TaskID: "test1", PeerID: "peer2"},
+		{CID: "foo", CallSystem: "foo", Path: "/peer/file/2", PieceSize: 4 * 1024 * 1024, TaskID: "test2", PeerID: "peer1"},
+	} {
+		err := manager.Add(context.Background(), dfgetTask)
+		c.Check(err, check.IsNil)
+	}
+
+	dfgetTasks, err := manager.List(context.Background(), nil)
+	c.Check(err, check.IsNil)
+	c.Check(dfgetTasks, check.HasLen, 3)
+
+	dfgetTasks, err = manager.List(context.Background(), map[string]string{"taskID": "test1"})
+	c.Check(err, check.IsNil)
+	c.Check(dfgetTasks, check.HasLen, 2)
+	for _, dfgetTask := range dfgetTasks {
+		c.Check(dfgetTask.TaskID, check.Equals, "test1")
+	}
+
+	dfgetTasks, err = manager.List(context.Background(), map[string]string{"taskID": "test3"})
+	c.Check(err, check.IsNil)
+	c.Check(dfgetTasks, check.HasLen, 0)
+}
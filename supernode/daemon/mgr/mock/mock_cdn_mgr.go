@@ -7,10 +7,13 @@ package mock
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 
 	types "github.com/dragonflyoss/Dragonfly/apis/types"
+	mgr "github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	store "github.com/dragonflyoss/Dragonfly/supernode/store"
 )
 
 // MockCDNMgr is a mock of CDNMgr interface
@@ -66,6 +69,66 @@ func (mr *MockCDNMgrMockRecorder) GetHTTPPath(ctx, taskID interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHTTPPath", reflect.TypeOf((*MockCDNMgr)(nil).GetHTTPPath), ctx, taskID)
 }
 
+// OpenFile mocks base method
+func (m *MockCDNMgr) OpenFile(ctx context.Context, taskID string) (store.File, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenFile", ctx, taskID)
+	ret0, _ := ret[0].(store.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenFile indicates an expected call of OpenFile
+func (mr *MockCDNMgrMockRecorder) OpenFile(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenFile", reflect.TypeOf((*MockCDNMgr)(nil).OpenFile), ctx, taskID)
+}
+
+// OpenContent mocks base method
+func (m *MockCDNMgr) OpenContent(ctx context.Context, taskID string) (*mgr.Content, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenContent", ctx, taskID)
+	ret0, _ := ret[0].(*mgr.Content)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenContent indicates an expected call of OpenContent
+func (mr *MockCDNMgrMockRecorder) OpenContent(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenContent", reflect.TypeOf((*MockCDNMgr)(nil).OpenContent), ctx, taskID)
+}
+
+// OpenPartialContent mocks base method
+func (m *MockCDNMgr) OpenPartialContent(ctx context.Context, taskID string) (*mgr.Content, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenPartialContent", ctx, taskID)
+	ret0, _ := ret[0].(*mgr.Content)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenPartialContent indicates an expected call of OpenPartialContent
+func (mr *MockCDNMgrMockRecorder) OpenPartialContent(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenPartialContent", reflect.TypeOf((*MockCDNMgr)(nil).OpenPartialContent), ctx, taskID)
+}
+
+// GetPieceSize mocks base method
+func (m *MockCDNMgr) GetPieceSize(ctx context.Context, task *types.TaskInfo) (int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPieceSize", ctx, task)
+	ret0, _ := ret[0].(int32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPieceSize indicates an expected call of GetPieceSize
+func (mr *MockCDNMgrMockRecorder) GetPieceSize(ctx, task interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPieceSize", reflect.TypeOf((*MockCDNMgr)(nil).GetPieceSize), ctx, task)
+}
+
 // GetStatus mocks base method
 func (m *MockCDNMgr) GetStatus(ctx context.Context, taskID string) (string, error) {
 	m.ctrl.T.Helper()
@@ -94,3 +157,145 @@ func (mr *MockCDNMgrMockRecorder) Delete(ctx, taskID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCDNMgr)(nil).Delete), ctx, taskID)
 }
+
+// Revalidate mocks base method
+func (m *MockCDNMgr) Revalidate(ctx context.Context, task *types.TaskInfo) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revalidate", ctx, task)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Revalidate indicates an expected call of Revalidate
+func (mr *MockCDNMgrMockRecorder) Revalidate(ctx, task interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revalidate", reflect.TypeOf((*MockCDNMgr)(nil).Revalidate), ctx, task)
+}
+
+// Cancel mocks base method
+func (m *MockCDNMgr) Cancel(ctx context.Context, taskID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cancel", ctx, taskID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Cancel indicates an expected call of Cancel
+func (mr *MockCDNMgrMockRecorder) Cancel(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cancel", reflect.TypeOf((*MockCDNMgr)(nil).Cancel), ctx, taskID)
+}
+
+// Pause mocks base method
+func (m *MockCDNMgr) Pause(ctx context.Context, taskID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pause", ctx, taskID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Pause indicates an expected call of Pause
+func (mr *MockCDNMgrMockRecorder) Pause(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockCDNMgr)(nil).Pause), ctx, taskID)
+}
+
+// VerifyFile mocks base method
+func (m *MockCDNMgr) VerifyFile(ctx context.Context, taskID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyFile", ctx, taskID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyFile indicates an expected call of VerifyFile
+func (mr *MockCDNMgrMockRecorder) VerifyFile(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyFile", reflect.TypeOf((*MockCDNMgr)(nil).VerifyFile), ctx, taskID)
+}
+
+// ReclaimOrphans mocks base method
+func (m *MockCDNMgr) ReclaimOrphans(ctx context.Context, gracePeriod time.Duration, isKnown func(string) bool) (int, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReclaimOrphans", ctx, gracePeriod, isKnown)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReclaimOrphans indicates an expected call of ReclaimOrphans
+func (mr *MockCDNMgrMockRecorder) ReclaimOrphans(ctx, gracePeriod, isKnown interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReclaimOrphans", reflect.TypeOf((*MockCDNMgr)(nil).ReclaimOrphans), ctx, gracePeriod, isKnown)
+}
+
+// Merge mocks base method
+func (m *MockCDNMgr) Merge(ctx context.Context, taskID, canonicalTaskID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Merge", ctx, taskID, canonicalTaskID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Merge indicates an expected call of Merge
+func (mr *MockCDNMgrMockRecorder) Merge(ctx, taskID, canonicalTaskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Merge", reflect.TypeOf((*MockCDNMgr)(nil).Merge), ctx, taskID, canonicalTaskID)
+}
+
+// GetOriginConcurrency mocks base method
+func (m *MockCDNMgr) GetOriginConcurrency(ctx context.Context) (int, int) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOriginConcurrency", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	return ret0, ret1
+}
+
+// GetOriginConcurrency indicates an expected call of GetOriginConcurrency
+func (mr *MockCDNMgrMockRecorder) GetOriginConcurrency(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOriginConcurrency", reflect.TypeOf((*MockCDNMgr)(nil).GetOriginConcurrency), ctx)
+}
+
+// GetOriginQueueDepth mocks base method
+func (m *MockCDNMgr) GetOriginQueueDepth(ctx context.Context) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOriginQueueDepth", ctx)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetOriginQueueDepth indicates an expected call of GetOriginQueueDepth
+func (mr *MockCDNMgrMockRecorder) GetOriginQueueDepth(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOriginQueueDepth", reflect.TypeOf((*MockCDNMgr)(nil).GetOriginQueueDepth), ctx)
+}
+
+// SetOriginConcurrency mocks base method
+func (m *MockCDNMgr) SetOriginConcurrency(ctx context.Context, limit int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetOriginConcurrency", ctx, limit)
+}
+
+// SetOriginConcurrency indicates an expected call of SetOriginConcurrency
+func (mr *MockCDNMgrMockRecorder) SetOriginConcurrency(ctx, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOriginConcurrency", reflect.TypeOf((*MockCDNMgr)(nil).SetOriginConcurrency), ctx, limit)
+}
+
+// GetStorageDriver mocks base method
+func (m *MockCDNMgr) GetStorageDriver(ctx context.Context) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStorageDriver", ctx)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetStorageDriver indicates an expected call of GetStorageDriver
+func (mr *MockCDNMgrMockRecorder) GetStorageDriver(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStorageDriver", reflect.TypeOf((*MockCDNMgr)(nil).GetStorageDriver), ctx)
+}
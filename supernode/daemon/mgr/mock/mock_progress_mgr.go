@@ -7,6 +7,7 @@ package mock
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 
@@ -52,18 +53,33 @@ func (mr *MockProgressMgrMockRecorder) InitProgress(ctx, taskID, peerID, clientI
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitProgress", reflect.TypeOf((*MockProgressMgr)(nil).InitProgress), ctx, taskID, peerID, clientID)
 }
 
+// RebindProgress mocks base method
+func (m *MockProgressMgr) RebindProgress(ctx context.Context, taskID, peerID, clientID, identity string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RebindProgress", ctx, taskID, peerID, clientID, identity)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RebindProgress indicates an expected call of RebindProgress
+func (mr *MockProgressMgrMockRecorder) RebindProgress(ctx, taskID, peerID, clientID, identity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RebindProgress", reflect.TypeOf((*MockProgressMgr)(nil).RebindProgress), ctx, taskID, peerID, clientID, identity)
+}
+
 // UpdateProgress mocks base method
-func (m *MockProgressMgr) UpdateProgress(ctx context.Context, taskID, srcCID, srcPID, dstPID string, pieceNum, pieceStatus int) error {
+func (m *MockProgressMgr) UpdateProgress(ctx context.Context, taskID, srcCID, srcPID, dstPID string, pieceNum, pieceStatus int, pieceSize int32) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateProgress", ctx, taskID, srcCID, srcPID, dstPID, pieceNum, pieceStatus)
+	ret := m.ctrl.Call(m, "UpdateProgress", ctx, taskID, srcCID, srcPID, dstPID, pieceNum, pieceStatus, pieceSize)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateProgress indicates an expected call of UpdateProgress
-func (mr *MockProgressMgrMockRecorder) UpdateProgress(ctx, taskID, srcCID, srcPID, dstPID, pieceNum, pieceStatus interface{}) *gomock.Call {
+func (mr *MockProgressMgrMockRecorder) UpdateProgress(ctx, taskID, srcCID, srcPID, dstPID, pieceNum, pieceStatus, pieceSize interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProgress", reflect.TypeOf((*MockProgressMgr)(nil).UpdateProgress), ctx, taskID, srcCID, srcPID, dstPID, pieceNum, pieceStatus)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProgress", reflect.TypeOf((*MockProgressMgr)(nil).UpdateProgress), ctx, taskID, srcCID, srcPID, dstPID, pieceNum, pieceStatus, pieceSize)
 }
 
 // UpdateClientProgress mocks base method
@@ -109,6 +125,20 @@ func (mr *MockProgressMgrMockRecorder) DeletePieceProgressByCID(ctx, taskID, cli
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePieceProgressByCID", reflect.TypeOf((*MockProgressMgr)(nil).DeletePieceProgressByCID), ctx, taskID, clientID)
 }
 
+// DeleteProgressByTaskID mocks base method
+func (m *MockProgressMgr) DeleteProgressByTaskID(ctx context.Context, taskID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteProgressByTaskID", ctx, taskID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteProgressByTaskID indicates an expected call of DeleteProgressByTaskID
+func (mr *MockProgressMgrMockRecorder) DeleteProgressByTaskID(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProgressByTaskID", reflect.TypeOf((*MockProgressMgr)(nil).DeleteProgressByTaskID), ctx, taskID)
+}
+
 // GetPeerIDsByPieceNum mocks base method
 func (m *MockProgressMgr) GetPeerIDsByPieceNum(ctx context.Context, taskID string, pieceNum int) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -153,6 +183,21 @@ func (mr *MockProgressMgrMockRecorder) GetPeerStateByPeerID(ctx, peerID interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeerStateByPeerID", reflect.TypeOf((*MockProgressMgr)(nil).GetPeerStateByPeerID), ctx, peerID)
 }
 
+// GetPeerSources mocks base method
+func (m *MockProgressMgr) GetPeerSources(ctx context.Context, peerID string) ([]*mgr.PeerSource, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPeerSources", ctx, peerID)
+	ret0, _ := ret[0].([]*mgr.PeerSource)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPeerSources indicates an expected call of GetPeerSources
+func (mr *MockProgressMgrMockRecorder) GetPeerSources(ctx, peerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeerSources", reflect.TypeOf((*MockProgressMgr)(nil).GetPeerSources), ctx, peerID)
+}
+
 // DeletePeerStateByPeerID mocks base method
 func (m *MockProgressMgr) DeletePeerStateByPeerID(ctx context.Context, peerID string) error {
 	m.ctrl.T.Helper()
@@ -196,3 +241,252 @@ func (mr *MockProgressMgrMockRecorder) GetBlackInfoByPeerID(ctx, peerID interfac
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlackInfoByPeerID", reflect.TypeOf((*MockProgressMgr)(nil).GetBlackInfoByPeerID), ctx, peerID)
 }
+
+// UpdateSuperPieceMD5 mocks base method
+func (m *MockProgressMgr) UpdateSuperPieceMD5(ctx context.Context, taskID string, pieceNum int, pieceMD5 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSuperPieceMD5", ctx, taskID, pieceNum, pieceMD5)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSuperPieceMD5 indicates an expected call of UpdateSuperPieceMD5
+func (mr *MockProgressMgrMockRecorder) UpdateSuperPieceMD5(ctx, taskID, pieceNum, pieceMD5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSuperPieceMD5", reflect.TypeOf((*MockProgressMgr)(nil).UpdateSuperPieceMD5), ctx, taskID, pieceNum, pieceMD5)
+}
+
+// GetPieceProof mocks base method
+func (m *MockProgressMgr) GetPieceProof(ctx context.Context, taskID string, pieceNum int) (*mgr.PieceProof, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPieceProof", ctx, taskID, pieceNum)
+	ret0, _ := ret[0].(*mgr.PieceProof)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPieceProof indicates an expected call of GetPieceProof
+func (mr *MockProgressMgrMockRecorder) GetPieceProof(ctx, taskID, pieceNum interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPieceProof", reflect.TypeOf((*MockProgressMgr)(nil).GetPieceProof), ctx, taskID, pieceNum)
+}
+
+// GetSuperPieceMD5s mocks base method
+func (m *MockProgressMgr) GetSuperPieceMD5s(ctx context.Context, taskID string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSuperPieceMD5s", ctx, taskID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSuperPieceMD5s indicates an expected call of GetSuperPieceMD5s
+func (mr *MockProgressMgrMockRecorder) GetSuperPieceMD5s(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSuperPieceMD5s", reflect.TypeOf((*MockProgressMgr)(nil).GetSuperPieceMD5s), ctx, taskID)
+}
+
+// GetFirstPieceTime mocks base method
+func (m *MockProgressMgr) GetFirstPieceTime(ctx context.Context, taskID string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFirstPieceTime", ctx, taskID)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFirstPieceTime indicates an expected call of GetFirstPieceTime
+func (mr *MockProgressMgrMockRecorder) GetFirstPieceTime(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFirstPieceTime", reflect.TypeOf((*MockProgressMgr)(nil).GetFirstPieceTime), ctx, taskID)
+}
+
+// GetTaskServedBytes mocks base method
+func (m *MockProgressMgr) GetTaskServedBytes(ctx context.Context, taskID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTaskServedBytes", ctx, taskID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTaskServedBytes indicates an expected call of GetTaskServedBytes
+func (mr *MockProgressMgrMockRecorder) GetTaskServedBytes(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTaskServedBytes", reflect.TypeOf((*MockProgressMgr)(nil).GetTaskServedBytes), ctx, taskID)
+}
+
+// GetSwarmHealth mocks base method
+func (m *MockProgressMgr) GetSwarmHealth(ctx context.Context, taskID string, pieceTotal int) (*mgr.SwarmHealth, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSwarmHealth", ctx, taskID, pieceTotal)
+	ret0, _ := ret[0].(*mgr.SwarmHealth)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSwarmHealth indicates an expected call of GetSwarmHealth
+func (mr *MockProgressMgrMockRecorder) GetSwarmHealth(ctx, taskID, pieceTotal interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSwarmHealth", reflect.TypeOf((*MockProgressMgr)(nil).GetSwarmHealth), ctx, taskID, pieceTotal)
+}
+
+// RecordCacheResult mocks base method
+func (m *MockProgressMgr) RecordCacheResult(ctx context.Context, taskID, result string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordCacheResult", ctx, taskID, result)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordCacheResult indicates an expected call of RecordCacheResult
+func (mr *MockProgressMgrMockRecorder) RecordCacheResult(ctx, taskID, result interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordCacheResult", reflect.TypeOf((*MockProgressMgr)(nil).RecordCacheResult), ctx, taskID, result)
+}
+
+// GetCacheStats mocks base method
+func (m *MockProgressMgr) GetCacheStats(ctx context.Context, taskID string) (*mgr.CacheStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCacheStats", ctx, taskID)
+	ret0, _ := ret[0].(*mgr.CacheStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCacheStats indicates an expected call of GetCacheStats
+func (mr *MockProgressMgrMockRecorder) GetCacheStats(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheStats", reflect.TypeOf((*MockProgressMgr)(nil).GetCacheStats), ctx, taskID)
+}
+
+// CancelStalledPieces mocks base method
+func (m *MockProgressMgr) CancelStalledPieces(ctx context.Context, taskID, clientID, peerID string) (map[int]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelStalledPieces", ctx, taskID, clientID, peerID)
+	ret0, _ := ret[0].(map[int]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelStalledPieces indicates an expected call of CancelStalledPieces
+func (mr *MockProgressMgrMockRecorder) CancelStalledPieces(ctx, taskID, clientID, peerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelStalledPieces", reflect.TypeOf((*MockProgressMgr)(nil).CancelStalledPieces), ctx, taskID, clientID, peerID)
+}
+
+// CancelPeerPieces mocks base method
+func (m *MockProgressMgr) CancelPeerPieces(ctx context.Context, taskID, clientID string) (map[int]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelPeerPieces", ctx, taskID, clientID)
+	ret0, _ := ret[0].(map[int]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelPeerPieces indicates an expected call of CancelPeerPieces
+func (mr *MockProgressMgrMockRecorder) CancelPeerPieces(ctx, taskID, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelPeerPieces", reflect.TypeOf((*MockProgressMgr)(nil).CancelPeerPieces), ctx, taskID, clientID)
+}
+
+// GetSuperConsecutivePieces mocks base method
+func (m *MockProgressMgr) GetSuperConsecutivePieces(ctx context.Context, taskID string, pieceNum int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSuperConsecutivePieces", ctx, taskID, pieceNum)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSuperConsecutivePieces indicates an expected call of GetSuperConsecutivePieces
+func (mr *MockProgressMgrMockRecorder) GetSuperConsecutivePieces(ctx, taskID, pieceNum interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSuperConsecutivePieces", reflect.TypeOf((*MockProgressMgr)(nil).GetSuperConsecutivePieces), ctx, taskID, pieceNum)
+}
+
+// GetSuperPieceCount mocks base method
+func (m *MockProgressMgr) GetSuperPieceCount(ctx context.Context, taskID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSuperPieceCount", ctx, taskID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSuperPieceCount indicates an expected call of GetSuperPieceCount
+func (mr *MockProgressMgrMockRecorder) GetSuperPieceCount(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSuperPieceCount", reflect.TypeOf((*MockProgressMgr)(nil).GetSuperPieceCount), ctx, taskID)
+}
+
+// WatchTask mocks base method
+func (m *MockProgressMgr) WatchTask(ctx context.Context, taskID string) (<-chan struct{}, func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WatchTask", ctx, taskID)
+	ret0, _ := ret[0].(<-chan struct{})
+	ret1, _ := ret[1].(func())
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// WatchTask indicates an expected call of WatchTask
+func (mr *MockProgressMgrMockRecorder) WatchTask(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WatchTask", reflect.TypeOf((*MockProgressMgr)(nil).WatchTask), ctx, taskID)
+}
+
+// NotifyTask mocks base method
+func (m *MockProgressMgr) NotifyTask(ctx context.Context, taskID string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "NotifyTask", ctx, taskID)
+}
+
+// NotifyTask indicates an expected call of NotifyTask
+func (mr *MockProgressMgrMockRecorder) NotifyTask(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NotifyTask", reflect.TypeOf((*MockProgressMgr)(nil).NotifyTask), ctx, taskID)
+}
+
+// GetTaskVersion mocks base method
+func (m *MockProgressMgr) GetTaskVersion(ctx context.Context, taskID string) int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTaskVersion", ctx, taskID)
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// GetTaskVersion indicates an expected call of GetTaskVersion
+func (mr *MockProgressMgrMockRecorder) GetTaskVersion(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTaskVersion", reflect.TypeOf((*MockProgressMgr)(nil).GetTaskVersion), ctx, taskID)
+}
+
+// RecordTaskEvent mocks base method
+func (m *MockProgressMgr) RecordTaskEvent(ctx context.Context, taskID, eventType, detail string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordTaskEvent", ctx, taskID, eventType, detail)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordTaskEvent indicates an expected call of RecordTaskEvent
+func (mr *MockProgressMgrMockRecorder) RecordTaskEvent(ctx, taskID, eventType, detail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordTaskEvent", reflect.TypeOf((*MockProgressMgr)(nil).RecordTaskEvent), ctx, taskID, eventType, detail)
+}
+
+// GetTaskEvents mocks base method
+func (m *MockProgressMgr) GetTaskEvents(ctx context.Context, taskID string) ([]*mgr.TaskEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTaskEvents", ctx, taskID)
+	ret0, _ := ret[0].([]*mgr.TaskEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTaskEvents indicates an expected call of GetTaskEvents
+func (mr *MockProgressMgrMockRecorder) GetTaskEvents(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTaskEvents", reflect.TypeOf((*MockProgressMgr)(nil).GetTaskEvents), ctx, taskID)
+}
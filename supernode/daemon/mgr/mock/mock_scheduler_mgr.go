@@ -10,6 +10,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 
+	types "github.com/dragonflyoss/Dragonfly/apis/types"
 	mgr "github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 )
 
@@ -37,16 +38,72 @@ func (m *MockSchedulerMgr) EXPECT() *MockSchedulerMgrMockRecorder {
 }
 
 // Schedule mocks base method
-func (m *MockSchedulerMgr) Schedule(ctx context.Context, taskID, clientID, peerID string) ([]*mgr.PieceResult, error) {
+func (m *MockSchedulerMgr) Schedule(ctx context.Context, taskID, clientID, peerID, pieceOrder string) ([]*mgr.PieceResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Schedule", ctx, taskID, clientID, peerID)
+	ret := m.ctrl.Call(m, "Schedule", ctx, taskID, clientID, peerID, pieceOrder)
 	ret0, _ := ret[0].([]*mgr.PieceResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Schedule indicates an expected call of Schedule
-func (mr *MockSchedulerMgrMockRecorder) Schedule(ctx, taskID, clientID, peerID interface{}) *gomock.Call {
+func (mr *MockSchedulerMgrMockRecorder) Schedule(ctx, taskID, clientID, peerID, pieceOrder interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schedule", reflect.TypeOf((*MockSchedulerMgr)(nil).Schedule), ctx, taskID, clientID, peerID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schedule", reflect.TypeOf((*MockSchedulerMgr)(nil).Schedule), ctx, taskID, clientID, peerID, pieceOrder)
+}
+
+// WarmHandoff mocks base method
+func (m *MockSchedulerMgr) WarmHandoff(ctx context.Context, taskID string, clientIDs []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WarmHandoff", ctx, taskID, clientIDs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WarmHandoff indicates an expected call of WarmHandoff
+func (mr *MockSchedulerMgrMockRecorder) WarmHandoff(ctx, taskID, clientIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WarmHandoff", reflect.TypeOf((*MockSchedulerMgr)(nil).WarmHandoff), ctx, taskID, clientIDs)
+}
+
+// SetSafeMode mocks base method
+func (m *MockSchedulerMgr) SetSafeMode(ctx context.Context, enabled, cutPeerTransfers bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetSafeMode", ctx, enabled, cutPeerTransfers)
+}
+
+// SetSafeMode indicates an expected call of SetSafeMode
+func (mr *MockSchedulerMgrMockRecorder) SetSafeMode(ctx, enabled, cutPeerTransfers interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSafeMode", reflect.TypeOf((*MockSchedulerMgr)(nil).SetSafeMode), ctx, enabled, cutPeerTransfers)
+}
+
+// GetSafeMode mocks base method
+func (m *MockSchedulerMgr) GetSafeMode(ctx context.Context) (bool, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSafeMode", ctx)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetSafeMode indicates an expected call of GetSafeMode
+func (mr *MockSchedulerMgrMockRecorder) GetSafeMode(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSafeMode", reflect.TypeOf((*MockSchedulerMgr)(nil).GetSafeMode), ctx)
+}
+
+// Explain mocks base method
+func (m *MockSchedulerMgr) Explain(ctx context.Context, taskID, clientID string, pieceNum int) (*types.SchedulerDecision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Explain", ctx, taskID, clientID, pieceNum)
+	ret0, _ := ret[0].(*types.SchedulerDecision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Explain indicates an expected call of Explain
+func (mr *MockSchedulerMgrMockRecorder) Explain(ctx, taskID, clientID, pieceNum interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Explain", reflect.TypeOf((*MockSchedulerMgr)(nil).Explain), ctx, taskID, clientID, pieceNum)
 }
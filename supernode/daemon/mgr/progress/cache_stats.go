@@ -0,0 +1,64 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+)
+
+// RecordCacheResult records the result of looking up the cache of the task
+// into the counts of the task and the metrics.
+func (pm *Manager) RecordCacheResult(ctx context.Context, taskID, result string) error {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return err
+	}
+
+	var count *int64
+	switch result {
+	case mgr.CacheHit:
+		count = &ss.cacheHits
+	case mgr.CacheRevalidationHit:
+		count = &ss.cacheRevalidationHits
+	case mgr.CacheMiss:
+		count = &ss.cacheMisses
+	default:
+		return errors.Wrapf(errortypes.ErrInvalidValue, "cache result: %s", result)
+	}
+	atomic.AddInt64(count, 1)
+	pm.metrics.cacheResults.WithLabelValues(result).Inc()
+	return nil
+}
+
+// GetCacheStats gets the counts of the results of looking up the cache of the task.
+func (pm *Manager) GetCacheStats(ctx context.Context, taskID string) (*mgr.CacheStats, error) {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return nil, err
+	}
+	return &mgr.CacheStats{
+		Hits:             atomic.LoadInt64(&ss.cacheHits),
+		RevalidationHits: atomic.LoadInt64(&ss.cacheRevalidationHits),
+		Misses:           atomic.LoadInt64(&ss.cacheMisses),
+	}, nil
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RebindProgress binds the stable identity of the client to clientID for taskID.
+// If the identity has been bound to a client which is seen within the ClientIdentityTTL,
+// the progress of that client will be moved to clientID and its clientID is returned.
+// Otherwise an empty string is returned and the progress of clientID should be initialized.
+func (pm *Manager) RebindProgress(ctx context.Context, taskID, peerID, clientID, identity string) (string, error) {
+	if stringutils.IsEmptyStr(identity) || !pm.isClientIdentityEnabled() || pm.cfg.IsSuperCID(clientID) {
+		return "", nil
+	}
+	if stringutils.IsEmptyStr(taskID) {
+		return "", errors.Wrap(errortypes.ErrEmptyValue, "taskID")
+	}
+	if stringutils.IsEmptyStr(clientID) {
+		return "", errors.Wrap(errortypes.ErrEmptyValue, "clientID")
+	}
+	if stringutils.IsEmptyStr(peerID) {
+		return "", errors.Wrap(errortypes.ErrEmptyValue, "peerID")
+	}
+
+	key := generateIdentityKey(identity, taskID)
+	prevClientID, err := pm.clientIdentities.GetAsString(key)
+	if err != nil || !pm.resumeClientProgress(taskID, prevClientID, clientID) {
+		prevClientID = ""
+	}
+	if err := pm.clientIdentities.Add(key, clientID); err != nil {
+		return "", err
+	}
+	if prevClientID == "" {
+		return "", nil
+	}
+
+	if _, err := pm.peerProgress.loadOrAdd(peerID, newPeerState()); err != nil {
+		return "", err
+	}
+	logrus.Infof("success to resume the progress of clientID(%s) for clientID(%s) with identity %s of taskID(%s)",
+		prevClientID, clientID, identity, taskID)
+	return prevClientID, nil
+}
+
+// resumeClientProgress moves the progress of prevClientID to clientID
+// if it's seen within the ClientIdentityTTL.
+func (pm *Manager) resumeClientProgress(taskID, prevClientID, clientID string) bool {
+	cs, err := pm.clientProgress.getAsClientState(prevClientID)
+	if err != nil || pm.isClientExpired(cs) {
+		return false
+	}
+
+	pm.bitSetLocker.GetLock(prevClientID, false)
+	// the pieces being downloaded by the previous connection will never be reported,
+	// so release the loads of the peers serving them.
+	pm.releaseRunningPieces(taskID, prevClientID, cs)
+	atomic.StoreInt64(&cs.lastSeen, time.Now().UnixNano())
+	pm.bitSetLocker.ReleaseLock(prevClientID, false)
+
+	if prevClientID == clientID {
+		return true
+	}
+	if err := pm.clientProgress.add(clientID, cs); err != nil {
+		return false
+	}
+	if err := pm.clientProgress.remove(prevClientID); err != nil {
+		logrus.Warnf("failed to delete clientProgress for clientID: %s: %v", prevClientID, err)
+	}
+	return true
+}
+
+// startIdentityReaper removes the expired client identities periodically
+// until the client identities are disabled.
+func (pm *Manager) startIdentityReaper() {
+	if !pm.isClientIdentityEnabled() {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(pm.cfg.ClientIdentityTTL)
+			pm.reapClientIdentities()
+		}
+	}()
+}
+
+// reapClientIdentities removes the identities whose clients are gone or expired.
+func (pm *Manager) reapClientIdentities() {
+	for _, key := range pm.clientIdentities.ListKeyAsStringSlice() {
+		clientID, err := pm.clientIdentities.GetAsString(key)
+		if err != nil {
+			continue
+		}
+		if cs, err := pm.clientProgress.getAsClientState(clientID); err == nil && !pm.isClientExpired(cs) {
+			continue
+		}
+		pm.clientIdentities.Remove(key)
+		logrus.Debugf("success to remove the expired client identity %s", key)
+	}
+}
+
+func (pm *Manager) isClientIdentityEnabled() bool {
+	return pm.cfg != nil && pm.cfg.BaseProperties != nil && pm.cfg.ClientIdentityTTL > 0
+}
+
+// isClientExpired returns whether the client isn't seen within the ClientIdentityTTL.
+func (pm *Manager) isClientExpired(cs *clientState) bool {
+	lastSeen := time.Unix(0, atomic.LoadInt64(&cs.lastSeen))
+	return time.Since(lastSeen) > pm.cfg.ClientIdentityTTL
+}
+
+func generateIdentityKey(identity, taskID string) string {
+	return fmt.Sprintf("%s@%s", identity, taskID)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"context"
+	"sort"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+)
+
+// GetPeerSources gets the pieces of the tasks that the peer currently sources to the other peers,
+// which are the pieces it holds and the pieces being downloaded from it.
+// It scans the whole pieceProgress, so it's only supposed to be used for the administration.
+func (pm *Manager) GetPeerSources(ctx context.Context, peerID string) ([]*mgr.PeerSource, error) {
+	if stringutils.IsEmptyStr(peerID) {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "peerID")
+	}
+
+	sources := make(map[string]*mgr.PeerSource)
+	getSource := func(taskID string) *mgr.PeerSource {
+		source, ok := sources[taskID]
+		if !ok {
+			source = &mgr.PeerSource{TaskID: taskID}
+			sources[taskID] = source
+		}
+		return source
+	}
+
+	for _, key := range pm.pieceProgress.listKeys() {
+		taskID, pieceNum, ok := parsePieceProgressKey(key)
+		if !ok {
+			continue
+		}
+		ps, err := pm.pieceProgress.getAsPieceState(key)
+		if err != nil {
+			continue
+		}
+
+		if _, err := ps.pieceContainer.Get(peerID); err == nil {
+			source := getSource(taskID)
+			source.PieceNums = append(source.PieceNums, pieceNum)
+		}
+		uploading := false
+		ps.assignments.Range(func(_, v interface{}) bool {
+			if assignment, ok := v.(*pieceAssignment); ok && assignment.dstPID == peerID {
+				uploading = true
+				return false
+			}
+			return true
+		})
+		if uploading {
+			source := getSource(taskID)
+			source.UploadingPieceNums = append(source.UploadingPieceNums, pieceNum)
+		}
+	}
+
+	result := make([]*mgr.PeerSource, 0, len(sources))
+	for _, source := range sources {
+		sort.Ints(source.PieceNums)
+		sort.Ints(source.UploadingPieceNums)
+		result = append(result, source)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TaskID < result[j].TaskID
+	})
+	return result, nil
+}
@@ -17,6 +17,8 @@
 package progress
 
 import (
+	"time"
+
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
@@ -29,12 +31,29 @@ import (
 // which peers the piece currently exists on.
 type pieceState struct {
 	pieceContainer *syncmap.SyncMap
+
+	// assignments maintains the assignments of the piece to the clients being downloading it.
+	// key:srcCID,value:*pieceAssignment
+	assignments *syncmap.SyncMap
+
+	// cancelled maintains the sources of the assignments cancelled since they timed out,
+	// whose reports of the piece will be ignored.
+	// key:srcCID,value:dstPID
+	cancelled *syncmap.SyncMap
+}
+
+// pieceAssignment is an assignment of the piece to a client from the source dstPID.
+type pieceAssignment struct {
+	dstPID    string
+	startTime time.Time
 }
 
 // newPieceState returns a new pieceState.
 func newPieceState() *pieceState {
 	return &pieceState{
 		pieceContainer: syncmap.NewSyncMap(),
+		assignments:    syncmap.NewSyncMap(),
+		cancelled:      syncmap.NewSyncMap(),
 	}
 }
 
@@ -45,17 +64,12 @@ func (ps *pieceState) add(peerID string) error {
 		return errors.Wrap(errortypes.ErrEmptyValue, "peerID")
 	}
 
-	ok, err := ps.pieceContainer.GetAsBool(peerID)
-	if err == nil && ok {
-		logrus.Warnf("peerID: %s is exist", peerID)
-		return nil
+	// it's a no-op to add a peerID which already exists,
+	// so that the duplicate reports of a piece never make duplicate entries.
+	if _, loaded := ps.pieceContainer.LoadOrStore(peerID, true); loaded {
+		logrus.Debugf("peerID: %s is exist", peerID)
 	}
-
-	if err != nil && !errortypes.IsDataNotFound(err) {
-		return err
-	}
-
-	return ps.pieceContainer.Add(peerID, true)
+	return nil
 }
 
 func (ps *pieceState) getAvailablePeers() []string {
@@ -65,3 +79,55 @@ func (ps *pieceState) getAvailablePeers() []string {
 func (ps *pieceState) delete(peerID string) error {
 	return ps.pieceContainer.Remove(peerID)
 }
+
+// assign records that the piece is assigned to srcCID from dstPID now,
+// and the assignment replaces the previous one of srcCID if any.
+func (ps *pieceState) assign(srcCID, dstPID string) error {
+	if dstPID == ps.getCancelled(srcCID) {
+		ps.cancelled.Remove(srcCID)
+	}
+	return ps.assignments.Add(srcCID, &pieceAssignment{
+		dstPID:    dstPID,
+		startTime: time.Now(),
+	})
+}
+
+// getAssignment returns the assignment of the piece to srcCID, or nil if there is none.
+func (ps *pieceState) getAssignment(srcCID string) *pieceAssignment {
+	v, err := ps.assignments.Get(srcCID)
+	if err != nil {
+		return nil
+	}
+	assignment, _ := v.(*pieceAssignment)
+	return assignment
+}
+
+// unassign removes the assignment of the piece to srcCID.
+func (ps *pieceState) unassign(srcCID string) {
+	ps.assignments.Remove(srcCID)
+}
+
+// cancel removes the assignment of the piece to srcCID,
+// and the following reports of it from dstPID will be ignored.
+func (ps *pieceState) cancel(srcCID, dstPID string) error {
+	ps.assignments.Remove(srcCID)
+	return ps.cancelled.Add(srcCID, dstPID)
+}
+
+// isCancelled returns whether the report of the piece from srcCID
+// belongs to a cancelled assignment from dstPID.
+func (ps *pieceState) isCancelled(srcCID, dstPID string) bool {
+	if stringutils.IsEmptyStr(dstPID) || ps.getCancelled(srcCID) != dstPID {
+		return false
+	}
+	assignment := ps.getAssignment(srcCID)
+	return assignment == nil || assignment.dstPID != dstPID
+}
+
+func (ps *pieceState) getCancelled(srcCID string) string {
+	dstPID, err := ps.cancelled.GetAsString(srcCID)
+	if err != nil {
+		return ""
+	}
+	return dstPID
+}
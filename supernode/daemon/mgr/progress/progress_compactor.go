@@ -0,0 +1,81 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// compactJitterFactor is the max proportion of the compact interval
+// used as the random jitter.
+const compactJitterFactor = 0.2
+
+// startCompactor compacts the progress maps periodically
+// until the compaction is disabled.
+func (pm *Manager) startCompactor() {
+	if pm.cfg == nil || pm.cfg.BaseProperties == nil {
+		return
+	}
+
+	interval := pm.cfg.ProgressCompactInterval
+	if interval <= 0 {
+		logrus.Infof("progress compaction is disabled")
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(jitterInterval(interval))
+			pm.compactProgress(pm.cfg.ProgressCompactRatio)
+		}
+	}()
+}
+
+// compactProgress compacts every progress map whose ratio of
+// removed entries to live entries reaches the ratio.
+func (pm *Manager) compactProgress(ratio float64) {
+	maps := map[string]*stateSyncMap{
+		"superProgress":  pm.superProgress,
+		"clientProgress": pm.clientProgress,
+		"peerProgress":   pm.peerProgress,
+		"pieceProgress":  pm.pieceProgress,
+	}
+
+	for name, mmap := range maps {
+		if !mmap.needCompact(ratio) {
+			continue
+		}
+
+		removed := mmap.removedCount.Get()
+		start := time.Now()
+		mmap.compact()
+		logrus.Infof("success to compact %s: reclaim %d removed entries and keep %d live entries in %v",
+			name, removed, mmap.liveCount.Get(), time.Since(start))
+	}
+}
+
+// jitterInterval returns the interval with a random jitter added.
+func jitterInterval(interval time.Duration) time.Duration {
+	maxJitter := int64(float64(interval) * compactJitterFactor)
+	if maxJitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(maxJitter))
+}
@@ -18,15 +18,24 @@ package progress
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/merkle"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/util"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"github.com/willf/bitset"
 )
@@ -46,6 +55,57 @@ const (
 
 var _ mgr.ProgressMgr = &Manager{}
 
+type metrics struct {
+	firstPieceDurationSeconds *prometheus.HistogramVec
+	peerServedBytes           *prometheus.CounterVec
+	peerConsumedBytes         *prometheus.CounterVec
+	pieceTimeouts             *prometheus.CounterVec
+
+	progressMapOperationDurationSeconds *prometheus.HistogramVec
+	progressMapLockWaitSeconds          *prometheus.HistogramVec
+	progressMapErrors                   *prometheus.CounterVec
+
+	subscribers          *prometheus.GaugeVec
+	subscriberRejections *prometheus.CounterVec
+
+	cacheResults *prometheus.CounterVec
+}
+
+func newMetrics(register prometheus.Registerer) *metrics {
+	return &metrics{
+		firstPieceDurationSeconds: metricsutils.NewHistogram(config.SubsystemSupernode, "task_first_piece_duration_seconds",
+			"Duration from the registration of a task to its first piece being available on supernode",
+			[]string{}, prometheus.ExponentialBuckets(0.1, 2, 12), register),
+		peerServedBytes: metricsutils.NewCounter(config.SubsystemSupernode, "peer_served_bytes_total",
+			"Total bytes of the pieces that the other peers downloaded from the peer",
+			[]string{"peer"}, register),
+		peerConsumedBytes: metricsutils.NewCounter(config.SubsystemSupernode, "peer_consumed_bytes_total",
+			"Total bytes of the pieces that the peer downloaded from the other peers and supernode",
+			[]string{"peer"}, register),
+		pieceTimeouts: metricsutils.NewCounter(config.SubsystemSupernode, "piece_download_timeouts_total",
+			"Total times of the piece assignments cancelled since the clients didn't finish downloading them in time",
+			[]string{}, register),
+		progressMapOperationDurationSeconds: metricsutils.NewHistogram(config.SubsystemSupernode, "progress_map_operation_duration_seconds",
+			"Duration of the sampled operations on the progress maps, including the time waiting for the lock",
+			[]string{"map", "op"}, prometheus.ExponentialBuckets(1e-7, 4, 10), register),
+		progressMapLockWaitSeconds: metricsutils.NewHistogram(config.SubsystemSupernode, "progress_map_lock_wait_seconds",
+			"Duration of the sampled operations on the progress maps waiting for the lock held by the compaction",
+			[]string{"map", "op"}, prometheus.ExponentialBuckets(1e-7, 4, 10), register),
+		progressMapErrors: metricsutils.NewCounter(config.SubsystemSupernode, "progress_map_errors_total",
+			"Total errors of the operations on the progress maps, where the frequent dataNotFound errors often indicate a scheduling bug",
+			[]string{"map", "op", "error"}, register),
+		subscribers: metricsutils.NewGauge(config.SubsystemSupernode, "task_subscribers",
+			"Current number of the subscribers of the task changes, such as the progress streams",
+			[]string{}, register),
+		subscriberRejections: metricsutils.NewCounter(config.SubsystemSupernode, "task_subscriber_rejections_total",
+			"Total subscriptions to the task changes rejected since the subscribers reach the limit",
+			[]string{"limit"}, register),
+		cacheResults: metricsutils.NewCounter(config.SubsystemSupernode, "task_cache_results_total",
+			"Total results of looking up the cache of the tasks, which are hit, revalidation-hit and miss",
+			[]string{"result"}, register),
+	}
+}
+
 // Manager is an implementation of the interface of ProgressMgr.
 type Manager struct {
 	// superProgress maintains the super progress.
@@ -65,23 +125,52 @@ type Manager struct {
 	// key:pieceNum@taskID,value:*pieceState
 	pieceProgress *stateSyncMap
 
+	// clientIdentities maintains the clients bound to the stable identities.
+	// key:identity@taskID,value:CID
+	clientIdentities *syncmap.SyncMap
+
 	// clientBlackInfo maintains the blacklist of the PID.
 	// key:srcPID,value:map[dstPID]*Atomic
 	clientBlackInfo *syncmap.SyncMap
 
-	cfg *config.Config
+	// taskWatchers maintains the subscribers of the progress changes of the tasks on supernode.
+	taskWatchers *taskWatchers
+
+	// retainedEvents maintains the event history of the evicted tasks.
+	// key:taskID,value:*retainedEvents
+	retainedEvents *syncmap.SyncMap
+
+	// bitSetLocker protects the piece bitSet of superState and clientState
+	// to make the updates of the same piece atomic.
+	// key:superStateLockKey or CID
+	bitSetLocker *util.LockerPool
+
+	cfg     *config.Config
+	metrics *metrics
 }
 
 // NewManager returns a new Manager.
-func NewManager(cfg *config.Config) (*Manager, error) {
-	return &Manager{
-		cfg:             cfg,
-		superProgress:   newStateSyncMap(),
-		clientProgress:  newStateSyncMap(),
-		peerProgress:    newStateSyncMap(),
-		pieceProgress:   newStateSyncMap(),
-		clientBlackInfo: syncmap.NewSyncMap(),
-	}, nil
+func NewManager(cfg *config.Config, register prometheus.Registerer) (*Manager, error) {
+	metrics := newMetrics(register)
+	manager := &Manager{
+		cfg:              cfg,
+		metrics:          metrics,
+		superProgress:    newStateSyncMap(),
+		clientProgress:   newStateSyncMap(),
+		peerProgress:     newStateSyncMap(),
+		pieceProgress:    newStateSyncMap(),
+		clientBlackInfo:  syncmap.NewSyncMap(),
+		bitSetLocker:     util.NewLockerPool(),
+		clientIdentities: syncmap.NewSyncMap(),
+		retainedEvents:   syncmap.NewSyncMap(),
+		taskWatchers:     newTaskWatchers(metrics.subscribers.WithLabelValues(), metrics.subscriberRejections),
+	}
+	manager.instrumentProgress()
+	manager.startCompactor()
+	manager.startIdentityReaper()
+	manager.startEventReaper()
+
+	return manager, nil
 }
 
 // InitProgress inits the correlation information between peers and pieces, etc.
@@ -99,7 +188,11 @@ func (pm *Manager) InitProgress(ctx context.Context, taskID, peerID, clientID st
 
 	// init cdn node if the clientID represents a supernode.
 	if pm.cfg.IsSuperCID(clientID) {
-		return pm.superProgress.add(taskID, newSuperState())
+		ss := newSuperState()
+		ss.events = newTaskEvents(pm.cfg.TaskEventHistorySize)
+		ss.events.add(mgr.TaskEvent{Time: ss.createTime, Type: mgr.TaskEventRegistered})
+		pm.retainedEvents.Remove(taskID)
+		return pm.superProgress.add(taskID, ss)
 	}
 
 	// init peer node if the clientID represents a ordinary peer node.
@@ -119,7 +212,7 @@ func (pm *Manager) InitProgress(ctx context.Context, taskID, peerID, clientID st
 
 // UpdateProgress updates the correlation information between peers and pieces.
 // NOTE: What if the update failed?
-func (pm *Manager) UpdateProgress(ctx context.Context, taskID, srcCID, srcPID, dstPID string, pieceNum, pieceStatus int) error {
+func (pm *Manager) UpdateProgress(ctx context.Context, taskID, srcCID, srcPID, dstPID string, pieceNum, pieceStatus int, pieceSize int32) error {
 	if stringutils.IsEmptyStr(taskID) {
 		return errors.Wrap(errortypes.ErrEmptyValue, "taskID")
 	}
@@ -130,6 +223,10 @@ func (pm *Manager) UpdateProgress(ctx context.Context, taskID, srcCID, srcPID, d
 		return errors.Wrapf(errortypes.ErrEmptyValue, "srcPID for taskID:%s", taskID)
 	}
 
+	if peerState, err := pm.peerProgress.getAsPeerState(srcPID); err == nil {
+		atomic.StoreInt64(&peerState.lastSeen, time.Now().UnixNano())
+	}
+
 	// Step1: update the PieceProgress
 	// Add one more peer for this piece when the srcPID successfully downloads the piece.
 	if pieceStatus == config.PieceSUCCESS {
@@ -143,7 +240,7 @@ func (pm *Manager) UpdateProgress(ctx context.Context, taskID, srcCID, srcPID, d
 	}
 
 	// Step2: update the clientProgress and superProgress
-	result, err := pm.updateClientProgress(taskID, srcCID, dstPID, pieceNum, pieceStatus)
+	result, err := pm.updateClientProgress(taskID, srcCID, srcPID, dstPID, pieceNum, pieceStatus)
 	if err != nil {
 		logrus.Errorf("failed to update ClientProgress taskID(%s) srcCID(%s) dstPID(%s) pieceNum(%d) pieceStatus(%d): %v",
 			taskID, srcCID, dstPID, pieceNum, pieceStatus, err)
@@ -159,7 +256,7 @@ func (pm *Manager) UpdateProgress(ctx context.Context, taskID, srcCID, srcPID, d
 	}
 
 	// Step3: update the peerProgress
-	if err := pm.updatePeerProgress(taskID, srcPID, dstPID, pieceNum, pieceStatus); err != nil {
+	if err := pm.updatePeerProgress(taskID, srcPID, dstPID, pieceNum, pieceStatus, pieceSize); err != nil {
 		logrus.Errorf("failed to update PeerProgress taskID(%s) srcCID(%s) dstPID(%s) pieceNum(%d) pieceStatus(%d): %v",
 			taskID, srcCID, dstPID, pieceNum, pieceStatus, err)
 		return err
@@ -178,7 +275,7 @@ func (pm *Manager) UpdateClientProgress(ctx context.Context, taskID, srcCID, dst
 		return errors.Wrapf(errortypes.ErrEmptyValue, "srcCID for taskID:%s", taskID)
 	}
 
-	result, err := pm.updateClientProgress(taskID, srcCID, dstPID, pieceNum, pieceStatus)
+	result, err := pm.updateClientProgress(taskID, srcCID, "", dstPID, pieceNum, pieceStatus)
 	if err != nil {
 		logrus.Errorf("failed to update ClientProgress taskID(%s) srcCID(%s) dstPID(%s) pieceNum(%d) pieceStatus(%d): %v",
 			taskID, srcCID, dstPID, pieceNum, pieceStatus, err)
@@ -211,8 +308,12 @@ func (pm *Manager) GetPieceProgressByCID(ctx context.Context, taskID, clientID,
 	if err != nil {
 		return nil, err
 	}
+	pm.bitSetLocker.GetLock(clientID, true)
 	clientBitset := cs.pieceBitSet.Clone()
+	pm.bitSetLocker.ReleaseLock(clientID, true)
+	pm.bitSetLocker.GetLock(superStateLockKey(taskID), true)
 	cdnBitset := ss.pieceBitSet.Clone()
+	pm.bitSetLocker.ReleaseLock(superStateLockKey(taskID), true)
 
 	// get successful pieces
 	if pieceStatus == PieceSuccess {
@@ -223,15 +324,50 @@ func (pm *Manager) GetPieceProgressByCID(ctx context.Context, taskID, clientID,
 	return getAvailablePieces(clientBitset, cdnBitset, runningPieces)
 }
 
-// DeletePieceProgressByCID deletes the pieces progress with specified clientID.
+// DeletePieceProgressByCID deletes the pieces progress with specified clientID,
+// and the pieces being downloaded by the client are released from their sources.
 func (pm *Manager) DeletePieceProgressByCID(ctx context.Context, taskID, clientID string) (err error) {
 	if pm.cfg.IsSuperCID(clientID) {
 		return pm.superProgress.remove(taskID)
 	}
 
+	if cs, err := pm.clientProgress.getAsClientState(clientID); err == nil {
+		pm.bitSetLocker.GetLock(clientID, false)
+		pm.releaseRunningPieces(taskID, clientID, cs)
+		pm.bitSetLocker.ReleaseLock(clientID, false)
+	}
 	return pm.clientProgress.remove(clientID)
 }
 
+// DeleteProgressByTaskID deletes the super progress and the pieces progress with specified taskID.
+func (pm *Manager) DeleteProgressByTaskID(ctx context.Context, taskID string) (err error) {
+	if stringutils.IsEmptyStr(taskID) {
+		return errors.Wrap(errortypes.ErrEmptyValue, "taskID")
+	}
+
+	ss, _ := pm.superProgress.getAsSuperState(taskID)
+	if err := pm.superProgress.remove(taskID); err != nil && !errortypes.IsDataNotFound(err) {
+		return err
+	}
+	if ss != nil {
+		logTaskEvents(taskID, ss)
+		pm.retainTaskEvents(taskID, ss)
+	}
+	pm.taskWatchers.notify(taskID)
+	pm.taskWatchers.forget(taskID)
+
+	suffix := "@" + taskID
+	for _, key := range pm.pieceProgress.listKeys() {
+		if !strings.HasSuffix(key, suffix) {
+			continue
+		}
+		if err := pm.pieceProgress.remove(key); err != nil && !errortypes.IsDataNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetPeerIDsByPieceNum gets all peerIDs with specified taskID and pieceNum.
 // It will return nil when no peers is available.
 func (pm *Manager) GetPeerIDsByPieceNum(ctx context.Context, taskID string, pieceNum int) (peerIDs []string, err error) {
@@ -270,11 +406,15 @@ func (pm *Manager) GetPeerStateByPeerID(ctx context.Context, peerID string) (*mg
 	}
 
 	return &mgr.PeerState{
-		PeerID:            peerID,
-		ServiceDownTime:   &peerState.serviceDownTime,
-		ClientErrorCount:  peerState.clientErrorCount,
-		ServiceErrorCount: peerState.serviceErrorCount,
-		ProducerLoad:      peerState.producerLoad,
+		PeerID:              peerID,
+		ServiceDownTime:     &peerState.serviceDownTime,
+		ClientErrorCount:    peerState.clientErrorCount,
+		ServiceErrorCount:   peerState.serviceErrorCount,
+		ProducerLoad:        peerState.producerLoad,
+		ServiceSuccessCount: peerState.serviceSuccessCount,
+		ServedBytes:         &peerState.servedBytes,
+		ConsumedBytes:       &peerState.consumedBytes,
+		LastSeen:            &peerState.lastSeen,
 	}, nil
 }
 
@@ -284,6 +424,9 @@ func (pm *Manager) DeletePeerStateByPeerID(ctx context.Context, peerID string) e
 	// TODO: delete the blackinfo that refer to peerID
 	pm.clientBlackInfo.Delete(peerID)
 
+	pm.metrics.peerServedBytes.DeleteLabelValues(peerID)
+	pm.metrics.peerConsumedBytes.DeleteLabelValues(peerID)
+
 	// delete peer progress
 	return pm.peerProgress.remove(peerID)
 }
@@ -298,6 +441,153 @@ func (pm *Manager) GetBlackInfoByPeerID(ctx context.Context, peerID string) (dst
 	return pm.clientBlackInfo.GetAsMap(peerID)
 }
 
+// UpdateSuperPieceMD5 updates the md5 of the piece which has been downloaded by supernode.
+func (pm *Manager) UpdateSuperPieceMD5(ctx context.Context, taskID string, pieceNum int, pieceMD5 string) error {
+	if stringutils.IsEmptyStr(pieceMD5) {
+		return errors.Wrapf(errortypes.ErrEmptyValue, "pieceMD5 of pieceNum %d for taskID: %s", pieceNum, taskID)
+	}
+	if pieceNum < 0 {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "pieceNum: %d", pieceNum)
+	}
+
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return err
+	}
+	return ss.pieceMD5s.Add(strconv.Itoa(pieceNum), pieceMD5)
+}
+
+// GetPieceProof gets the proof of the piece in the Merkle tree of the piece md5s on supernode.
+func (pm *Manager) GetPieceProof(ctx context.Context, taskID string, pieceNum int) (*mgr.PieceProof, error) {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	pieceMD5s := getConsecutivePieceMD5s(ss.pieceMD5s)
+	if pieceNum < 0 || pieceNum >= len(pieceMD5s) {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound,
+			"md5 of pieceNum %d for taskID %s with %d consecutive pieces", pieceNum, taskID, len(pieceMD5s))
+	}
+
+	tree := merkle.NewTree(pieceMD5s)
+	siblings, err := tree.Proof(pieceNum)
+	if err != nil {
+		return nil, err
+	}
+	return &mgr.PieceProof{
+		PieceNum:   pieceNum,
+		PieceMD5:   pieceMD5s[pieceNum],
+		PieceCount: tree.LeafCount(),
+		Root:       tree.Root(),
+		Siblings:   siblings,
+	}, nil
+}
+
+// GetFirstPieceTime gets the time when the first piece of the task became available on supernode.
+func (pm *Manager) GetFirstPieceTime(ctx context.Context, taskID string) (time.Time, error) {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	pm.bitSetLocker.GetLock(superStateLockKey(taskID), true)
+	defer pm.bitSetLocker.ReleaseLock(superStateLockKey(taskID), true)
+	return ss.firstPieceTime, nil
+}
+
+// GetTaskServedBytes gets the bytes served by supernode and all peers for the task.
+func (pm *Manager) GetTaskServedBytes(ctx context.Context, taskID string) (int64, error) {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return 0, err
+	}
+	return atomic.LoadInt64(&ss.servedBytes), nil
+}
+
+// CancelStalledPieces cancels the assignments of the pieces to clientID which have been
+// running longer than the PieceDownloadTimeout. The cancelled pieces are treated as the failures
+// of their sources, which releases the load and penalizes the sources, and they will be
+// scheduled again. It returns the pieceNums cancelled with their sources.
+func (pm *Manager) CancelStalledPieces(ctx context.Context, taskID, clientID, peerID string) (map[int]string, error) {
+	timeout := pm.cfg.PieceDownloadTimeout
+	if timeout <= 0 || pm.cfg.IsSuperCID(clientID) {
+		return nil, nil
+	}
+
+	cs, err := pm.clientProgress.getAsClientState(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	stalled := make(map[int]string)
+	for _, pieceNum := range cs.runningPiece.ListKeyAsIntSlice() {
+		dstPID, ok := pm.cancelStalledPiece(taskID, clientID, cs, pieceNum, timeout)
+		if !ok {
+			continue
+		}
+		if err := pm.updatePeerProgress(taskID, peerID, dstPID, pieceNum, config.PieceFAILED, 0); err != nil {
+			logrus.Warnf("failed to update PeerProgress for the cancelled pieceNum(%d) taskID(%s) clientID(%s) dstPID(%s): %v",
+				pieceNum, taskID, clientID, dstPID, err)
+		}
+		// the stalled dstPID is penalized explicitly since
+		// its serviceErrorInfo is not updated by the reports of the clients.
+		if dstPeerState, err := pm.peerProgress.getAsPeerState(dstPID); err == nil {
+			processPeerFailInfo(nil, dstPeerState)
+		}
+		pm.metrics.pieceTimeouts.WithLabelValues().Inc()
+		logrus.Warnf("cancel the assignment of pieceNum(%d) taskID(%s) clientID(%s) from dstPID(%s) which exceeds timeout %v",
+			pieceNum, taskID, clientID, dstPID, timeout)
+		pm.recordTaskEvent(taskID, mgr.TaskEventReassigned,
+			fmt.Sprintf("pieceNum(%d) of clientID(%s) from dstPID(%s) exceeds timeout %v", pieceNum, clientID, dstPID, timeout))
+		stalled[pieceNum] = dstPID
+	}
+	return stalled, nil
+}
+
+// CancelPeerPieces cancels the assignments of the pieces to clientID which are being downloaded
+// from the peers other than supernode. The cancelled pieces are not treated as the failures
+// of their sources, which only releases the load of the sources, and they will be scheduled again.
+// It returns the pieceNums cancelled with their sources.
+func (pm *Manager) CancelPeerPieces(ctx context.Context, taskID, clientID string) (map[int]string, error) {
+	if pm.cfg.IsSuperCID(clientID) {
+		return nil, nil
+	}
+
+	cs, err := pm.clientProgress.getAsClientState(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelled := make(map[int]string)
+	for _, pieceNum := range cs.runningPiece.ListKeyAsIntSlice() {
+		dstPID, ok := pm.cancelRunningPiece(taskID, clientID, cs, pieceNum, func(assignment *pieceAssignment) bool {
+			return !pm.cfg.IsSuperPID(assignment.dstPID)
+		})
+		if !ok {
+			continue
+		}
+		if dstPeerState, err := pm.peerProgress.getAsPeerState(dstPID); err == nil && dstPeerState.producerLoad != nil {
+			updateProducerLoad(dstPeerState.producerLoad, taskID, dstPID, pieceNum, config.PieceFAILED)
+		}
+		logrus.Infof("cancel the assignment of pieceNum(%d) taskID(%s) clientID(%s) from dstPID(%s)",
+			pieceNum, taskID, clientID, dstPID)
+		pm.recordTaskEvent(taskID, mgr.TaskEventReassigned,
+			fmt.Sprintf("pieceNum(%d) of clientID(%s) from the peer dstPID(%s)", pieceNum, clientID, dstPID))
+		cancelled[pieceNum] = dstPID
+	}
+	return cancelled, nil
+}
+
+// GetSuperPieceMD5s gets the md5s of the consecutive pieces starting from 0 downloaded by supernode.
+func (pm *Manager) GetSuperPieceMD5s(ctx context.Context, taskID string) ([]string, error) {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return nil, err
+	}
+	return getConsecutivePieceMD5s(ss.pieceMD5s), nil
+}
+
 // getSuccessfulPieces gets pieces that the piece has been downloaded successful.
 func getSuccessfulPieces(clientBitset, cdnBitset *bitset.BitSet) ([]int, error) {
 	successPieces := make([]int, 0)
@@ -343,6 +633,17 @@ func getAvailablePieces(clientBitset, cdnBitset *bitset.BitSet, runningPieceNums
 	return parseMapKeyToIntSlice(availablePieces), nil
 }
 
+// getConsecutivePieceMD5s returns the md5s of the consecutive pieces starting from 0.
+func getConsecutivePieceMD5s(pieceMD5s *syncmap.SyncMap) (result []string) {
+	for pieceNum := 0; ; pieceNum++ {
+		pieceMD5, err := pieceMD5s.GetAsString(strconv.Itoa(pieceNum))
+		if err != nil {
+			return
+		}
+		result = append(result, pieceMD5)
+	}
+}
+
 func parseMapKeyToIntSlice(mmap map[int]bool) (result []int) {
 	for k, v := range mmap {
 		if v {
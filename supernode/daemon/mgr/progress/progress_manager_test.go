@@ -17,11 +17,20 @@
 package progress
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/merkle"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 
 	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/willf/bitset"
 )
 
@@ -100,3 +109,480 @@ func (s *ProgressManagerTestSuite) TestGetAvailablePieces(c *check.C) {
 		c.Check(result, check.DeepEquals, v.expected)
 	}
 }
+
+func (s *ProgressManagerTestSuite) TestDeleteProgressByTaskID(c *check.C) {
+	pm, _ := NewManager(nil, prometheus.NewRegistry())
+	pm.superProgress.add("task1", newSuperState())
+	pm.superProgress.add("task2", newSuperState())
+	pm.pieceProgress.add("0@task1", newPieceState())
+	pm.pieceProgress.add("1@task1", newPieceState())
+	pm.pieceProgress.add("0@task2", newPieceState())
+
+	err := pm.DeleteProgressByTaskID(context.Background(), "")
+	c.Check(errortypes.IsEmptyValue(err), check.Equals, true)
+
+	err = pm.DeleteProgressByTaskID(context.Background(), "task1")
+	c.Check(err, check.IsNil)
+	_, err = pm.superProgress.get("task1")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+	c.Check(pm.pieceProgress.listKeys(), check.DeepEquals, []string{"0@task2"})
+
+	// delete the progress of a task which does not exist
+	err = pm.DeleteProgressByTaskID(context.Background(), "task3")
+	c.Check(err, check.IsNil)
+}
+
+func (s *ProgressManagerTestSuite) TestGetPieceProof(c *check.C) {
+	pm, _ := NewManager(nil, prometheus.NewRegistry())
+	pm.superProgress.add("task", newSuperState())
+
+	_, err := pm.GetPieceProof(context.Background(), "foo", 0)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	pieceMD5s := []string{"md5-0", "md5-1", "md5-2", "md5-3", "md5-4"}
+	for _, pieceNum := range []int{0, 1, 2, 4} {
+		c.Check(pm.UpdateSuperPieceMD5(context.Background(), "task", pieceNum, pieceMD5s[pieceNum]), check.IsNil)
+	}
+	c.Check(errortypes.IsEmptyValue(pm.UpdateSuperPieceMD5(context.Background(), "task", 3, "")), check.Equals, true)
+
+	// the tree only covers the consecutive pieces
+	_, err = pm.GetPieceProof(context.Background(), "task", 4)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+	proof, err := pm.GetPieceProof(context.Background(), "task", 1)
+	c.Assert(err, check.IsNil)
+	c.Check(proof.PieceCount, check.Equals, 3)
+	c.Check(proof.PieceMD5, check.Equals, "md5-1")
+	c.Check(merkle.Verify(proof.Root, "md5-1", 1, proof.PieceCount, proof.Siblings), check.Equals, true)
+
+	// the tree covers all pieces after the missing one is downloaded
+	c.Check(pm.UpdateSuperPieceMD5(context.Background(), "task", 3, pieceMD5s[3]), check.IsNil)
+	proof, err = pm.GetPieceProof(context.Background(), "task", 4)
+	c.Assert(err, check.IsNil)
+	c.Check(proof.PieceCount, check.Equals, 5)
+	c.Check(proof.Root, check.DeepEquals, merkle.NewTree(pieceMD5s).Root())
+	c.Check(merkle.Verify(proof.Root, "md5-4", 4, proof.PieceCount, proof.Siblings), check.Equals, true)
+	c.Check(merkle.Verify(proof.Root, "corrupted", 4, proof.PieceCount, proof.Siblings), check.Equals, false)
+}
+
+func (s *ProgressManagerTestSuite) TestGetFirstPieceTime(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	register := prometheus.NewRegistry()
+	pm, _ := NewManager(cfg, register)
+
+	ctx := context.Background()
+	taskID := "task"
+	superCID := cfg.GetSuperCID(taskID)
+	c.Assert(pm.InitProgress(ctx, taskID, cfg.GetSuperPID(), superCID), check.IsNil)
+
+	firstPieceTime, err := pm.GetFirstPieceTime(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(firstPieceTime.IsZero(), check.Equals, true)
+	c.Check(getHistogramSampleCount(c, register, "dragonfly_supernode_task_first_piece_duration_seconds"),
+		check.Equals, uint64(0))
+
+	// the pieces are reported concurrently and repeatedly
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		for pieceNum := 0; pieceNum < 8; pieceNum++ {
+			wg.Add(1)
+			go func(pieceNum int) {
+				defer wg.Done()
+				err := pm.UpdateProgress(ctx, taskID, superCID, cfg.GetSuperPID(), "", pieceNum, config.PieceSUCCESS, 0)
+				c.Check(err, check.IsNil)
+			}(pieceNum)
+		}
+	}
+	wg.Wait()
+
+	firstPieceTime, err = pm.GetFirstPieceTime(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(firstPieceTime.IsZero(), check.Equals, false)
+	c.Check(getHistogramSampleCount(c, register, "dragonfly_supernode_task_first_piece_duration_seconds"),
+		check.Equals, uint64(1))
+
+	// the later pieces don't change the time of the first piece
+	c.Assert(pm.UpdateProgress(ctx, taskID, superCID, cfg.GetSuperPID(), "", 8, config.PieceSUCCESS, 0), check.IsNil)
+	result, err := pm.GetFirstPieceTime(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(result.Equal(firstPieceTime), check.Equals, true)
+	c.Check(getHistogramSampleCount(c, register, "dragonfly_supernode_task_first_piece_duration_seconds"),
+		check.Equals, uint64(1))
+
+	_, err = pm.GetFirstPieceTime(ctx, "foo")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *ProgressManagerTestSuite) TestPeerTrafficAccounting(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	register := prometheus.NewRegistry()
+	pm, _ := NewManager(cfg, register)
+
+	var (
+		ctx       = context.Background()
+		taskID    = "task"
+		pieceSize = int32(100)
+	)
+	c.Assert(pm.InitProgress(ctx, taskID, cfg.GetSuperPID(), cfg.GetSuperCID(taskID)), check.IsNil)
+	c.Assert(pm.InitProgress(ctx, taskID, "contributor", "cidContributor"), check.IsNil)
+	c.Assert(pm.InitProgress(ctx, taskID, "freeloader", "cidFreeloader"), check.IsNil)
+
+	// the contributor downloads the pieces from supernode and serves them to the freeloader,
+	// while the freeloader never serves any piece.
+	for pieceNum := 0; pieceNum < 2; pieceNum++ {
+		c.Assert(pm.UpdateProgress(ctx, taskID, "cidContributor", "contributor", cfg.GetSuperPID(),
+			pieceNum, config.PieceSUCCESS, pieceSize), check.IsNil)
+		c.Assert(pm.UpdateProgress(ctx, taskID, "cidFreeloader", "freeloader", "contributor",
+			pieceNum, config.PieceSUCCESS, pieceSize), check.IsNil)
+	}
+	c.Assert(pm.UpdateProgress(ctx, taskID, "cidFreeloader", "freeloader", cfg.GetSuperPID(),
+		2, config.PieceSUCCESS, pieceSize), check.IsNil)
+	// the failed and duplicate reports are not accounted
+	c.Assert(pm.UpdateProgress(ctx, taskID, "cidFreeloader", "freeloader", "contributor",
+		3, config.PieceFAILED, pieceSize), check.IsNil)
+	c.Assert(pm.UpdateProgress(ctx, taskID, "cidFreeloader", "freeloader", "contributor",
+		0, config.PieceSUCCESS, pieceSize), check.IsNil)
+
+	var cases = []struct {
+		peerID   string
+		served   int64
+		consumed int64
+	}{
+		{peerID: "contributor", served: 200, consumed: 200},
+		{peerID: "freeloader", served: 0, consumed: 300},
+	}
+	for _, v := range cases {
+		peerState, err := pm.GetPeerStateByPeerID(ctx, v.peerID)
+		c.Assert(err, check.IsNil)
+		c.Check(atomic.LoadInt64(peerState.ServedBytes), check.Equals, v.served)
+		c.Check(atomic.LoadInt64(peerState.ConsumedBytes), check.Equals, v.consumed)
+		c.Check(getCounterValue(c, register, "dragonfly_supernode_peer_served_bytes_total", v.peerID),
+			check.Equals, float64(v.served))
+		c.Check(getCounterValue(c, register, "dragonfly_supernode_peer_consumed_bytes_total", v.peerID),
+			check.Equals, float64(v.consumed))
+	}
+
+	// all the pieces downloaded by the peers are accounted for the task
+	servedBytes, err := pm.GetTaskServedBytes(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(servedBytes, check.Equals, int64(500))
+
+	// the metrics of the peer are removed with the peer state
+	c.Assert(pm.DeletePeerStateByPeerID(ctx, "freeloader"), check.IsNil)
+	c.Check(getCounterValue(c, register, "dragonfly_supernode_peer_consumed_bytes_total", "freeloader"),
+		check.Equals, float64(0))
+}
+
+func getHistogramSampleCount(c *check.C, register *prometheus.Registry, name string) uint64 {
+	families, err := register.Gather()
+	c.Assert(err, check.IsNil)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		var count uint64
+		for _, metric := range family.GetMetric() {
+			count += metric.GetHistogram().GetSampleCount()
+		}
+		return count
+	}
+	return 0
+}
+
+func getCounterValue(c *check.C, register *prometheus.Registry, name, peerID string) float64 {
+	families, err := register.Gather()
+	c.Assert(err, check.IsNil)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "peer" && label.GetValue() == peerID {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func (s *ProgressManagerTestSuite) TestRebindProgress(c *check.C) {
+	ctx := context.Background()
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	cfg.ClientIdentityTTL = time.Hour
+	pm, err := NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	taskID := "rebindTaskID"
+	superCID := cfg.GetSuperCID(taskID)
+	c.Assert(pm.InitProgress(ctx, taskID, "superPID", superCID), check.IsNil)
+	for pieceNum := 0; pieceNum < 3; pieceNum++ {
+		c.Assert(pm.UpdateProgress(ctx, taskID, superCID, "superPID", "", pieceNum, config.PieceSUCCESS, 0), check.IsNil)
+	}
+
+	prevCID, err := pm.RebindProgress(ctx, taskID, "peer1", "cid1", "identity")
+	c.Assert(err, check.IsNil)
+	c.Check(prevCID, check.Equals, "")
+	c.Assert(pm.InitProgress(ctx, taskID, "peer1", "cid1"), check.IsNil)
+	c.Assert(pm.UpdateProgress(ctx, taskID, "cid1", "peer1", "superPID", 0, config.PieceSUCCESS, 10), check.IsNil)
+	c.Assert(pm.UpdateClientProgress(ctx, taskID, "cid1", "superPID", 1, config.PieceRUNNING), check.IsNil)
+
+	// reconnect within the TTL resumes the progress without the running pieces
+	prevCID, err = pm.RebindProgress(ctx, taskID, "peer1", "cid2", "identity")
+	c.Assert(err, check.IsNil)
+	c.Check(prevCID, check.Equals, "cid1")
+	pieceNums, err := pm.GetPieceProgressByCID(ctx, taskID, "cid2", PieceSuccess)
+	c.Assert(err, check.IsNil)
+	c.Check(pieceNums, check.DeepEquals, []int{0})
+	pieceNums, err = pm.GetPieceProgressByCID(ctx, taskID, "cid2", PieceRunning)
+	c.Assert(err, check.IsNil)
+	c.Check(pieceNums, check.HasLen, 0)
+	_, err = pm.clientProgress.getAsClientState("cid1")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	// reconnect after the TTL starts fresh
+	cs, err := pm.clientProgress.getAsClientState("cid2")
+	c.Assert(err, check.IsNil)
+	atomic.StoreInt64(&cs.lastSeen, time.Now().Add(-2*time.Hour).UnixNano())
+	prevCID, err = pm.RebindProgress(ctx, taskID, "peer1", "cid3", "identity")
+	c.Assert(err, check.IsNil)
+	c.Check(prevCID, check.Equals, "")
+	c.Assert(pm.InitProgress(ctx, taskID, "peer1", "cid3"), check.IsNil)
+	pieceNums, err = pm.GetPieceProgressByCID(ctx, taskID, "cid3", PieceSuccess)
+	c.Assert(err, check.IsNil)
+	c.Check(pieceNums, check.HasLen, 0)
+
+	// the expired identities are garbage collected
+	key := generateIdentityKey("identity", taskID)
+	pm.reapClientIdentities()
+	_, err = pm.clientIdentities.Get(key)
+	c.Check(err, check.IsNil)
+	cs, err = pm.clientProgress.getAsClientState("cid3")
+	c.Assert(err, check.IsNil)
+	atomic.StoreInt64(&cs.lastSeen, time.Now().Add(-2*time.Hour).UnixNano())
+	pm.reapClientIdentities()
+	_, err = pm.clientIdentities.Get(key)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *ProgressManagerTestSuite) TestDeletePieceProgressByCID(c *check.C) {
+	ctx := context.Background()
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	pm, err := NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	taskID := "deleteTaskID"
+	c.Assert(pm.InitProgress(ctx, taskID, "superPID", cfg.GetSuperCID(taskID)), check.IsNil)
+	c.Assert(pm.InitProgress(ctx, taskID, "peer1", "cid1"), check.IsNil)
+	c.Assert(pm.InitProgress(ctx, taskID, "peer2", "cid2"), check.IsNil)
+
+	// cid2 is downloading a piece from peer1 which takes a load of peer1
+	peerState, err := pm.GetPeerStateByPeerID(ctx, "peer1")
+	c.Assert(err, check.IsNil)
+	peerState.ProducerLoad.Add(1)
+	c.Assert(pm.UpdateClientProgress(ctx, taskID, "cid2", "peer1", 0, config.PieceRUNNING), check.IsNil)
+	key, _ := generatePieceProgressKey(taskID, 0)
+	pstate, err := pm.pieceProgress.getAsPieceState(key)
+	c.Assert(err, check.IsNil)
+	c.Assert(pstate.getAssignment("cid2"), check.NotNil)
+
+	// the running piece of the deleted client is released from its source
+	c.Assert(pm.DeletePieceProgressByCID(ctx, taskID, "cid2"), check.IsNil)
+	c.Check(peerState.ProducerLoad.Get(), check.Equals, int32(0))
+	c.Check(pstate.getAssignment("cid2"), check.IsNil)
+	_, err = pm.clientProgress.getAsClientState("cid2")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *ProgressManagerTestSuite) TestRebindProgressDisabled(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.ClientIdentityTTL = 0
+	pm, err := NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	prevCID, err := pm.RebindProgress(context.Background(), "taskID", "peer1", "cid1", "identity")
+	c.Assert(err, check.IsNil)
+	c.Check(prevCID, check.Equals, "")
+	c.Check(pm.clientIdentities.ListKeyAsStringSlice(), check.HasLen, 0)
+}
+
+func (s *ProgressManagerTestSuite) TestIgnoreLateSuccessOfCancelledPiece(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	cfg.PieceDownloadTimeout = 10 * time.Millisecond
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+
+	ctx := context.Background()
+	taskID := "cancelTaskID"
+	superCID := cfg.GetSuperCID(taskID)
+	c.Assert(pm.InitProgress(ctx, taskID, "superPID", superCID), check.IsNil)
+	c.Assert(pm.UpdateProgress(ctx, taskID, superCID, "superPID", "", 0, config.PieceSUCCESS, 0), check.IsNil)
+	c.Assert(pm.InitProgress(ctx, taskID, "slow", "slowCID"), check.IsNil)
+	c.Assert(pm.InitProgress(ctx, taskID, "peer", "peerCID"), check.IsNil)
+	c.Assert(pm.UpdateProgress(ctx, taskID, "slowCID", "slow", "superPID", 0, config.PieceSUCCESS, 10), check.IsNil)
+
+	// the assignment from the slow peer is cancelled after the timeout
+	c.Assert(pm.UpdateProgress(ctx, taskID, "peerCID", "peer", "slow", 0, config.PieceRUNNING, 0), check.IsNil)
+	time.Sleep(2 * cfg.PieceDownloadTimeout)
+	stalled, err := pm.CancelStalledPieces(ctx, taskID, "peerCID", "peer")
+	c.Assert(err, check.IsNil)
+	c.Check(stalled, check.DeepEquals, map[int]string{0: "slow"})
+
+	// and its late success report neither marks the piece as downloaded by the client
+	// nor makes the client a source of the piece
+	c.Assert(pm.UpdateProgress(ctx, taskID, "peerCID", "peer", "slow", 0, config.PieceSUCCESS, 10), check.IsNil)
+	pieceNums, err := pm.GetPieceProgressByCID(ctx, taskID, "peerCID", PieceSuccess)
+	c.Assert(err, check.IsNil)
+	c.Check(pieceNums, check.HasLen, 0)
+	peerIDs, err := pm.GetPeerIDsByPieceNum(ctx, taskID, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(peerIDs, check.DeepEquals, []string{"slow"})
+
+	// but the success report of the reassignment does
+	c.Assert(pm.UpdateProgress(ctx, taskID, "peerCID", "peer", "superPID", 0, config.PieceRUNNING, 0), check.IsNil)
+	c.Assert(pm.UpdateProgress(ctx, taskID, "peerCID", "peer", "superPID", 0, config.PieceSUCCESS, 10), check.IsNil)
+	pieceNums, err = pm.GetPieceProgressByCID(ctx, taskID, "peerCID", PieceSuccess)
+	c.Assert(err, check.IsNil)
+	c.Check(pieceNums, check.DeepEquals, []int{0})
+	peerIDs, err = pm.GetPeerIDsByPieceNum(ctx, taskID, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(len(peerIDs), check.Equals, 2)
+}
+
+func (s *ProgressManagerTestSuite) TestGetPeerSources(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+
+	ctx := context.Background()
+	taskID := "sourceTaskID"
+	superCID := cfg.GetSuperCID(taskID)
+	c.Assert(pm.InitProgress(ctx, taskID, "superPID", superCID), check.IsNil)
+	c.Assert(pm.UpdateProgress(ctx, taskID, superCID, "superPID", "", 0, config.PieceSUCCESS, 0), check.IsNil)
+	c.Assert(pm.UpdateProgress(ctx, taskID, superCID, "superPID", "", 1, config.PieceSUCCESS, 0), check.IsNil)
+	c.Assert(pm.InitProgress(ctx, taskID, "source", "sourceCID"), check.IsNil)
+	c.Assert(pm.InitProgress(ctx, taskID, "peer", "peerCID"), check.IsNil)
+
+	peerState, err := pm.GetPeerStateByPeerID(ctx, "source")
+	c.Assert(err, check.IsNil)
+	atomic.StoreInt64(peerState.LastSeen, 0)
+	c.Assert(pm.UpdateProgress(ctx, taskID, "sourceCID", "source", "superPID", 0, config.PieceSUCCESS, 10), check.IsNil)
+	c.Assert(pm.UpdateProgress(ctx, taskID, "sourceCID", "source", "superPID", 1, config.PieceSUCCESS, 10), check.IsNil)
+	c.Check(atomic.LoadInt64(peerState.LastSeen) > 0, check.Equals, true)
+
+	// the peer is downloading the piece 1 from the source
+	c.Assert(pm.UpdateProgress(ctx, taskID, "peerCID", "peer", "source", 1, config.PieceRUNNING, 0), check.IsNil)
+	c.Assert(pm.updatePieceProgress("anotherTaskID", "source", 3), check.IsNil)
+
+	sources, err := pm.GetPeerSources(ctx, "source")
+	c.Assert(err, check.IsNil)
+	c.Assert(sources, check.HasLen, 2)
+	c.Check(*sources[0], check.DeepEquals, mgr.PeerSource{TaskID: "anotherTaskID", PieceNums: []int{3}})
+	c.Check(*sources[1], check.DeepEquals, mgr.PeerSource{TaskID: taskID, PieceNums: []int{0, 1}, UploadingPieceNums: []int{1}})
+
+	sources, err = pm.GetPeerSources(ctx, "peer")
+	c.Assert(err, check.IsNil)
+	c.Check(sources, check.HasLen, 0)
+}
+
+func (s *ProgressManagerTestSuite) TestCacheStats(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+
+	ctx := context.Background()
+	for _, taskID := range []string{"task1", "task2"} {
+		c.Assert(pm.InitProgress(ctx, taskID, "superPID", cfg.GetSuperCID(taskID)), check.IsNil)
+	}
+	for _, result := range []string{mgr.CacheMiss, mgr.CacheHit, mgr.CacheHit, mgr.CacheRevalidationHit} {
+		c.Assert(pm.RecordCacheResult(ctx, "task1", result), check.IsNil)
+	}
+	c.Assert(pm.RecordCacheResult(ctx, "task2", mgr.CacheHit), check.IsNil)
+	c.Check(errortypes.IsInvalidValue(pm.RecordCacheResult(ctx, "task2", "unknown")), check.Equals, true)
+	c.Check(errortypes.IsDataNotFound(pm.RecordCacheResult(ctx, "unknown", mgr.CacheHit)), check.Equals, true)
+
+	// the counts are kept for each task
+	stats, err := pm.GetCacheStats(ctx, "task1")
+	c.Assert(err, check.IsNil)
+	c.Check(stats, check.DeepEquals, &mgr.CacheStats{Hits: 2, RevalidationHits: 1, Misses: 1})
+	stats, err = pm.GetCacheStats(ctx, "task2")
+	c.Assert(err, check.IsNil)
+	c.Check(stats, check.DeepEquals, &mgr.CacheStats{Hits: 1})
+
+	// and for all the tasks by the metrics
+	c.Check(prom_testutil.ToFloat64(pm.metrics.cacheResults.WithLabelValues(mgr.CacheHit)), check.Equals, float64(3))
+	c.Check(prom_testutil.ToFloat64(pm.metrics.cacheResults.WithLabelValues(mgr.CacheRevalidationHit)), check.Equals, float64(1))
+	c.Check(prom_testutil.ToFloat64(pm.metrics.cacheResults.WithLabelValues(mgr.CacheMiss)), check.Equals, float64(1))
+}
+
+func (s *ProgressManagerTestSuite) TestGetSwarmHealth(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+
+	ctx := context.Background()
+	taskID := "swarmTaskID"
+	superCID := cfg.GetSuperCID(taskID)
+	c.Assert(pm.InitProgress(ctx, taskID, "superPID", superCID), check.IsNil)
+	for pieceNum := 0; pieceNum < 4; pieceNum++ {
+		c.Assert(pm.UpdateProgress(ctx, taskID, superCID, "superPID", "", pieceNum, config.PieceSUCCESS, 0), check.IsNil)
+	}
+	for _, peerID := range []string{"peer1", "peer2", "down", "failing"} {
+		c.Assert(pm.InitProgress(ctx, taskID, peerID, peerID+"CID"), check.IsNil)
+	}
+
+	// peer1 holds the pieces 0,1,2, peer2 holds the pieces 0,1,
+	// and the unhealthy peers hold all the pieces.
+	for pieceNum, peerIDs := range map[int][]string{
+		0: {"peer1", "peer2", "down", "failing"},
+		1: {"peer1", "peer2", "down", "failing"},
+		2: {"peer1", "down", "failing"},
+		3: {"down", "failing"},
+	} {
+		for _, peerID := range peerIDs {
+			c.Assert(pm.UpdateProgress(ctx, taskID, peerID+"CID", peerID, "superPID", pieceNum, config.PieceSUCCESS, 10), check.IsNil)
+		}
+	}
+	down, err := pm.peerProgress.getAsPeerState("down")
+	c.Assert(err, check.IsNil)
+	atomic.StoreInt64(&down.serviceDownTime, time.Now().Unix())
+	failing, err := pm.peerProgress.getAsPeerState("failing")
+	c.Assert(err, check.IsNil)
+	failing.serviceErrorCount.Set(config.EliminationLimit)
+
+	health, err := pm.GetSwarmHealth(ctx, taskID, 4)
+	c.Assert(err, check.IsNil)
+	c.Check(*health, check.DeepEquals, mgr.SwarmHealth{
+		HealthySources:  2,
+		MinReplication:  0,
+		AvgReplication:  1.25,
+		AvailablePieces: 3,
+	})
+
+	health, err = pm.GetSwarmHealth(ctx, taskID, 2)
+	c.Assert(err, check.IsNil)
+	c.Check(*health, check.DeepEquals, mgr.SwarmHealth{
+		HealthySources:  2,
+		MinReplication:  2,
+		AvgReplication:  2,
+		AvailablePieces: 2,
+	})
+
+	// the piece total is unknown yet
+	health, err = pm.GetSwarmHealth(ctx, taskID, -1)
+	c.Assert(err, check.IsNil)
+	c.Check(*health, check.DeepEquals, mgr.SwarmHealth{})
+}
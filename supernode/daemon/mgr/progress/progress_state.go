@@ -17,6 +17,8 @@
 package progress
 
 import (
+	"time"
+
 	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 
@@ -27,6 +29,31 @@ type superState struct {
 	// pieceBitSet maintains the piece bitSet of CID
 	// which means that the status of each pieces of the task corresponding to taskID on the supernode.
 	pieceBitSet *bitset.BitSet
+
+	// pieceMD5s maintains the md5 of each pieces downloaded by supernode.
+	// key:pieceNum,value:md5
+	pieceMD5s *syncmap.SyncMap
+
+	// createTime is the time when the task was registered and supernode started to download it.
+	createTime time.Time
+
+	// firstPieceTime is the time when the first piece of the task became available on supernode.
+	// It's set only once and protected by the lock of the pieceBitSet.
+	firstPieceTime time.Time
+
+	// servedBytes is the bytes of the pieces that the peers successfully downloaded
+	// from supernode and the other peers. It should be accessed atomically.
+	servedBytes int64
+
+	// cacheHits, cacheRevalidationHits and cacheMisses are the counts of the results
+	// of looking up the cache of the task. They should be accessed atomically.
+	cacheHits             int64
+	cacheRevalidationHits int64
+	cacheMisses           int64
+
+	// events is the bounded history of the events of the task,
+	// which is nil if the history is disabled.
+	events *taskEvents
 }
 
 type clientState struct {
@@ -37,6 +64,11 @@ type clientState struct {
 	// runningPiece maintains the pieces currently being downloaded from dstCID to srcCID.
 	// key:pieceNum,value:dstPID
 	runningPiece *syncmap.SyncMap
+
+	// lastSeen is the time in nanoseconds when the client registered or updated its progress
+	// last time, which decides whether the progress can be resumed with the client identity.
+	// It should be accessed atomically.
+	lastSeen int64
 }
 
 type peerState struct {
@@ -59,11 +91,29 @@ type peerState struct {
 
 	// serviceDownTime the down time of the peer service.
 	serviceDownTime int64
+
+	// serviceSuccessCount maintains the number of times that the other peer nodes
+	// successfully downloaded from the PeerID, which will be reset when it fails during the warmup.
+	serviceSuccessCount *atomiccount.AtomicInt
+
+	// servedBytes is the bytes of the pieces that the other peer nodes successfully downloaded from the PeerID.
+	// It should be accessed atomically.
+	servedBytes int64
+
+	// consumedBytes is the bytes of the pieces that the PeerID successfully downloaded
+	// from the other peer nodes and supernode. It should be accessed atomically.
+	consumedBytes int64
+
+	// lastSeen is the time in nanoseconds when a client of the PeerID registered
+	// or reported its progress last time. It should be accessed atomically.
+	lastSeen int64
 }
 
 func newSuperState() *superState {
 	return &superState{
 		pieceBitSet: &bitset.BitSet{},
+		pieceMD5s:   syncmap.NewSyncMap(),
+		createTime:  time.Now(),
 	}
 }
 
@@ -71,13 +121,16 @@ func newClientState() *clientState {
 	return &clientState{
 		pieceBitSet:  &bitset.BitSet{},
 		runningPiece: syncmap.NewSyncMap(),
+		lastSeen:     time.Now().UnixNano(),
 	}
 }
 
 func newPeerState() *peerState {
 	return &peerState{
-		producerLoad:      atomiccount.NewAtomicInt(0),
-		clientErrorCount:  atomiccount.NewAtomicInt(0),
-		serviceErrorCount: atomiccount.NewAtomicInt(0),
+		producerLoad:        atomiccount.NewAtomicInt(0),
+		clientErrorCount:    atomiccount.NewAtomicInt(0),
+		serviceErrorCount:   atomiccount.NewAtomicInt(0),
+		serviceSuccessCount: atomiccount.NewAtomicInt(0),
+		lastSeen:            time.Now().UnixNano(),
 	}
 }
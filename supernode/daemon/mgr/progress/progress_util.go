@@ -19,12 +19,16 @@ package progress
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -33,28 +37,11 @@ import (
 
 // updatePieceProgress added a new peer for the pieceNum when the srcPID successfully downloads the piece.
 func (pm *Manager) updatePieceProgress(taskID, srcPID string, pieceNum int) error {
-	key, err := generatePieceProgressKey(taskID, pieceNum)
+	pstate, err := pm.getOrAddPieceState(taskID, pieceNum)
 	if err != nil {
 		return err
 	}
 
-	pstate, err := pm.pieceProgress.getAsPieceState(key)
-	if err != nil {
-		if !errortypes.IsDataNotFound(err) {
-			return err
-		}
-
-		// initialize a PieceState if not found.
-		if err := pm.pieceProgress.add(key, newPieceState()); err != nil {
-			return err
-		}
-
-		// reacquisition after initialization.
-		if pstate, err = pm.pieceProgress.getAsPieceState(key); err != nil {
-			return err
-		}
-	}
-
 	// don't add the superPID to pieceState which maintains the information
 	// about which peers the piece currently exists on.
 	if pm.cfg.IsSuperPID(srcPID) {
@@ -64,32 +51,176 @@ func (pm *Manager) updatePieceProgress(taskID, srcPID string, pieceNum int) erro
 	return pstate.add(srcPID)
 }
 
+// getOrAddPieceState returns the pieceState of the pieceNum of taskID,
+// and initializes one if not found.
+func (pm *Manager) getOrAddPieceState(taskID string, pieceNum int) (*pieceState, error) {
+	key, err := generatePieceProgressKey(taskID, pieceNum)
+	if err != nil {
+		return nil, err
+	}
+
+	pstate, err := pm.pieceProgress.getAsPieceState(key)
+	if err == nil || !errortypes.IsDataNotFound(err) {
+		return pstate, err
+	}
+
+	// initialize a PieceState if not found,
+	// and use the one added by others concurrently if any.
+	v, err := pm.pieceProgress.loadOrAdd(key, newPieceState())
+	if err != nil {
+		return nil, err
+	}
+	pstate, ok := v.(*pieceState)
+	if !ok {
+		return nil, errors.Wrapf(errortypes.ErrConvertFailed, "key %s: %v", key, v)
+	}
+	return pstate, nil
+}
+
 // updateClientProgress updates the client progress when clientID is not a supernode,
 // otherwise update the super progress.
-func (pm *Manager) updateClientProgress(taskID, srcCID, dstPID string, pieceNum, pieceStatus int) (bool, error) {
+func (pm *Manager) updateClientProgress(taskID, srcCID, srcPID, dstPID string, pieceNum, pieceStatus int) (bool, error) {
 	// update piece bitSet
 	if pm.cfg.IsSuperCID(srcCID) {
 		ss, err := pm.superProgress.getAsSuperState(taskID)
 		if err != nil {
 			return false, err
 		}
-		return updatePieceBitSet(ss.pieceBitSet, pieceNum, pieceStatus), nil
+
+		pm.bitSetLocker.GetLock(superStateLockKey(taskID), false)
+		defer pm.bitSetLocker.ReleaseLock(superStateLockKey(taskID), false)
+		result := updatePieceBitSet(ss.pieceBitSet, pieceNum, pieceStatus)
+		if result && pieceStatus == config.PieceSUCCESS {
+			pm.updateFirstPieceTime(taskID, ss)
+			pm.taskWatchers.notify(taskID)
+		}
+		return result, nil
 	}
 
 	cs, err := pm.clientProgress.getAsClientState(srcCID)
 	if err != nil {
 		return false, err
 	}
+	atomic.StoreInt64(&cs.lastSeen, time.Now().UnixNano())
+
+	// the running piece and the bitSet should be updated atomically,
+	// and only the first one of the duplicate reports of a piece takes effect.
+	pm.bitSetLocker.GetLock(srcCID, false)
+	defer pm.bitSetLocker.ReleaseLock(srcCID, false)
+
+	// ignore the report of the assignment which has been cancelled since it timed out
+	pstate, err := pm.getOrAddPieceState(taskID, pieceNum)
+	if err != nil {
+		return false, err
+	}
+	if pieceStatus != config.PieceRUNNING && pstate.isCancelled(srcCID, dstPID) {
+		logrus.Warnf("ignore the report of the cancelled assignment of pieceNum(%d) taskID(%s) srcCID(%s) dstPID(%s)",
+			pieceNum, taskID, srcCID, dstPID)
+		pstate.cancelled.Remove(srcCID)
+		// and the srcPID added by the ignored success report is removed,
+		// unless srcCID has downloaded the piece before.
+		if pieceStatus == config.PieceSUCCESS && !stringutils.IsEmptyStr(srcPID) &&
+			!cs.pieceBitSet.Test(uint(getStartIndexByPieceNum(pieceNum)+config.PieceSUCCESS)) {
+			pstate.delete(srcPID)
+		}
+		return false, nil
+	}
 
 	// update running piece
 	err = updateRunningPiece(cs.runningPiece, srcCID, dstPID, pieceNum, pieceStatus)
 	if err != nil {
 		return false, err
 	}
+	if pieceStatus == config.PieceRUNNING && !stringutils.IsEmptyStr(dstPID) {
+		if err := pstate.assign(srcCID, dstPID); err != nil {
+			return false, err
+		}
+	} else {
+		pstate.unassign(srcCID)
+	}
 
 	return updatePieceBitSet(cs.pieceBitSet, pieceNum, pieceStatus), nil
 }
 
+// releaseRunningPieces releases the loads of the peers serving the pieces being downloaded
+// by clientID and removes the assignments of them, which will never be reported.
+// The caller should hold the lock of the piece bitSet of clientID.
+func (pm *Manager) releaseRunningPieces(taskID, clientID string, cs *clientState) {
+	for _, pieceNum := range cs.runningPiece.ListKeyAsIntSlice() {
+		pieceNumString := strconv.Itoa(pieceNum)
+		if dstPID, err := cs.runningPiece.GetAsString(pieceNumString); err == nil {
+			if dstPeerState, err := pm.peerProgress.getAsPeerState(dstPID); err == nil && dstPeerState.producerLoad != nil {
+				updateProducerLoad(dstPeerState.producerLoad, taskID, dstPID, pieceNum, config.PieceFAILED)
+			}
+		}
+		if key, err := generatePieceProgressKey(taskID, pieceNum); err == nil {
+			if pstate, err := pm.pieceProgress.getAsPieceState(key); err == nil {
+				pstate.unassign(clientID)
+				pstate.cancelled.Remove(clientID)
+			}
+		}
+		cs.runningPiece.Remove(pieceNumString)
+	}
+}
+
+// cancelStalledPiece cancels the assignment of the pieceNum to srcCID if it has been running
+// longer than the timeout, and the piece is marked as failed to be rescheduled.
+// It returns the source of the cancelled assignment, or false if it's not cancelled.
+func (pm *Manager) cancelStalledPiece(taskID, srcCID string, cs *clientState, pieceNum int, timeout time.Duration) (string, bool) {
+	return pm.cancelRunningPiece(taskID, srcCID, cs, pieceNum, func(assignment *pieceAssignment) bool {
+		return time.Since(assignment.startTime) >= timeout
+	})
+}
+
+// cancelRunningPiece cancels the assignment of the pieceNum to srcCID if the assignment
+// is cancelable, and the piece is marked as failed to be rescheduled.
+// It returns the source of the cancelled assignment, or false if it's not cancelled.
+func (pm *Manager) cancelRunningPiece(taskID, srcCID string, cs *clientState, pieceNum int,
+	cancelable func(assignment *pieceAssignment) bool) (string, bool) {
+	key, err := generatePieceProgressKey(taskID, pieceNum)
+	if err != nil {
+		return "", false
+	}
+	pstate, err := pm.pieceProgress.getAsPieceState(key)
+	if err != nil {
+		return "", false
+	}
+
+	pm.bitSetLocker.GetLock(srcCID, false)
+	defer pm.bitSetLocker.ReleaseLock(srcCID, false)
+
+	assignment := pstate.getAssignment(srcCID)
+	if assignment == nil || !cancelable(assignment) {
+		return "", false
+	}
+	if err := updateRunningPiece(cs.runningPiece, srcCID, assignment.dstPID, pieceNum, config.PieceFAILED); err != nil {
+		return "", false
+	}
+	if err := pstate.cancel(srcCID, assignment.dstPID); err != nil {
+		return "", false
+	}
+	updatePieceBitSet(cs.pieceBitSet, pieceNum, config.PieceFAILED)
+	return assignment.dstPID, true
+}
+
+// updateFirstPieceTime records the time when the first piece of the task
+// became available on supernode. It should be called with the lock of ss.pieceBitSet held.
+func (pm *Manager) updateFirstPieceTime(taskID string, ss *superState) {
+	if !ss.firstPieceTime.IsZero() {
+		return
+	}
+
+	ss.firstPieceTime = time.Now()
+	duration := ss.firstPieceTime.Sub(ss.createTime)
+	pm.metrics.firstPieceDurationSeconds.WithLabelValues().Observe(duration.Seconds())
+	logrus.Infof("the first piece of taskID(%s) is available after %v", taskID, duration)
+	ss.events.add(mgr.TaskEvent{
+		Time:   ss.firstPieceTime,
+		Type:   mgr.TaskEventFirstPiece,
+		Detail: fmt.Sprintf("available after %v", duration),
+	})
+}
+
 // updateRunningPiece update the relationship between the running piece and srcCID and dstPID,
 // which means the info that records the pieces being downloaded from dstPID to srcCID.
 func updateRunningPiece(dstPIDMap *syncmap.SyncMap, srcCID, dstPID string, pieceNum, pieceStatus int) error {
@@ -131,12 +262,13 @@ func updatePieceBitSet(pieceBitSet *bitset.BitSet, pieceNum, pieceStatus int) bo
 }
 
 // updatePeerProgress update the peer progress.
-func (pm *Manager) updatePeerProgress(taskID, srcPID, dstPID string, pieceNum, pieceStatus int) error {
+func (pm *Manager) updatePeerProgress(taskID, srcPID, dstPID string, pieceNum, pieceStatus int, pieceSize int32) error {
 	var dstPeerState *peerState
 
 	// update producerLoad of dstPID
 	if !stringutils.IsEmptyStr(dstPID) {
-		dstPeerState, err := pm.peerProgress.getAsPeerState(dstPID)
+		var err error
+		dstPeerState, err = pm.peerProgress.getAsPeerState(dstPID)
 		if err != nil && !errortypes.IsDataNotFound(err) {
 			return err
 		}
@@ -148,6 +280,11 @@ func (pm *Manager) updatePeerProgress(taskID, srcPID, dstPID string, pieceNum, p
 		}
 	}
 
+	if pieceStatus == config.PieceSUCCESS {
+		pm.updatePeerTraffic(srcPID, dstPID, dstPeerState, pieceSize)
+		pm.updateTaskTraffic(taskID, srcPID, pieceSize)
+	}
+
 	if !pm.needUpdatePeerInfo(srcPID, dstPID) {
 		return nil
 	}
@@ -158,18 +295,59 @@ func (pm *Manager) updatePeerProgress(taskID, srcPID, dstPID string, pieceNum, p
 	}
 
 	// update ClientErrorInfo/serviceErrorInfo
+	// NOTE: the serviceErrorInfo of dstPID is not updated by the reports of the clients,
+	// and only the warmup of dstPID is maintained.
 	if pieceStatus == config.PieceSUCCESS || pieceStatus == config.PieceSEMISUC {
-		processPeerSucInfo(srcPeerState, dstPeerState)
+		processPeerSucInfo(srcPeerState, nil)
+		addServiceSuccess(dstPeerState)
 	}
 	if pieceStatus == config.PieceFAILED {
 		if err := pm.updateBlackInfo(srcPID, dstPID); err != nil {
 			return err
 		}
-		processPeerFailInfo(srcPeerState, dstPeerState)
+		processPeerFailInfo(srcPeerState, nil)
+		pm.resetWarmup(dstPID, dstPeerState)
 	}
 	return nil
 }
 
+// updatePeerTraffic accounts the bytes of the piece which srcPID successfully
+// downloaded from dstPID, and the supernode is excluded from the accounting.
+func (pm *Manager) updatePeerTraffic(srcPID, dstPID string, dstPeerState *peerState, pieceSize int32) {
+	if pieceSize <= 0 {
+		return
+	}
+
+	if dstPeerState != nil && !pm.cfg.IsSuperPID(dstPID) {
+		atomic.AddInt64(&dstPeerState.servedBytes, int64(pieceSize))
+		pm.metrics.peerServedBytes.WithLabelValues(dstPID).Add(float64(pieceSize))
+	}
+
+	if stringutils.IsEmptyStr(srcPID) || pm.cfg.IsSuperPID(srcPID) {
+		return
+	}
+	srcPeerState, err := pm.peerProgress.getAsPeerState(srcPID)
+	if err != nil {
+		return
+	}
+	atomic.AddInt64(&srcPeerState.consumedBytes, int64(pieceSize))
+	pm.metrics.peerConsumedBytes.WithLabelValues(srcPID).Add(float64(pieceSize))
+}
+
+// updateTaskTraffic accounts the bytes of the piece which srcPID successfully
+// downloaded for taskID, and the pieces downloaded by supernode are excluded.
+func (pm *Manager) updateTaskTraffic(taskID, srcPID string, pieceSize int32) {
+	if pieceSize <= 0 || stringutils.IsEmptyStr(srcPID) || pm.cfg.IsSuperPID(srcPID) {
+		return
+	}
+
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return
+	}
+	atomic.AddInt64(&ss.servedBytes, int64(pieceSize))
+}
+
 func (pm *Manager) updateBlackInfo(srcPID, dstPID string) error {
 	// update black List
 	blackList, err := pm.clientBlackInfo.GetAsMap(srcPID)
@@ -210,6 +388,33 @@ func processPeerSucInfo(srcPeerState, dstPeerState *peerState) {
 	}
 }
 
+// addServiceSuccess adds one to the count of successful services
+// when srcCID successfully downloads a piece from dstPID.
+func addServiceSuccess(dstPeerState *peerState) {
+	if dstPeerState == nil {
+		return
+	}
+
+	if dstPeerState.serviceSuccessCount != nil {
+		dstPeerState.serviceSuccessCount.Add(1)
+	} else {
+		dstPeerState.serviceSuccessCount = atomiccount.NewAtomicInt(1)
+	}
+}
+
+// resetWarmup restarts the slow start warmup of dstPID
+// when it fails to provide the service before the warmup finishes.
+func (pm *Manager) resetWarmup(dstPID string, dstPeerState *peerState) {
+	if dstPeerState == nil || dstPeerState.serviceSuccessCount == nil {
+		return
+	}
+
+	if count := dstPeerState.serviceSuccessCount.Get(); count < int32(pm.cfg.SlowStartWarmupPieces) {
+		dstPeerState.serviceSuccessCount.Set(0)
+		logrus.Infof("reset the slow start warmup of peerID(%s) after serving %d pieces successfully", dstPID, count)
+	}
+}
+
 // processPeerFailInfo adds one to the count of errors
 // when srcCID failed to download a piece from dstPID.
 func processPeerFailInfo(srcPeerState, dstPeerState *peerState) {
@@ -260,6 +465,11 @@ func (pm *Manager) needUpdatePeerInfo(srcPID, dstPID string) bool {
 	return true
 }
 
+// superStateLockKey returns the key of bitSetLocker for the superState of taskID.
+func superStateLockKey(taskID string) string {
+	return "super@" + taskID
+}
+
 // generatePieceProgressKey returns a string as the key of PieceProgress.
 func generatePieceProgressKey(taskID string, pieceNum int) (string, error) {
 	if stringutils.IsEmptyStr(taskID) || pieceNum < 0 {
@@ -269,6 +479,19 @@ func generatePieceProgressKey(taskID string, pieceNum int) (string, error) {
 	return fmt.Sprintf("%d@%s", pieceNum, taskID), nil
 }
 
+// parsePieceProgressKey returns the taskID and the pieceNum of the key of PieceProgress.
+func parsePieceProgressKey(key string) (string, int, bool) {
+	parts := strings.SplitN(key, "@", 2)
+	if len(parts) != 2 || stringutils.IsEmptyStr(parts[1]) {
+		return "", -1, false
+	}
+	pieceNum, err := strconv.Atoi(parts[0])
+	if err != nil || pieceNum < 0 {
+		return "", -1, false
+	}
+	return parts[1], pieceNum, true
+}
+
 func getStartIndexByPieceNum(pieceNum int) int {
 	return pieceNum * 8
 }
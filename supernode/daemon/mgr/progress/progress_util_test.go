@@ -17,10 +17,16 @@
 package progress
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
 	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 
 	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/willf/bitset"
 )
 
@@ -88,7 +94,7 @@ func (s *ProgressUtilTestSuite) TestUpdatePieceBitset(c *check.C) {
 }
 
 func (s *ProgressUtilTestSuite) TestUpdateBlackInfo(c *check.C) {
-	pm, _ := NewManager(nil)
+	pm, _ := NewManager(nil, prometheus.NewRegistry())
 
 	updateAndCheckBlackInfo(pm, "src0", "dst0", 1, c)
 
@@ -108,3 +114,105 @@ func updateAndCheckBlackInfo(pm *Manager, srcPID, dstPID string, expected int32,
 	c.Check(err, check.IsNil)
 	c.Check(count.Get(), check.Equals, atomiccount.NewAtomicInt(expected).Get())
 }
+
+func (s *ProgressUtilTestSuite) TestUpdatePeerProgressWarmup(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("superPID")
+	cfg.SlowStartWarmupPieces = 3
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+	pm.peerProgress.add("src", newPeerState())
+	pm.peerProgress.add("dst", newPeerState())
+	dstPeerState, err := pm.peerProgress.getAsPeerState("dst")
+	c.Assert(err, check.IsNil)
+
+	// the failure during the warmup resets the count of successful services
+	for i := 0; i < 2; i++ {
+		c.Check(pm.updatePeerProgress("task", "src", "dst", i, config.PieceSUCCESS, 0), check.IsNil)
+	}
+	c.Check(dstPeerState.serviceSuccessCount.Get(), check.Equals, int32(2))
+	c.Check(pm.updatePeerProgress("task", "src", "dst", 2, config.PieceFAILED, 0), check.IsNil)
+	c.Check(dstPeerState.serviceSuccessCount.Get(), check.Equals, int32(0))
+
+	// the failure after the warmup does not reset the count
+	for i := 0; i < 3; i++ {
+		c.Check(pm.updatePeerProgress("task", "src", "dst", i, config.PieceSUCCESS, 0), check.IsNil)
+	}
+	c.Check(dstPeerState.serviceSuccessCount.Get(), check.Equals, int32(3))
+	c.Check(pm.updatePeerProgress("task", "src", "dst", 3, config.PieceFAILED, 0), check.IsNil)
+	c.Check(dstPeerState.serviceSuccessCount.Get(), check.Equals, int32(3))
+}
+
+func (s *ProgressUtilTestSuite) TestUpdatePeerProgressServiceInfo(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("superPID")
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+	pm.peerProgress.add("src", newPeerState())
+	pm.peerProgress.add("dst", newPeerState())
+	srcPeerState, err := pm.peerProgress.getAsPeerState("src")
+	c.Assert(err, check.IsNil)
+	dstPeerState, err := pm.peerProgress.getAsPeerState("dst")
+	c.Assert(err, check.IsNil)
+
+	// the failures count the client errors of src,
+	// but not the service errors of dst
+	for i := 0; i < config.EliminationLimit; i++ {
+		c.Check(pm.updatePeerProgress("task", "src", "dst", i, config.PieceFAILED, 0), check.IsNil)
+	}
+	c.Check(srcPeerState.clientErrorCount.Get(), check.Equals, int32(config.EliminationLimit))
+	c.Check(dstPeerState.serviceErrorCount.Get(), check.Equals, int32(0))
+
+	// and the success resets the client errors of src
+	c.Check(pm.updatePeerProgress("task", "src", "dst", 0, config.PieceSUCCESS, 0), check.IsNil)
+	c.Check(srcPeerState.clientErrorCount.Get(), check.Equals, int32(0))
+}
+
+func (s *ProgressUtilTestSuite) TestUpdateProgressWithDuplicateReports(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+
+	var (
+		ctx      = context.Background()
+		taskID   = "task"
+		srcCount = 4
+		repeat   = 20
+	)
+	c.Assert(pm.InitProgress(ctx, taskID, cfg.GetSuperPID(), cfg.GetSuperCID(taskID)), check.IsNil)
+	var srcPIDs []string
+	for i := 0; i < srcCount; i++ {
+		srcPID := fmt.Sprintf("src%d", i)
+		c.Assert(pm.InitProgress(ctx, taskID, srcPID, "cid"+srcPID), check.IsNil)
+		srcPIDs = append(srcPIDs, srcPID)
+	}
+	c.Assert(pm.InitProgress(ctx, taskID, "dst", "ciddst"), check.IsNil)
+	dstPeerState, err := pm.peerProgress.getAsPeerState("dst")
+	c.Assert(err, check.IsNil)
+	dstPeerState.producerLoad.Set(int32(srcCount + 1))
+
+	// every peer reports the same piece repeatedly and concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < repeat; i++ {
+		for _, srcPID := range srcPIDs {
+			wg.Add(1)
+			go func(srcPID string) {
+				defer wg.Done()
+				err := pm.UpdateProgress(ctx, taskID, "cid"+srcPID, srcPID, "dst", 0, config.PieceSUCCESS, 0)
+				c.Check(err, check.IsNil)
+			}(srcPID)
+		}
+	}
+	wg.Wait()
+
+	peerIDs, err := pm.GetPeerIDsByPieceNum(ctx, taskID, 0)
+	c.Assert(err, check.IsNil)
+	sort.Strings(peerIDs)
+	c.Check(peerIDs, check.DeepEquals, srcPIDs)
+	c.Check(dstPeerState.producerLoad.Get(), check.Equals, int32(1))
+	c.Check(dstPeerState.serviceSuccessCount.Get(), check.Equals, int32(srcCount))
+	for _, srcPID := range srcPIDs {
+		cs, err := pm.clientProgress.getAsClientState("cid" + srcPID)
+		c.Assert(err, check.IsNil)
+		c.Check(cs.pieceBitSet.Count(), check.Equals, uint(1))
+	}
+}
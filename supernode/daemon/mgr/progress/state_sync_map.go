@@ -18,7 +18,9 @@ package progress
 
 import (
 	"sync"
+	"time"
 
+	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
 
@@ -26,13 +28,30 @@ import (
 )
 
 // stateSyncMap is a thread-safe map.
+//
+// It keeps track of the number of live and removed keys so that
+// the underlying *sync.Map could be rebuilt to reclaim the memory
+// held by the removed keys when there are too many of them.
 type stateSyncMap struct {
-	*sync.Map
+	// rwLock protects the underlying map from being replaced
+	// while other operations are in progress.
+	rwLock sync.RWMutex
+	m      *sync.Map
+
+	liveCount    *atomiccount.AtomicInt
+	removedCount *atomiccount.AtomicInt
+
+	// recorder records the operations into the metrics if it's not nil.
+	recorder *mapRecorder
 }
 
 // newStateSyncMap returns a new stateSyncMap.
 func newStateSyncMap() *stateSyncMap {
-	return &stateSyncMap{&sync.Map{}}
+	return &stateSyncMap{
+		m:            &sync.Map{},
+		liveCount:    atomiccount.NewAtomicInt(0),
+		removedCount: atomiccount.NewAtomicInt(0),
+	}
 }
 
 // add a key-value pair into the *sync.Map.
@@ -41,19 +60,48 @@ func (mmap *stateSyncMap) add(key string, value interface{}) error {
 	if stringutils.IsEmptyStr(key) {
 		return errors.Wrap(errortypes.ErrEmptyValue, "key")
 	}
-	mmap.Store(key, value)
+
+	start := mmap.rLock(mapOpAdd)
+	defer mmap.rUnlock(mapOpAdd, start, nil)
+
+	if _, loaded := mmap.m.LoadOrStore(key, value); loaded {
+		mmap.m.Store(key, value)
+		return nil
+	}
+	mmap.liveCount.Add(1)
 	return nil
 }
 
+// loadOrAdd returns the existing value for the key if present.
+// Otherwise, it adds the key-value pair and returns the given value.
+// The ErrEmptyValue error will be returned if the key is empty.
+func (mmap *stateSyncMap) loadOrAdd(key string, value interface{}) (interface{}, error) {
+	if stringutils.IsEmptyStr(key) {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "key")
+	}
+
+	start := mmap.rLock(mapOpLoadOrAdd)
+	defer mmap.rUnlock(mapOpLoadOrAdd, start, nil)
+
+	actual, loaded := mmap.m.LoadOrStore(key, value)
+	if !loaded {
+		mmap.liveCount.Add(1)
+	}
+	return actual, nil
+}
+
 // get returns result as interface{} according to the key.
 // The ErrEmptyValue error will be returned if the key is empty.
 // And the ErrDataNotFound error will be returned if the key cannot be found.
-func (mmap *stateSyncMap) get(key string) (interface{}, error) {
+func (mmap *stateSyncMap) get(key string) (v interface{}, err error) {
 	if stringutils.IsEmptyStr(key) {
 		return nil, errors.Wrap(errortypes.ErrEmptyValue, "key")
 	}
 
-	if v, ok := mmap.Load(key); ok {
+	start := mmap.rLock(mapOpGet)
+	defer func() { mmap.rUnlock(mapOpGet, start, err) }()
+
+	if v, ok := mmap.m.Load(key); ok {
 		return v, nil
 	}
 
@@ -71,7 +119,7 @@ func (mmap *stateSyncMap) getAsSuperState(key string) (*superState, error) {
 	if value, ok := v.(*superState); ok {
 		return value, nil
 	}
-	return nil, errors.Wrapf(errortypes.ErrConvertFailed, "key %s: %v", key, v)
+	return nil, mmap.convertFailed(key, v)
 }
 
 // getAsClientState returns result as *clientState.
@@ -85,7 +133,7 @@ func (mmap *stateSyncMap) getAsClientState(key string) (*clientState, error) {
 	if value, ok := v.(*clientState); ok {
 		return value, nil
 	}
-	return nil, errors.Wrapf(errortypes.ErrConvertFailed, "key %s: %v", key, v)
+	return nil, mmap.convertFailed(key, v)
 }
 
 // getAsPeerState returns result as *peerState.
@@ -99,7 +147,7 @@ func (mmap *stateSyncMap) getAsPeerState(key string) (*peerState, error) {
 	if value, ok := v.(*peerState); ok {
 		return value, nil
 	}
-	return nil, errors.Wrapf(errortypes.ErrConvertFailed, "key %s: %v", key, v)
+	return nil, mmap.convertFailed(key, v)
 }
 
 // getAsPieceState returns result as *pieceState.
@@ -113,21 +161,117 @@ func (mmap *stateSyncMap) getAsPieceState(key string) (*pieceState, error) {
 	if value, ok := v.(*pieceState); ok {
 		return value, nil
 	}
-	return nil, errors.Wrapf(errortypes.ErrConvertFailed, "key %s: %v", key, v)
+	return nil, mmap.convertFailed(key, v)
+}
+
+// convertFailed returns the ErrConvertFailed error of the value of the key
+// which is not of the expected type.
+func (mmap *stateSyncMap) convertFailed(key string, v interface{}) error {
+	err := errors.Wrapf(errortypes.ErrConvertFailed, "key %s: %v", key, v)
+	mmap.recorder.end(mapOpGet, time.Time{}, err)
+	return err
 }
 
 // remove deletes the key-value pair from the mmap.
 // The ErrEmptyValue error will be returned if the key is empty.
 // And the ErrDataNotFound error will be returned if the key cannot be found.
-func (mmap *stateSyncMap) remove(key string) error {
+func (mmap *stateSyncMap) remove(key string) (err error) {
 	if stringutils.IsEmptyStr(key) {
 		return errors.Wrap(errortypes.ErrEmptyValue, "key")
 	}
 
-	if _, ok := mmap.Load(key); !ok {
+	// the write lock makes the check and the deletion atomic, otherwise the concurrent
+	// removals of the same key would both pass the check and corrupt the counts.
+	start := mmap.lock(mapOpRemove)
+	defer func() { mmap.unlock(mapOpRemove, start, err) }()
+
+	if _, ok := mmap.m.Load(key); !ok {
 		return errors.Wrapf(errortypes.ErrDataNotFound, "key: %s", key)
 	}
 
-	mmap.Delete(key)
+	mmap.m.Delete(key)
+	mmap.liveCount.Add(-1)
+	mmap.removedCount.Add(1)
 	return nil
 }
+
+// rLock acquires the read lock for the operation op,
+// and returns the start time of the operation if it's sampled by the recorder.
+func (mmap *stateSyncMap) rLock(op string) time.Time {
+	start := mmap.recorder.begin()
+	mmap.rwLock.RLock()
+	mmap.recorder.locked(op, start)
+	return start
+}
+
+// rUnlock releases the read lock acquired by rLock and records the operation op.
+func (mmap *stateSyncMap) rUnlock(op string, start time.Time, err error) {
+	mmap.rwLock.RUnlock()
+	mmap.recorder.end(op, start, err)
+}
+
+// lock acquires the write lock for the operation op,
+// and returns the start time of the operation if it's sampled by the recorder.
+func (mmap *stateSyncMap) lock(op string) time.Time {
+	start := mmap.recorder.begin()
+	mmap.rwLock.Lock()
+	mmap.recorder.locked(op, start)
+	return start
+}
+
+// unlock releases the write lock acquired by lock and records the operation op.
+func (mmap *stateSyncMap) unlock(op string, start time.Time, err error) {
+	mmap.rwLock.Unlock()
+	mmap.recorder.end(op, start, err)
+}
+
+// listKeys returns all keys of the mmap as a string slice.
+func (mmap *stateSyncMap) listKeys() (keys []string) {
+	mmap.rwLock.RLock()
+	defer mmap.rwLock.RUnlock()
+
+	mmap.m.Range(func(key, value interface{}) bool {
+		if v, ok := key.(string); ok {
+			keys = append(keys, v)
+		}
+		return true
+	})
+	return
+}
+
+// needCompact returns whether the ratio of removed keys to live keys
+// reaches the specified ratio.
+func (mmap *stateSyncMap) needCompact(ratio float64) bool {
+	removed := mmap.removedCount.Get()
+	if removed <= 0 {
+		return false
+	}
+
+	live := mmap.liveCount.Get()
+	if live <= 0 {
+		return true
+	}
+	return float64(removed)/float64(live) >= ratio
+}
+
+// compact rebuilds the underlying *sync.Map with the live keys only
+// to reclaim the memory held by the removed keys.
+//
+// The other operations are blocked only while the live keys are copied,
+// which is cheap compared with the removed keys it gets rid of.
+func (mmap *stateSyncMap) compact() {
+	mmap.rwLock.Lock()
+	defer mmap.rwLock.Unlock()
+
+	var live int32
+	fresh := &sync.Map{}
+	mmap.m.Range(func(key, value interface{}) bool {
+		fresh.Store(key, value)
+		live++
+		return true
+	})
+
+	mmap.m = fresh
+	mmap.liveCount.Set(live)
+	mmap.removedCount.Set(0)
+}
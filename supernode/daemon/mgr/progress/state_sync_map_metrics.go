@@ -0,0 +1,122 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The operations on the stateSyncMap recorded into the metrics.
+const (
+	mapOpAdd       = "add"
+	mapOpLoadOrAdd = "loadOrAdd"
+	mapOpGet       = "get"
+	mapOpRemove    = "remove"
+)
+
+// The errors of the operations on the stateSyncMap counted into the metrics.
+const (
+	mapErrDataNotFound  = "dataNotFound"
+	mapErrConvertFailed = "convertFailed"
+)
+
+// mapRecorder records the operations on a stateSyncMap into the metrics.
+//
+// Only one of every sample operations is timed to keep the overhead on the fast path low,
+// while all the errors are counted since they are rare and usually indicate a bug.
+// A nil *mapRecorder records nothing.
+type mapRecorder struct {
+	sample   uint32
+	ops      uint32
+	duration prometheus.ObserverVec
+	lockWait prometheus.ObserverVec
+	errors   *prometheus.CounterVec
+}
+
+// newMapRecorder returns the recorder of the map with the name,
+// or nil if the instrumentation is disabled.
+func newMapRecorder(m *metrics, name string, sample int) *mapRecorder {
+	if sample <= 0 {
+		return nil
+	}
+
+	labels := prometheus.Labels{"map": name}
+	return &mapRecorder{
+		sample:   uint32(sample),
+		duration: m.progressMapOperationDurationSeconds.MustCurryWith(labels),
+		lockWait: m.progressMapLockWaitSeconds.MustCurryWith(labels),
+		errors:   m.progressMapErrors.MustCurryWith(labels),
+	}
+}
+
+// begin returns the start time of the operation if it's sampled, and the zero time otherwise.
+func (r *mapRecorder) begin() time.Time {
+	if r == nil || atomic.AddUint32(&r.ops, 1)%r.sample != 0 {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// locked records the time the sampled operation waited for the lock.
+func (r *mapRecorder) locked(op string, start time.Time) {
+	if r == nil || start.IsZero() {
+		return
+	}
+	r.lockWait.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// end records the latency of the sampled operation and counts the error it returns.
+func (r *mapRecorder) end(op string, start time.Time, err error) {
+	if r == nil {
+		return
+	}
+	if !start.IsZero() {
+		r.duration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	}
+	if err == nil {
+		return
+	}
+	switch {
+	case errortypes.IsDataNotFound(err):
+		r.errors.WithLabelValues(op, mapErrDataNotFound).Inc()
+	case errortypes.IsConvertFailed(err):
+		r.errors.WithLabelValues(op, mapErrConvertFailed).Inc()
+	}
+}
+
+// instrumentProgress enables the instrumentation of the progress maps
+// unless it's disabled by the config.
+func (pm *Manager) instrumentProgress() {
+	if pm.cfg == nil || pm.cfg.BaseProperties == nil {
+		return
+	}
+
+	maps := map[string]*stateSyncMap{
+		"superProgress":  pm.superProgress,
+		"clientProgress": pm.clientProgress,
+		"peerProgress":   pm.peerProgress,
+		"pieceProgress":  pm.pieceProgress,
+	}
+	for name, mmap := range maps {
+		mmap.recorder = newMapRecorder(pm.metrics, name, pm.cfg.ProgressMapMetricsSample)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func init() {
+	check.Suite(&StateSyncMapTestSuite{})
+}
+
+type StateSyncMapTestSuite struct {
+}
+
+// footprint returns the number of entries held by the underlying map.
+func footprint(mmap *stateSyncMap) int {
+	count := 0
+	mmap.m.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// churn adds count entries starting from start and removes all of them except the last keep ones.
+func churn(c *check.C, mmap *stateSyncMap, start, count, keep int) {
+	for i := start; i < start+count; i++ {
+		c.Assert(mmap.add(fmt.Sprintf("key-%d", i), newPeerState()), check.IsNil)
+	}
+	for i := start; i < start+count-keep; i++ {
+		c.Assert(mmap.remove(fmt.Sprintf("key-%d", i)), check.IsNil)
+	}
+}
+
+func (s *StateSyncMapTestSuite) TestAddAndRemoveCount(c *check.C) {
+	mmap := newStateSyncMap()
+
+	c.Assert(mmap.add("foo", 1), check.IsNil)
+	c.Assert(mmap.add("foo", 2), check.IsNil)
+	c.Assert(mmap.add("bar", 3), check.IsNil)
+	c.Check(mmap.liveCount.Get(), check.Equals, int32(2))
+
+	c.Assert(mmap.remove("foo"), check.IsNil)
+	c.Check(errortypes.IsDataNotFound(mmap.remove("foo")), check.Equals, true)
+	c.Check(mmap.liveCount.Get(), check.Equals, int32(1))
+	c.Check(mmap.removedCount.Get(), check.Equals, int32(1))
+
+	v, err := mmap.get("bar")
+	c.Assert(err, check.IsNil)
+	c.Check(v, check.Equals, 3)
+}
+
+func (s *StateSyncMapTestSuite) TestConcurrentRemoveCount(c *check.C) {
+	mmap := newStateSyncMap()
+	for i := 0; i < 100; i++ {
+		c.Assert(mmap.add(fmt.Sprintf("key-%d", i), i), check.IsNil)
+	}
+
+	// only one of the concurrent removals of the same key succeeds
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				mmap.remove(key)
+			}(fmt.Sprintf("key-%d", i))
+		}
+	}
+	wg.Wait()
+	c.Check(mmap.liveCount.Get(), check.Equals, int32(0))
+	c.Check(mmap.removedCount.Get(), check.Equals, int32(100))
+}
+
+func (s *StateSyncMapTestSuite) TestNeedCompact(c *check.C) {
+	var cases = []struct {
+		live     int32
+		removed  int32
+		ratio    float64
+		expected bool
+	}{
+		{live: 10, removed: 0, ratio: 1.0, expected: false},
+		{live: 10, removed: 5, ratio: 1.0, expected: false},
+		{live: 10, removed: 10, ratio: 1.0, expected: true},
+		{live: 10, removed: 5, ratio: 0.5, expected: true},
+		{live: 0, removed: 1, ratio: 1.0, expected: true},
+	}
+
+	for _, v := range cases {
+		mmap := newStateSyncMap()
+		mmap.liveCount.Set(v.live)
+		mmap.removedCount.Set(v.removed)
+		c.Check(mmap.needCompact(v.ratio), check.Equals, v.expected,
+			check.Commentf("live: %d, removed: %d, ratio: %f", v.live, v.removed, v.ratio))
+	}
+}
+
+func (s *StateSyncMapTestSuite) TestCompactKeepsFootprintBounded(c *check.C) {
+	mmap := newStateSyncMap()
+	keep := 10
+
+	for round := 0; round < 10; round++ {
+		churn(c, mmap, round*1000, 1000, keep)
+		c.Assert(mmap.needCompact(1.0), check.Equals, true)
+
+		mmap.compact()
+		c.Check(mmap.removedCount.Get(), check.Equals, int32(0))
+		c.Check(mmap.liveCount.Get(), check.Equals, int32((round+1)*keep))
+		c.Check(footprint(mmap), check.Equals, (round+1)*keep)
+	}
+
+	// the live entries should be still available after compaction.
+	for round := 0; round < 10; round++ {
+		_, err := mmap.getAsPeerState(fmt.Sprintf("key-%d", round*1000+999))
+		c.Check(err, check.IsNil)
+	}
+}
+
+func (s *StateSyncMapTestSuite) TestCompactWithConcurrentOperations(c *check.C) {
+	mmap := newStateSyncMap()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for i := 0; i < 5000; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			mmap.add(key, i)
+			if i%2 == 0 {
+				mmap.remove(key)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			mmap.compact()
+			c.Check(mmap.liveCount.Get(), check.Equals, int32(2500))
+			c.Check(footprint(mmap), check.Equals, 2500)
+			return
+		case <-time.After(time.Millisecond):
+			mmap.compact()
+		}
+	}
+}
+
+func (s *StateSyncMapTestSuite) TestJitterInterval(c *check.C) {
+	interval := 10 * time.Second
+	for i := 0; i < 100; i++ {
+		v := jitterInterval(interval)
+		c.Check(v >= interval, check.Equals, true)
+		c.Check(v < interval+time.Duration(float64(interval)*compactJitterFactor), check.Equals, true)
+	}
+	c.Check(jitterInterval(0), check.Equals, time.Duration(0))
+}
+
+func (s *StateSyncMapTestSuite) TestMapMetrics(c *check.C) {
+	register := prometheus.NewRegistry()
+	m := newMetrics(register)
+	mmap := newStateSyncMap()
+	mmap.recorder = newMapRecorder(m, "peerProgress", 2)
+
+	c.Assert(mmap.add("foo", newPeerState()), check.IsNil)
+	c.Assert(mmap.add("bar", 1), check.IsNil)
+	_, err := mmap.getAsPeerState("foo")
+	c.Assert(err, check.IsNil)
+	_, err = mmap.getAsPeerState("bar")
+	c.Check(errortypes.IsConvertFailed(err), check.Equals, true)
+	_, err = mmap.get("baz")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+	c.Check(errortypes.IsDataNotFound(mmap.remove("baz")), check.Equals, true)
+
+	// one of every two operations is timed
+	c.Check(getHistogramSampleCount(c, register, "dragonfly_supernode_progress_map_operation_duration_seconds"),
+		check.Equals, uint64(3))
+	c.Check(getHistogramSampleCount(c, register, "dragonfly_supernode_progress_map_lock_wait_seconds"),
+		check.Equals, uint64(3))
+	// while all the errors are counted
+	var cases = []struct {
+		op       string
+		err      string
+		expected float64
+	}{
+		{op: mapOpGet, err: mapErrConvertFailed, expected: 1},
+		{op: mapOpGet, err: mapErrDataNotFound, expected: 1},
+		{op: mapOpRemove, err: mapErrDataNotFound, expected: 1},
+		{op: mapOpAdd, err: mapErrDataNotFound, expected: 0},
+	}
+	for _, v := range cases {
+		c.Check(prom_testutil.ToFloat64(m.progressMapErrors.WithLabelValues("peerProgress", v.op, v.err)),
+			check.Equals, v.expected, check.Commentf("op: %s, error: %s", v.op, v.err))
+	}
+}
+
+func (s *StateSyncMapTestSuite) TestMapMetricsDisabled(c *check.C) {
+	register := prometheus.NewRegistry()
+	c.Check(newMapRecorder(newMetrics(register), "peerProgress", 0), check.IsNil)
+
+	mmap := newStateSyncMap()
+	c.Assert(mmap.add("foo", 1), check.IsNil)
+	_, err := mmap.getAsPeerState("foo")
+	c.Check(errortypes.IsConvertFailed(err), check.Equals, true)
+	c.Check(errortypes.IsDataNotFound(mmap.remove("bar")), check.Equals, true)
+	c.Check(getHistogramSampleCount(c, register, "dragonfly_supernode_progress_map_operation_duration_seconds"),
+		check.Equals, uint64(0))
+}
+
+func (s *StateSyncMapTestSuite) BenchmarkChurnAndCompact(c *check.C) {
+	mmap := newStateSyncMap()
+	for i := 0; i < c.N; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		mmap.add(key, i)
+		mmap.remove(key)
+		if mmap.needCompact(1.0) {
+			mmap.compact()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+)
+
+// GetSwarmHealth gets the aggregate health of the peers sourcing the pieces
+// from 0 to pieceTotal-1 of the task.
+func (pm *Manager) GetSwarmHealth(ctx context.Context, taskID string, pieceTotal int) (*mgr.SwarmHealth, error) {
+	if stringutils.IsEmptyStr(taskID) {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "taskID")
+	}
+
+	health := &mgr.SwarmHealth{}
+	if pieceTotal <= 0 {
+		return health, nil
+	}
+
+	// healthy caches whether the peers are healthy, since a peer usually holds many pieces.
+	healthy := make(map[string]bool)
+	isHealthy := func(peerID string) bool {
+		if result, ok := healthy[peerID]; ok {
+			return result
+		}
+		result := pm.isHealthySource(peerID)
+		healthy[peerID] = result
+		return result
+	}
+
+	replicas := 0
+	health.MinReplication = -1
+	for pieceNum := 0; pieceNum < pieceTotal; pieceNum++ {
+		count := 0
+		if key, err := generatePieceProgressKey(taskID, pieceNum); err == nil {
+			if ps, err := pm.pieceProgress.getAsPieceState(key); err == nil {
+				for _, peerID := range ps.getAvailablePeers() {
+					if isHealthy(peerID) {
+						count++
+					}
+				}
+			}
+		}
+
+		replicas += count
+		if count > 0 {
+			health.AvailablePieces++
+		}
+		if health.MinReplication < 0 || count < health.MinReplication {
+			health.MinReplication = count
+		}
+	}
+
+	for _, ok := range healthy {
+		if ok {
+			health.HealthySources++
+		}
+	}
+	health.AvgReplication = float64(replicas) / float64(pieceTotal)
+	return health, nil
+}
+
+// isHealthySource returns whether the peer can serve the other peers, which is
+// the same as the scheduler: its service is not down and has failed less than EliminationLimit times.
+func (pm *Manager) isHealthySource(peerID string) bool {
+	peerState, err := pm.peerProgress.getAsPeerState(peerID)
+	if err != nil {
+		return false
+	}
+	if atomic.LoadInt64(&peerState.serviceDownTime) > 0 {
+		return false
+	}
+	return peerState.serviceErrorCount == nil || peerState.serviceErrorCount.Get() < config.EliminationLimit
+}
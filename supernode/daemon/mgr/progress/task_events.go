@@ -0,0 +1,201 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/sirupsen/logrus"
+)
+
+// taskEvents is the bounded history of the events of a task, which is a ring buffer
+// overwriting the oldest event once it's full. It's nil if the history is disabled.
+type taskEvents struct {
+	mu     sync.Mutex
+	events []mgr.TaskEvent
+	// next is the index of the slot which the next event is written into.
+	next int
+	// full indicates whether all the slots have been written.
+	full bool
+}
+
+func newTaskEvents(size int) *taskEvents {
+	if size <= 0 {
+		return nil
+	}
+	return &taskEvents{
+		events: make([]mgr.TaskEvent, size),
+	}
+}
+
+// add appends the event, which overwrites the oldest one if the history is full.
+func (te *taskEvents) add(event mgr.TaskEvent) {
+	if te == nil {
+		return
+	}
+
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	te.events[te.next] = event
+	te.next = (te.next + 1) % len(te.events)
+	if te.next == 0 {
+		te.full = true
+	}
+}
+
+// list returns the copies of the events from the oldest to the latest.
+func (te *taskEvents) list() []*mgr.TaskEvent {
+	result := make([]*mgr.TaskEvent, 0)
+	if te == nil {
+		return result
+	}
+
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	start, count := 0, te.next
+	if te.full {
+		start, count = te.next, len(te.events)
+	}
+	for i := 0; i < count; i++ {
+		event := te.events[(start+i)%len(te.events)]
+		result = append(result, &event)
+	}
+	return result
+}
+
+// RecordTaskEvent records the event into the history of the task on supernode.
+func (pm *Manager) RecordTaskEvent(ctx context.Context, taskID, eventType, detail string) error {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return err
+	}
+	ss.events.add(mgr.TaskEvent{
+		Time:   time.Now(),
+		Type:   eventType,
+		Detail: detail,
+	})
+	return nil
+}
+
+// GetTaskEvents gets the events in the history of the task in chronological order,
+// and the history of the evicted task is got within the TaskEventRetention.
+func (pm *Manager) GetTaskEvents(ctx context.Context, taskID string) ([]*mgr.TaskEvent, error) {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err == nil {
+		return ss.events.list(), nil
+	}
+	if v, rerr := pm.retainedEvents.Get(taskID); rerr == nil {
+		if retained, ok := v.(*retainedEvents); ok && !pm.isEventsExpired(retained) {
+			return retained.events.list(), nil
+		}
+	}
+	return nil, err
+}
+
+// recordTaskEvent records the event of the task raised by the progress manager itself,
+// and the task whose progress has been deleted is skipped.
+func (pm *Manager) recordTaskEvent(taskID, eventType, detail string) {
+	if ss, err := pm.superProgress.getAsSuperState(taskID); err == nil {
+		ss.events.add(mgr.TaskEvent{
+			Time:   time.Now(),
+			Type:   eventType,
+			Detail: detail,
+		})
+	}
+}
+
+// retainedEvents is the event history of an evicted task.
+type retainedEvents struct {
+	events    *taskEvents
+	evictedAt time.Time
+}
+
+// retainTaskEvents keeps the history of the task whose progress is deleted
+// until the TaskEventRetention expires.
+func (pm *Manager) retainTaskEvents(taskID string, ss *superState) {
+	if !pm.isEventRetentionEnabled() || ss.events == nil {
+		return
+	}
+	pm.retainedEvents.Add(taskID, &retainedEvents{
+		events:    ss.events,
+		evictedAt: time.Now(),
+	})
+}
+
+// startEventReaper removes the expired history of the evicted tasks periodically
+// until the retention is disabled.
+func (pm *Manager) startEventReaper() {
+	if !pm.isEventRetentionEnabled() {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(pm.cfg.TaskEventRetention)
+			pm.reapTaskEvents()
+		}
+	}()
+}
+
+// reapTaskEvents removes the history of the evicted tasks which is expired.
+func (pm *Manager) reapTaskEvents() {
+	for _, taskID := range pm.retainedEvents.ListKeyAsStringSlice() {
+		v, err := pm.retainedEvents.Get(taskID)
+		if err != nil {
+			continue
+		}
+		if retained, ok := v.(*retainedEvents); ok && !pm.isEventsExpired(retained) {
+			continue
+		}
+		pm.retainedEvents.Remove(taskID)
+		logrus.Debugf("success to remove the expired event history of taskID(%s)", taskID)
+	}
+}
+
+func (pm *Manager) isEventRetentionEnabled() bool {
+	return pm.cfg != nil && pm.cfg.BaseProperties != nil && pm.cfg.TaskEventRetention > 0
+}
+
+// isEventsExpired returns whether the history is kept longer than the TaskEventRetention.
+func (pm *Manager) isEventsExpired(retained *retainedEvents) bool {
+	return time.Since(retained.evictedAt) > pm.cfg.TaskEventRetention
+}
+
+// logTaskEvents logs the history of the task whose progress is deleted,
+// so that the timeline of the evicted task is still available for support.
+func logTaskEvents(taskID string, ss *superState) {
+	events := ss.events.list()
+	if len(events) == 0 {
+		return
+	}
+
+	timeline := make([]string, 0, len(events))
+	for _, event := range events {
+		entry := fmt.Sprintf("%s %s", event.Time.Format(time.RFC3339Nano), event.Type)
+		if event.Detail != "" {
+			entry += ": " + event.Detail
+		}
+		timeline = append(timeline, entry)
+	}
+	logrus.Infof("the event history of taskID(%s): [%s]", taskID, strings.Join(timeline, "; "))
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// eventDetails returns the details of the events in order.
+func eventDetails(events []*mgr.TaskEvent) []string {
+	details := make([]string, 0, len(events))
+	for _, event := range events {
+		details = append(details, event.Detail)
+	}
+	return details
+}
+
+func (s *ProgressManagerTestSuite) TestTaskEventsBounded(c *check.C) {
+	te := newTaskEvents(3)
+	c.Check(te.list(), check.HasLen, 0)
+
+	for i := 0; i < 2; i++ {
+		te.add(mgr.TaskEvent{Type: mgr.TaskEventReassigned, Detail: fmt.Sprint(i)})
+	}
+	c.Check(eventDetails(te.list()), check.DeepEquals, []string{"0", "1"})
+
+	// the oldest events are overwritten once the history is full
+	for i := 2; i < 8; i++ {
+		te.add(mgr.TaskEvent{Type: mgr.TaskEventReassigned, Detail: fmt.Sprint(i)})
+		c.Check(te.list(), check.HasLen, 3)
+	}
+	c.Check(eventDetails(te.list()), check.DeepEquals, []string{"5", "6", "7"})
+
+	// nothing is recorded if the history is disabled
+	te = newTaskEvents(0)
+	te.add(mgr.TaskEvent{Type: mgr.TaskEventRegistered})
+	c.Check(te.list(), check.HasLen, 0)
+}
+
+func (s *ProgressManagerTestSuite) TestRecordTaskEvents(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	cfg.TaskEventHistorySize = 4
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+
+	ctx := context.Background()
+	start := time.Now()
+	c.Assert(pm.InitProgress(ctx, "task", "superPID", cfg.GetSuperCID("task")), check.IsNil)
+	c.Assert(pm.RecordTaskEvent(ctx, "task", mgr.TaskEventDownloadStarted, ""), check.IsNil)
+	c.Assert(pm.UpdateProgress(ctx, "task", cfg.GetSuperCID("task"), "superPID", "", 0, config.PieceSUCCESS, 0), check.IsNil)
+	c.Assert(pm.RecordTaskEvent(ctx, "task", mgr.TaskEventCompleted, ""), check.IsNil)
+	c.Check(errortypes.IsDataNotFound(pm.RecordTaskEvent(ctx, "unknown", mgr.TaskEventCompleted, "")), check.Equals, true)
+
+	// the events are recorded in order
+	events, err := pm.GetTaskEvents(ctx, "task")
+	c.Assert(err, check.IsNil)
+	eventTypes := make([]string, 0, len(events))
+	for i, event := range events {
+		eventTypes = append(eventTypes, event.Type)
+		c.Check(event.Time.Before(start), check.Equals, false)
+		if i > 0 {
+			c.Check(event.Time.Before(events[i-1].Time), check.Equals, false)
+		}
+	}
+	c.Check(eventTypes, check.DeepEquals, []string{mgr.TaskEventRegistered, mgr.TaskEventDownloadStarted,
+		mgr.TaskEventFirstPiece, mgr.TaskEventCompleted})
+
+	// and the registration is overwritten by the next event as the history is full
+	c.Assert(pm.RecordTaskEvent(ctx, "task", mgr.TaskEventEvicted, "purged"), check.IsNil)
+	events, err = pm.GetTaskEvents(ctx, "task")
+	c.Assert(err, check.IsNil)
+	c.Assert(events, check.HasLen, 4)
+	c.Check(events[0].Type, check.Equals, mgr.TaskEventDownloadStarted)
+	c.Check(events[3].Type, check.Equals, mgr.TaskEventEvicted)
+	c.Check(events[3].Detail, check.Equals, "purged")
+
+	// the history is kept after the progress of the task is deleted
+	c.Assert(pm.DeleteProgressByTaskID(ctx, "task"), check.IsNil)
+	events, err = pm.GetTaskEvents(ctx, "task")
+	c.Assert(err, check.IsNil)
+	c.Assert(events, check.HasLen, 4)
+	c.Check(events[3].Type, check.Equals, mgr.TaskEventEvicted)
+
+	// and the history starts fresh once the task is registered again
+	c.Assert(pm.InitProgress(ctx, "task", "superPID", cfg.GetSuperCID("task")), check.IsNil)
+	events, err = pm.GetTaskEvents(ctx, "task")
+	c.Assert(err, check.IsNil)
+	c.Assert(events, check.HasLen, 1)
+	c.Check(events[0].Type, check.Equals, mgr.TaskEventRegistered)
+}
+
+func (s *ProgressManagerTestSuite) TestRetainTaskEvents(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+	ctx := context.Background()
+
+	for _, taskID := range []string{"task1", "task2"} {
+		c.Assert(pm.InitProgress(ctx, taskID, "superPID", cfg.GetSuperCID(taskID)), check.IsNil)
+		c.Assert(pm.RecordTaskEvent(ctx, taskID, mgr.TaskEventEvicted, "purged"), check.IsNil)
+		c.Assert(pm.DeleteProgressByTaskID(ctx, taskID), check.IsNil)
+	}
+
+	// the history kept beyond the TaskEventRetention is neither got nor kept after reaping
+	v, err := pm.retainedEvents.Get("task1")
+	c.Assert(err, check.IsNil)
+	v.(*retainedEvents).evictedAt = time.Now().Add(-cfg.TaskEventRetention - time.Second)
+	_, err = pm.GetTaskEvents(ctx, "task1")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+	pm.reapTaskEvents()
+	c.Check(pm.retainedEvents.ListKeyAsStringSlice(), check.DeepEquals, []string{"task2"})
+	events, err := pm.GetTaskEvents(ctx, "task2")
+	c.Assert(err, check.IsNil)
+	c.Check(events[len(events)-1].Detail, check.Equals, "purged")
+
+	// and the history is deleted with the progress if the retention is disabled
+	cfg = config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	cfg.TaskEventRetention = 0
+	pm, _ = NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(pm.InitProgress(ctx, "task", "superPID", cfg.GetSuperCID("task")), check.IsNil)
+	c.Assert(pm.DeleteProgressByTaskID(ctx, "task"), check.IsNil)
+	_, err = pm.GetTaskEvents(ctx, "task")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
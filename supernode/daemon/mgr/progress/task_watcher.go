@@ -0,0 +1,193 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// taskWatchers maintains the subscribers of the progress changes of the tasks.
+// The changes are fanned out to the subscribers by the updater directly
+// without starting any goroutine for the subscribers.
+type taskWatchers struct {
+	mu sync.Mutex
+	// watchers maintains the channels of the subscribers.
+	// key:taskID,value:set of the channels
+	watchers map[string]map[chan struct{}]struct{}
+	// total is the number of the subscribers of all the tasks.
+	total int
+	// versions maintains the versions of the tasks which increase on every change.
+	// key:taskID,value:version
+	versions map[string]int64
+
+	subscribers prometheus.Gauge
+	rejections  *prometheus.CounterVec
+}
+
+func newTaskWatchers(subscribers prometheus.Gauge, rejections *prometheus.CounterVec) *taskWatchers {
+	return &taskWatchers{
+		watchers:    make(map[string]map[chan struct{}]struct{}),
+		versions:    make(map[string]int64),
+		subscribers: subscribers,
+		rejections:  rejections,
+	}
+}
+
+// add subscribes to the changes of taskID and returns the function to unsubscribe.
+// The ErrTooManySubscribers is returned if the subscribers of all the tasks reach maxTotal
+// or the ones of taskID reach maxPerTask, and the limits are disabled if they're not greater than 0.
+func (tw *taskWatchers) add(taskID string, maxTotal, maxPerTask int) (chan struct{}, func(), error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if maxTotal > 0 && tw.total >= maxTotal {
+		tw.rejections.WithLabelValues("total").Inc()
+		return nil, nil, errors.Wrapf(errortypes.ErrTooManySubscribers, "the subscribers of all the tasks reach the limit %d", maxTotal)
+	}
+	if maxPerTask > 0 && len(tw.watchers[taskID]) >= maxPerTask {
+		tw.rejections.WithLabelValues("task").Inc()
+		return nil, nil, errors.Wrapf(errortypes.ErrTooManySubscribers, "the subscribers of taskID %s reach the limit %d", taskID, maxPerTask)
+	}
+
+	// the channel is buffered by one to coalesce the changes
+	// which the subscriber has not received yet.
+	ch := make(chan struct{}, 1)
+	if tw.watchers[taskID] == nil {
+		tw.watchers[taskID] = make(map[chan struct{}]struct{})
+	}
+	tw.watchers[taskID][ch] = struct{}{}
+	tw.total++
+	tw.subscribers.Inc()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			tw.remove(taskID, ch)
+		})
+	}, nil
+}
+
+func (tw *taskWatchers) remove(taskID string, ch chan struct{}) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.total--
+	tw.subscribers.Dec()
+	delete(tw.watchers[taskID], ch)
+	if len(tw.watchers[taskID]) == 0 {
+		delete(tw.watchers, taskID)
+	}
+}
+
+// notify increases the version of taskID and signals all the subscribers of it without blocking.
+func (tw *taskWatchers) notify(taskID string) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.versions[taskID]++
+	for ch := range tw.watchers[taskID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// version returns the version of taskID, which is 0 if it has never changed.
+func (tw *taskWatchers) version(taskID string) int64 {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.versions[taskID]
+}
+
+// forget removes the version of taskID after the task is deleted.
+func (tw *taskWatchers) forget(taskID string) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	delete(tw.versions, taskID)
+}
+
+// count returns the number of the subscribers of taskID.
+func (tw *taskWatchers) count(taskID string) int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return len(tw.watchers[taskID])
+}
+
+// WatchTask subscribes to the progress changes of the task on supernode
+// within the limits of the MaxSubscribers and MaxTaskSubscribers.
+func (pm *Manager) WatchTask(ctx context.Context, taskID string) (<-chan struct{}, func(), error) {
+	if stringutils.IsEmptyStr(taskID) {
+		return nil, nil, errors.Wrap(errortypes.ErrEmptyValue, "taskID")
+	}
+
+	ch, cancel, err := pm.taskWatchers.add(taskID, pm.cfg.MaxSubscribers, pm.cfg.MaxTaskSubscribers)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cancel, nil
+}
+
+// NotifyTask signals the subscribers of the task that its state has changed.
+func (pm *Manager) NotifyTask(ctx context.Context, taskID string) {
+	pm.taskWatchers.notify(taskID)
+}
+
+// GetTaskVersion gets the version of the progress of the task on supernode.
+func (pm *Manager) GetTaskVersion(ctx context.Context, taskID string) int64 {
+	return pm.taskWatchers.version(taskID)
+}
+
+// GetSuperPieceCount gets the count of the pieces which have been downloaded by supernode.
+func (pm *Manager) GetSuperPieceCount(ctx context.Context, taskID string) (int, error) {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	pm.bitSetLocker.GetLock(superStateLockKey(taskID), true)
+	defer pm.bitSetLocker.ReleaseLock(superStateLockKey(taskID), true)
+	count := 0
+	for i, e := ss.pieceBitSet.NextSet(0); e; i, e = ss.pieceBitSet.NextSet(i + 1) {
+		if getPieceStatusByIndex(i) == config.PieceSUCCESS {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetSuperConsecutivePieces gets the count of the consecutive pieces starting from pieceNum
+// which have been downloaded by supernode.
+func (pm *Manager) GetSuperConsecutivePieces(ctx context.Context, taskID string, pieceNum int) (int, error) {
+	ss, err := pm.superProgress.getAsSuperState(taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	pm.bitSetLocker.GetLock(superStateLockKey(taskID), true)
+	defer pm.bitSetLocker.ReleaseLock(superStateLockKey(taskID), true)
+	count := 0
+	for pieceNum >= 0 && ss.pieceBitSet.Test(uint(getStartIndexByPieceNum(pieceNum+count)+config.PieceSUCCESS)) {
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package progress
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func isSignaled(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ProgressManagerTestSuite) TestWatchTask(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+
+	ctx := context.Background()
+	taskID := "task"
+	superCID := cfg.GetSuperCID(taskID)
+	c.Assert(pm.InitProgress(ctx, taskID, cfg.GetSuperPID(), superCID), check.IsNil)
+
+	// all the subscribers are signaled on the piece completion
+	var channels []<-chan struct{}
+	var cancels []func()
+	for i := 0; i < 100; i++ {
+		ch, cancel, err := pm.WatchTask(ctx, taskID)
+		c.Assert(err, check.IsNil)
+		channels = append(channels, ch)
+		cancels = append(cancels, cancel)
+	}
+	c.Check(pm.taskWatchers.count(taskID), check.Equals, 100)
+
+	// and the changes are coalesced until they're received
+	for pieceNum := 0; pieceNum < 3; pieceNum++ {
+		c.Assert(pm.UpdateProgress(ctx, taskID, superCID, cfg.GetSuperPID(), "", pieceNum, config.PieceSUCCESS, 0), check.IsNil)
+	}
+	count, err := pm.GetSuperPieceCount(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(count, check.Equals, 3)
+	c.Check(pm.GetTaskVersion(ctx, taskID), check.Equals, int64(3))
+	for _, ch := range channels {
+		c.Check(isSignaled(ch), check.Equals, true)
+		c.Check(isSignaled(ch), check.Equals, false)
+	}
+
+	// the duplicate report changes nothing
+	c.Assert(pm.UpdateProgress(ctx, taskID, superCID, cfg.GetSuperPID(), "", 0, config.PieceSUCCESS, 0), check.IsNil)
+	c.Check(isSignaled(channels[0]), check.Equals, false)
+	c.Check(pm.GetTaskVersion(ctx, taskID), check.Equals, int64(3))
+
+	pm.NotifyTask(ctx, taskID)
+	c.Check(isSignaled(channels[0]), check.Equals, true)
+	c.Check(pm.GetTaskVersion(ctx, taskID), check.Equals, int64(4))
+
+	// the subscribers are cleaned up after canceled
+	for _, cancel := range cancels {
+		cancel()
+		cancel()
+	}
+	c.Check(pm.taskWatchers.count(taskID), check.Equals, 0)
+	c.Check(len(pm.taskWatchers.watchers), check.Equals, 0)
+	c.Assert(pm.UpdateProgress(ctx, taskID, superCID, cfg.GetSuperPID(), "", 3, config.PieceSUCCESS, 0), check.IsNil)
+	c.Check(isSignaled(channels[0]), check.Equals, false)
+
+	// and the version is removed with the task
+	c.Assert(pm.DeleteProgressByTaskID(ctx, taskID), check.IsNil)
+	c.Check(pm.GetTaskVersion(ctx, taskID), check.Equals, int64(0))
+}
+
+func (s *ProgressManagerTestSuite) TestWatchTaskLimits(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.MaxSubscribers = 3
+	cfg.MaxTaskSubscribers = 2
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+	ctx := context.Background()
+
+	_, cancel1, err := pm.WatchTask(ctx, "task1")
+	c.Assert(err, check.IsNil)
+	_, cancel2, err := pm.WatchTask(ctx, "task1")
+	c.Assert(err, check.IsNil)
+
+	// the subscribers of a task are limited by MaxTaskSubscribers
+	_, _, err = pm.WatchTask(ctx, "task1")
+	c.Check(errortypes.IsTooManySubscribers(err), check.Equals, true)
+	_, cancel3, err := pm.WatchTask(ctx, "task2")
+	c.Assert(err, check.IsNil)
+
+	// and the ones of all the tasks are limited by MaxSubscribers
+	_, _, err = pm.WatchTask(ctx, "task3")
+	c.Check(errortypes.IsTooManySubscribers(err), check.Equals, true)
+	c.Check(prom_testutil.ToFloat64(pm.metrics.subscribers.WithLabelValues()), check.Equals, float64(3))
+	c.Check(prom_testutil.ToFloat64(pm.metrics.subscriberRejections.WithLabelValues("task")), check.Equals, float64(1))
+	c.Check(prom_testutil.ToFloat64(pm.metrics.subscriberRejections.WithLabelValues("total")), check.Equals, float64(1))
+
+	// the slot is released after canceled
+	cancel1()
+	cancel1()
+	_, cancel4, err := pm.WatchTask(ctx, "task3")
+	c.Assert(err, check.IsNil)
+	c.Check(pm.taskWatchers.count("task1"), check.Equals, 1)
+
+	for _, cancel := range []func(){cancel2, cancel3, cancel4} {
+		cancel()
+	}
+	c.Check(pm.taskWatchers.total, check.Equals, 0)
+	c.Check(prom_testutil.ToFloat64(pm.metrics.subscribers.WithLabelValues()), check.Equals, float64(0))
+}
+
+func (s *ProgressManagerTestSuite) TestGetSuperConsecutivePieces(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	pm, _ := NewManager(cfg, prometheus.NewRegistry())
+
+	ctx := context.Background()
+	taskID := "task"
+	superCID := cfg.GetSuperCID(taskID)
+	c.Assert(pm.InitProgress(ctx, taskID, cfg.GetSuperPID(), superCID), check.IsNil)
+
+	// the pieces are downloaded out of order
+	for _, pieceNum := range []int{0, 1, 3, 4, 5} {
+		c.Assert(pm.UpdateProgress(ctx, taskID, superCID, cfg.GetSuperPID(), "", pieceNum, config.PieceSUCCESS, 0), check.IsNil)
+	}
+	c.Assert(pm.UpdateProgress(ctx, taskID, superCID, cfg.GetSuperPID(), "", 6, config.PieceFAILED, 0), check.IsNil)
+
+	for pieceNum, expected := range map[int]int{-1: 0, 0: 2, 1: 1, 2: 0, 3: 3, 5: 1, 6: 0, 100: 0} {
+		count, err := pm.GetSuperConsecutivePieces(ctx, taskID, pieceNum)
+		c.Assert(err, check.IsNil)
+		c.Check(count, check.Equals, expected, check.Commentf("pieceNum: %d", pieceNum))
+	}
+
+	_, err := pm.GetSuperConsecutivePieces(ctx, "unknown", 0)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
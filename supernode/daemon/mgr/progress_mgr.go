@@ -18,6 +18,7 @@ package mgr
 
 import (
 	"context"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
@@ -40,6 +41,132 @@ type PeerState struct {
 
 	// ServiceDownTime the down time of the peer service.
 	ServiceDownTime *int64
+
+	// ServiceSuccessCount maintains the number of times that the other peer nodes
+	// successfully downloaded from the PeerID since its last failure during the slow start warmup.
+	ServiceSuccessCount *atomiccount.AtomicInt
+
+	// ServedBytes is the bytes of the pieces that the other peer nodes successfully downloaded from the PeerID.
+	// It should be read atomically.
+	ServedBytes *int64
+
+	// ConsumedBytes is the bytes of the pieces that the PeerID successfully downloaded
+	// from the other peer nodes and supernode. It should be read atomically.
+	ConsumedBytes *int64
+
+	// LastSeen is the time in nanoseconds when a client of the PeerID registered
+	// or reported its progress last time. It should be read atomically.
+	LastSeen *int64
+}
+
+// PeerSource contains the pieces of a task that a peer currently sources to the other peers.
+type PeerSource struct {
+	// TaskID identifies the task.
+	TaskID string
+
+	// PieceNums is the pieces of the task that the peer holds and offers to the other peers.
+	PieceNums []int
+
+	// UploadingPieceNums is the pieces of the task being downloaded from the peer by the other peers.
+	UploadingPieceNums []int
+}
+
+// SwarmHealth contains the aggregate health of the peers sourcing the pieces of a task.
+type SwarmHealth struct {
+	// HealthySources is the number of the distinct healthy peers holding any piece of the task.
+	HealthySources int
+
+	// MinReplication is the min number of the healthy peers holding a piece among all the pieces.
+	MinReplication int
+
+	// AvgReplication is the average number of the healthy peers holding a piece.
+	AvgReplication float64
+
+	// AvailablePieces is the number of the pieces held by at least one healthy peer.
+	AvailablePieces int
+}
+
+// The results of looking up the cache of a task.
+const (
+	// CacheHit means that the content of the task is served from the cache,
+	// such as a registration attaches to the content which has been downloaded completely.
+	CacheHit = "hit"
+
+	// CacheRevalidationHit means that the cached content is served after the source
+	// responds 304 Not Modified to the conditional request.
+	CacheRevalidationHit = "revalidation-hit"
+
+	// CacheMiss means that the content of the task is downloaded from the source.
+	CacheMiss = "miss"
+)
+
+// CacheStats contains the counts of the results of looking up the cache of a task.
+type CacheStats struct {
+	// Hits is the count of the CacheHit.
+	Hits int64
+
+	// RevalidationHits is the count of the CacheRevalidationHit.
+	RevalidationHits int64
+
+	// Misses is the count of the CacheMiss.
+	Misses int64
+}
+
+// The types of the events in the history of a task.
+const (
+	// TaskEventRegistered means that the task is registered and supernode is initialized for it.
+	TaskEventRegistered = "registered"
+
+	// TaskEventDownloadStarted means that supernode starts to download the task from the source.
+	TaskEventDownloadStarted = "download-started"
+
+	// TaskEventFirstPiece means that the first piece of the task becomes available on supernode.
+	TaskEventFirstPiece = "first-piece"
+
+	// TaskEventReassigned means that the assignment of a piece to a client is cancelled
+	// so that the piece is scheduled again.
+	TaskEventReassigned = "reassigned"
+
+	// TaskEventCompleted means that supernode downloads the task from the source successfully.
+	TaskEventCompleted = "completed"
+
+	// TaskEventFailed means that supernode fails to download the task from the source.
+	TaskEventFailed = "failed"
+
+	// TaskEventEvicted means that the task is evicted from supernode.
+	TaskEventEvicted = "evicted"
+)
+
+// TaskEvent is an event in the lifecycle of a task or the scheduling of its pieces.
+type TaskEvent struct {
+	// Time is the time when the event occurs.
+	Time time.Time
+
+	// Type is the type of the event, such as TaskEventRegistered.
+	Type string
+
+	// Detail describes the event, such as the piece reassigned or the reason of the failure.
+	Detail string
+}
+
+// PieceProof contains the information to verify a piece against
+// the root of the Merkle tree of the piece md5s of a task.
+type PieceProof struct {
+	// PieceNum is the number of the piece to verify.
+	PieceNum int
+
+	// PieceMD5 is the md5 of the piece which is the leaf of the tree.
+	PieceMD5 string
+
+	// PieceCount is the count of the leaves of the tree,
+	// which covers the pieces from 0 to PieceCount-1.
+	PieceCount int
+
+	// Root is the root hash of the tree.
+	Root []byte
+
+	// Siblings is the hashes of the siblings from the leaf up to the root.
+	Siblings [][]byte
 }
 
 // ProgressMgr is responsible for maintaining the correspondence between peer and pieces.
@@ -47,11 +174,18 @@ type ProgressMgr interface {
 	// InitProgress inits the correlation information between peers and pieces, etc.
 	InitProgress(ctx context.Context, taskID, peerID, clientID string) error
 
+	// RebindProgress binds the stable identity of the client to clientID for taskID.
+	// If the identity has been bound to a client which is seen within the TTL,
+	// the progress of that client will be moved to clientID and its clientID is returned.
+	// Otherwise an empty string is returned and the progress of clientID should be initialized.
+	RebindProgress(ctx context.Context, taskID, peerID, clientID, identity string) (prevClientID string, err error)
+
 	// UpdateProgress updates the correlation information between peers and pieces.
 	// 1. update the info about srcCID to tell the scheduler that corresponding peer has the piece now.
 	// 2. update the info about dstPID to tell the scheduler that someone has downloaded the piece form here.
 	// Scheduler will calculate the load and times of error/success for every peer to make better decisions.
-	UpdateProgress(ctx context.Context, taskID, srcCID, srcPID, dstPID string, pieceNum, pieceStatus int) error
+	// The pieceSize is used to account the bytes served by dstPID and consumed by srcPID when the piece succeeds.
+	UpdateProgress(ctx context.Context, taskID, srcCID, srcPID, dstPID string, pieceNum, pieceStatus int, pieceSize int32) error
 
 	// UpdateClientProgress updates the info when success to schedule peer srcCID to download from dstPID.
 	UpdateClientProgress(ctx context.Context, taskID, srcCID, dstPID string, pieceNum, pieceStatus int) error
@@ -63,6 +197,10 @@ type ProgressMgr interface {
 	// DeletePieceProgressByCID deletes the pieces progress with specified clientID.
 	DeletePieceProgressByCID(ctx context.Context, taskID, clientID string) (err error)
 
+	// DeleteProgressByTaskID deletes the super progress and the pieces progress
+	// with specified taskID, which means that no peer has the pieces of the task any more.
+	DeleteProgressByTaskID(ctx context.Context, taskID string) (err error)
+
 	// GetPeerIDsByPieceNum gets all peerIDs with specified taskID and pieceNum.
 	GetPeerIDsByPieceNum(ctx context.Context, taskID string, pieceNum int) (peerIDs []string, err error)
 
@@ -73,6 +211,10 @@ type ProgressMgr interface {
 	// GetPeerStateByPeerID gets peer state with specified peerID.
 	GetPeerStateByPeerID(ctx context.Context, peerID string) (peerState *PeerState, err error)
 
+	// GetPeerSources gets the pieces of the tasks that the peer currently sources to the other peers,
+	// which are ordered by the taskID.
+	GetPeerSources(ctx context.Context, peerID string) ([]*PeerSource, error)
+
 	// DeletePeerStateByPeerID deletes the peerState by PeerID.
 	DeletePeerStateByPeerID(ctx context.Context, peerID string) error
 
@@ -81,4 +223,75 @@ type ProgressMgr interface {
 
 	// GetBlackInfoByPeerID gets black info with specified peerID.
 	GetBlackInfoByPeerID(ctx context.Context, peerID string) (dstPIDMap *syncmap.SyncMap, err error)
+
+	// UpdateSuperPieceMD5 updates the md5 of the piece which has been downloaded by supernode.
+	UpdateSuperPieceMD5(ctx context.Context, taskID string, pieceNum int, pieceMD5 string) error
+
+	// GetPieceProof gets the proof of the piece in the Merkle tree built with the piece md5s
+	// of the task on supernode. The tree covers the consecutive pieces starting from 0 which
+	// have been downloaded by supernode, and it covers all pieces when the CDN finishes.
+	GetPieceProof(ctx context.Context, taskID string, pieceNum int) (proof *PieceProof, err error)
+
+	// GetSuperPieceMD5s gets the md5s of the consecutive pieces starting from 0
+	// which have been downloaded by supernode, and it covers all pieces when the CDN finishes.
+	GetSuperPieceMD5s(ctx context.Context, taskID string) (pieceMD5s []string, err error)
+
+	// GetFirstPieceTime gets the time when the first piece of the task became available on supernode.
+	// The zero time will be returned if no piece is available yet.
+	GetFirstPieceTime(ctx context.Context, taskID string) (time.Time, error)
+
+	// GetTaskServedBytes gets the bytes of the pieces that the peers successfully downloaded
+	// from supernode and the other peers for the task.
+	GetTaskServedBytes(ctx context.Context, taskID string) (int64, error)
+
+	// GetSwarmHealth gets the aggregate health of the peers sourcing the pieces
+	// from 0 to pieceTotal-1 of the task. The peers whose service is down or has failed
+	// for EliminationLimit times are not healthy, and supernode is never counted.
+	GetSwarmHealth(ctx context.Context, taskID string, pieceTotal int) (*SwarmHealth, error)
+
+	// RecordCacheResult records the result of looking up the cache of the task,
+	// which is one of the CacheHit, CacheRevalidationHit and CacheMiss.
+	RecordCacheResult(ctx context.Context, taskID, result string) error
+
+	// GetCacheStats gets the counts of the results of looking up the cache of the task
+	// since supernode started to download it.
+	GetCacheStats(ctx context.Context, taskID string) (*CacheStats, error)
+
+	// CancelStalledPieces cancels the assignments of the pieces to clientID which have been
+	// running longer than the configured timeout, and treats them as the failures of their sources.
+	// It returns the cancelled pieceNums with their sources.
+	CancelStalledPieces(ctx context.Context, taskID, clientID, peerID string) (map[int]string, error)
+
+	// CancelPeerPieces cancels the assignments of the pieces to clientID which are being
+	// downloaded from the peers other than supernode, without treating them as the failures
+	// of their sources. It returns the cancelled pieceNums with their sources.
+	CancelPeerPieces(ctx context.Context, taskID, clientID string) (map[int]string, error)
+
+	// GetSuperPieceCount gets the count of the pieces which have been downloaded by supernode.
+	GetSuperPieceCount(ctx context.Context, taskID string) (int, error)
+
+	// GetSuperConsecutivePieces gets the count of the consecutive pieces starting from pieceNum
+	// which have been downloaded by supernode.
+	GetSuperConsecutivePieces(ctx context.Context, taskID string, pieceNum int) (int, error)
+
+	// WatchTask subscribes to the progress changes of the task on supernode,
+	// such as a piece becoming available or the status of the task changing.
+	// The changes are coalesced, so a signal received from the channel means that
+	// the task has changed since the last signal. And the returned cancel function
+	// should be called to unsubscribe when the subscriber is gone.
+	WatchTask(ctx context.Context, taskID string) (changes <-chan struct{}, cancel func(), err error)
+
+	// NotifyTask signals the subscribers of the task that its state has changed.
+	NotifyTask(ctx context.Context, taskID string)
+
+	// GetTaskVersion gets the version of the progress of the task on supernode,
+	// which increases whenever the subscribers of the task are signaled.
+	GetTaskVersion(ctx context.Context, taskID string) int64
+
+	// RecordTaskEvent records the event into the history of the task on supernode,
+	// which overwrites the oldest event once the history is full.
+	RecordTaskEvent(ctx context.Context, taskID, eventType, detail string) error
+
+	// GetTaskEvents gets the events in the history of the task in chronological order.
+	GetTaskEvents(ctx context.Context, taskID string) ([]*TaskEvent, error)
 }
@@ -0,0 +1,226 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// The policies which decide the cached files of the peer supernodes to replicate.
+const (
+	// PolicyAll replicates all the cached files.
+	PolicyAll = "all"
+
+	// PolicyHot replicates the files of the tasks registered
+	// no less than ReplicationMinAccessCount times.
+	PolicyHot = "hot"
+
+	// DefaultPolicy is the policy used if none is configured.
+	DefaultPolicy = PolicyAll
+)
+
+// listTimeout is the timeout to list the cached tasks of a peer supernode.
+const listTimeout = 10 * time.Second
+
+type metrics struct {
+	replicatedFiles *prometheus.CounterVec
+}
+
+func newMetrics(register prometheus.Registerer) *metrics {
+	return &metrics{
+		replicatedFiles: metricsutils.NewCounter(config.SubsystemSupernode, "replicated_files_total",
+			"Total number of the files replicated from the peer supernodes", []string{"peer"}, register),
+	}
+}
+
+// Manager replicates the cached files of the peer supernodes to the local store,
+// so that the supernode serves as a warm standby of them. The peer supernode is
+// treated as the source of the file, which is downloaded by the CDN as usual.
+type Manager struct {
+	cfg         *config.Config
+	cdnMgr      mgr.CDNMgr
+	progressMgr mgr.ProgressMgr
+	metrics     *metrics
+}
+
+// NewManager returns a new Manager with the policy specified by cfg.ReplicationPolicy.
+func NewManager(cfg *config.Config, cdnMgr mgr.CDNMgr, progressMgr mgr.ProgressMgr,
+	register prometheus.Registerer) (*Manager, error) {
+	if policy := getPolicyName(cfg); policy != PolicyAll && policy != PolicyHot {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "unknown replication policy: %s", policy)
+	}
+
+	return &Manager{
+		cfg:         cfg,
+		cdnMgr:      cdnMgr,
+		progressMgr: progressMgr,
+		metrics:     newMetrics(register),
+	}, nil
+}
+
+// Start replicates the cached files of the ReplicationPeers periodically
+// until the replication is disabled. It should be called after the supernode
+// has been registered as a peer, whose peerID is used by the CDN.
+func (rm *Manager) Start() {
+	if len(rm.cfg.ReplicationPeers) == 0 {
+		logrus.Infof("replication is disabled")
+		return
+	}
+
+	go func() {
+		for {
+			for _, peer := range rm.cfg.ReplicationPeers {
+				count, err := rm.Replicate(context.Background(), peer)
+				if err != nil {
+					logrus.Warnf("failed to replicate the cached files of peer supernode %s: %v", peer, err)
+					continue
+				}
+				logrus.Infof("success to replicate %d cached files of peer supernode %s", count, peer)
+			}
+			if rm.cfg.ReplicationInterval <= 0 {
+				return
+			}
+			time.Sleep(rm.cfg.ReplicationInterval)
+		}
+	}()
+}
+
+// Replicate replicates the cached files of the peer supernode selected by the policy,
+// and returns the number of the files replicated this time. The files which have been
+// cached by the local store are skipped.
+func (rm *Manager) Replicate(ctx context.Context, peer string) (int, error) {
+	tasks, err := listCachedTasks(peer)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, task := range tasks {
+		if !rm.shouldReplicate(ctx, task) {
+			continue
+		}
+		if err := rm.replicateTask(ctx, peer, task); err != nil {
+			logrus.Warnf("failed to replicate taskID %s from peer supernode %s: %v", task.ID, peer, err)
+			continue
+		}
+		rm.metrics.replicatedFiles.WithLabelValues(peer).Inc()
+		count++
+	}
+	return count, nil
+}
+
+// shouldReplicate returns whether the file of the task is selected by the policy
+// and it has not been cached by the local store.
+func (rm *Manager) shouldReplicate(ctx context.Context, task *types.TaskInfo) bool {
+	if task == nil || task.ID == "" || task.PieceSize <= config.PieceWrapSize {
+		return false
+	}
+	if getPolicyName(rm.cfg) == PolicyHot && task.AccessCount < rm.cfg.ReplicationMinAccessCount {
+		return false
+	}
+
+	cdnStatus, err := rm.cdnMgr.GetStatus(ctx, task.ID)
+	return err != nil || cdnStatus != types.TaskInfoCdnStatusSUCCESS
+}
+
+// replicateTask downloads the content of the task from the peer supernode with the CDN,
+// and the task keeps the ID, url and piece size on the peer supernode, so that
+// the following registrations of the same task hit the cache on the local store.
+func (rm *Manager) replicateTask(ctx context.Context, peer string, task *types.TaskInfo) error {
+	replica := &types.TaskInfo{
+		ID:         task.ID,
+		Identifier: task.Identifier,
+		Md5:        task.Md5,
+		PieceSize:  task.PieceSize,
+		RawURL:     peerURL(peer, fmt.Sprintf("/tasks/%s/content", task.ID)),
+		TaskURL:    task.TaskURL,
+	}
+
+	// the pieces downloaded by the CDN are reported to the progress of supernode,
+	// which is removed after the replication unless the task is being downloaded.
+	if _, err := rm.progressMgr.GetSuperPieceCount(ctx, task.ID); errortypes.IsDataNotFound(err) {
+		if err := rm.progressMgr.InitProgress(ctx, task.ID, rm.cfg.GetSuperPID(), rm.cfg.GetSuperCID(task.ID)); err != nil {
+			return err
+		}
+		defer rm.progressMgr.DeleteProgressByTaskID(ctx, task.ID)
+	}
+
+	result, err := rm.cdnMgr.TriggerCDN(ctx, replica)
+	if err != nil {
+		return err
+	}
+	if result == nil || result.CdnStatus != types.TaskInfoCdnStatusSUCCESS {
+		return errors.Errorf("unexpected result of CDN: %+v", result)
+	}
+	if task.RealMd5 != "" && result.RealMd5 != task.RealMd5 {
+		if err := rm.cdnMgr.Delete(ctx, task.ID); err != nil {
+			logrus.Warnf("failed to delete the replicated file of taskID %s: %v", task.ID, err)
+		}
+		return errors.Errorf("md5 of the replicated file %s doesn't match %s", result.RealMd5, task.RealMd5)
+	}
+
+	logrus.Infof("success to replicate taskID %s from peer supernode %s", task.ID, peer)
+	return nil
+}
+
+// listCachedTasks lists the tasks whose files have been cached by the peer supernode.
+func listCachedTasks(peer string) ([]*types.TaskInfo, error) {
+	code, body, err := httputils.Get(peerURL(peer, "/tasks?cdnStatus="+types.TaskInfoCdnStatusSUCCESS), listTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if !httputils.HTTPStatusOk(code) {
+		return nil, errors.Errorf("failed to list the tasks with status code %d: %s", code, body)
+	}
+
+	var tasks []*types.TaskInfo
+	if err := json.Unmarshal(body, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// peerURL returns the url of the path on the peer supernode,
+// and the http scheme is used if the address has no scheme.
+func peerURL(peer, path string) string {
+	if !strings.Contains(peer, "://") {
+		peer = "http://" + peer
+	}
+	return strings.TrimSuffix(peer, "/") + path
+}
+
+func getPolicyName(cfg *config.Config) string {
+	if cfg == nil || cfg.BaseProperties == nil || cfg.ReplicationPolicy == "" {
+		return DefaultPolicy
+	}
+	return cfg.ReplicationPolicy
+}
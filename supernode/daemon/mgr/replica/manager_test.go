@@ -0,0 +1,143 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func init() {
+	check.Suite(&ReplicaMgrTestSuite{})
+}
+
+type ReplicaMgrTestSuite struct {
+	server *httptest.Server
+}
+
+func (s *ReplicaMgrTestSuite) SetUpSuite(c *check.C) {
+	tasks := []*types.TaskInfo{
+		{ID: "hot", AccessCount: 3, PieceSize: 4096, CdnStatus: types.TaskInfoCdnStatusSUCCESS},
+		{ID: "cold", AccessCount: 1, PieceSize: 4096, CdnStatus: types.TaskInfoCdnStatusSUCCESS},
+		{ID: "cached", AccessCount: 5, PieceSize: 4096, CdnStatus: types.TaskInfoCdnStatusSUCCESS},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tasks" || r.URL.Query().Get("cdnStatus") != types.TaskInfoCdnStatusSUCCESS {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(tasks)
+	}))
+}
+
+func (s *ReplicaMgrTestSuite) TearDownSuite(c *check.C) {
+	s.server.Close()
+}
+
+func (s *ReplicaMgrTestSuite) newManager(c *check.C, policy string) (*Manager, *mock.MockCDNMgr, *mock.MockProgressMgr) {
+	mockCtl := gomock.NewController(c)
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("fooPid")
+	cfg.ReplicationPolicy = policy
+	cfg.ReplicationMinAccessCount = 2
+
+	manager, err := NewManager(cfg, mockCDNMgr, mockProgressMgr, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	return manager, mockCDNMgr, mockProgressMgr
+}
+
+func (s *ReplicaMgrTestSuite) expectReplicate(mockCDNMgr *mock.MockCDNMgr, mockProgressMgr *mock.MockProgressMgr, peer string, taskIDs ...string) {
+	mockCDNMgr.EXPECT().GetStatus(gomock.Any(), "cached").Return(types.TaskInfoCdnStatusSUCCESS, nil).AnyTimes()
+	mockCDNMgr.EXPECT().GetStatus(gomock.Any(), gomock.Any()).Return("", errortypes.ErrDataNotFound).AnyTimes()
+	for _, taskID := range taskIDs {
+		mockProgressMgr.EXPECT().GetSuperPieceCount(gomock.Any(), taskID).Return(0, errortypes.ErrDataNotFound)
+		mockProgressMgr.EXPECT().InitProgress(gomock.Any(), taskID, "fooPid", gomock.Any()).Return(nil)
+		mockProgressMgr.EXPECT().DeleteProgressByTaskID(gomock.Any(), taskID).Return(nil)
+		mockCDNMgr.EXPECT().TriggerCDN(gomock.Any(), &types.TaskInfo{
+			ID:        taskID,
+			PieceSize: 4096,
+			RawURL:    peer + "/tasks/" + taskID + "/content",
+		}).Return(&types.TaskInfo{ID: taskID, CdnStatus: types.TaskInfoCdnStatusSUCCESS}, nil)
+	}
+}
+
+func (s *ReplicaMgrTestSuite) TestReplicateAll(c *check.C) {
+	manager, mockCDNMgr, mockProgressMgr := s.newManager(c, PolicyAll)
+	s.expectReplicate(mockCDNMgr, mockProgressMgr, s.server.URL, "hot", "cold")
+
+	count, err := manager.Replicate(context.Background(), s.server.URL)
+	c.Check(err, check.IsNil)
+	c.Check(count, check.Equals, 2)
+}
+
+func (s *ReplicaMgrTestSuite) TestReplicateHot(c *check.C) {
+	manager, mockCDNMgr, mockProgressMgr := s.newManager(c, PolicyHot)
+	s.expectReplicate(mockCDNMgr, mockProgressMgr, s.server.URL, "hot")
+
+	count, err := manager.Replicate(context.Background(), s.server.URL)
+	c.Check(err, check.IsNil)
+	c.Check(count, check.Equals, 1)
+}
+
+func (s *ReplicaMgrTestSuite) TestReplicateWithUnreachablePeer(c *check.C) {
+	manager, _, _ := s.newManager(c, PolicyAll)
+
+	_, err := manager.Replicate(context.Background(), s.server.URL+"/unknown")
+	c.Check(err, check.NotNil)
+}
+
+func (s *ReplicaMgrTestSuite) TestNewManagerWithUnknownPolicy(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.ReplicationPolicy = "foo"
+
+	_, err := NewManager(cfg, nil, nil, prometheus.NewRegistry())
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *ReplicaMgrTestSuite) TestPeerURL(c *check.C) {
+	var cases = []struct {
+		peer     string
+		expected string
+	}{
+		{peer: "127.0.0.1:8002", expected: "http://127.0.0.1:8002/tasks"},
+		{peer: "http://127.0.0.1:8002/", expected: "http://127.0.0.1:8002/tasks"},
+		{peer: "https://supernode", expected: "https://supernode/tasks"},
+	}
+
+	for _, v := range cases {
+		c.Check(peerURL(v.peer, "/tasks"), check.Equals, v.expected)
+	}
+}
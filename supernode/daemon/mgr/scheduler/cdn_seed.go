@@ -0,0 +1,131 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// seedLoadExpiry is the duration after which a piece assigned from supernode for seeding
+// is no longer counted even if the client never reports it, e.g. the client is gone.
+const seedLoadExpiry = 2 * time.Minute
+
+// seedLoad counts the pieces being downloaded from supernode by the clients
+// which could have downloaded them from the peers but are seeded by supernode,
+// so that the seeding never takes more than the limit of supernode.
+type seedLoad struct {
+	mu    sync.Mutex
+	limit int
+	// seeds maps a clientID to the pieces it's downloading from supernode for seeding
+	// with the time when they were assigned.
+	seeds map[string]map[int]time.Time
+	count int
+}
+
+func newSeedLoad(limit int) *seedLoad {
+	return &seedLoad{
+		limit: limit,
+		seeds: make(map[string]map[int]time.Time),
+	}
+}
+
+// acquire returns whether the piece can be seeded to the client by supernode,
+// and counts it until it's released. The load is unlimited if the limit is not greater than 0.
+func (sl *seedLoad) acquire(clientID string, pieceNum int) bool {
+	if sl.limit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if sl.count >= sl.limit {
+		sl.expire(now)
+	}
+	if sl.count >= sl.limit {
+		return false
+	}
+
+	pieces, ok := sl.seeds[clientID]
+	if !ok {
+		pieces = make(map[int]time.Time)
+		sl.seeds[clientID] = pieces
+	}
+	if _, ok := pieces[pieceNum]; !ok {
+		sl.count++
+	}
+	pieces[pieceNum] = now
+	return true
+}
+
+// release stops counting the piece seeded to the client.
+func (sl *seedLoad) release(clientID string, pieceNum int) {
+	if sl.limit <= 0 {
+		return
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.remove(clientID, pieceNum)
+}
+
+// sync releases the pieces seeded to the client which are no longer running on it.
+func (sl *seedLoad) sync(clientID string, runningPieces []int) {
+	if sl.limit <= 0 {
+		return
+	}
+
+	running := make(map[int]bool, len(runningPieces))
+	for _, pieceNum := range runningPieces {
+		running[pieceNum] = true
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	for pieceNum := range sl.seeds[clientID] {
+		if !running[pieceNum] {
+			sl.remove(clientID, pieceNum)
+		}
+	}
+}
+
+// expire releases the pieces which have been assigned longer than the seedLoadExpiry.
+func (sl *seedLoad) expire(now time.Time) {
+	for clientID, pieces := range sl.seeds {
+		for pieceNum, assigned := range pieces {
+			if now.Sub(assigned) > seedLoadExpiry {
+				sl.remove(clientID, pieceNum)
+			}
+		}
+	}
+}
+
+func (sl *seedLoad) remove(clientID string, pieceNum int) {
+	pieces, ok := sl.seeds[clientID]
+	if !ok {
+		return
+	}
+	if _, ok := pieces[pieceNum]; !ok {
+		return
+	}
+	delete(pieces, pieceNum)
+	sl.count--
+	if len(pieces) == 0 {
+		delete(sl.seeds, clientID)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// clientFairness counts the recent assignments of the pieces of each task from the peers
+// for the clients contending for the task, so that the scarce peers are shared among
+// the clients with max-min fairness rather than favoring the early arrivals.
+type clientFairness struct {
+	mu     sync.Mutex
+	window time.Duration
+	// tasks maps a taskID to the clients contending for it.
+	tasks     map[string]map[string]*clientAssignments
+	lastPrune time.Time
+}
+
+// clientAssignments records the recent activity of a client contending for a task.
+type clientAssignments struct {
+	// lastSeen is the last time that the client requested the pieces of the task.
+	lastSeen time.Time
+	// assigned contains the times of the assignments within the window in order.
+	assigned []time.Time
+}
+
+func newClientFairness(window time.Duration) *clientFairness {
+	return &clientFairness{
+		window: window,
+		tasks:  make(map[string]map[string]*clientAssignments),
+	}
+}
+
+// touch records that the client is requesting the pieces of the task.
+func (cf *clientFairness) touch(taskID, clientID string) {
+	if cf.window <= 0 {
+		return
+	}
+
+	now := time.Now()
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	cf.prune(now)
+	cf.getOrCreate(taskID, clientID).lastSeen = now
+}
+
+// assign records that a piece of the task is assigned to the client from a peer.
+func (cf *clientFairness) assign(taskID, clientID string) {
+	if cf.window <= 0 {
+		return
+	}
+
+	now := time.Now()
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	ca := cf.getOrCreate(taskID, clientID)
+	ca.assigned = append(ca.assigned, now)
+}
+
+// countLessServed returns the number of the other clients contending for the task
+// within the window which have been assigned fewer pieces than the client.
+func (cf *clientFairness) countLessServed(taskID, clientID string) int {
+	if cf.window <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	clients := cf.tasks[taskID]
+	self, ok := clients[clientID]
+	if !ok {
+		return 0
+	}
+
+	selfCount := self.count(now, cf.window)
+	lessServed := 0
+	for id, ca := range clients {
+		if id == clientID || now.Sub(ca.lastSeen) > cf.window {
+			continue
+		}
+		if ca.count(now, cf.window) < selfCount {
+			lessServed++
+		}
+	}
+	return lessServed
+}
+
+func (cf *clientFairness) getOrCreate(taskID, clientID string) *clientAssignments {
+	clients, ok := cf.tasks[taskID]
+	if !ok {
+		clients = make(map[string]*clientAssignments)
+		cf.tasks[taskID] = clients
+	}
+	ca, ok := clients[clientID]
+	if !ok {
+		ca = &clientAssignments{}
+		clients[clientID] = ca
+	}
+	return ca
+}
+
+// prune forgets the clients which have neither requested nor been assigned
+// within the window, and it runs at most once per window.
+func (cf *clientFairness) prune(now time.Time) {
+	if now.Sub(cf.lastPrune) < cf.window {
+		return
+	}
+	cf.lastPrune = now
+
+	for taskID, clients := range cf.tasks {
+		for clientID, ca := range clients {
+			if now.Sub(ca.lastSeen) > cf.window && ca.count(now, cf.window) == 0 {
+				delete(clients, clientID)
+			}
+		}
+		if len(clients) == 0 {
+			delete(cf.tasks, taskID)
+		}
+	}
+}
+
+// count returns the number of the assignments within the window,
+// and the earlier ones are dropped.
+func (ca *clientAssignments) count(now time.Time, window time.Duration) int {
+	i := 0
+	for i < len(ca.assigned) && now.Sub(ca.assigned[i]) > window {
+		i++
+	}
+	ca.assigned = ca.assigned[i:]
+	return len(ca.assigned)
+}
+
+// deferForFairness returns whether to leave the peers holding a piece to the other clients,
+// which is true when their free upload slots are not enough for the contending clients
+// assigned fewer pieces of the task than the client within the AssignmentFairnessWindow.
+// Supernode is not counted as a peer since it's always the source of the last resort.
+func (sm *Manager) deferForFairness(ctx context.Context, taskID, clientID, srcPID string, peerIDs []string) bool {
+	if sm.cfg.AssignmentFairnessWindow <= 0 {
+		return false
+	}
+
+	hasPeer := false
+	freeSlots := 0
+	for _, peerID := range sm.excludeSelf(ctx, srcPID, peerIDs) {
+		if sm.cfg.IsSuperPID(peerID) {
+			continue
+		}
+		hasPeer = true
+		peerState, err := sm.progressMgr.GetPeerStateByPeerID(ctx, peerID)
+		if err != nil || peerState.ProducerLoad == nil {
+			continue
+		}
+		if free := int(sm.getUpLimit(peerState) - peerState.ProducerLoad.Get()); free > 0 {
+			freeSlots += free
+		}
+	}
+	if !hasPeer {
+		return false
+	}
+
+	lessServed := sm.fairness.countLessServed(taskID, clientID)
+	return lessServed > 0 && freeSlots <= lessServed
+}
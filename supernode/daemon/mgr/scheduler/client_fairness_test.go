@@ -0,0 +1,140 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+)
+
+func init() {
+	check.Suite(&ClientFairnessTestSuite{})
+}
+
+type ClientFairnessTestSuite struct{}
+
+func newTestPeerState(peerID string) *mgr.PeerState {
+	var downTime int64
+	return &mgr.PeerState{
+		PeerID:              peerID,
+		ClientErrorCount:    atomiccount.NewAtomicInt(0),
+		ServiceDownTime:     &downTime,
+		ServiceErrorCount:   atomiccount.NewAtomicInt(0),
+		ServiceSuccessCount: atomiccount.NewAtomicInt(0),
+		ProducerLoad:        atomiccount.NewAtomicInt(0),
+	}
+}
+
+// countSeedAssignments returns the times each client is assigned the pieces from the only peer
+// holding them, when the clients request the pieces in the same order in rounds and the peer
+// finishes serving all of them between the rounds.
+func countSeedAssignments(c *check.C, window time.Duration, clientCount, rounds int) []int {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("superPID")
+	cfg.SlowStartInitialLimit = 0
+	cfg.CDNSeedMinPeers = 0
+	cfg.AssignmentFairnessWindow = window
+	manager, _ := NewManager(cfg, mockProgressMgr, nil)
+
+	seedState := newTestPeerState("seed")
+	mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), "seed").Return(seedState, nil).AnyTimes()
+	mockProgressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), gomock.Any()).Return(nil, errortypes.ErrDataNotFound).AnyTimes()
+	for i := 0; i < clientCount; i++ {
+		peerID := fmt.Sprintf("peer%d", i)
+		mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), peerID).Return(newTestPeerState(peerID), nil).AnyTimes()
+	}
+	mockProgressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), "taskID", gomock.Any()).Return([]string{"seed"}, nil).AnyTimes()
+	mockProgressMgr.EXPECT().UpdateClientProgress(gomock.Any(), "taskID", gomock.Any(), gomock.Any(), gomock.Any(), config.PieceRUNNING).
+		Return(nil).AnyTimes()
+
+	counts := make([]int, clientCount)
+	for round := 0; round < rounds; round++ {
+		for i := 0; i < clientCount; i++ {
+			results, err := manager.getPieceResults(context.TODO(), "taskID", fmt.Sprintf("client%d", i),
+				fmt.Sprintf("peer%d", i), []int{0, 1, 2, 3, 4, 5}, 0, nil)
+			c.Assert(err, check.IsNil)
+			c.Assert(len(results), check.Equals, config.PeerDownLimit)
+			for _, result := range results {
+				if result.DstPID == "seed" {
+					counts[i]++
+				}
+			}
+		}
+		seedState.ProducerLoad.Set(0)
+	}
+	return counts
+}
+
+func (s *ClientFairnessTestSuite) TestEarlyArrivalsFavoredWithoutWindow(c *check.C) {
+	counts := countSeedAssignments(c, 0, 10, 20)
+	c.Check(counts[0], check.Equals, 20*config.PeerDownLimit)
+	c.Check(counts[9], check.Equals, 0)
+}
+
+func (s *ClientFairnessTestSuite) TestShareScarcePeerFairly(c *check.C) {
+	clientCount, rounds := 10, 20
+	counts := countSeedAssignments(c, time.Hour, clientCount, rounds)
+
+	// all the slots of the peer are used and spread evenly among the clients
+	total, min, max := 0, counts[0], counts[0]
+	for _, count := range counts {
+		total += count
+		if count < min {
+			min = count
+		}
+		if count > max {
+			max = count
+		}
+	}
+	c.Check(total, check.Equals, rounds*config.PeerUpLimit)
+	c.Check(max-min <= 1, check.Equals, true, check.Commentf("counts: %v", counts))
+}
+
+func (s *ClientFairnessTestSuite) TestCountLessServed(c *check.C) {
+	cf := newClientFairness(time.Hour)
+	cf.touch("taskID", "client1")
+	cf.touch("taskID", "client2")
+	cf.touch("otherTaskID", "client3")
+	cf.assign("taskID", "client1")
+	c.Check(cf.countLessServed("taskID", "client1"), check.Equals, 1)
+	c.Check(cf.countLessServed("taskID", "client2"), check.Equals, 0)
+	c.Check(cf.countLessServed("taskID", "unknown"), check.Equals, 0)
+
+	// the assignments and the clients out of the window are forgotten
+	ca := cf.tasks["taskID"]["client1"]
+	ca.assigned[0] = time.Now().Add(-2 * time.Hour)
+	c.Check(cf.countLessServed("taskID", "client1"), check.Equals, 0)
+	cf.tasks["taskID"]["client2"].lastSeen = time.Now().Add(-2 * time.Hour)
+	cf.lastPrune = time.Time{}
+	cf.touch("taskID", "client1")
+	_, ok := cf.tasks["taskID"]["client2"]
+	c.Check(ok, check.Equals, false)
+}
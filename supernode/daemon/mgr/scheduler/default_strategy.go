@@ -0,0 +1,105 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterStrategy(DefaultStrategy, newDefaultStrategy)
+}
+
+var _ UnrankedStrategy = &defaultStrategy{}
+
+// defaultStrategy selects all the candidates which are still able to provide services
+// in the order of the candidates, which are equally good.
+type defaultStrategy struct {
+	progressMgr mgr.ProgressMgr
+}
+
+func newDefaultStrategy(cfg *config.Config, progressMgr mgr.ProgressMgr) (Strategy, error) {
+	return &defaultStrategy{
+		progressMgr: progressMgr,
+	}, nil
+}
+
+// SelectSources filters out the candidates whose service is unavailable
+// and removes them from the peers of the piece.
+func (ds *defaultStrategy) SelectSources(ctx context.Context, taskID, srcPID string, pieceNum int, candidates []string) []string {
+	var sources []string
+	for _, peerID := range candidates {
+		// if failed to get peerState, and then it should not be needed.
+		peerState, err := ds.progressMgr.GetPeerStateByPeerID(ctx, peerID)
+		if err != nil {
+			ds.deletePeerIDByPieceNum(ctx, taskID, pieceNum, peerID)
+			continue
+		}
+
+		// if the service has been down, and then it should not be needed.
+		if peerState.ServiceDownTime != nil && *(peerState.ServiceDownTime) > 0 {
+			ds.deletePeerIDByPieceNum(ctx, taskID, pieceNum, peerID)
+			continue
+		}
+
+		// if service has failed for EliminationLimit times, and then it should not be needed.
+		if peerState.ServiceErrorCount != nil && peerState.ServiceErrorCount.Get() >= config.EliminationLimit {
+			ds.deletePeerIDByPieceNum(ctx, taskID, pieceNum, peerID)
+			continue
+		}
+
+		// if the v is in the blackList, try the next one.
+		blackInfo, err := ds.progressMgr.GetBlackInfoByPeerID(ctx, peerID)
+		if err != nil && !errortypes.IsDataNotFound(err) {
+			logrus.Errorf("failed to get blackInfo for peerID %s: %v", peerID, err)
+			continue
+		}
+		if blackInfo != nil && isExistInMap(blackInfo, peerID) {
+			continue
+		}
+
+		sources = append(sources, peerID)
+	}
+	return sources
+}
+
+// Unranked returns true since the candidates are not ranked by the default strategy.
+func (ds *defaultStrategy) Unranked() bool {
+	return true
+}
+
+func (ds *defaultStrategy) deletePeerIDByPieceNum(ctx context.Context, taskID string, pieceNum int, peerID string) {
+	if err := ds.progressMgr.DeletePeerIDByPieceNum(ctx, taskID, pieceNum, peerID); err != nil {
+		logrus.Warnf("failed to delete the peerID %s for pieceNum %d of taskID: %s", peerID, pieceNum, taskID)
+	}
+}
+
+// isExistInMap returns whether the key exists in the mmap
+func isExistInMap(mmap *syncmap.SyncMap, key string) bool {
+	if mmap == nil {
+		return false
+	}
+	_, err := mmap.Get(key)
+	return err == nil
+}
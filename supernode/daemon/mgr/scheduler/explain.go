@@ -0,0 +1,253 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+)
+
+// maxDecisions is the max number of the decisions kept by the decisionLog,
+// beyond which the least recently made ones are dropped.
+const maxDecisions = 4096
+
+// the reasons why the source of a piece was chosen.
+const (
+	reasonFirstAvailable = "first-available-source"
+	reasonSafeMode       = "safe-mode"
+	reasonClientErrors   = "client-errors"
+	reasonNoSources      = "no-sources"
+	reasonFairness       = "fairness"
+	reasonCDNSeed        = "cdn-seed"
+	reasonAllBusy        = "all-sources-busy"
+)
+
+// the statuses of the candidates considered for a piece.
+const (
+	candidateSelected    = "selected"
+	candidateBusy        = "busy"
+	candidateUntried     = "untried"
+	candidateStalled     = "stalled"
+	candidateSameHost    = "same-host"
+	candidateUnavailable = "unavailable"
+	candidateDeferred    = "deferred"
+)
+
+// weightedStrategy is implemented by the strategy which ranks the sources by their weights.
+type weightedStrategy interface {
+	weight(ctx context.Context, peerID string) float64
+}
+
+// decisionLog keeps the most recent decisions of the scheduler on the sources of the pieces
+// for debugging, and it's nil if the SchedulerExplain is disabled so that nothing is recorded.
+type decisionLog struct {
+	mu       sync.Mutex
+	capacity int
+	// decisions maps the key of a decision to its element in the order.
+	decisions map[string]*list.Element
+	// order contains the decisions from the least recently made to the most.
+	order *list.List
+}
+
+func newDecisionLog(enabled bool, capacity int) *decisionLog {
+	if !enabled {
+		return nil
+	}
+	return &decisionLog{
+		capacity:  capacity,
+		decisions: make(map[string]*list.Element),
+		order:     list.New(),
+	}
+}
+
+func decisionKey(taskID, clientID string, pieceNum int) string {
+	return fmt.Sprintf("%s/%s/%d", taskID, clientID, pieceNum)
+}
+
+// enabled returns whether the decisions are recorded.
+func (l *decisionLog) enabled() bool {
+	return l != nil
+}
+
+// add records the decision, which replaces the previous one on the same piece for the same client.
+func (l *decisionLog) add(decision *types.SchedulerDecision) {
+	if l == nil || decision == nil {
+		return
+	}
+
+	key := decisionKey(decision.TaskID, decision.CID, int(decision.PieceNum))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.decisions[key]; ok {
+		l.order.Remove(e)
+	}
+	l.decisions[key] = l.order.PushBack(decision)
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Front()
+		l.order.Remove(oldest)
+		d := oldest.Value.(*types.SchedulerDecision)
+		delete(l.decisions, decisionKey(d.TaskID, d.CID, int(d.PieceNum)))
+	}
+}
+
+func (l *decisionLog) get(taskID, clientID string, pieceNum int) *types.SchedulerDecision {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.decisions[decisionKey(taskID, clientID, pieceNum)]; ok {
+		return e.Value.(*types.SchedulerDecision)
+	}
+	return nil
+}
+
+// Explain gets the most recent decision on the source of the piece assigned to the client.
+func (sm *Manager) Explain(ctx context.Context, taskID, clientID string, pieceNum int) (*types.SchedulerDecision, error) {
+	if !sm.decisions.enabled() {
+		return nil, errors.Wrap(errortypes.ErrDataNotFound, "the decisions are not recorded since the scheduler explain is disabled")
+	}
+	decision := sm.decisions.get(taskID, clientID, pieceNum)
+	if decision == nil {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "decision of pieceNum %d for taskID %s clientID %s", pieceNum, taskID, clientID)
+	}
+	return decision, nil
+}
+
+func (sm *Manager) newDecision(taskID, clientID string, pieceNum int) *types.SchedulerDecision {
+	return &types.SchedulerDecision{
+		TaskID:     taskID,
+		CID:        clientID,
+		PieceNum:   int32(pieceNum),
+		Strategy:   getStrategyName(sm.cfg),
+		CreatedAt:  strfmt.DateTime(time.Now()),
+		Candidates: []*types.SchedulerCandidate{},
+	}
+}
+
+// explainSupernode explains the piece assigned from supernode without considering the peers.
+func (sm *Manager) explainSupernode(taskID, clientID string, pieceNum int, reason string) *types.SchedulerDecision {
+	decision := sm.newDecision(taskID, clientID, pieceNum)
+	decision.DstPID = sm.cfg.GetSuperPID()
+	decision.Reason = reason
+	return decision
+}
+
+// explainSources explains the candidates holding the piece before its source is picked,
+// with the load and the capacity that the decision is based on. The candidates are the peers
+// holding the piece, and the sources are the ones selected by the strategy in order.
+func (sm *Manager) explainSources(ctx context.Context, taskID, clientID, srcPID string, pieceNum int,
+	candidates []string, stalledPID string, deferred bool, sources []string) *types.SchedulerDecision {
+	decision := sm.newDecision(taskID, clientID, pieceNum)
+
+	ranks := make(map[string]int, len(sources))
+	for i, peerID := range sources {
+		ranks[peerID] = i + 1
+	}
+	others := make(map[string]bool, len(candidates))
+	for _, peerID := range sm.excludeSelf(ctx, srcPID, candidates) {
+		others[peerID] = true
+	}
+	weighted, _ := sm.strategy.(weightedStrategy)
+
+	for _, peerID := range candidates {
+		candidate := &types.SchedulerCandidate{
+			PeerID: peerID,
+			Rank:   int32(ranks[peerID]),
+		}
+		if peerState, err := sm.progressMgr.GetPeerStateByPeerID(ctx, peerID); err == nil {
+			if peerState.ProducerLoad != nil {
+				candidate.Load = peerState.ProducerLoad.Get()
+			}
+			candidate.UpLimit = sm.getUpLimit(peerState)
+		}
+		if weighted != nil && candidate.Rank > 0 {
+			candidate.Weight = weighted.weight(ctx, peerID)
+		}
+
+		switch {
+		case candidate.Rank > 0:
+			// it's settled once the source is picked
+			candidate.Status = candidateUntried
+		case peerID == stalledPID:
+			candidate.Status = candidateStalled
+		case !others[peerID]:
+			candidate.Status = candidateSameHost
+		case deferred:
+			candidate.Status = candidateDeferred
+		default:
+			candidate.Status = candidateUnavailable
+		}
+		decision.Candidates = append(decision.Candidates, candidate)
+	}
+	return decision
+}
+
+// settleDecision settles the statuses of the sources and the reason of the decision once
+// the piece is assigned from dstPID. The sources ranked ahead of the selected one were busy,
+// since the first source whose load is under its upload limit is picked.
+func settleDecision(decision *types.SchedulerDecision, dstPID string, seeded bool) {
+	if decision == nil {
+		return
+	}
+	decision.DstPID = dstPID
+	if seeded {
+		decision.Reason = reasonCDNSeed
+		return
+	}
+
+	var selectedRank int32
+	hasSource, deferred := false, false
+	for _, candidate := range decision.Candidates {
+		if candidate.Rank > 0 {
+			hasSource = true
+		}
+		if candidate.Status == candidateDeferred {
+			deferred = true
+		}
+		if candidate.Rank > 0 && candidate.PeerID == dstPID {
+			candidate.Status = candidateSelected
+			selectedRank = candidate.Rank
+		}
+	}
+	for _, candidate := range decision.Candidates {
+		if candidate.Rank > 0 && (selectedRank == 0 || candidate.Rank < selectedRank) {
+			candidate.Status = candidateBusy
+		}
+	}
+
+	switch {
+	case selectedRank > 0:
+		decision.Reason = reasonFirstAvailable
+	case hasSource:
+		decision.Reason = reasonAllBusy
+	case deferred:
+		decision.Reason = reasonFairness
+	default:
+		decision.Reason = reasonNoSources
+	}
+}
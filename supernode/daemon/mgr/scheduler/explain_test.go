@@ -0,0 +1,175 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/progress"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// candidatesOf returns the candidates of the decision by their peerIDs.
+func candidatesOf(decision *types.SchedulerDecision) map[string]*types.SchedulerCandidate {
+	candidates := make(map[string]*types.SchedulerCandidate, len(decision.Candidates))
+	for _, candidate := range decision.Candidates {
+		candidates[candidate.PeerID] = candidate
+	}
+	return candidates
+}
+
+func (s *SchedulerMgrTestSuite) TestExplainDecision(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	cfg.CDNSeedMinPeers = 0
+	cfg.SchedulerExplain = true
+	progressMgr, err := progress.NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	manager, _ := NewManager(cfg, progressMgr, nil)
+	ctx := context.Background()
+
+	// the piece is held by the free peer, the busy peer and the down peer
+	for _, peerID := range []string{"free", "busy", "down", "peerA", "peerB", "peerC"} {
+		c.Assert(progressMgr.InitProgress(ctx, "taskID", peerID, peerID+"CID"), check.IsNil)
+	}
+	for _, peerID := range []string{"free", "busy", "down"} {
+		c.Assert(progressMgr.UpdateProgress(ctx, "taskID", peerID+"CID", peerID, "superPID", 0, config.PieceSUCCESS, 100), check.IsNil)
+	}
+	freeState, err := progressMgr.GetPeerStateByPeerID(ctx, "free")
+	c.Assert(err, check.IsNil)
+	busyState, err := progressMgr.GetPeerStateByPeerID(ctx, "busy")
+	c.Assert(err, check.IsNil)
+	busyState.ProducerLoad.Set(manager.getUpLimit(busyState))
+	downState, err := progressMgr.GetPeerStateByPeerID(ctx, "down")
+	c.Assert(err, check.IsNil)
+	*downState.ServiceDownTime = time.Now().Unix()
+
+	// the free peer is chosen since the busy one has no capacity left
+	results, err := manager.getPieceResults(ctx, "taskID", "peerACID", "peerA", []int{0}, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+	c.Check(results[0].DstPID, check.Equals, "free")
+
+	decision, err := manager.Explain(ctx, "taskID", "peerACID", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(decision.DstPID, check.Equals, "free")
+	c.Check(decision.Reason, check.Equals, reasonFirstAvailable)
+	c.Check(decision.Strategy, check.Equals, DefaultStrategy)
+	candidates := candidatesOf(decision)
+	c.Assert(len(candidates), check.Equals, 3)
+	free, busy, down := candidates["free"], candidates["busy"], candidates["down"]
+	c.Check(free.Status, check.Equals, candidateSelected)
+	c.Check(free.Load, check.Equals, int32(0))
+	c.Check(free.UpLimit, check.Equals, manager.getUpLimit(freeState))
+	c.Check(busy.Load, check.Equals, busy.UpLimit)
+	c.Check(free.Rank > 0 && busy.Rank > 0, check.Equals, true)
+	// the busy peer is tried only if it's ranked ahead of the free one
+	if busy.Rank < free.Rank {
+		c.Check(busy.Status, check.Equals, candidateBusy)
+	} else {
+		c.Check(busy.Status, check.Equals, candidateUntried)
+	}
+	c.Check(down.Status, check.Equals, candidateUnavailable)
+	c.Check(down.Rank, check.Equals, int32(0))
+
+	// the piece is assigned from supernode once all the sources are busy
+	results, err = manager.getPieceResults(ctx, "taskID", "peerBCID", "peerB", []int{0}, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+	c.Check(results[0].DstPID, check.Equals, "superPID")
+	decision, err = manager.Explain(ctx, "taskID", "peerBCID", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(decision.DstPID, check.Equals, "superPID")
+	c.Check(decision.Reason, check.Equals, reasonAllBusy)
+	for _, candidate := range decision.Candidates {
+		if candidate.Rank > 0 {
+			c.Check(candidate.Status, check.Equals, candidateBusy)
+			c.Check(candidate.Load, check.Equals, candidate.UpLimit)
+		}
+	}
+
+	// the peers are not considered at all in the safe mode
+	manager.SetSafeMode(ctx, true, false)
+	_, err = manager.getPieceResults(ctx, "taskID", "peerCCID", "peerC", []int{0}, 0, nil)
+	c.Assert(err, check.IsNil)
+	decision, err = manager.Explain(ctx, "taskID", "peerCCID", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(decision.DstPID, check.Equals, "superPID")
+	c.Check(decision.Reason, check.Equals, reasonSafeMode)
+	c.Check(len(decision.Candidates), check.Equals, 0)
+
+	_, err = manager.Explain(ctx, "taskID", "unknownCID", 0)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	// nothing is recorded if it's disabled
+	manager, _ = NewManager(config.NewConfig(), progressMgr, nil)
+	_, err = manager.Explain(ctx, "taskID", "peerACID", 0)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *SchedulerMgrTestSuite) TestExplainWeights(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	cfg.CDNSeedMinPeers = 0
+	cfg.SlowStartInitialLimit = 0
+	cfg.SchedulerStrategy = WeightedRandomStrategy
+	cfg.SchedulerExplain = true
+	progressMgr, err := progress.NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	manager, err := NewManager(cfg, progressMgr, nil)
+	c.Assert(err, check.IsNil)
+	ctx := context.Background()
+
+	for _, peerID := range []string{"idle", "loaded", "full", "peer"} {
+		c.Assert(progressMgr.InitProgress(ctx, "taskID", peerID, peerID+"CID"), check.IsNil)
+	}
+	for _, peerID := range []string{"idle", "loaded", "full"} {
+		c.Assert(progressMgr.UpdateProgress(ctx, "taskID", peerID+"CID", peerID, "superPID", 0, config.PieceSUCCESS, 100), check.IsNil)
+	}
+	loadedState, err := progressMgr.GetPeerStateByPeerID(ctx, "loaded")
+	c.Assert(err, check.IsNil)
+	loadedState.ProducerLoad.Set(config.PeerUpLimit - 1)
+	fullState, err := progressMgr.GetPeerStateByPeerID(ctx, "full")
+	c.Assert(err, check.IsNil)
+	fullState.ProducerLoad.Set(config.PeerUpLimit)
+
+	results, err := manager.getPieceResults(ctx, "taskID", "peerCID", "peer", []int{0}, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+
+	// the weights are the remaining capacity of the peers with the temperature 1
+	decision, err := manager.Explain(ctx, "taskID", "peerCID", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(decision.Strategy, check.Equals, WeightedRandomStrategy)
+	c.Check(decision.DstPID, check.Equals, results[0].DstPID)
+	candidates := candidatesOf(decision)
+	c.Check(candidates["idle"].Weight, check.Equals, float64(config.PeerUpLimit))
+	c.Check(candidates["loaded"].Weight, check.Equals, float64(1))
+	c.Check(candidates["full"].Weight, check.Equals, float64(0))
+	// and the full peer is ranked last and never tried
+	c.Check(candidates["full"].Rank, check.Equals, int32(3))
+	c.Check(candidates["full"].Status, check.Equals, candidateUntried)
+	c.Check(candidates[results[0].DstPID].Status, check.Equals, candidateSelected)
+}
@@ -18,10 +18,12 @@ package scheduler
 
 import (
 	"context"
+	"math"
 	"math/rand"
 	"sort"
-	"time"
+	"sync/atomic"
 
+	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
@@ -31,28 +33,81 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 var _ mgr.SchedulerMgr = &Manager{}
 
+// budgetThrottleRatio is the ratio of the served bytes to the TaskBandwidthBudget
+// from which the peers of the task are throttled.
+const budgetThrottleRatio = 0.9
+
 // Manager is an implement of the interface of SchedulerMgr.
 type Manager struct {
 	cfg         *config.Config
 	progressMgr mgr.ProgressMgr
+	// peerMgr is used to recognize the peers on the same host as the requesting peer.
+	peerMgr  mgr.PeerMgr
+	strategy Strategy
+	// tiebreaker orders the sources selected by the UnrankedStrategy.
+	tiebreaker tiebreaker
+	// rand makes the random decisions of the scheduler, which is seeded by the SchedulerSeed.
+	rand *rand.Rand
+
+	// handoffs contains the pieces assigned to the clients by the warm handoff.
+	// key:clientID,value:*handoff
+	handoffs *syncmap.SyncMap
+	// fairness counts the recent assignments of the clients from the peers.
+	fairness *clientFairness
+	// seeds counts the pieces being seeded to the clients by supernode.
+	seeds *seedLoad
+	// safeMode makes all the pieces scheduled from supernode when it's enabled.
+	safeMode *safeMode
+	// decisions records the recent decisions on the sources of the pieces if SchedulerExplain is enabled.
+	decisions *decisionLog
 }
 
-// NewManager returns a new Manager.
-func NewManager(cfg *config.Config, progressMgr mgr.ProgressMgr) (*Manager, error) {
+// NewManager returns a new Manager with the strategy specified by cfg.SchedulerStrategy.
+func NewManager(cfg *config.Config, progressMgr mgr.ProgressMgr, peerMgr mgr.PeerMgr) (*Manager, error) {
+	strategy, err := newStrategy(cfg, progressMgr)
+	if err != nil {
+		return nil, err
+	}
+	seed := getSchedulerSeed(cfg)
+	tiebreaker, err := newTiebreaker(getTiebreakerName(cfg), seed)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("success to init scheduler with strategy %s and tiebreaker %s", getStrategyName(cfg), getTiebreakerName(cfg))
+
 	return &Manager{
 		cfg:         cfg,
 		progressMgr: progressMgr,
+		peerMgr:     peerMgr,
+		strategy:    strategy,
+		tiebreaker:  tiebreaker,
+		rand:        newLockedRand(seed),
+		handoffs:    syncmap.NewSyncMap(),
+		fairness:    newClientFairness(cfg.AssignmentFairnessWindow),
+		seeds:       newSeedLoad(cfg.CDNSeedMaxLoad),
+		safeMode:    newSafeMode(cfg.SafeMode, cfg.SafeModeCutPeerTransfers),
+		decisions:   newDecisionLog(cfg.SchedulerExplain, maxDecisions),
 	}, nil
 }
 
 // Schedule gets scheduler result with specified taskID, clientID and peerID through some rules.
-func (sm *Manager) Schedule(ctx context.Context, taskID, clientID, peerID string) ([]*mgr.PieceResult, error) {
+func (sm *Manager) Schedule(ctx context.Context, taskID, clientID, peerID, pieceOrder string) ([]*mgr.PieceResult, error) {
+	// cancel the stalled pieces to reassign them from the alternate sources
+	stalled, err := sm.progressMgr.CancelStalledPieces(ctx, taskID, clientID, peerID)
+	if err != nil {
+		logrus.Warnf("failed to cancel the stalled pieces of clientID(%s) for taskID(%s): %v", clientID, taskID, err)
+	}
+	// cancel the pieces being downloaded from the peers to reassign them from supernode
+	if enabled, cutPeerTransfers := sm.safeMode.get(); enabled && cutPeerTransfers {
+		cancelled, err := sm.progressMgr.CancelPeerPieces(ctx, taskID, clientID)
+		if err != nil {
+			logrus.Warnf("failed to cancel the peer pieces of clientID(%s) for taskID(%s): %v", clientID, taskID, err)
+		}
+		stalled = mergeCancelled(stalled, cancelled)
+	}
+
 	// get available pieces
 	pieceAvailable, err := sm.progressMgr.GetPieceProgressByCID(ctx, taskID, clientID, "available")
 	if err != nil {
@@ -69,22 +124,38 @@ func (sm *Manager) Schedule(ctx context.Context, taskID, clientID, peerID string
 		return nil, err
 	}
 	logrus.Debugf("scheduler get running pieces %v for taskID(%s)", pieceRunning, taskID)
+	sm.seeds.sync(clientID, pieceRunning)
 	runningCount := len(pieceRunning)
 	if runningCount >= config.PeerDownLimit {
 		return nil, errors.Wrapf(errortypes.PeerContinue, "taskID: %s,clientID: %s", taskID, clientID)
 	}
 
 	// prioritize pieces
-	pieceNums, err := sm.sort(ctx, pieceAvailable, pieceRunning, taskID)
+	pieceNums, err := sm.sort(ctx, pieceAvailable, pieceRunning, taskID, pieceOrder)
 	if err != nil {
 		return nil, err
 	}
+	pieceNums = sm.prioritizeHandoff(taskID, clientID, pieceNums)
+	pieceNums = prioritizeStalled(pieceNums, stalled)
 	logrus.Debugf("scheduler get pieces %v with prioritize for taskID(%s)", pieceNums, taskID)
 
-	return sm.getPieceResults(ctx, taskID, clientID, peerID, pieceNums, runningCount)
+	return sm.getPieceResults(ctx, taskID, clientID, peerID, pieceNums, runningCount, stalled)
 }
 
-func (sm *Manager) sort(ctx context.Context, pieceNums, runningPieces []int, taskID string) ([]int, error) {
+// sort orders the pieceNums as per the pieceOrder hinted by the client,
+// and the rarest pieces are prioritized if no hint is given.
+func (sm *Manager) sort(ctx context.Context, pieceNums, runningPieces []int, taskID, pieceOrder string) ([]int, error) {
+	switch pieceOrder {
+	case types.DfGetTaskPieceOrderSequential:
+		sort.Ints(pieceNums)
+		return pieceNums, nil
+	case types.DfGetTaskPieceOrderRandom:
+		sm.rand.Shuffle(len(pieceNums), func(i, j int) {
+			pieceNums[i], pieceNums[j] = pieceNums[j], pieceNums[i]
+		})
+		return pieceNums, nil
+	}
+
 	pieceCountMap, err := sm.getPieceCountMap(ctx, pieceNums, taskID)
 	if err != nil {
 		return nil, err
@@ -131,7 +202,7 @@ func (sm *Manager) sortExecutor(ctx context.Context, pieceNums []int, centerNum
 
 		// randomly choose whether to exchange when the distance to center value is equal
 		if abs(pieceNums[i]-centerNum) == abs(pieceNums[j]-centerNum) {
-			randNum := rand.Intn(2)
+			randNum := sm.rand.Intn(2)
 			if randNum == 0 {
 				return true
 			}
@@ -140,9 +211,15 @@ func (sm *Manager) sortExecutor(ctx context.Context, pieceNums []int, centerNum
 	})
 }
 
-func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, peerID string, pieceNums []int, runningCount int) ([]*mgr.PieceResult, error) {
+// getPieceResults assigns the sources of the pieceNums to the client, and the pieces
+// cancelled since they stalled are assigned from the sources other than the stalled ones.
+func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, peerID string, pieceNums []int, runningCount int,
+	stalled map[int]string) ([]*mgr.PieceResult, error) {
 	// validate ClientErrorCount
-	var useSupernode bool
+	var (
+		useSupernode    bool
+		supernodeReason string
+	)
 	srcPeerState, err := sm.progressMgr.GetPeerStateByPeerID(ctx, peerID)
 	if err != nil {
 		return nil, err
@@ -151,20 +228,58 @@ func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, peerID
 		logrus.Warnf("peerID: %s got errors for %d times which reaches error limit: %d for taskID(%s)",
 			peerID, srcPeerState.ClientErrorCount.Get(), config.FailCountLimit, taskID)
 		useSupernode = true
+		supernodeReason = reasonClientErrors
+	}
+	if enabled, _ := sm.safeMode.get(); enabled {
+		useSupernode = true
+		supernodeReason = reasonSafeMode
 	}
 
+	downLimit := sm.getDownLimit(srcPeerState)
+	budgetLimit, err := sm.getBudgetLimit(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if budgetLimit < downLimit {
+		downLimit = budgetLimit
+	}
+	if runningCount >= downLimit {
+		return nil, errors.Wrapf(errortypes.PeerContinue, "taskID: %s,clientID: %s", taskID, clientID)
+	}
+	sm.fairness.touch(taskID, clientID)
+
 	pieceResults := make([]*mgr.PieceResult, 0)
 	for i := 0; i < len(pieceNums); i++ {
 		var dstPID string
 		if useSupernode {
 			dstPID = sm.cfg.GetSuperPID()
+			if sm.decisions.enabled() {
+				sm.decisions.add(sm.explainSupernode(taskID, clientID, pieceNums[i], supernodeReason))
+			}
 		} else {
 			// get peerIDs by pieceNum
-			peerIDs, err := sm.progressMgr.GetPeerIDsByPieceNum(ctx, taskID, pieceNums[i])
+			candidates, err := sm.progressMgr.GetPeerIDsByPieceNum(ctx, taskID, pieceNums[i])
 			if err != nil {
 				return nil, errors.Wrapf(errortypes.ErrUnknowError, "failed to get peerIDs for pieceNum: %d of taskID: %s", pieceNums[i], taskID)
 			}
-			dstPID = sm.tryGetPID(ctx, taskID, pieceNums[i], peerIDs)
+			peerIDs := excludePeer(candidates, stalled[pieceNums[i]])
+			deferred := sm.deferForFairness(ctx, taskID, clientID, peerID, peerIDs)
+			if deferred {
+				peerIDs = nil
+			}
+			sources := sm.selectSources(ctx, taskID, peerID, pieceNums[i], peerIDs)
+			var decision *types.SchedulerDecision
+			if sm.decisions.enabled() {
+				decision = sm.explainSources(ctx, taskID, clientID, peerID, pieceNums[i], candidates, stalled[pieceNums[i]], deferred, sources)
+			}
+			seeded := sm.seedFromSupernode(len(sources)) && sm.seeds.acquire(clientID, pieceNums[i])
+			if seeded {
+				dstPID = sm.cfg.GetSuperPID()
+			} else {
+				dstPID = sm.pickSource(ctx, sources)
+			}
+			settleDecision(decision, dstPID, seeded)
+			sm.decisions.add(decision)
 		}
 
 		if dstPID == "" {
@@ -173,9 +288,14 @@ func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, peerID
 
 		if err := sm.progressMgr.UpdateClientProgress(ctx, taskID, clientID, dstPID, pieceNums[i], config.PieceRUNNING); err != nil {
 			logrus.Warnf("failed to update client progress running for pieceNum(%d) taskID(%s) clientID(%s) dstPID(%s)", pieceNums[i], taskID, clientID, dstPID)
+			sm.seeds.release(clientID, pieceNums[i])
 			continue
 		}
 
+		if !sm.cfg.IsSuperPID(dstPID) {
+			sm.fairness.assign(taskID, clientID)
+		}
+
 		pieceResults = append(pieceResults, &mgr.PieceResult{
 			TaskID:   taskID,
 			PieceNum: pieceNums[i],
@@ -183,7 +303,7 @@ func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, peerID
 		})
 
 		runningCount++
-		if runningCount >= config.PeerDownLimit {
+		if runningCount >= downLimit {
 			break
 		}
 	}
@@ -191,67 +311,196 @@ func (sm *Manager) getPieceResults(ctx context.Context, taskID, clientID, peerID
 	return pieceResults, nil
 }
 
-// tryGetPID returns an available dstPID from ps.pieceContainer.
-func (sm *Manager) tryGetPID(ctx context.Context, taskID string, pieceNum int, peerIDs []string) (dstPID string) {
+// tryGetPID returns an available dstPID selected by the strategy from the peerIDs.
+func (sm *Manager) tryGetPID(ctx context.Context, taskID, srcPID string, pieceNum int, peerIDs []string) string {
+	return sm.pickSource(ctx, sm.selectSources(ctx, taskID, srcPID, pieceNum, peerIDs))
+}
+
+// selectSources returns the sources of the piece selected by the strategy from the peerIDs
+// other than srcPID itself, which are in the order to be tried.
+func (sm *Manager) selectSources(ctx context.Context, taskID, srcPID string, pieceNum int, peerIDs []string) []string {
+	sources := sm.strategy.SelectSources(ctx, taskID, srcPID, pieceNum, sm.excludeSelf(ctx, srcPID, peerIDs))
+	if unranked, ok := sm.strategy.(UnrankedStrategy); ok && unranked.Unranked() {
+		sm.tiebreaker.order(sources)
+	}
+	return sources
+}
+
+// pickSource returns the first of the sources whose load is under its upload limit,
+// or supernode if there is none.
+func (sm *Manager) pickSource(ctx context.Context, sources []string) (dstPID string) {
 	defer func() {
 		if dstPID == "" {
 			dstPID = sm.cfg.GetSuperPID()
 		}
 	}()
 
-	for i := 0; i < len(peerIDs); i++ {
-		// if failed to get peerState, and then it should not be needed.
-		peerState, err := sm.progressMgr.GetPeerStateByPeerID(ctx, peerIDs[i])
+	for _, peerID := range sources {
+		peerState, err := sm.progressMgr.GetPeerStateByPeerID(ctx, peerID)
 		if err != nil {
-			sm.deletePeerIDByPieceNum(ctx, taskID, pieceNum, peerIDs[i])
 			continue
 		}
 
-		// if the service has been down, and then it should not be needed.
-		if peerState.ServiceDownTime != nil && *(peerState.ServiceDownTime) > 0 {
-			sm.deletePeerIDByPieceNum(ctx, taskID, pieceNum, peerIDs[i])
-			continue
+		if peerState.ProducerLoad != nil {
+			if peerState.ProducerLoad.Add(1) <= sm.getUpLimit(peerState) {
+				sm.tiebreaker.assign(peerID)
+				return peerID
+			}
+			peerState.ProducerLoad.Add(-1)
 		}
+	}
+	return
+}
 
-		// if service has failed for EliminationLimit times, and then it should not be needed.
-		if peerState.ServiceErrorCount != nil && peerState.ServiceErrorCount.Get() >= config.EliminationLimit {
-			sm.deletePeerIDByPieceNum(ctx, taskID, pieceNum, peerIDs[i])
+// excludeSelf filters out the peers which are the requesting peer itself,
+// that is the peers with the same peerID or the same IP as srcPID.
+func (sm *Manager) excludeSelf(ctx context.Context, srcPID string, peerIDs []string) []string {
+	srcIP := sm.getPeerIP(ctx, srcPID)
+	result := make([]string, 0, len(peerIDs))
+	for _, peerID := range peerIDs {
+		if peerID == srcPID {
 			continue
 		}
-
-		// if the v is in the blackList, try the next one.
-		blackInfo, err := sm.progressMgr.GetBlackInfoByPeerID(ctx, peerIDs[i])
-		if err != nil && !errortypes.IsDataNotFound(err) {
-			logrus.Errorf("failed to get blackInfo for peerID %s: %v", peerIDs[i], err)
+		if srcIP != "" && sm.getPeerIP(ctx, peerID) == srcIP {
 			continue
 		}
-		if blackInfo != nil && isExistInMap(blackInfo, peerIDs[i]) {
-			continue
+		result = append(result, peerID)
+	}
+	return result
+}
+
+// excludePeer filters out the peerID from the peerIDs.
+func excludePeer(peerIDs []string, peerID string) []string {
+	if peerID == "" {
+		return peerIDs
+	}
+	result := make([]string, 0, len(peerIDs))
+	for _, v := range peerIDs {
+		if v != peerID {
+			result = append(result, v)
 		}
+	}
+	return result
+}
 
-		if peerState.ProducerLoad != nil {
-			if peerState.ProducerLoad.Add(1) <= config.PeerUpLimit {
-				return peerIDs[i]
-			}
-			peerState.ProducerLoad.Add(-1)
+// prioritizeStalled moves the stalled pieces to the front of the pieceNums,
+// so that they are reassigned before the other pieces.
+func prioritizeStalled(pieceNums []int, stalled map[int]string) []int {
+	if len(stalled) == 0 {
+		return pieceNums
+	}
+	result := make([]int, 0, len(pieceNums))
+	for _, pieceNum := range pieceNums {
+		if _, ok := stalled[pieceNum]; ok {
+			result = append(result, pieceNum)
 		}
 	}
-	return
+	for _, pieceNum := range pieceNums {
+		if _, ok := stalled[pieceNum]; !ok {
+			result = append(result, pieceNum)
+		}
+	}
+	return result
 }
 
-func (sm *Manager) deletePeerIDByPieceNum(ctx context.Context, taskID string, pieceNum int, peerID string) {
-	if err := sm.progressMgr.DeletePeerIDByPieceNum(ctx, taskID, pieceNum, peerID); err != nil {
-		logrus.Warnf("failed to delete the peerID %s for pieceNum %d of taskID: %s", peerID, pieceNum, taskID)
+// getPeerIP returns the IP of the peer, or an empty string if it's unknown.
+func (sm *Manager) getPeerIP(ctx context.Context, peerID string) string {
+	if sm.peerMgr == nil {
+		return ""
+	}
+	peerInfo, err := sm.peerMgr.Get(ctx, peerID)
+	if err != nil || peerInfo == nil {
+		return ""
 	}
+	return peerInfo.IP.String()
 }
 
-// isExistInMap returns whether the key exists in the mmap
-func isExistInMap(mmap *syncmap.SyncMap, key string) bool {
-	if mmap == nil {
+// getDownLimit returns the download limit of the peer, which is scaled down with the
+// FairnessFactor by the ratio of the bytes it served to the bytes it consumed.
+// The peer which serves no less than it consumes always gets the full PeerDownLimit.
+func (sm *Manager) getDownLimit(peerState *mgr.PeerState) int {
+	factor := sm.cfg.FairnessFactor
+	if factor <= 0 || peerState == nil || peerState.ServedBytes == nil || peerState.ConsumedBytes == nil {
+		return config.PeerDownLimit
+	}
+	if factor > 1 {
+		factor = 1
+	}
+
+	consumed := atomic.LoadInt64(peerState.ConsumedBytes)
+	if consumed <= 0 {
+		return config.PeerDownLimit
+	}
+	ratio := float64(atomic.LoadInt64(peerState.ServedBytes)) / float64(consumed)
+	if ratio >= 1 {
+		return config.PeerDownLimit
+	}
+
+	limit := int(math.Ceil(float64(config.PeerDownLimit) * (1 - factor + factor*ratio)))
+	if limit < 1 {
+		return 1
+	}
+	return limit
+}
+
+// getBudgetLimit returns the download limit of the peers of the task according to the
+// bytes served for the task and its TaskBandwidthBudget. The peers are throttled to one
+// piece at a time when the served bytes reach budgetThrottleRatio of the budget,
+// and an ErrTaskBudgetExceeded is returned once the budget is exhausted.
+func (sm *Manager) getBudgetLimit(ctx context.Context, taskID string) (int, error) {
+	budget := sm.cfg.TaskBandwidthBudget
+	if budget <= 0 {
+		return config.PeerDownLimit, nil
+	}
+
+	served, err := sm.progressMgr.GetTaskServedBytes(ctx, taskID)
+	if err != nil {
+		return 0, err
+	}
+	if served >= budget {
+		return 0, errors.Wrapf(errortypes.ErrTaskBudgetExceeded, "taskID: %s served %d bytes of the budget %d", taskID, served, budget)
+	}
+	if float64(served) >= float64(budget)*budgetThrottleRatio {
+		return 1, nil
+	}
+	return config.PeerDownLimit, nil
+}
+
+// seedFromSupernode returns whether to download the piece from supernode even if
+// there are peers holding it, which accelerates the initial spread of the piece.
+//
+// The piece held by fewer available sources than CDNSeedMinPeers is scheduled to supernode
+// with the probability (CDNSeedMinPeers-peerCount)/CDNSeedMinPeers, which drops to zero
+// as the piece is replicated to enough peers. The peerCount should only count the sources
+// selected for the requesting peer, which excludes the peer itself and the unavailable ones.
+func (sm *Manager) seedFromSupernode(peerCount int) bool {
+	minPeers := sm.cfg.CDNSeedMinPeers
+	if minPeers <= 0 || peerCount <= 0 || peerCount >= minPeers {
 		return false
 	}
-	_, err := mmap.Get(key)
-	return err == nil
+	return sm.rand.Intn(minPeers) < minPeers-peerCount
+}
+
+// getUpLimit returns the upload limit of the peer with slow start,
+// which ramps up from SlowStartInitialLimit to PeerUpLimit linearly
+// as the count of successful services reaches SlowStartWarmupPieces.
+func (sm *Manager) getUpLimit(peerState *mgr.PeerState) int32 {
+	return getUpLimit(sm.cfg, peerState)
+}
+
+func getUpLimit(cfg *config.Config, peerState *mgr.PeerState) int32 {
+	initialLimit := cfg.SlowStartInitialLimit
+	warmupPieces := cfg.SlowStartWarmupPieces
+	if initialLimit <= 0 || initialLimit >= config.PeerUpLimit || warmupPieces <= 0 ||
+		peerState.ServiceSuccessCount == nil {
+		return config.PeerUpLimit
+	}
+
+	successCount := int(peerState.ServiceSuccessCount.Get())
+	if successCount >= warmupPieces {
+		return config.PeerUpLimit
+	}
+	return int32(initialLimit + (config.PeerUpLimit-initialLimit)*successCount/warmupPieces)
 }
 
 // get the center value of the piece num being downloaded
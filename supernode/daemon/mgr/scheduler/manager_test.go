@@ -19,15 +19,23 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/syncmap"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/progress"
 
 	"github.com/go-check/check"
 	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func Test(t *testing.T) {
@@ -52,7 +60,7 @@ func (s *SchedulerMgrTestSuite) SetUpSuite(c *check.C) {
 
 	cfg := config.NewConfig()
 	cfg.SetSuperPID("fooPid")
-	s.manager, _ = NewManager(cfg, s.mockProgressMgr)
+	s.manager, _ = NewManager(cfg, s.mockProgressMgr, nil)
 }
 
 func (s *SchedulerMgrTestSuite) TearDownSuite(c *check.C) {
@@ -132,6 +140,435 @@ func (s *SchedulerMgrTestSuite) TestIsExistInMap(c *check.C) {
 	c.Check(isExistInMap(mmap, "d"), check.Equals, false)
 }
 
+func (s *SchedulerMgrTestSuite) TestGetUpLimit(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SlowStartInitialLimit = 1
+	cfg.SlowStartWarmupPieces = 8
+	manager, _ := NewManager(cfg, s.mockProgressMgr, nil)
+
+	var cases = []struct {
+		successCount int32
+		expected     int32
+	}{
+		{successCount: 0, expected: 1},
+		{successCount: 1, expected: 1},
+		{successCount: 2, expected: 2},
+		{successCount: 4, expected: 3},
+		{successCount: 7, expected: 4},
+		{successCount: 8, expected: config.PeerUpLimit},
+		{successCount: 100, expected: config.PeerUpLimit},
+	}
+
+	for _, v := range cases {
+		peerState := &mgr.PeerState{ServiceSuccessCount: atomiccount.NewAtomicInt(v.successCount)}
+		c.Check(manager.getUpLimit(peerState), check.Equals, v.expected)
+	}
+
+	// the slow start is disabled
+	cfg.SlowStartInitialLimit = 0
+	c.Check(manager.getUpLimit(&mgr.PeerState{ServiceSuccessCount: atomiccount.NewAtomicInt(0)}),
+		check.Equals, int32(config.PeerUpLimit))
+}
+
+func (s *SchedulerMgrTestSuite) TestTryGetPIDWithSlowStart(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("fooPid")
+	cfg.SlowStartInitialLimit = 1
+	cfg.SlowStartWarmupPieces = 4
+	manager, _ := NewManager(cfg, s.mockProgressMgr, nil)
+
+	var downTime int64
+	peerState := &mgr.PeerState{
+		PeerID:              "newPeer",
+		ServiceDownTime:     &downTime,
+		ServiceErrorCount:   atomiccount.NewAtomicInt(0),
+		ServiceSuccessCount: atomiccount.NewAtomicInt(0),
+		ProducerLoad:        atomiccount.NewAtomicInt(0),
+	}
+	s.mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), "newPeer").Return(peerState, nil).AnyTimes()
+	s.mockProgressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), "newPeer").Return(nil, nil).AnyTimes()
+
+	// the new peer serves only one piece at a time
+	c.Check(manager.tryGetPID(context.TODO(), "foo", "srcPeer", 0, []string{"newPeer"}), check.Equals, "newPeer")
+	c.Check(manager.tryGetPID(context.TODO(), "foo", "srcPeer", 1, []string{"newPeer"}), check.Equals, "fooPid")
+
+	// and more pieces after serving successfully
+	peerState.ServiceSuccessCount.Set(2)
+	c.Check(manager.tryGetPID(context.TODO(), "foo", "srcPeer", 1, []string{"newPeer"}), check.Equals, "newPeer")
+	c.Check(manager.tryGetPID(context.TODO(), "foo", "srcPeer", 2, []string{"newPeer"}), check.Equals, "newPeer")
+	c.Check(manager.tryGetPID(context.TODO(), "foo", "srcPeer", 3, []string{"newPeer"}), check.Equals, "fooPid")
+	c.Check(peerState.ProducerLoad.Get(), check.Equals, int32(3))
+}
+
+func (s *SchedulerMgrTestSuite) TestTryGetPIDAvoidSelf(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	mockPeerMgr := mock.NewMockPeerMgr(mockCtl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("superPID")
+	manager, _ := NewManager(cfg, mockProgressMgr, mockPeerMgr)
+
+	newPeerState := func(peerID string) *mgr.PeerState {
+		var downTime int64
+		return &mgr.PeerState{
+			PeerID:              peerID,
+			ServiceDownTime:     &downTime,
+			ServiceErrorCount:   atomiccount.NewAtomicInt(0),
+			ServiceSuccessCount: atomiccount.NewAtomicInt(0),
+			ProducerLoad:        atomiccount.NewAtomicInt(0),
+		}
+	}
+	for _, peerID := range []string{"srcPeer", "sameHostPeer", "otherPeer"} {
+		mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), peerID).Return(newPeerState(peerID), nil).AnyTimes()
+		mockProgressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), peerID).Return(nil, nil).AnyTimes()
+	}
+	mockPeerMgr.EXPECT().Get(gomock.Any(), "srcPeer").Return(&types.PeerInfo{ID: "srcPeer", IP: "10.0.0.1"}, nil).AnyTimes()
+	mockPeerMgr.EXPECT().Get(gomock.Any(), "sameHostPeer").Return(&types.PeerInfo{ID: "sameHostPeer", IP: "10.0.0.1"}, nil).AnyTimes()
+	mockPeerMgr.EXPECT().Get(gomock.Any(), "otherPeer").Return(&types.PeerInfo{ID: "otherPeer", IP: "10.0.0.2"}, nil).AnyTimes()
+
+	// the requesting peer itself is the only candidate
+	c.Check(manager.tryGetPID(context.TODO(), "foo", "srcPeer", 0, []string{"srcPeer"}), check.Equals, "superPID")
+	// the candidate on the same host is the requesting peer too
+	c.Check(manager.tryGetPID(context.TODO(), "foo", "srcPeer", 0, []string{"sameHostPeer"}), check.Equals, "superPID")
+	c.Check(manager.tryGetPID(context.TODO(), "foo", "srcPeer", 0, []string{"srcPeer", "sameHostPeer", "otherPeer"}), check.Equals, "otherPeer")
+}
+
+// cycleSource is a rand.Source which makes rand.Intn(n) return 0, 1, ..., n-1
+// in turn for the n of a power of 2.
+type cycleSource struct {
+	n    int64
+	next int64
+}
+
+func (cs *cycleSource) Int63() int64 {
+	v := cs.next % cs.n
+	cs.next++
+	return v << 32
+}
+
+func (cs *cycleSource) Seed(seed int64) {}
+
+func (s *SchedulerMgrTestSuite) TestSeedFromSupernode(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.CDNSeedMinPeers = 4
+	manager, _ := NewManager(cfg, s.mockProgressMgr, nil)
+	manager.rand = rand.New(&cycleSource{n: int64(cfg.CDNSeedMinPeers)})
+
+	// every value of the random decision is drawn once in a cycle
+	countSeeds := func(peerCount int) int {
+		count := 0
+		for i := 0; i < cfg.CDNSeedMinPeers; i++ {
+			if manager.seedFromSupernode(peerCount) {
+				count++
+			}
+		}
+		return count
+	}
+
+	// the usage of supernode drops as the piece is replicated to more peers
+	for peerCount := 1; peerCount < cfg.CDNSeedMinPeers; peerCount++ {
+		c.Check(countSeeds(peerCount), check.Equals, cfg.CDNSeedMinPeers-peerCount)
+	}
+
+	// and the peers are preferred once the piece is sufficiently replicated
+	c.Check(countSeeds(cfg.CDNSeedMinPeers), check.Equals, 0)
+	c.Check(countSeeds(cfg.CDNSeedMinPeers+1), check.Equals, 0)
+
+	// the seeding is disabled
+	cfg.CDNSeedMinPeers = 0
+	c.Check(countSeeds(1), check.Equals, 0)
+}
+
+func (s *SchedulerMgrTestSuite) TestSeedFromSupernodeWithAvailableSources(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	cfg.CDNSeedMinPeers = 2
+	cfg.CDNSeedMaxLoad = 1
+	progressMgr, err := progress.NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	manager, _ := NewManager(cfg, progressMgr, nil)
+	// the random decision always seeds the piece held by one available source
+	manager.rand = rand.New(&cycleSource{n: 1})
+	ctx := context.Background()
+
+	// the piece is held by peerA and peerD, but peerD is down
+	for _, peerID := range []string{"peerA", "peerB", "peerC", "peerD"} {
+		c.Assert(progressMgr.InitProgress(ctx, "taskID", peerID, peerID+"CID"), check.IsNil)
+	}
+	for _, peerID := range []string{"peerA", "peerD"} {
+		c.Assert(progressMgr.UpdateProgress(ctx, "taskID", peerID+"CID", peerID, "superPID", 0, config.PieceSUCCESS, 100), check.IsNil)
+	}
+	peerState, err := progressMgr.GetPeerStateByPeerID(ctx, "peerD")
+	c.Assert(err, check.IsNil)
+	*peerState.ServiceDownTime = time.Now().Unix()
+	peerIDs, err := progressMgr.GetPeerIDsByPieceNum(ctx, "taskID", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(peerIDs), check.Equals, 2)
+
+	// the piece is seeded by supernode since peerA is the only available source
+	results, err := manager.getPieceResults(ctx, "taskID", "peerBCID", "peerB", []int{0}, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+	c.Check(results[0].DstPID, check.Equals, "superPID")
+
+	// but not beyond the seeding load of supernode
+	results, err = manager.getPieceResults(ctx, "taskID", "peerCCID", "peerC", []int{0}, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+	c.Check(results[0].DstPID, check.Equals, "peerA")
+
+	// and the load is released once the seeded piece is no longer running
+	manager.seeds.sync("peerBCID", nil)
+	c.Check(manager.seeds.acquire("peerCCID", 0), check.Equals, true)
+}
+
+func (s *SchedulerMgrTestSuite) TestGetDownLimitWithFairness(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.FairnessFactor = 1
+	manager, _ := NewManager(cfg, s.mockProgressMgr, nil)
+
+	newPeerState := func(served, consumed int64) *mgr.PeerState {
+		return &mgr.PeerState{ServedBytes: &served, ConsumedBytes: &consumed}
+	}
+	freeloader := newPeerState(0, 1000)
+	contributor := newPeerState(1500, 1000)
+
+	var cases = []struct {
+		factor    float64
+		peerState *mgr.PeerState
+		expected  int
+	}{
+		{factor: 1, peerState: freeloader, expected: 1},
+		{factor: 1, peerState: contributor, expected: config.PeerDownLimit},
+		{factor: 1, peerState: newPeerState(500, 1000), expected: 2},
+		{factor: 1, peerState: newPeerState(0, 0), expected: config.PeerDownLimit},
+		{factor: 0.5, peerState: freeloader, expected: 2},
+		{factor: 0.5, peerState: contributor, expected: config.PeerDownLimit},
+		{factor: 0, peerState: freeloader, expected: config.PeerDownLimit},
+		{factor: 1, peerState: &mgr.PeerState{}, expected: config.PeerDownLimit},
+	}
+
+	for _, v := range cases {
+		cfg.FairnessFactor = v.factor
+		c.Check(manager.getDownLimit(v.peerState), check.Equals, v.expected)
+	}
+}
+
+func (s *SchedulerMgrTestSuite) TestScheduleWithBandwidthBudget(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("superPID")
+	cfg.TaskBandwidthBudget = 1000
+	manager, _ := NewManager(cfg, mockProgressMgr, nil)
+
+	var downTime int64
+	peerState := &mgr.PeerState{
+		PeerID:              "peer",
+		ClientErrorCount:    atomiccount.NewAtomicInt(0),
+		ServiceDownTime:     &downTime,
+		ServiceErrorCount:   atomiccount.NewAtomicInt(0),
+		ServiceSuccessCount: atomiccount.NewAtomicInt(0),
+		ProducerLoad:        atomiccount.NewAtomicInt(0),
+	}
+	mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), "peer").Return(peerState, nil).AnyTimes()
+	mockProgressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), "taskID", gomock.Any()).Return(nil, nil).AnyTimes()
+	mockProgressMgr.EXPECT().UpdateClientProgress(gomock.Any(), "taskID", "client", "superPID", gomock.Any(), config.PieceRUNNING).
+		Return(nil).AnyTimes()
+	servedBytes := int64(0)
+	mockProgressMgr.EXPECT().GetTaskServedBytes(gomock.Any(), "taskID").DoAndReturn(
+		func(ctx context.Context, taskID string) (int64, error) {
+			return servedBytes, nil
+		}).AnyTimes()
+
+	pieceNums := []int{0, 1, 2, 3, 4, 5, 6}
+
+	// the pieces are assigned up to the download limit far from the budget
+	results, err := manager.getPieceResults(context.TODO(), "taskID", "client", "peer", pieceNums, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(len(results), check.Equals, config.PeerDownLimit)
+
+	// and one piece at a time near the budget
+	servedBytes = 900
+	results, err = manager.getPieceResults(context.TODO(), "taskID", "client", "peer", pieceNums, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(len(results), check.Equals, 1)
+	_, err = manager.getPieceResults(context.TODO(), "taskID", "client", "peer", pieceNums, 1, nil)
+	c.Check(errortypes.IsPeerContinue(err), check.Equals, true)
+
+	// and none once the budget is exhausted
+	servedBytes = 1000
+	_, err = manager.getPieceResults(context.TODO(), "taskID", "client", "peer", pieceNums, 0, nil)
+	c.Check(errortypes.IsTaskBudgetExceeded(err), check.Equals, true)
+}
+
+func (s *SchedulerMgrTestSuite) TestReassignStalledPiece(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	cfg.CDNSeedMinPeers = 0
+	cfg.PieceDownloadTimeout = 50 * time.Millisecond
+	progressMgr, err := progress.NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	manager, _ := NewManager(cfg, progressMgr, nil)
+	ctx := context.Background()
+
+	// the piece is downloaded by supernode and the slow peer
+	superCID := cfg.GetSuperCID("taskID")
+	c.Assert(progressMgr.InitProgress(ctx, "taskID", "superPID", superCID), check.IsNil)
+	c.Assert(progressMgr.UpdateProgress(ctx, "taskID", superCID, "superPID", "", 0, config.PieceSUCCESS, 0), check.IsNil)
+	for _, peerID := range []string{"slow", "fast", "peer"} {
+		c.Assert(progressMgr.InitProgress(ctx, "taskID", peerID, peerID+"CID"), check.IsNil)
+	}
+	c.Assert(progressMgr.UpdateProgress(ctx, "taskID", "slowCID", "slow", "superPID", 0, config.PieceSUCCESS, 100), check.IsNil)
+
+	// and assigned to the client from the slow peer which never completes it
+	results, err := manager.Schedule(ctx, "taskID", "peerCID", "peer", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+	c.Check(results[0].DstPID, check.Equals, "slow")
+	slowState, err := progressMgr.GetPeerStateByPeerID(ctx, "slow")
+	c.Assert(err, check.IsNil)
+	c.Check(slowState.ProducerLoad.Get(), check.Equals, int32(1))
+
+	// the piece keeps running before the timeout
+	c.Assert(progressMgr.UpdateProgress(ctx, "taskID", "fastCID", "fast", "superPID", 0, config.PieceSUCCESS, 100), check.IsNil)
+	_, err = manager.Schedule(ctx, "taskID", "peerCID", "peer", "")
+	c.Check(errortypes.IsPeerWait(err), check.Equals, true)
+
+	// and it's reassigned from the alternate source after the timeout,
+	// and the slow peer is penalized with its load released
+	time.Sleep(cfg.PieceDownloadTimeout)
+	results, err = manager.Schedule(ctx, "taskID", "peerCID", "peer", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+	c.Check(results[0].PieceNum, check.Equals, 0)
+	c.Check(results[0].DstPID, check.Equals, "fast")
+	c.Check(slowState.ProducerLoad.Get(), check.Equals, int32(0))
+	c.Check(slowState.ServiceErrorCount.Get(), check.Equals, int32(1))
+
+	// the late report of the cancelled assignment is ignored
+	c.Assert(progressMgr.UpdateProgress(ctx, "taskID", "peerCID", "peer", "slow", 0, config.PieceFAILED, 0), check.IsNil)
+	running, err := progressMgr.GetPieceProgressByCID(ctx, "taskID", "peerCID", "running")
+	c.Assert(err, check.IsNil)
+	c.Check(running, check.DeepEquals, []int{0})
+	c.Check(slowState.ProducerLoad.Get(), check.Equals, int32(0))
+	c.Check(slowState.ServiceErrorCount.Get(), check.Equals, int32(1))
+}
+
+func (s *SchedulerMgrTestSuite) TestScheduleInSafeMode(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	cfg.CDNSeedMinPeers = 0
+	progressMgr, err := progress.NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	manager, _ := NewManager(cfg, progressMgr, nil)
+	ctx := context.Background()
+
+	// the pieces are downloaded by supernode and the source peer
+	superCID := cfg.GetSuperCID("taskID")
+	c.Assert(progressMgr.InitProgress(ctx, "taskID", "superPID", superCID), check.IsNil)
+	for _, peerID := range []string{"source", "peer"} {
+		c.Assert(progressMgr.InitProgress(ctx, "taskID", peerID, peerID+"CID"), check.IsNil)
+	}
+	for pieceNum := 0; pieceNum < 3; pieceNum++ {
+		c.Assert(progressMgr.UpdateProgress(ctx, "taskID", superCID, "superPID", "", pieceNum, config.PieceSUCCESS, 0), check.IsNil)
+		c.Assert(progressMgr.UpdateProgress(ctx, "taskID", "sourceCID", "source", "superPID", pieceNum, config.PieceSUCCESS, 100), check.IsNil)
+	}
+
+	// and the piece 0 is assigned to the client from the source peer
+	results, err := manager.getPieceResults(ctx, "taskID", "peerCID", "peer", []int{0}, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+	c.Check(results[0].DstPID, check.Equals, "source")
+	sourceState, err := progressMgr.GetPeerStateByPeerID(ctx, "source")
+	c.Assert(err, check.IsNil)
+	c.Check(sourceState.ProducerLoad.Get(), check.Equals, int32(1))
+
+	// no peer source is returned in the safe mode,
+	// and the peer transfer is allowed to finish by default
+	manager.SetSafeMode(ctx, true, false)
+	results, err = manager.Schedule(ctx, "taskID", "peerCID", "peer", types.DfGetTaskPieceOrderSequential)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 2)
+	for _, result := range results {
+		c.Check(result.PieceNum, check.Not(check.Equals), 0)
+		c.Check(result.DstPID, check.Equals, "superPID")
+	}
+	c.Check(sourceState.ProducerLoad.Get(), check.Equals, int32(1))
+
+	// and it's cut and reassigned from supernode without penalizing the source peer
+	manager.SetSafeMode(ctx, true, true)
+	enabled, cutPeerTransfers := manager.GetSafeMode(ctx)
+	c.Check(enabled, check.Equals, true)
+	c.Check(cutPeerTransfers, check.Equals, true)
+	results, err = manager.Schedule(ctx, "taskID", "peerCID", "peer", types.DfGetTaskPieceOrderSequential)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+	c.Check(results[0].PieceNum, check.Equals, 0)
+	c.Check(results[0].DstPID, check.Equals, "superPID")
+	c.Check(sourceState.ProducerLoad.Get(), check.Equals, int32(0))
+	c.Check(sourceState.ServiceErrorCount.Get(), check.Equals, int32(0))
+
+	// the peer sources are returned again once the safe mode is disabled
+	manager.SetSafeMode(ctx, false, false)
+	c.Assert(progressMgr.InitProgress(ctx, "taskID", "another", "anotherCID"), check.IsNil)
+	results, err = manager.getPieceResults(ctx, "taskID", "anotherCID", "another", []int{0}, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(results), check.Equals, 1)
+	c.Check(results[0].DstPID, check.Not(check.Equals), "superPID")
+}
+
+func (s *SchedulerMgrTestSuite) TestSortWithPieceOrder(c *check.C) {
+	cfg := config.NewConfig()
+	progressMgr, err := progress.NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	manager, _ := NewManager(cfg, progressMgr, nil)
+	ctx := context.Background()
+
+	// the pieces 4 and 5 are held by one peer while the others are held by two
+	for _, peerID := range []string{"peerA", "peerB"} {
+		c.Assert(progressMgr.InitProgress(ctx, "taskID", peerID, peerID+"CID"), check.IsNil)
+	}
+	for pieceNum := 0; pieceNum < 6; pieceNum++ {
+		c.Assert(progressMgr.UpdateProgress(ctx, "taskID", "peerACID", "peerA", "", pieceNum, config.PieceSUCCESS, 0), check.IsNil)
+		if pieceNum < 4 {
+			c.Assert(progressMgr.UpdateProgress(ctx, "taskID", "peerBCID", "peerB", "", pieceNum, config.PieceSUCCESS, 0), check.IsNil)
+		}
+	}
+	available := func() []int { return []int{3, 5, 1, 4, 0, 2} }
+
+	pieceNums, err := manager.sort(ctx, available(), nil, "taskID", types.DfGetTaskPieceOrderSequential)
+	c.Assert(err, check.IsNil)
+	c.Check(pieceNums, check.DeepEquals, []int{0, 1, 2, 3, 4, 5})
+
+	for _, pieceOrder := range []string{"", types.DfGetTaskPieceOrderRarestFirst} {
+		pieceNums, err = manager.sort(ctx, available(), nil, "taskID", pieceOrder)
+		c.Assert(err, check.IsNil)
+		rarest := pieceNums[:2]
+		if rarest[0] > rarest[1] {
+			rarest[0], rarest[1] = rarest[1], rarest[0]
+		}
+		c.Check(rarest, check.DeepEquals, []int{4, 5})
+	}
+
+	// the random order is a permutation of the pieces which differs from run to run
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		pieceNums, err = manager.sort(ctx, available(), nil, "taskID", types.DfGetTaskPieceOrderRandom)
+		c.Assert(err, check.IsNil)
+		c.Assert(len(pieceNums), check.Equals, 6)
+		seen[fmt.Sprint(pieceNums)] = true
+	}
+	c.Check(len(seen) > 1, check.Equals, true)
+}
+
 func (s *SchedulerMgrTestSuite) BenchmarkGetPieceCountMap(c *check.C) {
 	pieceNums := make([]int, 1000)
 	for i := 0; i < 1000; i++ {
@@ -143,3 +580,64 @@ func (s *SchedulerMgrTestSuite) BenchmarkGetPieceCountMap(c *check.C) {
 		s.manager.getPieceCountMap(context.TODO(), pieceNums, "foo")
 	}
 }
+
+func (s *SchedulerMgrTestSuite) TestWarmHandoff(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("superPID")
+	cfg.WarmHandoffClients = 2
+	manager, _ := NewManager(cfg, mockProgressMgr, nil)
+
+	// the CDN has finished with 6 pieces and peer1 of client1 holds piece 0
+	mockProgressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), "taskID", "client1", "available").
+		Return([]int{1, 2, 3, 4, 5}, nil)
+	mockProgressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), "taskID", "client2", "available").
+		Return([]int{0, 1, 2, 3, 4, 5}, nil)
+	mockProgressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), "taskID", "client3", "available").
+		Return([]int{0, 1, 2}, nil)
+	mockProgressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), "taskID", 0).Return([]string{"superPID", "peer1"}, nil)
+	mockProgressMgr.EXPECT().GetPeerIDsByPieceNum(gomock.Any(), "taskID", gomock.Any()).Return([]string{"superPID"}, nil).AnyTimes()
+
+	c.Assert(manager.WarmHandoff(context.Background(), "taskID", []string{"client1", "client2", "client3"}), check.IsNil)
+
+	// the pieces held by no peer are spread among two of the clients without overlap
+	assigned := make(map[int]string)
+	for _, clientID := range manager.handoffs.ListKeyAsStringSlice() {
+		v, err := manager.handoffs.Get(clientID)
+		c.Assert(err, check.IsNil)
+		h := v.(*handoff)
+		c.Check(h.taskID, check.Equals, "taskID")
+		c.Check(len(h.pieces) >= 2, check.Equals, true)
+		for pieceNum := range h.pieces {
+			_, ok := assigned[pieceNum]
+			c.Check(ok, check.Equals, false)
+			assigned[pieceNum] = clientID
+		}
+	}
+	c.Check(len(manager.handoffs.ListKeyAsStringSlice()), check.Equals, 2)
+	c.Check(len(assigned), check.Equals, 5)
+	for pieceNum := 1; pieceNum <= 5; pieceNum++ {
+		c.Check(assigned[pieceNum], check.Not(check.Equals), "")
+	}
+
+	// the assigned pieces are scheduled before the others
+	clientID := assigned[1]
+	pieceNums := manager.prioritizeHandoff("taskID", clientID, []int{0, 1, 2, 3, 4, 5})
+	for i := 0; i < len(pieceNums); i++ {
+		inHandoff := assigned[pieceNums[i]] == clientID
+		if !inHandoff {
+			for _, pieceNum := range pieceNums[i:] {
+				c.Check(assigned[pieceNum], check.Not(check.Equals), clientID)
+			}
+			break
+		}
+	}
+
+	// the handoff is forgotten once none of its pieces is available
+	c.Check(manager.prioritizeHandoff("taskID", clientID, []int{0}), check.DeepEquals, []int{0})
+	_, err := manager.handoffs.Get(clientID)
+	c.Check(err, check.NotNil)
+}
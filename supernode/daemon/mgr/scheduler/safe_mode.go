@@ -0,0 +1,83 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// safeMode is the switch to disable the P2P transfers for the incident response,
+// and all the pieces are scheduled from supernode while it's enabled.
+type safeMode struct {
+	mu      sync.RWMutex
+	enabled bool
+	// cutPeerTransfers indicates whether the pieces being downloaded from the peers
+	// are cancelled, otherwise they are allowed to finish.
+	cutPeerTransfers bool
+}
+
+func newSafeMode(enabled, cutPeerTransfers bool) *safeMode {
+	return &safeMode{
+		enabled:          enabled,
+		cutPeerTransfers: cutPeerTransfers,
+	}
+}
+
+func (m *safeMode) get() (enabled, cutPeerTransfers bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled, m.cutPeerTransfers
+}
+
+func (m *safeMode) set(enabled, cutPeerTransfers bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = enabled
+	m.cutPeerTransfers = cutPeerTransfers
+}
+
+// SetSafeMode enables or disables the safe mode, which applies to the following schedules.
+func (sm *Manager) SetSafeMode(ctx context.Context, enabled, cutPeerTransfers bool) {
+	if oldEnabled, oldCut := sm.safeMode.get(); oldEnabled == enabled && oldCut == cutPeerTransfers {
+		return
+	}
+	sm.safeMode.set(enabled, cutPeerTransfers)
+	logrus.Infof("success to set the safe mode of the scheduler to %t with cutPeerTransfers %t", enabled, cutPeerTransfers)
+}
+
+// GetSafeMode gets whether the safe mode is enabled and whether it cuts the peer transfers.
+func (sm *Manager) GetSafeMode(ctx context.Context) (enabled, cutPeerTransfers bool) {
+	return sm.safeMode.get()
+}
+
+// mergeCancelled adds the pieces cancelled for the safe mode to the stalled ones,
+// so that they are reassigned before the other pieces as well.
+func mergeCancelled(stalled, cancelled map[int]string) map[int]string {
+	if len(cancelled) == 0 {
+		return stalled
+	}
+	if stalled == nil {
+		stalled = make(map[int]string, len(cancelled))
+	}
+	for pieceNum, dstPID := range cancelled {
+		stalled[pieceNum] = dstPID
+	}
+	return stalled
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+)
+
+func init() {
+	check.Suite(&SeedTestSuite{})
+}
+
+type SeedTestSuite struct{}
+
+// assignSequence returns the peers assigned the pieces in turn by the scheduler
+// configured by setup, and the loads of the peers are 0, 1, 2 and 3 initially.
+func assignSequence(c *check.C, setup func(cfg *config.Config), rounds int) []string {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("superPID")
+	cfg.SlowStartInitialLimit = 0
+	setup(cfg)
+	manager, err := NewManager(cfg, mockProgressMgr, nil)
+	c.Assert(err, check.IsNil)
+
+	var downTime int64
+	peerIDs := []string{"peer1", "peer2", "peer3", "peer4"}
+	states := make(map[string]*mgr.PeerState)
+	for i, peerID := range peerIDs {
+		states[peerID] = &mgr.PeerState{
+			PeerID:              peerID,
+			ServiceDownTime:     &downTime,
+			ServiceSuccessCount: atomiccount.NewAtomicInt(0),
+			ProducerLoad:        atomiccount.NewAtomicInt(int32(i)),
+		}
+		mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), peerID).Return(states[peerID], nil).AnyTimes()
+		mockProgressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), peerID).Return(nil, errortypes.ErrDataNotFound).AnyTimes()
+	}
+
+	var sequence []string
+	for i := 0; i < rounds; i++ {
+		peerID := manager.tryGetPID(context.TODO(), "task", "srcPeer", i, append([]string(nil), peerIDs...))
+		sequence = append(sequence, peerID)
+		// the piece is finished immediately
+		states[peerID].ProducerLoad.Add(-1)
+	}
+	return sequence
+}
+
+func (s *SeedTestSuite) TestReproduceAssignments(c *check.C) {
+	var cases = []struct {
+		name     string
+		setup    func(cfg *config.Config)
+		expected []string
+	}{
+		{
+			name: "weighted-random strategy",
+			setup: func(cfg *config.Config) {
+				cfg.SchedulerStrategy = WeightedRandomStrategy
+			},
+			expected: []string{"peer2", "peer1", "peer1", "peer2", "peer1", "peer1", "peer2", "peer2", "peer3", "peer3"},
+		},
+		{
+			name: "random tiebreaker",
+			setup: func(cfg *config.Config) {
+				cfg.SchedulerTiebreaker = TiebreakerRandom
+			},
+			expected: []string{"peer3", "peer2", "peer3", "peer2", "peer3", "peer1", "peer2", "peer4", "peer4", "peer3"},
+		},
+	}
+
+	for _, v := range cases {
+		seeded := func(seed int64) func(cfg *config.Config) {
+			return func(cfg *config.Config) {
+				v.setup(cfg)
+				cfg.SchedulerSeed = seed
+			}
+		}
+		sequence := assignSequence(c, seeded(42), 10)
+		c.Check(sequence, check.DeepEquals, v.expected, check.Commentf("%s", v.name))
+		c.Check(assignSequence(c, seeded(42), 10), check.DeepEquals, sequence, check.Commentf("%s", v.name))
+		c.Check(assignSequence(c, seeded(7), 10), check.Not(check.DeepEquals), sequence, check.Commentf("%s", v.name))
+	}
+}
+
+func (s *SeedTestSuite) TestReproducePieceOrder(c *check.C) {
+	order := func(seed int64) []int {
+		cfg := config.NewConfig()
+		cfg.SchedulerSeed = seed
+		manager, err := NewManager(cfg, nil, nil)
+		c.Assert(err, check.IsNil)
+		pieceNums, err := manager.sort(context.TODO(), []int{0, 1, 2, 3, 4, 5, 6, 7}, nil, "task", types.DfGetTaskPieceOrderRandom)
+		c.Assert(err, check.IsNil)
+		return pieceNums
+	}
+
+	c.Check(order(42), check.DeepEquals, []int{5, 7, 4, 6, 1, 3, 0, 2})
+	c.Check(order(42), check.DeepEquals, order(42))
+}
+
+func (s *SeedTestSuite) TestLockedRand(c *check.C) {
+	shared := newLockedRand(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				shared.Intn(100)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the same seed makes the same sequence
+	a, b := newLockedRand(1), newLockedRand(1)
+	for i := 0; i < 100; i++ {
+		c.Assert(a.Int63(), check.Equals, b.Int63())
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultStrategy is the name of the strategy used when no strategy is specified.
+const DefaultStrategy = "default"
+
+// Strategy decides which peers a piece should be downloaded from.
+type Strategy interface {
+	// SelectSources selects the sources of the piece pieceNum of taskID for the peer srcPID
+	// from the candidates which have the piece, ordered by preference.
+	// The scheduler assigns the piece to the first source whose load is under the limit,
+	// and to the supernode if none of them is available.
+	SelectSources(ctx context.Context, taskID, srcPID string, pieceNum int, candidates []string) []string
+}
+
+// UnrankedStrategy is implemented by the strategy which selects the sources
+// without ranking them, and the scheduler orders the sources with the tiebreaker
+// specified by cfg.SchedulerTiebreaker to spread the load among them.
+type UnrankedStrategy interface {
+	Strategy
+
+	// Unranked returns whether the selected sources are equally good.
+	Unranked() bool
+}
+
+// StrategyBuilder is a function that creates a new strategy with the giving config.
+type StrategyBuilder func(cfg *config.Config, progressMgr mgr.ProgressMgr) (Strategy, error)
+
+var (
+	strategyBuilders = make(map[string]StrategyBuilder)
+	strategyMutex    sync.RWMutex
+)
+
+// RegisterStrategy registers a strategy builder with specified name,
+// and the strategy can be selected by the name with the config SchedulerStrategy.
+func RegisterStrategy(name string, builder StrategyBuilder) {
+	strategyMutex.Lock()
+	defer strategyMutex.Unlock()
+
+	strategyBuilders[name] = builder
+}
+
+// newStrategy creates the strategy specified by cfg.SchedulerStrategy.
+func newStrategy(cfg *config.Config, progressMgr mgr.ProgressMgr) (Strategy, error) {
+	name := getStrategyName(cfg)
+
+	strategyMutex.RLock()
+	builder, ok := strategyBuilders[name]
+	strategyMutex.RUnlock()
+	if !ok {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "unknown scheduler strategy: %s", name)
+	}
+	return builder(cfg, progressMgr)
+}
+
+func getStrategyName(cfg *config.Config) string {
+	if cfg == nil || cfg.BaseProperties == nil || cfg.SchedulerStrategy == "" {
+		return DefaultStrategy
+	}
+	return cfg.SchedulerStrategy
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"math"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+)
+
+func init() {
+	check.Suite(&StrategyTestSuite{})
+}
+
+type StrategyTestSuite struct{}
+
+// reverseStrategy prefers the candidates in the reverse order.
+type reverseStrategy struct {
+	calls int
+}
+
+func (rs *reverseStrategy) SelectSources(ctx context.Context, taskID, srcPID string, pieceNum int, candidates []string) []string {
+	rs.calls++
+	sources := make([]string, 0, len(candidates))
+	for i := len(candidates) - 1; i >= 0; i-- {
+		sources = append(sources, candidates[i])
+	}
+	return sources
+}
+
+func (s *StrategyTestSuite) TestCustomStrategy(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+
+	strategy := &reverseStrategy{}
+	RegisterStrategy("reverse", func(cfg *config.Config, progressMgr mgr.ProgressMgr) (Strategy, error) {
+		return strategy, nil
+	})
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("superPID")
+	cfg.SchedulerStrategy = "reverse"
+	manager, err := NewManager(cfg, mockProgressMgr, nil)
+	c.Assert(err, check.IsNil)
+
+	for _, peerID := range []string{"peer1", "peer2"} {
+		mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), peerID).Return(&mgr.PeerState{
+			PeerID:       peerID,
+			ProducerLoad: atomiccount.NewAtomicInt(0),
+		}, nil).AnyTimes()
+	}
+
+	c.Check(manager.tryGetPID(context.TODO(), "task", "srcPeer", 0, []string{"peer1", "peer2"}), check.Equals, "peer2")
+	c.Check(manager.tryGetPID(context.TODO(), "task", "srcPeer", 0, nil), check.Equals, "superPID")
+	c.Check(strategy.calls, check.Equals, 2)
+}
+
+func (s *StrategyTestSuite) TestUnknownStrategy(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SchedulerStrategy = "foo"
+	_, err := NewManager(cfg, nil, nil)
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *StrategyTestSuite) TestDefaultStrategy(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+
+	manager, err := NewManager(&config.Config{BaseProperties: &config.BaseProperties{}}, mockProgressMgr, nil)
+	c.Assert(err, check.IsNil)
+	_, ok := manager.strategy.(*defaultStrategy)
+	c.Check(ok, check.Equals, true)
+
+	var downTime int64 = 1
+	mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), "down").Return(&mgr.PeerState{
+		ServiceDownTime: &downTime,
+	}, nil)
+	mockProgressMgr.EXPECT().DeletePeerIDByPieceNum(gomock.Any(), "task", 0, "down").Return(nil)
+	mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), "up").Return(&mgr.PeerState{}, nil)
+	mockProgressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), "up").Return(nil, errortypes.ErrDataNotFound)
+
+	sources := manager.strategy.SelectSources(context.TODO(), "task", "srcPeer", 0, []string{"down", "up"})
+	c.Check(sources, check.DeepEquals, []string{"up"})
+}
+
+func (s *StrategyTestSuite) TestWeightedRandomStrategy(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+
+	// the remaining capacities of the peers are 4, 3, 1 and 0 without slow start
+	loads := map[string]int32{"peer1": 1, "peer2": 2, "peer3": 4, "full": 5}
+	for peerID, load := range loads {
+		mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), peerID).Return(&mgr.PeerState{
+			PeerID:       peerID,
+			ProducerLoad: atomiccount.NewAtomicInt(load),
+		}, nil).AnyTimes()
+		mockProgressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), peerID).Return(nil, errortypes.ErrDataNotFound).AnyTimes()
+	}
+
+	var cases = []struct {
+		temperature float64
+		expected    map[string]float64
+	}{
+		{1, map[string]float64{"peer1": 4.0 / 8, "peer2": 3.0 / 8, "peer3": 1.0 / 8}},
+		{0.5, map[string]float64{"peer1": 16.0 / 26, "peer2": 9.0 / 26, "peer3": 1.0 / 26}},
+		{1000, map[string]float64{"peer1": 1.0 / 3, "peer2": 1.0 / 3, "peer3": 1.0 / 3}},
+	}
+	const selections = 20000
+	for _, v := range cases {
+		cfg := config.NewConfig()
+		cfg.SchedulerStrategy = WeightedRandomStrategy
+		cfg.SchedulerTemperature = v.temperature
+		cfg.SlowStartInitialLimit = 0
+		manager, err := NewManager(cfg, mockProgressMgr, nil)
+		c.Assert(err, check.IsNil)
+		strategy := manager.strategy.(*weightedRandomStrategy)
+		strategy.rand.Seed(1)
+
+		counts := make(map[string]int)
+		for i := 0; i < selections; i++ {
+			sources := strategy.SelectSources(context.TODO(), "task", "srcPeer", 0, []string{"full", "peer1", "peer2", "peer3"})
+			c.Assert(sources, check.HasLen, 4)
+			c.Assert(sources[3], check.Equals, "full")
+			counts[sources[0]]++
+		}
+		for peerID, expected := range v.expected {
+			actual := float64(counts[peerID]) / selections
+			c.Check(math.Abs(actual-expected) < 0.02, check.Equals, true,
+				check.Commentf("temperature: %v, peer: %s, actual: %v, expected: %v", v.temperature, peerID, actual, expected))
+		}
+	}
+}
+
+func (s *StrategyTestSuite) TestWeightedRandomStrategyInvalidTemperature(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SchedulerStrategy = WeightedRandomStrategy
+	cfg.SchedulerTemperature = 0
+	_, err := NewManager(cfg, nil, nil)
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// TiebreakerRandom orders the equally good sources randomly.
+	TiebreakerRandom = "random"
+
+	// TiebreakerRoundRobin rotates the equally good sources in turn.
+	TiebreakerRoundRobin = "round-robin"
+
+	// TiebreakerLeastRecentlyAssigned orders the equally good sources
+	// by the last time they were assigned a piece, and the ones never assigned come first.
+	TiebreakerLeastRecentlyAssigned = "least-recently-assigned"
+
+	// DefaultTiebreaker is the tiebreaker used when no tiebreaker is specified.
+	DefaultTiebreaker = TiebreakerLeastRecentlyAssigned
+)
+
+// tiebreaker orders the sources which are equally good,
+// so that the same peer is not always chosen from them.
+type tiebreaker interface {
+	// order orders the sources in place.
+	order(sources []string)
+
+	// assign records that the source is assigned a piece.
+	assign(peerID string)
+}
+
+// newTiebreaker creates the tiebreaker specified by name,
+// and the random tiebreaker is seeded with seed.
+func newTiebreaker(name string, seed int64) (tiebreaker, error) {
+	switch name {
+	case TiebreakerRandom:
+		return &randomTiebreaker{rand: rand.New(rand.NewSource(seed))}, nil
+	case TiebreakerRoundRobin:
+		return &roundRobinTiebreaker{}, nil
+	case TiebreakerLeastRecentlyAssigned:
+		return &lraTiebreaker{lastAssigned: make(map[string]int64)}, nil
+	}
+	return nil, errors.Wrapf(errortypes.ErrInvalidValue, "unknown scheduler tiebreaker: %s", name)
+}
+
+func getTiebreakerName(cfg *config.Config) string {
+	if cfg == nil || cfg.BaseProperties == nil || cfg.SchedulerTiebreaker == "" {
+		return DefaultTiebreaker
+	}
+	return cfg.SchedulerTiebreaker
+}
+
+type randomTiebreaker struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (rt *randomTiebreaker) order(sources []string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.rand.Shuffle(len(sources), func(i, j int) {
+		sources[i], sources[j] = sources[j], sources[i]
+	})
+}
+
+func (rt *randomTiebreaker) assign(peerID string) {}
+
+type roundRobinTiebreaker struct {
+	next uint64
+}
+
+func (rrt *roundRobinTiebreaker) order(sources []string) {
+	if len(sources) <= 1 {
+		return
+	}
+	offset := int((atomic.AddUint64(&rrt.next, 1) - 1) % uint64(len(sources)))
+	rotated := append(append(make([]string, 0, len(sources)), sources[offset:]...), sources[:offset]...)
+	copy(sources, rotated)
+}
+
+func (rrt *roundRobinTiebreaker) assign(peerID string) {}
+
+// lraTiebreaker is the least-recently-assigned tiebreaker,
+// which uses a logical clock to record the last time of the assignments.
+type lraTiebreaker struct {
+	mu           sync.Mutex
+	clock        int64
+	lastAssigned map[string]int64
+}
+
+func (lt *lraTiebreaker) order(sources []string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	sort.SliceStable(sources, func(i, j int) bool {
+		return lt.lastAssigned[sources[i]] < lt.lastAssigned[sources[j]]
+	})
+}
+
+func (lt *lraTiebreaker) assign(peerID string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.clock++
+	lt.lastAssigned[peerID] = lt.clock
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+)
+
+func init() {
+	check.Suite(&TiebreakerTestSuite{})
+}
+
+type TiebreakerTestSuite struct{}
+
+// countAssignments returns the times each of the equally good peers is chosen
+// by the scheduler with the tiebreaker in rounds.
+func countAssignments(c *check.C, tiebreaker string, peerIDs []string, rounds int) map[string]int {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+
+	cfg := config.NewConfig()
+	cfg.SetSuperPID("superPID")
+	cfg.SchedulerTiebreaker = tiebreaker
+	manager, err := NewManager(cfg, mockProgressMgr, nil)
+	c.Assert(err, check.IsNil)
+
+	var downTime int64
+	states := make(map[string]*mgr.PeerState)
+	for _, peerID := range peerIDs {
+		states[peerID] = &mgr.PeerState{
+			PeerID:              peerID,
+			ServiceDownTime:     &downTime,
+			ServiceSuccessCount: atomiccount.NewAtomicInt(0),
+			ProducerLoad:        atomiccount.NewAtomicInt(0),
+		}
+		mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), peerID).Return(states[peerID], nil).AnyTimes()
+		mockProgressMgr.EXPECT().GetBlackInfoByPeerID(gomock.Any(), peerID).Return(nil, errortypes.ErrDataNotFound).AnyTimes()
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < rounds; i++ {
+		peerID := manager.tryGetPID(context.TODO(), "task", "srcPeer", i, append([]string(nil), peerIDs...))
+		counts[peerID]++
+		// the piece is finished immediately
+		states[peerID].ProducerLoad.Add(-1)
+	}
+	return counts
+}
+
+func (s *TiebreakerTestSuite) TestSpreadAssignments(c *check.C) {
+	peerIDs := []string{"peer1", "peer2", "peer3", "peer4"}
+
+	for _, tiebreaker := range []string{TiebreakerRoundRobin, TiebreakerLeastRecentlyAssigned} {
+		counts := countAssignments(c, tiebreaker, peerIDs, 400)
+		for _, peerID := range peerIDs {
+			c.Check(counts[peerID], check.Equals, 100, check.Commentf("tiebreaker %s", tiebreaker))
+		}
+	}
+
+	counts := countAssignments(c, TiebreakerRandom, peerIDs, 400)
+	for _, peerID := range peerIDs {
+		c.Check(counts[peerID] > 50 && counts[peerID] < 150, check.Equals, true)
+	}
+}
+
+func (s *TiebreakerTestSuite) TestSeededRandomTiebreaker(c *check.C) {
+	order := func(seed int64) [][]string {
+		tb, err := newTiebreaker(TiebreakerRandom, seed)
+		c.Assert(err, check.IsNil)
+		var orders [][]string
+		for i := 0; i < 10; i++ {
+			sources := []string{"peer1", "peer2", "peer3", "peer4"}
+			tb.order(sources)
+			orders = append(orders, sources)
+		}
+		return orders
+	}
+
+	c.Check(order(1), check.DeepEquals, order(1))
+}
+
+func (s *TiebreakerTestSuite) TestLeastRecentlyAssignedTiebreaker(c *check.C) {
+	tb, err := newTiebreaker(TiebreakerLeastRecentlyAssigned, 0)
+	c.Assert(err, check.IsNil)
+
+	tb.assign("peer1")
+	tb.assign("peer3")
+	sources := []string{"peer1", "peer2", "peer3", "peer4"}
+	tb.order(sources)
+	c.Check(sources, check.DeepEquals, []string{"peer2", "peer4", "peer1", "peer3"})
+}
+
+func (s *TiebreakerTestSuite) TestUnknownTiebreaker(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SchedulerTiebreaker = "foo"
+	_, err := NewManager(cfg, nil, nil)
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// handoff contains the pieces assigned to a client by the warm handoff,
+// which will be scheduled to the client before the other pieces.
+type handoff struct {
+	sync.Mutex
+	taskID string
+	pieces map[int]bool
+}
+
+// WarmHandoff spreads the pieces of taskID which are held by no peer among some of the clientIDs
+// when the CDN of the task finishes, and the clients will be scheduled to download them first.
+//
+// The clients are chosen greedily to cover the most pieces held by no peer, and each piece
+// is assigned to the chosen client which lacks it and has been assigned the fewest pieces.
+// So that the clients download different pieces from supernode at the beginning, and the
+// whole file will be held by peers as soon as possible.
+func (sm *Manager) WarmHandoff(ctx context.Context, taskID string, clientIDs []string) error {
+	limit := sm.cfg.WarmHandoffClients
+	if limit <= 0 || len(clientIDs) == 0 {
+		return nil
+	}
+
+	// get the pieces that each client lacks
+	available := make(map[string]map[int]bool)
+	uncovered := make(map[int]bool)
+	for _, clientID := range clientIDs {
+		pieceNums, err := sm.progressMgr.GetPieceProgressByCID(ctx, taskID, clientID, "available")
+		if err != nil {
+			logrus.Warnf("failed to get available pieces of clientID(%s) for warm handoff of taskID(%s): %v", clientID, taskID, err)
+			continue
+		}
+		available[clientID] = make(map[int]bool, len(pieceNums))
+		for _, pieceNum := range pieceNums {
+			available[clientID][pieceNum] = true
+			if _, ok := uncovered[pieceNum]; !ok {
+				uncovered[pieceNum] = !sm.isHeldByPeers(ctx, taskID, pieceNum)
+			}
+		}
+	}
+	for pieceNum, ok := range uncovered {
+		if !ok {
+			delete(uncovered, pieceNum)
+		}
+	}
+	if len(uncovered) == 0 {
+		return nil
+	}
+
+	chosen := chooseHandoffClients(available, uncovered, limit)
+	assigned := assignHandoffPieces(available, uncovered, chosen)
+	for clientID, pieces := range assigned {
+		sm.handoffs.Add(clientID, &handoff{
+			taskID: taskID,
+			pieces: pieces,
+		})
+		logrus.Infof("warm handoff assigns %d pieces to clientID(%s) for taskID(%s)", len(pieces), clientID, taskID)
+	}
+	return nil
+}
+
+// isHeldByPeers returns whether the piece is held by any peer other than supernode.
+func (sm *Manager) isHeldByPeers(ctx context.Context, taskID string, pieceNum int) bool {
+	peerIDs, err := sm.progressMgr.GetPeerIDsByPieceNum(ctx, taskID, pieceNum)
+	if err != nil {
+		return false
+	}
+	for _, peerID := range peerIDs {
+		if peerID != sm.cfg.GetSuperPID() {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseHandoffClients chooses at most limit clients one by one, each of which lacks the most
+// pieces not covered by the chosen ones, or the most uncovered pieces if all have been covered,
+// so that the pieces can be spread among more clients.
+func chooseHandoffClients(available map[string]map[int]bool, uncovered map[int]bool, limit int) []string {
+	clientIDs := make([]string, 0, len(available))
+	for clientID := range available {
+		clientIDs = append(clientIDs, clientID)
+	}
+	sort.Strings(clientIDs)
+
+	covered := make(map[int]bool)
+	var chosen []string
+	for len(chosen) < limit {
+		best, bestGain, bestTotal := -1, 0, 0
+		for i, clientID := range clientIDs {
+			if clientID == "" {
+				continue
+			}
+			gain, total := 0, 0
+			for pieceNum := range available[clientID] {
+				if !uncovered[pieceNum] {
+					continue
+				}
+				total++
+				if !covered[pieceNum] {
+					gain++
+				}
+			}
+			if total > 0 && (gain > bestGain || (gain == bestGain && total > bestTotal)) {
+				best, bestGain, bestTotal = i, gain, total
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		chosen = append(chosen, clientIDs[best])
+		for pieceNum := range available[clientIDs[best]] {
+			covered[pieceNum] = true
+		}
+		clientIDs[best] = ""
+	}
+	return chosen
+}
+
+// assignHandoffPieces assigns each uncovered piece to the chosen client
+// which lacks it and has been assigned the fewest pieces.
+func assignHandoffPieces(available map[string]map[int]bool, uncovered map[int]bool, chosen []string) map[string]map[int]bool {
+	pieceNums := make([]int, 0, len(uncovered))
+	for pieceNum := range uncovered {
+		pieceNums = append(pieceNums, pieceNum)
+	}
+	sort.Ints(pieceNums)
+
+	assigned := make(map[string]map[int]bool, len(chosen))
+	for _, pieceNum := range pieceNums {
+		var target string
+		for _, clientID := range chosen {
+			if !available[clientID][pieceNum] {
+				continue
+			}
+			if target == "" || len(assigned[clientID]) < len(assigned[target]) {
+				target = clientID
+			}
+		}
+		if target == "" {
+			continue
+		}
+		if assigned[target] == nil {
+			assigned[target] = make(map[int]bool)
+		}
+		assigned[target][pieceNum] = true
+	}
+	return assigned
+}
+
+// prioritizeHandoff moves the pieces assigned to the client by the warm handoff
+// to the front of the pieceNums, and forgets the handoff once none of its pieces
+// is available to the client any more.
+func (sm *Manager) prioritizeHandoff(taskID, clientID string, pieceNums []int) []int {
+	v, err := sm.handoffs.Get(clientID)
+	if err != nil {
+		return pieceNums
+	}
+	h, ok := v.(*handoff)
+	if !ok || h.taskID != taskID {
+		return pieceNums
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	result := make([]int, 0, len(pieceNums))
+	for _, pieceNum := range pieceNums {
+		if h.pieces[pieceNum] {
+			result = append(result, pieceNum)
+		}
+	}
+	if len(result) == 0 {
+		sm.handoffs.Remove(clientID)
+		return pieceNums
+	}
+	for _, pieceNum := range pieceNums {
+		if !h.pieces[pieceNum] {
+			result = append(result, pieceNum)
+		}
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+)
+
+// WeightedRandomStrategy is the name of the strategy which prefers the peers randomly
+// with the probabilities in proportion to their remaining upload capacity.
+const WeightedRandomStrategy = "weighted-random"
+
+func init() {
+	RegisterStrategy(WeightedRandomStrategy, newWeightedRandomStrategy)
+}
+
+var _ Strategy = &weightedRandomStrategy{}
+
+// weightedRandomStrategy orders the sources selected by the defaultStrategy randomly,
+// and the probability of a source to be the first one is in proportion to its weight.
+// Compared with always choosing the least loaded peer, it spreads the pieces assigned
+// at the same time among the peers instead of piling them onto the same one.
+type weightedRandomStrategy struct {
+	*defaultStrategy
+	cfg *config.Config
+	// exponent is 1/temperature which the capacity is raised to the power of.
+	exponent float64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newWeightedRandomStrategy(cfg *config.Config, progressMgr mgr.ProgressMgr) (Strategy, error) {
+	if cfg.SchedulerTemperature <= 0 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "scheduler temperature: %v", cfg.SchedulerTemperature)
+	}
+
+	return &weightedRandomStrategy{
+		defaultStrategy: &defaultStrategy{progressMgr: progressMgr},
+		cfg:             cfg,
+		exponent:        1 / cfg.SchedulerTemperature,
+		rand:            rand.New(rand.NewSource(getSchedulerSeed(cfg))),
+	}, nil
+}
+
+// SelectSources orders the available candidates by the weighted random sampling
+// without replacement, and the fully loaded ones are put at the end.
+func (ws *weightedRandomStrategy) SelectSources(ctx context.Context, taskID, srcPID string, pieceNum int, candidates []string) []string {
+	sources := ws.defaultStrategy.SelectSources(ctx, taskID, srcPID, pieceNum, candidates)
+	if len(sources) <= 1 {
+		return sources
+	}
+
+	// the key of a source is log(u)/weight with u uniform in (0, 1), and ordering the sources
+	// by the keys descending samples them without replacement in proportion to the weights.
+	keys := make(map[string]float64, len(sources))
+	ws.mu.Lock()
+	for _, peerID := range sources {
+		weight := ws.weight(ctx, peerID)
+		if weight <= 0 {
+			keys[peerID] = math.Inf(-1)
+			continue
+		}
+		keys[peerID] = math.Log(1-ws.rand.Float64()) / weight
+	}
+	ws.mu.Unlock()
+
+	sort.SliceStable(sources, func(i, j int) bool {
+		return keys[sources[i]] > keys[sources[j]]
+	})
+	return sources
+}
+
+// Unranked returns false since the sources have been ordered by the weights.
+func (ws *weightedRandomStrategy) Unranked() bool {
+	return false
+}
+
+// weight returns the remaining upload capacity of the peer raised to the power of the exponent.
+func (ws *weightedRandomStrategy) weight(ctx context.Context, peerID string) float64 {
+	peerState, err := ws.progressMgr.GetPeerStateByPeerID(ctx, peerID)
+	if err != nil || peerState.ProducerLoad == nil {
+		return 0
+	}
+
+	capacity := getUpLimit(ws.cfg, peerState) - peerState.ProducerLoad.Get()
+	if capacity <= 0 {
+		return 0
+	}
+	return math.Pow(float64(capacity), ws.exponent)
+}
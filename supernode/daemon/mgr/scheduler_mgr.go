@@ -18,6 +18,8 @@ package mgr
 
 import (
 	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
 )
 
 // PieceResult contains the information about which piece to download from which node.
@@ -29,6 +31,24 @@ type PieceResult struct {
 
 // SchedulerMgr is responsible for calculating scheduling results according to certain rules.
 type SchedulerMgr interface {
-	// Schedule gets scheduler result with specified taskID, clientID and peerID through some rules.
-	Schedule(ctx context.Context, taskID, clientID, peerID string) ([]*PieceResult, error)
+	// Schedule gets scheduler result with specified taskID, clientID and peerID through some rules,
+	// and the pieces are assigned in the pieceOrder hinted by the client.
+	Schedule(ctx context.Context, taskID, clientID, peerID, pieceOrder string) ([]*PieceResult, error)
+
+	// WarmHandoff spreads the pieces of taskID which are held by no peer among some of the clientIDs
+	// when the CDN of the task finishes, and the clients will be scheduled to download them first.
+	WarmHandoff(ctx context.Context, taskID string, clientIDs []string) error
+
+	// SetSafeMode enables or disables the safe mode, in which all the pieces of all the tasks
+	// are scheduled from supernode only until it's disabled. The pieces being downloaded
+	// from the peers are cancelled and scheduled again if cutPeerTransfers is true,
+	// otherwise they are allowed to finish.
+	SetSafeMode(ctx context.Context, enabled, cutPeerTransfers bool)
+
+	// GetSafeMode gets whether the safe mode is enabled and whether it cuts the peer transfers.
+	GetSafeMode(ctx context.Context) (enabled, cutPeerTransfers bool)
+
+	// Explain gets the most recent decision on the source of the piece pieceNum of taskID
+	// assigned to clientID, which is recorded only if the SchedulerExplain is enabled.
+	Explain(ctx context.Context, taskID, clientID string, pieceNum int) (*types.SchedulerDecision, error)
 }
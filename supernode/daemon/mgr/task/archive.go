@@ -0,0 +1,174 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RegisterArchive registers the members of the archive as the tasks, which are downloaded
+// and deduplicated just like the other tasks, and triggers the CDN of the uncached ones.
+// The archive of the same members is registered with the same ID.
+func (tm *Manager) RegisterArchive(ctx context.Context, req *types.ArchiveCreateRequest) (*types.ArchiveInfo, error) {
+	members, err := sortArchiveMembers(req.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &types.ArchiveInfo{}
+	for _, member := range members {
+		task, err := tm.addOrUpdateTask(ctx, &types.TaskCreateRequest{
+			RawURL:  *member.RawURL,
+			Headers: req.Headers,
+		}, tm.cfg.FailAccessInterval*time.Minute)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to register the member %s", *member.Name)
+		}
+		tm.touchTask(task.ID)
+		if err := tm.triggerCdnSyncAction(ctx, task); err != nil {
+			return nil, errors.Wrapf(errortypes.ErrSystemError, "failed to trigger cdn of the member %s: %v", *member.Name, err)
+		}
+
+		archive.Members = append(archive.Members, &types.ArchiveMember{
+			Name:   member.Name,
+			RawURL: member.RawURL,
+			TaskID: task.ID,
+		})
+	}
+	archive.ID = generateArchiveID(archive.Members)
+	tm.archives.Add(archive.ID, archive)
+	logrus.Infof("success to register archive %s with %d members", archive.ID, len(archive.Members))
+
+	return tm.GetArchive(ctx, archive.ID)
+}
+
+// GetArchive returns the archive with the CDN status of its members.
+// The archive is removed once any of its member tasks is deleted,
+// and it should be registered again then.
+func (tm *Manager) GetArchive(ctx context.Context, archiveID string) (*types.ArchiveInfo, error) {
+	v, err := tm.archives.Get(archiveID)
+	if err != nil {
+		return nil, err
+	}
+	archive := v.(*types.ArchiveInfo)
+
+	result := &types.ArchiveInfo{ID: archive.ID}
+	for _, member := range archive.Members {
+		task, err := tm.getTask(member.TaskID)
+		if err != nil {
+			if errortypes.IsDataNotFound(err) {
+				tm.archives.Delete(archiveID)
+				return nil, errors.Wrapf(errortypes.ErrDataNotFound, "archive %s with the member %s deleted", archiveID, *member.Name)
+			}
+			return nil, err
+		}
+		tm.touchTask(task.ID)
+
+		result.Members = append(result.Members, &types.ArchiveMember{
+			Name:      member.Name,
+			RawURL:    member.RawURL,
+			TaskID:    member.TaskID,
+			CdnStatus: task.CdnStatus,
+		})
+	}
+	result.Status = getArchiveStatus(result.Members)
+	return result, nil
+}
+
+// touchTask updates the access time of the task to keep it from being garbage collected.
+func (tm *Manager) touchTask(taskID string) {
+	if err := tm.accessTimeMap.Add(taskID, timeutils.GetCurrentTimeMillis()); err != nil {
+		logrus.Warnf("failed to update accessTime for taskID(%s): %v", taskID, err)
+	}
+}
+
+// sortArchiveMembers returns the members ordered by name after validating that
+// the names are unique relative paths, so that the archive is assembled deterministically.
+func sortArchiveMembers(members []*types.ArchiveMember) ([]*types.ArchiveMember, error) {
+	if len(members) == 0 {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "members")
+	}
+
+	sorted := make([]*types.ArchiveMember, 0, len(members))
+	names := make(map[string]bool, len(members))
+	for _, member := range members {
+		if member == nil || member.Name == nil || member.RawURL == nil {
+			return nil, errors.Wrap(errortypes.ErrEmptyValue, "name or raw url of the member")
+		}
+		name := *member.Name
+		if path.IsAbs(name) || path.Clean(name) != name || name == "." ||
+			name == ".." || strings.HasPrefix(name, "../") {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "member name: %s", name)
+		}
+		if names[name] {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "duplicate member name: %s", name)
+		}
+		names[name] = true
+		sorted = append(sorted, member)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return *sorted[i].Name < *sorted[j].Name
+	})
+	return sorted, nil
+}
+
+// generateArchiveID generates the ID of the archive with the names and the tasks of the members.
+func generateArchiveID(members []*types.ArchiveMember) string {
+	var sb strings.Builder
+	for _, member := range members {
+		fmt.Fprintf(&sb, "%s\t%s\n", *member.Name, member.TaskID)
+	}
+	return digest.Sha256(sb.String())
+}
+
+// getArchiveStatus returns FAILED if any member fails, SUCCESS if all the members succeed,
+// RUNNING if any member is running, and WAITING otherwise.
+func getArchiveStatus(members []*types.ArchiveMember) string {
+	succeeded, running := 0, 0
+	for _, member := range members {
+		switch member.CdnStatus {
+		case types.TaskInfoCdnStatusFAILED, types.TaskInfoCdnStatusSOURCEERROR:
+			return types.ArchiveInfoStatusFAILED
+		case types.TaskInfoCdnStatusSUCCESS:
+			succeeded++
+		case types.TaskInfoCdnStatusRUNNING:
+			running++
+		}
+	}
+
+	if succeeded == len(members) {
+		return types.ArchiveInfoStatusSUCCESS
+	}
+	if running > 0 || succeeded > 0 {
+		return types.ArchiveInfoStatusRUNNING
+	}
+	return types.ArchiveInfoStatusWAITING
+}
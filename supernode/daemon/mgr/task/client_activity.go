@@ -0,0 +1,160 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// clientActivity is the last time when the client pulled or reported the pieces of the task,
+// or renewed its lease on the task.
+type clientActivity struct {
+	taskID     string
+	clientID   string
+	lastActive time.Time
+}
+
+// touchClient records that the client makes progress on the task now,
+// which resets the timeout of its inactivity. It holds the lock of the task
+// so that it's never lost in the middle of detaching the client, and the client
+// which has been detached is not recorded again until it registers.
+func (tm *Manager) touchClient(taskID, clientID string) {
+	if !tm.isClientReaperEnabled() {
+		return
+	}
+
+	tm.taskLocker.GetLock(taskID, false)
+	defer tm.taskLocker.ReleaseLock(taskID, false)
+
+	if tm.getPurgedReason(taskID, clientID) != nil {
+		return
+	}
+	tm.clientActivities.Add(generatePurgedClientKey(taskID, clientID), &clientActivity{
+		taskID:     taskID,
+		clientID:   clientID,
+		lastActive: time.Now(),
+	})
+}
+
+// RenewClient renews the lease of the client on the task without pulling the pieces,
+// which resets the timeout of its inactivity. So the client which is alive but busy,
+// such as writing to a slow disk, is not detached. Nothing is scheduled for it.
+func (tm *Manager) RenewClient(ctx context.Context, taskID, clientID string) error {
+	if _, err := tm.dfgetTaskMgr.Get(ctx, clientID, taskID); err != nil {
+		if reason := tm.getPurgedReason(taskID, clientID); errortypes.IsDataNotFound(err) && reason != nil {
+			return errors.Wrapf(reason, "taskID (%s) clientID (%s)", taskID, clientID)
+		}
+		return errors.Wrapf(err, "failed to get dfgetTask with taskID (%s) clientID (%s)", taskID, clientID)
+	}
+	tm.touchClient(taskID, clientID)
+	return nil
+}
+
+// startClientReaper detaches the inactive clients periodically
+// until the client progress timeout is disabled.
+func (tm *Manager) startClientReaper() {
+	if !tm.isClientReaperEnabled() {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(tm.cfg.ClientProgressTimeout / 2)
+			tm.reapInactiveClients(context.Background())
+		}
+	}()
+}
+
+// reapInactiveClients detaches the clients which make no progress within the ClientProgressTimeout.
+func (tm *Manager) reapInactiveClients(ctx context.Context) {
+	for _, key := range tm.clientActivities.ListKeyAsStringSlice() {
+		v, err := tm.clientActivities.Get(key)
+		if err != nil {
+			continue
+		}
+		activity, ok := v.(*clientActivity)
+		if !ok || !tm.isClientInactive(activity) {
+			continue
+		}
+		if err := tm.detachClient(ctx, activity.taskID, activity.clientID); err != nil {
+			logrus.Errorf("failed to detach the inactive clientID(%s) from taskID(%s): %v",
+				activity.clientID, activity.taskID, err)
+		}
+	}
+}
+
+// detachClient detaches the inactive client from the task, which releases the pieces
+// being downloaded by it and cleans its progress. And the client is told that it's detached
+// when it pulls the pieces again.
+func (tm *Manager) detachClient(ctx context.Context, taskID, clientID string) error {
+	tm.taskLocker.GetLock(taskID, true)
+	defer tm.taskLocker.ReleaseLock(taskID, true)
+
+	// the client may have renewed its lease after being found inactive.
+	key := generatePurgedClientKey(taskID, clientID)
+	if v, err := tm.clientActivities.Get(key); err == nil {
+		if activity, ok := v.(*clientActivity); ok && !tm.isClientInactive(activity) {
+			return nil
+		}
+	}
+
+	dfgetTask, err := tm.dfgetTaskMgr.Get(ctx, clientID, taskID)
+	if err != nil {
+		tm.clientActivities.Delete(key)
+		if errortypes.IsDataNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	// the finished client stops pulling the pieces but keeps serving them to the others.
+	if dfgetTask.Status == types.DfGetTaskStatusSUCCESS || dfgetTask.Status == types.DfGetTaskStatusFAILED {
+		tm.clientActivities.Delete(key)
+		return nil
+	}
+
+	if err := tm.progressMgr.DeletePieceProgressByCID(ctx, taskID, clientID); err != nil &&
+		!errortypes.IsDataNotFound(err) {
+		return err
+	}
+	if err := tm.dfgetTaskMgr.Delete(ctx, clientID, taskID); err != nil &&
+		!errortypes.IsDataNotFound(err) {
+		return err
+	}
+	tm.taskPurgedClients.Add(key, errortypes.ErrClientInactive)
+	tm.clientActivities.Delete(key)
+	tm.metrics.inactiveClientsDetached.WithLabelValues().Inc()
+
+	logrus.Warnf("success to detach the clientID(%s) from taskID(%s) which is inactive for %v",
+		clientID, taskID, tm.cfg.ClientProgressTimeout)
+	return nil
+}
+
+// isClientInactive returns whether the client makes no progress within the ClientProgressTimeout.
+func (tm *Manager) isClientInactive(activity *clientActivity) bool {
+	return time.Since(activity.lastActive) > tm.cfg.ClientProgressTimeout
+}
+
+func (tm *Manager) isClientReaperEnabled() bool {
+	return tm.cfg != nil && tm.cfg.BaseProperties != nil && tm.cfg.ClientProgressTimeout > 0
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/util"
+
+	"github.com/pkg/errors"
+)
+
+// validateCompletionPolicy validates the completion policy and the required range of the request.
+func validateCompletionPolicy(req *types.TaskCreateRequest) error {
+	switch req.CompletionPolicy {
+	case "", types.TaskCreateRequestCompletionPolicyFull, types.TaskCreateRequestCompletionPolicyPartial:
+	default:
+		return errors.Wrapf(errortypes.ErrInvalidValue, "completion policy: %s", req.CompletionPolicy)
+	}
+
+	if stringutils.IsEmptyStr(req.RequiredRange) {
+		return nil
+	}
+	if _, _, err := util.ParseRange(req.RequiredRange); err != nil {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "required range: %v", err)
+	}
+	return nil
+}
+
+// requiredPieceRange returns the numbers of the first and the last pieces covering
+// the required range of the client, and ok is false if the client should download
+// all the pieces since the task isn't completed partially.
+// The range beyond the end of the file is ignored.
+func requiredPieceRange(task *types.TaskInfo, requiredRange string) (startNum, endNum int, ok bool) {
+	if task.CompletionPolicy != types.TaskInfoCompletionPolicyPartial || stringutils.IsEmptyStr(requiredRange) {
+		return 0, 0, false
+	}
+	pieceContSize := int64(task.PieceSize) - config.PieceWrapSize
+	if pieceContSize <= 0 {
+		return 0, 0, false
+	}
+	start, end, err := util.ParseRange(requiredRange)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	if task.HTTPFileLength > 0 {
+		if start >= task.HTTPFileLength {
+			return 0, 0, false
+		}
+		if end >= task.HTTPFileLength {
+			end = task.HTTPFileLength - 1
+		}
+	}
+	startNum, endNum = int(start/pieceContSize), int(end/pieceContSize)
+	if task.PieceTotal > 0 && endNum >= int(task.PieceTotal) {
+		endNum = int(task.PieceTotal) - 1
+	}
+	return startNum, endNum, startNum <= endNum
+}
+
+// isRequiredRangeDownloaded returns whether the client has downloaded all the pieces
+// covering its required range when the task is completed partially.
+func isRequiredRangeDownloaded(task *types.TaskInfo, dfgetTask *types.DfGetTask, successPieceNums []int) bool {
+	startNum, endNum, ok := requiredPieceRange(task, dfgetTask.RequiredRange)
+	if !ok {
+		return false
+	}
+
+	downloaded := make(map[int]bool, len(successPieceNums))
+	for _, pieceNum := range successPieceNums {
+		downloaded[pieceNum] = true
+	}
+	for pieceNum := startNum; pieceNum <= endNum; pieceNum++ {
+		if !downloaded[pieceNum] {
+			return false
+		}
+	}
+	return true
+}
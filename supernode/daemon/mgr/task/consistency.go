@@ -0,0 +1,116 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ensureConsistency makes the content of the task registered by the req as consistent
+// with the source as the level the req requires. The task downloaded successfully is
+// attached as it is with cached-ok, attached after the source is revalidated with revalidate,
+// and downloaded from the source again with always-fresh. And the task to be downloaded
+// detects its cache as the level when the CDN is triggered.
+// The registration fails if the source can't be revalidated with revalidate, or the task
+// is being downloaded by other clients when it needs to be downloaded again.
+// It returns the task to attach to and whether the source has been revalidated.
+func (tm *Manager) ensureConsistency(ctx context.Context, req *types.TaskCreateRequest, task *types.TaskInfo,
+	failAccessInterval time.Duration) (*types.TaskInfo, bool, error) {
+	tm.taskLocker.GetLock(task.ID, false)
+	if isFrozen(task.CdnStatus) {
+		task.Consistency = req.Consistency
+	}
+	cdnStatus := task.CdnStatus
+	tm.taskLocker.ReleaseLock(task.ID, false)
+
+	// the task being downloaded is attached as it is since its content comes from the source just now.
+	if !isSuccessCDN(cdnStatus) {
+		return task, false, nil
+	}
+
+	switch req.Consistency {
+	case types.TaskCreateRequestConsistencyRevalidate:
+		notModified, err := tm.cdnMgr.Revalidate(ctx, task)
+		if err != nil {
+			// the cached content is never served unless the source confirms it's not modified.
+			return nil, false, errors.Wrapf(err, "failed to revalidate taskID(%s)", task.ID)
+		}
+		if notModified {
+			return task, true, nil
+		}
+		logrus.Infof("taskID(%s) has been modified in the source since it was downloaded", task.ID)
+	case types.TaskCreateRequestConsistencyAlwaysFresh:
+	default:
+		return task, false, nil
+	}
+	return tm.refreshTask(ctx, req, task, failAccessInterval)
+}
+
+// refreshTask purges the task downloaded successfully with its cached file and registers
+// the task again, so that the content is downloaded from the source again.
+// The refresh is rejected with ErrTaskBusy while other clients are downloading the task,
+// since the purge would detach them from the shared file.
+func (tm *Manager) refreshTask(ctx context.Context, req *types.TaskCreateRequest, task *types.TaskInfo,
+	failAccessInterval time.Duration) (*types.TaskInfo, bool, error) {
+	// the task may have been refreshed by another registration just now.
+	if current, err := tm.getTask(task.ID); err == nil && current == task {
+		downloading, err := tm.hasDownloadingClients(ctx, task.ID, req.CID)
+		if err != nil {
+			return nil, false, err
+		}
+		if downloading {
+			return nil, false, errors.Wrapf(errortypes.ErrTaskBusy,
+				"taskID(%s) is being downloaded by other clients, refresh it later", task.ID)
+		}
+		if err := tm.purgeTask(ctx, task.ID, errortypes.ErrTaskPurged); err != nil {
+			return nil, false, err
+		}
+		logrus.Infof("success to purge taskID(%s) to download it again with the consistency %s", task.ID, req.Consistency)
+	}
+
+	task, err := tm.addOrUpdateTask(ctx, req, failAccessInterval)
+	if err != nil {
+		return nil, false, err
+	}
+	return task, false, nil
+}
+
+// hasDownloadingClients returns whether any client other than the cID and supernode itself
+// is still downloading the task.
+func (tm *Manager) hasDownloadingClients(ctx context.Context, taskID, cID string) (bool, error) {
+	dfgetTasks, err := tm.dfgetTaskMgr.List(ctx, map[string]string{"taskID": taskID})
+	if err != nil {
+		return false, err
+	}
+	superCID := tm.cfg.GetSuperCID(taskID)
+	for _, dfgetTask := range dfgetTasks {
+		if dfgetTask.CID == cID || dfgetTask.CID == superCID {
+			continue
+		}
+		if dfgetTask.Status == types.DfGetTaskStatusWAITING || dfgetTask.Status == types.DfGetTaskStatusRUNNING {
+			return true, nil
+		}
+	}
+	return false, nil
+}
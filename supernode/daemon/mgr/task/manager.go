@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
@@ -49,6 +50,11 @@ type metrics struct {
 	triggerCdnCount              *prometheus.CounterVec
 	triggerCdnFailCount          *prometheus.CounterVec
 	scheduleDurationMilliSeconds *prometheus.HistogramVec
+	taskCompleteDurationSeconds  *prometheus.HistogramVec
+	inactiveClientsDetached      *prometheus.CounterVec
+	corruptedTasksEvicted        *prometheus.CounterVec
+	orphanedFilesReclaimed       *prometheus.CounterVec
+	orphanedBytesReclaimed       *prometheus.CounterVec
 }
 
 func newMetrics(register prometheus.Registerer) *metrics {
@@ -68,6 +74,21 @@ func newMetrics(register prometheus.Registerer) *metrics {
 		scheduleDurationMilliSeconds: metricsutils.NewHistogram(config.SubsystemSupernode, "schedule_duration_milliseconds",
 			"Duration for task scheduling in milliseconds", []string{"peer"},
 			prometheus.ExponentialBuckets(0.02, 2, 6), register),
+		taskCompleteDurationSeconds: metricsutils.NewHistogram(config.SubsystemSupernode, "task_complete_duration_seconds",
+			"Duration from the registration of a task to supernode finishing downloading the whole file",
+			[]string{}, prometheus.ExponentialBuckets(0.1, 2, 16), register),
+		inactiveClientsDetached: metricsutils.NewCounter(config.SubsystemSupernode, "inactive_clients_detached_total",
+			"Total number of the clients detached from the tasks since they made no progress in time",
+			[]string{}, register),
+		corruptedTasksEvicted: metricsutils.NewCounter(config.SubsystemSupernode, "corrupted_tasks_evicted_total",
+			"Total number of the tasks evicted since their stored pieces were corrupted",
+			[]string{"detector"}, register),
+		orphanedFilesReclaimed: metricsutils.NewCounter(config.SubsystemSupernode, "orphaned_files_reclaimed_total",
+			"Total number of the files reclaimed from the storage since they were referenced by no task",
+			[]string{}, register),
+		orphanedBytesReclaimed: metricsutils.NewCounter(config.SubsystemSupernode, "orphaned_bytes_reclaimed_total",
+			"Total bytes of the files reclaimed from the storage since they were referenced by no task",
+			[]string{}, register),
 	}
 }
 
@@ -79,6 +100,27 @@ type Manager struct {
 	taskLocker              *util.LockerPool
 	accessTimeMap           *syncmap.SyncMap
 	taskURLUnReachableStore *syncmap.SyncMap
+	// taskPurgedClients records the clients detached by purging or abandoning,
+	// the key is formed as "clientID@taskID" and the value is the error of the reason.
+	taskPurgedClients *syncmap.SyncMap
+	// clientActivities records the last activities of the clients downloading the tasks,
+	// the key is formed as "clientID@taskID" and the value is *clientActivity.
+	clientActivities *syncmap.SyncMap
+	// tagIndex indexes the tasks by their tags.
+	tagIndex *tagIndex
+	// merger records the tasks merged into the canonical ones of the same content.
+	merger *taskMerger
+	// archives contains the archives assembling the member tasks.
+	// key:archiveID,value:*types.ArchiveInfo
+	archives *syncmap.SyncMap
+	// poisonedTasks contains the tasks which failed the final verification after their content
+	// had been served, key:taskID,value:the error of the reason.
+	poisonedTasks *syncmap.SyncMap
+	// pausedTasks contains the tasks whose CDN downloads are paused by the administrator.
+	// key:taskID,value:bool
+	pausedTasks *syncmap.SyncMap
+	// pinnedMetadata selects the tasks never evicted by purging by their origin metadata.
+	pinnedMetadata []*metadataSelector
 
 	peerMgr      mgr.PeerMgr
 	dfgetTaskMgr mgr.DfgetTaskMgr
@@ -93,7 +135,20 @@ type Manager struct {
 func NewManager(cfg *config.Config, peerMgr mgr.PeerMgr, dfgetTaskMgr mgr.DfgetTaskMgr,
 	progressMgr mgr.ProgressMgr, cdnMgr mgr.CDNMgr, schedulerMgr mgr.SchedulerMgr,
 	originClient httpclient.OriginHTTPClient, register prometheus.Registerer) (*Manager, error) {
-	return &Manager{
+	if err := validateQueryRules(cfg.TaskIDQueryRules); err != nil {
+		return nil, err
+	}
+	if !stringutils.IsEmptyStr(cfg.DigestAlgorithm) {
+		if _, err := digest.NewHash(cfg.DigestAlgorithm); err != nil {
+			return nil, err
+		}
+	}
+	pinnedMetadata, err := parseMetadataSelectors(cfg.PinnedOriginMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	tm := &Manager{
 		cfg:                     cfg,
 		taskStore:               dutil.NewStore(),
 		taskLocker:              util.NewLockerPool(),
@@ -104,9 +159,22 @@ func NewManager(cfg *config.Config, peerMgr mgr.PeerMgr, dfgetTaskMgr mgr.DfgetT
 		schedulerMgr:            schedulerMgr,
 		accessTimeMap:           syncmap.NewSyncMap(),
 		taskURLUnReachableStore: syncmap.NewSyncMap(),
+		taskPurgedClients:       syncmap.NewSyncMap(),
+		clientActivities:        syncmap.NewSyncMap(),
+		tagIndex:                newTagIndex(),
+		merger:                  newTaskMerger(),
+		archives:                syncmap.NewSyncMap(),
+		poisonedTasks:           syncmap.NewSyncMap(),
+		pausedTasks:             syncmap.NewSyncMap(),
+		pinnedMetadata:          pinnedMetadata,
 		OriginClient:            originClient,
 		metrics:                 newMetrics(register),
-	}, nil
+	}
+	tm.startClientReaper()
+	tm.startScrubber()
+	tm.startOrphanReclaimer()
+
+	return tm, nil
 }
 
 // Register will not only register a task.
@@ -123,6 +191,13 @@ func (tm *Manager) Register(ctx context.Context, req *types.TaskCreateRequest) (
 		logrus.Infof("failed to add or update task with req %+v: %v", req, err)
 		return nil, err
 	}
+
+	// the cached content is revalidated or downloaded again as the consistency level requires
+	task, revalidated, err := tm.ensureConsistency(ctx, req, task, failAccessInterval)
+	if err != nil {
+		logrus.Infof("failed to ensure the consistency %s of task with req %+v: %v", req.Consistency, req, err)
+		return nil, err
+	}
 	tm.metrics.tasksRegisterCount.WithLabelValues().Inc()
 	logrus.Debugf("success to get task info: %+v", task)
 	// TODO: defer rollback the task update
@@ -131,6 +206,21 @@ func (tm *Manager) Register(ctx context.Context, req *types.TaskCreateRequest) (
 	if err := tm.accessTimeMap.Add(task.ID, timeutils.GetCurrentTimeMillis()); err != nil {
 		logrus.Warnf("failed to update accessTime for taskID(%s): %v", task.ID, err)
 	}
+	tm.taskLocker.GetLock(task.ID, false)
+	task.AccessCount++
+	tm.taskLocker.ReleaseLock(task.ID, false)
+
+	// resume the progress of the previous client with the same identity if any,
+	// and its dfgetTask will be replaced by the new one.
+	prevCID, err := tm.progressMgr.RebindProgress(ctx, task.ID, req.PeerID, req.CID, req.ClientIdentity)
+	if err != nil {
+		return nil, err
+	}
+	if prevCID != "" && prevCID != req.CID {
+		if err := tm.dfgetTaskMgr.Delete(ctx, prevCID, task.ID); err != nil && !errortypes.IsDataNotFound(err) {
+			logrus.Warnf("failed to delete the dfgetTask of the previous clientID %s for taskID %s: %v", prevCID, task.ID, err)
+		}
+	}
 
 	// Step3: add a new DfgetTask
 	dfgetTask, err := tm.addDfgetTask(ctx, req, task)
@@ -140,6 +230,8 @@ func (tm *Manager) Register(ctx context.Context, req *types.TaskCreateRequest) (
 	}
 
 	logrus.Debugf("success to add dfgetTask %+v", dfgetTask)
+	tm.taskPurgedClients.Delete(generatePurgedClientKey(task.ID, req.CID))
+	tm.touchClient(task.ID, req.CID)
 	defer func() {
 		if err != nil {
 			if err := tm.dfgetTaskMgr.Delete(ctx, req.CID, task.ID); err != nil {
@@ -149,13 +241,26 @@ func (tm *Manager) Register(ctx context.Context, req *types.TaskCreateRequest) (
 		}
 	}()
 
-	// Step4: init Progress
-	if err := tm.progressMgr.InitProgress(ctx, task.ID, req.PeerID, req.CID); err != nil {
-		return nil, err
+	// Step4: init Progress unless it's resumed
+	if prevCID == "" {
+		if err := tm.progressMgr.InitProgress(ctx, task.ID, req.PeerID, req.CID); err != nil {
+			return nil, err
+		}
+		logrus.Debugf("success to init progress for taskID: %s peerID: %s cID: %s", task.ID, req.PeerID, req.CID)
 	}
-	logrus.Debugf("success to init progress for taskID: %s peerID: %s cID: %s", task.ID, req.PeerID, req.CID)
 	// TODO: defer rollback init Progress
 
+	// the registration attaches to the content which has been downloaded completely
+	if isSuccessCDN(task.CdnStatus) {
+		result := mgr.CacheHit
+		if revalidated {
+			result = mgr.CacheRevalidationHit
+		}
+		if err := tm.progressMgr.RecordCacheResult(ctx, task.ID, result); err != nil {
+			logrus.Warnf("failed to record the cache %s for taskID %s: %v", result, task.ID, err)
+		}
+	}
+
 	// Step5: trigger CDN
 	if err := tm.triggerCdnSyncAction(ctx, task); err != nil {
 		return nil, errors.Wrapf(errortypes.ErrSystemError, "failed to trigger cdn: %v", err)
@@ -169,8 +274,18 @@ func (tm *Manager) Register(ctx context.Context, req *types.TaskCreateRequest) (
 }
 
 // Get a task info according to specified taskID.
+// The copy of the task taken under its lock is returned, since the task is updated
+// in place by the CDN running in the background.
 func (tm *Manager) Get(ctx context.Context, taskID string) (*types.TaskInfo, error) {
-	return tm.getTask(taskID)
+	task, err := tm.getTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	tm.taskLocker.GetLock(taskID, true)
+	taskInfo := *task
+	tm.taskLocker.ReleaseLock(taskID, true)
+	return &taskInfo, nil
 }
 
 // GetAccessTime gets all task accessTime.
@@ -179,9 +294,43 @@ func (tm *Manager) GetAccessTime(ctx context.Context) (*syncmap.SyncMap, error)
 }
 
 // List returns a list of tasks with filter.
-// TODO: implement it.
+// The tasks can be filtered by the keys cdnStatus, tag and metadata in the form of "Name=value",
+// and the tasks with the tag are looked up by the tag index.
+// The copies of the tasks taken under the locks of them are returned.
 func (tm *Manager) List(ctx context.Context, filter map[string]string) ([]*types.TaskInfo, error) {
-	return nil, nil
+	var selector *metadataSelector
+	if metadata, ok := filter["metadata"]; ok {
+		var err error
+		if selector, err = parseMetadataSelector(metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	values := tm.taskStore.List()
+	if tag, ok := filter["tag"]; ok {
+		values = tm.listTasksByTag(tag)
+	}
+
+	taskList := make([]*types.TaskInfo, 0)
+	for _, v := range values {
+		task, ok := v.(*types.TaskInfo)
+		if !ok {
+			return nil, errors.Wrapf(errortypes.ErrConvertFailed, "value: %v", v)
+		}
+
+		tm.taskLocker.GetLock(task.ID, true)
+		taskInfo := *task
+		tm.taskLocker.ReleaseLock(task.ID, true)
+
+		if cdnStatus, ok := filter["cdnStatus"]; ok && taskInfo.CdnStatus != cdnStatus {
+			continue
+		}
+		if selector != nil && !selector.match(taskInfo.OriginMetadata) {
+			continue
+		}
+		taskList = append(taskList, &taskInfo)
+	}
+	return taskList, nil
 }
 
 // CheckTaskStatus check the task status.
@@ -201,10 +350,94 @@ func (tm *Manager) CheckTaskStatus(ctx context.Context, taskID string) (bool, er
 
 // Delete deletes a task.
 func (tm *Manager) Delete(ctx context.Context, taskID string) error {
+	if v, err := tm.taskStore.Get(taskID); err == nil {
+		if task, ok := v.(*types.TaskInfo); ok {
+			tm.tagIndex.remove(taskID, task.Tags)
+		}
+	}
 	tm.taskStore.Delete(taskID)
+	tm.merger.remove(taskID)
+	tm.poisonedTasks.Delete(taskID)
+	tm.pausedTasks.Delete(taskID)
 	return nil
 }
 
+// Purge evicts the tasks whose url, digest or tag matches from the cache.
+// The tasks pinned by their origin metadata are never evicted.
+func (tm *Manager) Purge(ctx context.Context, url, digest, tag string) ([]string, error) {
+	if stringutils.IsEmptyStr(url) && stringutils.IsEmptyStr(digest) && stringutils.IsEmptyStr(tag) {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "url, digest and tag")
+	}
+
+	taskIDs, err := tm.listTaskIDsToPurge(url, digest, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	purgedTaskIDs := make([]string, 0, len(taskIDs))
+	for _, taskID := range taskIDs {
+		if tm.isPinned(taskID) {
+			logrus.Infof("skip purging task %s pinned by its origin metadata", taskID)
+			continue
+		}
+		if err := tm.purgeTask(ctx, taskID, errortypes.ErrTaskPurged); err != nil {
+			return purgedTaskIDs, errors.Wrapf(err, "failed to purge taskID %s", taskID)
+		}
+		purgedTaskIDs = append(purgedTaskIDs, taskID)
+		logrus.Infof("success to purge task %s with url(%s) digest(%s) tag(%s)", taskID, url, digest, tag)
+	}
+	return purgedTaskIDs, nil
+}
+
+// Preheat triggers the CDN of the tasks with the tag which are not downloaded
+// or failed to download, so that the files are cached before the clients request them.
+func (tm *Manager) Preheat(ctx context.Context, tag string) ([]string, error) {
+	if stringutils.IsEmptyStr(tag) {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "tag")
+	}
+
+	preheatedTaskIDs := make([]string, 0)
+	for _, taskID := range tm.tagIndex.list(tag) {
+		task, err := tm.getTask(taskID)
+		if err != nil {
+			if errortypes.IsDataNotFound(err) {
+				continue
+			}
+			return preheatedTaskIDs, err
+		}
+		if !isFrozen(task.CdnStatus) || tm.getPoisonedReason(taskID) != nil {
+			continue
+		}
+		if err := tm.triggerCdnSyncAction(ctx, task); err != nil {
+			return preheatedTaskIDs, errors.Wrapf(err, "failed to preheat taskID %s", taskID)
+		}
+		preheatedTaskIDs = append(preheatedTaskIDs, taskID)
+		logrus.Infof("success to preheat task %s with tag(%s)", taskID, tag)
+	}
+	return preheatedTaskIDs, nil
+}
+
+// Cancel cancels the running CDN of the tasks with the tag,
+// and the tasks are abandoned when the CDN stops.
+func (tm *Manager) Cancel(ctx context.Context, tag string) ([]string, error) {
+	if stringutils.IsEmptyStr(tag) {
+		return nil, errors.Wrap(errortypes.ErrEmptyValue, "tag")
+	}
+
+	canceledTaskIDs := make([]string, 0)
+	for _, taskID := range tm.tagIndex.list(tag) {
+		if err := tm.cdnMgr.Cancel(ctx, taskID); err != nil {
+			if errortypes.IsDataNotFound(err) {
+				continue
+			}
+			return canceledTaskIDs, errors.Wrapf(err, "failed to cancel taskID %s", taskID)
+		}
+		canceledTaskIDs = append(canceledTaskIDs, taskID)
+		logrus.Infof("success to cancel task %s with tag(%s)", taskID, tag)
+	}
+	return canceledTaskIDs, nil
+}
+
 // Update the info of task.
 func (tm *Manager) Update(ctx context.Context, taskID string, taskInfo *types.TaskInfo) error {
 	return tm.updateTask(taskID, taskInfo)
@@ -222,9 +455,13 @@ func (tm *Manager) GetPieces(ctx context.Context, taskID, clientID string, req *
 
 	dfgetTask, err := tm.dfgetTaskMgr.Get(ctx, clientID, taskID)
 	if err != nil {
+		if reason := tm.getPurgedReason(taskID, clientID); errortypes.IsDataNotFound(err) && reason != nil {
+			return false, nil, errors.Wrapf(reason, "taskID (%s) clientID (%s)", taskID, clientID)
+		}
 		return false, nil, errors.Wrapf(err, "failed to get dfgetTask with taskID (%s) clientID (%s)", taskID, clientID)
 	}
 	logrus.Debugf("success to get dfgetTask: %+v", dfgetTask)
+	tm.touchClient(taskID, clientID)
 
 	task, err := tm.getTask(taskID)
 	if err != nil {
@@ -258,12 +495,20 @@ func (tm *Manager) UpdatePieceStatus(ctx context.Context, taskID, pieceRange str
 			"failed to parse pieceRange: %s to pieceNum for taskID: %s, clientID: %s",
 			pieceRange, taskID, pieceUpdateRequest.ClientID)
 	}
+	task, err := tm.getTask(taskID)
+	if err != nil {
+		return err
+	}
+	if err := validatePieceNum(task, pieceNum); err != nil {
+		return err
+	}
 
 	// get dfgetTask according to the CID
 	srcDfgetTask, err := tm.dfgetTaskMgr.Get(ctx, pieceUpdateRequest.ClientID, taskID)
 	if err != nil {
 		return err
 	}
+	tm.touchClient(taskID, pieceUpdateRequest.ClientID)
 
 	// get piece status code according to the pieceUpdateRequest.Result
 	pieceStatus, ok := mgr.PieceStatusMap[pieceUpdateRequest.PieceStatus]
@@ -272,5 +517,5 @@ func (tm *Manager) UpdatePieceStatus(ctx context.Context, taskID, pieceRange str
 	}
 
 	return tm.progressMgr.UpdateProgress(ctx, taskID, pieceUpdateRequest.ClientID,
-		srcDfgetTask.PeerID, pieceUpdateRequest.DstPID, pieceNum, pieceStatus)
+		srcDfgetTask.PeerID, pieceUpdateRequest.DstPID, pieceNum, pieceStatus, srcDfgetTask.PieceSize)
 }
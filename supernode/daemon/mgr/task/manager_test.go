@@ -18,10 +18,13 @@ package task
 
 import (
 	"context"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
 	dutil "github.com/dragonflyoss/Dragonfly/supernode/daemon/util"
@@ -29,6 +32,7 @@ import (
 
 	"github.com/go-check/check"
 	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
 )
@@ -64,8 +68,11 @@ func (s *TaskMgrTestSuite) SetUpSuite(c *check.C) {
 	s.mockOriginClient = cMock.NewMockOriginHTTPClient(s.mockCtl)
 
 	s.mockCDNMgr.EXPECT().TriggerCDN(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	s.mockCDNMgr.EXPECT().GetPieceSize(gomock.Any(), gomock.Any()).Return(int32(0), nil).AnyTimes()
 	s.mockDfgetTaskMgr.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	s.mockProgressMgr.EXPECT().InitProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	s.mockProgressMgr.EXPECT().NotifyTask(gomock.Any(), gomock.Any()).AnyTimes()
+	s.mockProgressMgr.EXPECT().RecordTaskEvent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	s.mockOriginClient.EXPECT().GetContentLength(gomock.Any(), gomock.Any()).Return(int64(1000), 200, nil)
 	cfg := config.NewConfig()
 	s.taskManager, _ = NewManager(cfg, s.mockPeerMgr, s.mockDfgetTaskMgr,
@@ -153,6 +160,16 @@ func (s *TaskMgrTestSuite) TestUpdateTaskInfo(c *check.C) {
 	c.Check(err, check.IsNil)
 	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
 	c.Check(task.FileLength, check.Equals, int64(2000))
+	finishTime := time.Time(task.FinishTime)
+	c.Check(finishTime.IsZero(), check.Equals, false)
+	c.Check(finishTime.Before(time.Time(task.CreateTime)), check.Equals, false)
+
+	// do not update the finish time if origin CDNStatus equals success
+	err = s.taskManager.Update(context.Background(), resp.ID, &types.TaskInfo{
+		CdnStatus: types.TaskInfoCdnStatusSUCCESS,
+	})
+	c.Check(err, check.IsNil)
+	c.Check(time.Time(task.FinishTime).Equal(finishTime), check.Equals, true)
 
 	// do not update if origin CDNStatus equals success
 	err = s.taskManager.Update(context.Background(), resp.ID, &types.TaskInfo{
@@ -166,3 +183,646 @@ func (s *TaskMgrTestSuite) TestUpdateTaskInfo(c *check.C) {
 	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
 	c.Check(task.FileLength, check.Equals, int64(2000))
 }
+
+func (s *TaskMgrTestSuite) TestPurge(c *check.C) {
+	s.taskManager.taskStore = dutil.NewStore()
+	tasks := []*types.TaskInfo{
+		{ID: "task1", RawURL: "http://aa.bb.com/foo/1", TaskURL: "http://aa.bb.com/foo/1", Md5: "md5a"},
+		{ID: "task2", RawURL: "http://aa.bb.com/foo/2", TaskURL: "http://aa.bb.com/foo/2", RealMd5: "MD5B"},
+		{ID: "task3", RawURL: "http://aa.bb.com/bar", TaskURL: "http://aa.bb.com/bar"},
+	}
+	for _, task := range tasks {
+		s.taskManager.taskStore.Put(task.ID, task)
+	}
+
+	// return error when both url and digest are empty
+	_, err := s.taskManager.Purge(context.Background(), "", "", "")
+	c.Check(errortypes.IsEmptyValue(err), check.Equals, true)
+
+	// purge the task by exact url with an active client
+	s.mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": "task3"}).
+		Return([]*types.DfGetTask{{CID: "cid3", TaskID: "task3"}}, nil)
+	s.mockProgressMgr.EXPECT().DeletePieceProgressByCID(gomock.Any(), "task3", "cid3").Return(nil)
+	s.mockDfgetTaskMgr.EXPECT().Delete(gomock.Any(), "cid3", "task3").Return(nil)
+	s.mockProgressMgr.EXPECT().DeleteProgressByTaskID(gomock.Any(), "task3").Return(nil)
+	s.mockCDNMgr.EXPECT().Delete(gomock.Any(), "task3").Return(nil)
+	taskIDs, err := s.taskManager.Purge(context.Background(), "http://aa.bb.com/bar", "", "")
+	c.Check(err, check.IsNil)
+	c.Check(taskIDs, check.DeepEquals, []string{"task3"})
+	_, err = s.taskManager.Get(context.Background(), "task3")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	// the purged client is required to register again
+	s.mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "cid3", "task3").
+		Return(nil, errortypes.ErrDataNotFound)
+	_, _, err = s.taskManager.GetPieces(context.Background(), "task3", "cid3", &types.PiecePullRequest{
+		DfgetTaskStatus: types.PiecePullRequestDfgetTaskStatusRUNNING,
+		PieceResult:     types.PiecePullRequestPieceResultSUCCESS,
+	})
+	c.Check(errortypes.IsTaskPurged(err), check.Equals, true)
+
+	// purge the task by digest case-insensitively
+	s.mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": "task2"}).Return(nil, nil)
+	s.mockProgressMgr.EXPECT().DeleteProgressByTaskID(gomock.Any(), "task2").Return(nil)
+	s.mockCDNMgr.EXPECT().Delete(gomock.Any(), "task2").Return(nil)
+	taskIDs, err = s.taskManager.Purge(context.Background(), "", "md5b", "")
+	c.Check(err, check.IsNil)
+	c.Check(taskIDs, check.DeepEquals, []string{"task2"})
+
+	// purge the tasks by url prefix
+	s.mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": "task1"}).Return(nil, nil)
+	s.mockProgressMgr.EXPECT().DeleteProgressByTaskID(gomock.Any(), "task1").Return(nil)
+	s.mockCDNMgr.EXPECT().Delete(gomock.Any(), "task1").Return(nil)
+	taskIDs, err = s.taskManager.Purge(context.Background(), "http://aa.bb.com/foo/*", "", "")
+	c.Check(err, check.IsNil)
+	c.Check(taskIDs, check.DeepEquals, []string{"task1"})
+
+	// nothing matches
+	taskIDs, err = s.taskManager.Purge(context.Background(), "http://aa.bb.com/foo/*", "", "")
+	c.Check(err, check.IsNil)
+	c.Check(taskIDs, check.HasLen, 0)
+}
+
+func (s *TaskMgrTestSuite) TestAbandonExpiredTask(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockDfgetTaskMgr := mock.NewMockDfgetTaskMgr(mockCtl)
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	mockProgressMgr.EXPECT().RecordTaskEvent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockProgressMgr.EXPECT().NotifyTask(gomock.Any(), gomock.Any()).AnyTimes()
+	taskManager, _ := NewManager(config.NewConfig(), s.mockPeerMgr, mockDfgetTaskMgr,
+		mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+
+	task := &types.TaskInfo{ID: "expiredTask", CdnStatus: types.TaskInfoCdnStatusFAILED}
+	taskManager.taskStore.Put(task.ID, task)
+
+	mockCDNMgr.EXPECT().TriggerCDN(gomock.Any(), task).Return(
+		&types.TaskInfo{CdnStatus: types.TaskInfoCdnStatusFAILED},
+		errors.Wrapf(errortypes.ErrTaskExpired, "taskID: %s", task.ID))
+	mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": task.ID}).
+		Return([]*types.DfGetTask{{CID: "cid", TaskID: task.ID}}, nil)
+	mockProgressMgr.EXPECT().DeletePieceProgressByCID(gomock.Any(), task.ID, "cid").Return(nil)
+	mockDfgetTaskMgr.EXPECT().Delete(gomock.Any(), "cid", task.ID).Return(nil)
+	mockProgressMgr.EXPECT().DeleteProgressByTaskID(gomock.Any(), task.ID).Return(nil)
+	mockCDNMgr.EXPECT().Delete(gomock.Any(), task.ID).Return(nil)
+
+	c.Assert(taskManager.triggerCdnSyncAction(context.Background(), task), check.IsNil)
+	for i := 0; i < 100; i++ {
+		if _, err := taskManager.Get(context.Background(), task.ID); errortypes.IsDataNotFound(err) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err := taskManager.Get(context.Background(), task.ID)
+	c.Assert(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	// the attached client is failed with the reason
+	mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "cid", task.ID).Return(nil, errortypes.ErrDataNotFound)
+	_, _, err = taskManager.GetPieces(context.Background(), task.ID, "cid", &types.PiecePullRequest{
+		DfgetTaskStatus: types.PiecePullRequestDfgetTaskStatusRUNNING,
+		PieceResult:     types.PiecePullRequestPieceResultSUCCESS,
+	})
+	c.Check(errortypes.IsTaskExpired(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestDetachInactiveClient(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockDfgetTaskMgr := mock.NewMockDfgetTaskMgr(mockCtl)
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	cfg := config.NewConfig()
+	cfg.ClientProgressTimeout = time.Hour
+	taskManager, _ := NewManager(cfg, s.mockPeerMgr, mockDfgetTaskMgr,
+		mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+
+	taskID := "inactiveTask"
+	for _, clientID := range []string{"activeCID", "inactiveCID", "finishedCID", "goneCID"} {
+		taskManager.touchClient(taskID, clientID)
+	}
+	for _, clientID := range []string{"inactiveCID", "finishedCID", "goneCID"} {
+		v, err := taskManager.clientActivities.Get(generatePurgedClientKey(taskID, clientID))
+		c.Assert(err, check.IsNil)
+		v.(*clientActivity).lastActive = time.Now().Add(-2 * time.Hour)
+	}
+
+	// only the inactive client which is still downloading is detached
+	mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "inactiveCID", taskID).
+		Return(&types.DfGetTask{CID: "inactiveCID", TaskID: taskID, Status: types.DfGetTaskStatusRUNNING}, nil)
+	mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "finishedCID", taskID).
+		Return(&types.DfGetTask{CID: "finishedCID", TaskID: taskID, Status: types.DfGetTaskStatusSUCCESS}, nil)
+	mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "goneCID", taskID).Return(nil, errortypes.ErrDataNotFound)
+	mockProgressMgr.EXPECT().DeletePieceProgressByCID(gomock.Any(), taskID, "inactiveCID").Return(nil)
+	mockDfgetTaskMgr.EXPECT().Delete(gomock.Any(), "inactiveCID", taskID).Return(nil)
+	taskManager.reapInactiveClients(context.Background())
+
+	c.Check(taskManager.clientActivities.ListKeyAsStringSlice(), check.DeepEquals,
+		[]string{generatePurgedClientKey(taskID, "activeCID")})
+	c.Check(int(prom_testutil.ToFloat64(taskManager.metrics.inactiveClientsDetached.WithLabelValues())), check.Equals, 1)
+
+	// the detached client is required to register again
+	mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "inactiveCID", taskID).Return(nil, errortypes.ErrDataNotFound)
+	_, _, err := taskManager.GetPieces(context.Background(), taskID, "inactiveCID", &types.PiecePullRequest{
+		DfgetTaskStatus: types.PiecePullRequestDfgetTaskStatusRUNNING,
+		PieceResult:     types.PiecePullRequestPieceResultSUCCESS,
+	})
+	c.Check(errortypes.IsClientInactive(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestRenewClient(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockDfgetTaskMgr := mock.NewMockDfgetTaskMgr(mockCtl)
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	cfg := config.NewConfig()
+	cfg.ClientProgressTimeout = time.Hour
+	taskManager, _ := NewManager(cfg, s.mockPeerMgr, mockDfgetTaskMgr,
+		mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+
+	taskID := "slowTask"
+	key := generatePurgedClientKey(taskID, "slowCID")
+	taskManager.touchClient(taskID, "slowCID")
+	v, err := taskManager.clientActivities.Get(key)
+	c.Assert(err, check.IsNil)
+	activity := v.(*clientActivity)
+	activity.lastActive = time.Now().Add(-2 * time.Hour)
+
+	// the client busy past the timeout renews its lease without pulling the pieces
+	mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "slowCID", taskID).
+		Return(&types.DfGetTask{CID: "slowCID", TaskID: taskID, Status: types.DfGetTaskStatusRUNNING}, nil)
+	c.Assert(taskManager.RenewClient(context.Background(), taskID, "slowCID"), check.IsNil)
+
+	// so it's not detached
+	taskManager.reapInactiveClients(context.Background())
+	c.Check(taskManager.clientActivities.ListKeyAsStringSlice(), check.DeepEquals, []string{key})
+	c.Check(int(prom_testutil.ToFloat64(taskManager.metrics.inactiveClientsDetached.WithLabelValues())), check.Equals, 0)
+
+	// even if it was found inactive right before renewing
+	c.Assert(taskManager.detachClient(context.Background(), taskID, "slowCID"), check.IsNil)
+	c.Check(taskManager.clientActivities.ListKeyAsStringSlice(), check.DeepEquals, []string{key})
+
+	// and the detached client is told to register again
+	taskManager.taskPurgedClients.Add(generatePurgedClientKey(taskID, "goneCID"), errortypes.ErrClientInactive)
+	taskManager.touchClient(taskID, "goneCID")
+	c.Check(taskManager.clientActivities.ListKeyAsStringSlice(), check.DeepEquals, []string{key})
+	mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "goneCID", taskID).Return(nil, errortypes.ErrDataNotFound)
+	err = taskManager.RenewClient(context.Background(), taskID, "goneCID")
+	c.Check(errortypes.IsClientInactive(err), check.Equals, true)
+	mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "unknownCID", taskID).Return(nil, errortypes.ErrDataNotFound)
+	err = taskManager.RenewClient(context.Background(), taskID, "unknownCID")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestTagTasks(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockOriginClient := cMock.NewMockOriginHTTPClient(mockCtl)
+	mockCDNMgr.EXPECT().GetPieceSize(gomock.Any(), gomock.Any()).Return(int32(0), nil).AnyTimes()
+	mockOriginClient.EXPECT().GetContentLength(gomock.Any(), gomock.Any()).Return(int64(1000), 200, nil).AnyTimes()
+	cfg := config.NewConfig()
+	cfg.MaxTaskTags = 3
+	taskManager, _ := NewManager(cfg, s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, mockOriginClient, prometheus.NewRegistry())
+
+	fooTask, err := taskManager.addOrUpdateTask(context.Background(), &types.TaskCreateRequest{
+		RawURL: "http://aa.bb.com/foo",
+		Tags:   []string{"release", "foo", "release"},
+	}, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(fooTask.Tags, check.DeepEquals, []string{"release", "foo"})
+	barTask, err := taskManager.addOrUpdateTask(context.Background(), &types.TaskCreateRequest{
+		RawURL: "http://aa.bb.com/bar",
+		Tags:   []string{"release"},
+	}, 0)
+	c.Assert(err, check.IsNil)
+	_, err = taskManager.addOrUpdateTask(context.Background(), &types.TaskCreateRequest{
+		RawURL: "http://aa.bb.com/baz",
+	}, 0)
+	c.Assert(err, check.IsNil)
+
+	// the tags of the following registrations are merged up to the limit
+	task, err := taskManager.addOrUpdateTask(context.Background(), &types.TaskCreateRequest{
+		RawURL: "http://aa.bb.com/foo",
+		Tags:   []string{"foo", "bar", "baz"},
+	}, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(task.ID, check.Equals, fooTask.ID)
+	c.Check(task.Tags, check.DeepEquals, []string{"release", "foo", "bar"})
+
+	// list the tasks by tag
+	tasks, err := taskManager.List(context.Background(), map[string]string{"tag": "release"})
+	c.Check(err, check.IsNil)
+	c.Check(tasks, check.HasLen, 2)
+	tasks, err = taskManager.List(context.Background(), map[string]string{"tag": "bar"})
+	c.Check(err, check.IsNil)
+	c.Check(tasks, check.DeepEquals, []*types.TaskInfo{fooTask})
+	tasks, err = taskManager.List(context.Background(), map[string]string{"tag": "baz"})
+	c.Check(err, check.IsNil)
+	c.Check(tasks, check.HasLen, 0)
+
+	// the deleted task is removed from the index
+	c.Check(taskManager.Delete(context.Background(), fooTask.ID), check.IsNil)
+	c.Check(taskManager.tagIndex.list("release"), check.DeepEquals, []string{barTask.ID})
+	c.Check(taskManager.tagIndex.list("foo"), check.HasLen, 0)
+}
+
+func (s *TaskMgrTestSuite) TestPurgeByTag(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockDfgetTaskMgr := mock.NewMockDfgetTaskMgr(mockCtl)
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	mockProgressMgr.EXPECT().RecordTaskEvent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	taskManager, _ := NewManager(config.NewConfig(), s.mockPeerMgr, mockDfgetTaskMgr,
+		mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+
+	tasks := []*types.TaskInfo{
+		{ID: "task1", RawURL: "http://aa.bb.com/1", Tags: []string{"release"}},
+		{ID: "task2", RawURL: "http://aa.bb.com/2", Tags: []string{"release", "foo"}},
+		{ID: "task3", RawURL: "http://aa.bb.com/3", Tags: []string{"foo"}},
+	}
+	for _, task := range tasks {
+		taskManager.taskStore.Put(task.ID, task)
+		taskManager.tagIndex.add(task.ID, task.Tags)
+	}
+
+	// purge all the tasks with the tag and detach the clients
+	mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": "task1"}).
+		Return([]*types.DfGetTask{{CID: "cid1", TaskID: "task1"}}, nil)
+	mockProgressMgr.EXPECT().DeletePieceProgressByCID(gomock.Any(), "task1", "cid1").Return(nil)
+	mockDfgetTaskMgr.EXPECT().Delete(gomock.Any(), "cid1", "task1").Return(nil)
+	mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": "task2"}).Return(nil, nil)
+	for _, taskID := range []string{"task1", "task2"} {
+		mockProgressMgr.EXPECT().DeleteProgressByTaskID(gomock.Any(), taskID).Return(nil)
+		mockCDNMgr.EXPECT().Delete(gomock.Any(), taskID).Return(nil)
+	}
+	taskIDs, err := taskManager.Purge(context.Background(), "", "", "release")
+	c.Check(err, check.IsNil)
+	c.Check(taskIDs, check.DeepEquals, []string{"task1", "task2"})
+	c.Check(taskManager.tagIndex.list("release"), check.HasLen, 0)
+	c.Check(taskManager.tagIndex.list("foo"), check.DeepEquals, []string{"task3"})
+	_, err = taskManager.Get(context.Background(), "task3")
+	c.Check(err, check.IsNil)
+
+	// nothing matches
+	taskIDs, err = taskManager.Purge(context.Background(), "", "", "release")
+	c.Check(err, check.IsNil)
+	c.Check(taskIDs, check.HasLen, 0)
+}
+
+func (s *TaskMgrTestSuite) TestPurgeSkipsPinnedTasks(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockDfgetTaskMgr := mock.NewMockDfgetTaskMgr(mockCtl)
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	mockProgressMgr.EXPECT().RecordTaskEvent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	cfg := config.NewConfig()
+	cfg.PinnedOriginMetadata = []string{"x-content-class=golden"}
+	taskManager, err := NewManager(cfg, s.mockPeerMgr, mockDfgetTaskMgr,
+		mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	tasks := []*types.TaskInfo{
+		{ID: "task1", RawURL: "http://aa.bb.com/1", Tags: []string{"release"},
+			OriginMetadata: map[string]string{"X-Content-Class": "golden"}},
+		{ID: "task2", RawURL: "http://aa.bb.com/2", Tags: []string{"release"},
+			OriginMetadata: map[string]string{"X-Content-Class": "scratch"}},
+		{ID: "task3", RawURL: "http://aa.bb.com/3", Tags: []string{"release"}},
+	}
+	for _, task := range tasks {
+		taskManager.taskStore.Put(task.ID, task)
+		taskManager.tagIndex.add(task.ID, task.Tags)
+	}
+
+	// the pinned task is never evicted
+	for _, taskID := range []string{"task2", "task3"} {
+		mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": taskID}).Return(nil, nil)
+		mockProgressMgr.EXPECT().DeleteProgressByTaskID(gomock.Any(), taskID).Return(nil)
+		mockCDNMgr.EXPECT().Delete(gomock.Any(), taskID).Return(nil)
+	}
+	taskIDs, err := taskManager.Purge(context.Background(), "", "", "release")
+	c.Check(err, check.IsNil)
+	c.Check(taskIDs, check.DeepEquals, []string{"task2", "task3"})
+	_, err = taskManager.Get(context.Background(), "task1")
+	c.Check(err, check.IsNil)
+	c.Check(taskManager.tagIndex.list("release"), check.DeepEquals, []string{"task1"})
+
+	// the pinned metadata must be in the form of Name=value
+	cfg.PinnedOriginMetadata = []string{"X-Content-Class"}
+	_, err = NewManager(cfg, s.mockPeerMgr, mockDfgetTaskMgr,
+		mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestListByOriginMetadata(c *check.C) {
+	taskManager, _ := NewManager(config.NewConfig(), s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+	tasks := []*types.TaskInfo{
+		{ID: "task1", OriginMetadata: map[string]string{"X-Content-Class": "golden", "X-Owner": "team-a"}},
+		{ID: "task2", OriginMetadata: map[string]string{"X-Content-Class": "scratch", "X-Owner": "team-a"}},
+		{ID: "task3"},
+	}
+	for _, task := range tasks {
+		taskManager.taskStore.Put(task.ID, task)
+	}
+
+	var cases = []struct {
+		metadata string
+		expected []string
+	}{
+		{metadata: "X-Content-Class=golden", expected: []string{"task1"}},
+		{metadata: "x-owner=team-a", expected: []string{"task1", "task2"}},
+		{metadata: "X-Owner=team-b", expected: []string{}},
+	}
+	for _, tc := range cases {
+		result, err := taskManager.List(context.Background(), map[string]string{"metadata": tc.metadata})
+		c.Assert(err, check.IsNil)
+		taskIDs := make([]string, 0, len(result))
+		for _, task := range result {
+			taskIDs = append(taskIDs, task.ID)
+		}
+		sort.Strings(taskIDs)
+		c.Check(taskIDs, check.DeepEquals, tc.expected, check.Commentf("metadata: %s", tc.metadata))
+	}
+
+	_, err := taskManager.List(context.Background(), map[string]string{"metadata": "=golden"})
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestCancelByTag(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	taskManager, _ := NewManager(config.NewConfig(), s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+
+	_, err := taskManager.Cancel(context.Background(), "")
+	c.Check(errortypes.IsEmptyValue(err), check.Equals, true)
+
+	taskManager.tagIndex.add("running", []string{"release"})
+	taskManager.tagIndex.add("finished", []string{"release"})
+	mockCDNMgr.EXPECT().Cancel(gomock.Any(), "running").Return(nil)
+	mockCDNMgr.EXPECT().Cancel(gomock.Any(), "finished").Return(errortypes.ErrDataNotFound)
+
+	// only the tasks whose CDN is running are canceled
+	taskIDs, err := taskManager.Cancel(context.Background(), "release")
+	c.Check(err, check.IsNil)
+	c.Check(taskIDs, check.DeepEquals, []string{"running"})
+}
+
+func (s *TaskMgrTestSuite) TestPartialCompletion(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockDfgetTaskMgr := mock.NewMockDfgetTaskMgr(mockCtl)
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	mockPeerMgr := mock.NewMockPeerMgr(mockCtl)
+	mockSchedulerMgr := mock.NewMockSchedulerMgr(mockCtl)
+	taskManager, _ := NewManager(config.NewConfig(), mockPeerMgr, mockDfgetTaskMgr,
+		mockProgressMgr, s.mockCDNMgr, mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+	mockPeerMgr.EXPECT().Get(gomock.Any(), gomock.Any()).Return(&types.PeerInfo{IP: "127.0.0.1"}, nil).AnyTimes()
+	mockSchedulerMgr.EXPECT().Schedule(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+	// the content of each piece is 1000 bytes, and the CDN is still downloading the tail pieces
+	task := &types.TaskInfo{
+		ID:               "partialTask",
+		CdnStatus:        types.TaskInfoCdnStatusRUNNING,
+		CompletionPolicy: types.TaskInfoCompletionPolicyPartial,
+		HTTPFileLength:   10000,
+		PieceSize:        1000 + config.PieceWrapSize,
+		PieceTotal:       10,
+	}
+	prefixTask := &types.DfGetTask{CID: "prefixCID", TaskID: task.ID, RequiredRange: "0-2499"}
+	fullTask := &types.DfGetTask{CID: "fullCID", TaskID: task.ID}
+
+	// the client isn't released until the pieces covering the required prefix are downloaded
+	mockProgressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), task.ID, "prefixCID", "success").Return([]int{0, 1}, nil)
+	finished, _, err := taskManager.parseAvailablePeers(context.Background(), "prefixCID", task, prefixTask)
+	c.Assert(err, check.IsNil)
+	c.Check(finished, check.Equals, false)
+
+	mockProgressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), task.ID, "prefixCID", "success").Return([]int{0, 1, 2}, nil)
+	mockDfgetTaskMgr.EXPECT().UpdateStatus(gomock.Any(), "prefixCID", task.ID, types.DfGetTaskStatusSUCCESS).Return(nil)
+	finished, data, err := taskManager.parseAvailablePeers(context.Background(), "prefixCID", task, prefixTask)
+	c.Assert(err, check.IsNil)
+	c.Check(finished, check.Equals, true)
+	c.Check(data.(map[string]interface{})["partial"], check.Equals, true)
+
+	// while the client requiring the whole file keeps downloading
+	mockProgressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), task.ID, "fullCID", "success").Return([]int{0, 1, 2}, nil)
+	finished, _, err = taskManager.parseAvailablePeers(context.Background(), "fullCID", task, fullTask)
+	c.Assert(err, check.IsNil)
+	c.Check(finished, check.Equals, false)
+
+	// and the required range is ignored if the task isn't completed partially
+	task.CompletionPolicy = types.TaskInfoCompletionPolicyFull
+	mockProgressMgr.EXPECT().GetPieceProgressByCID(gomock.Any(), task.ID, "prefixCID", "success").Return([]int{0, 1, 2}, nil)
+	finished, _, err = taskManager.parseAvailablePeers(context.Background(), "prefixCID", task, prefixTask)
+	c.Assert(err, check.IsNil)
+	c.Check(finished, check.Equals, false)
+}
+
+func (s *TaskMgrTestSuite) TestRequiredPieceRange(c *check.C) {
+	task := &types.TaskInfo{
+		CompletionPolicy: types.TaskInfoCompletionPolicyPartial,
+		HTTPFileLength:   10000,
+		PieceSize:        1000 + config.PieceWrapSize,
+		PieceTotal:       10,
+	}
+	var cases = []struct {
+		requiredRange string
+		startNum      int
+		endNum        int
+		ok            bool
+	}{
+		{requiredRange: "", ok: false},
+		{requiredRange: "foo", ok: false},
+		{requiredRange: "0-0", startNum: 0, endNum: 0, ok: true},
+		{requiredRange: "1500-3000", startNum: 1, endNum: 3, ok: true},
+		{requiredRange: "9500-20000", startNum: 9, endNum: 9, ok: true},
+		{requiredRange: "10000-20000", ok: false},
+	}
+
+	for _, v := range cases {
+		startNum, endNum, ok := requiredPieceRange(task, v.requiredRange)
+		c.Check(ok, check.Equals, v.ok, check.Commentf("range: %s", v.requiredRange))
+		if v.ok {
+			c.Check(startNum, check.Equals, v.startNum)
+			c.Check(endNum, check.Equals, v.endNum)
+		}
+	}
+}
+
+func (s *TaskMgrTestSuite) TestScrubCorruptedTasks(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockDfgetTaskMgr := mock.NewMockDfgetTaskMgr(mockCtl)
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	mockProgressMgr.EXPECT().RecordTaskEvent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	taskManager, _ := NewManager(config.NewConfig(), s.mockPeerMgr, mockDfgetTaskMgr,
+		mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+	taskManager.cfg.ScrubInterval = time.Hour
+	corrupted := errors.Wrapf(errortypes.ErrContentCorrupted, "piece 1")
+	for _, task := range []*types.TaskInfo{
+		{ID: "intactTask", CdnStatus: types.TaskInfoCdnStatusSUCCESS},
+		{ID: "corruptedTask", CdnStatus: types.TaskInfoCdnStatusSUCCESS},
+		{ID: "accessedTask", CdnStatus: types.TaskInfoCdnStatusSUCCESS},
+		{ID: "runningTask", CdnStatus: types.TaskInfoCdnStatusRUNNING},
+	} {
+		taskManager.taskStore.Put(task.ID, task)
+	}
+	taskManager.accessTimeMap.Add("intactTask", timeutils.GetCurrentTimeMillis()-int64(2*time.Hour/time.Millisecond))
+	taskManager.accessTimeMap.Add("accessedTask", timeutils.GetCurrentTimeMillis())
+
+	// only the idle successful tasks are verified, and the corrupted one is evicted
+	mockCDNMgr.EXPECT().VerifyFile(gomock.Any(), "intactTask").Return(nil)
+	mockCDNMgr.EXPECT().VerifyFile(gomock.Any(), "corruptedTask").Return(corrupted)
+	mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": "corruptedTask"}).
+		Return([]*types.DfGetTask{{CID: "cid", TaskID: "corruptedTask"}}, nil)
+	mockProgressMgr.EXPECT().DeletePieceProgressByCID(gomock.Any(), "corruptedTask", "cid").Return(nil)
+	mockDfgetTaskMgr.EXPECT().Delete(gomock.Any(), "cid", "corruptedTask").Return(nil)
+	mockProgressMgr.EXPECT().DeleteProgressByTaskID(gomock.Any(), "corruptedTask").Return(nil)
+	mockCDNMgr.EXPECT().Delete(gomock.Any(), "corruptedTask").Return(nil)
+	taskManager.scrub(context.Background())
+
+	_, err := taskManager.Get(context.Background(), "corruptedTask")
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+	for _, taskID := range []string{"intactTask", "accessedTask", "runningTask"} {
+		_, err := taskManager.Get(context.Background(), taskID)
+		c.Check(err, check.IsNil)
+	}
+	c.Check(int(prom_testutil.ToFloat64(
+		taskManager.metrics.corruptedTasksEvicted.WithLabelValues(corruptionDetectorScrub))), check.Equals, 1)
+
+	// the client is told that the task is purged for the corruption
+	mockDfgetTaskMgr.EXPECT().Get(gomock.Any(), "cid", "corruptedTask").Return(nil, errortypes.ErrDataNotFound)
+	_, _, err = taskManager.GetPieces(context.Background(), "corruptedTask", "cid", &types.PiecePullRequest{
+		DfgetTaskStatus: types.PiecePullRequestDfgetTaskStatusRUNNING,
+		PieceResult:     types.PiecePullRequestPieceResultSUCCESS,
+	})
+	c.Check(errortypes.IsTaskPurged(err), check.Equals, true)
+
+	// the task is evicted only for the corruption
+	err = taskManager.EvictCorrupted(context.Background(), "intactTask", errortypes.ErrDataNotFound)
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *TaskMgrTestSuite) TestReclaimOrphans(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	taskManager, _ := NewManager(config.NewConfig(), s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+	taskManager.taskStore.Put("knownTask", &types.TaskInfo{ID: "knownTask"})
+
+	// the files of the tasks known by supernode are never reclaimed
+	mockCDNMgr.EXPECT().ReclaimOrphans(gomock.Any(), taskManager.cfg.OrphanGracePeriod, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, gracePeriod time.Duration, isKnown func(string) bool) (int, int64, error) {
+			c.Check(isKnown("knownTask"), check.Equals, true)
+			c.Check(isKnown("orphanedTask"), check.Equals, false)
+			return 2, 100, nil
+		})
+	taskManager.reclaimOrphans(context.Background())
+	c.Check(int(prom_testutil.ToFloat64(taskManager.metrics.orphanedFilesReclaimed.WithLabelValues())), check.Equals, 2)
+	c.Check(int(prom_testutil.ToFloat64(taskManager.metrics.orphanedBytesReclaimed.WithLabelValues())), check.Equals, 100)
+}
+
+func (s *TaskMgrTestSuite) TestEnsureConsistency(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockDfgetTaskMgr := mock.NewMockDfgetTaskMgr(mockCtl)
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	mockProgressMgr.EXPECT().RecordTaskEvent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockOriginClient := cMock.NewMockOriginHTTPClient(mockCtl)
+	mockCDNMgr.EXPECT().GetPieceSize(gomock.Any(), gomock.Any()).Return(int32(0), nil).AnyTimes()
+	mockOriginClient.EXPECT().GetContentLength(gomock.Any(), gomock.Any()).Return(int64(1000), 200, nil).AnyTimes()
+	taskManager, _ := NewManager(config.NewConfig(), s.mockPeerMgr, mockDfgetTaskMgr,
+		mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, mockOriginClient, prometheus.NewRegistry())
+	ctx := context.Background()
+	expectPurge := func(taskID string) {
+		// the clients are listed to check none is downloading the task before it's purged
+		mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": taskID}).Return(nil, nil).Times(2).Times(2)
+		mockProgressMgr.EXPECT().DeleteProgressByTaskID(gomock.Any(), taskID).Return(nil)
+		mockCDNMgr.EXPECT().Delete(gomock.Any(), taskID).Return(nil)
+	}
+
+	req := &types.TaskCreateRequest{RawURL: "http://aa.bb.com/consistency"}
+	task, err := taskManager.addOrUpdateTask(ctx, req, 0)
+	c.Assert(err, check.IsNil)
+	task.CdnStatus = types.TaskInfoCdnStatusSUCCESS
+
+	// the cached content is attached without contacting the source with cached-ok
+	req.Consistency = types.TaskCreateRequestConsistencyCachedOk
+	result, revalidated, err := taskManager.ensureConsistency(ctx, req, task, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(result, check.Equals, task)
+	c.Check(revalidated, check.Equals, false)
+
+	// the source is revalidated with revalidate, and the cached content is attached if it's not modified
+	req.Consistency = types.TaskCreateRequestConsistencyRevalidate
+	mockCDNMgr.EXPECT().Revalidate(gomock.Any(), task).Return(true, nil)
+	result, revalidated, err = taskManager.ensureConsistency(ctx, req, task, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(result, check.Equals, task)
+	c.Check(revalidated, check.Equals, true)
+
+	// the cached content is not attached if the source fails to be revalidated
+	mockCDNMgr.EXPECT().Revalidate(gomock.Any(), task).Return(false, errortypes.ErrURLNotReachable)
+	_, _, err = taskManager.ensureConsistency(ctx, req, task, 0)
+	c.Check(errortypes.IsURLNotReachable(err), check.Equals, true)
+
+	// but the task is downloaded again if it's modified
+	mockCDNMgr.EXPECT().Revalidate(gomock.Any(), task).Return(false, nil)
+	expectPurge(task.ID)
+	result, revalidated, err = taskManager.ensureConsistency(ctx, req, task, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(result != task, check.Equals, true)
+	c.Check(result.ID, check.Equals, task.ID)
+	c.Check(result.CdnStatus, check.Equals, types.TaskInfoCdnStatusWAITING)
+	c.Check(result.Consistency, check.Equals, types.TaskInfoConsistencyRevalidate)
+	c.Check(revalidated, check.Equals, false)
+
+	// the task is always downloaded again with always-fresh
+	task = result
+	task.CdnStatus = types.TaskInfoCdnStatusSUCCESS
+	req.Consistency = types.TaskCreateRequestConsistencyAlwaysFresh
+	req.CID = "cid"
+
+	// but not while other clients are downloading it, which would be detached by the purge
+	mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": task.ID}).Return([]*types.DfGetTask{
+		{CID: "cid", TaskID: task.ID, Status: types.DfGetTaskStatusRUNNING},
+		{CID: "otherCID", TaskID: task.ID, Status: types.DfGetTaskStatusRUNNING},
+	}, nil)
+	_, _, err = taskManager.ensureConsistency(ctx, req, task, 0)
+	c.Check(errortypes.IsTaskBusy(err), check.Equals, true)
+	current, err := taskManager.getTask(task.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(current, check.Equals, task)
+
+	expectPurge(task.ID)
+	result, _, err = taskManager.ensureConsistency(ctx, req, task, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(result != task, check.Equals, true)
+	c.Check(result.CdnStatus, check.Equals, types.TaskInfoCdnStatusWAITING)
+	c.Check(result.Consistency, check.Equals, types.TaskInfoConsistencyAlwaysFresh)
+
+	// and the task to be downloaded detects its cache as the level of the registration triggering it
+	req.Consistency = types.TaskCreateRequestConsistencyCachedOk
+	task = result
+	result, _, err = taskManager.ensureConsistency(ctx, req, task, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(result, check.Equals, task)
+	c.Check(result.Consistency, check.Equals, types.TaskInfoConsistencyCachedOk)
+
+	// the unknown level is rejected
+	c.Check(errortypes.IsInvalidValue(validateParams(&types.TaskCreateRequest{
+		RawURL:      "http://aa.bb.com/consistency",
+		Path:        "/peer/file/taskFileName",
+		CID:         "cid",
+		PeerID:      "peerID",
+		Consistency: "eventual",
+	})), check.Equals, true)
+}
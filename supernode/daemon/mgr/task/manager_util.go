@@ -20,6 +20,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
@@ -30,8 +32,10 @@ import (
 	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
 	"github.com/dragonflyoss/Dragonfly/supernode/util"
 
+	"github.com/go-openapi/strfmt"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -42,7 +46,12 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 	if stringutils.IsEmptyStr(req.TaskURL) {
 		taskURL = netutils.FilterURLParam(req.RawURL, req.Filter)
 	}
-	taskID := generateTaskID(taskURL, req.Md5, req.Identifier)
+	taskURL = applyQueryRules(taskURL, tm.cfg.TaskIDQueryRules)
+	taskID := generateTaskIDWithHeaders(taskURL, req.Md5, req.Identifier, req.Headers, tm.cfg.TaskIDHeaders)
+
+	if reason := tm.getPoisonedReason(taskID); reason != nil {
+		return nil, reason
+	}
 
 	if key, err := tm.taskURLUnReachableStore.Get(taskID); err == nil {
 		if unReachableStartTime, ok := key.(time.Time); ok &&
@@ -53,6 +62,16 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 		tm.taskURLUnReachableStore.Delete(taskID)
 	}
 
+	// the registrations of the task merged into a canonical one join the canonical task
+	if canonical := tm.getCanonicalTask(taskID); canonical != nil {
+		tm.taskLocker.GetLock(canonical.ID, false)
+		defer tm.taskLocker.ReleaseLock(canonical.ID, false)
+		canonical.Tags = mergeTags(canonical.ID, canonical.Tags, req.Tags, tm.cfg.MaxTaskTags)
+		tm.tagIndex.add(canonical.ID, canonical.Tags)
+		logrus.Debugf("redirect the registration of taskID(%s) to the canonical taskID(%s)", taskID, canonical.ID)
+		return canonical, nil
+	}
+
 	// using the existing task if it already exists corresponding to taskID
 	var task *types.TaskInfo
 	newTask := &types.TaskInfo{
@@ -64,6 +83,11 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 		TaskURL:    taskURL,
 		CdnStatus:  types.TaskInfoCdnStatusWAITING,
 		PieceTotal: -1,
+		CreateTime: strfmt.DateTime(time.Now()),
+
+		CompletionPolicy: req.CompletionPolicy,
+		Consistency:      req.Consistency,
+		DigestAlgorithm:  tm.getDigestAlgorithm(req),
 	}
 
 	if v, err := tm.taskStore.Get(taskID); err == nil {
@@ -78,6 +102,13 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 	tm.taskLocker.GetLock(taskID, false)
 	defer tm.taskLocker.ReleaseLock(taskID, false)
 
+	// the tags of the registrations are merged into the task,
+	// and the existing task is indexed by the new tags at once.
+	task.Tags = mergeTags(taskID, task.Tags, req.Tags, tm.cfg.MaxTaskTags)
+	if task != newTask {
+		tm.tagIndex.add(taskID, task.Tags)
+	}
+
 	if task.FileLength != 0 {
 		return task, nil
 	}
@@ -87,11 +118,19 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 	if err != nil {
 		logrus.Errorf("failed to get file length from http client for taskID(%s): %v", taskID, err)
 
+		// the CDN won't be triggered to release the state of the requests to the source
+		// if the registration fails.
 		if errortypes.IsURLNotReachable(err) {
-			tm.taskURLUnReachableStore.Add(taskID, time.Now())
+			httpclient.ReleaseTask(tm.OriginClient, taskID)
+			// remember the failure for a short while so that the following
+			// registrations of the same URL fail fast without re-querying the source.
+			if failAccessInterval > 0 {
+				tm.taskURLUnReachableStore.Add(taskID, time.Now())
+			}
 			return nil, err
 		}
 		if errortypes.IsAuthenticationRequired(err) {
+			httpclient.ReleaseTask(tm.OriginClient, taskID)
 			return nil, err
 		}
 	}
@@ -105,11 +144,17 @@ func (tm *Manager) addOrUpdateTask(ctx context.Context, req *types.TaskCreateReq
 	}
 
 	// calculate piece size and update the PieceSize and PieceTotal
-	pieceSize := computePieceSize(fileLength)
+	pieceSize, err := tm.getPieceSize(ctx, task, fileLength)
+	if err != nil {
+		logrus.Errorf("failed to get the piece size for taskID(%s): %v", taskID, err)
+		httpclient.ReleaseTask(tm.OriginClient, taskID)
+		return nil, err
+	}
 	task.PieceSize = pieceSize
 	task.PieceTotal = int32((fileLength + (int64(pieceSize) - 1)) / int64(pieceSize))
 
 	tm.taskStore.Put(taskID, task)
+	tm.tagIndex.add(taskID, task.Tags)
 	tm.metrics.tasks.WithLabelValues(task.CdnStatus).Inc()
 	return task, nil
 }
@@ -165,6 +210,7 @@ func (tm *Manager) updateTask(taskID string, updateTaskInfo *types.TaskInfo) err
 		tm.metrics.tasks.WithLabelValues(task.CdnStatus).Dec()
 		tm.metrics.tasks.WithLabelValues(updateTaskInfo.CdnStatus).Inc()
 		task.CdnStatus = updateTaskInfo.CdnStatus
+		tm.progressMgr.NotifyTask(context.Background(), taskID)
 		return nil
 	}
 
@@ -174,10 +220,28 @@ func (tm *Manager) updateTask(taskID string, updateTaskInfo *types.TaskInfo) err
 		task.FileLength = updateTaskInfo.FileLength
 	}
 
+	// the http file length is recomputed by CDN when the source
+	// doesn't send the bytes of its declared Content-Length.
+	if updateTaskInfo.HTTPFileLength > 0 {
+		task.HTTPFileLength = updateTaskInfo.HTTPFileLength
+	}
+
 	if !stringutils.IsEmptyStr(updateTaskInfo.RealMd5) {
 		task.RealMd5 = updateTaskInfo.RealMd5
 	}
 
+	if !stringutils.IsEmptyStr(updateTaskInfo.OriginalMd5) {
+		task.OriginalMd5 = updateTaskInfo.OriginalMd5
+	}
+
+	if !stringutils.IsEmptyStr(updateTaskInfo.Digest) {
+		task.Digest = updateTaskInfo.Digest
+	}
+
+	if len(updateTaskInfo.OriginMetadata) > 0 {
+		task.OriginMetadata = updateTaskInfo.OriginMetadata
+	}
+
 	var pieceTotal int32
 	if updateTaskInfo.FileLength > 0 {
 		pieceTotal = int32((updateTaskInfo.FileLength + int64(task.PieceSize-1)) / int64(task.PieceSize))
@@ -185,13 +249,31 @@ func (tm *Manager) updateTask(taskID string, updateTaskInfo *types.TaskInfo) err
 	if pieceTotal != 0 {
 		task.PieceTotal = pieceTotal
 	}
+	if !isSuccessCDN(task.CdnStatus) {
+		tm.updateFinishTime(task)
+	}
 	tm.metrics.tasks.WithLabelValues(task.CdnStatus).Dec()
 	tm.metrics.tasks.WithLabelValues(updateTaskInfo.CdnStatus).Inc()
 	task.CdnStatus = updateTaskInfo.CdnStatus
+	tm.progressMgr.NotifyTask(context.Background(), taskID)
 
 	return nil
 }
 
+// updateFinishTime records the time when the CDN of the task succeeded.
+// It should be called with the lock of the task held.
+func (tm *Manager) updateFinishTime(task *types.TaskInfo) {
+	finishTime := time.Now()
+	task.FinishTime = strfmt.DateTime(finishTime)
+	if time.Time(task.CreateTime).IsZero() {
+		return
+	}
+
+	duration := finishTime.Sub(time.Time(task.CreateTime))
+	tm.metrics.taskCompleteDurationSeconds.WithLabelValues().Observe(duration.Seconds())
+	logrus.Infof("taskID(%s) is completed after %v", task.ID, duration)
+}
+
 func (tm *Manager) addDfgetTask(ctx context.Context, req *types.TaskCreateRequest, task *types.TaskInfo) (*types.DfGetTask, error) {
 	dfgetTask := &types.DfGetTask{
 		CID:         req.CID,
@@ -203,6 +285,9 @@ func (tm *Manager) addDfgetTask(ctx context.Context, req *types.TaskCreateReques
 		TaskID:      task.ID,
 		PeerID:      req.PeerID,
 		SupernodeIP: req.SupernodeIP,
+
+		PieceOrder:    req.PieceOrder,
+		RequiredRange: req.RequiredRange,
 	}
 
 	if err := tm.dfgetTaskMgr.Add(ctx, dfgetTask); err != nil {
@@ -230,19 +315,93 @@ func (tm *Manager) triggerCdnSyncAction(ctx context.Context, task *types.TaskInf
 	}); err != nil {
 		return err
 	}
+	tm.recordTaskEvent(ctx, task.ID, mgr.TaskEventDownloadStarted, "")
 
+	tm.startCDN(ctx, task)
+	logrus.Infof("success to start cdn trigger for taskID: %s", task.ID)
+	return nil
+}
+
+// startCDN triggers the CDN of the task in the background and updates the task when it stops.
+func (tm *Manager) startCDN(ctx context.Context, task *types.TaskInfo) {
 	go func() {
 		updateTaskInfo, err := tm.cdnMgr.TriggerCDN(ctx, task)
 		tm.metrics.triggerCdnCount.WithLabelValues().Inc()
+		// the paused task keeps running with the pieces downloaded until it's resumed.
+		if errortypes.IsTaskPaused(err) {
+			logrus.Infof("taskID(%s) trigger cdn is paused: %v", task.ID, err)
+			return
+		}
+		tm.pausedTasks.Delete(task.ID)
 		if err != nil {
 			tm.metrics.triggerCdnFailCount.WithLabelValues().Inc()
 			logrus.Errorf("taskID(%s) trigger cdn get error: %v", task.ID, err)
 		}
 		tm.updateTask(task.ID, updateTaskInfo)
 		logrus.Infof("success to update task cdn %+v", updateTaskInfo)
+		if err != nil {
+			tm.recordTaskEvent(ctx, task.ID, mgr.TaskEventFailed, err.Error())
+		} else if updateTaskInfo != nil && isSuccessCDN(updateTaskInfo.CdnStatus) {
+			tm.recordTaskEvent(ctx, task.ID, mgr.TaskEventCompleted, "")
+		} else if updateTaskInfo != nil && isFrozen(updateTaskInfo.CdnStatus) {
+			tm.recordTaskEvent(ctx, task.ID, mgr.TaskEventFailed, updateTaskInfo.CdnStatus)
+		}
+		if errortypes.IsTaskExpired(err) || errortypes.IsTaskCanceled(err) {
+			tm.abandonTask(ctx, task.ID, err)
+			return
+		}
+		if tm.shouldPoison(err) {
+			tm.poisonTask(ctx, task.ID, err)
+			return
+		}
+		if updateTaskInfo != nil && isSuccessCDN(updateTaskInfo.CdnStatus) {
+			tm.warmHandoff(ctx, task.ID)
+			tm.mergeTask(ctx, task.ID)
+		}
 	}()
-	logrus.Infof("success to start cdn trigger for taskID: %s", task.ID)
-	return nil
+}
+
+// recordTaskEvent records the event into the history of the task,
+// and the failure is only logged since the history is for auditing and debugging.
+func (tm *Manager) recordTaskEvent(ctx context.Context, taskID, eventType, detail string) {
+	if err := tm.progressMgr.RecordTaskEvent(ctx, taskID, eventType, detail); err != nil {
+		logrus.Debugf("failed to record the event %s for taskID %s: %v", eventType, taskID, err)
+	}
+}
+
+// abandonTask abandons the incomplete task which has made no progress for the max task age
+// or whose CDN is canceled, so that it doesn't hold the downloaded file and the progress forever.
+func (tm *Manager) abandonTask(ctx context.Context, taskID string, reason error) {
+	if err := tm.purgeTask(ctx, taskID, reason); err != nil {
+		logrus.Errorf("failed to abandon taskID(%s): %v", taskID, err)
+		return
+	}
+	logrus.Warnf("success to abandon taskID(%s): %v", taskID, reason)
+}
+
+// warmHandoff spreads the pieces of the task among the clients waiting for it
+// when the CDN finishes, so that they become the sources of the other clients quickly.
+func (tm *Manager) warmHandoff(ctx context.Context, taskID string) {
+	if tm.cfg.WarmHandoffClients <= 0 {
+		return
+	}
+
+	dfgetTasks, err := tm.dfgetTaskMgr.List(ctx, map[string]string{"taskID": taskID})
+	if err != nil {
+		logrus.Warnf("failed to list dfgetTasks for warm handoff of taskID(%s): %v", taskID, err)
+		return
+	}
+	var clientIDs []string
+	for _, dfgetTask := range dfgetTasks {
+		if tm.cfg.IsSuperCID(dfgetTask.CID) || dfgetTask.Status == types.DfGetTaskStatusSUCCESS {
+			continue
+		}
+		clientIDs = append(clientIDs, dfgetTask.CID)
+	}
+
+	if err := tm.schedulerMgr.WarmHandoff(ctx, taskID, clientIDs); err != nil {
+		logrus.Warnf("failed to warm handoff for taskID(%s): %v", taskID, err)
+	}
 }
 
 func (tm *Manager) initCdnNode(ctx context.Context, task *types.TaskInfo) error {
@@ -283,6 +442,9 @@ func (tm *Manager) processTaskRunning(ctx context.Context, srcCID, srcPID string
 	if pieceNum == -1 {
 		return false, nil, errors.Wrapf(errortypes.ErrInvalidValue, "pieceRange: %s", req.PieceRange)
 	}
+	if err := validatePieceNum(task, pieceNum); err != nil {
+		return false, nil, err
+	}
 	pieceStatus, success := convertToPeerPieceStatus(req.PieceResult, req.DfgetTaskStatus)
 	if !success {
 		return false, nil, errors.Wrapf(errortypes.ErrInvalidValue, "failed to convert result: %s and status %s to pieceStatus", req.PieceResult, req.DfgetTaskStatus)
@@ -290,7 +452,7 @@ func (tm *Manager) processTaskRunning(ctx context.Context, srcCID, srcPID string
 
 	logrus.Debugf("start to update progress taskID (%s) srcCID (%s) srcPID (%s) dstPID (%s) pieceNum (%d) pieceStatus (%d)",
 		task.ID, srcCID, srcPID, req.DstPID, pieceNum, pieceStatus)
-	if err := tm.progressMgr.UpdateProgress(ctx, task.ID, srcCID, srcPID, req.DstPID, pieceNum, pieceStatus); err != nil {
+	if err := tm.progressMgr.UpdateProgress(ctx, task.ID, srcCID, srcPID, req.DstPID, pieceNum, pieceStatus, task.PieceSize); err != nil {
 		return false, nil, errors.Wrap(err, "failed to update progress")
 	}
 
@@ -335,12 +497,28 @@ func (tm *Manager) parseAvailablePeers(ctx context.Context, clientID string, tas
 		return true, finishInfo, nil
 	}
 
+	// the client of the task completed partially is finished with the pieces covering
+	// its required range, and the rest of the task continues in the background.
+	if isRequiredRangeDownloaded(task, dfgetTask, pieceSuccess) {
+		if err := tm.dfgetTaskMgr.UpdateStatus(ctx, clientID, task.ID, types.DfGetTaskStatusSUCCESS); err != nil {
+			logrus.Errorf("failed to update dfget task status with "+
+				"taskID(%s) clientID(%s) status(%s): %v", task.ID, clientID, types.DfGetTaskStatusSUCCESS, err)
+		}
+		logrus.Infof("clientID(%s) of taskID(%s) is finished with the required range %s",
+			clientID, task.ID, dfgetTask.RequiredRange)
+		finishInfo := make(map[string]interface{})
+		finishInfo["md5"] = task.Md5
+		finishInfo["fileLength"] = task.FileLength
+		finishInfo["partial"] = true
+		return true, finishInfo, nil
+	}
+
 	// Get peerName to represent peer in metrics.
 	peer, _ := tm.peerMgr.Get(context.Background(), dfgetTask.PeerID)
 	// get scheduler pieceResult
 	logrus.Debugf("start scheduler for taskID: %s clientID: %s", task.ID, clientID)
 	startTime := time.Now()
-	pieceResult, err := tm.schedulerMgr.Schedule(ctx, task.ID, clientID, dfgetTask.PeerID)
+	pieceResult, err := tm.schedulerMgr.Schedule(ctx, task.ID, clientID, dfgetTask.PeerID, dfgetTask.PieceOrder)
 	if err != nil {
 		return false, nil, err
 	}
@@ -391,6 +569,143 @@ func (tm *Manager) pieceResultToPieceInfo(ctx context.Context, pr *mgr.PieceResu
 	}, nil
 }
 
+// listTaskIDsToPurge returns the IDs of tasks whose url, digest or tag matches.
+// The tasks with the tag are looked up by the tag index,
+// and all the tasks are scanned only if the url or digest is specified.
+func (tm *Manager) listTaskIDsToPurge(url, digest, tag string) ([]string, error) {
+	matched := make(map[string]struct{})
+	if !stringutils.IsEmptyStr(tag) {
+		for _, taskID := range tm.tagIndex.list(tag) {
+			matched[taskID] = struct{}{}
+		}
+	}
+	if !stringutils.IsEmptyStr(url) || !stringutils.IsEmptyStr(digest) {
+		for _, v := range tm.taskStore.List() {
+			task, ok := v.(*types.TaskInfo)
+			if !ok {
+				return nil, errors.Wrapf(errortypes.ErrConvertFailed, "value: %v", v)
+			}
+			if matchPurgeURL(task, url) || matchPurgeDigest(task, digest) {
+				matched[task.ID] = struct{}{}
+			}
+		}
+	}
+
+	taskIDs := make([]string, 0, len(matched))
+	for taskID := range matched {
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Strings(taskIDs)
+	return taskIDs, nil
+}
+
+// listTasksByTag returns the tasks with the tag by the tag index.
+func (tm *Manager) listTasksByTag(tag string) []interface{} {
+	var values []interface{}
+	for _, taskID := range tm.tagIndex.list(tag) {
+		if v, err := tm.taskStore.Get(taskID); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// purgeTask evicts the task and the cached file of it,
+// and detaches all the clients downloading it for the reason,
+// which is returned to the clients when they pull the pieces.
+func (tm *Manager) purgeTask(ctx context.Context, taskID string, reason error) error {
+	tm.taskLocker.GetLock(taskID, false)
+	defer tm.taskLocker.ReleaseLock(taskID, false)
+
+	// the event is recorded before the progress is deleted,
+	// and the history is kept for the TaskEventRetention after it.
+	tm.recordTaskEvent(ctx, taskID, mgr.TaskEventEvicted, reason.Error())
+
+	if err := tm.clearTask(ctx, taskID, reason); err != nil {
+		return err
+	}
+
+	if v, err := tm.taskStore.Get(taskID); err == nil {
+		if task, ok := v.(*types.TaskInfo); ok {
+			tm.metrics.tasks.WithLabelValues(task.CdnStatus).Dec()
+			tm.tagIndex.remove(taskID, task.Tags)
+		}
+	}
+	tm.taskStore.Delete(taskID)
+	tm.merger.remove(taskID)
+	tm.accessTimeMap.Delete(taskID)
+	tm.taskURLUnReachableStore.Delete(taskID)
+	tm.poisonedTasks.Delete(taskID)
+	tm.pausedTasks.Delete(taskID)
+	return nil
+}
+
+// clearTask detaches the clients of the task with the reason, and deletes
+// the progress and the file of the task. The lock of the task should be held.
+func (tm *Manager) clearTask(ctx context.Context, taskID string, reason error) error {
+	dfgetTasks, err := tm.dfgetTaskMgr.List(ctx, map[string]string{"taskID": taskID})
+	if err != nil {
+		return err
+	}
+	for _, dfgetTask := range dfgetTasks {
+		if err := tm.progressMgr.DeletePieceProgressByCID(ctx, taskID, dfgetTask.CID); err != nil &&
+			!errortypes.IsDataNotFound(err) {
+			return err
+		}
+		if err := tm.dfgetTaskMgr.Delete(ctx, dfgetTask.CID, taskID); err != nil &&
+			!errortypes.IsDataNotFound(err) {
+			return err
+		}
+		tm.taskPurgedClients.Add(generatePurgedClientKey(taskID, dfgetTask.CID), reason)
+		tm.clientActivities.Delete(generatePurgedClientKey(taskID, dfgetTask.CID))
+	}
+
+	if err := tm.progressMgr.DeleteProgressByTaskID(ctx, taskID); err != nil {
+		return err
+	}
+	return tm.cdnMgr.Delete(ctx, taskID)
+}
+
+// getPurgedReason returns the reason why the client was detached from the task,
+// or nil if the client was not detached.
+func (tm *Manager) getPurgedReason(taskID, clientID string) error {
+	v, err := tm.taskPurgedClients.Get(generatePurgedClientKey(taskID, clientID))
+	if err != nil {
+		return nil
+	}
+	reason, ok := v.(error)
+	if !ok {
+		return nil
+	}
+	return reason
+}
+
+func generatePurgedClientKey(taskID, clientID string) string {
+	return fmt.Sprintf("%s@%s", clientID, taskID)
+}
+
+// matchPurgeURL returns whether the url of task matches the url to purge.
+// The url ending with "*" matches all urls with the prefix before it.
+func matchPurgeURL(task *types.TaskInfo, url string) bool {
+	if stringutils.IsEmptyStr(url) {
+		return false
+	}
+	if strings.HasSuffix(url, "*") {
+		prefix := strings.TrimSuffix(url, "*")
+		return strings.HasPrefix(task.TaskURL, prefix) || strings.HasPrefix(task.RawURL, prefix)
+	}
+	return task.TaskURL == url || task.RawURL == url
+}
+
+// matchPurgeDigest returns whether the md5 of task equals the digest to purge.
+func matchPurgeDigest(task *types.TaskInfo, digest string) bool {
+	if stringutils.IsEmptyStr(digest) {
+		return false
+	}
+	return strings.EqualFold(task.Md5, digest) || strings.EqualFold(task.RealMd5, digest) ||
+		strings.EqualFold(task.OriginalMd5, digest)
+}
+
 // convertToPeerPieceStatus convert piece result and dfgetTask status to dfgetTask status code.
 // And it should return "" if failed to convert.
 func convertToDfgetTaskStatus(result, status string) string {
@@ -468,40 +783,211 @@ func validateParams(req *types.TaskCreateRequest) error {
 		return errors.Wrapf(errortypes.ErrEmptyValue, "peerID")
 	}
 
-	return nil
+	switch req.PieceOrder {
+	case "", types.TaskCreateRequestPieceOrderRarestFirst,
+		types.TaskCreateRequestPieceOrderSequential, types.TaskCreateRequestPieceOrderRandom:
+	default:
+		return errors.Wrapf(errortypes.ErrInvalidValue, "piece order: %s", req.PieceOrder)
+	}
+
+	if err := validateConsistency(req.Consistency); err != nil {
+		return err
+	}
+
+	if !stringutils.IsEmptyStr(req.DigestAlgorithm) {
+		if _, err := digest.NewHash(req.DigestAlgorithm); err != nil {
+			return err
+		}
+	}
+
+	return validateCompletionPolicy(req)
+}
+
+func validateConsistency(consistency string) error {
+	switch consistency {
+	case "", types.TaskCreateRequestConsistencyCachedOk,
+		types.TaskCreateRequestConsistencyRevalidate, types.TaskCreateRequestConsistencyAlwaysFresh:
+		return nil
+	default:
+		return errors.Wrapf(errortypes.ErrInvalidValue, "consistency: %s", consistency)
+	}
+}
+
+// getDigestAlgorithm returns the digest algorithm of the task created by the req,
+// which is the default of supernode if the req doesn't specify it.
+func (tm *Manager) getDigestAlgorithm(req *types.TaskCreateRequest) string {
+	if !stringutils.IsEmptyStr(req.DigestAlgorithm) {
+		return req.DigestAlgorithm
+	}
+	if !stringutils.IsEmptyStr(tm.cfg.DigestAlgorithm) {
+		return tm.cfg.DigestAlgorithm
+	}
+	return digest.AlgorithmMD5
 }
 
 // generateTaskID generates taskID with taskURL,md5 and identifier
 // and returns the SHA-256 checksum of the data.
 func generateTaskID(taskURL, md5, identifier string) string {
-	sign := ""
+	id := fmt.Sprintf("%s%s%s%s", key, taskURL, getTaskSign(md5, identifier), key)
+
+	return digest.Sha256(id)
+}
+
+// getTaskSign returns the md5 if it's not empty, otherwise the identifier.
+func getTaskSign(md5, identifier string) string {
 	if !stringutils.IsEmptyStr(md5) {
-		sign = md5
-	} else if !stringutils.IsEmptyStr(identifier) {
-		sign = identifier
+		return md5
+	}
+	return identifier
+}
+
+// generateTaskIDWithHeaders generates taskID with taskURL, md5, identifier
+// and the values of headers whose names are in the identityHeaders.
+//
+// The header names are case-insensitive and the order of them makes no difference.
+// A header that is absent from the request is the same as one with an empty value.
+// And it returns the same taskID as generateTaskID when identityHeaders is empty.
+func generateTaskIDWithHeaders(taskURL, md5, identifier string, headers map[string]string, identityHeaders []string) string {
+	headersSign := generateHeadersSign(headers, identityHeaders)
+	if stringutils.IsEmptyStr(headersSign) {
+		return generateTaskID(taskURL, md5, identifier)
 	}
-	id := fmt.Sprintf("%s%s%s%s", key, taskURL, sign, key)
+
+	id := fmt.Sprintf("%s%s%s%s%s", key, taskURL, getTaskSign(md5, identifier), headersSign, key)
 
 	return digest.Sha256(id)
 }
 
-// computePieceSize computes the piece size with specified fileLength.
+// generateHeadersSign returns a stable string consisting of the headers
+// whose names are in the identityHeaders, like this: "\nName1:value1\nName2:value2".
+func generateHeadersSign(headers map[string]string, identityHeaders []string) string {
+	if len(identityHeaders) == 0 {
+		return ""
+	}
+
+	canonicalHeaders := make(map[string]string, len(headers))
+	for k, v := range headers {
+		canonicalHeaders[http.CanonicalHeaderKey(k)] = v
+	}
+
+	names := make(map[string]bool, len(identityHeaders))
+	for _, name := range identityHeaders {
+		name = strings.TrimSpace(name)
+		if stringutils.IsEmptyStr(name) {
+			continue
+		}
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	var sign strings.Builder
+	for _, name := range sortedNames {
+		sign.WriteString(fmt.Sprintf("\n%s:%s", name, canonicalHeaders[name]))
+	}
+	return sign.String()
+}
+
+// getPieceSize returns the piece size recorded by CDN if the file of task
+// has been downloaded before, so that the downloaded pieces keep their offsets
+// even if the configured piece size has changed since then.
+// Otherwise, the piece size is computed with the current config for the new task,
+// which grows to keep the pieces under the MaxPiecesPerTask.
+func (tm *Manager) getPieceSize(ctx context.Context, task *types.TaskInfo, fileLength int64) (int32, error) {
+	recordedPieceSize, err := tm.cdnMgr.GetPieceSize(ctx, task)
+	if err != nil {
+		logrus.Errorf("failed to get the recorded piece size for taskID(%s): %v", task.ID, err)
+		recordedPieceSize = 0
+	}
+	if recordedPieceSize > 0 {
+		if count := pieceCount(fileLength, recordedPieceSize); tm.cfg.MaxPiecesPerTask > 0 && count > int64(tm.cfg.MaxPiecesPerTask) {
+			return 0, errors.Wrapf(errortypes.ErrTooManyPieces, "taskID: %s, %d pieces of the recorded piece size %d exceed the limit %d",
+				task.ID, count, recordedPieceSize, tm.cfg.MaxPiecesPerTask)
+		}
+		if computed := computePieceSize(fileLength, int32(tm.cfg.PieceSize)); recordedPieceSize != computed {
+			logrus.Infof("taskID(%s) keeps the recorded piece size %d instead of %d", task.ID, recordedPieceSize, computed)
+		}
+		return recordedPieceSize, nil
+	}
+
+	pieceSize := computePieceSize(fileLength, int32(tm.cfg.PieceSize))
+	fitted, err := fitPieceCount(fileLength, pieceSize, tm.cfg.MaxPiecesPerTask)
+	if err != nil {
+		return 0, errors.Wrapf(err, "taskID: %s", task.ID)
+	}
+	if fitted != pieceSize {
+		logrus.Infof("taskID(%s) grows the piece size from %d to %d to keep %d bytes in %d pieces",
+			task.ID, pieceSize, fitted, fileLength, tm.cfg.MaxPiecesPerTask)
+	}
+	return fitted, nil
+}
+
+// fitPieceCount returns the smallest piece size not less than pieceSize which splits
+// the file of length into at most maxPieces pieces, and ErrTooManyPieces if the piece size
+// would exceed the DefaultPieceSizeLimit. The file of unknown length is never resized.
+// And the limit will be disabled if maxPieces is not greater than 0.
+func fitPieceCount(length int64, pieceSize int32, maxPieces int) (int32, error) {
+	if maxPieces <= 0 || length <= 0 || pieceCount(length, pieceSize) <= int64(maxPieces) {
+		return pieceSize, nil
+	}
+
+	fitted := (length + int64(maxPieces) - 1) / int64(maxPieces)
+	if fitted > config.DefaultPieceSizeLimit {
+		return 0, errors.Wrapf(errortypes.ErrTooManyPieces, "%d bytes can't be split into %d pieces of at most %d bytes",
+			length, maxPieces, config.DefaultPieceSizeLimit)
+	}
+	return int32(fitted), nil
+}
+
+// pieceCount returns the number of pieces of pieceSize the file of length is split into.
+func pieceCount(length int64, pieceSize int32) int64 {
+	return (length + int64(pieceSize) - 1) / int64(pieceSize)
+}
+
+// computePieceSize computes the piece size with specified fileLength
+// and the basePieceSize of the files not larger than 200MB.
 //
 // If the fileLength<=0, which means failed to get fileLength
-// and then use the DefaultPieceSize.
-func computePieceSize(length int64) int32 {
+// and then use the basePieceSize.
+// And the DefaultPieceSize is used if the basePieceSize is invalid.
+func computePieceSize(length int64, basePieceSize int32) int32 {
+	if basePieceSize <= config.PieceWrapSize || basePieceSize > config.DefaultPieceSizeLimit {
+		basePieceSize = config.DefaultPieceSize
+	}
+
 	if length <= 0 || length <= 200*1024*1024 {
-		return config.DefaultPieceSize
+		return basePieceSize
 	}
 
 	gapCount := length / int64(100*1024*1024)
-	tmpSize := (gapCount-2)*1024*1024 + config.DefaultPieceSize
+	tmpSize := (gapCount-2)*1024*1024 + int64(basePieceSize)
 	if tmpSize > config.DefaultPieceSizeLimit {
 		return config.DefaultPieceSizeLimit
 	}
 	return int32(tmpSize)
 }
 
+// validatePieceNum checks whether pieceNum is in the range of the pieces of the task.
+// The upper bound is not checked if the piece count is unknown, which happens when
+// the length of the source is unknown before the CDN finishes.
+func validatePieceNum(task *types.TaskInfo, pieceNum int) error {
+	if pieceNum < 0 {
+		return errors.Wrapf(errortypes.ErrPieceOutOfRange, "pieceNum %d for taskID: %s", pieceNum, task.ID)
+	}
+	if task.HTTPFileLength < 0 && !isSuccessCDN(task.CdnStatus) {
+		return nil
+	}
+	if pieceNum >= int(task.PieceTotal) {
+		return errors.Wrapf(errortypes.ErrPieceOutOfRange, "pieceNum %d for taskID: %s with %d pieces",
+			pieceNum, task.ID, task.PieceTotal)
+	}
+	return nil
+}
+
 // isSuccessCDN determines that whether the CDNStatus is success.
 func isSuccessCDN(CDNStatus string) bool {
 	return CDNStatus == types.TaskInfoCdnStatusSUCCESS
@@ -518,8 +1004,11 @@ func isWait(CDNStatus string) bool {
 }
 
 func (tm *Manager) getHTTPFileLength(taskID, url string, headers map[string]string) (int64, error) {
-	fileLength, code, err := tm.OriginClient.GetContentLength(url, headers)
+	fileLength, code, err := httpclient.ForTask(tm.OriginClient, taskID).GetContentLength(url, headers)
 	if err != nil {
+		if errortypes.IsSourceBadResponse(err) {
+			return -1, errors.Wrapf(err, "failed to get http file Length")
+		}
 		return -1, errors.Wrapf(errortypes.ErrUnknowError, "failed to get http file Length: %v", err)
 	}
 
@@ -528,7 +1017,7 @@ func (tm *Manager) getHTTPFileLength(taskID, url string, headers map[string]stri
 	}
 	if code != http.StatusOK {
 		logrus.Warnf("failed to get http file length with unexpected code: %d", code)
-		if code == http.StatusNotFound {
+		if code == http.StatusNotFound || code == http.StatusGone {
 			return -1, errors.Wrapf(errortypes.ErrURLNotReachable, "taskID: %s, url: %s", taskID, url)
 		}
 		return -1, nil
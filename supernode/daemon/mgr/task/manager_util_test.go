@@ -18,8 +18,12 @@ package task
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
 	cMock "github.com/dragonflyoss/Dragonfly/supernode/httpclient/mock"
@@ -53,6 +57,7 @@ func (s *TaskUtilTestSuite) SetUpSuite(c *check.C) {
 	s.mockCDNMgr = mock.NewMockCDNMgr(s.mockCtl)
 	s.mockDfgetTaskMgr = mock.NewMockDfgetTaskMgr(s.mockCtl)
 	s.mockProgressMgr = mock.NewMockProgressMgr(s.mockCtl)
+	s.mockProgressMgr.EXPECT().NotifyTask(gomock.Any(), gomock.Any()).AnyTimes()
 	s.mockSchedulerMgr = mock.NewMockSchedulerMgr(s.mockCtl)
 	s.mockOriginClient = cMock.NewMockOriginHTTPClient(s.mockCtl)
 	s.taskManager, _ = NewManager(config.NewConfig(), s.mockPeerMgr, s.mockDfgetTaskMgr,
@@ -181,3 +186,372 @@ func (s *TaskUtilTestSuite) TestTriggerCdnSyncAction(c *check.C) {
 		}
 	}
 }
+
+func (s *TaskUtilTestSuite) TestGenerateTaskIDWithHeaders(c *check.C) {
+	url := "http://aa.bb.com/foo"
+	gzip := map[string]string{"Accept-Encoding": "gzip", "X-Tenant": "foo"}
+	identity := map[string]string{"accept-encoding": "identity", "x-tenant": "foo"}
+	otherTenant := map[string]string{"Accept-Encoding": "gzip", "X-Tenant": "bar"}
+
+	// it should be the same as generateTaskID if there is no identity headers.
+	c.Check(generateTaskIDWithHeaders(url, "", "", gzip, nil), check.Equals, generateTaskID(url, "", ""))
+	c.Check(generateTaskIDWithHeaders(url, "md5", "", gzip, []string{" "}), check.Equals, generateTaskID(url, "md5", ""))
+
+	var cases = []struct {
+		desc            string
+		identityHeaders []string
+		headers1        map[string]string
+		headers2        map[string]string
+		shared          bool
+	}{
+		{
+			desc:            "Accept-Encoding is not a part of identity",
+			identityHeaders: []string{"X-Tenant"},
+			headers1:        gzip,
+			headers2:        identity,
+			shared:          true,
+		},
+		{
+			desc:            "Accept-Encoding is a part of identity",
+			identityHeaders: []string{"Accept-Encoding"},
+			headers1:        gzip,
+			headers2:        identity,
+			shared:          false,
+		},
+		{
+			desc:            "isolate the tenants",
+			identityHeaders: []string{"x-tenant"},
+			headers1:        gzip,
+			headers2:        otherTenant,
+			shared:          false,
+		},
+		{
+			desc:            "the order and case of identity headers make no difference",
+			identityHeaders: []string{"X-TENANT", "accept-encoding", "X-Tenant"},
+			headers1:        gzip,
+			headers2:        map[string]string{"x-tenant": "foo", "ACCEPT-ENCODING": "gzip"},
+			shared:          true,
+		},
+		{
+			desc:            "the absent header equals to the empty one",
+			identityHeaders: []string{"X-Tenant"},
+			headers1:        nil,
+			headers2:        map[string]string{"X-Tenant": ""},
+			shared:          true,
+		},
+		{
+			desc:            "the absent header differs from the non-empty one",
+			identityHeaders: []string{"X-Tenant"},
+			headers1:        nil,
+			headers2:        gzip,
+			shared:          false,
+		},
+	}
+
+	for _, v := range cases {
+		id1 := generateTaskIDWithHeaders(url, "", "", v.headers1, v.identityHeaders)
+		id2 := generateTaskIDWithHeaders(url, "", "", v.headers2, v.identityHeaders)
+		c.Check(id1 == id2, check.Equals, v.shared, check.Commentf(v.desc))
+
+		// the result should be stable.
+		c.Check(generateTaskIDWithHeaders(url, "", "", v.headers1, v.identityHeaders), check.Equals, id1)
+	}
+
+	// the md5 should be still a part of identity with the identity headers.
+	c.Check(generateTaskIDWithHeaders(url, "md5", "", gzip, []string{"X-Tenant"}), check.Not(check.Equals),
+		generateTaskIDWithHeaders(url, "otherMd5", "", gzip, []string{"X-Tenant"}))
+}
+
+func (s *TaskUtilTestSuite) TestWarmHandoff(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.WarmHandoffClients = 2
+	taskManager, _ := NewManager(cfg, s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, s.mockOriginClient, prometheus.NewRegistry())
+
+	s.mockDfgetTaskMgr.EXPECT().List(gomock.Any(), map[string]string{"taskID": "handoffTask"}).Return([]*types.DfGetTask{
+		{CID: cfg.GetSuperCID("handoffTask"), TaskID: "handoffTask", Status: types.DfGetTaskStatusRUNNING},
+		{CID: "cid1", TaskID: "handoffTask", Status: types.DfGetTaskStatusRUNNING},
+		{CID: "cid2", TaskID: "handoffTask", Status: types.DfGetTaskStatusSUCCESS},
+		{CID: "cid3", TaskID: "handoffTask", Status: types.DfGetTaskStatusWAITING},
+	}, nil)
+	s.mockSchedulerMgr.EXPECT().WarmHandoff(gomock.Any(), "handoffTask", []string{"cid1", "cid3"}).Return(nil)
+	taskManager.warmHandoff(context.Background(), "handoffTask")
+
+	// no handoff when disabled
+	s.taskManager.warmHandoff(context.Background(), "handoffTask")
+}
+
+func (s *TaskUtilTestSuite) TestKeepRecordedPieceSize(c *check.C) {
+	ctx := context.Background()
+	cfg := config.NewConfig()
+	cfg.PieceSize = 2 * 1024 * 1024
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockOriginClient := cMock.NewMockOriginHTTPClient(mockCtl)
+	taskManager, _ := NewManager(cfg, s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, mockOriginClient, prometheus.NewRegistry())
+	mockOriginClient.EXPECT().GetContentLength(gomock.Any(), gomock.Any()).Return(int64(10*1024*1024), 200, nil).Times(2)
+
+	// the task downloaded partially keeps the piece size before the config changes
+	mockCDNMgr.EXPECT().GetPieceSize(gomock.Any(), gomock.Any()).Return(int32(config.DefaultPieceSize), nil)
+	task, err := taskManager.addOrUpdateTask(ctx, &types.TaskCreateRequest{RawURL: "http://aa.bb.com/resumed"}, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(task.PieceSize, check.Equals, int32(config.DefaultPieceSize))
+	c.Check(task.PieceTotal, check.Equals, int32(3))
+
+	// the brand-new task uses the current config
+	mockCDNMgr.EXPECT().GetPieceSize(gomock.Any(), gomock.Any()).Return(int32(0), nil)
+	task, err = taskManager.addOrUpdateTask(ctx, &types.TaskCreateRequest{RawURL: "http://aa.bb.com/new"}, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(task.PieceSize, check.Equals, int32(2*1024*1024))
+	c.Check(task.PieceTotal, check.Equals, int32(5))
+}
+
+func (s *TaskUtilTestSuite) TestComputePieceSize(c *check.C) {
+	c.Check(computePieceSize(100, 2*1024*1024), check.Equals, int32(2*1024*1024))
+	c.Check(computePieceSize(-1, 0), check.Equals, int32(config.DefaultPieceSize))
+	c.Check(computePieceSize(500*1024*1024, 2*1024*1024), check.Equals, int32(5*1024*1024))
+	c.Check(computePieceSize(5000*1024*1024, 2*1024*1024), check.Equals, int32(config.DefaultPieceSizeLimit))
+}
+
+func (s *TaskUtilTestSuite) TestFitPieceCount(c *check.C) {
+	const mb = 1024 * 1024
+
+	// disabled, unknown length or already under the limit
+	for _, maxPieces := range []int{0, -1} {
+		pieceSize, err := fitPieceCount(100*mb, mb, maxPieces)
+		c.Check(err, check.IsNil)
+		c.Check(pieceSize, check.Equals, int32(mb))
+	}
+	pieceSize, err := fitPieceCount(-1, mb, 10)
+	c.Check(err, check.IsNil)
+	c.Check(pieceSize, check.Equals, int32(mb))
+	pieceSize, err = fitPieceCount(10*mb, mb, 10)
+	c.Check(err, check.IsNil)
+	c.Check(pieceSize, check.Equals, int32(mb))
+
+	// grows to the smallest piece size under the limit
+	pieceSize, err = fitPieceCount(100*mb+1, mb, 10)
+	c.Check(err, check.IsNil)
+	c.Check(pieceSize, check.Equals, int32(10*mb+1))
+	c.Check(pieceCount(100*mb+1, pieceSize), check.Equals, int64(10))
+
+	// never beyond the piece size limit
+	_, err = fitPieceCount(1000*mb, mb, 10)
+	c.Check(errortypes.IsTooManyPieces(err), check.Equals, true)
+}
+
+func (s *TaskUtilTestSuite) TestMaxPiecesPerTask(c *check.C) {
+	ctx := context.Background()
+	cfg := config.NewConfig()
+	cfg.PieceSize = 64 * 1024
+	cfg.MaxPiecesPerTask = 16
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockOriginClient := cMock.NewMockOriginHTTPClient(mockCtl)
+	taskManager, _ := NewManager(cfg, s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, mockCDNMgr, s.mockSchedulerMgr, mockOriginClient, prometheus.NewRegistry())
+	mockOriginClient.EXPECT().GetContentLength(gomock.Any(), gomock.Any()).Return(int64(10*1024*1024), 200, nil).Times(2)
+
+	// the new task grows the piece size to stay under the limit
+	mockCDNMgr.EXPECT().GetPieceSize(gomock.Any(), gomock.Any()).Return(int32(0), nil)
+	task, err := taskManager.addOrUpdateTask(ctx, &types.TaskCreateRequest{RawURL: "http://aa.bb.com/resized"}, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(task.PieceSize, check.Equals, int32(640*1024))
+	c.Check(task.PieceTotal, check.Equals, int32(16))
+
+	// the task whose piece size is fixed by the downloaded pieces is rejected
+	mockCDNMgr.EXPECT().GetPieceSize(gomock.Any(), gomock.Any()).Return(int32(64*1024), nil)
+	_, err = taskManager.addOrUpdateTask(ctx, &types.TaskCreateRequest{RawURL: "http://aa.bb.com/fixed"}, 0)
+	c.Check(errortypes.IsTooManyPieces(err), check.Equals, true)
+	_, err = taskManager.getTask(generateTaskID("http://aa.bb.com/fixed", "", ""))
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+}
+
+func (s *TaskUtilTestSuite) TestNegativeCaching(c *check.C) {
+	ctx := context.Background()
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockOriginClient := cMock.NewMockOriginHTTPClient(mockCtl)
+	taskManager, _ := NewManager(config.NewConfig(), s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, mockOriginClient, prometheus.NewRegistry())
+
+	for _, code := range []int{http.StatusNotFound, http.StatusGone} {
+		req := &types.TaskCreateRequest{RawURL: fmt.Sprintf("http://aa.bb.com/%d", code)}
+
+		// the source is queried only once within the interval
+		mockOriginClient.EXPECT().GetContentLength(req.RawURL, gomock.Any()).Return(int64(-1), code, nil)
+		for i := 0; i < 3; i++ {
+			_, err := taskManager.addOrUpdateTask(ctx, req, 50*time.Millisecond)
+			c.Check(errortypes.IsURLNotReachable(err), check.Equals, true)
+		}
+
+		// and re-queried after the interval expires
+		time.Sleep(60 * time.Millisecond)
+		mockOriginClient.EXPECT().GetContentLength(req.RawURL, gomock.Any()).Return(int64(-1), code, nil)
+		_, err := taskManager.addOrUpdateTask(ctx, req, 50*time.Millisecond)
+		c.Check(errortypes.IsURLNotReachable(err), check.Equals, true)
+	}
+
+	// the source is queried every time when the negative caching is disabled
+	req := &types.TaskCreateRequest{RawURL: "http://aa.bb.com/disabled"}
+	mockOriginClient.EXPECT().GetContentLength(req.RawURL, gomock.Any()).Return(int64(-1), http.StatusNotFound, nil).Times(2)
+	for i := 0; i < 2; i++ {
+		_, err := taskManager.addOrUpdateTask(ctx, req, 0)
+		c.Check(errortypes.IsURLNotReachable(err), check.Equals, true)
+	}
+}
+
+func (s *TaskUtilTestSuite) TestTaskIDQueryRules(c *check.C) {
+	ctx := context.Background()
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockOriginClient := cMock.NewMockOriginHTTPClient(mockCtl)
+	mockOriginClient.EXPECT().GetContentLength(gomock.Any(), gomock.Any()).Return(int64(1000), http.StatusOK, nil).AnyTimes()
+	cfg := config.NewConfig()
+	cfg.TaskIDQueryRules = []config.QueryRule{
+		{Pattern: "aa.bb.com/images/*", Mode: config.QueryRuleModeDeny, Params: []string{"utm_*", "t"}},
+		{Pattern: "aa.bb.com/blobs/*", Mode: config.QueryRuleModeAllow, Params: []string{"version"}},
+	}
+	taskManager, err := NewManager(cfg, s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, mockOriginClient, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	var cases = []struct {
+		rawURLs  []string
+		expected string
+	}{
+		{
+			// the tracking params are ignored and the others are sorted
+			rawURLs: []string{
+				"http://aa.bb.com/images/a.png?size=1&utm_source=x",
+				"http://aa.bb.com/images/a.png?t=1&size=1&utm_source=y&utm_medium=z",
+				"http://aa.bb.com/images/a.png?size=1&t=2",
+			},
+			expected: "http://aa.bb.com/images/a.png?size=1",
+		},
+		{
+			// only the allowed params matter
+			rawURLs: []string{
+				"http://aa.bb.com/blobs/b?version=2&session=a",
+				"http://aa.bb.com/blobs/b?session=b&version=2&sig=c",
+			},
+			expected: "http://aa.bb.com/blobs/b?version=2",
+		},
+		{
+			// the urls matching no rule are kept
+			rawURLs:  []string{"http://aa.bb.com/others/c?utm_source=x"},
+			expected: "http://aa.bb.com/others/c?utm_source=x",
+		},
+	}
+
+	for _, v := range cases {
+		var taskIDs []string
+		for _, rawURL := range v.rawURLs {
+			task, err := taskManager.addOrUpdateTask(ctx, &types.TaskCreateRequest{RawURL: rawURL}, 0)
+			c.Assert(err, check.IsNil, check.Commentf(rawURL))
+			c.Check(task.TaskURL, check.Equals, v.expected)
+			c.Check(task.RawURL, check.Equals, v.rawURLs[0])
+			taskIDs = append(taskIDs, task.ID)
+		}
+		for _, taskID := range taskIDs {
+			c.Check(taskID, check.Equals, taskIDs[0], check.Commentf(v.expected))
+		}
+	}
+
+	// the invalid rules are rejected
+	cfg = config.NewConfig()
+	cfg.TaskIDQueryRules = []config.QueryRule{{Pattern: "aa.bb.com/*", Mode: "ignore"}}
+	_, err = NewManager(cfg, s.mockPeerMgr, s.mockDfgetTaskMgr,
+		s.mockProgressMgr, s.mockCDNMgr, s.mockSchedulerMgr, mockOriginClient, prometheus.NewRegistry())
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+}
+
+func (s *TaskUtilTestSuite) TestSortArchiveMembers(c *check.C) {
+	member := func(name string) *types.ArchiveMember {
+		rawURL := "http://aa.bb.com/" + name
+		return &types.ArchiveMember{Name: &name, RawURL: &rawURL}
+	}
+
+	members, err := sortArchiveMembers([]*types.ArchiveMember{member("b/c"), member("a"), member("b/a")})
+	c.Assert(err, check.IsNil)
+	var names []string
+	for _, m := range members {
+		names = append(names, *m.Name)
+	}
+	c.Check(names, check.DeepEquals, []string{"a", "b/a", "b/c"})
+
+	for _, names := range [][]string{{"/a"}, {"../a"}, {"a/../b"}, {"."}, {"a/"}, {"a", "a"}} {
+		var invalid []*types.ArchiveMember
+		for _, name := range names {
+			invalid = append(invalid, member(name))
+		}
+		_, err := sortArchiveMembers(invalid)
+		c.Check(errortypes.IsInvalidValue(err), check.Equals, true, check.Commentf("%v", names))
+	}
+}
+
+func (s *TaskUtilTestSuite) TestValidatePieceNum(c *check.C) {
+	var cases = []struct {
+		desc     string
+		task     *types.TaskInfo
+		pieceNum int
+		errCheck func(error) bool
+	}{
+		{
+			desc:     "negative",
+			task:     &types.TaskInfo{PieceTotal: 4},
+			pieceNum: -1,
+			errCheck: errortypes.IsPieceOutOfRange,
+		},
+		{
+			desc:     "zero with empty task",
+			task:     &types.TaskInfo{PieceTotal: 0},
+			pieceNum: 0,
+			errCheck: errortypes.IsPieceOutOfRange,
+		},
+		{
+			desc:     "beyond count",
+			task:     &types.TaskInfo{PieceTotal: 4},
+			pieceNum: 4,
+			errCheck: errortypes.IsPieceOutOfRange,
+		},
+		{
+			desc:     "the last piece",
+			task:     &types.TaskInfo{PieceTotal: 4},
+			pieceNum: 3,
+			errCheck: errortypes.IsNilError,
+		},
+		{
+			desc:     "unknown piece count",
+			task:     &types.TaskInfo{HTTPFileLength: -1, CdnStatus: types.TaskInfoCdnStatusRUNNING},
+			pieceNum: 100,
+			errCheck: errortypes.IsNilError,
+		},
+		{
+			desc:     "negative with unknown piece count",
+			task:     &types.TaskInfo{HTTPFileLength: -1, CdnStatus: types.TaskInfoCdnStatusRUNNING},
+			pieceNum: -1,
+			errCheck: errortypes.IsPieceOutOfRange,
+		},
+		{
+			desc:     "beyond count after the CDN of unknown length finishes",
+			task:     &types.TaskInfo{HTTPFileLength: -1, CdnStatus: types.TaskInfoCdnStatusSUCCESS, PieceTotal: 4},
+			pieceNum: 4,
+			errCheck: errortypes.IsPieceOutOfRange,
+		},
+	}
+
+	for _, tc := range cases {
+		c.Check(tc.errCheck(validatePieceNum(tc.task, tc.pieceNum)), check.Equals, true, check.Commentf(tc.desc))
+	}
+
+	// the piece beyond count is rejected without panic
+	s.taskManager.taskStore.Put("rangeTask", &types.TaskInfo{ID: "rangeTask", PieceTotal: 4, PieceSize: 4})
+	err := s.taskManager.UpdatePieceStatus(context.Background(), "rangeTask", "4000000000000-4000000000003",
+		&types.PieceUpdateRequest{ClientID: "cid"})
+	c.Check(errortypes.IsPieceOutOfRange(err), check.Equals, true)
+}
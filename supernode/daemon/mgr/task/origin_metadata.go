@@ -0,0 +1,88 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+
+	"github.com/pkg/errors"
+)
+
+// metadataSelector selects the tasks whose origin metadata with the name equals the value.
+type metadataSelector struct {
+	name  string
+	value string
+}
+
+// parseMetadataSelector parses the selector in the form of "Name=value",
+// and the name is canonicalized as the header captured into the origin metadata.
+func parseMetadataSelector(selector string) (*metadataSelector, error) {
+	i := strings.Index(selector, "=")
+	if i <= 0 {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "origin metadata selector %q, expected Name=value", selector)
+	}
+	name := strings.TrimSpace(selector[:i])
+	if stringutils.IsEmptyStr(name) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "origin metadata selector %q, expected Name=value", selector)
+	}
+	return &metadataSelector{
+		name:  http.CanonicalHeaderKey(name),
+		value: strings.TrimSpace(selector[i+1:]),
+	}, nil
+}
+
+func parseMetadataSelectors(selectors []string) ([]*metadataSelector, error) {
+	result := make([]*metadataSelector, 0, len(selectors))
+	for _, s := range selectors {
+		selector, err := parseMetadataSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, selector)
+	}
+	return result, nil
+}
+
+func (s *metadataSelector) match(originMetadata map[string]string) bool {
+	value, ok := originMetadata[s.name]
+	return ok && value == s.value
+}
+
+// isPinned returns whether the task is never evicted by purging since its origin
+// metadata matches one of the PinnedOriginMetadata.
+func (tm *Manager) isPinned(taskID string) bool {
+	if len(tm.pinnedMetadata) == 0 {
+		return false
+	}
+	task, err := tm.getTask(taskID)
+	if err != nil {
+		return false
+	}
+
+	tm.taskLocker.GetLock(taskID, true)
+	defer tm.taskLocker.ReleaseLock(taskID, true)
+	for _, selector := range tm.pinnedMetadata {
+		if selector.match(task.OriginMetadata) {
+			return true
+		}
+	}
+	return false
+}
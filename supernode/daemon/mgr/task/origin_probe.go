@@ -0,0 +1,59 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// originProbeTimeout is the max time to wait for the response of a probed source.
+const originProbeTimeout = 10 * time.Second
+
+// ProbeOrigin checks whether the source can be reached and authenticated to
+// with the same client as the downloads, without downloading the file.
+func (tm *Manager) ProbeOrigin(ctx context.Context, req *types.OriginProbeRequest) (*types.OriginProbeResult, error) {
+	if req.RawURL == nil {
+		return nil, errors.Wrapf(errortypes.ErrEmptyValue, "raw url")
+	}
+	rawURL := *req.RawURL
+	if !netutils.IsValidURL(rawURL) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "raw url: %s", rawURL)
+	}
+
+	// the tls config is registered only if it's specified,
+	// so that the one registered by the tasks of the host is probed by default.
+	if req.Insecure || len(req.RootCAs) > 0 {
+		tm.OriginClient.RegisterTLSConfig(rawURL, req.Insecure, req.RootCAs)
+	}
+
+	result := tm.OriginClient.Probe(rawURL, req.Headers, originProbeTimeout)
+	if result.Success {
+		logrus.Infof("success to probe the source %s: status %d, length %d, cost %dms",
+			rawURL, result.StatusCode, result.ContentLength, result.TotalTime)
+	} else {
+		logrus.Warnf("failed to probe the source %s with failure %s: %s", rawURL, result.Failure, result.Message)
+	}
+	return result, nil
+}
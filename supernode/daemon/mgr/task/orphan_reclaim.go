@@ -0,0 +1,64 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// startOrphanReclaimer reclaims the orphaned files in the storage periodically
+// until the reclaiming is disabled.
+func (tm *Manager) startOrphanReclaimer() {
+	if !tm.isOrphanReclaimerEnabled() {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(tm.cfg.OrphanReclaimInterval)
+			tm.reclaimOrphans(context.Background())
+		}
+	}()
+}
+
+// reclaimOrphans removes the files in the storage which are referenced by none
+// of the tasks known by supernode and can't be reused by the tasks registered again.
+func (tm *Manager) reclaimOrphans(ctx context.Context) {
+	files, bytes, err := tm.cdnMgr.ReclaimOrphans(ctx, tm.cfg.OrphanGracePeriod, tm.isKnownTask)
+	if err != nil {
+		logrus.Warnf("failed to reclaim the orphaned files: %v", err)
+	}
+	if files == 0 {
+		return
+	}
+	tm.metrics.orphanedFilesReclaimed.WithLabelValues().Add(float64(files))
+	tm.metrics.orphanedBytesReclaimed.WithLabelValues().Add(float64(bytes))
+	logrus.Infof("success to reclaim %d orphaned files of %d bytes", files, bytes)
+}
+
+// isKnownTask returns whether the task is known by supernode.
+func (tm *Manager) isKnownTask(taskID string) bool {
+	_, err := tm.taskStore.Get(taskID)
+	return err == nil
+}
+
+func (tm *Manager) isOrphanReclaimerEnabled() bool {
+	return tm.cfg != nil && tm.cfg.BaseProperties != nil && tm.cfg.OrphanReclaimInterval > 0
+}
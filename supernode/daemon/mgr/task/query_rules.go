@@ -0,0 +1,88 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+)
+
+// validateQueryRules validates the rules of the query params making up the taskID.
+func validateQueryRules(rules []config.QueryRule) error {
+	for _, rule := range rules {
+		if stringutils.IsEmptyStr(rule.Pattern) {
+			return errors.Wrapf(errortypes.ErrEmptyValue, "pattern of the task id query rule")
+		}
+		if rule.Mode != config.QueryRuleModeAllow && rule.Mode != config.QueryRuleModeDeny {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "mode of the task id query rule %s: %s", rule.Pattern, rule.Mode)
+		}
+	}
+	return nil
+}
+
+// applyQueryRules returns the taskURL keeping only the query params which matter
+// as per the first rule matching its host and path, and the kept params are sorted
+// by name. The taskURL is returned as it is if no rule matches.
+func applyQueryRules(taskURL string, rules []config.QueryRule) string {
+	if len(rules) == 0 {
+		return taskURL
+	}
+	u, err := url.Parse(taskURL)
+	if err != nil || u.RawQuery == "" {
+		return taskURL
+	}
+
+	for _, rule := range rules {
+		if !matchWildcard(rule.Pattern, u.Host+u.Path) {
+			continue
+		}
+
+		query := u.Query()
+		for name := range query {
+			if matchAnyWildcard(rule.Params, name) != (rule.Mode == config.QueryRuleModeAllow) {
+				query.Del(name)
+			}
+		}
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return taskURL
+}
+
+// matchWildcard returns whether s matches the pattern,
+// and the pattern ending with "*" matches all strings with the prefix before it.
+func matchWildcard(pattern, s string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(s, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == s
+}
+
+func matchAnyWildcard(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matchWildcard(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
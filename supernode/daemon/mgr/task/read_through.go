@@ -0,0 +1,74 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ReadThrough registers the task of the source without any client and triggers its CDN.
+// The task is shared with the registrations of the same source, and its cached content is
+// revalidated or downloaded again as the consistency level of the req requires as well.
+func (tm *Manager) ReadThrough(ctx context.Context, req *types.TaskCreateRequest) (*types.TaskInfo, error) {
+	if !netutils.IsValidURL(req.RawURL) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "raw url: %s", req.RawURL)
+	}
+	if err := validateConsistency(req.Consistency); err != nil {
+		return nil, err
+	}
+
+	failAccessInterval := tm.cfg.FailAccessInterval * time.Minute
+	task, err := tm.addOrUpdateTask(ctx, req, failAccessInterval)
+	if err != nil {
+		return nil, err
+	}
+	task, revalidated, err := tm.ensureConsistency(ctx, req, task, failAccessInterval)
+	if err != nil {
+		return nil, err
+	}
+	tm.metrics.tasksRegisterCount.WithLabelValues().Inc()
+	tm.touchTask(task.ID)
+
+	tm.taskLocker.GetLock(task.ID, false)
+	task.AccessCount++
+	taskInfo := *task
+	tm.taskLocker.ReleaseLock(task.ID, false)
+
+	if isSuccessCDN(taskInfo.CdnStatus) {
+		result := mgr.CacheHit
+		if revalidated {
+			result = mgr.CacheRevalidationHit
+		}
+		if err := tm.progressMgr.RecordCacheResult(ctx, task.ID, result); err != nil {
+			logrus.Warnf("failed to record the cache %s for taskID %s: %v", result, task.ID, err)
+		}
+	}
+
+	if err := tm.triggerCdnSyncAction(ctx, task); err != nil {
+		return nil, errors.Wrapf(errortypes.ErrSystemError, "failed to trigger cdn: %v", err)
+	}
+	return &taskInfo, nil
+}
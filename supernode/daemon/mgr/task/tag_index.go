@@ -0,0 +1,122 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tagIndex is the secondary index of the tasks by their tags,
+// so that the tasks sharing a tag are found without scanning all the tasks.
+type tagIndex struct {
+	sync.RWMutex
+	// tasks maps a tag to the set of IDs of the tasks with the tag.
+	tasks map[string]map[string]struct{}
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		tasks: make(map[string]map[string]struct{}),
+	}
+}
+
+// add indexes the task by the tags.
+func (ti *tagIndex) add(taskID string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	ti.Lock()
+	defer ti.Unlock()
+	for _, tag := range tags {
+		taskIDs, ok := ti.tasks[tag]
+		if !ok {
+			taskIDs = make(map[string]struct{})
+			ti.tasks[tag] = taskIDs
+		}
+		taskIDs[taskID] = struct{}{}
+	}
+}
+
+// remove removes the task from the index of the tags.
+func (ti *tagIndex) remove(taskID string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	ti.Lock()
+	defer ti.Unlock()
+	for _, tag := range tags {
+		taskIDs, ok := ti.tasks[tag]
+		if !ok {
+			continue
+		}
+		delete(taskIDs, taskID)
+		if len(taskIDs) == 0 {
+			delete(ti.tasks, tag)
+		}
+	}
+}
+
+// list returns the sorted IDs of the tasks with the tag.
+func (ti *tagIndex) list(tag string) []string {
+	ti.RLock()
+	defer ti.RUnlock()
+
+	taskIDs := make([]string, 0, len(ti.tasks[tag]))
+	for taskID := range ti.tasks[tag] {
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Strings(taskIDs)
+	return taskIDs
+}
+
+// mergeTags appends the new tags to the existing ones of the task without duplicates.
+// It returns a new slice if any tag is appended so that the readers of the existing one
+// are not affected, and the tags beyond the limit are ignored.
+func mergeTags(taskID string, tags, newTags []string, limit int) []string {
+	merged := tags
+	for _, tag := range newTags {
+		if stringutils.IsEmptyStr(tag) || containsTag(merged, tag) {
+			continue
+		}
+		if limit > 0 && len(merged) >= limit {
+			logrus.Warnf("ignore the tag %s of taskID(%s) since the number of tags reaches the limit %d",
+				tag, taskID, limit)
+			continue
+		}
+		if len(merged) == len(tags) {
+			merged = append(make([]string, 0, len(tags)+len(newTags)), tags...)
+		}
+		merged = append(merged, tag)
+	}
+	return merged
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
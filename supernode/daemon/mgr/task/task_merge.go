@@ -0,0 +1,123 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// taskMerger records the canonical task of each content and the tasks merged into them,
+// so that the tasks of the different URLs which turn out to be byte-identical after
+// being downloaded converge on one copy of the content.
+type taskMerger struct {
+	sync.Mutex
+	// canonicals maps the key of a content to the ID of its canonical task.
+	canonicals map[string]string
+	// merged maps the ID of a merged task to the ID of its canonical task.
+	merged map[string]string
+}
+
+func newTaskMerger() *taskMerger {
+	return &taskMerger{
+		canonicals: make(map[string]string),
+		merged:     make(map[string]string),
+	}
+}
+
+// remove forgets the task whether it's canonical or merged,
+// and the tasks merged into it are no longer redirected.
+func (m *taskMerger) remove(taskID string) {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.merged, taskID)
+	for key, canonicalID := range m.canonicals {
+		if canonicalID == taskID {
+			delete(m.canonicals, key)
+		}
+	}
+	for mergedID, canonicalID := range m.merged {
+		if canonicalID == taskID {
+			delete(m.merged, mergedID)
+		}
+	}
+}
+
+// canonicalID returns the ID of the canonical task which the task has been merged into.
+func (m *taskMerger) canonicalID(taskID string) (string, bool) {
+	m.Lock()
+	defer m.Unlock()
+	canonicalID, ok := m.merged[taskID]
+	return canonicalID, ok
+}
+
+// contentKey identifies the content of the task which has been downloaded successfully.
+// The tasks with the same key are stored in the same layout of pieces.
+func contentKey(task *types.TaskInfo) string {
+	return fmt.Sprintf("%s:%d:%d", task.RealMd5, task.FileLength, task.PieceSize)
+}
+
+// mergeTask merges the task whose CDN finishes successfully into the canonical task
+// of the same content, or makes it the canonical one if there is none.
+//
+// The merged task keeps its clients and progress, and its file on supernode shares
+// the content of the canonical task, so that the pieces being assigned are not affected.
+// And the following registrations of the merged task join the canonical task.
+func (tm *Manager) mergeTask(ctx context.Context, taskID string) {
+	task, err := tm.getTask(taskID)
+	if err != nil || !isSuccessCDN(task.CdnStatus) || stringutils.IsEmptyStr(task.RealMd5) {
+		return
+	}
+	key := contentKey(task)
+
+	tm.merger.Lock()
+	defer tm.merger.Unlock()
+	if canonicalID, ok := tm.merger.canonicals[key]; ok && canonicalID != taskID {
+		canonical, err := tm.getTask(canonicalID)
+		if err == nil && isSuccessCDN(canonical.CdnStatus) && contentKey(canonical) == key {
+			if err := tm.cdnMgr.Merge(ctx, taskID, canonicalID); err != nil {
+				logrus.Warnf("failed to merge taskID(%s) into taskID(%s): %v", taskID, canonicalID, err)
+				return
+			}
+			tm.merger.merged[taskID] = canonicalID
+			logrus.Infof("success to merge taskID(%s) into taskID(%s) with the same content", taskID, canonicalID)
+			return
+		}
+	}
+	tm.merger.canonicals[key] = taskID
+}
+
+// getCanonicalTask returns the canonical task which the task has been merged into,
+// or nil if the task isn't merged or the canonical task is no longer available.
+func (tm *Manager) getCanonicalTask(taskID string) *types.TaskInfo {
+	canonicalID, ok := tm.merger.canonicalID(taskID)
+	if !ok {
+		return nil
+	}
+	canonical, err := tm.getTask(canonicalID)
+	if err != nil || !isSuccessCDN(canonical.CdnStatus) {
+		return nil
+	}
+	return canonical
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Pause suspends the CDN download of the running task. The task keeps running,
+// so that the clients can still pull the pieces downloaded, and it doesn't hold
+// the concurrency of the source until it's resumed.
+func (tm *Manager) Pause(ctx context.Context, taskID string) error {
+	tm.taskLocker.GetLock(taskID, false)
+	defer tm.taskLocker.ReleaseLock(taskID, false)
+
+	task, err := tm.getTask(taskID)
+	if err != nil {
+		return err
+	}
+	if tm.isPaused(taskID) {
+		return nil
+	}
+	if task.CdnStatus != types.TaskInfoCdnStatusRUNNING {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "the CDN of taskID %s is %s, not running", taskID, task.CdnStatus)
+	}
+
+	tm.pausedTasks.Add(taskID, true)
+	if err := tm.cdnMgr.Pause(ctx, taskID); err != nil {
+		tm.pausedTasks.Delete(taskID)
+		return errors.Wrapf(err, "failed to pause taskID %s", taskID)
+	}
+	logrus.Infof("success to pause taskID: %s", taskID)
+	return nil
+}
+
+// Resume triggers the CDN of the paused task again, which continues
+// the download from the pieces downloaded before it's paused.
+func (tm *Manager) Resume(ctx context.Context, taskID string) error {
+	tm.taskLocker.GetLock(taskID, false)
+	defer tm.taskLocker.ReleaseLock(taskID, false)
+
+	task, err := tm.getTask(taskID)
+	if err != nil {
+		return err
+	}
+	if !tm.isPaused(taskID) {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "taskID %s is not paused", taskID)
+	}
+
+	tm.pausedTasks.Delete(taskID)
+	tm.recordTaskEvent(ctx, taskID, mgr.TaskEventDownloadStarted, "resumed")
+	tm.startCDN(ctx, task)
+	logrus.Infof("success to resume taskID: %s", taskID)
+	return nil
+}
+
+// isPaused returns whether the CDN download of the task is paused.
+func (tm *Manager) isPaused(taskID string) bool {
+	_, err := tm.pausedTasks.Get(taskID)
+	return err == nil
+}
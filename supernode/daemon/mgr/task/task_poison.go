@@ -0,0 +1,66 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// shouldPoison returns whether the task failing the CDN with err should be poisoned,
+// which is the case that the content served before the whole content is verified
+// turns out to be different from the expected one.
+func (tm *Manager) shouldPoison(err error) bool {
+	if tm.cfg.ContentServingPolicy != config.ContentServingFirstByte {
+		return false
+	}
+	return errortypes.IsMd5Mismatch(err) || errortypes.IsContentLengthMismatch(err)
+}
+
+// poisonTask detaches the clients of the task with the ErrTaskPoisoned, so that they
+// discard the pieces downloaded, and deletes the file of the task. The task is kept
+// with the failed status, and its registrations are refused until it's purged.
+func (tm *Manager) poisonTask(ctx context.Context, taskID string, reason error) {
+	tm.taskLocker.GetLock(taskID, false)
+	defer tm.taskLocker.ReleaseLock(taskID, false)
+
+	poisoned := errors.Wrapf(errortypes.ErrTaskPoisoned, "taskID %s: %v", taskID, reason)
+	tm.poisonedTasks.Add(taskID, poisoned)
+	if err := tm.clearTask(ctx, taskID, poisoned); err != nil {
+		logrus.Errorf("failed to clear the poisoned taskID(%s): %v", taskID, err)
+		return
+	}
+	logrus.Warnf("success to poison taskID(%s): %v", taskID, reason)
+}
+
+// getPoisonedReason returns the error why the task is poisoned, or nil if it isn't.
+func (tm *Manager) getPoisonedReason(taskID string) error {
+	v, err := tm.poisonedTasks.Get(taskID)
+	if err != nil {
+		return nil
+	}
+	reason, ok := v.(error)
+	if !ok {
+		return nil
+	}
+	return reason
+}
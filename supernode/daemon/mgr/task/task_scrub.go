@@ -0,0 +1,106 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/timeutils"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	corruptionDetectorRead  = "read"
+	corruptionDetectorScrub = "scrub"
+)
+
+// EvictCorrupted evicts the task whose stored pieces are found corrupted while serving them.
+func (tm *Manager) EvictCorrupted(ctx context.Context, taskID string, reason error) error {
+	if !errortypes.IsContentCorrupted(reason) {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "reason: %v", reason)
+	}
+	return tm.evictCorrupted(ctx, taskID, reason, corruptionDetectorRead)
+}
+
+// evictCorrupted purges the corrupted task, and its clients are told that it's purged
+// for the corruption when they pull the pieces.
+func (tm *Manager) evictCorrupted(ctx context.Context, taskID string, reason error, detector string) error {
+	if _, err := tm.getTask(taskID); err != nil {
+		return err
+	}
+	purged := errors.Wrapf(errortypes.ErrTaskPurged, "taskID %s: %v", taskID, reason)
+	if err := tm.purgeTask(ctx, taskID, purged); err != nil {
+		return err
+	}
+	tm.metrics.corruptedTasksEvicted.WithLabelValues(detector).Inc()
+	logrus.Warnf("success to evict the corrupted taskID(%s) detected by %s: %v", taskID, detector, reason)
+	return nil
+}
+
+// startScrubber verifies the cached files of the idle tasks periodically
+// until the scrubbing is disabled.
+func (tm *Manager) startScrubber() {
+	if !tm.isScrubberEnabled() {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(tm.cfg.ScrubInterval)
+			tm.scrub(context.Background())
+		}
+	}()
+}
+
+// scrub verifies the cached files of the successful tasks which haven't been accessed
+// within the ScrubInterval, and evicts the tasks whose files are corrupted.
+func (tm *Manager) scrub(ctx context.Context) {
+	idleBefore := timeutils.GetCurrentTimeMillis() - int64(tm.cfg.ScrubInterval/time.Millisecond)
+	for _, v := range tm.taskStore.List() {
+		task, ok := v.(*types.TaskInfo)
+		if !ok || task.CdnStatus != types.TaskInfoCdnStatusSUCCESS {
+			continue
+		}
+		taskID := task.ID
+		if v, err := tm.accessTimeMap.Get(taskID); err == nil {
+			if accessTime, ok := v.(int64); ok && accessTime > idleBefore {
+				continue
+			}
+		}
+
+		err := tm.cdnMgr.VerifyFile(ctx, taskID)
+		if err == nil {
+			continue
+		}
+		if !errortypes.IsContentCorrupted(err) {
+			logrus.Warnf("failed to scrub taskID(%s): %v", taskID, err)
+			continue
+		}
+		if err := tm.evictCorrupted(ctx, taskID, err, corruptionDetectorScrub); err != nil {
+			logrus.Errorf("failed to evict the corrupted taskID(%s): %v", taskID, err)
+		}
+	}
+}
+
+func (tm *Manager) isScrubberEnabled() bool {
+	return tm.cfg != nil && tm.cfg.BaseProperties != nil && tm.cfg.ScrubInterval > 0
+}
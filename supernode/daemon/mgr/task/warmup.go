@@ -0,0 +1,57 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WarmupTag is the tag of the tasks registered by Warmup, which can be used
+// to cancel or purge them as the other tags.
+const WarmupTag = "warmup"
+
+// Warmup registers the tasks of the files with the WarmupTag and preheats them.
+// The files which fail to register are logged and skipped, so that one unreachable
+// source doesn't stop the others from being cached.
+func (tm *Manager) Warmup(ctx context.Context, tasks []config.WarmupTask) ([]string, error) {
+	for _, t := range tasks {
+		if !netutils.IsValidURL(t.URL) {
+			logrus.Warnf("ignore the warmup task with invalid url: %s", t.URL)
+			continue
+		}
+
+		task, err := tm.addOrUpdateTask(ctx, &types.TaskCreateRequest{
+			RawURL:  t.URL,
+			Headers: t.Headers,
+			Tags:    []string{WarmupTag},
+		}, tm.cfg.FailAccessInterval*time.Minute)
+		if err != nil {
+			logrus.Warnf("failed to register the warmup task with url %s: %v", t.URL, err)
+			continue
+		}
+		tm.touchTask(task.ID)
+	}
+
+	return tm.Preheat(ctx, WarmupTag)
+}
@@ -56,6 +56,49 @@ type TaskMgr interface {
 	// NOTE: delete the related peers and dfgetTask info is necessary.
 	Delete(ctx context.Context, taskID string) error
 
+	// Purge evicts the tasks whose url, digest or tag matches from the cache,
+	// and detaches the clients which are downloading them.
+	// The url ending with "*" matches all urls with the prefix before it.
+	// And the next registration of a purged task will download the file from source again.
+	Purge(ctx context.Context, url, digest, tag string) (taskIDs []string, err error)
+
+	// Preheat triggers the CDN of the tasks with the tag which haven't been cached.
+	Preheat(ctx context.Context, tag string) (taskIDs []string, err error)
+
+	// Warmup registers the tasks of the files without clients and preheats them,
+	// so that the files are cached before the clients request them.
+	Warmup(ctx context.Context, tasks []config.WarmupTask) (taskIDs []string, err error)
+
+	// Cancel cancels the running CDN of the tasks with the tag and abandons them.
+	Cancel(ctx context.Context, tag string) (taskIDs []string, err error)
+
+	// Pause suspends the CDN download of the running task, and keeps the pieces downloaded
+	// which can still be pulled by the clients.
+	Pause(ctx context.Context, taskID string) error
+
+	// Resume continues the CDN download of the paused task from the pieces downloaded.
+	Resume(ctx context.Context, taskID string) error
+
+	// EvictCorrupted evicts the task whose stored pieces are found corrupted while serving them,
+	// and detaches the clients downloading it, so that the next registration downloads it from source again.
+	EvictCorrupted(ctx context.Context, taskID string, reason error) error
+
+	// RegisterArchive registers an archive assembling the files of multiple sources,
+	// whose members are downloaded as the tasks and served as a tar stream once cached.
+	RegisterArchive(ctx context.Context, req *types.ArchiveCreateRequest) (*types.ArchiveInfo, error)
+
+	// GetArchive gets the archive with the status of its members.
+	GetArchive(ctx context.Context, archiveID string) (*types.ArchiveInfo, error)
+
+	// ReadThrough registers the task of the source without any client and triggers its CDN,
+	// so that the file is read through supernode by the proxy and cached for the later downloads.
+	// The task is returned as it was before the CDN is triggered.
+	ReadThrough(ctx context.Context, req *types.TaskCreateRequest) (*types.TaskInfo, error)
+
+	// ProbeOrigin checks whether supernode can reach and authenticate to the source
+	// without downloading it, and reports the observed size and latency or the classified failure.
+	ProbeOrigin(ctx context.Context, req *types.OriginProbeRequest) (*types.OriginProbeResult, error)
+
 	// Update updates the task info with specified info.
 	// In common, there are several situations that we will use this method:
 	// 1. when finished to download, update task status.
@@ -72,4 +115,8 @@ type TaskMgr interface {
 	// We use a sting called pieceRange to identify a piece.
 	// A pieceRange separated by a dash, like this: 0-45565, etc.
 	UpdatePieceStatus(ctx context.Context, taskID, pieceRange string, pieceUpdateRequest *types.PieceUpdateRequest) error
+
+	// RenewClient renews the lease of the client on the task to keep it from being
+	// detached as inactive while it makes no download progress.
+	RenewClient(ctx context.Context, taskID, clientID string) error
 }
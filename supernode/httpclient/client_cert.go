@@ -0,0 +1,148 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// clientCert is the client certificate presented to a source requiring the mutual TLS,
+// which is loaded again on the handshake after its files are modified.
+type clientCert struct {
+	certFile string
+	keyFile  string
+	// roots verifies the source, which is nil to use the system roots.
+	roots *x509.CertPool
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+	// modTime is the latest modification time of the files loaded.
+	modTime time.Time
+}
+
+// newClientCert returns a new clientCert, and the certificate itself
+// is loaded on the first handshake requesting it.
+func newClientCert(cfg config.OriginClientCert) (*clientCert, error) {
+	cc := &clientCert{
+		certFile: cfg.Cert,
+		keyFile:  cfg.Key,
+	}
+	if cfg.CA == "" {
+		return cc, nil
+	}
+
+	caBytes, err := ioutil.ReadFile(cfg.CA)
+	if err != nil {
+		return nil, err
+	}
+	cc.roots = x509.NewCertPool()
+	if !cc.roots.AppendCertsFromPEM(caBytes) {
+		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "no certificate in %s", cfg.CA)
+	}
+	return cc, nil
+}
+
+// get returns the certificate as the GetClientCertificate of tls.Config.
+// The certificate loaded before is kept if the modified files fail to be loaded,
+// such as being written partially, and they're loaded again on the next handshake.
+func (cc *clientCert) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	modTime, err := latestModTime(cc.certFile, cc.keyFile)
+	if err == nil && !modTime.Equal(cc.modTime) {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(cc.certFile, cc.keyFile); err == nil {
+			if cc.cert != nil {
+				logrus.Infof("reload the client certificate %s", cc.certFile)
+			}
+			cc.cert = &cert
+			cc.modTime = modTime
+		}
+	}
+	if err != nil {
+		if cc.cert == nil {
+			return nil, errors.Wrapf(err, "failed to load the client certificate %s", cc.certFile)
+		}
+		logrus.Warnf("keep the client certificate loaded before since failed to reload %s: %v", cc.certFile, err)
+	}
+	return cc.cert, nil
+}
+
+// tlsConfig returns the tls config presenting the certificate, and the roots of it
+// are used to verify the source if the task carries no roots.
+func (cc *clientCert) tlsConfig(insecure bool, roots *x509.CertPool) *tls.Config {
+	if roots == nil {
+		roots = cc.roots
+	}
+	return &tls.Config{
+		InsecureSkipVerify:   insecure,
+		RootCAs:              roots,
+		GetClientCertificate: cc.get,
+	}
+}
+
+// latestModTime returns the latest modification time of the files.
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// newClientCerts returns the client certificates of the hosts,
+// and the host whose certificate is misconfigured is skipped.
+func newClientCerts(certs map[string]config.OriginClientCert) map[string]*clientCert {
+	clientCerts := make(map[string]*clientCert)
+	for host, cfg := range certs {
+		cc, err := newClientCert(cfg)
+		if err != nil {
+			logrus.Errorf("failed to init the client certificate of the source host %s: %v", host, err)
+			continue
+		}
+		clientCerts[host] = cc
+	}
+	return clientCerts
+}
+
+// registerClientCerts stores the clients presenting the certificates of the hosts
+// into the clientMap, so the requests to the hosts are authenticated with them.
+// And the policy is enforced on the tls configs of them.
+func registerClientCerts(clientMap *sync.Map, clientCerts map[string]*clientCert, maxHeaderBytes int64, policy *tlsPolicy) {
+	for host, cc := range clientCerts {
+		logrus.Infof("requests to the source host %s present the client certificate %s", host, cc.certFile)
+		clientMap.Store(host, newTLSClient(policy.apply(cc.tlsConfig(false, nil)), maxHeaderBytes))
+	}
+}
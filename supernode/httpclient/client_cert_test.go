@@ -0,0 +1,161 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type ClientCertTestSuite struct{}
+
+func init() {
+	check.Suite(&ClientCertTestSuite{})
+}
+
+// newCertificate creates a certificate of the commonName signed by the parent,
+// and it's self-signed as a CA if the parent is nil.
+func newCertificate(c *check.C, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	c.Assert(err, check.IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, check.IsNil)
+	return cert, key
+}
+
+// writeKeyPair writes the certificate and its key in PEM into the files.
+func writeKeyPair(c *check.C, cert *x509.Certificate, key *ecdsa.PrivateKey, certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, check.IsNil)
+	c.Assert(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600), check.IsNil)
+	c.Assert(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600), check.IsNil)
+}
+
+func (s *ClientCertTestSuite) TestDownloadWithClientCert(c *check.C) {
+	ca, caKey := newCertificate(c, "ca", nil, nil)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	var commonNames []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commonNames = append(commonNames, r.TLS.PeerCertificates[0].Subject.CommonName)
+		// a new handshake for every request to present the certificate again
+		w.Header().Set("Connection", "close")
+		w.Write([]byte("dragonfly"))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+	url := server.URL + "/file"
+	host := server.Listener.Addr().String()
+
+	dir := c.MkDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"), filepath.Join(dir, "ca.crt")
+	cert, key := newCertificate(c, "client-1", ca, caKey)
+	writeKeyPair(c, cert, key, certFile, keyFile)
+	c.Assert(ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600), check.IsNil)
+
+	// the origin refuses the client without the certificate
+	client := NewOriginClientWithConfig(config.NewConfig(), prometheus.NewRegistry())
+	client.RegisterTLSConfig(url, true, nil)
+	_, err := client.Download(url, nil, http.StatusOK)
+	c.Check(err, check.NotNil)
+
+	cfg := config.NewConfig()
+	cfg.OriginClientCerts = map[string]config.OriginClientCert{
+		host: {Cert: certFile, Key: keyFile, CA: caFile},
+	}
+	client = NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+	download := func() {
+		resp, err := client.Download(url, nil, http.StatusOK)
+		c.Assert(err, check.IsNil)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		c.Assert(err, check.IsNil)
+		c.Check(string(body), check.Equals, "dragonfly")
+	}
+	download()
+
+	// the certificate is kept when the task registers the tls config of the host
+	client.RegisterTLSConfig(url, false, nil)
+	download()
+
+	// and reloaded after rotated
+	cert, key = newCertificate(c, "client-2", ca, caKey)
+	writeKeyPair(c, cert, key, certFile, keyFile)
+	modTime := time.Now().Add(time.Minute)
+	c.Assert(os.Chtimes(certFile, modTime, modTime), check.IsNil)
+	download()
+
+	// the certificate loaded before is kept if the new one is broken
+	c.Assert(ioutil.WriteFile(keyFile, []byte("broken"), 0600), check.IsNil)
+	download()
+	c.Check(commonNames, check.DeepEquals, []string{"client-1", "client-1", "client-2", "client-2"})
+}
+
+func (s *ClientCertTestSuite) TestNewClientCerts(c *check.C) {
+	dir := c.MkDir()
+	badCA := filepath.Join(dir, "bad.crt")
+	c.Assert(ioutil.WriteFile(badCA, []byte("not a certificate"), 0600), check.IsNil)
+
+	clientCerts := newClientCerts(map[string]config.OriginClientCert{
+		"a.com": {Cert: "a.crt", Key: "a.key"},
+		"b.com": {Cert: "b.crt", Key: "b.key", CA: badCA},
+		"c.com": {Cert: "c.crt", Key: "c.key", CA: filepath.Join(dir, "missing.crt")},
+	})
+	c.Assert(clientCerts, check.HasLen, 1)
+
+	// the certificate missing fails the handshake
+	_, err := clientCerts["a.com"].get(nil)
+	c.Check(err, check.NotNil)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"net/http"
+	netUrl "net/url"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// conditionalTracker records the hosts of the sources which ignore the conditional requests,
+// i.e. respond 200 with the unchanged validator to the If-None-Match or If-Modified-Since.
+type conditionalTracker struct {
+	threshold int
+	period    time.Duration
+
+	mu sync.Mutex
+	// hosts contains the states of the hosts responding to the conditional requests.
+	hosts map[string]*conditionalState
+}
+
+// conditionalState is the behavior of a host responding to the conditional requests.
+type conditionalState struct {
+	// ignored is the number of the conditional requests ignored by the host in a row.
+	ignored int
+	// ignoringUntil is the time until which the host is regarded as ignoring the conditional requests.
+	ignoringUntil time.Time
+}
+
+// newConditionalTracker returns a new conditionalTracker, which is nil if the detection is disabled.
+func newConditionalTracker(threshold int, period time.Duration) *conditionalTracker {
+	if threshold <= 0 || period <= 0 {
+		return nil
+	}
+	return &conditionalTracker{
+		threshold: threshold,
+		period:    period,
+		hosts:     make(map[string]*conditionalState),
+	}
+}
+
+// ignoring returns whether the host is regarded as ignoring the conditional requests now.
+func (ct *conditionalTracker) ignoring(host string) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	state, ok := ct.hosts[host]
+	return ok && time.Now().Before(state.ignoringUntil)
+}
+
+// record records whether the host ignored a conditional request, and the host is regarded
+// as ignoring them for the period once it has ignored the threshold ones in a row.
+func (ct *conditionalTracker) record(host string, ignored bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if !ignored {
+		delete(ct.hosts, host)
+		return
+	}
+
+	state, ok := ct.hosts[host]
+	if !ok {
+		state = &conditionalState{}
+		ct.hosts[host] = state
+	}
+	state.ignored++
+	if state.ignored >= ct.threshold {
+		state.ignored = 0
+		state.ignoringUntil = time.Now().Add(ct.period)
+		logrus.Warnf("the source host %s ignores the conditional requests, stop revalidating its files for %v",
+			host, ct.period)
+	}
+}
+
+// IgnoresConditional returns whether the host of the url is regarded as ignoring
+// the conditional requests, whose files should not be revalidated by IsExpired.
+func (client *OriginClient) IgnoresConditional(url string) bool {
+	if client.conditionals == nil {
+		return false
+	}
+	u, err := netUrl.Parse(url)
+	if err != nil {
+		return false
+	}
+	return client.conditionals.ignoring(u.Host)
+}
+
+// recordConditional records whether the host of the url ignored the conditional request.
+func (client *OriginClient) recordConditional(url string, ignored bool) {
+	if client.conditionals == nil {
+		return
+	}
+	u, err := netUrl.Parse(url)
+	if err != nil {
+		return
+	}
+	client.conditionals.record(u.Host, ignored)
+}
+
+// isValidatorUnchanged returns whether the response carries the same validator
+// as the one sent by the conditional request, preferring the ETag.
+func isValidatorUnchanged(resp *http.Response, lastModified int64, eTag string) bool {
+	if eTag != "" {
+		return resp.Header.Get("ETag") == eTag
+	}
+	respLastModified, err := netutils.ConvertTimeStringToInt(resp.Header.Get("Last-Modified"))
+	return err == nil && lastModified > 0 && respLastModified == lastModified
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const conditionalTestETag = `"foo-etag"`
+
+type ConditionalTrackerTestSuite struct{}
+
+func init() {
+	check.Suite(&ConditionalTrackerTestSuite{})
+}
+
+// newIgnoringServer returns a source which ignores the conditional requests,
+// and always responds the whole file with the unchanged ETag.
+func newIgnoringServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", conditionalTestETag)
+		w.Write([]byte("dragonfly"))
+	}))
+}
+
+func (s *ConditionalTrackerTestSuite) TestExpiredWhenDetectionDisabled(c *check.C) {
+	server := newIgnoringServer()
+	defer server.Close()
+
+	client := NewOriginClientWithConfig(config.NewConfig(), prometheus.NewRegistry())
+	for i := 0; i < 5; i++ {
+		expired, err := client.IsExpired(server.URL, nil, 0, conditionalTestETag)
+		c.Assert(err, check.IsNil)
+		c.Check(expired, check.Equals, true)
+	}
+	c.Check(client.IgnoresConditional(server.URL), check.Equals, false)
+}
+
+func (s *ConditionalTrackerTestSuite) TestDetectSourceIgnoringConditional(c *check.C) {
+	server := newIgnoringServer()
+	defer server.Close()
+
+	cfg := config.NewConfig()
+	cfg.OriginIgnoreConditionalThreshold = 2
+	cfg.OriginIgnoreConditionalPeriod = time.Minute
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+
+	expired, err := client.IsExpired(server.URL, nil, 0, conditionalTestETag)
+	c.Assert(err, check.IsNil)
+	c.Check(expired, check.Equals, false)
+	c.Check(client.IgnoresConditional(server.URL), check.Equals, false)
+
+	_, err = client.IsExpired(server.URL, nil, 0, conditionalTestETag)
+	c.Assert(err, check.IsNil)
+	c.Check(client.IgnoresConditional(server.URL), check.Equals, true)
+
+	// the changed validator is still expired
+	expired, err = client.IsExpired(server.URL, nil, 0, `"bar-etag"`)
+	c.Assert(err, check.IsNil)
+	c.Check(expired, check.Equals, true)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"net/http/cookiejar"
+	"sync"
+)
+
+// TaskScopedClient is implemented by the OriginHTTPClient which keeps the state
+// of the requests of a task, such as the cookies set by the source.
+type TaskScopedClient interface {
+	// ForTask returns the client whose requests share the state of the task.
+	ForTask(taskID string) OriginHTTPClient
+
+	// ReleaseTask discards the state of the task.
+	ReleaseTask(taskID string)
+}
+
+// ForTask returns the client scoped to the task if client is a TaskScopedClient,
+// otherwise client itself is returned.
+func ForTask(client OriginHTTPClient, taskID string) OriginHTTPClient {
+	if scoped, ok := client.(TaskScopedClient); ok {
+		return scoped.ForTask(taskID)
+	}
+	return client
+}
+
+// ReleaseTask discards the state of the task if client is a TaskScopedClient.
+func ReleaseTask(client OriginHTTPClient, taskID string) {
+	if scoped, ok := client.(TaskScopedClient); ok {
+		scoped.ReleaseTask(taskID)
+	}
+}
+
+// ForTask returns the client which carries the cookies set by the source in the responses
+// of the task into its following requests if the cookie jars are enabled, and requests
+// the cached final URLs of the task if the redirect cache is enabled.
+// Otherwise the client itself is returned.
+func (client *OriginClient) ForTask(taskID string) OriginHTTPClient {
+	if client.jars == nil && client.redirectCache == nil {
+		return client
+	}
+
+	scoped := *client
+	if client.jars != nil {
+		jar, _ := cookiejar.New(nil)
+		actual, _ := client.jars.LoadOrStore(taskID, jar)
+		scoped.jar = actual.(*cookiejar.Jar)
+	}
+	if client.redirectCache != nil {
+		scoped.redirects = client.redirectCache.forTask(taskID)
+	}
+	return &scoped
+}
+
+// ReleaseTask discards the cookie jar and the final URLs of the task.
+func (client *OriginClient) ReleaseTask(taskID string) {
+	if client.jars != nil {
+		client.jars.Delete(taskID)
+	}
+	if client.redirectCache != nil {
+		client.redirectCache.release(taskID)
+	}
+}
+
+// newCookieJars returns the map of the cookie jars of the tasks,
+// which is nil if the cookie jars are disabled.
+func newCookieJars(enabled bool) *sync.Map {
+	if !enabled {
+		return nil
+	}
+	return &sync.Map{}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type CookieJarTestSuite struct{}
+
+func init() {
+	check.Suite(&CookieJarTestSuite{})
+}
+
+// newSessionServer returns the source which sets a session cookie on the first response,
+// and the range requests must carry the cookie.
+func newSessionServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			if r.Header.Get("Range") != "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "foo", Path: "/"})
+			w.Write([]byte("0123456789"))
+			return
+		}
+		if r.Header.Get("Range") != "" {
+			w.Header().Set("Content-Range", "bytes 5-9/10")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("56789"))
+			return
+		}
+		w.Write([]byte("0123456789"))
+	}))
+}
+
+func (s *CookieJarTestSuite) TestCarryCookiesOfTask(c *check.C) {
+	server := newSessionServer()
+	defer server.Close()
+	rangeHeaders := map[string]string{"Range": "bytes=5-9"}
+
+	cfg := config.NewConfig()
+	cfg.OriginCookieJar = true
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+
+	// the cookie set on the first response is carried into the range request of the task
+	_, code, err := ForTask(client, "task1").GetContentLength(server.URL, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusOK)
+	resp, err := ForTask(client, "task1").Download(server.URL, rangeHeaders, http.StatusPartialContent)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+
+	// but never into the requests of the other tasks
+	_, err = ForTask(client, "task2").Download(server.URL, rangeHeaders, http.StatusPartialContent)
+	c.Check(err, check.NotNil)
+	_, err = client.Download(server.URL, rangeHeaders, http.StatusPartialContent)
+	c.Check(err, check.NotNil)
+
+	// and it's discarded after the task is released
+	ReleaseTask(client, "task1")
+	_, err = ForTask(client, "task1").Download(server.URL, rangeHeaders, http.StatusPartialContent)
+	c.Check(err, check.NotNil)
+}
+
+func (s *CookieJarTestSuite) TestCookieJarDisabled(c *check.C) {
+	server := newSessionServer()
+	defer server.Close()
+
+	client := NewOriginClientWithConfig(config.NewConfig(), prometheus.NewRegistry())
+	c.Check(ForTask(client, "task"), check.Equals, client)
+
+	_, _, err := ForTask(client, "task").GetContentLength(server.URL, nil)
+	c.Assert(err, check.IsNil)
+	_, err = ForTask(client, "task").Download(server.URL, map[string]string{"Range": "bytes=5-9"}, http.StatusPartialContent)
+	c.Check(err, check.NotNil)
+}
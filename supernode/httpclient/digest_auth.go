@@ -0,0 +1,227 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+)
+
+// digestScheme is the scheme of the HTTP Digest authentication.
+const digestScheme = "Digest"
+
+// digestAuth authorizes the requests to the hosts of the sources
+// which require the HTTP Digest authentication.
+type digestAuth struct {
+	credentials map[string]config.OriginCredential
+	// challenges contains the latest challenges of the hosts.
+	// key:host,value:*digestChallenge
+	challenges *sync.Map
+}
+
+// digestChallenge is a Digest challenge of a host, whose nonce is reused
+// by the following requests to the host with an increasing nonce count.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+
+	sync.Mutex
+	nonceCount int
+}
+
+// newDigestAuth returns a new digestAuth, which is nil if no credential is configured.
+func newDigestAuth(credentials map[string]config.OriginCredential) *digestAuth {
+	if len(credentials) == 0 {
+		return nil
+	}
+	return &digestAuth{
+		credentials: credentials,
+		challenges:  &sync.Map{},
+	}
+}
+
+// authorize sets the Authorization header of the request
+// with the latest challenge of the host if any.
+func (d *digestAuth) authorize(req *http.Request) {
+	credential, ok := d.credentials[req.URL.Host]
+	if !ok {
+		return
+	}
+	v, ok := d.challenges.Load(req.URL.Host)
+	if !ok {
+		return
+	}
+	req.Header.Set("Authorization", v.(*digestChallenge).authorization(req, credential))
+}
+
+// challenge returns whether the response is a Digest challenge to the request
+// which can be answered by the credential of the host, and the challenge is kept
+// to authorize the requests to the host.
+func (d *digestAuth) challenge(req *http.Request, resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	if _, ok := d.credentials[req.URL.Host]; !ok {
+		return false
+	}
+
+	for _, header := range resp.Header[http.CanonicalHeaderKey("WWW-Authenticate")] {
+		if c := parseDigestChallenge(header); c != nil {
+			d.challenges.Store(req.URL.Host, c)
+			return true
+		}
+	}
+	return false
+}
+
+// authorization returns the value of the Authorization header of the request
+// which responds to the challenge with the credential.
+func (c *digestChallenge) authorization(req *http.Request, credential config.OriginCredential) string {
+	c.Lock()
+	c.nonceCount++
+	nc := fmt.Sprintf("%08x", c.nonceCount)
+	c.Unlock()
+
+	cnonce := newCnonce()
+	uri := req.URL.RequestURI()
+	ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", credential.Username, c.realm, credential.Password))
+	if strings.EqualFold(c.algorithm, "MD5-sess") {
+		ha1 = md5Hex(fmt.Sprintf("%s:%s:%s", ha1, c.nonce, cnonce))
+	}
+	ha2 := md5Hex(fmt.Sprintf("%s:%s", req.Method, uri))
+
+	var response string
+	if c.qop == "" {
+		response = md5Hex(fmt.Sprintf("%s:%s:%s", ha1, c.nonce, ha2))
+	} else {
+		response = md5Hex(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, c.nonce, nc, cnonce, c.qop, ha2))
+	}
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, credential.Username),
+		fmt.Sprintf(`realm="%s"`, c.realm),
+		fmt.Sprintf(`nonce="%s"`, c.nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if c.algorithm != "" {
+		fields = append(fields, fmt.Sprintf("algorithm=%s", c.algorithm))
+	}
+	if c.opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, c.opaque))
+	}
+	if c.qop != "" {
+		fields = append(fields, fmt.Sprintf("qop=%s", c.qop), fmt.Sprintf("nc=%s", nc), fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	return digestScheme + " " + strings.Join(fields, ", ")
+}
+
+// parseDigestChallenge parses the value of the WWW-Authenticate header,
+// and returns nil if it's not a Digest challenge which can be answered.
+// Only the MD5 and MD5-sess algorithms and the auth protection are supported.
+func parseDigestChallenge(header string) *digestChallenge {
+	if len(header) <= len(digestScheme) || !strings.EqualFold(header[:len(digestScheme)], digestScheme) ||
+		header[len(digestScheme)] != ' ' {
+		return nil
+	}
+
+	params := parseAuthParams(header[len(digestScheme)+1:])
+	c := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+	}
+	if c.nonce == "" {
+		return nil
+	}
+	if c.algorithm != "" && !strings.EqualFold(c.algorithm, "MD5") && !strings.EqualFold(c.algorithm, "MD5-sess") {
+		return nil
+	}
+	if qop, ok := params["qop"]; ok {
+		for _, v := range strings.Split(qop, ",") {
+			if strings.TrimSpace(v) == "auth" {
+				c.qop = "auth"
+			}
+		}
+		if c.qop == "" {
+			return nil
+		}
+	}
+	return c
+}
+
+// parseAuthParams parses the comma separated auth params,
+// whose values may be quoted strings containing commas.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+}
+
+func newCnonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type DigestAuthTestSuite struct{}
+
+func init() {
+	check.Suite(&DigestAuthTestSuite{})
+}
+
+// digestServer is a source requiring the Digest authentication,
+// which issues a new nonce when the current one is expired.
+type digestServer struct {
+	sync.Mutex
+	nonce      string
+	nonceCount int
+	challenges int
+}
+
+func (ds *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if !ds.verify(r) {
+		ds.challenges++
+		w.Header().Add("WWW-Authenticate", `Basic realm="dragonfly"`)
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(
+			`Digest realm="dragonfly", qop="auth,auth-int", nonce="%s", opaque="foo, bar", algorithm=MD5`, ds.nonce))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Range") != "" {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	fmt.Fprint(w, "hello")
+}
+
+func (ds *digestServer) verify(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Digest ") {
+		return false
+	}
+	params := parseAuthParams(strings.TrimPrefix(header, "Digest "))
+	if params["nonce"] != ds.nonce || params["opaque"] != "foo, bar" || params["uri"] != r.URL.RequestURI() {
+		return false
+	}
+
+	var nc int
+	if _, err := fmt.Sscanf(params["nc"], "%x", &nc); err != nil || nc <= ds.nonceCount {
+		return false
+	}
+	ha1 := md5Hex("foo:dragonfly:bar")
+	ha2 := md5Hex(r.Method + ":" + params["uri"])
+	expected := md5Hex(strings.Join([]string{ha1, ds.nonce, params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+	if params["response"] != expected {
+		return false
+	}
+	ds.nonceCount = nc
+	return true
+}
+
+func (ds *digestServer) expireNonce(nonce string) {
+	ds.Lock()
+	defer ds.Unlock()
+	ds.nonce = nonce
+	ds.nonceCount = 0
+}
+
+func (s *DigestAuthTestSuite) TestDigestAuth(c *check.C) {
+	ds := &digestServer{nonce: "nonce1"}
+	server := httptest.NewServer(ds)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	cfg := config.NewConfig()
+	cfg.OriginDigestAuth = map[string]config.OriginCredential{
+		serverURL.Host: {Username: "foo", Password: "bar"},
+	}
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+
+	// the first request is retried with the response to the challenge
+	resp, err := client.Download(server.URL+"/file?a=1", nil, http.StatusOK)
+	c.Assert(err, check.IsNil)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Check(string(body), check.Equals, "hello")
+	c.Check(ds.challenges, check.Equals, 1)
+
+	// the following range requests reuse the nonce without being challenged
+	for i := 0; i < 3; i++ {
+		resp, err = client.Download(server.URL+"/file?a=1", map[string]string{"Range": "bytes=1-"}, http.StatusPartialContent)
+		c.Assert(err, check.IsNil)
+		resp.Body.Close()
+	}
+	c.Check(ds.challenges, check.Equals, 1)
+
+	// the request is challenged again once the nonce expires
+	ds.expireNonce("nonce2")
+	supportRange, err := client.IsSupportRange(server.URL+"/file", nil)
+	c.Assert(err, check.IsNil)
+	c.Check(supportRange, check.Equals, true)
+	c.Check(ds.challenges, check.Equals, 2)
+}
+
+func (s *DigestAuthTestSuite) TestDigestAuthWithoutCredential(c *check.C) {
+	ds := &digestServer{nonce: "nonce"}
+	server := httptest.NewServer(ds)
+	defer server.Close()
+
+	cfg := config.NewConfig()
+	cfg.OriginDigestAuth = map[string]config.OriginCredential{
+		"example.com": {Username: "foo", Password: "bar"},
+	}
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+
+	_, code, err := client.GetContentLength(server.URL, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusUnauthorized)
+	c.Check(ds.challenges, check.Equals, 1)
+}
+
+func (s *DigestAuthTestSuite) TestParseDigestChallenge(c *check.C) {
+	var cases = []struct {
+		header   string
+		expected *digestChallenge
+	}{
+		{
+			header:   `Digest realm="a, b", nonce="n\"1", qop="auth-int, auth", algorithm=MD5-sess`,
+			expected: &digestChallenge{realm: "a, b", nonce: `n"1`, qop: "auth", algorithm: "MD5-sess"},
+		},
+		{
+			header:   `digest nonce=n1,opaque="o"`,
+			expected: &digestChallenge{nonce: "n1", opaque: "o"},
+		},
+		{header: `Basic realm="a"`},
+		{header: `Digest realm="a"`},
+		{header: `Digest nonce="n1", qop="auth-int"`},
+		{header: `Digest nonce="n1", algorithm=SHA-256`},
+		{header: `Digest`},
+	}
+
+	for _, v := range cases {
+		c.Check(parseDigestChallenge(v.header), check.DeepEquals, v.expected, check.Commentf(v.header))
+	}
+}
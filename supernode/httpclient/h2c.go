@@ -0,0 +1,67 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+)
+
+// newH2CClient returns a client which requests the sources over HTTP/2 cleartext
+// with prior knowledge, which the http.Transport never negotiates without TLS.
+// The http2.Transport dials the plain TCP connection instead of the TLS one, and
+// multiplexes the requests to a host on it. And the response headers are limited to maxHeaderBytes.
+func newH2CClient(maxHeaderBytes int64) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   originDialTimeout,
+		KeepAlive: 30 * time.Second,
+		DualStack: true,
+	}
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.Dial(network, addr)
+		},
+		DisableCompression: true,
+	}
+	if maxHeaderBytes > 0 && maxHeaderBytes <= int64(^uint32(0)) {
+		transport.MaxHeaderListSize = uint32(maxHeaderBytes)
+	}
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// registerH2CHosts stores the clients requesting the hosts over HTTP/2 cleartext
+// into the clientMap, and they share one transport to reuse the connections.
+func registerH2CHosts(clientMap *sync.Map, hosts []string, maxHeaderBytes int64) {
+	if len(hosts) == 0 {
+		return
+	}
+
+	client := newH2CClient(maxHeaderBytes)
+	for _, host := range hosts {
+		logrus.Infof("requests to the source host %s are sent over HTTP/2 cleartext", host)
+		clientMap.Store(host, client)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	netUrl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type H2CTestSuite struct{}
+
+func init() {
+	check.Suite(&H2CTestSuite{})
+}
+
+func (s *H2CTestSuite) TestDownloadOverH2C(c *check.C) {
+	content := strings.Repeat("dragonfly", 100)
+	lastModified := time.Unix(1500000000, 0).UTC()
+	var (
+		mu     sync.Mutex
+		protos []int
+		conns  int
+	)
+	server := httptest.NewUnstartedServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		protos = append(protos, r.ProtoMajor)
+		mu.Unlock()
+		http.ServeContent(w, r, "file", lastModified, strings.NewReader(content))
+	}), &http2.Server{}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+	u, err := netUrl.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+
+	cfg := config.NewConfig()
+	cfg.OriginH2CHosts = []string{u.Host}
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+
+	// the h2c client is kept when the task registers the tls config of the host.
+	client.RegisterTLSConfig(server.URL+"/file", true, nil)
+
+	resp, err := client.Download(server.URL+"/file", nil, http.StatusOK)
+	c.Assert(err, check.IsNil)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, content)
+	c.Check(resp.ProtoMajor, check.Equals, 2)
+
+	// the range requests resume the download
+	resp, err = client.Download(server.URL+"/file", map[string]string{"Range": "bytes=9-17"}, http.StatusPartialContent)
+	c.Assert(err, check.IsNil)
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, content[9:18])
+
+	// and the conditional requests revalidate the cached file
+	expired, err := client.IsExpired(server.URL+"/file", nil, lastModified.UnixNano()/int64(time.Millisecond), "")
+	c.Assert(err, check.IsNil)
+	c.Check(expired, check.Equals, false)
+
+	length, code, err := client.GetContentLength(server.URL+"/file", nil)
+	c.Assert(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusOK)
+	c.Check(length, check.Equals, int64(len(content)))
+
+	// all the requests are sent over HTTP/2 and multiplexed on one connection
+	mu.Lock()
+	defer mu.Unlock()
+	c.Check(protos, check.DeepEquals, []int{2, 2, 2, 2})
+	c.Check(conns, check.Equals, 1)
+}
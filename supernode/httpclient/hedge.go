@@ -0,0 +1,148 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/metricsutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	attemptPrimary = "primary"
+	attemptHedge   = "hedge"
+)
+
+// hedger issues a hedged request in parallel if the first attempt
+// has not responded after a delay, and uses whichever responds first.
+// It should only be used for the idempotent requests.
+type hedger struct {
+	delay time.Duration
+	// slots bounds the number of the hedged requests in flight.
+	slots chan struct{}
+	// wins records which attempt wins.
+	wins *prometheus.CounterVec
+}
+
+// newHedger returns a new hedger, or nil if the hedging is disabled.
+func newHedger(delay time.Duration, maxHedges int, register prometheus.Registerer) *hedger {
+	if delay <= 0 || maxHedges <= 0 {
+		return nil
+	}
+	return &hedger{
+		delay: delay,
+		slots: make(chan struct{}, maxHedges),
+		wins: metricsutils.NewCounter(config.SubsystemSupernode, "origin_hedge_wins_total",
+			"Total times of the attempts winning the hedged requests to the source", []string{"attempt"}, register),
+	}
+}
+
+type attemptResult struct {
+	attempt string
+	resp    *http.Response
+	err     error
+}
+
+// do sends the request with send, and sends a hedged one if there is no response
+// after the delay and the hedged requests in flight don't reach the limit.
+// The response which comes first is returned and the other attempt is canceled.
+// If an attempt fails, the result of the other one is waited for.
+func (h *hedger) do(send func(ctx context.Context) (*http.Response, error)) (*http.Response, error) {
+	results := make(chan *attemptResult, 2)
+	cancels := make(map[string]context.CancelFunc, 2)
+	start := func(attempt string, done func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[attempt] = cancel
+		go func() {
+			resp, err := send(ctx)
+			if done != nil {
+				done()
+			}
+			results <- &attemptResult{attempt: attempt, resp: resp, err: err}
+		}()
+	}
+
+	start(attemptPrimary, nil)
+	pending := 1
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			select {
+			case h.slots <- struct{}{}:
+				logrus.Debugf("no response from the source after %v, send a hedged request", h.delay)
+				start(attemptHedge, func() { <-h.slots })
+				pending++
+			default:
+				logrus.Debugf("skip the hedged request since %d ones are in flight", cap(h.slots))
+			}
+		case result := <-results:
+			pending--
+			if result.err != nil {
+				cancels[result.attempt]()
+				lastErr = result.err
+				continue
+			}
+
+			// cancel the losers and release their responses.
+			for attempt, cancel := range cancels {
+				if attempt != result.attempt {
+					cancel()
+				}
+			}
+			go discardResults(results, pending)
+
+			h.wins.WithLabelValues(result.attempt).Inc()
+			if result.attempt == attemptHedge {
+				logrus.Infof("the hedged request wins with status code: %d", result.resp.StatusCode)
+			}
+			result.resp.Body = &cancelReadCloser{ReadCloser: result.resp.Body, cancel: cancels[result.attempt]}
+			return result.resp, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// discardResults closes the responses of the remaining count attempts.
+func discardResults(results <-chan *attemptResult, count int) {
+	for i := 0; i < count; i++ {
+		if result := <-results; result.resp != nil {
+			result.resp.Body.Close()
+		}
+	}
+}
+
+// cancelReadCloser cancels the context of the request when the response body is closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (rc *cancelReadCloser) Close() error {
+	defer rc.cancel()
+	return rc.ReadCloser.Close()
+}
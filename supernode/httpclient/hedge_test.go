@@ -0,0 +1,123 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type HedgeTestSuite struct{}
+
+func init() {
+	check.Suite(&HedgeTestSuite{})
+}
+
+func newHedgedClient(delay time.Duration) *OriginClient {
+	cfg := config.NewConfig()
+	cfg.OriginHedgeDelay = delay
+	return NewOriginClientWithConfig(cfg, prometheus.NewRegistry()).(*OriginClient)
+}
+
+func (s *HedgeTestSuite) TestHedgeWinsOverSlowPrimary(c *check.C) {
+	var requests int32
+	primaryCanceled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				close(primaryCanceled)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		fmt.Fprint(w, "hedged")
+	}))
+	defer server.Close()
+
+	client := newHedgedClient(50 * time.Millisecond)
+	resp, err := client.Download(server.URL, nil, http.StatusOK)
+	c.Assert(err, check.IsNil)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Body.Close(), check.IsNil)
+	c.Check(string(body), check.Equals, "hedged")
+	c.Check(atomic.LoadInt32(&requests), check.Equals, int32(2))
+
+	c.Check(int(prom_testutil.ToFloat64(client.hedger.wins.WithLabelValues(attemptHedge))), check.Equals, 1)
+	c.Check(int(prom_testutil.ToFloat64(client.hedger.wins.WithLabelValues(attemptPrimary))), check.Equals, 0)
+
+	select {
+	case <-primaryCanceled:
+	case <-time.After(3 * time.Second):
+		c.Fatal("the slow primary request is not canceled")
+	}
+}
+
+func (s *HedgeTestSuite) TestNoHedgeForFastPrimary(c *check.C) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, "primary")
+	}))
+	defer server.Close()
+
+	client := newHedgedClient(time.Second)
+	resp, err := client.Download(server.URL, nil, http.StatusOK)
+	c.Assert(err, check.IsNil)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Body.Close(), check.IsNil)
+	c.Check(string(body), check.Equals, "primary")
+	c.Check(atomic.LoadInt32(&requests), check.Equals, int32(1))
+	c.Check(int(prom_testutil.ToFloat64(client.hedger.wins.WithLabelValues(attemptPrimary))), check.Equals, 1)
+}
+
+func (s *HedgeTestSuite) TestHedgeBounded(c *check.C) {
+	h := newHedger(10*time.Millisecond, 1, prometheus.NewRegistry())
+	// occupy the only slot of the hedged requests
+	h.slots <- struct{}{}
+
+	var attempts int32
+	resp, err := h.do(func(ctx context.Context) (*http.Response, error) {
+		atomic.AddInt32(&attempts, 1)
+		time.Sleep(50 * time.Millisecond)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(atomic.LoadInt32(&attempts), check.Equals, int32(1))
+
+	c.Check(newHedger(0, 1, prometheus.NewRegistry()), check.IsNil)
+}
@@ -7,7 +7,9 @@ package mock
 import (
 	http "net/http"
 	reflect "reflect"
+	time "time"
 
+	types "github.com/dragonflyoss/Dragonfly/apis/types"
 	strfmt "github.com/go-openapi/strfmt"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -93,6 +95,20 @@ func (mr *MockOriginHTTPClientMockRecorder) IsExpired(url, headers, lastModified
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExpired", reflect.TypeOf((*MockOriginHTTPClient)(nil).IsExpired), url, headers, lastModified, eTag)
 }
 
+// IgnoresConditional mocks base method
+func (m *MockOriginHTTPClient) IgnoresConditional(url string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IgnoresConditional", url)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IgnoresConditional indicates an expected call of IgnoresConditional
+func (mr *MockOriginHTTPClientMockRecorder) IgnoresConditional(url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IgnoresConditional", reflect.TypeOf((*MockOriginHTTPClient)(nil).IgnoresConditional), url)
+}
+
 // Download mocks base method
 func (m *MockOriginHTTPClient) Download(url string, headers map[string]string, checkCode int) (*http.Response, error) {
 	m.ctrl.T.Helper()
@@ -107,3 +123,17 @@ func (mr *MockOriginHTTPClientMockRecorder) Download(url, headers, checkCode int
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockOriginHTTPClient)(nil).Download), url, headers, checkCode)
 }
+
+// Probe mocks base method
+func (m *MockOriginHTTPClient) Probe(url string, headers map[string]string, timeout time.Duration) *types.OriginProbeResult {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Probe", url, headers, timeout)
+	ret0, _ := ret[0].(*types.OriginProbeResult)
+	return ret0
+}
+
+// Probe indicates an expected call of Probe
+func (mr *MockOriginHTTPClientMockRecorder) Probe(url, headers, timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Probe", reflect.TypeOf((*MockOriginHTTPClient)(nil).Probe), url, headers, timeout)
+}
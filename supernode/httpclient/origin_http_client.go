@@ -24,46 +24,175 @@ import (
 	"net"
 	"net/http"
 	netUrl "net/url"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
 	"github.com/dragonflyoss/Dragonfly/pkg/stringutils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
 
 	strfmt "github.com/go-openapi/strfmt"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 )
 
+// headersExceededMessage is a part of the error returned by the http transport
+// if the response headers exceed its MaxResponseHeaderBytes, which is not exported.
+const headersExceededMessage = "server response headers exceeded"
+
+// h2HeadersExceededMessage is a part of the error returned by the http2 transport
+// if the response headers exceed its MaxHeaderListSize.
+const h2HeadersExceededMessage = "response header list larger than advertised limit"
+
 // OriginHTTPClient supply apis that interact with the source.
 type OriginHTTPClient interface {
 	RegisterTLSConfig(rawURL string, insecure bool, caBlock []strfmt.Base64)
 	GetContentLength(url string, headers map[string]string) (int64, int, error)
 	IsSupportRange(url string, headers map[string]string) (bool, error)
 	IsExpired(url string, headers map[string]string, lastModified int64, eTag string) (bool, error)
+	IgnoresConditional(url string) bool
 	Download(url string, headers map[string]string, checkCode int) (*http.Response, error)
+	Probe(url string, headers map[string]string, timeout time.Duration) *types.OriginProbeResult
+}
+
+// originDialTimeout is the timeout to connect to the sources by TCP.
+const originDialTimeout = 30 * time.Second
+
+// defaultClient is used to request the sources without the registered tls config.
+var defaultClient = newDefaultClient(config.DefaultOriginMaxHeaderBytes, nil)
+
+// newDefaultClient returns a client requesting the sources without the registered tls config,
+// whose response headers are limited to maxHeaderBytes. The tlsConfig enforcing the TLS policy
+// is used if it's not nil.
+func newDefaultClient(maxHeaderBytes int64, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   originDialTimeout,
+				KeepAlive: 30 * time.Second,
+				DualStack: true,
+			}).DialContext,
+			MaxIdleConns:           100,
+			IdleConnTimeout:        90 * time.Second,
+			TLSHandshakeTimeout:    10 * time.Second,
+			ExpectContinueTimeout:  1 * time.Second,
+			TLSClientConfig:        tlsConfig,
+			DisableCompression:     true,
+			MaxResponseHeaderBytes: maxHeaderBytes,
+		},
+	}
 }
 
 // OriginClient is an implementation of the interface of OriginHTTPClient.
 type OriginClient struct {
 	clientMap *sync.Map
+	// defaultClient requests the hosts which have no client in the clientMap.
+	defaultClient *http.Client
+	// maxHeaderBytes is the max size of the response headers of the sources,
+	// and the limit of the http transport is used if it's not greater than 0.
+	maxHeaderBytes int64
+	// hedger hedges the download requests, which is nil if the hedging is disabled.
+	hedger *hedger
+	// jars contains the cookie jars of the tasks, which is nil if the cookie jars are disabled.
+	// key:taskID,value:*cookiejar.Jar
+	jars *sync.Map
+	// jar is the cookie jar of the task which the client is scoped to by ForTask.
+	jar http.CookieJar
+	// digest authorizes the requests to the hosts requiring the Digest authentication,
+	// which is nil if no credential is configured.
+	digest *digestAuth
+	// redirectCache contains the final URLs of the tasks, which is nil if it's disabled.
+	redirectCache *redirectCache
+	// redirects contains the final URLs of the task which the client is scoped to by ForTask.
+	redirects *taskRedirects
+	// unixSockets contains the paths of the unix domain sockets of the hosts
+	// whose requests are sent over the sockets instead of TCP.
+	unixSockets map[string]string
+	// h2cHosts contains the hosts whose requests are sent over HTTP/2 cleartext.
+	h2cHosts map[string]bool
+	// clientCerts contains the client certificates of the hosts requiring the mutual TLS.
+	clientCerts map[string]*clientCert
+	// conditionals records the hosts ignoring the conditional requests,
+	// which is nil if the detection is disabled.
+	conditionals *conditionalTracker
+	// retries classifies the requests which may be sent again,
+	// which only classifies them by their methods if it's nil.
+	retries *retryPolicy
+	// tlsPolicy enforces the TLS parameters negotiated with the sources,
+	// which is nil if nothing is enforced.
+	tlsPolicy *tlsPolicy
 }
 
 // NewOriginClient returns a new OriginClient.
 func NewOriginClient() OriginHTTPClient {
 	return &OriginClient{
-		clientMap: &sync.Map{},
+		clientMap:      &sync.Map{},
+		defaultClient:  defaultClient,
+		maxHeaderBytes: config.DefaultOriginMaxHeaderBytes,
+	}
+}
+
+// NewOriginClientWithConfig returns a new OriginClient which hedges the retryable download
+// requests, keeps the cookies and the final URLs of the tasks, authenticates
+// to the sources with the credentials or the client certificates and dials
+// the unix domain sockets of the sources or speaks h2c to them as configured.
+// The response headers of the sources are limited to the OriginMaxHeaderBytes,
+// and the TLS policy is enforced on the connections to the sources over https.
+func NewOriginClientWithConfig(cfg *config.Config, register prometheus.Registerer) OriginHTTPClient {
+	policy, err := newTLSPolicy(cfg)
+	if err != nil {
+		logrus.Errorf("failed to init the tls policy of the sources: %v", err)
 	}
+	client := &OriginClient{
+		clientMap:      &sync.Map{},
+		defaultClient:  newDefaultClient(cfg.OriginMaxHeaderBytes, policy.apply(nil)),
+		maxHeaderBytes: cfg.OriginMaxHeaderBytes,
+		hedger:         newHedger(cfg.OriginHedgeDelay, cfg.OriginMaxHedges, register),
+		jars:           newCookieJars(cfg.OriginCookieJar),
+		digest:         newDigestAuth(cfg.OriginDigestAuth),
+		redirectCache:  newRedirectCache(cfg.OriginRedirectCacheTTL),
+		unixSockets:    cfg.OriginUnixSockets,
+		h2cHosts:       make(map[string]bool),
+		clientCerts:    newClientCerts(cfg.OriginClientCerts),
+		conditionals:   newConditionalTracker(cfg.OriginIgnoreConditionalThreshold, cfg.OriginIgnoreConditionalPeriod),
+		retries:        newRetryPolicy(cfg.OriginNonRetryable),
+		tlsPolicy:      policy,
+	}
+	for _, host := range cfg.OriginH2CHosts {
+		client.h2cHosts[host] = true
+	}
+	registerClientCerts(client.clientMap, client.clientCerts, client.maxHeaderBytes, client.tlsPolicy)
+	registerH2CHosts(client.clientMap, cfg.OriginH2CHosts, client.maxHeaderBytes)
+	registerUnixSockets(client.clientMap, cfg.OriginUnixSockets, client.maxHeaderBytes)
+	return client
 }
 
 // RegisterTLSConfig save tls config into map as http client.
 // tlsMap:
 // key->host value->*http.Client
+// The hosts reached over the unix domain sockets or HTTP/2 cleartext are skipped
+// since TLS doesn't apply, and the client certificates of the hosts are still presented.
+// The insecure is ignored if the TLS policy requires the verified certificates.
 func (client *OriginClient) RegisterTLSConfig(rawURL string, insecure bool, caBlock []strfmt.Base64) {
 	url, err := netUrl.Parse(rawURL)
 	if err != nil {
 		return
 	}
+	if _, ok := client.unixSockets[url.Host]; ok {
+		return
+	}
+	if client.h2cHosts[url.Host] {
+		return
+	}
+	if insecure && client.tlsPolicy != nil && client.tlsPolicy.requireVerified {
+		logrus.Warnf("refuse to skip the verification of the certificate of the source host %s", url.Host)
+		insecure = false
+	}
 
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: insecure,
@@ -76,8 +205,17 @@ func (client *OriginClient) RegisterTLSConfig(rawURL string, insecure bool, caBl
 	if appendSuccess {
 		tlsConfig.RootCAs = roots
 	}
+	if cc, ok := client.clientCerts[url.Host]; ok {
+		tlsConfig = cc.tlsConfig(insecure, tlsConfig.RootCAs)
+	}
+
+	client.clientMap.Store(url.Host, newTLSClient(client.tlsPolicy.apply(tlsConfig), client.maxHeaderBytes))
+}
 
-	client.clientMap.Store(url.Host, &http.Client{
+// newTLSClient returns a client requesting the sources with the tls config,
+// whose response headers are limited to maxHeaderBytes.
+func newTLSClient(tlsConfig *tls.Config, maxHeaderBytes int64) *http.Client {
+	return &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
 			DialContext: (&net.Dialer{
@@ -85,13 +223,15 @@ func (client *OriginClient) RegisterTLSConfig(rawURL string, insecure bool, caBl
 				KeepAlive: 30 * time.Second,
 				DualStack: true,
 			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			TLSClientConfig:       tlsConfig,
+			MaxIdleConns:           100,
+			IdleConnTimeout:        90 * time.Second,
+			TLSHandshakeTimeout:    10 * time.Second,
+			ExpectContinueTimeout:  1 * time.Second,
+			TLSClientConfig:        tlsConfig,
+			DisableCompression:     true,
+			MaxResponseHeaderBytes: maxHeaderBytes,
 		},
-	})
+	}
 }
 
 // GetContentLength send a head request to get file length.
@@ -108,10 +248,8 @@ func (client *OriginClient) GetContentLength(url string, headers map[string]stri
 
 // IsSupportRange checks if the source url support partial requests.
 func (client *OriginClient) IsSupportRange(url string, headers map[string]string) (bool, error) {
-	// set headers
-	if headers == nil {
-		headers = make(map[string]string)
-	}
+	// set headers without modifying the headers of the task
+	headers = copyHeaders(headers)
 	headers["Range"] = "bytes=0-0"
 
 	// send request
@@ -128,15 +266,15 @@ func (client *OriginClient) IsSupportRange(url string, headers map[string]string
 }
 
 // IsExpired checks if a resource received or stored is the same.
+// If the detection of the sources ignoring the conditional requests is enabled,
+// the resource responded 200 with the unchanged validator is not expired either.
 func (client *OriginClient) IsExpired(url string, headers map[string]string, lastModified int64, eTag string) (bool, error) {
 	if lastModified <= 0 && stringutils.IsEmptyStr(eTag) {
 		return true, nil
 	}
 
-	// set headers
-	if headers == nil {
-		headers = make(map[string]string)
-	}
+	// set headers without modifying the headers of the task
+	headers = copyHeaders(headers)
 	if lastModified > 0 {
 		lastModifiedStr, _ := netutils.ConvertTimeIntToString(lastModified)
 		headers["If-Modified-Since"] = lastModifiedStr
@@ -152,13 +290,33 @@ func (client *OriginClient) IsExpired(url string, headers map[string]string, las
 	}
 	resp.Body.Close()
 
-	return resp.StatusCode != http.StatusNotModified, nil
+	if resp.StatusCode == http.StatusNotModified {
+		client.recordConditional(url, false)
+		return false, nil
+	}
+	// the source ignoring the conditional request responds the whole file with the unchanged validator,
+	// which is regarded as not expired only if the detection is enabled.
+	if resp.StatusCode == http.StatusOK && client.conditionals != nil {
+		unchanged := isValidatorUnchanged(resp, lastModified, eTag)
+		client.recordConditional(url, unchanged)
+		return !unchanged, nil
+	}
+	return true, nil
 }
 
 // Download downloads the file from the original address
 func (client *OriginClient) Download(url string, headers map[string]string, checkCode int) (*http.Response, error) {
 	// TODO: add timeout
-	resp, err := client.HTTPWithHeaders("GET", url, headers, 0)
+	var resp *http.Response
+	var err error
+	// the non-retryable request is never sent twice by hedging.
+	if client.hedger != nil && client.retries.isRetryable("GET", url) {
+		resp, err = client.hedger.do(func(ctx context.Context) (*http.Response, error) {
+			return client.httpWithContext(ctx, "GET", url, headers)
+		})
+	} else {
+		resp, err = client.HTTPWithHeaders("GET", url, headers, 0)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -166,34 +324,172 @@ func (client *OriginClient) Download(url string, headers map[string]string, chec
 	if resp.StatusCode == checkCode {
 		return resp, nil
 	}
+	resp.Body.Close()
+
+	// the source responds the whole file if the validator of the If-Range doesn't match
+	if ifRange := headers["If-Range"]; ifRange != "" && checkCode == http.StatusPartialContent &&
+		resp.StatusCode == http.StatusOK {
+		return nil, errors.Wrapf(errortypes.ErrContentRangeMismatch, "the file has been changed since If-Range(%s)", ifRange)
+	}
 	return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 }
 
 // HTTPWithHeaders use host-matched client to request the origin resource.
 func (client *OriginClient) HTTPWithHeaders(method, url string, headers map[string]string, timeout time.Duration) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, nil)
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return client.httpWithContext(ctx, method, url, headers)
+}
+
+// httpWithContext use host-matched client to request the origin resource with ctx.
+// The final URL which the source redirected the url to is requested directly if it's cached,
+// and it's resolved again by requesting the url if the request to it fails,
+// unless the request is non-retryable, which fails fast instead.
+func (client *OriginClient) httpWithContext(ctx context.Context, method, url string, headers map[string]string) (*http.Response, error) {
+	if client.redirects == nil {
+		return client.do(ctx, method, url, url, headers, nil)
+	}
+
+	if finalURL, ok := client.redirects.get(url); ok {
+		resp, err := client.do(ctx, method, url, finalURL, headers, nil)
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			return resp, nil
+		}
+		// the request canceled by the caller tells nothing about the final URL
+		if ctx.Err() != nil {
+			return resp, err
+		}
+		client.redirects.remove(url)
+		if !client.retries.isRetryable(method, url) {
+			logrus.Infof("skip resolving the redirect of %s again for the non-retryable request to %s: %v", url, finalURL, describeFailure(resp, err))
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		logrus.Infof("resolve the redirect of %s again since the request to %s failed: %v", url, finalURL, describeFailure(resp, err))
+	}
+
+	ttl := client.redirects.ttl
+	resp, err := client.do(ctx, method, url, url, headers, func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if redirectTTL, ok := redirectTTL(req.Response); ok && redirectTTL < ttl {
+			ttl = redirectTTL
+		}
+		return nil
+	})
+	if err == nil && resp.StatusCode < http.StatusBadRequest && ttl > 0 {
+		if finalURL := resp.Request.URL.String(); finalURL != url {
+			client.redirects.put(url, finalURL, ttl)
+		}
+	}
+	return resp, err
+}
+
+// describeFailure describes the failed response or error.
+func describeFailure(resp *http.Response, err error) string {
 	if err != nil {
-		return nil, err
+		return err.Error()
 	}
+	return fmt.Sprintf("unexpected status code: %d", resp.StatusCode)
+}
 
-	if timeout > 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		req = req.WithContext(ctx)
-		defer cancel()
+// do requests the targetURL with the client matching the host of the url.
+// The credentials are not sent if the targetURL is on another host than the url,
+// and the redirects are checked by checkRedirect if it's not nil.
+func (client *OriginClient) do(ctx context.Context, method, url, targetURL string, headers map[string]string,
+	checkRedirect func(req *http.Request, via []*http.Request) error) (*http.Response, error) {
+	req, err := http.NewRequest(method, targetURL, nil)
+	if err != nil {
+		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	for k, v := range headers {
 		req.Header.Add(k, v)
 	}
 
-	httpClientObject, existed := client.clientMap.Load(req.Host)
+	host := req.Host
+	if targetURL != url {
+		origin, err := netUrl.Parse(url)
+		if err != nil {
+			return nil, err
+		}
+		if origin.Hostname() != req.URL.Hostname() {
+			for _, name := range credentialHeaders {
+				req.Header.Del(name)
+			}
+		}
+		host = origin.Host
+	}
+
+	// The Content-Encoding is a part of the entity of the source, so the compression
+	// of the transports is disabled to never decode the content transparently.
+	// Then the stored file and its md5 match the entity declared by the source.
+	// And the Transfer-Encoding is still handled by the transports transparently.
+	httpClientObject, existed := client.clientMap.Load(host)
 	if !existed {
-		httpClientObject = http.DefaultClient
+		httpClientObject = client.defaultClient
+		if client.defaultClient == nil {
+			httpClientObject = defaultClient
+		}
 	}
 
 	httpClient, ok := httpClientObject.(*http.Client)
 	if !ok {
 		return nil, errors.Wrapf(errortypes.ErrInvalidValue, "http client type check error: %T", httpClientObject)
 	}
-	return httpClient.Do(req)
+
+	// the http.Client is shared by the tasks, so it's copied to carry
+	// the cookies of the task and check the redirects of the request only.
+	if client.jar != nil || checkRedirect != nil {
+		scoped := *httpClient
+		if client.jar != nil {
+			scoped.Jar = client.jar
+		}
+		if checkRedirect != nil {
+			scoped.CheckRedirect = checkRedirect
+		}
+		httpClient = &scoped
+	}
+	if client.digest == nil {
+		return send(httpClient, req, client.tlsPolicy)
+	}
+
+	// the request is retried once with the digest response if the host challenges it.
+	client.digest.authorize(req)
+	resp, err := send(httpClient, req, client.tlsPolicy)
+	if err != nil || !client.digest.challenge(req, resp) {
+		return resp, err
+	}
+	resp.Body.Close()
+	client.digest.authorize(req)
+	return send(httpClient, req, client.tlsPolicy)
+}
+
+// send sends the request with the httpClient, and the response whose headers exceed
+// the limit of the transport fails with the ErrSourceBadResponse.
+// And the connection failing to meet the policy fails with the ErrTLSPolicyViolation.
+func send(httpClient *http.Client, req *http.Request, policy *tlsPolicy) (*http.Response, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil && (strings.Contains(err.Error(), headersExceededMessage) ||
+		strings.Contains(err.Error(), h2HeadersExceededMessage)) {
+		return nil, errors.Wrapf(errortypes.ErrSourceBadResponse, "%v", err)
+	}
+	return resp, policy.check(err)
+}
+
+// copyHeaders returns a copy of the headers which is never nil.
+func copyHeaders(headers map[string]string) map[string]string {
+	result := make(map[string]string, len(headers))
+	for k, v := range headers {
+		result[k] = v
+	}
+	return result
 }
@@ -0,0 +1,59 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type OriginClientTestSuite struct{}
+
+func init() {
+	check.Suite(&OriginClientTestSuite{})
+}
+
+func (s *OriginClientTestSuite) TestOversizedResponseHeaders(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oversized" {
+			w.Header().Set("X-Padding", strings.Repeat("a", 8*1024))
+		}
+		w.Write([]byte("dragonfly"))
+	}))
+	defer server.Close()
+
+	cfg := config.NewConfig()
+	cfg.OriginMaxHeaderBytes = 4 * 1024
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+
+	resp, err := client.Download(server.URL+"/normal", nil, http.StatusOK)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+
+	_, err = client.Download(server.URL+"/oversized", nil, http.StatusOK)
+	c.Assert(errortypes.IsSourceBadResponse(err), check.Equals, true)
+
+	_, _, err = client.GetContentLength(server.URL+"/oversized", nil)
+	c.Assert(errortypes.IsSourceBadResponse(err), check.Equals, true)
+}
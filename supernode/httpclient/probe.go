@@ -0,0 +1,170 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// probeTrace records the latency of the stages of a probe,
+// and the stage in progress when it fails.
+type probeTrace struct {
+	sync.Mutex
+	stage        string
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	dns          time.Duration
+	connect      time.Duration
+	tls          time.Duration
+}
+
+// clientTrace returns the httptrace.ClientTrace recording into pt.
+// The callbacks are guarded by the lock since the dials may run concurrently.
+func (pt *probeTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			pt.Lock()
+			defer pt.Unlock()
+			pt.stage = types.OriginProbeResultFailureDNS
+			pt.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			pt.Lock()
+			defer pt.Unlock()
+			pt.dns = time.Since(pt.dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			pt.Lock()
+			defer pt.Unlock()
+			pt.stage = types.OriginProbeResultFailureConnect
+			if pt.connectStart.IsZero() {
+				pt.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			pt.Lock()
+			defer pt.Unlock()
+			if err == nil {
+				pt.connect = time.Since(pt.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			pt.Lock()
+			defer pt.Unlock()
+			pt.stage = types.OriginProbeResultFailureTLS
+			pt.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			pt.Lock()
+			defer pt.Unlock()
+			pt.tls = time.Since(pt.tlsStart)
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			pt.Lock()
+			defer pt.Unlock()
+			pt.stage = types.OriginProbeResultFailureRequest
+		},
+	}
+}
+
+// Probe requests the first byte of the url with the same client as the downloads,
+// and reports the observed size and latency or the stage where it fails.
+func (client *OriginClient) Probe(url string, headers map[string]string, timeout time.Duration) *types.OriginProbeResult {
+	// set headers without modifying the headers of the caller
+	headers = copyHeaders(headers)
+	headers["Range"] = "bytes=0-0"
+
+	trace := &probeTrace{stage: types.OriginProbeResultFailureRequest}
+	ctx, cancel := context.WithTimeout(httptrace.WithClientTrace(context.Background(), trace.clientTrace()), timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := client.httpWithContext(ctx, http.MethodGet, url, headers)
+	result := &types.OriginProbeResult{ContentLength: -1}
+	trace.Lock()
+	result.DNSTime = toMillis(trace.dns)
+	result.ConnectTime = toMillis(trace.connect)
+	result.TLSTime = toMillis(trace.tls)
+	stage := trace.stage
+	trace.Unlock()
+	if err != nil {
+		result.Failure = classifyProbeError(err, stage)
+		result.Message = err.Error()
+		return result
+	}
+	resp.Body.Close()
+	result.TotalTime = toMillis(time.Since(start))
+	result.StatusCode = int64(resp.StatusCode)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		result.Success = true
+		result.ContentLength = resp.ContentLength
+	case http.StatusPartialContent:
+		result.Success = true
+		result.SupportRange = true
+		result.ContentLength = parseContentRangeTotal(resp.Header.Get("Content-Range"))
+	case http.StatusUnauthorized, http.StatusForbidden:
+		result.Failure = types.OriginProbeResultFailureAuth
+	case http.StatusNotFound:
+		result.Failure = types.OriginProbeResultFailureNotFound
+	default:
+		result.Failure = types.OriginProbeResultFailureStatus
+	}
+	if !result.Success {
+		result.Message = fmt.Sprintf("unexpected status code: %d", resp.StatusCode)
+	}
+	return result
+}
+
+// classifyProbeError returns the failure of the probe which fails with err in the stage.
+func classifyProbeError(err error, stage string) string {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return types.OriginProbeResultFailureTimeout
+	}
+	return stage
+}
+
+// parseContentRangeTotal returns the complete length in the Content-Range header
+// such as "bytes 0-0/1024", and -1 if it's unknown.
+func parseContentRangeTotal(contentRange string) int64 {
+	index := strings.LastIndex(contentRange, "/")
+	if index < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(contentRange[index+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
+
+func toMillis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type ProbeTestSuite struct{}
+
+func init() {
+	check.Suite(&ProbeTestSuite{})
+}
+
+func (s *ProbeTestSuite) TestProbeReachable(c *check.C) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.Header().Set("Content-Range", "bytes 0-0/1024")
+		w.WriteHeader(http.StatusPartialContent)
+		fmt.Fprint(w, "a")
+	}))
+	defer server.Close()
+
+	client := NewOriginClient()
+	result := client.Probe(server.URL, map[string]string{"token": "foo"}, time.Second)
+	c.Check(result.Success, check.Equals, true)
+	c.Check(result.Failure, check.Equals, "")
+	c.Check(result.StatusCode, check.Equals, int64(http.StatusPartialContent))
+	c.Check(result.ContentLength, check.Equals, int64(1024))
+	c.Check(result.SupportRange, check.Equals, true)
+	c.Check(headers.Get("token"), check.Equals, "foo")
+	c.Check(headers.Get("Range"), check.Equals, "bytes=0-0")
+}
+
+func (s *ProbeTestSuite) TestProbeAuthFailing(c *check.C) {
+	ds := &digestServer{nonce: "nonce"}
+	server := httptest.NewServer(ds)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	// the probe fails with the wrong credential
+	cfg := config.NewConfig()
+	cfg.OriginDigestAuth = map[string]config.OriginCredential{
+		serverURL.Host: {Username: "foo", Password: "wrong"},
+	}
+	result := NewOriginClientWithConfig(cfg, prometheus.NewRegistry()).Probe(server.URL, nil, time.Second)
+	c.Check(result.Success, check.Equals, false)
+	c.Check(result.Failure, check.Equals, types.OriginProbeResultFailureAuth)
+	c.Check(result.StatusCode, check.Equals, int64(http.StatusUnauthorized))
+
+	// and succeeds with the right one just like the downloads
+	cfg.OriginDigestAuth[serverURL.Host] = config.OriginCredential{Username: "foo", Password: "bar"}
+	result = NewOriginClientWithConfig(cfg, prometheus.NewRegistry()).Probe(server.URL, nil, time.Second)
+	c.Check(result.Success, check.Equals, true)
+	c.Check(result.SupportRange, check.Equals, true)
+}
+
+func (s *ProbeTestSuite) TestProbeFailures(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	var cases = []struct {
+		url     string
+		failure string
+	}{
+		{url: server.URL + "/missing", failure: types.OriginProbeResultFailureNotFound},
+		{url: server.URL + "/broken", failure: types.OriginProbeResultFailureStatus},
+		{url: server.URL + "/slow", failure: types.OriginProbeResultFailureTimeout},
+		{url: closed.URL, failure: types.OriginProbeResultFailureConnect},
+	}
+
+	client := NewOriginClient()
+	for _, v := range cases {
+		result := client.Probe(v.url, nil, 100*time.Millisecond)
+		c.Check(result.Success, check.Equals, false, check.Commentf(v.url))
+		c.Check(result.Failure, check.Equals, v.failure, check.Commentf(v.url))
+		c.Check(result.Message, check.Not(check.Equals), "", check.Commentf(v.url))
+	}
+}
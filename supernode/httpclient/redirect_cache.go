@@ -0,0 +1,118 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+)
+
+// maxRedirects is the max number of the redirects followed by a request,
+// which is the same as the default policy of http.Client.
+const maxRedirects = 10
+
+// redirectCache caches the final URLs which the sources redirect the requests of the tasks to.
+type redirectCache struct {
+	// ttl is the max duration that a final URL is cached.
+	ttl time.Duration
+	// key:taskID,value:*taskRedirects
+	tasks *sync.Map
+}
+
+// newRedirectCache returns a new redirectCache, which is nil if the ttl is not greater than 0.
+func newRedirectCache(ttl time.Duration) *redirectCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &redirectCache{
+		ttl:   ttl,
+		tasks: &sync.Map{},
+	}
+}
+
+// forTask returns the final URLs of the task.
+func (rc *redirectCache) forTask(taskID string) *taskRedirects {
+	actual, _ := rc.tasks.LoadOrStore(taskID, &taskRedirects{
+		ttl:     rc.ttl,
+		entries: make(map[string]*resolvedURL),
+	})
+	return actual.(*taskRedirects)
+}
+
+// release discards the final URLs of the task.
+func (rc *redirectCache) release(taskID string) {
+	rc.tasks.Delete(taskID)
+}
+
+// taskRedirects contains the final URLs of the URLs requested by a task.
+type taskRedirects struct {
+	sync.Mutex
+	ttl time.Duration
+	// key:the requested URL,value:*resolvedURL
+	entries map[string]*resolvedURL
+}
+
+type resolvedURL struct {
+	url      string
+	expireAt time.Time
+}
+
+// get returns the final URL of the url if it's cached and not expired.
+func (tr *taskRedirects) get(url string) (string, bool) {
+	tr.Lock()
+	defer tr.Unlock()
+
+	resolved, ok := tr.entries[url]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(resolved.expireAt) {
+		delete(tr.entries, url)
+		return "", false
+	}
+	return resolved.url, true
+}
+
+// put caches the final URL of the url for the ttl.
+func (tr *taskRedirects) put(url, finalURL string, ttl time.Duration) {
+	tr.Lock()
+	defer tr.Unlock()
+	tr.entries[url] = &resolvedURL{
+		url:      finalURL,
+		expireAt: time.Now().Add(ttl),
+	}
+}
+
+// remove discards the final URL of the url.
+func (tr *taskRedirects) remove(url string) {
+	tr.Lock()
+	defer tr.Unlock()
+	delete(tr.entries, url)
+}
+
+// redirectTTL returns the duration that the redirect response allows its target to be cached,
+// and false if the response carries neither the Cache-Control nor the Expires.
+func redirectTTL(resp *http.Response) (time.Duration, bool) {
+	return netutils.FreshnessLifetime(resp.Header, time.Now())
+}
+
+// credentialHeaders are the headers which are not sent to the final URL on another host,
+// just like the ones removed by http.Client when following the redirects.
+var credentialHeaders = []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"}
@@ -0,0 +1,168 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type RedirectCacheTestSuite struct{}
+
+func init() {
+	check.Suite(&RedirectCacheTestSuite{})
+}
+
+// redirectServer is a source which redirects the requests of /file to the current
+// signed URL, and only the current signed URL is served.
+type redirectServer struct {
+	sync.Mutex
+	version      int
+	cacheControl string
+	resolves     int
+	requests     int
+}
+
+func (rs *redirectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rs.Lock()
+	defer rs.Unlock()
+
+	if r.URL.Path == "/file" {
+		rs.resolves++
+		if rs.cacheControl != "" {
+			w.Header().Set("Cache-Control", rs.cacheControl)
+		}
+		http.Redirect(w, r, fmt.Sprintf("/signed/%d", rs.version), http.StatusFound)
+		return
+	}
+
+	rs.requests++
+	if r.URL.Path != fmt.Sprintf("/signed/%d", rs.version) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.Write([]byte("dragonfly"))
+}
+
+// rotate changes the signed URL and expires the previous one.
+func (rs *redirectServer) rotate() {
+	rs.Lock()
+	defer rs.Unlock()
+	rs.version++
+}
+
+func (rs *redirectServer) counts() (resolves, requests int) {
+	rs.Lock()
+	defer rs.Unlock()
+	return rs.resolves, rs.requests
+}
+
+func newRedirectClient(ttl time.Duration) OriginHTTPClient {
+	cfg := config.NewConfig()
+	cfg.OriginRedirectCacheTTL = ttl
+	return NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+}
+
+func download(c *check.C, client OriginHTTPClient, url string) {
+	resp, err := client.Download(url, map[string]string{"Range": "bytes=0-"}, http.StatusOK)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+}
+
+func (s *RedirectCacheTestSuite) TestReuseResolvedURL(c *check.C) {
+	rs := &redirectServer{}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+	client := newRedirectClient(time.Minute)
+
+	// the following requests of the task go to the resolved URL directly
+	for i := 0; i < 3; i++ {
+		download(c, ForTask(client, "task"), server.URL+"/file")
+	}
+	resolves, requests := rs.counts()
+	c.Check(resolves, check.Equals, 1)
+	c.Check(requests, check.Equals, 3)
+
+	// while the other tasks resolve the redirect by themselves
+	download(c, ForTask(client, "other"), server.URL+"/file")
+	resolves, _ = rs.counts()
+	c.Check(resolves, check.Equals, 2)
+
+	// and the resolved URLs are discarded with the task
+	ReleaseTask(client, "task")
+	download(c, ForTask(client, "task"), server.URL+"/file")
+	resolves, _ = rs.counts()
+	c.Check(resolves, check.Equals, 3)
+}
+
+func (s *RedirectCacheTestSuite) TestReResolveOnTargetFailure(c *check.C) {
+	rs := &redirectServer{}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+	client := ForTask(newRedirectClient(time.Minute), "task")
+
+	download(c, client, server.URL+"/file")
+
+	// the redirect is resolved again once the resolved URL fails
+	rs.rotate()
+	download(c, client, server.URL+"/file")
+	resolves, requests := rs.counts()
+	c.Check(resolves, check.Equals, 2)
+	c.Check(requests, check.Equals, 3)
+
+	// and the new target is reused
+	download(c, client, server.URL+"/file")
+	resolves, requests = rs.counts()
+	c.Check(resolves, check.Equals, 2)
+	c.Check(requests, check.Equals, 4)
+}
+
+func (s *RedirectCacheTestSuite) TestRedirectCacheExpiration(c *check.C) {
+	var cases = []struct {
+		ttl          time.Duration
+		cacheControl string
+		sleep        time.Duration
+		resolves     int
+	}{
+		{ttl: time.Minute, cacheControl: "no-store", resolves: 2},
+		{ttl: time.Minute, cacheControl: "private, max-age=0", resolves: 2},
+		{ttl: 50 * time.Millisecond, sleep: 60 * time.Millisecond, resolves: 2},
+		{ttl: time.Minute, cacheControl: "max-age=60", sleep: 60 * time.Millisecond, resolves: 1},
+		{ttl: 0, resolves: 2},
+	}
+
+	for _, v := range cases {
+		rs := &redirectServer{cacheControl: v.cacheControl}
+		server := httptest.NewServer(rs)
+		client := ForTask(newRedirectClient(v.ttl), "task")
+
+		download(c, client, server.URL+"/file")
+		time.Sleep(v.sleep)
+		download(c, client, server.URL+"/file")
+		resolves, _ := rs.counts()
+		c.Check(resolves, check.Equals, v.resolves, check.Commentf("%+v", v))
+		server.Close()
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"net/http"
+	netUrl "net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// retryPolicy classifies the requests to the sources into the retryable ones, which
+// may be sent more than once, and the non-retryable ones, which are sent only once
+// to avoid the duplicate side effects or work on the sources.
+type retryPolicy struct {
+	// rules contains the sources whose requests are non-retryable.
+	rules []nonRetryableRule
+}
+
+// nonRetryableRule matches the requests to the host whose paths start with the pathPrefix.
+type nonRetryableRule struct {
+	host       string
+	pathPrefix string
+}
+
+// newRetryPolicy returns the policy which classifies the requests to the sources as non-retryable,
+// each of which is a host or a host followed by a path prefix, such as "example.com/api/".
+// It returns nil if there is no source, which still classifies the requests by their methods.
+func newRetryPolicy(sources []string) *retryPolicy {
+	if len(sources) == 0 {
+		return nil
+	}
+
+	policy := &retryPolicy{}
+	for _, source := range sources {
+		rule := nonRetryableRule{host: source}
+		if i := strings.Index(source, "/"); i >= 0 {
+			rule.host, rule.pathPrefix = source[:i], source[i:]
+		}
+		logrus.Infof("requests to the source %s are never retried", source)
+		policy.rules = append(policy.rules, rule)
+	}
+	return policy
+}
+
+// isRetryable returns whether the request with the method to the url may be sent again.
+// The requests other than GET and HEAD are never retryable since they may not be idempotent.
+func (p *retryPolicy) isRetryable(method, url string) bool {
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+	if p == nil {
+		return true
+	}
+
+	u, err := netUrl.Parse(url)
+	if err != nil {
+		return false
+	}
+	for _, rule := range p.rules {
+		if (rule.host == u.Host || rule.host == u.Hostname()) && strings.HasPrefix(u.Path, rule.pathPrefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	netUrl "net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type RetryPolicyTestSuite struct{}
+
+func init() {
+	check.Suite(&RetryPolicyTestSuite{})
+}
+
+// flakyServer is a source which redirects the requests of /file to /target,
+// and the requests to /target fail with 503 for the number of failures.
+type flakyServer struct {
+	sync.Mutex
+	failures int
+	resolves int
+	requests int
+}
+
+func (fs *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if r.URL.Path == "/file" {
+		fs.resolves++
+		http.Redirect(w, r, "/target", http.StatusFound)
+		return
+	}
+
+	fs.requests++
+	if fs.failures > 0 {
+		fs.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("dragonfly"))
+}
+
+func (fs *flakyServer) fail(failures int) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.failures = failures
+}
+
+func (fs *flakyServer) counts() (resolves, requests int) {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.resolves, fs.requests
+}
+
+func (s *RetryPolicyTestSuite) TestIsRetryable(c *check.C) {
+	policy := newRetryPolicy([]string{"metered.example.com", "origin.internal:8080/api/"})
+	var cases = []struct {
+		method    string
+		url       string
+		retryable bool
+	}{
+		{method: "GET", url: "http://example.com/file", retryable: true},
+		{method: "HEAD", url: "http://example.com/file", retryable: true},
+		{method: "POST", url: "http://example.com/file", retryable: false},
+		{method: "PUT", url: "http://example.com/file", retryable: false},
+		{method: "GET", url: "http://metered.example.com/file", retryable: false},
+		{method: "GET", url: "https://metered.example.com:8443/file", retryable: false},
+		{method: "GET", url: "http://origin.internal:8080/api/file", retryable: false},
+		{method: "GET", url: "http://origin.internal:8080/static/file", retryable: true},
+		{method: "GET", url: "http://origin.internal/api/file", retryable: true},
+	}
+	for _, v := range cases {
+		c.Check(policy.isRetryable(v.method, v.url), check.Equals, v.retryable, check.Commentf("%+v", v))
+	}
+
+	// the requests are only classified by their methods without the sources
+	var nilPolicy *retryPolicy
+	c.Check(nilPolicy.isRetryable("GET", "http://metered.example.com/file"), check.Equals, true)
+	c.Check(nilPolicy.isRetryable("POST", "http://example.com/file"), check.Equals, false)
+}
+
+func (s *RetryPolicyTestSuite) TestFailFastOnTransientFailure(c *check.C) {
+	fs := &flakyServer{}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+	u, err := netUrl.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+
+	cfg := config.NewConfig()
+	cfg.OriginRedirectCacheTTL = time.Minute
+	retryable := ForTask(NewOriginClientWithConfig(cfg, prometheus.NewRegistry()), "task")
+	cfg.OriginNonRetryable = []string{u.Host + "/file"}
+	nonRetryable := ForTask(NewOriginClientWithConfig(cfg, prometheus.NewRegistry()), "task")
+
+	// the retryable request resolves the redirect again once the cached final URL fails
+	download(c, retryable, server.URL+"/file")
+	fs.fail(1)
+	download(c, retryable, server.URL+"/file")
+	resolves, requests := fs.counts()
+	c.Check(resolves, check.Equals, 2)
+	c.Check(requests, check.Equals, 3)
+
+	// while the non-retryable request fails fast with the transient failure
+	download(c, nonRetryable, server.URL+"/file")
+	fs.fail(1)
+	_, err = nonRetryable.Download(server.URL+"/file", nil, http.StatusOK)
+	c.Check(err, check.NotNil)
+	resolves, requests = fs.counts()
+	c.Check(resolves, check.Equals, 3)
+	c.Check(requests, check.Equals, 5)
+
+	// and the redirect is resolved by the next request
+	download(c, nonRetryable, server.URL+"/file")
+	resolves, requests = fs.counts()
+	c.Check(resolves, check.Equals, 4)
+	c.Check(requests, check.Equals, 6)
+}
+
+func (s *RetryPolicyTestSuite) TestNoHedgeForNonRetryable(c *check.C) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		// the source is slow to respond
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, "dragonfly")
+	}))
+	defer server.Close()
+	u, err := netUrl.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+
+	cfg := config.NewConfig()
+	cfg.OriginHedgeDelay = 20 * time.Millisecond
+	download(c, NewOriginClientWithConfig(cfg, prometheus.NewRegistry()), server.URL)
+	c.Check(atomic.LoadInt32(&requests), check.Equals, int32(2))
+
+	atomic.StoreInt32(&requests, 0)
+	cfg.OriginNonRetryable = []string{u.Hostname()}
+	download(c, NewOriginClientWithConfig(cfg, prometheus.NewRegistry()), server.URL)
+	c.Check(atomic.LoadInt32(&requests), check.Equals, int32(1))
+}
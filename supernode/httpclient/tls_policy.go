@@ -0,0 +1,231 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	stderrors "errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+)
+
+// tlsVersions contains the TLS versions which can be configured as the OriginMinTLSVersion.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// cipherSuites contains the cipher suites of TLS 1.0 to 1.2 implemented by crypto/tls,
+// which can be configured in the OriginCipherSuites by their names.
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_RC4_128_SHA":                tls.TLS_RSA_WITH_RC4_128_SHA,
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA256":         tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":        tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_RC4_128_SHA":          tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":     tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// negotiationFailureMessages are the errors returned by crypto/tls, which are not exported,
+// if the source selects the version or the cipher suite which is not allowed.
+var negotiationFailureMessages = []string{
+	"tls: server selected unsupported protocol version",
+	"tls: server chose an unconfigured cipher suite",
+}
+
+// negotiationFailureAlerts are the alerts sent by the source if it supports none of the versions
+// or the cipher suites allowed.
+var negotiationFailureAlerts = map[string]bool{
+	"tls: protocol version not supported": true,
+	"tls: insufficient security level":    true,
+}
+
+// handshakeFailureAlert is the generic alert sent by the source failing the handshake,
+// which is also sent by the source if it supports none of the cipher suites allowed.
+const handshakeFailureAlert = "tls: handshake failure"
+
+// tlsPolicy enforces the TLS parameters negotiated with the sources.
+type tlsPolicy struct {
+	// minVersion is the min version of TLS, which is 0 to use the default of Go.
+	minVersion uint16
+	// cipherSuites contains the allowed cipher suites, which is nil to use the defaults of Go.
+	cipherSuites []uint16
+	// requireVerified makes the certificates of the sources always verified.
+	requireVerified bool
+}
+
+// newTLSPolicy returns the TLS policy configured by the cfg, or nil if nothing is enforced.
+func newTLSPolicy(cfg *config.Config) (*tlsPolicy, error) {
+	policy := &tlsPolicy{
+		requireVerified: cfg.OriginRequireVerifiedCerts,
+	}
+	if cfg.OriginMinTLSVersion != "" {
+		version, ok := tlsVersions[cfg.OriginMinTLSVersion]
+		if !ok {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "origin min tls version: %s", cfg.OriginMinTLSVersion)
+		}
+		policy.minVersion = version
+	}
+	for _, name := range cfg.OriginCipherSuites {
+		suite, ok := cipherSuites[strings.TrimSpace(name)]
+		if !ok {
+			return nil, errors.Wrapf(errortypes.ErrInvalidValue, "origin cipher suite: %s", name)
+		}
+		policy.cipherSuites = append(policy.cipherSuites, suite)
+	}
+
+	if policy.minVersion == 0 && policy.cipherSuites == nil && !policy.requireVerified {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// ValidateTLSPolicy checks the TLS policy of the sources configured by the cfg.
+func ValidateTLSPolicy(cfg *config.Config) error {
+	_, err := newTLSPolicy(cfg)
+	return err
+}
+
+// apply enforces the policy on the tlsConfig and returns it, and a new one is created if it's nil.
+// It returns the tlsConfig as it is if the policy is nil.
+func (p *tlsPolicy) apply(tlsConfig *tls.Config) *tls.Config {
+	if p == nil {
+		return tlsConfig
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if p.minVersion != 0 {
+		tlsConfig.MinVersion = p.minVersion
+	}
+	if p.cipherSuites != nil {
+		tlsConfig.CipherSuites = p.cipherSuites
+	}
+	if p.requireVerified {
+		tlsConfig.InsecureSkipVerify = false
+	}
+	return tlsConfig
+}
+
+// check returns the ErrTLSPolicyViolation if the err is caused by the handshake
+// failing to meet the policy, or the err itself otherwise.
+func (p *tlsPolicy) check(err error) error {
+	if p == nil || err == nil {
+		return err
+	}
+
+	cause := errors.Cause(err)
+	addr := ""
+	if urlErr, ok := cause.(*url.Error); ok {
+		cause = urlErr.Err
+		addr = tlsAddr(urlErr.URL)
+	}
+	if (p.requireVerified && isCertificateFailure(cause)) ||
+		((p.minVersion != 0 || p.cipherSuites != nil) && p.isNegotiationFailure(cause, addr)) {
+		return errors.Wrapf(errortypes.ErrTLSPolicyViolation, "%v", err)
+	}
+	return err
+}
+
+// isCertificateFailure returns whether the err is caused by the certificate of the source
+// failing to be verified.
+func isCertificateFailure(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return stderrors.As(err, &unknownAuthority) || stderrors.As(err, &hostname) || stderrors.As(err, &invalid)
+}
+
+// isNegotiationFailure returns whether the err is caused by the source at the addr supporting
+// none of the versions or the cipher suites allowed.
+func (p *tlsPolicy) isNegotiationFailure(err error, addr string) bool {
+	var opErr *net.OpError
+	if stderrors.As(err, &opErr) && opErr.Op == "remote error" {
+		alert := opErr.Err.Error()
+		if alert == handshakeFailureAlert {
+			return p.cipherSuites != nil && addr != "" && acceptsDefaultCipherSuites(addr, p.minVersion)
+		}
+		return negotiationFailureAlerts[alert]
+	}
+
+	msg := err.Error()
+	for _, failure := range negotiationFailureMessages {
+		if strings.Contains(msg, failure) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsDefaultCipherSuites returns whether the source at the addr completes the handshake of
+// TLS 1.2 with the default cipher suites of Go, which tells whether the generic handshake failure
+// is caused by the cipher suites allowed rather than the others, such as the client certificate.
+func acceptsDefaultCipherSuites(addr string, minVersion uint16) bool {
+	if minVersion > tls.VersionTLS12 {
+		return false
+	}
+	dialer := &net.Dialer{Timeout: originDialTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		MinVersion: minVersion,
+		// the cipher suites of TLS 1.3 can't be configured
+		MaxVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// tlsAddr returns the address of the source over https with the rawURL,
+// or an empty string if it's not a valid https url.
+func tlsAddr(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return ""
+	}
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return u.Host
+}
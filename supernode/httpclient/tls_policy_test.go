@@ -0,0 +1,178 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	strfmt "github.com/go-openapi/strfmt"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type TLSPolicyTestSuite struct{}
+
+func init() {
+	check.Suite(&TLSPolicyTestSuite{})
+}
+
+// newTLSOrigin starts a source over https with the tls config.
+func newTLSOrigin(tlsConfig *tls.Config) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("dragonfly"))
+	}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	return server
+}
+
+// downloadFrom downloads the file from the server with the client trusting its certificate
+// unless the insecure is set, and returns the error.
+func downloadFrom(cfg *config.Config, server *httptest.Server, insecure bool) error {
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+	var caBlock []strfmt.Base64
+	if !insecure {
+		caBlock = []strfmt.Base64{pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})}
+	}
+	client.RegisterTLSConfig(server.URL, insecure, caBlock)
+	resp, err := client.Download(server.URL+"/file", nil, http.StatusOK)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func (s *TLSPolicyTestSuite) TestNewTLSPolicy(c *check.C) {
+	cfg := config.NewConfig()
+	policy, err := newTLSPolicy(cfg)
+	c.Check(err, check.IsNil)
+	c.Check(policy, check.IsNil)
+
+	cfg.OriginMinTLSVersion = "1.2"
+	cfg.OriginCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	policy, err = newTLSPolicy(cfg)
+	c.Assert(err, check.IsNil)
+	c.Check(policy.minVersion, check.Equals, uint16(tls.VersionTLS12))
+	c.Check(policy.cipherSuites, check.DeepEquals, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256})
+
+	cfg.OriginMinTLSVersion = "1.4"
+	_, err = newTLSPolicy(cfg)
+	c.Check(errortypes.IsInvalidValue(err), check.Equals, true)
+
+	cfg.OriginMinTLSVersion = ""
+	cfg.OriginCipherSuites = []string{"TLS_UNKNOWN"}
+	c.Check(errortypes.IsInvalidValue(ValidateTLSPolicy(cfg)), check.Equals, true)
+}
+
+func (s *TLSPolicyTestSuite) TestEnforceMinVersion(c *check.C) {
+	compliant := newTLSOrigin(&tls.Config{MinVersion: tls.VersionTLS12})
+	defer compliant.Close()
+	outdated := newTLSOrigin(&tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11})
+	defer outdated.Close()
+
+	cfg := config.NewConfig()
+	cfg.OriginMinTLSVersion = "1.2"
+	c.Check(downloadFrom(cfg, compliant, false), check.IsNil)
+	err := downloadFrom(cfg, outdated, false)
+	c.Check(errortypes.IsTLSPolicyViolation(err), check.Equals, true, check.Commentf("%v", err))
+}
+
+func (s *TLSPolicyTestSuite) TestEnforceCipherSuites(c *check.C) {
+	// the suites of both the RSA and ECDSA certificates are listed for the certificate of httptest
+	allowed := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}
+	disallowed := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA}
+	compliant := newTLSOrigin(&tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: allowed})
+	defer compliant.Close()
+	weak := newTLSOrigin(&tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: disallowed})
+	defer weak.Close()
+
+	// the weak source is reachable without the policy
+	c.Check(downloadFrom(config.NewConfig(), weak, false), check.IsNil)
+
+	cfg := config.NewConfig()
+	cfg.OriginCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+	c.Check(downloadFrom(cfg, compliant, false), check.IsNil)
+	err := downloadFrom(cfg, weak, false)
+	c.Check(errortypes.IsTLSPolicyViolation(err), check.Equals, true, check.Commentf("%v", err))
+}
+
+func (s *TLSPolicyTestSuite) TestRequireVerifiedCerts(c *check.C) {
+	server := newTLSOrigin(nil)
+	defer server.Close()
+
+	// the insecure registration skips the verification without the policy
+	c.Check(downloadFrom(config.NewConfig(), server, true), check.IsNil)
+
+	cfg := config.NewConfig()
+	cfg.OriginRequireVerifiedCerts = true
+	c.Check(downloadFrom(cfg, server, false), check.IsNil)
+	err := downloadFrom(cfg, server, true)
+	c.Check(errortypes.IsTLSPolicyViolation(err), check.Equals, true, check.Commentf("%v", err))
+
+	// the requests to the unregistered hosts are verified as well
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+	_, err = client.Download(server.URL+"/file", nil, http.StatusOK)
+	c.Check(errortypes.IsTLSPolicyViolation(err), check.Equals, true, check.Commentf("%v", err))
+}
+
+func (s *TLSPolicyTestSuite) TestIgnoreClientCertFailure(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.OriginMinTLSVersion = "1.2"
+	cfg.OriginCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+	cfg.OriginRequireVerifiedCerts = true
+
+	// the source requiring the client certificate fails the handshake regardless of the policy
+	for _, maxVersion := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		server := newTLSOrigin(&tls.Config{ClientAuth: tls.RequireAnyClientCert, MaxVersion: maxVersion})
+		err := downloadFrom(cfg, server, false)
+		server.Close()
+		c.Check(err, check.NotNil)
+		c.Check(errortypes.IsTLSPolicyViolation(err), check.Equals, false, check.Commentf("%v", err))
+	}
+}
+
+func (s *TLSPolicyTestSuite) TestIgnoreGenericHandshakeFailure(c *check.C) {
+	// the source fails every handshake with the generic handshake failure
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 1024))
+			conn.Write([]byte{21, 3, 3, 0, 2, 2, 40})
+			conn.Close()
+		}
+	}()
+
+	cfg := config.NewConfig()
+	cfg.OriginCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+	_, err = client.Download("https://"+l.Addr().String()+"/file", nil, http.StatusOK)
+	c.Check(err, check.ErrorMatches, ".*tls: handshake failure.*")
+	c.Check(errortypes.IsTLSPolicyViolation(err), check.Equals, false, check.Commentf("%v", err))
+}
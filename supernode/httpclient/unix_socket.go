@@ -0,0 +1,58 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newUnixSocketClient returns a client which dials the unix domain socket at the path
+// for all the requests, whatever the host of the URL is. The proxy from the environment
+// is ignored since the socket is only reachable locally. And the response headers
+// are limited to maxHeaderBytes.
+func newUnixSocketClient(path string, maxHeaderBytes int64) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 3 * time.Second,
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+			MaxIdleConns:           100,
+			IdleConnTimeout:        90 * time.Second,
+			ExpectContinueTimeout:  1 * time.Second,
+			DisableCompression:     true,
+			MaxResponseHeaderBytes: maxHeaderBytes,
+		},
+	}
+}
+
+// registerUnixSockets stores the clients dialing the unix domain sockets of the hosts
+// into the clientMap, so the requests to the hosts are sent over the sockets.
+func registerUnixSockets(clientMap *sync.Map, sockets map[string]string, maxHeaderBytes int64) {
+	for host, path := range sockets {
+		logrus.Infof("requests to the source host %s are sent over the unix socket %s", host, path)
+		clientMap.Store(host, newUnixSocketClient(path, maxHeaderBytes))
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type UnixSocketTestSuite struct{}
+
+func init() {
+	check.Suite(&UnixSocketTestSuite{})
+}
+
+func (s *UnixSocketTestSuite) TestDownloadOverUnixSocket(c *check.C) {
+	path := filepath.Join(c.MkDir(), "origin.sock")
+	listener, err := net.Listen("unix", path)
+	c.Assert(err, check.IsNil)
+	var hosts []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		w.Write([]byte("dragonfly"))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	cfg := config.NewConfig()
+	cfg.OriginUnixSockets = map[string]string{"registry.local": path}
+	client := NewOriginClientWithConfig(cfg, prometheus.NewRegistry())
+
+	// the socket client is kept when the task registers the tls config of the host.
+	client.RegisterTLSConfig("http://registry.local/file", true, nil)
+
+	resp, err := client.Download("http://registry.local/file", nil, http.StatusOK)
+	c.Assert(err, check.IsNil)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, "dragonfly")
+	c.Check(hosts, check.DeepEquals, []string{"registry.local"})
+
+	// the other hosts are still dialed over TCP.
+	_, err = client.Download("http://unmapped.invalid/file", nil, http.StatusOK)
+	c.Check(err, check.NotNil)
+}
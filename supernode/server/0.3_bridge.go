@@ -18,7 +18,6 @@ package server
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
@@ -38,6 +37,16 @@ type RegisterResponseData struct {
 	TaskID     string `json:"taskId"`
 	FileLength int64  `json:"fileLength"`
 	PieceSize  int32  `json:"pieceSize"`
+
+	// Passthrough tells the client to download the file from the source directly,
+	// which is responded with the code CodeSourcePassthrough without registering the task.
+	Passthrough *PassthroughData `json:"passthrough,omitempty"`
+}
+
+// PassthroughData is the directive telling the client how to download the file from the source.
+type PassthroughData struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 // PullPieceTaskResponseContinueData is the data when successfully pulling piece task
@@ -68,15 +77,22 @@ var resultMap = map[string]string{
 }
 
 func (s *Server) registry(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
-	reader := req.Body
 	request := &types.TaskRegisterRequest{}
-	if err := json.NewDecoder(reader).Decode(request); err != nil {
-		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	if err := decodeRequestBody(req, request); err != nil {
+		return err
 	}
 
 	if err := request.Validate(strfmt.NewFormats()); err != nil {
 		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
 	}
+	if err := s.validateRegisterBounds(request); err != nil {
+		return err
+	}
+	if request.AllowPassthrough {
+		if reason := s.overloadReason(ctx); reason != "" {
+			return s.passthrough(rw, request, reason)
+		}
+	}
 
 	peerCreateRequest := &types.PeerCreateRequest{
 		IP:       request.IP,
@@ -93,17 +109,25 @@ func (s *Server) registry(ctx context.Context, rw http.ResponseWriter, req *http
 
 	peerID := peerCreateResponse.ID
 	taskCreateRequest := &types.TaskCreateRequest{
-		CID:         request.CID,
-		CallSystem:  request.CallSystem,
-		Dfdaemon:    request.Dfdaemon,
-		Headers:     netutils.ConvertHeaders(request.Headers),
-		Identifier:  request.Identifier,
-		Md5:         request.Md5,
-		Path:        request.Path,
-		PeerID:      peerID,
-		RawURL:      request.RawURL,
-		TaskURL:     request.TaskURL,
-		SupernodeIP: request.SuperNodeIP,
+		CID:            request.CID,
+		CallSystem:     request.CallSystem,
+		ClientIdentity: request.ClientIdentity,
+		Dfdaemon:       request.Dfdaemon,
+		Headers:        netutils.ConvertHeaders(request.Headers),
+		Identifier:     request.Identifier,
+		Md5:            request.Md5,
+		Path:           request.Path,
+		PeerID:         peerID,
+		RawURL:         request.RawURL,
+		TaskURL:        request.TaskURL,
+		SupernodeIP:    request.SuperNodeIP,
+		Tags:           request.Tags,
+
+		CompletionPolicy: request.CompletionPolicy,
+		RequiredRange:    request.RequiredRange,
+		PieceOrder:       request.PieceOrder,
+		Consistency:      request.Consistency,
+		DigestAlgorithm:  request.DigestAlgorithm,
 	}
 	s.OriginClient.RegisterTLSConfig(taskCreateRequest.RawURL, request.Insecure, request.RootCAs)
 	resp, err := s.TaskMgr.Register(ctx, taskCreateRequest)
@@ -148,6 +172,11 @@ func (s *Server) pullPieceTask(ctx context.Context, rw http.ResponseWriter, req
 
 	isFinished, data, err := s.TaskMgr.GetPieces(ctx, taskID, srcCID, request)
 	if err != nil {
+		// the piece out of range is requested by a buggy or malicious client,
+		// which is rejected as a bad request.
+		if errortypes.IsPieceOutOfRange(err) {
+			return err
+		}
 		if errortypes.IsCDNFail(err) {
 			logrus.Errorf("taskID:%s, failed to get pieces %+v: %v", taskID, request, err)
 		}
@@ -225,6 +254,27 @@ func (s *Server) reportPiece(ctx context.Context, rw http.ResponseWriter, req *h
 	})
 }
 
+// renewLease renews the lease of the client on the task to keep it attached while it makes
+// no download progress. The client detached is told the reason with the code of the result
+// like pulling the pieces, such as the client inactive, to register again.
+func (s *Server) renewLease(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	params := req.URL.Query()
+	taskID := params.Get("taskId")
+	cID := params.Get("cid")
+
+	if err := s.TaskMgr.RenewClient(ctx, taskID, cID); err != nil {
+		resultInfo := NewResultInfoWithError(err)
+		return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
+			Code: int32(resultInfo.code),
+			Msg:  resultInfo.msg,
+		})
+	}
+
+	return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
+		Code: constants.CodeLeaseRenewed,
+	})
+}
+
 func (s *Server) reportServiceDown(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
 	params := req.URL.Query()
 	taskID := params.Get("taskId")
@@ -255,3 +305,21 @@ func (s *Server) reportServiceDown(ctx context.Context, rw http.ResponseWriter,
 		Code: constants.CodeGetPeerDown,
 	})
 }
+
+// validateRegisterBounds checks that the fields of the registration
+// don't exceed the bounds configured for supernode.
+func (s *Server) validateRegisterBounds(request *types.TaskRegisterRequest) error {
+	if limit := s.Config.MaxRegisterHeaders; limit > 0 && len(request.Headers) > limit {
+		return errors.Wrapf(errortypes.ErrRequestTooLarge, "the number of headers %d exceeds the limit %d",
+			len(request.Headers), limit)
+	}
+	if limit := s.Config.MaxRegisterRootCAs; limit > 0 && len(request.RootCAs) > limit {
+		return errors.Wrapf(errortypes.ErrRequestTooLarge, "the number of rootCAs %d exceeds the limit %d",
+			len(request.RootCAs), limit)
+	}
+	if limit := s.Config.MaxTaskTags; limit > 0 && len(request.Tags) > limit {
+		return errors.Wrapf(errortypes.ErrRequestTooLarge, "the number of tags %d exceeds the limit %d",
+			len(request.Tags), limit)
+	}
+	return nil
+}
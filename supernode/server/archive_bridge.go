@@ -0,0 +1,281 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// archiveModTime is the modification time of all the members in the tar stream,
+// so that the stream is the same for the same content of the members.
+var archiveModTime = time.Unix(0, 0)
+
+func (s *Server) createArchive(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	request := &types.ArchiveCreateRequest{}
+	if err := decodeRequestBody(req, request); err != nil {
+		return err
+	}
+	if err := request.Validate(strfmt.NewFormats()); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+
+	archive, err := s.TaskMgr.RegisterArchive(ctx, request)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusCreated, archive)
+}
+
+func (s *Server) getArchive(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	archive, err := s.TaskMgr.GetArchive(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, archive)
+}
+
+// serveArchiveContent serves the tar stream assembling the contents of the members cached
+// by supernode, in which the members are ordered by name with the same metadata.
+// So the stream of the same members is always the same, and the range requests are supported.
+func (s *Server) serveArchiveContent(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	archive, members, closeMembers, err := s.openArchive(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	defer closeMembers()
+
+	stream, _, err := newArchiveStream(members)
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", "application/x-tar")
+	rw.Header().Set("Etag", archiveETag(members))
+	http.ServeContent(rw, req, archive.ID+".tar", time.Time{}, stream)
+	return nil
+}
+
+// getArchiveManifest gets the layout of the members in the tar stream of the archive,
+// with which the clients can extract a member by downloading its range of the stream only.
+func (s *Server) getArchiveManifest(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	archive, members, closeMembers, err := s.openArchive(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	defer closeMembers()
+
+	stream, offsets, err := newArchiveStream(members)
+	if err != nil {
+		return err
+	}
+	manifest := &types.ArchiveManifest{
+		ID:      archive.ID,
+		Size:    stream.Size(),
+		Members: make([]*types.ArchiveManifestMember, 0, len(members)),
+	}
+	for i, member := range members {
+		manifest.Members = append(manifest.Members, &types.ArchiveManifestMember{
+			Name:   member.name,
+			TaskID: archive.Members[i].TaskID,
+			Md5:    member.md5,
+			Offset: offsets[i],
+			Size:   member.content.Size(),
+		})
+	}
+	return EncodeResponse(rw, http.StatusOK, manifest)
+}
+
+// serveArchiveMember serves the content of the member of the archive by name, which is
+// the range of the member in the tar stream. And the range requests within the member are supported.
+func (s *Server) serveArchiveMember(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	name := mux.Vars(req)["name"]
+	archive, members, closeMembers, err := s.openArchive(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+	defer closeMembers()
+
+	stream, offsets, err := newArchiveStream(members)
+	if err != nil {
+		return err
+	}
+	for i, member := range members {
+		if member.name != name {
+			continue
+		}
+		if member.md5 != "" {
+			rw.Header().Set("Etag", fmt.Sprintf("%q", member.md5))
+		}
+		rw.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(rw, req, path.Base(name), time.Time{},
+			io.NewSectionReader(stream, offsets[i], member.content.Size()))
+		return nil
+	}
+	return errors.Wrapf(errortypes.ErrDataNotFound, "member %s of archive %s", name, archive.ID)
+}
+
+// openArchive opens the contents of the members of the archive which has been cached,
+// and the returned function should be called to close them.
+func (s *Server) openArchive(ctx context.Context, archiveID string) (*types.ArchiveInfo, []archiveMember, func(), error) {
+	archive, err := s.TaskMgr.GetArchive(ctx, archiveID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if archive.Status != types.ArchiveInfoStatusSUCCESS {
+		return nil, nil, nil, errors.Wrapf(errortypes.ErrDataNotFound, "archive %s is %s", archive.ID, archive.Status)
+	}
+
+	contents := make([]*mgr.Content, 0, len(archive.Members))
+	closeContents := func() {
+		for _, content := range contents {
+			content.Close()
+		}
+	}
+	members := make([]archiveMember, 0, len(archive.Members))
+	for _, member := range archive.Members {
+		task, err := s.TaskMgr.Get(ctx, member.TaskID)
+		if err != nil {
+			closeContents()
+			return nil, nil, nil, err
+		}
+		content, err := s.CDNMgr.OpenContent(ctx, member.TaskID)
+		if err != nil {
+			closeContents()
+			return nil, nil, nil, err
+		}
+		contents = append(contents, content)
+		size, err := content.Seek(0, io.SeekEnd)
+		if err != nil {
+			closeContents()
+			return nil, nil, nil, err
+		}
+		members = append(members, archiveMember{
+			name:    *member.Name,
+			md5:     task.RealMd5,
+			content: io.NewSectionReader(content, 0, size),
+		})
+	}
+	return archive, members, closeContents, nil
+}
+
+// archiveMember is a member of the tar stream.
+type archiveMember struct {
+	name    string
+	md5     string
+	content *io.SectionReader
+}
+
+// archiveETag returns the ETag of the tar stream of the members,
+// which is derived from the names and the md5 of the members.
+func archiveETag(members []archiveMember) string {
+	var sb strings.Builder
+	for _, member := range members {
+		fmt.Fprintf(&sb, "%s\t%d\t%s\n", member.name, member.content.Size(), member.md5)
+	}
+	return fmt.Sprintf("%q", digest.Sha256(sb.String()))
+}
+
+// newArchiveStream returns the tar stream of the members for reading at random offsets,
+// which consists of the header, the content and the padding of each member in order,
+// followed by the two zero blocks marking the end of the archive.
+// And it returns the offsets of the contents of the members in the stream.
+func newArchiveStream(members []archiveMember) (*io.SectionReader, []int64, error) {
+	var (
+		sections []*io.SectionReader
+		offsets  []int64
+		offset   int64
+	)
+	for _, member := range members {
+		var header bytes.Buffer
+		tw := tar.NewWriter(&header)
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     member.name,
+			Mode:     0644,
+			Size:     member.content.Size(),
+			ModTime:  archiveModTime,
+		}); err != nil {
+			return nil, nil, errors.Wrapf(errortypes.ErrInvalidValue, "member %s: %v", member.name, err)
+		}
+
+		offset += int64(header.Len())
+		offsets = append(offsets, offset)
+		offset += member.content.Size()
+		sections = append(sections, bytesSection(header.Bytes()), member.content)
+		if remainder := member.content.Size() % tarBlockSize; remainder != 0 {
+			sections = append(sections, bytesSection(make([]byte, tarBlockSize-remainder)))
+			offset += tarBlockSize - remainder
+		}
+	}
+	sections = append(sections, bytesSection(make([]byte, 2*tarBlockSize)))
+
+	var size int64
+	for _, section := range sections {
+		size += section.Size()
+	}
+	return io.NewSectionReader(multiReaderAt(sections), 0, size), offsets, nil
+}
+
+// tarBlockSize is the size of the blocks which the tar stream is made up of.
+const tarBlockSize = 512
+
+func bytesSection(b []byte) *io.SectionReader {
+	return io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))
+}
+
+// multiReaderAt is the logical concatenation of the sections.
+type multiReaderAt []*io.SectionReader
+
+func (mr multiReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	for _, section := range mr {
+		if len(p) == 0 {
+			return n, nil
+		}
+		if off >= section.Size() {
+			off -= section.Size()
+			continue
+		}
+
+		read, err := section.ReadAt(p, off)
+		n += read
+		p = p[read:]
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		off = 0
+	}
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+
+	"github.com/go-check/check"
+)
+
+// createArchive creates the archive of the members in the form of name:url.
+func createArchive(c *check.C, serverURL string, members ...string) *types.ArchiveInfo {
+	req := &types.ArchiveCreateRequest{}
+	for _, member := range members {
+		parts := strings.SplitN(member, ":", 2)
+		req.Members = append(req.Members, &types.ArchiveMember{Name: &parts[0], RawURL: &parts[1]})
+	}
+	body, err := json.Marshal(req)
+	c.Assert(err, check.IsNil)
+	resp, err := http.Post(serverURL+"/archives", "application/json", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusCreated)
+	archive := &types.ArchiveInfo{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(archive), check.IsNil)
+	return archive
+}
+
+func (s *TaskBridgeTestSuite) TestServeArchive(c *check.C) {
+	files := map[string]string{
+		"/a.txt":     strings.Repeat("a", 1000),
+		"/dir/b.bin": strings.Repeat("dragonfly", 100000),
+	}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, r.URL.Path, time.Unix(1500000000, 0), strings.NewReader(files[r.URL.Path]))
+	}))
+	defer origin.Close()
+	srv, server := s.newSupernode(c, "127.0.0.2")
+	defer server.Close()
+
+	// the members are cached as the tasks
+	archive := createArchive(c, server.URL, "dir/b.bin:"+origin.URL+"/dir/b.bin", "a.txt:"+origin.URL+"/a.txt")
+	c.Assert(archive.Members, check.HasLen, 2)
+	c.Check(*archive.Members[0].Name, check.Equals, "a.txt")
+	c.Check(*archive.Members[1].Name, check.Equals, "dir/b.bin")
+	for _, member := range archive.Members {
+		c.Check(waitTaskFinished(c, srv.TaskMgr, member.TaskID).CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	}
+	info, err := srv.TaskMgr.GetArchive(context.Background(), archive.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(info.Status, check.Equals, types.ArchiveInfoStatusSUCCESS)
+
+	// and assembled into the deterministic tar
+	var expected bytes.Buffer
+	tw := tar.NewWriter(&expected)
+	for _, name := range []string{"a.txt", "dir/b.bin"} {
+		content := files["/"+name]
+		c.Assert(tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  time.Unix(0, 0),
+		}), check.IsNil)
+		_, err := tw.Write([]byte(content))
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(tw.Close(), check.IsNil)
+
+	get := func(rangeHeader string) (*http.Response, []byte) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/archives/"+archive.ID+"/content", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, check.IsNil)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		c.Assert(err, check.IsNil)
+		return resp, body
+	}
+	resp, first := get("")
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(resp.Header.Get("Content-Type"), check.Equals, "application/x-tar")
+	c.Check(sha256.Sum256(first), check.Equals, sha256.Sum256(expected.Bytes()))
+	etag := resp.Header.Get("Etag")
+
+	// the digest is stable across the requests and the registrations
+	c.Check(createArchive(c, server.URL, "a.txt:"+origin.URL+"/a.txt", "dir/b.bin:"+origin.URL+"/dir/b.bin").ID,
+		check.Equals, archive.ID)
+	resp, second := get("")
+	c.Check(sha256.Sum256(second), check.Equals, sha256.Sum256(first))
+	c.Check(resp.Header.Get("Etag"), check.Equals, etag)
+
+	// and the range across the members is served
+	resp, part := get("bytes=1000-2047")
+	c.Assert(resp.StatusCode, check.Equals, http.StatusPartialContent)
+	c.Check(part, check.DeepEquals, expected.Bytes()[1000:2048])
+}
+
+func (s *TaskBridgeTestSuite) TestServeArchiveMember(c *check.C) {
+	longName := strings.Repeat("long/", 30) + "c.txt"
+	files := map[string]string{
+		"/a.txt":         strings.Repeat("a", 1000),
+		"/b.bin":         strings.Repeat("dragonfly", 100000),
+		"/" + longName:   "the name needs a PAX header",
+		"/unused/z.json": "{}",
+	}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, r.URL.Path, time.Unix(1500000000, 0), strings.NewReader(files[r.URL.Path]))
+	}))
+	defer origin.Close()
+	srv, server := s.newSupernode(c, "127.0.0.2")
+	defer server.Close()
+
+	archive := createArchive(c, server.URL, "b.bin:"+origin.URL+"/b.bin", "a.txt:"+origin.URL+"/a.txt",
+		longName+":"+origin.URL+"/"+longName)
+	for _, member := range archive.Members {
+		c.Check(waitTaskFinished(c, srv.TaskMgr, member.TaskID).CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	}
+
+	get := func(path, rangeHeader string) (*http.Response, []byte) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/archives/"+archive.ID+path, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, check.IsNil)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		c.Assert(err, check.IsNil)
+		return resp, body
+	}
+
+	// the manifest locates each member in the tar stream
+	resp, body := get("/manifest", "")
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	manifest := &types.ArchiveManifest{}
+	c.Assert(json.Unmarshal(body, manifest), check.IsNil)
+	c.Check(manifest.ID, check.Equals, archive.ID)
+	_, stream := get("/content", "")
+	c.Check(manifest.Size, check.Equals, int64(len(stream)))
+	c.Assert(manifest.Members, check.HasLen, 3)
+	for i, member := range manifest.Members {
+		c.Check(member.Name, check.Equals, *archive.Members[i].Name)
+		c.Check(member.TaskID, check.Equals, archive.Members[i].TaskID)
+		c.Check(member.Size, check.Equals, int64(len(files["/"+member.Name])))
+		c.Check(string(stream[member.Offset:member.Offset+member.Size]), check.Equals, files["/"+member.Name])
+	}
+
+	// and the member is served by name with the ranges within it
+	for _, name := range []string{"a.txt", "b.bin", longName} {
+		resp, body := get("/members/"+name, "")
+		c.Assert(resp.StatusCode, check.Equals, http.StatusOK, check.Commentf(name))
+		c.Check(string(body), check.Equals, files["/"+name], check.Commentf(name))
+		c.Check(resp.Header.Get("Etag"), check.Not(check.Equals), "", check.Commentf(name))
+	}
+	resp, body = get("/members/b.bin", "bytes=9-17")
+	c.Assert(resp.StatusCode, check.Equals, http.StatusPartialContent)
+	c.Check(string(body), check.Equals, "dragonfly")
+	c.Check(resp.Header.Get("Content-Range"), check.Equals, "bytes 9-17/900000")
+
+	// but the member not in the archive is not found
+	resp, _ = get("/members/unused/z.json", "")
+	c.Check(resp.StatusCode, check.Equals, http.StatusInternalServerError)
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// nextCursorHeader carries the cursor to continue the cache inventory from,
+// which is absent on the last page.
+const nextCursorHeader = "X-Dragonfly-Next-Cursor"
+
+func (s *Server) purgeCache(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	params := req.URL.Query()
+
+	taskIDs, err := s.TaskMgr.Purge(ctx, params.Get("url"), params.Get("digest"), params.Get("tag"))
+	if err != nil {
+		return err
+	}
+
+	return EncodeResponse(rw, http.StatusOK, &types.CachePurgeResponse{
+		TaskIDs: taskIDs,
+	})
+}
+
+// exportCacheInventory streams the tasks cached successfully as newline-delimited JSON
+// in the order of the task IDs. The entries are encoded one by one as they're written,
+// and the page starts after the task ID of the cursor and ends at the limit if it's set.
+func (s *Server) exportCacheInventory(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	params := req.URL.Query()
+	var limit int
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "limit: %s", v)
+		}
+	}
+
+	tasks, err := s.TaskMgr.List(ctx, map[string]string{"cdnStatus": types.TaskInfoCdnStatusSUCCESS})
+	if err != nil {
+		return err
+	}
+	accessTimes, err := s.TaskMgr.GetAccessTime(ctx)
+	if err != nil {
+		return err
+	}
+	storageDriver := s.CDNMgr.GetStorageDriver(ctx)
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].ID < tasks[j].ID
+	})
+	cursor := params.Get("cursor")
+	tasks = tasks[sort.Search(len(tasks), func(i int) bool { return tasks[i].ID > cursor }):]
+	if limit > 0 && len(tasks) > limit {
+		tasks = tasks[:limit]
+		rw.Header().Set(nextCursorHeader, tasks[limit-1].ID)
+	}
+
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	rw.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(rw)
+	for _, task := range tasks {
+		entry := &types.CacheInventoryEntry{
+			Digest:        task.RealMd5,
+			PieceCount:    task.PieceTotal,
+			Size:          task.HTTPFileLength,
+			StorageDriver: storageDriver,
+			TaskID:        task.ID,
+			URL:           task.RawURL,
+		}
+		if v, err := accessTimes.Get(task.ID); err == nil {
+			if accessTime, ok := v.(int64); ok {
+				entry.LastAccess = strfmt.DateTime(time.Unix(0, accessTime*int64(time.Millisecond)))
+			}
+		}
+		if err := enc.Encode(entry); err != nil {
+			logrus.Debugf("stop streaming the cache inventory at taskID(%s): %v", task.ID, err)
+			return nil
+		}
+	}
+	return nil
+}
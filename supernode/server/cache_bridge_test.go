@@ -0,0 +1,106 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+)
+
+func (s *TaskBridgeTestSuite) TestExportCacheInventory(c *check.C) {
+	content := strings.Repeat("dragonfly", 100000)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Unix(1500000000, 0), strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	cached := make(map[string]string)
+	for i := 0; i < 3; i++ {
+		rawURL := fmt.Sprintf("%s/file%d", origin.URL, i)
+		taskID := registerTask(c, server.URL, rawURL, fmt.Sprintf("127.0.0.3-1-%d", i))
+		c.Assert(waitTaskFinished(c, srv.TaskMgr, taskID).CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+		cached[taskID] = rawURL
+	}
+	// the task failing to download is not in the inventory
+	code, failedID := registerTaskWithMd5(c, server.URL, origin.URL+"/corrupted", "127.0.0.3-1-3", "00000000000000000000000000000000")
+	c.Assert(code, check.Equals, constants.Success)
+	c.Assert(waitTaskFinished(c, srv.TaskMgr, failedID).CdnStatus, check.Equals, types.TaskInfoCdnStatusFAILED)
+
+	// all the entries in a stream
+	entries, next := getCacheInventory(c, server.URL, "", 0)
+	c.Check(next, check.Equals, "")
+	c.Assert(entries, check.HasLen, len(cached))
+	for _, entry := range entries {
+		c.Check(entry.URL, check.Equals, cached[entry.TaskID])
+		c.Check(entry.Size, check.Equals, int64(len(content)))
+		c.Check(entry.PieceCount, check.Equals, int32(1))
+		c.Check(entry.Digest, check.Not(check.Equals), "")
+		c.Check(entry.StorageDriver, check.Equals, store.LocalStorageDriver)
+		c.Check(time.Since(time.Time(entry.LastAccess)) < time.Minute, check.Equals, true)
+	}
+	c.Check(sort.SliceIsSorted(entries, func(i, j int) bool { return entries[i].TaskID < entries[j].TaskID }), check.Equals, true)
+
+	// the entries continued with the cursor
+	first, next := getCacheInventory(c, server.URL, "", 2)
+	c.Assert(first, check.HasLen, 2)
+	c.Check(next, check.Equals, first[1].TaskID)
+	rest, next := getCacheInventory(c, server.URL, next, 2)
+	c.Assert(rest, check.HasLen, 1)
+	c.Check(next, check.Equals, "")
+	c.Check(append(first, rest...), check.DeepEquals, entries)
+
+	resp, err := http.Get(server.URL + "/cache/inventory?limit=-1")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusInternalServerError)
+}
+
+// getCacheInventory gets a page of the cache inventory and the cursor to continue from.
+func getCacheInventory(c *check.C, serverURL, cursor string, limit int) ([]*types.CacheInventoryEntry, string) {
+	query := url.Values{}
+	query.Set("cursor", cursor)
+	query.Set("limit", fmt.Sprint(limit))
+	resp, err := http.Get(serverURL + "/cache/inventory?" + query.Encode())
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(resp.Header.Get("Content-Type"), check.Equals, "application/x-ndjson")
+
+	var entries []*types.CacheInventoryEntry
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		entry := &types.CacheInventoryEntry{}
+		c.Assert(entry.UnmarshalBinary(scanner.Bytes()), check.IsNil)
+		entries = append(entries, entry)
+	}
+	c.Assert(scanner.Err(), check.IsNil)
+	return entries, resp.Header.Get(nextCursorHeader)
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// connHoldTimeout is the max duration that a connection beyond the limit
+	// is held waiting for a free slot before it's rejected.
+	connHoldTimeout = time.Second
+
+	// connRejectTimeout is the max duration of writing the rejection to a connection.
+	connRejectTimeout = time.Second
+)
+
+// limitListener is a net.Listener that serves at most limit connections at the same time.
+// A connection beyond the limit is held waiting for a free slot, and it's rejected gracefully
+// if no slot is free within connHoldTimeout. Each connection is held on its own,
+// so all the connections beyond the limit get the same bounded wait.
+type limitListener struct {
+	net.Listener
+	slots chan struct{}
+	// holdTimeout is the connHoldTimeout when the listener is created.
+	holdTimeout time.Duration
+	// rejectWithResponse indicates whether to write a 503 response with a
+	// Retry-After header before closing a rejected connection. It should be
+	// false if the connections are wrapped by TLS later.
+	rejectWithResponse bool
+	// retryAfter returns the seconds of the Retry-After header of a rejection.
+	retryAfter func() int
+
+	// accepted delivers the connections which have acquired a slot to Accept,
+	// and errs delivers the errors of accepting the connections.
+	accepted  chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+
+	connections prometheus.Gauge
+	rejected    prometheus.Counter
+}
+
+func newLimitListener(l net.Listener, limit int, rejectWithResponse bool, retryAfter func() int,
+	connections prometheus.Gauge, rejected prometheus.Counter) *limitListener {
+	ll := &limitListener{
+		Listener:           l,
+		slots:              make(chan struct{}, limit),
+		holdTimeout:        connHoldTimeout,
+		rejectWithResponse: rejectWithResponse,
+		retryAfter:         retryAfter,
+		accepted:           make(chan net.Conn),
+		errs:               make(chan error),
+		done:               make(chan struct{}),
+		connections:        connections,
+		rejected:           rejected,
+	}
+	go ll.acceptLoop()
+	return ll
+}
+
+// Accept waits for the next connection which has acquired a slot.
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accepted:
+		l.connections.Inc()
+		return &limitConn{Conn: conn, release: l.release}, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, errors.Wrap(errortypes.ErrSystemError, "the listener is closed")
+	}
+}
+
+// Close closes the listener, and the held connections are closed as well.
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+// acceptLoop accepts the connections until the listener is closed,
+// and holds the connections without a free slot in their own goroutines.
+func (l *limitListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+				continue
+			case <-l.done:
+				return
+			}
+		}
+		if l.acquire(0) {
+			l.deliver(conn)
+			continue
+		}
+		go l.hold(conn)
+	}
+}
+
+// hold waits for a free slot for the connection within the holdTimeout,
+// otherwise the connection is rejected.
+func (l *limitListener) hold(conn net.Conn) {
+	if !l.acquire(l.holdTimeout) {
+		l.rejected.Inc()
+		l.reject(conn)
+		return
+	}
+	l.deliver(conn)
+}
+
+// deliver passes the connection which has acquired a slot to Accept,
+// or closes it if the listener is closed.
+func (l *limitListener) deliver(conn net.Conn) {
+	select {
+	case l.accepted <- conn:
+	case <-l.done:
+		<-l.slots
+		conn.Close()
+	}
+}
+
+func (l *limitListener) acquire(timeout time.Duration) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (l *limitListener) release() {
+	l.connections.Dec()
+	<-l.slots
+}
+
+func (l *limitListener) reject(conn net.Conn) {
+	defer conn.Close()
+	logrus.Debugf("reject the connection from %s since the connections reach the limit %d",
+		conn.RemoteAddr(), cap(l.slots))
+	if !l.rejectWithResponse {
+		return
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(connRejectTimeout))
+	fmt.Fprintf(conn, "HTTP/1.1 503 Service Unavailable\r\n"+
+		"Retry-After: %d\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", l.retryAfter())
+}
+
+// newRetryAfter returns a function that generates the seconds of the Retry-After header,
+// which is the base plus a random number of whole seconds within the jitter. So the clients
+// rejected at the same time are spread out over the jitter instead of retrying together.
+// The random numbers are generated by its own source seeded with seed.
+func newRetryAfter(base, jitter time.Duration, seed int64) func() int {
+	baseSeconds := int((base + time.Second - 1) / time.Second)
+	jitterSeconds := int(jitter / time.Second)
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return func() int {
+		if jitterSeconds <= 0 {
+			return baseSeconds
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return baseSeconds + r.Intn(jitterSeconds+1)
+	}
+}
+
+// limitConn releases the slot of the limitListener when it's closed the first time.
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
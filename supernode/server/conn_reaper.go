@@ -0,0 +1,112 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// connReaper closes the client connections which have lived longer than the maxLifetime
+// once they become idle, so that the requests in progress are never interrupted.
+// The HTTP/2 connections are never idle in the view of the http.Server,
+// so they're only closed by the IdleTimeout of the HTTP/2 server.
+type connReaper struct {
+	maxLifetime time.Duration
+
+	sync.Mutex
+	// conns contains the time when the connections are accepted.
+	conns map[net.Conn]time.Time
+	// idle contains the connections waiting for the next request.
+	idle map[net.Conn]bool
+}
+
+func newConnReaper(maxLifetime time.Duration) *connReaper {
+	return &connReaper{
+		maxLifetime: maxLifetime,
+		conns:       make(map[net.Conn]time.Time),
+		idle:        make(map[net.Conn]bool),
+	}
+}
+
+// trackConnState records the connections and closes the expired one when it becomes idle.
+func (r *connReaper) trackConnState(conn net.Conn, state http.ConnState) {
+	r.Lock()
+	defer r.Unlock()
+
+	switch state {
+	case http.StateNew:
+		r.conns[conn] = time.Now()
+	case http.StateActive:
+		delete(r.idle, conn)
+	case http.StateIdle:
+		if r.isExpired(conn, time.Now()) {
+			r.close(conn)
+			return
+		}
+		r.idle[conn] = true
+	case http.StateHijacked, http.StateClosed:
+		delete(r.conns, conn)
+		delete(r.idle, conn)
+	}
+}
+
+// reap closes the idle connections which have expired since they became idle.
+func (r *connReaper) reap(now time.Time) {
+	r.Lock()
+	defer r.Unlock()
+
+	for conn := range r.idle {
+		if r.isExpired(conn, now) {
+			r.close(conn)
+		}
+	}
+}
+
+// start reaps the idle connections periodically in the background.
+func (r *connReaper) start() {
+	interval := r.maxLifetime / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			r.reap(now)
+		}
+	}()
+}
+
+func (r *connReaper) isExpired(conn net.Conn, now time.Time) bool {
+	acceptedAt, ok := r.conns[conn]
+	return ok && now.Sub(acceptedAt) >= r.maxLifetime
+}
+
+func (r *connReaper) close(conn net.Conn) {
+	delete(r.conns, conn)
+	delete(r.idle, conn)
+	if err := conn.Close(); err != nil {
+		logrus.Debugf("failed to close the connection from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	logrus.Debugf("close the connection from %s which lives longer than %v", conn.RemoteAddr(), r.maxLifetime)
+}
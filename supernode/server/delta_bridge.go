@@ -0,0 +1,92 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/delta"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// serveTaskDelta serves the delta which reconstructs the file cached by supernode
+// from the version held by the client with the signature of that version.
+// It fails if the task isn't cached, and the client should download the whole file then.
+func (s *Server) serveTaskDelta(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+
+	request := &types.DeltaSignature{}
+	if err := decodeRequestBody(req, request); err != nil {
+		return err
+	}
+	if err := request.Validate(strfmt.NewFormats()); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+	sig := toSignature(request)
+	if err := sig.Validate(); err != nil {
+		return err
+	}
+
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	content, err := s.CDNMgr.OpenContent(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	if digest := taskDigest(task); digest != "" {
+		rw.Header().Set("Digest", digest)
+	}
+	rw.WriteHeader(http.StatusOK)
+
+	// the error can't be responded after the status is sent,
+	// and the client will fail to apply the truncated delta.
+	stats, err := delta.Compute(sig, content, rw)
+	if err != nil {
+		logrus.Errorf("failed to compute the delta of taskID %s against %s: %v", id, sig, err)
+		return nil
+	}
+	logrus.Infof("success to compute the delta of taskID %s against %s: copied %d bytes, literal %d bytes",
+		id, sig, stats.CopiedBytes, stats.LiteralBytes)
+	return nil
+}
+
+func toSignature(request *types.DeltaSignature) *delta.Signature {
+	sig := &delta.Signature{
+		BlockSize: int(*request.BlockSize),
+		Size:      request.Size,
+		Blocks:    make([]delta.BlockSignature, len(request.Blocks)),
+	}
+	for i, b := range request.Blocks {
+		if b == nil {
+			continue
+		}
+		sig.Blocks[i] = delta.BlockSignature{Weak: uint32(b.Weak), Strong: b.Strong}
+	}
+	return sig
+}
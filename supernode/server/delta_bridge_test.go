@@ -0,0 +1,94 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/delta"
+
+	"github.com/go-check/check"
+)
+
+func (s *TaskBridgeTestSuite) TestServeTaskDelta(c *check.C) {
+	content := strings.Repeat("dragonfly", 1000) + "the newest version"
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Unix(1500000000, 0), strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	taskID := registerTask(c, server.URL, origin.URL+"/file", "127.0.0.3-1-1")
+	task := waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+
+	base := []byte(strings.Repeat("dragonfly", 900) + "an older version")
+	sig, err := delta.NewSignature(bytes.NewReader(base), 128)
+	c.Assert(err, check.IsNil)
+
+	resp := postDelta(c, server.URL, taskID, sig)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(resp.Header.Get("Digest"), check.Equals, md5Digest(task.RealMd5))
+
+	var body bytes.Buffer
+	_, err = body.ReadFrom(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(body.Len() < len(content)/2, check.Equals, true, check.Commentf("delta size: %d", body.Len()))
+
+	var reconstructed bytes.Buffer
+	c.Assert(delta.Apply(bytes.NewReader(base), &body, &reconstructed), check.IsNil)
+	c.Check(reconstructed.String(), check.Equals, content)
+}
+
+func (s *TaskBridgeTestSuite) TestServeTaskDeltaFailure(c *check.C) {
+	_, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+
+	// the client falls back to the whole file if the task isn't cached.
+	sig := &delta.Signature{BlockSize: delta.MinBlockSize}
+	resp := postDelta(c, server.URL, "unknown", sig)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Not(check.Equals), http.StatusOK)
+
+	// the blocks don't cover the size.
+	sig.Size = 100
+	resp = postDelta(c, server.URL, "unknown", sig)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Not(check.Equals), http.StatusOK)
+}
+
+func postDelta(c *check.C, serverURL, taskID string, sig *delta.Signature) *http.Response {
+	blockSize := int64(sig.BlockSize)
+	request := &types.DeltaSignature{BlockSize: &blockSize, Size: sig.Size}
+	for _, b := range sig.Blocks {
+		request.Blocks = append(request.Blocks, &types.DeltaBlock{Weak: int64(b.Weak), Strong: b.Strong})
+	}
+	body, err := json.Marshal(request)
+	c.Assert(err, check.IsNil)
+
+	resp, err := http.Post(serverURL+"/tasks/"+taskID+"/delta", "application/json", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	return resp
+}
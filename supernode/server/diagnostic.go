@@ -0,0 +1,141 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// the initialization steps of supernode server.
+const (
+	stepStore     = "store"
+	stepOrigin    = "origin"
+	stepPeer      = "peer"
+	stepDfgetTask = "dfgettask"
+	stepProgress  = "progress"
+	stepScheduler = "scheduler"
+	stepCDN       = "cdn"
+	stepTask      = "task"
+	stepReplica   = "replica"
+)
+
+// redactedValue replaces the values of the sensitive config items in the diagnostic.
+const redactedValue = "******"
+
+// sensitiveConfigKeywords contains the keywords of the sensitive config items.
+var sensitiveConfigKeywords = []string{"key", "secret", "password", "token", "credential"}
+
+// StartupDiagnostic is the machine-parseable record of a startup failure of supernode.
+type StartupDiagnostic struct {
+	// Time is the time when the failure occurs in RFC3339 format.
+	Time string `json:"time"`
+
+	// Step is the initialization step which fails, such as store, progress and cdn.
+	Step string `json:"step"`
+
+	// Cause is the message of the underlying error.
+	Cause string `json:"cause"`
+
+	// Config contains the base properties of supernode keyed by the names in the config file,
+	// in which the sensitive values are redacted.
+	Config map[string]interface{} `json:"config,omitempty"`
+
+	// Storages contains the names of the configured storages without their settings.
+	Storages []string `json:"storages,omitempty"`
+}
+
+// newStartupDiagnostic creates a diagnostic record for the failure of the step.
+func newStartupDiagnostic(cfg *config.Config, step string, cause error) *StartupDiagnostic {
+	d := &StartupDiagnostic{
+		Time: time.Now().Format(time.RFC3339),
+		Step: step,
+	}
+	if cause != nil {
+		d.Cause = cause.Error()
+	}
+	if cfg == nil {
+		return d
+	}
+
+	d.Config = redactConfig(cfg.BaseProperties)
+	for name := range cfg.Storages {
+		d.Storages = append(d.Storages, name)
+	}
+	sort.Strings(d.Storages)
+	return d
+}
+
+// redactConfig converts the base properties to a map keyed by the names in the config file
+// and redacts the values of the sensitive items.
+func redactConfig(base *config.BaseProperties) map[string]interface{} {
+	if base == nil {
+		return nil
+	}
+	out, err := yaml.Marshal(base)
+	if err != nil {
+		return nil
+	}
+	result := make(map[string]interface{})
+	if err := yaml.Unmarshal(out, &result); err != nil {
+		return nil
+	}
+
+	for k, v := range result {
+		if isSensitiveConfigKey(k) && v != "" {
+			result[k] = redactedValue
+		}
+	}
+	return result
+}
+
+func isSensitiveConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, keyword := range sensitiveConfigKeywords {
+		if strings.Contains(key, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// startupFailed emits the diagnostic record of the failure of the step
+// and returns the cause as it is.
+func startupFailed(cfg *config.Config, step string, cause error) error {
+	d := newStartupDiagnostic(cfg, step, cause)
+	data, err := json.Marshal(d)
+	if err != nil {
+		logrus.Errorf("failed to marshal the startup diagnostic of step %s: %v", step, err)
+		return cause
+	}
+	logrus.Errorf("failed to start supernode, diagnostic: %s", data)
+
+	if cfg != nil && cfg.BaseProperties != nil && cfg.StartupDiagnosticFile != "" {
+		if err := ioutil.WriteFile(cfg.StartupDiagnosticFile, data, 0644); err != nil {
+			logrus.Errorf("failed to write the startup diagnostic to %s: %v", cfg.StartupDiagnosticFile, err)
+		}
+	}
+	return cause
+}
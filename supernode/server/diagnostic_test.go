@@ -0,0 +1,85 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	check.Suite(&StartupDiagnosticTestSuite{})
+}
+
+type StartupDiagnosticTestSuite struct {
+	workHome string
+}
+
+func (s *StartupDiagnosticTestSuite) SetUpSuite(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "supernode-server-StartupDiagnosticTestSuite-")
+}
+
+func (s *StartupDiagnosticTestSuite) TearDownSuite(c *check.C) {
+	if s.workHome != "" {
+		os.RemoveAll(s.workHome)
+	}
+}
+
+func (s *StartupDiagnosticTestSuite) TestSchedulerFailure(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.HomeDir = s.workHome
+	cfg.SchedulerStrategy = "unknown"
+	cfg.TLSKeyFile = "/etc/supernode/server.key"
+	cfg.Storages = map[string]interface{}{"local": "baseDir: /secret/path"}
+	cfg.StartupDiagnosticFile = filepath.Join(s.workHome, "diagnostic.json")
+
+	server, startErr := New(cfg, prometheus.NewRegistry())
+	c.Assert(startErr, check.NotNil)
+	c.Check(server, check.IsNil)
+
+	data, err := ioutil.ReadFile(cfg.StartupDiagnosticFile)
+	c.Assert(err, check.IsNil)
+	var d StartupDiagnostic
+	c.Assert(json.Unmarshal(data, &d), check.IsNil)
+
+	c.Check(d.Step, check.Equals, stepScheduler)
+	c.Check(d.Cause, check.Equals, startErr.Error())
+	c.Check(d.Time, check.Not(check.Equals), "")
+	c.Check(d.Config["schedulerStrategy"], check.Equals, "unknown")
+	c.Check(d.Config["homeDir"], check.Equals, s.workHome)
+	c.Check(d.Config["tlsKeyFile"], check.Equals, redactedValue)
+	c.Check(d.Storages, check.DeepEquals, []string{"local"})
+	c.Check(string(data), check.Not(check.Matches), ".*/secret/path.*")
+}
+
+func (s *StartupDiagnosticTestSuite) TestNewStartupDiagnosticWithoutConfig(c *check.C) {
+	d := newStartupDiagnostic(nil, stepStore, os.ErrNotExist)
+	c.Check(d.Step, check.Equals, stepStore)
+	c.Check(d.Cause, check.Equals, os.ErrNotExist.Error())
+	c.Check(d.Config, check.IsNil)
+
+	d = newStartupDiagnostic(&config.Config{}, stepStore, nil)
+	c.Check(d.Cause, check.Equals, "")
+	c.Check(d.Config, check.IsNil)
+}
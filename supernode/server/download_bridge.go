@@ -0,0 +1,300 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// serveDownload serves the downloaded file of the task with the same path as
+// the http download path of the task, and the range requests are supported.
+func (s *Server) serveDownload(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+
+	file, err := s.CDNMgr.OpenFile(ctx, id)
+	if err != nil {
+		if store.IsKeyNotFound(err) {
+			return errors.Wrapf(errortypes.ErrDataNotFound, "file of taskID: %s", id)
+		}
+		return err
+	}
+	defer file.Close()
+
+	recorder := s.newCorruptionRecorder(file)
+	serveFile(rw, req, id, recorder)
+	s.evictIfCorrupted(ctx, id, recorder)
+	return nil
+}
+
+// serveTaskContent serves the content of the file cached by supernode, which is the same
+// as the source file, with the Last-Modified and ETag of the source. So the supernode
+// serves as a source of the file and the conditional and range requests are supported.
+func (s *Server) serveTaskContent(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return s.serveContent(ctx, rw, req, mux.Vars(req)["id"])
+}
+
+// serveContent serves the content of the task as the serveTaskContent does.
+func (s *Server) serveContent(ctx context.Context, rw http.ResponseWriter, req *http.Request, id string) error {
+	content, err := s.CDNMgr.OpenContent(ctx, id)
+	if err != nil {
+		// the range may have been downloaded although the whole file hasn't.
+		if errortypes.IsDataNotFound(err) && req.Header.Get("Range") != "" {
+			return s.servePartialContent(ctx, rw, req, id, err)
+		}
+		// the content is streamed before it's verified as a whole if the policy allows.
+		if errortypes.IsDataNotFound(err) && s.Config.ContentServingPolicy == config.ContentServingFirstByte {
+			return s.serveEarlyContent(ctx, rw, req, id, err)
+		}
+		return err
+	}
+	defer content.Close()
+
+	var modTime time.Time
+	if content.LastModified > 0 {
+		modTime = time.Unix(content.LastModified/1000, 0)
+	}
+	if content.ETag != "" {
+		rw.Header().Set("Etag", content.ETag)
+	}
+	setCacheDirectives(rw, content)
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	recorder := s.newCorruptionRecorder(content.File)
+	content.File = recorder
+	http.ServeContent(rw, req, id, modTime, content)
+	s.evictIfCorrupted(ctx, id, recorder)
+	return nil
+}
+
+// setCacheDirectives passes the Cache-Control and Expires of the source through,
+// so that the downstream caches and clients could cache the content as the source allows.
+// And the Age tells them how long the content has been cached by supernode.
+func setCacheDirectives(rw http.ResponseWriter, content *mgr.Content) {
+	if content.CacheControl == "" && content.Expires == "" {
+		return
+	}
+	if content.CacheControl != "" {
+		rw.Header().Set("Cache-Control", content.CacheControl)
+	}
+	if content.Expires != "" {
+		rw.Header().Set("Expires", content.Expires)
+	}
+	if content.ResponseTime > 0 {
+		age := time.Since(time.Unix(0, content.ResponseTime*int64(time.Millisecond)))
+		if age < 0 {
+			age = 0
+		}
+		rw.Header().Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	}
+}
+
+// cacheStatusHeader tells whether the file of the task is cached by supernode
+// in the responses to the HEAD requests on the task.
+const cacheStatusHeader = "X-Dragonfly-Cache-Status"
+
+const (
+	cacheStatusHit     = "HIT"
+	cacheStatusRunning = "RUNNING"
+	cacheStatusMiss    = "MISS"
+)
+
+// headTask responds the metadata of the content of the task without the body, so that
+// the tools probing the metadata neither trigger nor wait on the download of the task.
+// The cached task is described by the cached file, and the response for the uncached
+// one depends on the HeadUncachedPolicy.
+func (s *Server) headTask(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		if errortypes.IsDataNotFound(err) {
+			rw.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		return err
+	}
+
+	if task.CdnStatus == types.TaskInfoCdnStatusSUCCESS {
+		content, err := s.CDNMgr.OpenContent(ctx, id)
+		if err == nil {
+			defer content.Close()
+			return headContent(rw, task, content)
+		}
+		// the cached file may be evicted after the task succeeded.
+		if !errortypes.IsDataNotFound(err) {
+			return err
+		}
+	}
+
+	cacheStatus := cacheStatusMiss
+	if task.CdnStatus == types.TaskInfoCdnStatusRUNNING {
+		cacheStatus = cacheStatusRunning
+	}
+	rw.Header().Set(cacheStatusHeader, cacheStatus)
+	if s.Config.HeadUncachedPolicy != config.HeadUncachedOrigin {
+		rw.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	return s.headOrigin(rw, task)
+}
+
+// headContent responds the metadata of the content cached by supernode.
+func headContent(rw http.ResponseWriter, task *types.TaskInfo, content *mgr.Content) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set(cacheStatusHeader, cacheStatusHit)
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if digest := taskDigest(task); digest != "" {
+		rw.Header().Set("Digest", digest)
+	}
+	if content.LastModified > 0 {
+		rw.Header().Set("Last-Modified", time.Unix(content.LastModified/1000, 0).UTC().Format(http.TimeFormat))
+	}
+	if content.ETag != "" {
+		rw.Header().Set("Etag", content.ETag)
+	}
+	setCacheDirectives(rw, content)
+	rw.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// headOrigin responds the length of the file of the uncached task, which is got from
+// the source without downloading the file if it's unknown yet. And the status code
+// of the source is responded if the source fails.
+func (s *Server) headOrigin(rw http.ResponseWriter, task *types.TaskInfo) error {
+	length := task.HTTPFileLength
+	if length <= 0 {
+		var (
+			code int
+			err  error
+		)
+		length, code, err = s.OriginClient.GetContentLength(task.RawURL, task.Headers)
+		if err != nil {
+			return errors.Wrapf(errortypes.ErrURLNotReachable, "taskID: %s: %v", task.ID, err)
+		}
+		if code != http.StatusOK {
+			rw.WriteHeader(code)
+			return nil
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	if length >= 0 {
+		rw.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	rw.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// md5Digest returns the value of the Digest header defined in RFC 3230
+// for the md5 in hex, or "" if the md5 is invalid.
+func md5Digest(md5 string) string {
+	sum, err := hex.DecodeString(md5)
+	if err != nil || len(sum) != 16 {
+		return ""
+	}
+	return "md5=" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// digestNames maps the digest algorithms other than md5 to their names in the Digest header.
+var digestNames = map[string]string{
+	digest.AlgorithmSHA256: "sha-256",
+	digest.AlgorithmSHA512: "sha-512",
+}
+
+// taskDigest returns the value of the Digest header for the whole content of the task,
+// which carries the digest with the algorithm of the task following the md5,
+// or "" if neither is known.
+func taskDigest(task *types.TaskInfo) string {
+	digests := md5Digest(task.RealMd5)
+	name, ok := digestNames[task.DigestAlgorithm]
+	if !ok {
+		return digests
+	}
+	sum, err := hex.DecodeString(task.Digest)
+	if err != nil || len(sum) == 0 {
+		return digests
+	}
+	if digests != "" {
+		digests += ","
+	}
+	return digests + name + "=" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// serveFile serves the file with http.ServeContent which handles the range requests,
+// and the content will be sent with sendfile if the file is an *os.File.
+func serveFile(rw http.ResponseWriter, req *http.Request, name string, file store.File) {
+	// set the content type in advance to avoid sniffing the content
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(rw, req, name, time.Time{}, file)
+}
+
+// corruptionRecorder records the corruption of the pieces found while serving the file.
+type corruptionRecorder struct {
+	store.File
+
+	err error
+}
+
+// newCorruptionRecorder returns the file recording the corruption if the pieces are verified on read,
+// otherwise the file itself, which keeps the *os.File served with sendfile.
+func (s *Server) newCorruptionRecorder(file store.File) store.File {
+	if !s.Config.VerifyOnRead {
+		return file
+	}
+	return &corruptionRecorder{File: file}
+}
+
+func (r *corruptionRecorder) Read(p []byte) (int, error) {
+	n, err := r.File.Read(p)
+	if r.err == nil && errortypes.IsContentCorrupted(err) {
+		r.err = err
+	}
+	return n, err
+}
+
+// evictIfCorrupted evicts the task if the corruption is found while serving its file,
+// and the response has been cut short, so that the next registration downloads it from source again.
+func (s *Server) evictIfCorrupted(ctx context.Context, taskID string, file store.File) {
+	recorder, ok := file.(*corruptionRecorder)
+	if !ok || recorder.err == nil {
+		return
+	}
+	if err := s.TaskMgr.EvictCorrupted(ctx, taskID, recorder.err); err != nil {
+		logrus.Errorf("failed to evict the corrupted taskID(%s): %v", taskID, err)
+	}
+}
@@ -0,0 +1,302 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/digest"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+	cMock "github.com/dragonflyoss/Dragonfly/supernode/httpclient/mock"
+	"github.com/dragonflyoss/Dragonfly/supernode/store"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+)
+
+func init() {
+	check.Suite(&DownloadTestSuite{})
+}
+
+// copyOnlyDriver hides the FileDriver implementation of the underlying driver
+// to serve the content with the copy path.
+type copyOnlyDriver struct {
+	store.StorageDriver
+}
+
+type DownloadTestSuite struct {
+	workHome   string
+	localStore *store.Store
+	copyStore  *store.Store
+	raw        *store.Raw
+	content    []byte
+}
+
+func (s *DownloadTestSuite) SetUpSuite(c *check.C) {
+	s.workHome, _ = ioutil.TempDir("/tmp", "supernode-server-DownloadTestSuite-")
+	var err error
+	s.localStore, err = store.NewStore(store.LocalStorageDriver, store.NewLocalStorage, "baseDir: "+s.workHome)
+	c.Assert(err, check.IsNil)
+	s.copyStore, err = store.NewStore("copy", func(conf string) (store.StorageDriver, error) {
+		driver, err := store.NewLocalStorage(conf)
+		return &copyOnlyDriver{driver}, err
+	}, "baseDir: "+s.workHome)
+	c.Assert(err, check.IsNil)
+
+	s.content = make([]byte, 8*1024*1024)
+	for i := range s.content {
+		s.content[i] = byte(i % 251)
+	}
+	s.raw = &store.Raw{Bucket: config.DownloadHome, Key: "foo/fooTask"}
+	c.Assert(s.localStore.PutBytes(context.TODO(), s.raw, s.content), check.IsNil)
+}
+
+func (s *DownloadTestSuite) TearDownSuite(c *check.C) {
+	if s.workHome != "" {
+		os.RemoveAll(s.workHome)
+	}
+}
+
+func (s *DownloadTestSuite) TestServeDownload(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	router := initRoute(&Server{Config: config.NewConfig(), CDNMgr: mockCDNMgr})
+
+	for _, st := range []*store.Store{s.localStore, s.copyStore} {
+		file, err := st.Open(context.TODO(), s.raw)
+		c.Assert(err, check.IsNil)
+		mockCDNMgr.EXPECT().OpenFile(gomock.Any(), "fooTask").Return(file, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/download/foo/fooTask", nil)
+		req.Header.Set("Range", "bytes=1000-1999")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		c.Check(rr.Code, check.Equals, http.StatusPartialContent)
+		c.Check(rr.Header().Get("Content-Type"), check.Equals, "application/octet-stream")
+		c.Check(rr.Body.Bytes(), check.DeepEquals, s.content[1000:2000])
+	}
+
+	mockCDNMgr.EXPECT().OpenFile(gomock.Any(), "barTask").Return(nil, store.ErrKeyNotFound)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/download/bar/barTask", nil))
+	c.Check(rr.Code, check.Equals, http.StatusInternalServerError)
+}
+
+func (s *DownloadTestSuite) TestHeadTask(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockOriginClient := cMock.NewMockOriginHTTPClient(mockCtl)
+	cfg := config.NewConfig()
+	taskMgr := &fakeTaskMgr{tasks: map[string]*types.TaskInfo{
+		"cachedTask": {ID: "cachedTask", CdnStatus: types.TaskInfoCdnStatusSUCCESS,
+			RealMd5: "5d41402abc4b2a76b9719d911017c592"},
+		"runningTask": {ID: "runningTask", CdnStatus: types.TaskInfoCdnStatusRUNNING, HTTPFileLength: 1000},
+		"waitingTask": {ID: "waitingTask", CdnStatus: types.TaskInfoCdnStatusWAITING,
+			RawURL: "http://aa.bb.com/waiting", HTTPFileLength: -1},
+	}}
+	router := initRoute(&Server{Config: cfg, TaskMgr: taskMgr, CDNMgr: mockCDNMgr, OriginClient: mockOriginClient})
+	head := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, path, nil))
+		return rr
+	}
+
+	// the metadata of the cached task is responded without the body
+	for _, path := range []string{"/tasks/cachedTask", "/tasks/cachedTask/content"} {
+		file, err := s.localStore.Open(context.TODO(), s.raw)
+		c.Assert(err, check.IsNil)
+		mockCDNMgr.EXPECT().OpenContent(gomock.Any(), "cachedTask").Return(&mgr.Content{
+			File:         file,
+			LastModified: 1560000000000,
+			ETag:         "fooETag",
+		}, nil)
+		rr := head(path)
+		c.Check(rr.Code, check.Equals, http.StatusOK)
+		c.Check(rr.Header().Get(cacheStatusHeader), check.Equals, cacheStatusHit)
+		c.Check(rr.Header().Get("Content-Length"), check.Equals, "8388608")
+		c.Check(rr.Header().Get("Digest"), check.Equals, "md5=XUFAKrxLKna5cZ2REBfFkg==")
+		c.Check(rr.Header().Get("Last-Modified"), check.Equals, "Sat, 08 Jun 2019 13:20:00 GMT")
+		c.Check(rr.Header().Get("Etag"), check.Equals, "fooETag")
+		c.Check(rr.Body.Len(), check.Equals, 0)
+	}
+
+	// the uncached tasks are not found by default
+	rr := head("/tasks/runningTask")
+	c.Check(rr.Code, check.Equals, http.StatusNotFound)
+	c.Check(rr.Header().Get(cacheStatusHeader), check.Equals, cacheStatusRunning)
+	rr = head("/tasks/waitingTask/content")
+	c.Check(rr.Code, check.Equals, http.StatusNotFound)
+	c.Check(rr.Header().Get(cacheStatusHeader), check.Equals, cacheStatusMiss)
+	c.Check(head("/tasks/unknownTask").Code, check.Equals, http.StatusNotFound)
+
+	// the length of the uncached tasks is got from the source only if it's unknown
+	cfg.HeadUncachedPolicy = config.HeadUncachedOrigin
+	rr = head("/tasks/runningTask")
+	c.Check(rr.Code, check.Equals, http.StatusOK)
+	c.Check(rr.Header().Get(cacheStatusHeader), check.Equals, cacheStatusRunning)
+	c.Check(rr.Header().Get("Content-Length"), check.Equals, "1000")
+
+	mockOriginClient.EXPECT().GetContentLength("http://aa.bb.com/waiting", gomock.Any()).Return(int64(2000), 200, nil)
+	rr = head("/tasks/waitingTask")
+	c.Check(rr.Code, check.Equals, http.StatusOK)
+	c.Check(rr.Header().Get(cacheStatusHeader), check.Equals, cacheStatusMiss)
+	c.Check(rr.Header().Get("Content-Length"), check.Equals, "2000")
+
+	mockOriginClient.EXPECT().GetContentLength("http://aa.bb.com/waiting", gomock.Any()).Return(int64(0), 404, nil)
+	c.Check(head("/tasks/waitingTask").Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *DownloadTestSuite) BenchmarkServeFile(c *check.C) {
+	s.benchmarkServe(c, s.localStore)
+}
+
+func (s *DownloadTestSuite) BenchmarkServeCopy(c *check.C) {
+	s.benchmarkServe(c, s.copyStore)
+}
+
+// benchmarkServe serves the whole file over TCP where sendfile can be used.
+func (s *DownloadTestSuite) benchmarkServe(c *check.C, st *store.Store) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		file, err := st.Open(context.TODO(), s.raw)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+		serveFile(rw, req, "fooTask", file)
+	}))
+	defer server.Close()
+
+	c.SetBytes(int64(len(s.content)))
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		resp, err := http.Get(server.URL)
+		c.Assert(err, check.IsNil)
+		n, err := io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		c.Assert(err, check.IsNil)
+		c.Assert(n, check.Equals, int64(len(s.content)))
+	}
+}
+
+func (s *TaskBridgeTestSuite) TestPassCacheDirectivesThrough(c *check.C) {
+	content := strings.Repeat("dragonfly", 1000)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("Expires", "Thu, 01 Dec 2094 16:00:00 GMT")
+		http.ServeContent(w, r, "file", time.Unix(1500000000, 0), strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	taskID := registerTask(c, server.URL, origin.URL+"/file", "127.0.0.3-1-1")
+	task := waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+
+	// the cache directives of the source are recorded at download time
+	cached, err := srv.CDNMgr.OpenContent(context.Background(), taskID)
+	c.Assert(err, check.IsNil)
+	cached.Close()
+	c.Check(cached.CacheControl, check.Equals, "public, max-age=3600")
+	c.Check(cached.Expires, check.Equals, "Thu, 01 Dec 2094 16:00:00 GMT")
+
+	// and echoed on serve
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		req, err := http.NewRequest(method, server.URL+"/tasks/"+taskID+"/content", nil)
+		c.Assert(err, check.IsNil)
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, check.IsNil)
+		resp.Body.Close()
+		c.Check(resp.StatusCode, check.Equals, http.StatusOK)
+		c.Check(resp.Header.Get("Cache-Control"), check.Equals, "public, max-age=3600")
+		c.Check(resp.Header.Get("Expires"), check.Equals, "Thu, 01 Dec 2094 16:00:00 GMT")
+		c.Check(resp.Header.Get("Age"), check.Not(check.Equals), "")
+	}
+}
+
+func (s *TaskBridgeTestSuite) TestComputeDigestWithAlgorithm(c *check.C) {
+	content := strings.Repeat("dragonfly", 1000)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Unix(1500000000, 0), strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	register := func(url, cid, algorithm string) *types.TaskInfo {
+		taskID := registerTaskWithRequest(c, server.URL, &types.TaskRegisterRequest{
+			RawURL:          url,
+			TaskURL:         url,
+			CID:             cid,
+			IP:              "127.0.0.3",
+			HostName:        "dfget",
+			Port:            15001,
+			Path:            "/peer/file/" + cid,
+			DigestAlgorithm: algorithm,
+		})
+		task := waitTaskFinished(c, srv.TaskMgr, taskID)
+		c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+		return task
+	}
+	md5Sum := md5.Sum([]byte(content))
+	sha256Sum := sha256.Sum256([]byte(content))
+	sha512Sum := sha512.Sum512([]byte(content))
+
+	// the digest is computed with the default algorithm
+	task := register(origin.URL+"/md5", "127.0.0.3-1-1", "")
+	c.Check(task.DigestAlgorithm, check.Equals, digest.AlgorithmMD5)
+	c.Check(task.Digest, check.Equals, hex.EncodeToString(md5Sum[:]))
+
+	// or the algorithm specified by the task while downloading
+	task = register(origin.URL+"/sha256", "127.0.0.3-1-2", types.TaskRegisterRequestDigestAlgorithmSha256)
+	c.Check(task.DigestAlgorithm, check.Equals, digest.AlgorithmSHA256)
+	c.Check(task.Digest, check.Equals, hex.EncodeToString(sha256Sum[:]))
+	c.Check(task.RealMd5, check.Equals, hex.EncodeToString(md5Sum[:]))
+
+	// and it's recorded for the clients to verify the content
+	req, err := http.NewRequest(http.MethodHead, server.URL+"/tasks/"+task.ID+"/content", nil)
+	c.Assert(err, check.IsNil)
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.Header.Get("Digest"), check.Equals, "md5="+base64.StdEncoding.EncodeToString(md5Sum[:])+
+		",sha-256="+base64.StdEncoding.EncodeToString(sha256Sum[:]))
+
+	// the digest of the cached content is computed with the algorithm of the new task
+	c.Assert(srv.TaskMgr.Delete(context.Background(), task.ID), check.IsNil)
+	task = register(origin.URL+"/sha256", "127.0.0.3-1-3", types.TaskRegisterRequestDigestAlgorithmSha512)
+	c.Check(task.DigestAlgorithm, check.Equals, digest.AlgorithmSHA512)
+	c.Check(task.Digest, check.Equals, hex.EncodeToString(sha512Sum[:]))
+}
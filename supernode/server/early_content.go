@@ -0,0 +1,167 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// contentVerificationHeader tells that the content is served before it's verified as a whole,
+// and the client could verify the pieces with the piece manifest of the task meanwhile.
+const contentVerificationHeader = "X-Dragonfly-Content-Verification"
+
+const contentVerificationPending = "pending"
+
+// serveEarlyContent streams the content of the task being downloaded by supernode as the
+// pieces are committed, which is enabled by the first-byte ContentServingPolicy.
+// The response is cut short if the download fails, e.g. the task is poisoned since
+// the whole content fails the verification, so that the client doesn't take the content.
+// The Digest of the whole content is sent in the trailer if the EnableDigestTrailer is set.
+// And the notCached error is returned if the task isn't being downloaded or its length is unknown.
+func (s *Server) serveEarlyContent(ctx context.Context, rw http.ResponseWriter, req *http.Request, id string, notCached error) error {
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if task.CdnStatus != types.TaskInfoCdnStatusRUNNING || task.HTTPFileLength < 0 || task.PieceSize <= config.PieceWrapSize {
+		return notCached
+	}
+
+	// subscribe before getting the pieces to miss no changes
+	changes, cancel, err := s.ProgressMgr.WatchTask(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	length := task.HTTPFileLength
+	pieceContSize := int64(task.PieceSize - config.PieceWrapSize)
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	if s.Config.EnableDigestTrailer {
+		// the trailer is only sent with the chunked encoding in HTTP/1.1,
+		// which is not used if the Content-Length is declared.
+		rw.Header().Set("Trailer", "Digest")
+	} else {
+		rw.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	rw.Header().Set(contentVerificationHeader, contentVerificationPending)
+	rw.WriteHeader(http.StatusOK)
+	flusher, _ := rw.(http.Flusher)
+
+	var offset int64
+	for offset < length {
+		end, err := s.getCommittedEnd(ctx, id, offset, pieceContSize, length)
+		if err != nil {
+			logrus.Warnf("stop streaming the content of taskID %s at %d: %v", id, offset, err)
+			return nil
+		}
+		if end > offset {
+			n, err := s.copyContent(ctx, rw, id, offset, end)
+			offset += n
+			if err != nil {
+				logrus.Warnf("stop streaming the content of taskID %s at %d: %v", id, offset, err)
+				return nil
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			continue
+		}
+
+		select {
+		case <-changes:
+		case <-req.Context().Done():
+			return nil
+		}
+	}
+
+	if s.Config.EnableDigestTrailer {
+		s.setDigestTrailer(ctx, rw, id)
+	}
+	return nil
+}
+
+// setDigestTrailer sets the Digest of the whole content of the task which has been
+// verified and streamed, and it's sent as the trailer after the body.
+func (s *Server) setDigestTrailer(ctx context.Context, rw http.ResponseWriter, id string) {
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		logrus.Warnf("failed to get the digest of taskID %s for the trailer: %v", id, err)
+		return
+	}
+	if digest := taskDigest(task); digest != "" {
+		rw.Header().Set("Digest", digest)
+	}
+}
+
+// getCommittedEnd returns the end of the content committed consecutively from the offset,
+// and an error if the download of the task has failed.
+// The end never reaches the length until the download succeeds.
+func (s *Server) getCommittedEnd(ctx context.Context, id string, offset, pieceContSize, length int64) (int64, error) {
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	switch task.CdnStatus {
+	case types.TaskInfoCdnStatusSUCCESS:
+		return length, nil
+	case types.TaskInfoCdnStatusRUNNING:
+	default:
+		return 0, errors.Wrapf(errortypes.ErrCDNFail, "taskID: %s status: %s", id, task.CdnStatus)
+	}
+
+	pieceNum := offset / pieceContSize
+	available, err := s.ProgressMgr.GetSuperConsecutivePieces(ctx, id, int(pieceNum))
+	if err != nil && !errortypes.IsDataNotFound(err) {
+		return 0, err
+	}
+	end := (pieceNum + int64(available)) * pieceContSize
+	// hold back the last byte until the whole content is verified,
+	// so that the response is always cut short if the verification fails
+	if end >= length {
+		end = length - 1
+	}
+	if end < offset {
+		end = offset
+	}
+	return end, nil
+}
+
+// copyContent writes the content of the task in [start, end) which has been committed.
+func (s *Server) copyContent(ctx context.Context, w io.Writer, id string, start, end int64) (int64, error) {
+	content, err := s.CDNMgr.OpenPartialContent(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	defer content.Close()
+
+	n, err := io.Copy(w, io.NewSectionReader(content, start, end-start))
+	if err == nil && n < end-start {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
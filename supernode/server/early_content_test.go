@@ -0,0 +1,227 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+func (s *TaskBridgeTestSuite) TestServeEarlyContent(c *check.C) {
+	const pieceSize = 64 * 1024
+	const pieceContSize = pieceSize - config.PieceWrapSize
+	content := make([]byte, 4*pieceContSize-10)
+	rand.New(rand.NewSource(1)).Read(content)
+	origin := &stalledOrigin{content: content, firstPart: 2*pieceContSize + 100, release: make(chan struct{})}
+	originServer := httptest.NewServer(origin)
+	defer originServer.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	srv.Config.PieceSize = pieceSize
+	srv.Config.ContentServingPolicy = config.ContentServingFirstByte
+	code, taskID := registerTaskWithMd5(c, server.URL, originServer.URL+"/file", "127.0.0.3-1-1", "")
+	c.Assert(code, check.Equals, constants.Success)
+
+	resp, err := http.Get(server.URL + "/tasks/" + taskID + "/content")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(resp.Header.Get(contentVerificationHeader), check.Equals, contentVerificationPending)
+	c.Check(resp.Header.Get("Content-Length"), check.Equals, strconv.Itoa(len(content)))
+
+	// the pieces committed are served before the origin is released
+	first := make([]byte, 2*pieceContSize)
+	_, err = io.ReadFull(resp.Body, first)
+	c.Assert(err, check.IsNil)
+	c.Check(first, check.DeepEquals, content[:2*pieceContSize])
+
+	close(origin.release)
+	rest, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.DeepEquals, content[2*pieceContSize:])
+
+	task := waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+}
+
+func (s *TaskBridgeTestSuite) TestServeEarlyContentWithDigestTrailer(c *check.C) {
+	const pieceSize = 64 * 1024
+	const pieceContSize = pieceSize - config.PieceWrapSize
+	content := make([]byte, 3*pieceContSize+10)
+	rand.New(rand.NewSource(1)).Read(content)
+	origin := &stalledOrigin{content: content, firstPart: pieceContSize + 100, release: make(chan struct{})}
+	originServer := httptest.NewServer(origin)
+	defer originServer.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	srv.Config.PieceSize = pieceSize
+	srv.Config.ContentServingPolicy = config.ContentServingFirstByte
+	srv.Config.EnableDigestTrailer = true
+	code, taskID := registerTaskWithMd5(c, server.URL, originServer.URL+"/file", "127.0.0.3-1-1", "")
+	c.Assert(code, check.Equals, constants.Success)
+
+	resp, err := http.Get(server.URL + "/tasks/" + taskID + "/content")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(resp.Header.Get("Content-Length"), check.Equals, "")
+	_, declared := resp.Trailer["Digest"]
+	c.Check(declared, check.Equals, true)
+
+	// the client starts reading before the digest is known
+	first := make([]byte, pieceContSize)
+	_, err = io.ReadFull(resp.Body, first)
+	c.Assert(err, check.IsNil)
+	c.Check(resp.Trailer.Get("Digest"), check.Equals, "")
+
+	// and receives the digest of the whole content after the body
+	close(origin.release)
+	rest, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(append(first, rest...), check.DeepEquals, content)
+	sum := md5.Sum(content)
+	c.Check(resp.Trailer.Get("Digest"), check.Equals, md5Digest(hex.EncodeToString(sum[:])))
+}
+
+func (s *TaskBridgeTestSuite) TestPoisonTaskFailingVerification(c *check.C) {
+	const pieceSize = 64 * 1024
+	const pieceContSize = pieceSize - config.PieceWrapSize
+	content := make([]byte, 4*pieceContSize-10)
+	rand.New(rand.NewSource(1)).Read(content)
+	origin := &stalledOrigin{content: content, firstPart: 2*pieceContSize + 100, release: make(chan struct{})}
+	originServer := httptest.NewServer(origin)
+	defer originServer.Close()
+	url := originServer.URL + "/file"
+	wrongMd5 := "00000000000000000000000000000000"
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	srv.Config.PieceSize = pieceSize
+	srv.Config.ContentServingPolicy = config.ContentServingFirstByte
+	code, taskID := registerTaskWithMd5(c, server.URL, url, "127.0.0.3-1-1", wrongMd5)
+	c.Assert(code, check.Equals, constants.Success)
+
+	resp, err := http.Get(server.URL + "/tasks/" + taskID + "/content")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(resp.Header.Get(contentVerificationHeader), check.Equals, contentVerificationPending)
+
+	// the response is cut short since the whole content fails the verification
+	close(origin.release)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Check(err, check.NotNil)
+	c.Check(len(body) < len(content), check.Equals, true)
+	c.Check(body, check.DeepEquals, content[:len(body)])
+
+	task := waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusFAILED)
+
+	// the client registered is told to discard the pieces downloaded
+	_, _, err = srv.TaskMgr.GetPieces(context.Background(), taskID, "127.0.0.3-1-1", &types.PiecePullRequest{
+		DfgetTaskStatus: types.PiecePullRequestDfgetTaskStatusRUNNING,
+	})
+	c.Check(errortypes.IsTaskPoisoned(err), check.Equals, true)
+
+	// the registrations are refused until the task is purged
+	code, _ = registerTaskWithMd5(c, server.URL, url, "127.0.0.3-1-2", wrongMd5)
+	c.Check(code, check.Equals, constants.CodeTaskPoisoned)
+
+	purged, err := srv.TaskMgr.Purge(context.Background(), url, "", "")
+	c.Assert(err, check.IsNil)
+	c.Check(purged, check.DeepEquals, []string{taskID})
+	code, _ = registerTaskWithMd5(c, server.URL, url, "127.0.0.3-1-3", "")
+	c.Check(code, check.Equals, constants.Success)
+}
+
+func (s *TaskBridgeTestSuite) TestNotPoisonTaskWithVerifiedPolicy(c *check.C) {
+	content := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(content)
+	origin := &stalledOrigin{content: content, firstPart: len(content), release: make(chan struct{})}
+	close(origin.release)
+	originServer := httptest.NewServer(origin)
+	defer originServer.Close()
+	url := originServer.URL + "/file"
+	wrongMd5 := "00000000000000000000000000000000"
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	code, taskID := registerTaskWithMd5(c, server.URL, url, "127.0.0.3-1-1", wrongMd5)
+	c.Assert(code, check.Equals, constants.Success)
+	task := waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusFAILED)
+
+	// no content has been served, so the failed task is simply retried
+	_, _, err := srv.TaskMgr.GetPieces(context.Background(), taskID, "127.0.0.3-1-1", &types.PiecePullRequest{
+		DfgetTaskStatus: types.PiecePullRequestDfgetTaskStatusRUNNING,
+	})
+	c.Check(errortypes.IsTaskPoisoned(err), check.Equals, false)
+	code, _ = registerTaskWithMd5(c, server.URL, url, "127.0.0.3-1-2", wrongMd5)
+	c.Check(code, check.Not(check.Equals), constants.CodeTaskPoisoned)
+}
+
+// registerTaskWithMd5 registers the task with the expected md5 and returns the result code,
+// which is carried by the message of the error response if the registration fails.
+func registerTaskWithMd5(c *check.C, serverURL, url, cid, md5 string) (int, string) {
+	body, err := json.Marshal(&types.TaskRegisterRequest{
+		RawURL:   url,
+		TaskURL:  url,
+		Md5:      md5,
+		CID:      cid,
+		IP:       "127.0.0.3",
+		HostName: "dfget",
+		Port:     15001,
+		Path:     "/peer/file/" + cid,
+	})
+	c.Assert(err, check.IsNil)
+	resp, err := http.Post(serverURL+"/peer/registry", "application/json", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		errResp := &types.Error{}
+		c.Assert(json.NewDecoder(resp.Body).Decode(errResp), check.IsNil)
+		var code int
+		_, err := fmt.Sscanf(errResp.Message, `{"Code":%d`, &code)
+		c.Assert(err, check.IsNil)
+		return code, ""
+	}
+	result := &struct {
+		Code int                   `json:"code"`
+		Data *RegisterResponseData `json:"data"`
+	}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(result), check.IsNil)
+	return result.Code, result.Data.TaskID
+}
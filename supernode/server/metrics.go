@@ -32,6 +32,11 @@ type metrics struct {
 	requestDuration *prometheus.HistogramVec
 	requestSize     *prometheus.HistogramVec
 	responseSize    *prometheus.HistogramVec
+
+	connections         *prometheus.GaugeVec
+	rejectedConnections *prometheus.CounterVec
+
+	passthroughRegistrations *prometheus.CounterVec
 }
 
 func newMetrics(register prometheus.Registerer) *metrics {
@@ -51,6 +56,16 @@ func newMetrics(register prometheus.Registerer) *metrics {
 			"Histogram of response size for HTTP requests.", []string{"handler"},
 			prometheus.ExponentialBuckets(100, 10, 8), register,
 		),
+		connections: metricsutils.NewGauge(config.SubsystemSupernode, "connections",
+			"Current number of client connections being served.", []string{}, register,
+		),
+		rejectedConnections: metricsutils.NewCounter(config.SubsystemSupernode, "connections_rejected_total",
+			"Total number of client connections rejected beyond the max concurrent connections.", []string{}, register,
+		),
+		passthroughRegistrations: metricsutils.NewCounter(config.SubsystemSupernode, "registrations_passthrough_total",
+			"Total number of registrations told to download from the sources directly since supernode is overloaded.",
+			[]string{"reason"}, register,
+		),
 	}
 }
 
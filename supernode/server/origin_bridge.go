@@ -0,0 +1,71 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+)
+
+func (s *Server) getOriginConcurrency(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return EncodeResponse(rw, http.StatusOK, s.originConcurrency(ctx))
+}
+
+func (s *Server) setOriginConcurrency(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	request := &types.OriginConcurrency{}
+	if err := decodeRequestBody(req, request); err != nil {
+		return err
+	}
+	if err := request.Validate(strfmt.NewFormats()); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+
+	s.CDNMgr.SetOriginConcurrency(ctx, int(*request.Limit))
+	return EncodeResponse(rw, http.StatusOK, s.originConcurrency(ctx))
+}
+
+func (s *Server) probeOrigin(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	request := &types.OriginProbeRequest{}
+	if err := decodeRequestBody(req, request); err != nil {
+		return err
+	}
+	if err := request.Validate(strfmt.NewFormats()); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+
+	result, err := s.TaskMgr.ProbeOrigin(ctx, request)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, result)
+}
+
+func (s *Server) originConcurrency(ctx context.Context) *types.OriginConcurrency {
+	limit, inFlight := s.CDNMgr.GetOriginConcurrency(ctx)
+	result := &types.OriginConcurrency{
+		InFlight: int64(inFlight),
+		Limit:    new(int64),
+	}
+	*result.Limit = int64(limit)
+	return result
+}
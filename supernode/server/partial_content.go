@@ -0,0 +1,139 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// partialContentRetryAfter is the Retry-After in seconds responded to the range requests
+// on the content of a task being downloaded whose ranges are unavailable yet.
+const partialContentRetryAfter = "1"
+
+// servePartialContent serves a range of the content of the task being downloaded by supernode.
+// The pieces are downloaded in parallel, so the bytes available from the start of the range
+// are responded with 206 Partial Content and the Content-Range telling where they end.
+// If the start of the range is unavailable after the PartialContentWait, 503 Service Unavailable
+// is responded with Retry-After. And the notCached error is returned if the task isn't being
+// downloaded, its length is unknown or the Range isn't a single range.
+func (s *Server) servePartialContent(ctx context.Context, rw http.ResponseWriter, req *http.Request, id string, notCached error) error {
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if task.CdnStatus != types.TaskInfoCdnStatusRUNNING || task.HTTPFileLength < 0 || task.PieceSize <= config.PieceWrapSize {
+		return notCached
+	}
+
+	length := task.HTTPFileLength
+	ranges, err := httputils.GetRangeSE(req.Header.Get("Range"), length)
+	if err != nil && !errortypes.IsRangeNotSatisfiable(err) || len(ranges) > 1 {
+		return notCached
+	}
+	if err != nil || ranges[0].StartIndex >= length {
+		rw.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", length))
+		rw.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+	start, end := ranges[0].StartIndex, ranges[0].EndIndex
+	if end >= length {
+		end = length - 1
+	}
+
+	pieceContSize := int64(task.PieceSize - config.PieceWrapSize)
+	startPieceNum := start / pieceContSize
+	available, err := s.waitSuperPieces(ctx, req, id, int(startPieceNum))
+	if err != nil {
+		return err
+	}
+	if available == 0 {
+		rw.Header().Set("Retry-After", partialContentRetryAfter)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return nil
+	}
+	if availableEnd := (startPieceNum+int64(available))*pieceContSize - 1; availableEnd < end {
+		end = availableEnd
+	}
+
+	content, err := s.CDNMgr.OpenPartialContent(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, length))
+	rw.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	if content.ETag != "" {
+		rw.Header().Set("Etag", content.ETag)
+	}
+	rw.WriteHeader(http.StatusPartialContent)
+	if _, err := io.Copy(rw, io.NewSectionReader(content, start, end-start+1)); err != nil {
+		logrus.Errorf("failed to serve the range %d-%d of taskID %s being downloaded: %v", start, end, id, err)
+	}
+	return nil
+}
+
+// waitSuperPieces returns the count of the consecutive pieces from pieceNum which have been
+// downloaded by supernode, and waits up to the PartialContentWait for the piece if it's unavailable.
+func (s *Server) waitSuperPieces(ctx context.Context, req *http.Request, id string, pieceNum int) (int, error) {
+	var changes <-chan struct{}
+	if s.Config.PartialContentWait > 0 {
+		// subscribe before getting the pieces to miss no changes,
+		// and don't wait if the subscribers reach the limits.
+		ch, cancel, err := s.ProgressMgr.WatchTask(ctx, id)
+		if err != nil && !errortypes.IsTooManySubscribers(err) {
+			return 0, err
+		}
+		if err == nil {
+			defer cancel()
+			changes = ch
+		}
+	}
+
+	timer := time.NewTimer(s.Config.PartialContentWait)
+	defer timer.Stop()
+	for {
+		available, err := s.ProgressMgr.GetSuperConsecutivePieces(ctx, id, pieceNum)
+		if err != nil && !errortypes.IsDataNotFound(err) {
+			return 0, err
+		}
+		if available > 0 || changes == nil {
+			return available, nil
+		}
+
+		select {
+		case <-changes:
+		case <-timer.C:
+			return 0, nil
+		case <-req.Context().Done():
+			return 0, nil
+		}
+	}
+}
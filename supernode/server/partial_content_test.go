@@ -0,0 +1,124 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+// stalledOrigin serves the first part of the content and then stalls until it's released.
+type stalledOrigin struct {
+	content   []byte
+	firstPart int
+	release   chan struct{}
+}
+
+func (so *stalledOrigin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(so.content)))
+	w.Write(so.content[:so.firstPart])
+	w.(http.Flusher).Flush()
+	select {
+	case <-so.release:
+	case <-r.Context().Done():
+		return
+	}
+	w.Write(so.content[so.firstPart:])
+}
+
+func (s *TaskBridgeTestSuite) TestServePartialContent(c *check.C) {
+	const pieceSize = 64 * 1024
+	const pieceContSize = pieceSize - config.PieceWrapSize
+	content := make([]byte, 4*pieceContSize-10)
+	rand.New(rand.NewSource(1)).Read(content)
+	origin := &stalledOrigin{content: content, firstPart: 2*pieceContSize + 100, release: make(chan struct{})}
+	originServer := httptest.NewServer(origin)
+	defer originServer.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	srv.Config.PieceSize = pieceSize
+	taskID := registerTask(c, server.URL, originServer.URL+"/file", "127.0.0.3-1-1")
+
+	// wait for the pieces served before the origin stalls
+	for i := 0; i < 500; i++ {
+		if count, _ := srv.ProgressMgr.GetSuperPieceCount(context.Background(), taskID); count >= 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	task, err := srv.TaskMgr.Get(context.Background(), taskID)
+	c.Assert(err, check.IsNil)
+	c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusRUNNING)
+	total := len(content)
+
+	// the range available entirely
+	code, header, body := getRange(c, server.URL, taskID, "bytes=10-1000")
+	c.Check(code, check.Equals, http.StatusPartialContent)
+	c.Check(header.Get("Content-Range"), check.Equals, fmt.Sprintf("bytes 10-1000/%d", total))
+	c.Check(body, check.DeepEquals, content[10:1001])
+
+	// the range available partially
+	start := 2*pieceContSize - 100
+	code, header, body = getRange(c, server.URL, taskID, fmt.Sprintf("bytes=%d-%d", start, 3*pieceContSize))
+	c.Check(code, check.Equals, http.StatusPartialContent)
+	c.Check(header.Get("Content-Range"), check.Equals, fmt.Sprintf("bytes %d-%d/%d", start, 2*pieceContSize-1, total))
+	c.Check(body, check.DeepEquals, content[start:2*pieceContSize])
+
+	// the range unavailable yet
+	code, header, _ = getRange(c, server.URL, taskID, fmt.Sprintf("bytes=%d-", 3*pieceContSize))
+	c.Check(code, check.Equals, http.StatusServiceUnavailable)
+	c.Check(header.Get("Retry-After"), check.Equals, partialContentRetryAfter)
+
+	// the range not satisfiable
+	code, header, _ = getRange(c, server.URL, taskID, fmt.Sprintf("bytes=%d-", total))
+	c.Check(code, check.Equals, http.StatusRequestedRangeNotSatisfiable)
+	c.Check(header.Get("Content-Range"), check.Equals, fmt.Sprintf("bytes */%d", total))
+
+	// the range becoming available while waiting
+	srv.Config.PartialContentWait = 5 * time.Second
+	time.AfterFunc(100*time.Millisecond, func() { close(origin.release) })
+	code, _, body = getRange(c, server.URL, taskID, fmt.Sprintf("bytes=%d-", 3*pieceContSize))
+	c.Check(code, check.Equals, http.StatusPartialContent)
+	c.Check(body, check.DeepEquals, content[3*pieceContSize:])
+
+	task = waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+}
+
+func getRange(c *check.C, serverURL, taskID, rangeHeader string) (int, http.Header, []byte) {
+	req, err := http.NewRequest(http.MethodGet, serverURL+"/tasks/"+taskID+"/content", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Range", rangeHeader)
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	return resp.StatusCode, resp.Header, body
+}
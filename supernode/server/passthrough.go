@@ -0,0 +1,81 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/netutils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The reasons why supernode is overloaded.
+const (
+	overloadConnections = "connections"
+	overloadQueueDepth  = "queueDepth"
+)
+
+// trackConnState counts the client connections being served.
+func (s *Server) trackConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt32(&s.connections, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt32(&s.connections, -1)
+	}
+}
+
+// overloadReason returns why supernode is overloaded by the PassthroughConnections
+// and PassthroughQueueDepth, or "" if it's not overloaded.
+func (s *Server) overloadReason(ctx context.Context) string {
+	if s.Config == nil || s.Config.BaseProperties == nil {
+		return ""
+	}
+
+	if limit := s.Config.PassthroughConnections; limit > 0 && int(atomic.LoadInt32(&s.connections)) >= limit {
+		return overloadConnections
+	}
+	if limit := s.Config.PassthroughQueueDepth; limit > 0 && s.CDNMgr.GetOriginQueueDepth(ctx) >= limit {
+		return overloadQueueDepth
+	}
+	return ""
+}
+
+// passthrough tells the client registering to download the file from the source directly
+// with the url and the headers which supernode would download it with.
+func (s *Server) passthrough(rw http.ResponseWriter, request *types.TaskRegisterRequest, reason string) error {
+	logrus.Infof("tell the client %s to download %s from the source directly since the %s reach the limit",
+		request.CID, request.RawURL, reason)
+	m.passthroughRegistrations.WithLabelValues(reason).Inc()
+
+	return EncodeResponse(rw, http.StatusOK, &types.ResultInfo{
+		Code: constants.CodeSourcePassthrough,
+		Msg:  constants.GetMsgByCode(constants.CodeSourcePassthrough),
+		Data: &RegisterResponseData{
+			Passthrough: &PassthroughData{
+				URL:     request.RawURL,
+				Headers: netutils.ConvertHeaders(request.Headers),
+			},
+		},
+	})
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+)
+
+// registerWithPassthrough registers the client allowing the passthrough and returns the result.
+func registerWithPassthrough(c *check.C, serverURL, url, cid string, allowPassthrough bool) (int, *RegisterResponseData) {
+	body, err := json.Marshal(&types.TaskRegisterRequest{
+		RawURL:           url,
+		TaskURL:          url,
+		CID:              cid,
+		IP:               "127.0.0.3",
+		HostName:         "dfget",
+		Port:             15001,
+		Path:             "/peer/file/" + cid,
+		Headers:          []string{"Authorization:Bearer foo"},
+		AllowPassthrough: allowPassthrough,
+	})
+	c.Assert(err, check.IsNil)
+	resp, err := http.Post(serverURL+"/peer/registry", "application/json", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	result := &struct {
+		Code int                   `json:"code"`
+		Data *RegisterResponseData `json:"data"`
+	}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(result), check.IsNil)
+	return result.Code, result.Data
+}
+
+func (s *TaskBridgeTestSuite) TestPassthroughAboveConnections(c *check.C) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Unix(1500000000, 0), strings.NewReader("dragonfly"))
+	}))
+	defer origin.Close()
+
+	// serve the supernode with the connections tracked
+	srv, unused := s.newSupernode(c, "127.0.0.1")
+	unused.Close()
+	srv.Config.PassthroughConnections = 2
+	server := httptest.NewUnstartedServer(initRoute(srv))
+	server.Config.ConnState = srv.trackConnState
+	server.Start()
+	defer server.Close()
+	url := origin.URL + "/file"
+
+	// the connection of the registration itself is below the threshold
+	code, data := registerWithPassthrough(c, server.URL, url, "127.0.0.3-1-1", true)
+	c.Assert(code, check.Equals, constants.Success)
+	c.Check(data.TaskID, check.Not(check.Equals), "")
+	c.Check(data.Passthrough, check.IsNil)
+
+	// another connection makes the supernode overloaded
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	for i := 0; i < 100 && atomic.LoadInt32(&srv.connections) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	code, data = registerWithPassthrough(c, server.URL, url, "127.0.0.3-1-2", true)
+	c.Assert(code, check.Equals, constants.CodeSourcePassthrough)
+	c.Check(data.TaskID, check.Equals, "")
+	c.Assert(data.Passthrough, check.NotNil)
+	c.Check(data.Passthrough.URL, check.Equals, url)
+	c.Check(data.Passthrough.Headers, check.DeepEquals, map[string]string{"Authorization": "Bearer foo"})
+
+	// while the clients unable to download from the source are still served
+	code, data = registerWithPassthrough(c, server.URL, url, "127.0.0.3-1-3", false)
+	c.Assert(code, check.Equals, constants.Success)
+	c.Check(data.Passthrough, check.IsNil)
+}
+
+func (s *TaskBridgeTestSuite) TestPassthroughAboveQueueDepth(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	cfg := config.NewConfig()
+	srv := &Server{Config: cfg, CDNMgr: mockCDNMgr}
+	ctx := context.Background()
+
+	// it's disabled by default
+	c.Check(srv.overloadReason(ctx), check.Equals, "")
+
+	cfg.PassthroughQueueDepth = 3
+	mockCDNMgr.EXPECT().GetOriginQueueDepth(gomock.Any()).Return(2)
+	c.Check(srv.overloadReason(ctx), check.Equals, "")
+	mockCDNMgr.EXPECT().GetOriginQueueDepth(gomock.Any()).Return(3)
+	c.Check(srv.overloadReason(ctx), check.Equals, overloadQueueDepth)
+}
@@ -18,11 +18,15 @@ package server
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
 	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
 	dutil "github.com/dragonflyoss/Dragonfly/supernode/daemon/util"
 
 	"github.com/go-openapi/strfmt"
@@ -31,10 +35,9 @@ import (
 )
 
 func (s *Server) registerPeer(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
-	reader := req.Body
 	request := &types.PeerCreateRequest{}
-	if err := json.NewDecoder(reader).Decode(request); err != nil {
-		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	if err := decodeRequestBody(req, request); err != nil {
+		return err
 	}
 
 	if err := request.Validate(strfmt.NewFormats()); err != nil {
@@ -68,19 +71,132 @@ func (s *Server) getPeer(ctx context.Context, rw http.ResponseWriter, req *http.
 		return err
 	}
 
-	return EncodeResponse(rw, http.StatusOK, peer)
+	return EncodeResponse(rw, http.StatusOK, s.withPeerState(ctx, peer))
+}
+
+// getPeerSources gets the pieces of the tasks that the peer currently sources to the other peers.
+func (s *Server) getPeerSources(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+
+	if _, err := s.PeerMgr.Get(ctx, id); err != nil {
+		return err
+	}
+	sources, err := s.ProgressMgr.GetPeerSources(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	result := make([]*types.PeerSource, 0, len(sources))
+	for _, source := range sources {
+		result = append(result, &types.PeerSource{
+			TaskID:             source.TaskID,
+			PieceNums:          toInt32Slice(source.PieceNums),
+			UploadingPieceNums: toInt32Slice(source.UploadingPieceNums),
+		})
+	}
+	return EncodeResponse(rw, http.StatusOK, result)
 }
 
-// TODO: parse filter
+// listPeers lists the peers which can be filtered by the role and whether they're blacklisted.
+// The peers are filtered before paging, so the page never misses the peers matched.
 func (s *Server) listPeers(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
 	filter, err := dutil.ParseFilter(req, nil)
 	if err != nil {
 		return err
 	}
-	peerList, err := s.PeerMgr.List(ctx, filter)
+	params := req.URL.Query()
+	role := params.Get("role")
+	if role != "" && role != types.PeerInfoRoleSeed && role != types.PeerInfoRoleNormal {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "unexpected role %s", role)
+	}
+	var blacklisted *bool
+	if v := params.Get("blacklisted"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "blacklisted %s is not a bool: %v", v, err)
+		}
+		blacklisted = &b
+	}
+
+	peerList, err := s.PeerMgr.List(ctx, &dutil.PageFilter{SortDirect: filter.SortDirect})
 	if err != nil {
 		return err
 	}
 
-	return EncodeResponse(rw, http.StatusOK, peerList)
+	result := make([]*types.PeerInfo, 0, len(peerList))
+	for _, peer := range peerList {
+		peerInfo := s.withPeerState(ctx, peer)
+		if role != "" && peerInfo.Role != role {
+			continue
+		}
+		if blacklisted != nil && peerInfo.Blacklisted != *blacklisted {
+			continue
+		}
+		result = append(result, peerInfo)
+	}
+	return EncodeResponse(rw, http.StatusOK, pagePeers(result, filter.PageNum, filter.PageSize))
+}
+
+// withPeerState returns a copy of the peer with its role and the state of its service,
+// such as the load, the bytes it served and consumed.
+func (s *Server) withPeerState(ctx context.Context, peer *types.PeerInfo) *types.PeerInfo {
+	result := *peer
+	result.Role = types.PeerInfoRoleNormal
+	if s.Config != nil && s.Config.IsSuperPID(peer.ID) {
+		result.Role = types.PeerInfoRoleSeed
+	}
+
+	peerState, err := s.ProgressMgr.GetPeerStateByPeerID(ctx, peer.ID)
+	if err != nil {
+		return &result
+	}
+
+	if peerState.ServedBytes != nil {
+		result.ServedBytes = atomic.LoadInt64(peerState.ServedBytes)
+	}
+	if peerState.ConsumedBytes != nil {
+		result.ConsumedBytes = atomic.LoadInt64(peerState.ConsumedBytes)
+	}
+	if peerState.LastSeen != nil {
+		result.LastSeen = strfmt.DateTime(time.Unix(0, atomic.LoadInt64(peerState.LastSeen)))
+	}
+	if peerState.ProducerLoad != nil {
+		result.Load = peerState.ProducerLoad.Get()
+	}
+	result.Blacklisted = isPeerBlacklisted(peerState)
+	return &result
+}
+
+// isPeerBlacklisted returns whether the peer is excluded from serving the other peers by the scheduler,
+// since its service is down or has failed for EliminationLimit times.
+func isPeerBlacklisted(peerState *mgr.PeerState) bool {
+	if peerState.ServiceDownTime != nil && atomic.LoadInt64(peerState.ServiceDownTime) > 0 {
+		return true
+	}
+	return peerState.ServiceErrorCount != nil && peerState.ServiceErrorCount.Get() >= config.EliminationLimit
+}
+
+// pagePeers returns the page of the peers, and all of them if the pageSize is 0.
+func pagePeers(peers []*types.PeerInfo, pageNum, pageSize int) []*types.PeerInfo {
+	if pageSize == 0 {
+		return peers
+	}
+
+	start := pageNum * pageSize
+	if start >= len(peers) {
+		return []*types.PeerInfo{}
+	}
+	end := start + pageSize
+	if end > len(peers) {
+		end = len(peers)
+	}
+	return peers[start:end]
+}
+
+func toInt32Slice(values []int) []int32 {
+	result := make([]int32, 0, len(values))
+	for _, v := range values {
+		result = append(result, int32(v))
+	}
+	return result
 }
@@ -0,0 +1,165 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/atomiccount"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/peer"
+
+	"github.com/go-check/check"
+	"github.com/go-openapi/strfmt"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestPeerState(peerID string, load int32, serviceDownTime int64, lastSeen time.Time) *mgr.PeerState {
+	seen := lastSeen.UnixNano()
+	return &mgr.PeerState{
+		PeerID:            peerID,
+		ProducerLoad:      atomiccount.NewAtomicInt(load),
+		ServiceErrorCount: atomiccount.NewAtomicInt(0),
+		ServiceDownTime:   &serviceDownTime,
+		LastSeen:          &seen,
+	}
+}
+
+func (rs *RouterTestSuite) TestListPeers(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	peerMgr, _ := peer.NewManager(prometheus.NewRegistry())
+
+	ctx := context.Background()
+	var ids []string
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		resp, err := peerMgr.Register(ctx, &types.PeerCreateRequest{
+			IP:       strfmt.IPv4(ip),
+			HostName: strfmt.Hostname("host"),
+			Port:     15001,
+		})
+		c.Assert(err, check.IsNil)
+		ids = append(ids, resp.ID)
+		time.Sleep(time.Millisecond)
+	}
+	cfg := config.NewConfig()
+	cfg.SetSuperPID(ids[0])
+
+	lastSeen := time.Unix(1500000000, 0)
+	mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), ids[0]).
+		Return(newTestPeerState(ids[0], 3, 0, lastSeen), nil).AnyTimes()
+	mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), ids[1]).
+		Return(newTestPeerState(ids[1], 1, 0, lastSeen), nil).AnyTimes()
+	mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), ids[2]).
+		Return(newTestPeerState(ids[2], 0, lastSeen.Unix(), lastSeen), nil).AnyTimes()
+	mockProgressMgr.EXPECT().GetPeerStateByPeerID(gomock.Any(), ids[3]).
+		Return(nil, errortypes.ErrDataNotFound).AnyTimes()
+
+	server := httptest.NewServer(initRoute(&Server{Config: cfg, PeerMgr: peerMgr, ProgressMgr: mockProgressMgr}))
+	defer server.Close()
+
+	listPeers := func(query string) []*types.PeerInfo {
+		code, body, err := httputils.Get(server.URL+"/peers?"+query, 0)
+		c.Assert(err, check.IsNil)
+		c.Assert(code, check.Equals, http.StatusOK, check.Commentf(query))
+		var peers []*types.PeerInfo
+		c.Assert(json.Unmarshal(body, &peers), check.IsNil)
+		return peers
+	}
+	peerIDs := func(peers []*types.PeerInfo) []string {
+		result := make([]string, 0, len(peers))
+		for _, p := range peers {
+			result = append(result, p.ID)
+		}
+		return result
+	}
+
+	// all the peers in the order of their registration with their states
+	peers := listPeers("")
+	c.Assert(peerIDs(peers), check.DeepEquals, ids)
+	c.Check(peers[0].Role, check.Equals, types.PeerInfoRoleSeed)
+	c.Check(peers[0].Load, check.Equals, int32(3))
+	c.Check(time.Time(peers[0].LastSeen).Equal(lastSeen), check.Equals, true)
+	c.Check(peers[1].Role, check.Equals, types.PeerInfoRoleNormal)
+	c.Check(peers[1].Blacklisted, check.Equals, false)
+	c.Check(peers[2].Blacklisted, check.Equals, true)
+	c.Check(peers[3].Role, check.Equals, types.PeerInfoRoleNormal)
+	c.Check(time.Time(peers[3].LastSeen).IsZero(), check.Equals, true)
+
+	// filtered before paging
+	c.Check(peerIDs(listPeers("role=seed")), check.DeepEquals, ids[:1])
+	c.Check(peerIDs(listPeers("blacklisted=true")), check.DeepEquals, ids[2:3])
+	c.Check(peerIDs(listPeers("role=normal&pageNum=1&pageSize=2")), check.DeepEquals, ids[3:])
+	c.Check(peerIDs(listPeers("role=normal&pageNum=2&pageSize=2")), check.HasLen, 0)
+	c.Check(peerIDs(listPeers("blacklisted=false&sortDirect=DESC")), check.DeepEquals, []string{ids[3], ids[1], ids[0]})
+
+	// and the invalid filters are rejected
+	for _, query := range []string{"role=leader", "blacklisted=maybe"} {
+		code, _, err := httputils.Get(server.URL+"/peers?"+query, 0)
+		c.Assert(err, check.IsNil)
+		c.Check(code, check.Equals, http.StatusInternalServerError, check.Commentf(query))
+	}
+}
+
+func (rs *RouterTestSuite) TestGetPeerSources(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockProgressMgr := mock.NewMockProgressMgr(mockCtl)
+	peerMgr, _ := peer.NewManager(prometheus.NewRegistry())
+
+	resp, err := peerMgr.Register(context.Background(), &types.PeerCreateRequest{
+		IP:       strfmt.IPv4("10.0.0.1"),
+		HostName: strfmt.Hostname("host"),
+		Port:     15001,
+	})
+	c.Assert(err, check.IsNil)
+	mockProgressMgr.EXPECT().GetPeerSources(gomock.Any(), resp.ID).Return([]*mgr.PeerSource{
+		{TaskID: "task1", PieceNums: []int{0, 1, 2}, UploadingPieceNums: []int{1}},
+		{TaskID: "task2", PieceNums: []int{5}},
+	}, nil)
+
+	server := httptest.NewServer(initRoute(&Server{Config: config.NewConfig(), PeerMgr: peerMgr, ProgressMgr: mockProgressMgr}))
+	defer server.Close()
+
+	code, body, err := httputils.Get(server.URL+"/peers/"+resp.ID+"/sources", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(code, check.Equals, http.StatusOK)
+	var sources []*types.PeerSource
+	c.Assert(json.Unmarshal(body, &sources), check.IsNil)
+	c.Check(sources, check.DeepEquals, []*types.PeerSource{
+		{TaskID: "task1", PieceNums: []int32{0, 1, 2}, UploadingPieceNums: []int32{1}},
+		{TaskID: "task2", PieceNums: []int32{5}, UploadingPieceNums: []int32{}},
+	})
+
+	// the unknown peer is not found
+	unknown, err := http.Get(server.URL + "/peers/unknown/sources")
+	c.Assert(err, check.IsNil)
+	c.Check(unknown.StatusCode, check.Equals, http.StatusInternalServerError)
+	checkErrorCode(c, unknown, constants.CodeTargetNotFound, "unknown peer")
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+	netUrl "net/url"
+	"strings"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/gorilla/mux"
+)
+
+// originURLHeader carries the url of the source in the requests to the read-through proxy
+// whose url is not encoded in the path.
+const originURLHeader = "X-Dragonfly-Origin-URL"
+
+// serveReadThrough serves the file of the source as a caching proxy. The task of the source
+// is registered and downloaded by supernode, and its content is served once it's cached,
+// or streamed as the pieces are committed with the first-byte ContentServingPolicy.
+// The X-Dragonfly-Cache-Status tells whether the file has been cached before the request.
+func (s *Server) serveReadThrough(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	if !s.Config.EnableReadThroughProxy {
+		rw.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	task, err := s.TaskMgr.ReadThrough(ctx, &types.TaskCreateRequest{
+		RawURL:      getReadThroughURL(req),
+		Consistency: getReadThroughConsistency(req.Header),
+	})
+	if err != nil {
+		return err
+	}
+
+	if task.CdnStatus == types.TaskInfoCdnStatusSUCCESS {
+		rw.Header().Set(cacheStatusHeader, cacheStatusHit)
+		return s.serveContent(ctx, rw, req, task.ID)
+	}
+	rw.Header().Set(cacheStatusHeader, cacheStatusMiss)
+
+	// the file whose length is unknown can't be streamed before it's cached.
+	if s.Config.ContentServingPolicy != config.ContentServingFirstByte || task.HTTPFileLength < 0 {
+		cdnStatus, err := s.waitCDNFinished(ctx, req, task.ID)
+		if err != nil || cdnStatus == "" {
+			return err
+		}
+		if cdnStatus != types.TaskInfoCdnStatusSUCCESS {
+			rw.WriteHeader(http.StatusBadGateway)
+			return nil
+		}
+	}
+	return s.serveContent(ctx, rw, req, task.ID)
+}
+
+// getReadThroughURL returns the url of the source encoded in the path of the req,
+// such as /proxy/https/example.com/file?query, or carried by the X-Dragonfly-Origin-URL.
+func getReadThroughURL(req *http.Request) string {
+	vars := mux.Vars(req)
+	if vars["scheme"] == "" {
+		return req.Header.Get(originURLHeader)
+	}
+
+	u := &netUrl.URL{
+		Scheme:   vars["scheme"],
+		Host:     vars["host"],
+		Path:     "/" + vars["path"],
+		RawQuery: req.URL.RawQuery,
+	}
+	return u.String()
+}
+
+// getReadThroughConsistency returns the consistency level required by the Cache-Control
+// of the request, and the cached file is revalidated with no-cache or max-age=0.
+func getReadThroughConsistency(header http.Header) string {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "max-age=0":
+			return types.TaskCreateRequestConsistencyRevalidate
+		}
+	}
+	return ""
+}
+
+// waitCDNFinished waits until the CDN of the task finishes and returns its status,
+// or "" if the request is canceled meanwhile.
+func (s *Server) waitCDNFinished(ctx context.Context, req *http.Request, id string) (string, error) {
+	// subscribe before getting the task to miss no changes
+	changes, cancel, err := s.ProgressMgr.WatchTask(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+
+	for {
+		// the copy of the task is polled since its status is updated by the CDN meanwhile
+		task, err := s.TaskMgr.Get(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if isFinishedCDN(task.CdnStatus) {
+			return task.CdnStatus, nil
+		}
+
+		select {
+		case <-changes:
+		case <-req.Context().Done():
+			return "", nil
+		}
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+	"github.com/gorilla/mux"
+)
+
+// readThrough gets the url through the proxy and returns the response with its body read.
+func readThrough(c *check.C, url string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	c.Assert(err, check.IsNil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	return resp, string(body)
+}
+
+func (s *TaskBridgeTestSuite) TestReadThroughProxy(c *check.C) {
+	content := strings.Repeat("dragonfly", 100000)
+	lastModified := time.Unix(1500000000, 0).UTC()
+	var downloads, revalidations int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") != "" {
+			atomic.AddInt32(&revalidations, 1)
+		} else if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+			atomic.AddInt32(&downloads, 1)
+		}
+		w.Header().Set("Cache-Control", "max-age=600")
+		http.ServeContent(w, r, "file", lastModified, strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	proxyURL := server.URL + "/proxy/http/" + strings.TrimPrefix(origin.URL, "http://") + "/file?v=1"
+
+	// the proxy is disabled by default
+	resp, _ := readThrough(c, proxyURL, nil)
+	c.Check(resp.StatusCode, check.Equals, http.StatusNotFound)
+	srv.Config.EnableReadThroughProxy = true
+
+	// the cold read fetches the file from the origin and caches it
+	resp, body := readThrough(c, proxyURL, nil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(body, check.Equals, content)
+	c.Check(resp.Header.Get(cacheStatusHeader), check.Equals, cacheStatusMiss)
+	c.Check(resp.Header.Get("Cache-Control"), check.Equals, "max-age=600")
+	c.Check(resp.Header.Get("Last-Modified"), check.Equals, lastModified.Format(http.TimeFormat))
+	downloaded := atomic.LoadInt32(&downloads)
+	c.Check(downloaded > 0, check.Equals, true)
+
+	tasks, err := srv.TaskMgr.List(nil, map[string]string{"cdnStatus": types.TaskInfoCdnStatusSUCCESS})
+	c.Assert(err, check.IsNil)
+	c.Assert(tasks, check.HasLen, 1)
+	c.Check(tasks[0].RawURL, check.Equals, origin.URL+"/file?v=1")
+
+	// and the warm reads are served from the cache, including the ones with the url in the header
+	resp, body = readThrough(c, proxyURL, nil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(body, check.Equals, content)
+	c.Check(resp.Header.Get(cacheStatusHeader), check.Equals, cacheStatusHit)
+	resp, body = readThrough(c, server.URL+"/proxy", http.Header{originURLHeader: {origin.URL + "/file?v=1"}})
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(body, check.Equals, content)
+	c.Check(resp.Header.Get(cacheStatusHeader), check.Equals, cacheStatusHit)
+
+	// the range requests are served from the cache as well
+	resp, body = readThrough(c, proxyURL, http.Header{"Range": {"bytes=9-17"}})
+	c.Check(resp.StatusCode, check.Equals, http.StatusPartialContent)
+	c.Check(body, check.Equals, "dragonfly")
+	c.Check(atomic.LoadInt32(&downloads), check.Equals, downloaded)
+
+	// the cached file is revalidated with the origin on demand
+	resp, body = readThrough(c, proxyURL, http.Header{"Cache-Control": {"no-cache"}})
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(body, check.Equals, content)
+	c.Check(resp.Header.Get(cacheStatusHeader), check.Equals, cacheStatusHit)
+	c.Check(atomic.LoadInt32(&revalidations), check.Equals, int32(1))
+	c.Check(atomic.LoadInt32(&downloads), check.Equals, downloaded)
+}
+
+func (s *TaskBridgeTestSuite) TestReadThroughFirstByte(c *check.C) {
+	content := strings.Repeat("dragonfly", 100000)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	srv.Config.EnableReadThroughProxy = true
+	srv.Config.ContentServingPolicy = config.ContentServingFirstByte
+
+	resp, body := readThrough(c, server.URL+"/proxy", http.Header{originURLHeader: {origin.URL + "/file"}})
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(body, check.Equals, content)
+	c.Check(resp.Header.Get(cacheStatusHeader), check.Equals, cacheStatusMiss)
+}
+
+func (s *TaskBridgeTestSuite) TestReadThroughSourceError(c *check.C) {
+	var requests int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the source responds the length and fails the download
+		if atomic.AddInt32(&requests, 1) > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Length", "9")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	srv.Config.EnableReadThroughProxy = true
+
+	resp, _ := readThrough(c, server.URL+"/proxy", http.Header{originURLHeader: {origin.URL + "/file"}})
+	c.Check(resp.StatusCode, check.Equals, http.StatusBadGateway)
+	c.Check(resp.Header.Get(cacheStatusHeader), check.Equals, cacheStatusMiss)
+}
+
+func (s *TaskBridgeTestSuite) TestGetReadThroughURL(c *check.C) {
+	router := mux.NewRouter()
+	var url string
+	router.HandleFunc("/proxy/{scheme:https?}/{host}/{path:.*}", func(w http.ResponseWriter, r *http.Request) {
+		url = getReadThroughURL(r)
+	})
+	router.HandleFunc("/proxy", func(w http.ResponseWriter, r *http.Request) {
+		url = getReadThroughURL(r)
+	})
+
+	var cases = []struct {
+		path     string
+		header   string
+		expected string
+	}{
+		{path: "/proxy/https/example.com/a/b.tar.gz", expected: "https://example.com/a/b.tar.gz"},
+		{path: "/proxy/http/example.com:8080/a?x=1&y=2", expected: "http://example.com:8080/a?x=1&y=2"},
+		{path: "/proxy/http/example.com/", expected: "http://example.com/"},
+		{path: "/proxy", header: "https://example.com/file?x=1", expected: "https://example.com/file?x=1"},
+	}
+	for _, tc := range cases {
+		url = ""
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set(originURLHeader, tc.header)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		c.Check(url, check.Equals, tc.expected, check.Commentf("path: %s", tc.path))
+	}
+}
+
+func (s *TaskBridgeTestSuite) TestGetReadThroughConsistency(c *check.C) {
+	var cases = []struct {
+		cacheControl string
+		expected     string
+	}{
+		{cacheControl: "", expected: ""},
+		{cacheControl: "max-age=600", expected: ""},
+		{cacheControl: "no-cache", expected: types.TaskCreateRequestConsistencyRevalidate},
+		{cacheControl: "no-transform, Max-Age=0", expected: types.TaskCreateRequestConsistencyRevalidate},
+	}
+	for _, tc := range cases {
+		header := http.Header{}
+		header.Set("Cache-Control", tc.cacheControl)
+		c.Check(getReadThroughConsistency(header), check.Equals, tc.expected, check.Commentf("%s", tc.cacheControl))
+	}
+}
@@ -54,6 +54,38 @@ func NewResultInfoWithError(err error) ResultInfo {
 		return NewResultInfoWithCodeError(constants.CodeURLNotReachable, err)
 	}
 
+	if errortypes.IsTaskPurged(err) {
+		return NewResultInfoWithCodeError(constants.CodeTaskPurged, err)
+	}
+
+	if errortypes.IsRequestTooLarge(err) {
+		return NewResultInfoWithCodeError(constants.CodeRequestTooLarge, err)
+	}
+
+	if errortypes.IsTaskExpired(err) {
+		return NewResultInfoWithCodeError(constants.CodeTaskExpired, err)
+	}
+
+	if errortypes.IsPieceOutOfRange(err) {
+		return NewResultInfoWithCodeError(constants.CodePieceOutOfRange, err)
+	}
+
+	if errortypes.IsTaskBudgetExceeded(err) {
+		return NewResultInfoWithCodeError(constants.CodeTaskBudgetExceeded, err)
+	}
+
+	if errortypes.IsClientInactive(err) {
+		return NewResultInfoWithCodeError(constants.CodeClientInactive, err)
+	}
+
+	if errortypes.IsTaskCanceled(err) {
+		return NewResultInfoWithCodeError(constants.CodeTaskCanceled, err)
+	}
+
+	if errortypes.IsTaskPoisoned(err) {
+		return NewResultInfoWithCodeError(constants.CodeTaskPoisoned, err)
+	}
+
 	// IsConvertFailed
 	return NewResultInfoWithCodeError(constants.CodeSystemError, err)
 }
@@ -19,13 +19,19 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/pprof"
+	"strconv"
+	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
 	"github.com/dragonflyoss/Dragonfly/version"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -47,23 +53,74 @@ func initRoute(s *Server) *mux.Router {
 		{Method: http.MethodGet, Path: "/peer/task", HandlerFunc: s.pullPieceTask},
 		{Method: http.MethodGet, Path: "/peer/piece/suc", HandlerFunc: s.reportPiece},
 		{Method: http.MethodGet, Path: "/peer/service/down", HandlerFunc: s.reportServiceDown},
+		{Method: http.MethodGet, Path: "/peer/lease", HandlerFunc: s.renewLease},
 
 		// v1
 		// peer
 		{Method: http.MethodPost, Path: "/peers", HandlerFunc: s.registerPeer},
 		{Method: http.MethodDelete, Path: "/peers/{id}", HandlerFunc: s.deRegisterPeer},
 		{Method: http.MethodGet, Path: "/peers/{id}", HandlerFunc: s.getPeer},
+		{Method: http.MethodGet, Path: "/peers/{id}/sources", HandlerFunc: s.getPeerSources},
 		{Method: http.MethodGet, Path: "/peers", HandlerFunc: s.listPeers},
 
+		// task
+		{Method: http.MethodGet, Path: "/tasks", HandlerFunc: s.listTasks},
+		{Method: http.MethodGet, Path: "/tasks/{id}", HandlerFunc: s.getTask},
+		{Method: http.MethodHead, Path: "/tasks/{id}", HandlerFunc: s.headTask},
+		{Method: http.MethodGet, Path: "/tasks/{id}/content", HandlerFunc: s.serveTaskContent},
+		{Method: http.MethodHead, Path: "/tasks/{id}/content", HandlerFunc: s.headTask},
+		{Method: http.MethodGet, Path: "/tasks/{id}/pieces/{pieceNum}/proof", HandlerFunc: s.getPieceProof},
+		{Method: http.MethodGet, Path: "/tasks/{id}/pieces/{pieceNum}/explain", HandlerFunc: s.explainPiece},
+		{Method: http.MethodGet, Path: "/tasks/{id}/pieces/manifest", HandlerFunc: s.getPieceManifest},
+		{Method: http.MethodPost, Path: "/tasks/{id}/delta", HandlerFunc: s.serveTaskDelta},
+		{Method: http.MethodGet, Path: "/tasks/{id}/progress", HandlerFunc: s.streamTaskProgress},
+		{Method: http.MethodGet, Path: "/tasks/{id}/swarm-health", HandlerFunc: s.getSwarmHealth},
+		{Method: http.MethodGet, Path: "/tasks/{id}/events", HandlerFunc: s.getTaskEvents},
+		{Method: http.MethodPost, Path: "/tasks/{id}/pause", HandlerFunc: s.pauseTask},
+		{Method: http.MethodPost, Path: "/tasks/{id}/resume", HandlerFunc: s.resumeTask},
+
+		// archive
+		{Method: http.MethodPost, Path: "/archives", HandlerFunc: s.createArchive},
+		{Method: http.MethodGet, Path: "/archives/{id}", HandlerFunc: s.getArchive},
+		{Method: http.MethodGet, Path: "/archives/{id}/content", HandlerFunc: s.serveArchiveContent},
+		{Method: http.MethodGet, Path: "/archives/{id}/manifest", HandlerFunc: s.getArchiveManifest},
+		{Method: http.MethodGet, Path: "/archives/{id}/members/{name:.+}", HandlerFunc: s.serveArchiveMember},
+
+		// download
+		{Method: http.MethodGet, Path: "/" + config.DownloadHome + "/{prefix}/{id}", HandlerFunc: s.serveDownload},
+
+		// cache
+		{Method: http.MethodDelete, Path: "/cache", HandlerFunc: s.purgeCache},
+		{Method: http.MethodGet, Path: "/cache/inventory", HandlerFunc: s.exportCacheInventory},
+
+		// tag
+		{Method: http.MethodPost, Path: "/tags/{tag}/preheat", HandlerFunc: s.preheatTag},
+		{Method: http.MethodPost, Path: "/tags/{tag}/cancel", HandlerFunc: s.cancelTag},
+
+		// origin
+		{Method: http.MethodGet, Path: "/origin/concurrency", HandlerFunc: s.getOriginConcurrency},
+		{Method: http.MethodPut, Path: "/origin/concurrency", HandlerFunc: s.setOriginConcurrency},
+		{Method: http.MethodPost, Path: "/origin/probe", HandlerFunc: s.probeOrigin},
+
+		// proxy
+		{Method: http.MethodGet, Path: "/proxy", HandlerFunc: s.serveReadThrough},
+		{Method: http.MethodGet, Path: "/proxy/{scheme:https?}/{host}/{path:.*}", HandlerFunc: s.serveReadThrough},
+
+		// scheduler
+		{Method: http.MethodGet, Path: "/scheduler/safe-mode", HandlerFunc: s.getSafeMode},
+		{Method: http.MethodPut, Path: "/scheduler/safe-mode", HandlerFunc: s.setSafeMode},
+
 		// metrics
 		{Method: http.MethodGet, Path: "/metrics", HandlerFunc: handleMetrics},
 	}
 
 	// register API
+	retryAfter := newRetryAfter(s.Config.RetryAfterBase, s.Config.RetryAfterJitter, time.Now().UnixNano())
 	for _, h := range handlers {
 		if h != nil {
-			r.Path(versionMatcher + h.Path).Methods(h.Method).Handler(m.instrumentHandler(h.Path, filter(h.HandlerFunc)))
-			r.Path(h.Path).Methods(h.Method).Handler(m.instrumentHandler(h.Path, filter(h.HandlerFunc)))
+			handler := limitRequestBody(s.Config.MaxRequestBodySize, h.HandlerFunc)
+			r.Path(versionMatcher + h.Path).Methods(h.Method).Handler(m.instrumentHandler(h.Path, filter(handler, retryAfter)))
+			r.Path(h.Path).Methods(h.Method).Handler(m.instrumentHandler(h.Path, filter(handler, retryAfter)))
 		}
 	}
 
@@ -82,7 +139,7 @@ func handleMetrics(ctx context.Context, rw http.ResponseWriter, req *http.Reques
 	return nil
 }
 
-func filter(handler Handler) http.HandlerFunc {
+func filter(handler Handler, retryAfter func() int) http.HandlerFunc {
 	pctx := context.Background()
 
 	return func(w http.ResponseWriter, req *http.Request) {
@@ -93,12 +150,78 @@ func filter(handler Handler) http.HandlerFunc {
 
 		if err := handler(ctx, w, req); err != nil {
 			// Handle error if request handling fails.
-			HandleErrorResponse(w, err)
+			HandleErrorResponse(w, err, retryAfter)
 		}
 		return
 	}
 }
 
+// limitRequestBody rejects the request whose body is larger than limit.
+// The limit will be disabled if it's not greater than 0.
+func limitRequestBody(limit int64, handler Handler) Handler {
+	if limit <= 0 {
+		return handler
+	}
+
+	return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		if req.ContentLength > limit {
+			return errors.Wrapf(errortypes.ErrRequestTooLarge, "the size of request body %d exceeds the limit %d",
+				req.ContentLength, limit)
+		}
+		// the body without Content-Length will be checked while reading.
+		req.Body = &limitedBody{ReadCloser: req.Body, rw: rw, limit: limit, remaining: limit}
+		return handler(ctx, rw, req)
+	}
+}
+
+// limitedBody reads a request body of at most limit bytes,
+// and the ErrRequestTooLarge error will be returned once the body exceeds it.
+type limitedBody struct {
+	io.ReadCloser
+	rw        http.ResponseWriter
+	limit     int64
+	remaining int64
+	err       error
+}
+
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	if lb.err != nil {
+		return 0, lb.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// read one more byte than remaining to find out whether the body exceeds the limit.
+	if int64(len(p)) > lb.remaining+1 {
+		p = p[:lb.remaining+1]
+	}
+	n, err := lb.ReadCloser.Read(p)
+	if int64(n) <= lb.remaining {
+		lb.remaining -= int64(n)
+		lb.err = err
+		return n, err
+	}
+
+	n = int(lb.remaining)
+	lb.remaining = 0
+	lb.err = errors.Wrapf(errortypes.ErrRequestTooLarge, "the size of request body exceeds the limit %d", lb.limit)
+	// the rest of the body is left unread, so the connection can't be reused.
+	lb.rw.Header().Set("Connection", "close")
+	return n, lb.err
+}
+
+// decodeRequestBody decodes the json body of req into v.
+func decodeRequestBody(req *http.Request, v interface{}) error {
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		if errortypes.IsRequestTooLarge(err) {
+			return err
+		}
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+	return nil
+}
+
 // EncodeResponse encodes response in json.
 func EncodeResponse(rw http.ResponseWriter, statusCode int, data interface{}) error {
 	rw.Header().Set("Content-Type", "application/json")
@@ -107,7 +230,9 @@ func EncodeResponse(rw http.ResponseWriter, statusCode int, data interface{}) er
 }
 
 // HandleErrorResponse handles err from daemon side and constructs response for client side.
-func HandleErrorResponse(w http.ResponseWriter, err error) {
+// And the 503 response is told to retry after the seconds generated by retryAfter
+// unless the Retry-After has been set, which is skipped if retryAfter is nil.
+func HandleErrorResponse(w http.ResponseWriter, err error, retryAfter func() int) {
 	var (
 		code   int
 		errMsg string
@@ -115,8 +240,20 @@ func HandleErrorResponse(w http.ResponseWriter, err error) {
 
 	// By default, daemon side returns code 500 if error happens.
 	code = http.StatusInternalServerError
+	if errortypes.IsRequestTooLarge(err) {
+		code = http.StatusRequestEntityTooLarge
+	}
+	if errortypes.IsPieceOutOfRange(err) {
+		code = http.StatusBadRequest
+	}
+	if errortypes.IsTooManySubscribers(err) || errortypes.IsTaskBusy(err) {
+		code = http.StatusServiceUnavailable
+	}
 	errMsg = NewResultInfoWithError(err).Error()
 
+	if code == http.StatusServiceUnavailable && retryAfter != nil && w.Header().Get("Retry-After") == "" {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter()))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	enc := json.NewEncoder(w)
@@ -17,23 +17,34 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
 	"github.com/dragonflyoss/Dragonfly/pkg/httputils"
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
 	"github.com/dragonflyoss/Dragonfly/version"
 
 	"github.com/go-check/check"
+	"github.com/go-openapi/strfmt"
+	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
 )
@@ -146,3 +157,288 @@ func (rs *RouterTestSuite) TestHTTPMetrics(c *check.C) {
 			int(prom_testutil.ToFloat64(counter.WithLabelValues(strconv.Itoa(http.StatusOK), "/_ping"))))
 	}
 }
+
+func (rs *RouterTestSuite) TestLimitRequestBody(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.MaxRequestBodySize = 1024
+	server := httptest.NewServer(initRoute(&Server{Config: cfg}))
+	defer server.Close()
+
+	largeBody := fmt.Sprintf(`{"version":"%s"}`, strings.Repeat("a", 2048))
+	for _, tc := range []struct {
+		desc    string
+		body    io.Reader
+		code    int
+		errCode int
+	}{
+		{
+			desc:    "the body with Content-Length exceeds the limit",
+			body:    strings.NewReader(largeBody),
+			code:    http.StatusRequestEntityTooLarge,
+			errCode: constants.CodeRequestTooLarge,
+		},
+		{
+			desc:    "the chunked body exceeds the limit",
+			body:    ioutil.NopCloser(strings.NewReader(largeBody)),
+			code:    http.StatusRequestEntityTooLarge,
+			errCode: constants.CodeRequestTooLarge,
+		},
+		{
+			desc:    "the invalid body within the limit",
+			body:    strings.NewReader(`{"port":1}`),
+			code:    http.StatusInternalServerError,
+			errCode: constants.CodeParamError,
+		},
+	} {
+		resp, err := http.Post(server.URL+"/peers", "application/json", tc.body)
+		c.Assert(err, check.IsNil, check.Commentf(tc.desc))
+		c.Check(resp.StatusCode, check.Equals, tc.code, check.Commentf(tc.desc))
+		checkErrorCode(c, resp, tc.errCode, tc.desc)
+	}
+}
+
+func (rs *RouterTestSuite) TestLimitedBody(c *check.C) {
+	for _, tc := range []struct {
+		size     int
+		tooLarge bool
+	}{
+		{size: 1023, tooLarge: false},
+		{size: 1024, tooLarge: false},
+		{size: 1025, tooLarge: true},
+	} {
+		rw := httptest.NewRecorder()
+		body := &limitedBody{
+			ReadCloser: ioutil.NopCloser(strings.NewReader(strings.Repeat("a", tc.size))),
+			rw:         rw,
+			limit:      1024,
+			remaining:  1024,
+		}
+		data, err := ioutil.ReadAll(body)
+		c.Check(errortypes.IsRequestTooLarge(err), check.Equals, tc.tooLarge, check.Commentf("%+v", tc))
+		if !tc.tooLarge {
+			c.Check(err, check.IsNil)
+			c.Check(len(data), check.Equals, tc.size)
+		}
+		c.Check(rw.Header().Get("Connection") == "close", check.Equals, tc.tooLarge)
+	}
+}
+
+func (rs *RouterTestSuite) TestRegistryFieldBounds(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.MaxRegisterHeaders = 2
+	cfg.MaxRegisterRootCAs = 1
+	server := httptest.NewServer(initRoute(&Server{Config: cfg}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		desc    string
+		request *types.TaskRegisterRequest
+	}{
+		{
+			desc: "too many headers",
+			request: &types.TaskRegisterRequest{
+				Headers: []string{"a:1", "b:2", "c:3"},
+			},
+		},
+		{
+			desc: "too many rootCAs",
+			request: &types.TaskRegisterRequest{
+				RootCAs: []strfmt.Base64{strfmt.Base64("ca1"), strfmt.Base64("ca2")},
+			},
+		},
+	} {
+		body, err := json.Marshal(tc.request)
+		c.Assert(err, check.IsNil)
+		resp, err := http.Post(server.URL+"/peer/registry", "application/json", bytes.NewReader(body))
+		c.Assert(err, check.IsNil, check.Commentf(tc.desc))
+		c.Check(resp.StatusCode, check.Equals, http.StatusRequestEntityTooLarge, check.Commentf(tc.desc))
+		checkErrorCode(c, resp, constants.CodeRequestTooLarge, tc.desc)
+	}
+}
+
+func (rs *RouterTestSuite) TestPieceOutOfRange(c *check.C) {
+	for _, tc := range []struct {
+		desc string
+		err  error
+		code int
+	}{
+		{
+			desc: "the piece out of range is a bad request",
+			err:  errors.Wrap(errortypes.ErrPieceOutOfRange, "pieceNum 4 with 4 pieces"),
+			code: http.StatusBadRequest,
+		},
+		{
+			desc: "the other errors are returned with the result code",
+			err:  errors.Wrap(errortypes.ErrCDNWait, "taskID"),
+			code: http.StatusOK,
+		},
+	} {
+		server := httptest.NewServer(initRoute(&Server{
+			Config:  config.NewConfig(),
+			TaskMgr: &fakeTaskMgr{getPiecesErr: tc.err},
+		}))
+		resp, err := http.Get(server.URL + "/peer/task?taskId=task&srcCid=cid&status=running&result=success&range=16-19")
+		c.Assert(err, check.IsNil, check.Commentf(tc.desc))
+		c.Check(resp.StatusCode, check.Equals, tc.code, check.Commentf(tc.desc))
+		if tc.code == http.StatusBadRequest {
+			checkErrorCode(c, resp, constants.CodePieceOutOfRange, tc.desc)
+		} else {
+			resp.Body.Close()
+		}
+		server.Close()
+	}
+}
+
+func (rs *RouterTestSuite) TestRetryAfterOfUnavailable(c *check.C) {
+	unavailable := errors.Wrap(errortypes.ErrTooManySubscribers, "taskID")
+	retryAfter := func() int { return 7 }
+
+	// the 503 response is told to retry after the generated seconds
+	rw := httptest.NewRecorder()
+	HandleErrorResponse(rw, unavailable, retryAfter)
+	c.Check(rw.Code, check.Equals, http.StatusServiceUnavailable)
+	c.Check(rw.Header().Get("Retry-After"), check.Equals, "7")
+
+	// unless the handler has set it
+	rw = httptest.NewRecorder()
+	rw.Header().Set("Retry-After", "3")
+	HandleErrorResponse(rw, unavailable, retryAfter)
+	c.Check(rw.Header().Get("Retry-After"), check.Equals, "3")
+
+	// and the other responses are not
+	rw = httptest.NewRecorder()
+	HandleErrorResponse(rw, errors.Wrap(errortypes.ErrSystemError, "taskID"), retryAfter)
+	c.Check(rw.Code, check.Equals, http.StatusInternalServerError)
+	c.Check(rw.Header().Get("Retry-After"), check.Equals, "")
+}
+
+func (rs *RouterTestSuite) TestOriginConcurrency(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	server := httptest.NewServer(initRoute(&Server{Config: config.NewConfig(), CDNMgr: mockCDNMgr}))
+	defer server.Close()
+
+	put := func(body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/origin/concurrency", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, check.IsNil)
+		return resp
+	}
+
+	// the limit is changed with the downloads in flight kept
+	gomock.InOrder(
+		mockCDNMgr.EXPECT().SetOriginConcurrency(gomock.Any(), 2),
+		mockCDNMgr.EXPECT().GetOriginConcurrency(gomock.Any()).Return(2, 3),
+	)
+	resp := put(`{"limit": 2}`)
+	c.Check(resp.StatusCode, check.Equals, http.StatusOK)
+	result := &types.OriginConcurrency{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(result), check.IsNil)
+	resp.Body.Close()
+	c.Check(*result.Limit, check.Equals, int64(2))
+	c.Check(result.InFlight, check.Equals, int64(3))
+
+	// and it's got at runtime
+	mockCDNMgr.EXPECT().GetOriginConcurrency(gomock.Any()).Return(2, 1)
+	code, body, err := httputils.Get(server.URL+"/origin/concurrency", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusOK)
+	c.Assert(json.Unmarshal(body, result), check.IsNil)
+	c.Check(*result.Limit, check.Equals, int64(2))
+	c.Check(result.InFlight, check.Equals, int64(1))
+
+	// and the missing or negative limit is rejected
+	for _, body := range []string{`{}`, `{"limit": -1}`} {
+		resp := put(body)
+		c.Check(resp.StatusCode, check.Equals, http.StatusInternalServerError, check.Commentf(body))
+		checkErrorCode(c, resp, constants.CodeParamError, body)
+	}
+}
+
+func (rs *RouterTestSuite) TestSafeMode(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockSchedulerMgr := mock.NewMockSchedulerMgr(mockCtl)
+	server := httptest.NewServer(initRoute(&Server{Config: config.NewConfig(), SchedulerMgr: mockSchedulerMgr}))
+	defer server.Close()
+
+	put := func(body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/scheduler/safe-mode", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, check.IsNil)
+		return resp
+	}
+
+	// the safe mode is enabled with the peer transfers cut
+	gomock.InOrder(
+		mockSchedulerMgr.EXPECT().SetSafeMode(gomock.Any(), true, true),
+		mockSchedulerMgr.EXPECT().GetSafeMode(gomock.Any()).Return(true, true),
+	)
+	resp := put(`{"enabled": true, "cutPeerTransfers": true}`)
+	c.Check(resp.StatusCode, check.Equals, http.StatusOK)
+	result := &types.SafeMode{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(result), check.IsNil)
+	resp.Body.Close()
+	c.Check(*result.Enabled, check.Equals, true)
+	c.Check(result.CutPeerTransfers, check.Equals, true)
+
+	// and it's got at runtime
+	mockSchedulerMgr.EXPECT().GetSafeMode(gomock.Any()).Return(false, false)
+	code, body, err := httputils.Get(server.URL+"/scheduler/safe-mode", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusOK)
+	result = &types.SafeMode{}
+	c.Assert(json.Unmarshal(body, result), check.IsNil)
+	c.Check(*result.Enabled, check.Equals, false)
+	c.Check(result.CutPeerTransfers, check.Equals, false)
+
+	// and the missing switch is rejected
+	resp = put(`{"cutPeerTransfers": true}`)
+	c.Check(resp.StatusCode, check.Equals, http.StatusInternalServerError)
+	checkErrorCode(c, resp, constants.CodeParamError, "missing enabled")
+}
+
+func (rs *RouterTestSuite) TestExplainPiece(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockSchedulerMgr := mock.NewMockSchedulerMgr(mockCtl)
+	server := httptest.NewServer(initRoute(&Server{Config: config.NewConfig(), SchedulerMgr: mockSchedulerMgr}))
+	defer server.Close()
+
+	mockSchedulerMgr.EXPECT().Explain(gomock.Any(), "taskID", "clientID", 3).Return(&types.SchedulerDecision{
+		TaskID:   "taskID",
+		CID:      "clientID",
+		PieceNum: 3,
+		DstPID:   "peerA",
+		Reason:   "first-available-source",
+		Candidates: []*types.SchedulerCandidate{
+			{PeerID: "peerB", Status: "busy", Rank: 1, Load: 5, UpLimit: 5},
+			{PeerID: "peerA", Status: "selected", Rank: 2, Load: 1, UpLimit: 5},
+		},
+	}, nil)
+	code, body, err := httputils.Get(server.URL+"/tasks/taskID/pieces/3/explain?cid=clientID", 0)
+	c.Assert(err, check.IsNil)
+	c.Check(code, check.Equals, http.StatusOK)
+	result := &types.SchedulerDecision{}
+	c.Assert(json.Unmarshal(body, result), check.IsNil)
+	c.Check(result.DstPID, check.Equals, "peerA")
+	c.Assert(len(result.Candidates), check.Equals, 2)
+	c.Check(*result.Candidates[0], check.Equals, types.SchedulerCandidate{PeerID: "peerB", Status: "busy", Rank: 1, Load: 5, UpLimit: 5})
+
+	// the client is required
+	resp, err := http.Get(server.URL + "/tasks/taskID/pieces/3/explain")
+	c.Assert(err, check.IsNil)
+	c.Check(resp.StatusCode, check.Equals, http.StatusInternalServerError)
+	checkErrorCode(c, resp, constants.CodeParamError, "missing cid")
+}
+
+func checkErrorCode(c *check.C, resp *http.Response, code int, desc string) {
+	defer resp.Body.Close()
+	result := &types.Error{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(result), check.IsNil, check.Commentf(desc))
+	c.Check(strings.HasPrefix(result.Message, fmt.Sprintf("{\"Code\":%d,", code)), check.Equals, true,
+		check.Commentf("%s: %s", desc, result.Message))
+}
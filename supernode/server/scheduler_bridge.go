@@ -0,0 +1,75 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+func (s *Server) getSafeMode(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	return EncodeResponse(rw, http.StatusOK, s.safeMode(ctx))
+}
+
+func (s *Server) setSafeMode(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	request := &types.SafeMode{}
+	if err := decodeRequestBody(req, request); err != nil {
+		return err
+	}
+	if err := request.Validate(strfmt.NewFormats()); err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+
+	s.SchedulerMgr.SetSafeMode(ctx, *request.Enabled, request.CutPeerTransfers)
+	return EncodeResponse(rw, http.StatusOK, s.safeMode(ctx))
+}
+
+func (s *Server) safeMode(ctx context.Context) *types.SafeMode {
+	enabled, cutPeerTransfers := s.SchedulerMgr.GetSafeMode(ctx)
+	return &types.SafeMode{
+		CutPeerTransfers: cutPeerTransfers,
+		Enabled:          &enabled,
+	}
+}
+
+// explainPiece returns the most recent decision of the scheduler on the source
+// of the piece assigned to the client specified by the query cid.
+func (s *Server) explainPiece(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+	pieceNum, err := strconv.Atoi(mux.Vars(req)["pieceNum"])
+	if err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+	cid := req.URL.Query().Get("cid")
+	if cid == "" {
+		return errors.Wrap(errortypes.ErrEmptyValue, "cid")
+	}
+
+	decision, err := s.SchedulerMgr.Explain(ctx, id, cid, pieceNum)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, decision)
+}
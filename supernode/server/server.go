@@ -17,9 +17,11 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/dragonflyoss/Dragonfly/supernode/config"
@@ -28,6 +30,7 @@ import (
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/dfgettask"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/peer"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/progress"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/replica"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/scheduler"
 	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/task"
 	"github.com/dragonflyoss/Dragonfly/supernode/httpclient"
@@ -36,6 +39,8 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // Server is supernode server struct.
@@ -45,53 +50,77 @@ type Server struct {
 	TaskMgr      mgr.TaskMgr
 	DfgetTaskMgr mgr.DfgetTaskMgr
 	ProgressMgr  mgr.ProgressMgr
+	CDNMgr       mgr.CDNMgr
+	SchedulerMgr mgr.SchedulerMgr
+	ReplicaMgr   *replica.Manager
 	OriginClient httpclient.OriginHTTPClient
+
+	// connections is the number of client connections being served,
+	// which should be accessed atomically.
+	connections int32
+
+	// reloadLock protects the loadedConfig.
+	reloadLock sync.Mutex
+	// loadedConfig is the config reloaded last time, and the Config is used until it's reloaded.
+	loadedConfig *config.Config
+
+	// progressCache shares the progress of the tasks among their subscribers.
+	progressCache *taskProgressCache
 }
 
 // New creates a brand new server instance.
+// The diagnostic record of the failed step will be emitted if it fails.
 func New(cfg *config.Config, register prometheus.Registerer) (*Server, error) {
 	// register supernode build information
 	version.NewBuildInfo("supernode", register)
 
 	sm, err := store.NewManager(cfg)
 	if err != nil {
-		return nil, err
+		return nil, startupFailed(cfg, stepStore, err)
 	}
 	storeLocal, err := sm.Get(store.LocalStorageDriver)
 	if err != nil {
-		return nil, err
+		return nil, startupFailed(cfg, stepStore, err)
 	}
 
-	originClient := httpclient.NewOriginClient()
+	if err := httpclient.ValidateTLSPolicy(cfg); err != nil {
+		return nil, startupFailed(cfg, stepOrigin, err)
+	}
+	originClient := httpclient.NewOriginClientWithConfig(cfg, register)
 	peerMgr, err := peer.NewManager(register)
 	if err != nil {
-		return nil, err
+		return nil, startupFailed(cfg, stepPeer, err)
 	}
 
 	dfgetTaskMgr, err := dfgettask.NewManager(cfg, register)
 	if err != nil {
-		return nil, err
+		return nil, startupFailed(cfg, stepDfgetTask, err)
 	}
 
-	progressMgr, err := progress.NewManager(cfg)
+	progressMgr, err := progress.NewManager(cfg, register)
 	if err != nil {
-		return nil, err
+		return nil, startupFailed(cfg, stepProgress, err)
 	}
 
-	schedulerMgr, err := scheduler.NewManager(cfg, progressMgr)
+	schedulerMgr, err := scheduler.NewManager(cfg, progressMgr, peerMgr)
 	if err != nil {
-		return nil, err
+		return nil, startupFailed(cfg, stepScheduler, err)
 	}
 
-	cdnMgr, err := cdn.NewManager(cfg, storeLocal, progressMgr, originClient)
+	cdnMgr, err := cdn.NewManager(cfg, storeLocal, progressMgr, originClient, register)
 	if err != nil {
-		return nil, err
+		return nil, startupFailed(cfg, stepCDN, err)
 	}
 
 	taskMgr, err := task.NewManager(cfg, peerMgr, dfgetTaskMgr, progressMgr, cdnMgr,
 		schedulerMgr, originClient, register)
 	if err != nil {
-		return nil, err
+		return nil, startupFailed(cfg, stepTask, err)
+	}
+
+	replicaMgr, err := replica.NewManager(cfg, cdnMgr, progressMgr, register)
+	if err != nil {
+		return nil, startupFailed(cfg, stepReplica, err)
 	}
 
 	return &Server{
@@ -100,13 +129,24 @@ func New(cfg *config.Config, register prometheus.Registerer) (*Server, error) {
 		TaskMgr:      taskMgr,
 		DfgetTaskMgr: dfgetTaskMgr,
 		ProgressMgr:  progressMgr,
+		CDNMgr:       cdnMgr,
+		SchedulerMgr: schedulerMgr,
+		ReplicaMgr:   replicaMgr,
 		OriginClient: originClient,
+
+		progressCache: newTaskProgressCache(cfg.ProgressRecomputeInterval),
 	}, nil
 }
 
 // Start runs supernode server.
 func (s *Server) Start() error {
 	router := initRoute(s)
+	if s.ReplicaMgr != nil {
+		s.ReplicaMgr.Start()
+	}
+	s.progressCache.start()
+	defer s.progressCache.stop()
+	s.warmup()
 
 	address := fmt.Sprintf("0.0.0.0:%d", s.Config.ListenPort)
 
@@ -116,11 +156,99 @@ func (s *Server) Start() error {
 		return err
 	}
 
-	server := &http.Server{
-		Handler:           router,
-		ReadTimeout:       time.Minute * 10,
-		ReadHeaderTimeout: time.Minute * 10,
-		IdleTimeout:       time.Minute * 10,
+	server, err := newHTTPServer(s.Config, router)
+	if err != nil {
+		return err
+	}
+	server.ConnState = s.trackConnState
+	if s.Config.MaxConnectionLifetime > 0 {
+		reaper := newConnReaper(s.Config.MaxConnectionLifetime)
+		reaper.start()
+		server.ConnState = func(conn net.Conn, state http.ConnState) {
+			s.trackConnState(conn, state)
+			reaper.trackConnState(conn, state)
+		}
+	}
+
+	tlsEnabled := s.Config.TLSCertFile != "" && s.Config.TLSKeyFile != ""
+	if s.Config.MaxConcurrentConnections > 0 {
+		l = newLimitListener(l, s.Config.MaxConcurrentConnections, !tlsEnabled,
+			newRetryAfter(s.Config.RetryAfterBase, s.Config.RetryAfterJitter, time.Now().UnixNano()),
+			m.connections.WithLabelValues(), m.rejectedConnections.WithLabelValues())
+	}
+
+	if tlsEnabled {
+		logrus.Infof("start to serve HTTPS with HTTP/2 on port %d", s.Config.ListenPort)
+		return server.ServeTLS(l, s.Config.TLSCertFile, s.Config.TLSKeyFile)
 	}
 	return server.Serve(l)
 }
+
+// warmup downloads the WarmupTasks in the background without blocking the start,
+// and the failures are only logged.
+func (s *Server) warmup() {
+	if len(s.Config.WarmupTasks) == 0 {
+		return
+	}
+
+	go func() {
+		taskIDs, err := s.TaskMgr.Warmup(context.Background(), s.Config.WarmupTasks)
+		if err != nil {
+			logrus.Warnf("failed to warm up the tasks: %v", err)
+		}
+		logrus.Infof("start to warm up %d of %d tasks: %v", len(taskIDs), len(s.Config.WarmupTasks), taskIDs)
+	}()
+}
+
+// Reload applies the properties of cfg which can be changed at runtime,
+// and the others are ignored until supernode restarts.
+func (s *Server) Reload(cfg *config.Config) {
+	if cfg == nil || cfg.BaseProperties == nil {
+		return
+	}
+
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	loaded := s.loadedConfig
+	if loaded == nil {
+		loaded = s.Config
+	}
+	s.loadedConfig = cfg
+
+	s.CDNMgr.SetOriginConcurrency(context.Background(), cfg.OriginConcurrencyLimit)
+
+	// the safe mode toggled at runtime stays until it's changed in the config file,
+	// rather than being reset whenever the file is reloaded for the other properties.
+	if loaded == nil || loaded.BaseProperties == nil ||
+		loaded.SafeMode != cfg.SafeMode || loaded.SafeModeCutPeerTransfers != cfg.SafeModeCutPeerTransfers {
+		s.SchedulerMgr.SetSafeMode(context.Background(), cfg.SafeMode, cfg.SafeModeCutPeerTransfers)
+	}
+}
+
+// newHTTPServer creates the http.Server which supports HTTP/2 for the handler.
+// The HTTP/2 will be negotiated by TLS ALPN when the server serves TLS,
+// and the plaintext HTTP/2 (h2c) is accepted if the EnableH2C is set.
+func newHTTPServer(cfg *config.Config, handler http.Handler) (*http.Server, error) {
+	h2s := &http2.Server{
+		IdleTimeout: cfg.ServerIdleTimeout,
+	}
+	if cfg.HTTP2MaxConcurrentStreams > 0 {
+		h2s.MaxConcurrentStreams = uint32(cfg.HTTP2MaxConcurrentStreams)
+	}
+
+	if cfg.EnableH2C {
+		handler = h2c.NewHandler(handler, h2s)
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       cfg.ServerReadTimeout,
+		ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
+		WriteTimeout:      cfg.ServerWriteTimeout,
+		IdleTimeout:       cfg.ServerIdleTimeout,
+	}
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
@@ -0,0 +1,425 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/mock"
+
+	"github.com/go-check/check"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/net/http2"
+)
+
+func init() {
+	check.Suite(&HTTPServerTestSuite{})
+}
+
+type HTTPServerTestSuite struct{}
+
+func (s *HTTPServerTestSuite) TestH2CMultiplexPieces(c *check.C) {
+	content := make([]byte, 64*1024)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.ServeContent(rw, req, "piece", time.Time{}, bytes.NewReader(content))
+	})
+
+	cfg := config.NewConfig()
+	cfg.EnableH2C = true
+	server, err := newHTTPServer(cfg, handler)
+	c.Assert(err, check.IsNil)
+
+	var connCount int32
+	server.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connCount, 1)
+		}
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	go server.Serve(l)
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+
+	pieceSize := 4 * 1024
+	pieceCount := len(content) / pieceSize
+	var wg sync.WaitGroup
+	errs := make(chan error, pieceCount)
+	for i := 0; i < pieceCount; i++ {
+		wg.Add(1)
+		go func(pieceNum int) {
+			defer wg.Done()
+			errs <- getPiece(client, "http://"+l.Addr().String()+"/piece",
+				content[pieceNum*pieceSize:(pieceNum+1)*pieceSize], pieceNum*pieceSize)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		c.Check(err, check.IsNil)
+	}
+	c.Check(atomic.LoadInt32(&connCount), check.Equals, int32(1))
+}
+
+func (s *HTTPServerTestSuite) TestHTTP2OverTLS(c *check.C) {
+	cfg := config.NewConfig()
+	server, err := newHTTPServer(cfg, http.NotFoundHandler())
+	c.Assert(err, check.IsNil)
+	c.Assert(server.TLSConfig, check.NotNil)
+	c.Check(server.TLSConfig.NextProtos, check.DeepEquals, []string{http2.NextProtoTLS})
+}
+
+func (s *HTTPServerTestSuite) TestServerTimeouts(c *check.C) {
+	server, err := newHTTPServer(config.NewConfig(), http.NotFoundHandler())
+	c.Assert(err, check.IsNil)
+	c.Check(server.ReadTimeout, check.Equals, 10*time.Minute)
+	c.Check(server.ReadHeaderTimeout, check.Equals, 10*time.Minute)
+	c.Check(server.WriteTimeout, check.Equals, time.Duration(0))
+	c.Check(server.IdleTimeout, check.Equals, 10*time.Minute)
+
+	cfg := config.NewConfig()
+	cfg.ServerReadTimeout = time.Minute
+	cfg.ServerReadHeaderTimeout = 10 * time.Second
+	cfg.ServerWriteTimeout = 5 * time.Minute
+	cfg.ServerIdleTimeout = 30 * time.Second
+	server, err = newHTTPServer(cfg, http.NotFoundHandler())
+	c.Assert(err, check.IsNil)
+	c.Check(server.ReadTimeout, check.Equals, time.Minute)
+	c.Check(server.ReadHeaderTimeout, check.Equals, 10*time.Second)
+	c.Check(server.WriteTimeout, check.Equals, 5*time.Minute)
+	c.Check(server.IdleTimeout, check.Equals, 30*time.Second)
+}
+
+func (s *HTTPServerTestSuite) TestMaxConnectionLifetime(c *check.C) {
+	reaper := newConnReaper(200 * time.Millisecond)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/slow" {
+				time.Sleep(250 * time.Millisecond)
+			}
+			rw.Write([]byte(req.RemoteAddr))
+		}),
+		ConnState: reaper.trackConnState,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	go server.Serve(l)
+	defer server.Close()
+
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+	get := func(path string) string {
+		resp, err := client.Get("http://" + l.Addr().String() + path)
+		c.Assert(err, check.IsNil)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		c.Assert(err, check.IsNil)
+		return string(body)
+	}
+
+	// the connection is reused within the lifetime
+	first := get("/")
+	c.Check(get("/"), check.Equals, first)
+
+	// the request in progress isn't interrupted,
+	// and the connection is closed once it becomes idle after the lifetime
+	c.Check(get("/slow"), check.Equals, first)
+	second := get("/")
+	c.Check(second, check.Not(check.Equals), first)
+
+	// and the idle connection is closed after the lifetime
+	reaper.reap(time.Now().Add(time.Hour))
+	c.Check(get("/"), check.Not(check.Equals), second)
+}
+
+func (s *HTTPServerTestSuite) TestLimitListener(c *check.C) {
+	oldHoldTimeout := connHoldTimeout
+	connHoldTimeout = 50 * time.Millisecond
+	defer func() { connHoldTimeout = oldHoldTimeout }()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	connections := prometheus.NewGauge(prometheus.GaugeOpts{Name: "connections"})
+	rejected := prometheus.NewCounter(prometheus.CounterOpts{Name: "rejected"})
+	ll := newLimitListener(l, 1, true, newRetryAfter(time.Second, 0, 1), connections, rejected)
+	server := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("ok"))
+	})}
+	go server.Serve(ll)
+	defer server.Close()
+
+	addr := l.Addr().String()
+	first, err := net.Dial("tcp", addr)
+	c.Assert(err, check.IsNil)
+	resp, err := rawGet(first)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(prom_testutil.ToFloat64(connections), check.Equals, float64(1))
+
+	// the first connection is kept alive, so the second one is rejected
+	second, err := net.Dial("tcp", addr)
+	c.Assert(err, check.IsNil)
+	defer second.Close()
+	resp, err = rawGet(second)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(resp.Header.Get("Retry-After"), check.Equals, "1")
+
+	// the slot is released after the first connection is closed
+	first.Close()
+	for i := 0; i < 100 && prom_testutil.ToFloat64(connections) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(prom_testutil.ToFloat64(connections), check.Equals, float64(0))
+	third, err := net.Dial("tcp", addr)
+	c.Assert(err, check.IsNil)
+	defer third.Close()
+	resp, err = rawGet(third)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(prom_testutil.ToFloat64(connections), check.Equals, float64(1))
+}
+
+func (s *HTTPServerTestSuite) TestLimitListenerHoldsEachConnection(c *check.C) {
+	oldHoldTimeout := connHoldTimeout
+	connHoldTimeout = 200 * time.Millisecond
+	defer func() { connHoldTimeout = oldHoldTimeout }()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	connections := prometheus.NewGauge(prometheus.GaugeOpts{Name: "connections"})
+	rejected := prometheus.NewCounter(prometheus.CounterOpts{Name: "rejected"})
+	ll := newLimitListener(l, 1, true, newRetryAfter(time.Second, 0, 1), connections, rejected)
+	server := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("ok"))
+	})}
+	go server.Serve(ll)
+	defer server.Close()
+
+	addr := l.Addr().String()
+	first, err := net.Dial("tcp", addr)
+	c.Assert(err, check.IsNil)
+	defer first.Close()
+	resp, err := rawGet(first)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+
+	// getConcurrently dials the connections back to back, and returns
+	// the status codes and the durations of them.
+	getConcurrently := func(count int) ([]int, []time.Duration) {
+		codes := make([]int, count)
+		durations := make([]time.Duration, count)
+		var wg sync.WaitGroup
+		for i := 0; i < count; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				start := time.Now()
+				conn, err := net.Dial("tcp", addr)
+				c.Assert(err, check.IsNil)
+				defer conn.Close()
+				resp, err := rawGet(conn)
+				c.Assert(err, check.IsNil)
+				codes[i] = resp.StatusCode
+				durations[i] = time.Since(start)
+			}(i)
+		}
+		wg.Wait()
+		return codes, durations
+	}
+
+	// every connection at the limit is held for the same bounded wait before rejected
+	codes, durations := getConcurrently(2)
+	for i := range codes {
+		c.Check(codes[i], check.Equals, http.StatusServiceUnavailable)
+		c.Check(durations[i] >= connHoldTimeout, check.Equals, true, check.Commentf("duration: %v", durations[i]))
+		c.Check(durations[i] < 2*connHoldTimeout, check.Equals, true, check.Commentf("duration: %v", durations[i]))
+	}
+	c.Check(prom_testutil.ToFloat64(rejected), check.Equals, float64(2))
+
+	// and the held connection is served once a slot is released within the wait
+	go func() {
+		time.Sleep(connHoldTimeout / 4)
+		first.Close()
+	}()
+	codes, _ = getConcurrently(1)
+	c.Check(codes[0], check.Equals, http.StatusOK)
+}
+
+func (s *HTTPServerTestSuite) TestLimitListenerJitteredRetryAfter(c *check.C) {
+	oldHoldTimeout := connHoldTimeout
+	connHoldTimeout = 10 * time.Millisecond
+	defer func() { connHoldTimeout = oldHoldTimeout }()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	connections := prometheus.NewGauge(prometheus.GaugeOpts{Name: "connections"})
+	rejected := prometheus.NewCounter(prometheus.CounterOpts{Name: "rejected"})
+	ll := newLimitListener(l, 1, true, newRetryAfter(2*time.Second, 3*time.Second, 1), connections, rejected)
+	server := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("ok"))
+	})}
+	go server.Serve(ll)
+	defer server.Close()
+
+	addr := l.Addr().String()
+	first, err := net.Dial("tcp", addr)
+	c.Assert(err, check.IsNil)
+	defer first.Close()
+	resp, err := rawGet(first)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+
+	// the clients rejected are told to retry at different times within the range
+	seen := make(map[int]bool)
+	for i := 0; i < 40; i++ {
+		conn, err := net.Dial("tcp", addr)
+		c.Assert(err, check.IsNil)
+		resp, err := rawGet(conn)
+		conn.Close()
+		c.Assert(err, check.IsNil)
+		c.Assert(resp.StatusCode, check.Equals, http.StatusServiceUnavailable)
+		retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		c.Assert(err, check.IsNil)
+		c.Check(retryAfter >= 2 && retryAfter <= 5, check.Equals, true, check.Commentf("Retry-After: %d", retryAfter))
+		seen[retryAfter] = true
+	}
+	c.Check(len(seen) > 1, check.Equals, true)
+}
+
+func (s *HTTPServerTestSuite) TestNewRetryAfter(c *check.C) {
+	// the base is rounded up to whole seconds without the jitter
+	retryAfter := newRetryAfter(1500*time.Millisecond, 0, 1)
+	for i := 0; i < 10; i++ {
+		c.Check(retryAfter(), check.Equals, 2)
+	}
+
+	// the jitter less than a second is ignored
+	retryAfter = newRetryAfter(time.Second, 500*time.Millisecond, 1)
+	for i := 0; i < 10; i++ {
+		c.Check(retryAfter(), check.Equals, 1)
+	}
+
+	// the seconds within the jitter are all generated, and
+	// the same sequence is generated with the same seed
+	retryAfter = newRetryAfter(time.Second, 2*time.Second, 1)
+	sameSeed := newRetryAfter(time.Second, 2*time.Second, 1)
+	counts := make(map[int]int)
+	for i := 0; i < 100; i++ {
+		seconds := retryAfter()
+		c.Check(sameSeed(), check.Equals, seconds)
+		counts[seconds]++
+	}
+	c.Assert(counts, check.HasLen, 3)
+	for seconds := 1; seconds <= 3; seconds++ {
+		c.Check(counts[seconds] > 0, check.Equals, true, check.Commentf("%d: %d", seconds, counts[seconds]))
+	}
+}
+
+func rawGet(conn net.Conn) (*http.Response, error) {
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: supernode\r\n\r\n")); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return nil, err
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp, nil
+}
+
+func getPiece(client *http.Client, url string, expected []byte, start int) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+len(expected)-1))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		return fmt.Errorf("unexpected protocol %s", resp.Proto)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(body, expected) {
+		return fmt.Errorf("unexpected content of range starting at %d", start)
+	}
+	return nil
+}
+
+func (s *HTTPServerTestSuite) TestReloadKeepsRuntimeSafeMode(c *check.C) {
+	mockCtl := gomock.NewController(c)
+	defer mockCtl.Finish()
+	mockCDNMgr := mock.NewMockCDNMgr(mockCtl)
+	mockSchedulerMgr := mock.NewMockSchedulerMgr(mockCtl)
+	mockCDNMgr.EXPECT().SetOriginConcurrency(gomock.Any(), gomock.Any()).AnyTimes()
+	server := &Server{Config: config.NewConfig(), CDNMgr: mockCDNMgr, SchedulerMgr: mockSchedulerMgr}
+
+	// the safe mode enabled at runtime is kept by the reload for the other properties
+	cfg := config.NewConfig()
+	cfg.OriginConcurrencyLimit = 8
+	server.Reload(cfg)
+
+	// but it's applied once it's changed in the config file
+	cfg = config.NewConfig()
+	cfg.SafeMode = true
+	mockSchedulerMgr.EXPECT().SetSafeMode(gomock.Any(), true, false)
+	server.Reload(cfg)
+	server.Reload(cfg)
+
+	cfg = config.NewConfig()
+	mockSchedulerMgr.EXPECT().SetSafeMode(gomock.Any(), false, false)
+	server.Reload(cfg)
+}
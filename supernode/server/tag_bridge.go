@@ -0,0 +1,48 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) preheatTag(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	taskIDs, err := s.TaskMgr.Preheat(ctx, mux.Vars(req)["tag"])
+	if err != nil {
+		return err
+	}
+
+	return EncodeResponse(rw, http.StatusOK, &types.TaskGroupResponse{
+		TaskIDs: taskIDs,
+	})
+}
+
+func (s *Server) cancelTag(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	taskIDs, err := s.TaskMgr.Cancel(ctx, mux.Vars(req)["tag"])
+	if err != nil {
+		return err
+	}
+
+	return EncodeResponse(rw, http.StatusOK, &types.TaskGroupResponse{
+		TaskIDs: taskIDs,
+	})
+}
@@ -0,0 +1,393 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/pkg/manifest"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *Server) getTask(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// copy the task to fill in the fields maintained by other managers
+	taskInfo := *task
+	firstPieceTime, err := s.ProgressMgr.GetFirstPieceTime(ctx, id)
+	if err != nil && !errortypes.IsDataNotFound(err) {
+		return err
+	}
+	if !firstPieceTime.IsZero() {
+		taskInfo.FirstPieceTime = strfmt.DateTime(firstPieceTime)
+	}
+	cacheStats, err := s.ProgressMgr.GetCacheStats(ctx, id)
+	if err != nil && !errortypes.IsDataNotFound(err) {
+		return err
+	}
+	if cacheStats != nil {
+		taskInfo.CacheStats = newTaskCacheStats(cacheStats)
+	}
+
+	return EncodeResponse(rw, http.StatusOK, &taskInfo)
+}
+
+// newTaskCacheStats converts the cache stats of a task into the one responded.
+func newTaskCacheStats(stats *mgr.CacheStats) *types.TaskCacheStats {
+	result := &types.TaskCacheStats{
+		Hits:             stats.Hits,
+		RevalidationHits: stats.RevalidationHits,
+		Misses:           stats.Misses,
+	}
+	if total := stats.Hits + stats.RevalidationHits + stats.Misses; total > 0 {
+		result.HitRatio = float64(stats.Hits+stats.RevalidationHits) / float64(total)
+	}
+	return result
+}
+
+// listTasks lists the tasks which can be filtered by the CDN status and tag.
+func (s *Server) listTasks(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	filter := make(map[string]string)
+	if cdnStatus := req.URL.Query().Get("cdnStatus"); cdnStatus != "" {
+		filter["cdnStatus"] = cdnStatus
+	}
+	if tag := req.URL.Query().Get("tag"); tag != "" {
+		filter["tag"] = tag
+	}
+	if metadata := req.URL.Query().Get("metadata"); metadata != "" {
+		filter["metadata"] = metadata
+	}
+
+	tasks, err := s.TaskMgr.List(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return EncodeResponse(rw, http.StatusOK, tasks)
+}
+
+func (s *Server) getPieceProof(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+	pieceNum, err := strconv.Atoi(mux.Vars(req)["pieceNum"])
+	if err != nil {
+		return errors.Wrap(errortypes.ErrInvalidValue, err.Error())
+	}
+
+	proof, err := s.ProgressMgr.GetPieceProof(ctx, id, pieceNum)
+	if err != nil {
+		return err
+	}
+
+	siblings := make([]string, 0, len(proof.Siblings))
+	for _, sibling := range proof.Siblings {
+		siblings = append(siblings, hex.EncodeToString(sibling))
+	}
+	return EncodeResponse(rw, http.StatusOK, &types.PieceProof{
+		PieceNum:   int32(proof.PieceNum),
+		PieceMd5:   proof.PieceMD5,
+		PieceCount: int32(proof.PieceCount),
+		Root:       hex.EncodeToString(proof.Root),
+		Siblings:   siblings,
+	})
+}
+
+func (s *Server) getPieceManifest(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	pieceMD5s, err := s.ProgressMgr.GetSuperPieceMD5s(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// the piece md5 is formed as "md5:pieceLength".
+	hashes := make([]string, 0, len(pieceMD5s))
+	for _, pieceMD5 := range pieceMD5s {
+		hashes = append(hashes, strings.SplitN(pieceMD5, ":", 2)[0])
+	}
+	m, err := manifest.New(manifest.AlgorithmMD5, task.PieceSize, hashes)
+	if err != nil {
+		return err
+	}
+
+	if req.URL.Query().Get("format") == "json" {
+		return EncodeResponse(rw, http.StatusOK, &types.PieceManifest{
+			Algorithm:  m.Algorithm,
+			Hashes:     m.HexHashes(),
+			PieceCount: int32(len(m.Hashes)),
+			PieceSize:  m.PieceSize,
+		})
+	}
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", manifest.ContentType)
+	rw.WriteHeader(http.StatusOK)
+	_, err = rw.Write(data)
+	return err
+}
+
+// taskProgressKeepAliveInterval is the interval to send a comment on the progress stream
+// of a task which doesn't change for a while, which keeps the idle connection alive and
+// detects the disconnected subscriber.
+var taskProgressKeepAliveInterval = 15 * time.Second
+
+// taskProgressMaxWait is the max duration that a long polling of the progress of a task waits for.
+var taskProgressMaxWait = time.Minute
+
+// streamTaskProgress pushes the progress of a task as server-sent events
+// until the CDN of the task finishes or the subscriber disconnects.
+// The progress is shared by all the subscribers of the task, and the changes are coalesced
+// into a computation per ProgressRecomputeInterval.
+// And it falls back to the long polling if the wait is specified.
+func (s *Server) streamTaskProgress(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+	if req.URL.Query().Get("wait") != "" {
+		return s.pollTaskProgress(ctx, rw, req, id)
+	}
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		return errors.Wrap(errortypes.ErrSystemError, "streaming is not supported by the response writer")
+	}
+
+	// subscribe before getting the first progress to miss no changes
+	changes, cancel, err := s.ProgressMgr.WatchTask(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	entry, release := s.progressCache.acquire(id)
+	defer release()
+
+	progress, recompute, err := s.getSharedTaskProgress(ctx, id, entry)
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(taskProgressKeepAliveInterval)
+	defer ticker.Stop()
+
+	var last types.TaskProgress
+	for {
+		// the coalesced changes are pushed once the progress can be computed again
+		if *progress != last {
+			data, err := json.Marshal(progress)
+			if err != nil {
+				return nil
+			}
+			if _, err := fmt.Fprintf(rw, "event: progress\ndata: %s\n\n", data); err != nil {
+				return nil
+			}
+			flusher.Flush()
+			last = *progress
+		}
+		if isFinishedCDN(progress.CdnStatus) {
+			return nil
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil
+		case <-changes:
+		case <-recompute:
+		case <-ticker.C:
+			if _, err := fmt.Fprint(rw, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+
+		if progress, recompute, err = s.getSharedTaskProgress(ctx, id, entry); err != nil {
+			logrus.Debugf("stop streaming the progress of taskID(%s): %v", id, err)
+			return nil
+		}
+	}
+}
+
+// pollTaskProgress responds the progress of a task once its version differs from the since
+// or the CDN of the task finishes, otherwise it waits for the change until the wait expires.
+// It's the fallback for the subscribers which can't consume the server-sent events.
+func (s *Server) pollTaskProgress(ctx context.Context, rw http.ResponseWriter, req *http.Request, id string) error {
+	params := req.URL.Query()
+	wait, err := time.ParseDuration(params.Get("wait"))
+	if err != nil || wait < 0 {
+		return errors.Wrapf(errortypes.ErrInvalidValue, "wait: %s", params.Get("wait"))
+	}
+	if wait > taskProgressMaxWait {
+		wait = taskProgressMaxWait
+	}
+	// the current progress is responded at once without the since
+	since := int64(-1)
+	if v := params.Get("since"); v != "" {
+		if since, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return errors.Wrapf(errortypes.ErrInvalidValue, "since: %s", v)
+		}
+	}
+
+	changes, cancel, err := s.ProgressMgr.WatchTask(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	entry, release := s.progressCache.acquire(id)
+	defer release()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		progress, recompute, err := s.getSharedTaskProgress(ctx, id, entry)
+		if err != nil {
+			return err
+		}
+		if progress.Version != since || isFinishedCDN(progress.CdnStatus) {
+			return EncodeResponse(rw, http.StatusOK, progress)
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil
+		case <-changes:
+		case <-recompute:
+		case <-timer.C:
+			return EncodeResponse(rw, http.StatusOK, progress)
+		}
+	}
+}
+
+// getSwarmHealth gets the aggregate health of the peers sourcing the pieces of the task.
+func (s *Server) getSwarmHealth(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	id := mux.Vars(req)["id"]
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	health, err := s.ProgressMgr.GetSwarmHealth(ctx, id, int(task.PieceTotal))
+	if err != nil {
+		return err
+	}
+
+	result := &types.SwarmHealth{
+		AvgReplication: health.AvgReplication,
+		HealthySources: int32(health.HealthySources),
+		MinReplication: int32(health.MinReplication),
+		PieceTotal:     task.PieceTotal,
+		TaskID:         id,
+	}
+	if task.PieceTotal > 0 {
+		result.Availability = float64(health.AvailablePieces) * 100 / float64(task.PieceTotal)
+	}
+	return EncodeResponse(rw, http.StatusOK, result)
+}
+
+// getTaskEvents gets the event history of the task in chronological order.
+func (s *Server) getTaskEvents(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	events, err := s.ProgressMgr.GetTaskEvents(ctx, mux.Vars(req)["id"])
+	if err != nil {
+		return err
+	}
+
+	result := make([]*types.TaskEvent, 0, len(events))
+	for _, event := range events {
+		result = append(result, &types.TaskEvent{
+			Time:   strfmt.DateTime(event.Time),
+			Type:   event.Type,
+			Detail: event.Detail,
+		})
+	}
+	return EncodeResponse(rw, http.StatusOK, result)
+}
+
+// pauseTask suspends the download of the task from the source.
+func (s *Server) pauseTask(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	if err := s.TaskMgr.Pause(ctx, mux.Vars(req)["id"]); err != nil {
+		return err
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// resumeTask continues the download of the paused task from the source.
+func (s *Server) resumeTask(ctx context.Context, rw http.ResponseWriter, req *http.Request) (err error) {
+	if err := s.TaskMgr.Resume(ctx, mux.Vars(req)["id"]); err != nil {
+		return err
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// getTaskProgress gets the progress of the task on supernode.
+func (s *Server) getTaskProgress(ctx context.Context, id string) (*types.TaskProgress, error) {
+	// get the version before the progress, so that the change in between
+	// is regarded as a newer version than the responded one.
+	version := s.ProgressMgr.GetTaskVersion(ctx, id)
+	task, err := s.TaskMgr.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	availablePieces, err := s.ProgressMgr.GetSuperPieceCount(ctx, id)
+	if err != nil && !errortypes.IsDataNotFound(err) {
+		return nil, err
+	}
+
+	progress := &types.TaskProgress{
+		AvailablePieces: int32(availablePieces),
+		CdnStatus:       task.CdnStatus,
+		PieceTotal:      task.PieceTotal,
+		TaskID:          id,
+		Version:         version,
+	}
+	if task.PieceTotal > 0 {
+		progress.Percent = float64(availablePieces) * 100 / float64(task.PieceTotal)
+	}
+	return progress, nil
+}
+
+func isFinishedCDN(cdnStatus string) bool {
+	return cdnStatus == types.TaskInfoCdnStatusSUCCESS ||
+		cdnStatus == types.TaskInfoCdnStatusFAILED ||
+		cdnStatus == types.TaskInfoCdnStatusSOURCEERROR
+}
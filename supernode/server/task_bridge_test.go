@@ -0,0 +1,811 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/pkg/constants"
+	"github.com/dragonflyoss/Dragonfly/pkg/errortypes"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/progress"
+
+	"github.com/go-check/check"
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	check.Suite(&TaskBridgeTestSuite{})
+}
+
+type TaskBridgeTestSuite struct{}
+
+// fakeTaskMgr serves the tasks in memory, and the other methods are not implemented.
+type fakeTaskMgr struct {
+	mgr.TaskMgr
+
+	mu    sync.Mutex
+	tasks map[string]*types.TaskInfo
+	// getPiecesErr is the error returned by GetPieces.
+	getPiecesErr error
+	// gets is the number of the calls of Get.
+	gets int32
+}
+
+func (tm *fakeTaskMgr) GetPieces(ctx context.Context, taskID, clientID string, req *types.PiecePullRequest) (bool, interface{}, error) {
+	return false, nil, tm.getPiecesErr
+}
+
+func (tm *fakeTaskMgr) Get(ctx context.Context, taskID string) (*types.TaskInfo, error) {
+	atomic.AddInt32(&tm.gets, 1)
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	task, ok := tm.tasks[taskID]
+	if !ok {
+		return nil, errors.Wrapf(errortypes.ErrDataNotFound, "taskID: %s", taskID)
+	}
+	taskInfo := *task
+	return &taskInfo, nil
+}
+
+func (tm *fakeTaskMgr) countGets() int32 {
+	return atomic.LoadInt32(&tm.gets)
+}
+
+func (tm *fakeTaskMgr) setStatus(taskID, cdnStatus string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.tasks[taskID].CdnStatus = cdnStatus
+}
+
+// countingProgressMgr counts the subscribers of the progress changes.
+type countingProgressMgr struct {
+	*progress.Manager
+
+	superCID string
+	watchers int32
+}
+
+func (pm *countingProgressMgr) WatchTask(ctx context.Context, taskID string) (<-chan struct{}, func(), error) {
+	changes, cancel, err := pm.Manager.WatchTask(ctx, taskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	atomic.AddInt32(&pm.watchers, 1)
+	return changes, func() {
+		cancel()
+		atomic.AddInt32(&pm.watchers, -1)
+	}, nil
+}
+
+func (pm *countingProgressMgr) countWatchers() int32 {
+	return atomic.LoadInt32(&pm.watchers)
+}
+
+// readProgress reads the next progress event from the stream.
+func readProgress(c *check.C, reader *bufio.Reader) *types.TaskProgress {
+	var event, data string
+	for {
+		line, err := reader.ReadString('\n')
+		c.Assert(err, check.IsNil)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && event != "" {
+			break
+		}
+		if strings.HasPrefix(line, "event: ") {
+			event = strings.TrimPrefix(line, "event: ")
+		}
+		if strings.HasPrefix(line, "data: ") {
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	c.Assert(event, check.Equals, "progress")
+
+	progress := &types.TaskProgress{}
+	c.Assert(json.Unmarshal([]byte(data), progress), check.IsNil)
+	return progress
+}
+
+// progressServer is the test server whose progress cache is stopped when it's closed.
+type progressServer struct {
+	*httptest.Server
+	progressCache *taskProgressCache
+}
+
+func (s *progressServer) Close() {
+	s.Server.Close()
+	s.progressCache.stop()
+}
+
+// newServer creates a server with the task "task" running on the fake task manager.
+func (s *TaskBridgeTestSuite) newServer(c *check.C, cfg *config.Config) (*progressServer, *fakeTaskMgr, *countingProgressMgr) {
+	cfg.SetCIDPrefix("127.0.0.1")
+	cfg.SetSuperPID("superPID")
+	manager, err := progress.NewManager(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+	progressMgr := &countingProgressMgr{Manager: manager, superCID: cfg.GetSuperCID("task")}
+	c.Assert(progressMgr.InitProgress(context.Background(), "task", "superPID", progressMgr.superCID), check.IsNil)
+
+	taskMgr := &fakeTaskMgr{tasks: map[string]*types.TaskInfo{
+		"task": {ID: "task", CdnStatus: types.TaskInfoCdnStatusRUNNING, PieceTotal: 4},
+	}}
+	srv := &Server{Config: cfg, TaskMgr: taskMgr, ProgressMgr: progressMgr,
+		progressCache: newTaskProgressCache(cfg.ProgressRecomputeInterval)}
+	srv.progressCache.start()
+	return &progressServer{httptest.NewServer(initRoute(srv)), srv.progressCache}, taskMgr, progressMgr
+}
+
+func (s *TaskBridgeTestSuite) TestStreamTaskProgress(c *check.C) {
+	server, taskMgr, progressMgr := s.newServer(c, config.NewConfig())
+	defer server.Close()
+	ctx := context.Background()
+	superCID := progressMgr.superCID
+
+	resp, err := http.Get(server.URL + "/tasks/task/progress")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(resp.Header.Get("Content-Type"), check.Equals, "text/event-stream")
+	reader := bufio.NewReader(resp.Body)
+
+	c.Check(readProgress(c, reader), check.DeepEquals, &types.TaskProgress{
+		TaskID: "task", CdnStatus: types.TaskInfoCdnStatusRUNNING, PieceTotal: 4,
+	})
+
+	// the update is pushed on the piece completion
+	c.Assert(progressMgr.UpdateProgress(ctx, "task", superCID, "superPID", "", 0, config.PieceSUCCESS, 0), check.IsNil)
+	c.Check(readProgress(c, reader), check.DeepEquals, &types.TaskProgress{
+		TaskID: "task", CdnStatus: types.TaskInfoCdnStatusRUNNING, PieceTotal: 4, AvailablePieces: 1, Percent: 25, Version: 1,
+	})
+
+	// and the stream ends when the CDN finishes
+	taskMgr.setStatus("task", types.TaskInfoCdnStatusSUCCESS)
+	progressMgr.NotifyTask(ctx, "task")
+	c.Check(readProgress(c, reader).CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	_, err = reader.ReadString('\n')
+	c.Check(err, check.NotNil)
+}
+
+func (s *TaskBridgeTestSuite) TestStreamTaskProgressCleanup(c *check.C) {
+	server, _, progressMgr := s.newServer(c, config.NewConfig())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tasks/task/progress")
+	c.Assert(err, check.IsNil)
+	readProgress(c, bufio.NewReader(resp.Body))
+
+	c.Check(progressMgr.countWatchers(), check.Equals, int32(1))
+
+	// the subscriber is removed after disconnecting
+	resp.Body.Close()
+	for i := 0; i < 100 && progressMgr.countWatchers() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(progressMgr.countWatchers(), check.Equals, int32(0))
+
+	// and the unknown task is rejected before streaming
+	resp, err = http.Get(server.URL + "/tasks/unknown/progress")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusInternalServerError)
+	c.Check(progressMgr.countWatchers(), check.Equals, int32(0))
+}
+
+// pollProgress gets the progress of the task by the long polling.
+func pollProgress(c *check.C, serverURL, query string) *types.TaskProgress {
+	resp, err := http.Get(serverURL + "/tasks/task/progress?" + query)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(resp.Header.Get("Content-Type"), check.Equals, "application/json")
+
+	progress := &types.TaskProgress{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(progress), check.IsNil)
+	return progress
+}
+
+func (s *TaskBridgeTestSuite) TestPollTaskProgress(c *check.C) {
+	server, taskMgr, progressMgr := s.newServer(c, config.NewConfig())
+	defer server.Close()
+	ctx := context.Background()
+
+	// the current progress is responded at once without the since
+	c.Check(pollProgress(c, server.URL, "wait=1m"), check.DeepEquals, &types.TaskProgress{
+		TaskID: "task", CdnStatus: types.TaskInfoCdnStatusRUNNING, PieceTotal: 4,
+	})
+
+	// the unchanged progress is responded after the wait expires
+	start := time.Now()
+	c.Check(pollProgress(c, server.URL, "wait=100ms&since=0").Version, check.Equals, int64(0))
+	c.Check(time.Since(start) >= 100*time.Millisecond, check.Equals, true)
+
+	// and the change is responded once it happens during the wait
+	go func() {
+		for progressMgr.countWatchers() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Check(progressMgr.UpdateProgress(ctx, "task", progressMgr.superCID, "superPID", "", 0, config.PieceSUCCESS, 0), check.IsNil)
+	}()
+	c.Check(pollProgress(c, server.URL, "wait=1m&since=0"), check.DeepEquals, &types.TaskProgress{
+		TaskID: "task", CdnStatus: types.TaskInfoCdnStatusRUNNING, PieceTotal: 4, AvailablePieces: 1, Percent: 25, Version: 1,
+	})
+	c.Check(progressMgr.countWatchers(), check.Equals, int32(0))
+
+	// and the finished progress is responded at once
+	taskMgr.setStatus("task", types.TaskInfoCdnStatusSUCCESS)
+	c.Check(pollProgress(c, server.URL, "wait=1m&since=1").CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+
+	// the invalid wait is rejected
+	resp, err := http.Get(server.URL + "/tasks/task/progress?wait=foo")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusInternalServerError)
+}
+
+func (s *TaskBridgeTestSuite) TestGetSwarmHealth(c *check.C) {
+	server, _, progressMgr := s.newServer(c, config.NewConfig())
+	defer server.Close()
+	ctx := context.Background()
+
+	// peer1 holds the pieces 0,1 and peer2 holds the piece 0 of the 4 pieces.
+	for peerID, pieceNums := range map[string][]int{"peer1": {0, 1}, "peer2": {0}} {
+		c.Assert(progressMgr.InitProgress(ctx, "task", peerID, peerID+"CID"), check.IsNil)
+		for _, pieceNum := range pieceNums {
+			c.Assert(progressMgr.UpdateProgress(ctx, "task", peerID+"CID", peerID, "superPID", pieceNum, config.PieceSUCCESS, 10), check.IsNil)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/tasks/task/swarm-health")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	health := &types.SwarmHealth{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(health), check.IsNil)
+	c.Check(health, check.DeepEquals, &types.SwarmHealth{
+		TaskID:         "task",
+		PieceTotal:     4,
+		HealthySources: 2,
+		MinReplication: 0,
+		AvgReplication: 0.75,
+		Availability:   50,
+	})
+
+	// the unknown task is not found
+	resp, err = http.Get(server.URL + "/tasks/unknown/swarm-health")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusInternalServerError)
+}
+
+func (s *TaskBridgeTestSuite) TestGetTaskEvents(c *check.C) {
+	server, _, progressMgr := s.newServer(c, config.NewConfig())
+	defer server.Close()
+	ctx := context.Background()
+	c.Assert(progressMgr.RecordTaskEvent(ctx, "task", mgr.TaskEventDownloadStarted, ""), check.IsNil)
+	c.Assert(progressMgr.RecordTaskEvent(ctx, "task", mgr.TaskEventFailed, "source error"), check.IsNil)
+
+	resp, err := http.Get(server.URL + "/tasks/task/events")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	var events []*types.TaskEvent
+	c.Assert(json.NewDecoder(resp.Body).Decode(&events), check.IsNil)
+	c.Assert(events, check.HasLen, 3)
+	c.Check(events[0].Type, check.Equals, types.TaskEventTypeRegistered)
+	c.Check(events[1].Type, check.Equals, types.TaskEventTypeDownloadStarted)
+	c.Check(events[2].Type, check.Equals, types.TaskEventTypeFailed)
+	c.Check(events[2].Detail, check.Equals, "source error")
+	for _, event := range events {
+		c.Check(event.Validate(strfmt.Default), check.IsNil)
+	}
+}
+
+func (s *TaskBridgeTestSuite) TestLimitProgressSubscribers(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.MaxTaskSubscribers = 1
+	cfg.RetryAfterBase = 2 * time.Second
+	cfg.RetryAfterJitter = 3 * time.Second
+	server, _, progressMgr := s.newServer(c, cfg)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tasks/task/progress")
+	c.Assert(err, check.IsNil)
+	readProgress(c, bufio.NewReader(resp.Body))
+
+	// the subscriber beyond the limit is told to retry later
+	rejected, err := http.Get(server.URL + "/tasks/task/progress")
+	c.Assert(err, check.IsNil)
+	rejected.Body.Close()
+	c.Check(rejected.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	retryAfter, err := strconv.Atoi(rejected.Header.Get("Retry-After"))
+	c.Assert(err, check.IsNil)
+	c.Check(retryAfter >= 2 && retryAfter <= 5, check.Equals, true)
+
+	// and accepted after the slot is released
+	resp.Body.Close()
+	for i := 0; i < 100 && progressMgr.countWatchers() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, err = http.Get(server.URL + "/tasks/task/progress")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusOK)
+}
+
+// newSupernode creates a supernode with the managers in memory and the store in a temporary directory.
+func (s *TaskBridgeTestSuite) newSupernode(c *check.C, ip string) (*Server, *httptest.Server) {
+	cfg := config.NewConfig()
+	cfg.HomeDir = c.MkDir()
+	cfg.SetCIDPrefix(ip)
+	srv, err := New(cfg, prometheus.NewRegistry())
+	c.Assert(err, check.IsNil)
+
+	resp, err := srv.PeerMgr.Register(context.Background(), &types.PeerCreateRequest{
+		IP:       strfmt.IPv4(ip),
+		HostName: "supernode",
+		Port:     8001,
+	})
+	c.Assert(err, check.IsNil)
+	cfg.SetSuperPID(resp.ID)
+	return srv, httptest.NewServer(initRoute(srv))
+}
+
+func (s *TaskBridgeTestSuite) TestReplicateBetweenSupernodes(c *check.C) {
+	content := strings.Repeat("dragonfly", 100000)
+	lastModified := time.Unix(1500000000, 0).UTC()
+	var originRequests int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&originRequests, 1)
+		http.ServeContent(w, r, "file", lastModified, strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	source, sourceServer := s.newSupernode(c, "127.0.0.1")
+	defer sourceServer.Close()
+	standby, standbyServer := s.newSupernode(c, "127.0.0.2")
+	defer standbyServer.Close()
+	ctx := context.Background()
+
+	// the file is downloaded from the origin by the source supernode
+	body, err := json.Marshal(&types.TaskRegisterRequest{
+		RawURL:   origin.URL + "/file",
+		TaskURL:  origin.URL + "/file",
+		CID:      "127.0.0.3-1-1",
+		IP:       "127.0.0.3",
+		HostName: "dfget",
+		Port:     15001,
+		Path:     "/peer/file/dfget",
+	})
+	c.Assert(err, check.IsNil)
+	resp, err := http.Post(sourceServer.URL+"/peer/registry", "application/json", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	result := &struct {
+		Code int                   `json:"code"`
+		Data *RegisterResponseData `json:"data"`
+	}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(result), check.IsNil)
+	resp.Body.Close()
+	c.Assert(result.Code, check.Equals, constants.Success)
+	taskID := result.Data.TaskID
+
+	task := waitTaskFinished(c, source.TaskMgr, taskID)
+	c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	requests := atomic.LoadInt32(&originRequests)
+
+	// and replicated from the source supernode by the standby one
+	count, err := standby.ReplicaMgr.Replicate(ctx, sourceServer.URL)
+	c.Assert(err, check.IsNil)
+	c.Check(count, check.Equals, 1)
+	c.Check(atomic.LoadInt32(&originRequests), check.Equals, requests)
+
+	cdnStatus, err := standby.CDNMgr.GetStatus(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(cdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+
+	replica, err := standby.CDNMgr.OpenContent(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadAll(replica)
+	replica.Close()
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, content)
+	c.Check(replica.LastModified, check.Equals, lastModified.UnixNano()/int64(time.Millisecond))
+
+	// the file cached by the standby supernode is not replicated again
+	count, err = standby.ReplicaMgr.Replicate(ctx, sourceServer.URL)
+	c.Assert(err, check.IsNil)
+	c.Check(count, check.Equals, 0)
+}
+
+// registerTask registers the client downloading the url to the supernode and returns the taskID.
+func registerTask(c *check.C, serverURL, url, cid string) string {
+	return registerTaskWithRequest(c, serverURL, &types.TaskRegisterRequest{
+		RawURL:   url,
+		TaskURL:  url,
+		CID:      cid,
+		IP:       "127.0.0.3",
+		HostName: "dfget",
+		Port:     15001,
+		Path:     "/peer/file/" + cid,
+	})
+}
+
+// registerTaskWithRequest registers the task with the request and returns the taskID.
+func registerTaskWithRequest(c *check.C, serverURL string, request *types.TaskRegisterRequest) string {
+	body, err := json.Marshal(request)
+	c.Assert(err, check.IsNil)
+	resp, err := http.Post(serverURL+"/peer/registry", "application/json", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	result := &struct {
+		Code int                   `json:"code"`
+		Data *RegisterResponseData `json:"data"`
+	}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(result), check.IsNil)
+	c.Assert(result.Code, check.Equals, constants.Success)
+	return result.Data.TaskID
+}
+
+// waitTaskFinished waits for the CDN of the task to finish and returns the task.
+func waitTaskFinished(c *check.C, taskMgr mgr.TaskMgr, taskID string) *types.TaskInfo {
+	var task *types.TaskInfo
+	for i := 0; i < 500; i++ {
+		task = getTaskCopy(c, taskMgr, taskID)
+		if task.CdnStatus != types.TaskInfoCdnStatusRUNNING && task.CdnStatus != types.TaskInfoCdnStatusWAITING {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return task
+}
+
+// getTaskCopy gets the copy of the task taken by the task manager under the lock of the task,
+// since the task got by taskMgr.Get is updated by the CDN concurrently.
+func getTaskCopy(c *check.C, taskMgr mgr.TaskMgr, taskID string) *types.TaskInfo {
+	tasks, err := taskMgr.List(context.Background(), nil)
+	c.Assert(err, check.IsNil)
+	for _, task := range tasks {
+		if task.ID == taskID {
+			return task
+		}
+	}
+	c.Fatalf("taskID %s not found", taskID)
+	return nil
+}
+
+func (s *TaskBridgeTestSuite) TestMergeIdenticalTasks(c *check.C) {
+	content := strings.Repeat("dragonfly", 100000)
+	lastModified := time.Unix(1500000000, 0).UTC()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", lastModified, strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	ctx := context.Background()
+
+	// the different urls of the same content are downloaded at the same time
+	urls := []string{origin.URL + "/a", origin.URL + "/b"}
+	taskIDs := make([]string, len(urls))
+	var wg sync.WaitGroup
+	for i := range urls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			taskIDs[i] = registerTask(c, server.URL, urls[i], fmt.Sprintf("127.0.0.3-1-%d", i))
+		}(i)
+	}
+	wg.Wait()
+	c.Assert(taskIDs[0], check.Not(check.Equals), taskIDs[1])
+	for _, taskID := range taskIDs {
+		task := waitTaskFinished(c, srv.TaskMgr, taskID)
+		c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	}
+
+	// the tasks share one copy of the content
+	var files []os.FileInfo
+	for _, taskID := range taskIDs {
+		var info os.FileInfo
+		for i := 0; i < 100; i++ {
+			f, err := srv.CDNMgr.OpenFile(ctx, taskID)
+			c.Assert(err, check.IsNil)
+			info, err = f.(*os.File).Stat()
+			f.Close()
+			c.Assert(err, check.IsNil)
+			if len(files) == 0 || os.SameFile(files[0], info) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		files = append(files, info)
+	}
+	c.Check(os.SameFile(files[0], files[1]), check.Equals, true)
+
+	// and the following registrations of both urls join the canonical task
+	canonicalID := registerTask(c, server.URL, urls[0], "127.0.0.3-1-2")
+	c.Check(canonicalID == taskIDs[0] || canonicalID == taskIDs[1], check.Equals, true)
+	c.Check(registerTask(c, server.URL, urls[1], "127.0.0.3-1-3"), check.Equals, canonicalID)
+
+	// the merged task still serves the clients which have registered it
+	for _, taskID := range taskIDs {
+		reader, err := srv.CDNMgr.OpenContent(ctx, taskID)
+		c.Assert(err, check.IsNil)
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		c.Assert(err, check.IsNil)
+		c.Check(string(data) == content, check.Equals, true)
+	}
+}
+
+func (s *TaskBridgeTestSuite) TestProbeOrigin(c *check.C) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader("dragonfly"))
+	}))
+	defer origin.Close()
+	_, server := s.newSupernode(c, "127.0.0.2")
+	defer server.Close()
+
+	probe := func(rawURL string, headers map[string]string) (int, *types.OriginProbeResult) {
+		body, err := json.Marshal(&types.OriginProbeRequest{RawURL: &rawURL, Headers: headers})
+		c.Assert(err, check.IsNil)
+		resp, err := http.Post(server.URL+"/origin/probe", "application/json", bytes.NewReader(body))
+		c.Assert(err, check.IsNil)
+		defer resp.Body.Close()
+		result := &types.OriginProbeResult{}
+		c.Assert(json.NewDecoder(resp.Body).Decode(result), check.IsNil)
+		return resp.StatusCode, result
+	}
+
+	// the reachable source is probed with its size
+	code, result := probe(origin.URL+"/file", map[string]string{"Authorization": "Bearer token"})
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Check(result.Success, check.Equals, true)
+	c.Check(result.ContentLength, check.Equals, int64(len("dragonfly")))
+	c.Check(result.SupportRange, check.Equals, true)
+
+	// and the one rejecting the credentials is reported as an auth failure
+	code, result = probe(origin.URL+"/file", map[string]string{"Authorization": "Bearer expired"})
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Check(result.Success, check.Equals, false)
+	c.Check(result.Failure, check.Equals, types.OriginProbeResultFailureAuth)
+	c.Check(result.StatusCode, check.Equals, int64(http.StatusUnauthorized))
+
+	// while the invalid url is rejected
+	code, _ = probe("foo", nil)
+	c.Check(code, check.Not(check.Equals), http.StatusOK)
+}
+
+// pausableOrigin stalls the plain download of the content after the first part until the request is aborted,
+// and serves the range and conditional requests entirely.
+type pausableOrigin struct {
+	content      []byte
+	firstPart    int
+	lastModified time.Time
+	stop         chan struct{}
+
+	sync.Mutex
+	ranges []string
+}
+
+func (po *pausableOrigin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.Header.Get("Range") != "" || r.Header.Get("If-Modified-Since") != "" {
+		po.Lock()
+		po.ranges = append(po.ranges, r.Header.Get("Range"))
+		po.Unlock()
+		http.ServeContent(w, r, "file", po.lastModified, bytes.NewReader(po.content))
+		return
+	}
+
+	w.Header().Set("Last-Modified", po.lastModified.Format(http.TimeFormat))
+	w.Header().Set("Content-Length", strconv.Itoa(len(po.content)))
+	w.Write(po.content[:po.firstPart])
+	w.(http.Flusher).Flush()
+	select {
+	case <-po.stop:
+	case <-r.Context().Done():
+	}
+}
+
+func (po *pausableOrigin) getRanges() []string {
+	po.Lock()
+	defer po.Unlock()
+	return append([]string(nil), po.ranges...)
+}
+
+func (s *TaskBridgeTestSuite) TestPauseAndResumeTask(c *check.C) {
+	// the header of the piece smaller than 1MB can't be parsed to resume the download.
+	const pieceSize = 1024 * 1024
+	const pieceContSize = pieceSize - config.PieceWrapSize
+	content := make([]byte, 4*pieceContSize-10)
+	rand.New(rand.NewSource(1)).Read(content)
+	origin := &pausableOrigin{content: content, firstPart: 2*pieceContSize + 100, lastModified: time.Unix(1500000000, 0).UTC(),
+		stop: make(chan struct{})}
+	originServer := httptest.NewServer(origin)
+	defer originServer.Close()
+	defer close(origin.stop)
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	srv.Config.PieceSize = pieceSize
+	ctx := context.Background()
+	taskID := registerTask(c, server.URL, originServer.URL+"/file", "127.0.0.3-1-1")
+
+	// the task can't be resumed unless it's paused
+	resp, err := http.Post(server.URL+"/tasks/"+taskID+"/resume", "application/json", nil)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Not(check.Equals), http.StatusOK)
+
+	for i := 0; i < 500; i++ {
+		if count, _ := srv.ProgressMgr.GetSuperPieceCount(ctx, taskID); count >= 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, err = http.Post(server.URL+"/tasks/"+taskID+"/pause", "application/json", nil)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+
+	// the paused task keeps running with the pieces downloaded, and releases the concurrency of the source
+	for i := 0; i < 500; i++ {
+		if _, inFlight := srv.CDNMgr.GetOriginConcurrency(ctx); inFlight == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, inFlight := srv.CDNMgr.GetOriginConcurrency(ctx)
+	c.Check(inFlight, check.Equals, 0)
+	task := getTaskCopy(c, srv.TaskMgr, taskID)
+	c.Check(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusRUNNING)
+	count, err := srv.ProgressMgr.GetSuperPieceCount(ctx, taskID)
+	c.Assert(err, check.IsNil)
+	c.Check(count, check.Equals, 2)
+	code, _, body := getRange(c, server.URL, taskID, "bytes=10-1000")
+	c.Check(code, check.Equals, http.StatusPartialContent)
+	c.Check(body, check.DeepEquals, content[10:1001])
+
+	// the resumed task continues the download from the pieces downloaded
+	resp, err = http.Post(server.URL+"/tasks/"+taskID+"/resume", "application/json", nil)
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	task = waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	ranges := origin.getRanges()
+	c.Assert(len(ranges) > 0, check.Equals, true)
+	c.Check(ranges[len(ranges)-1], check.Equals, fmt.Sprintf("bytes=%d-%d", 2*pieceContSize, len(content)-1))
+
+	resp, err = http.Get(server.URL + "/tasks/" + taskID + "/content")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(data, check.DeepEquals, content)
+}
+
+func (s *TaskBridgeTestSuite) TestTaskCacheStats(c *check.C) {
+	content := strings.Repeat("dragonfly", 1000)
+	lastModified := time.Unix(1500000000, 0).UTC()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", lastModified, strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	getCacheStats := func(taskID string) *types.TaskCacheStats {
+		resp, err := http.Get(server.URL + "/tasks/" + taskID)
+		c.Assert(err, check.IsNil)
+		defer resp.Body.Close()
+		c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+		task := &types.TaskInfo{}
+		c.Assert(json.NewDecoder(resp.Body).Decode(task), check.IsNil)
+		c.Assert(task.CacheStats, check.NotNil)
+		return task.CacheStats
+	}
+
+	// the first registration triggers the download from the origin
+	taskID := registerTask(c, server.URL, origin.URL+"/file", "127.0.0.3-1-1")
+	task := waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	c.Check(getCacheStats(taskID), check.DeepEquals, &types.TaskCacheStats{Misses: 1})
+
+	// and the following ones attach to the content downloaded
+	registerTask(c, server.URL, origin.URL+"/file", "127.0.0.3-1-2")
+	registerTask(c, server.URL, origin.URL+"/file", "127.0.0.3-1-3")
+	stats := getCacheStats(taskID)
+	c.Check(stats.Hits, check.Equals, int64(2))
+	c.Check(stats.RevalidationHits, check.Equals, int64(0))
+	c.Check(stats.Misses, check.Equals, int64(1))
+	c.Check(stats.HitRatio > 0.66 && stats.HitRatio < 0.67, check.Equals, true)
+
+	// the task registered again reuses the cached file after the origin responds 304
+	c.Assert(srv.TaskMgr.Delete(context.Background(), taskID), check.IsNil)
+	registerTask(c, server.URL, origin.URL+"/file", "127.0.0.3-1-4")
+	task = waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	c.Check(getCacheStats(taskID), check.DeepEquals, &types.TaskCacheStats{RevalidationHits: 1, HitRatio: 1})
+}
+
+func (s *TaskBridgeTestSuite) TestEvictCorruptedTaskOnRead(c *check.C) {
+	content := strings.Repeat("dragonfly", 100000)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, server := s.newSupernode(c, "127.0.0.1")
+	defer server.Close()
+	srv.Config.VerifyOnRead = true
+	taskID := registerTask(c, server.URL, origin.URL+"/file", "127.0.0.3-1-1")
+	task := waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	code, _, body := getRange(c, server.URL, taskID, "bytes=0-99")
+	c.Check(code, check.Equals, http.StatusPartialContent)
+	c.Check(string(body), check.Equals, content[:100])
+
+	// the stored bytes are corrupted on disk
+	file, err := os.OpenFile(filepath.Join(srv.Config.HomeDir, "repo", config.DownloadHome, taskID[:3], taskID), os.O_WRONLY, 0644)
+	c.Assert(err, check.IsNil)
+	_, err = file.WriteAt([]byte("corrupted"), int64(config.PieceHeadSize+10))
+	file.Close()
+	c.Assert(err, check.IsNil)
+
+	// the response of the corrupted piece is cut short and the task is evicted
+	resp, err := http.Get(server.URL + "/tasks/" + taskID + "/content")
+	c.Assert(err, check.IsNil)
+	_, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Check(err, check.NotNil)
+	_, err = srv.TaskMgr.Get(context.Background(), taskID)
+	c.Check(errortypes.IsDataNotFound(err), check.Equals, true)
+
+	// the next registration downloads the file from source again
+	taskID = registerTask(c, server.URL, origin.URL+"/file", "127.0.0.3-1-2")
+	task = waitTaskFinished(c, srv.TaskMgr, taskID)
+	c.Assert(task.CdnStatus, check.Equals, types.TaskInfoCdnStatusSUCCESS)
+	resp, err = http.Get(server.URL + "/tasks/" + taskID + "/content")
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, content)
+}
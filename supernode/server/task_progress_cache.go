@@ -0,0 +1,195 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+)
+
+// taskProgressCache shares the progress of the tasks among their subscribers, so that
+// the progress of a task is computed once per change and fanned out to all the subscribers
+// of it rather than computed by each of them.
+// The changes of a task after its progress has been computed are coalesced until the next
+// tick of the ticker, which is run from start to stop with the server.
+type taskProgressCache struct {
+	// interval is the interval of the ticker, and the changes are not coalesced without it.
+	interval time.Duration
+
+	mu sync.Mutex
+	// entries contains the progress of the tasks being subscribed.
+	// key:taskID,value:*taskProgressEntry
+	entries map[string]*taskProgressEntry
+	// stopCh is closed to stop the ticker, which is nil if the ticker is not running.
+	stopCh chan struct{}
+}
+
+// taskProgressEntry is the progress of a task shared by its subscribers.
+type taskProgressEntry struct {
+	mu sync.Mutex
+	// refs is the number of the subscribers sharing the entry.
+	refs     int
+	progress *types.TaskProgress
+	// coalesce indicates whether the changes are coalesced until the next tick.
+	coalesce bool
+	// computed indicates whether the progress has been computed since the last tick.
+	computed bool
+	// ticked is closed on the next tick to wake up the subscribers waiting for it.
+	ticked chan struct{}
+}
+
+func newTaskProgressCache(interval time.Duration) *taskProgressCache {
+	return &taskProgressCache{
+		interval: interval,
+		entries:  make(map[string]*taskProgressEntry),
+	}
+}
+
+// start runs the ticker of the cache in the background if the interval is greater than 0.
+func (pc *taskProgressCache) start() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.interval <= 0 || pc.stopCh != nil {
+		return
+	}
+	stopCh := make(chan struct{})
+	pc.stopCh = stopCh
+
+	go func() {
+		ticker := time.NewTicker(pc.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				pc.tick(false)
+			}
+		}
+	}()
+}
+
+// stop stops the ticker of the cache, and the changes are no longer coalesced after it.
+func (pc *taskProgressCache) stop() {
+	pc.mu.Lock()
+	if pc.stopCh == nil {
+		pc.mu.Unlock()
+		return
+	}
+	close(pc.stopCh)
+	pc.stopCh = nil
+	pc.mu.Unlock()
+
+	// wake up the subscribers waiting for the tick which never comes
+	pc.tick(true)
+}
+
+// tick wakes up the subscribers waiting for the coalesced changes of the tasks.
+func (pc *taskProgressCache) tick(stopped bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for _, entry := range pc.entries {
+		entry.tick(stopped)
+	}
+}
+
+// acquire returns the entry of the task shared by its subscribers and the function to release it,
+// and the entry is removed once it's released by all the subscribers.
+func (pc *taskProgressCache) acquire(taskID string) (*taskProgressEntry, func()) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	entry, ok := pc.entries[taskID]
+	if !ok {
+		entry = &taskProgressEntry{coalesce: pc.stopCh != nil}
+		pc.entries[taskID] = entry
+	}
+	entry.refs++
+
+	var once sync.Once
+	return entry, func() {
+		once.Do(func() {
+			pc.release(taskID, entry)
+		})
+	}
+}
+
+func (pc *taskProgressCache) release(taskID string, entry *taskProgressEntry) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	entry.refs--
+	if entry.refs == 0 && pc.entries[taskID] == entry {
+		delete(pc.entries, taskID)
+	}
+}
+
+// get returns the progress of the version, which is computed only if the shared one is of another
+// version and it has not been computed since the last tick. Otherwise the shared one is returned
+// with the channel closed on the next tick, after which the progress can be computed again.
+func (e *taskProgressEntry) get(version int64,
+	compute func() (*types.TaskProgress, error)) (*types.TaskProgress, <-chan struct{}, error) {
+	// the subscribers getting the progress at the same time wait for the one computing it
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.progress != nil {
+		if e.progress.Version == version {
+			progress := *e.progress
+			return &progress, nil, nil
+		}
+		if e.coalesce && e.computed {
+			if e.ticked == nil {
+				e.ticked = make(chan struct{})
+			}
+			progress := *e.progress
+			return &progress, e.ticked, nil
+		}
+	}
+
+	computed, err := compute()
+	if err != nil {
+		return nil, nil, err
+	}
+	e.progress, e.computed = computed, true
+	progress := *computed
+	return &progress, nil, nil
+}
+
+func (e *taskProgressEntry) tick(stopped bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if stopped {
+		e.coalesce = false
+	}
+	e.computed = false
+	if e.ticked != nil {
+		close(e.ticked)
+		e.ticked = nil
+	}
+}
+
+// getSharedTaskProgress gets the progress of the task shared by its subscribers with the entry.
+// The progress may be older than the latest change if it has been computed since the last tick
+// of the progress cache, and the channel closed on the next tick is returned to get it again.
+func (s *Server) getSharedTaskProgress(ctx context.Context, id string, entry *taskProgressEntry) (*types.TaskProgress, <-chan struct{}, error) {
+	version := s.ProgressMgr.GetTaskVersion(ctx, id)
+	return entry.get(version, func() (*types.TaskProgress, error) {
+		return s.getTaskProgress(ctx, id)
+	})
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+
+	"github.com/go-check/check"
+)
+
+func init() {
+	check.Suite(&TaskProgressCacheTestSuite{})
+}
+
+type TaskProgressCacheTestSuite struct{}
+
+// burstProgress changes the version of the progress for the changes times,
+// and each of the subscribers gets the progress on every change.
+// It returns the number of the computations.
+func burstProgress(c *check.C, subscribers, changes int, interval time.Duration) int32 {
+	pc := newTaskProgressCache(interval)
+	pc.start()
+	defer pc.stop()
+	var computed int32
+	var version int64
+	compute := func() (*types.TaskProgress, error) {
+		atomic.AddInt32(&computed, 1)
+		return &types.TaskProgress{TaskID: "task", Version: atomic.LoadInt64(&version)}, nil
+	}
+
+	entries := make([]*taskProgressEntry, 0, subscribers)
+	for j := 0; j < subscribers; j++ {
+		entry, release := pc.acquire("task")
+		defer release()
+		entries = append(entries, entry)
+	}
+	c.Check(pc.entries, check.HasLen, 1)
+
+	for i := 0; i < changes; i++ {
+		atomic.AddInt64(&version, 1)
+		var wg sync.WaitGroup
+		for _, entry := range entries {
+			wg.Add(1)
+			go func(entry *taskProgressEntry) {
+				defer wg.Done()
+				_, _, err := entry.get(atomic.LoadInt64(&version), compute)
+				c.Check(err, check.IsNil)
+			}(entry)
+		}
+		wg.Wait()
+	}
+	return atomic.LoadInt32(&computed)
+}
+
+func (s *TaskProgressCacheTestSuite) TestReleaseEntry(c *check.C) {
+	pc := newTaskProgressCache(0)
+	entry1, release1 := pc.acquire("task")
+	entry2, release2 := pc.acquire("task")
+	c.Check(entry1 == entry2, check.Equals, true)
+
+	// the entry is removed after it's released by all the subscribers
+	release1()
+	release1()
+	c.Check(pc.entries, check.HasLen, 1)
+	release2()
+	c.Check(pc.entries, check.HasLen, 0)
+}
+
+func (s *TaskProgressCacheTestSuite) TestComputeOncePerChange(c *check.C) {
+	// the progress is computed once per change regardless of the number of the subscribers
+	for _, subscribers := range []int{1, 10, 100} {
+		c.Check(burstProgress(c, subscribers, 100, 0), check.Equals, int32(100),
+			check.Commentf("subscribers: %d", subscribers))
+	}
+}
+
+func (s *TaskProgressCacheTestSuite) TestCoalesceChangesWithinInterval(c *check.C) {
+	// the burst of the changes within the interval is coalesced into the first computation
+	for _, subscribers := range []int{1, 10, 100} {
+		c.Check(burstProgress(c, subscribers, 100, time.Hour), check.Equals, int32(1),
+			check.Commentf("subscribers: %d", subscribers))
+	}
+}
+
+func (s *TaskProgressCacheTestSuite) TestGetAfterTick(c *check.C) {
+	pc := newTaskProgressCache(50 * time.Millisecond)
+	pc.start()
+	defer pc.stop()
+	entry, release := pc.acquire("task")
+	defer release()
+	compute := func(version int64) func() (*types.TaskProgress, error) {
+		return func() (*types.TaskProgress, error) {
+			return &types.TaskProgress{TaskID: "task", Version: version}, nil
+		}
+	}
+
+	progress, ticked, err := entry.get(0, compute(0))
+	c.Assert(err, check.IsNil)
+	c.Check(progress.Version, check.Equals, int64(0))
+	c.Check(ticked, check.IsNil)
+
+	// the shared progress is returned with the channel closed on the next tick
+	progress, ticked, err = entry.get(1, compute(1))
+	c.Assert(err, check.IsNil)
+	c.Check(progress.Version, check.Equals, int64(0))
+	c.Assert(ticked, check.NotNil)
+
+	// and the progress is computed after the tick
+	select {
+	case <-ticked:
+	case <-time.After(time.Second):
+		c.Fatal("the tick never comes")
+	}
+	progress, ticked, err = entry.get(1, compute(1))
+	c.Assert(err, check.IsNil)
+	c.Check(progress.Version, check.Equals, int64(1))
+	c.Check(ticked, check.IsNil)
+}
+
+func (s *TaskProgressCacheTestSuite) TestStopWakesSubscribers(c *check.C) {
+	pc := newTaskProgressCache(time.Hour)
+	pc.start()
+	entry, release := pc.acquire("task")
+	defer release()
+	compute := func() (*types.TaskProgress, error) {
+		return &types.TaskProgress{TaskID: "task"}, nil
+	}
+
+	_, _, err := entry.get(0, compute)
+	c.Assert(err, check.IsNil)
+	_, ticked, err := entry.get(1, compute)
+	c.Assert(err, check.IsNil)
+	c.Assert(ticked, check.NotNil)
+
+	// the subscribers waiting for the tick are woken up once the cache stops,
+	// and the changes are no longer coalesced after it
+	pc.stop()
+	select {
+	case <-ticked:
+	default:
+		c.Fatal("the subscribers are not woken up")
+	}
+	_, ticked, err = entry.get(1, compute)
+	c.Assert(err, check.IsNil)
+	c.Check(ticked, check.IsNil)
+}
+
+func (s *TaskProgressCacheTestSuite) TestStreamBurstOfPieces(c *check.C) {
+	cfg := config.NewConfig()
+	cfg.ProgressRecomputeInterval = 200 * time.Millisecond
+	server, taskMgr, progressMgr := (&TaskBridgeTestSuite{}).newServer(c, cfg)
+	defer server.Close()
+	ctx := context.Background()
+
+	readers := make([]*bufio.Reader, 0)
+	for i := 0; i < 20; i++ {
+		resp, err := http.Get(server.URL + "/tasks/task/progress")
+		c.Assert(err, check.IsNil)
+		defer resp.Body.Close()
+		reader := bufio.NewReader(resp.Body)
+		readProgress(c, reader)
+		readers = append(readers, reader)
+	}
+	c.Check(taskMgr.countGets(), check.Equals, int32(1))
+
+	// all the subscribers receive the latest progress after the burst of the piece completions
+	for pieceNum := 0; pieceNum < 4; pieceNum++ {
+		c.Assert(progressMgr.UpdateProgress(ctx, "task", progressMgr.superCID, "superPID", "", pieceNum, config.PieceSUCCESS, 0), check.IsNil)
+	}
+	for _, reader := range readers {
+		progress := readProgress(c, reader)
+		for progress.AvailablePieces < 4 {
+			progress = readProgress(c, reader)
+		}
+	}
+	c.Check(taskMgr.countGets() <= 3, check.Equals, true, check.Commentf("gets: %d", taskMgr.countGets()))
+}
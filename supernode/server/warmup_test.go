@@ -0,0 +1,81 @@
+/*
+ * Copyright The Dragonfly Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dragonflyoss/Dragonfly/apis/types"
+	"github.com/dragonflyoss/Dragonfly/supernode/config"
+	"github.com/dragonflyoss/Dragonfly/supernode/daemon/mgr/task"
+
+	"github.com/go-check/check"
+)
+
+func (s *TaskBridgeTestSuite) TestWarmupOnStart(c *check.C) {
+	content := strings.Repeat("dragonfly", 100000)
+	var downloads int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&downloads, 1)
+		}
+		http.ServeContent(w, r, "file", time.Unix(1500000000, 0), strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	srv, ts := s.newSupernode(c, "127.0.0.1")
+	defer ts.Close()
+	srv.Config.WarmupTasks = []config.WarmupTask{
+		{URL: "invalid-url"},
+		{URL: origin.URL + "/unauthorized"},
+		{URL: origin.URL + "/file", Headers: map[string]string{"Authorization": "Bearer token"}},
+	}
+	// Start warms up the tasks in the background before serving
+	srv.warmup()
+
+	var tasks []*types.TaskInfo
+	for i := 0; i < 500 && len(tasks) == 0; i++ {
+		var err error
+		tasks, err = srv.TaskMgr.List(context.Background(), map[string]string{
+			"tag":       task.WarmupTag,
+			"cdnStatus": types.TaskInfoCdnStatusSUCCESS,
+		})
+		c.Assert(err, check.IsNil)
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(tasks, check.HasLen, 1)
+	c.Check(tasks[0].RawURL, check.Equals, origin.URL+"/file")
+	c.Check(tasks[0].HTTPFileLength, check.Equals, int64(len(content)))
+	c.Check(atomic.LoadInt32(&downloads) > 0, check.Equals, true)
+
+	// the warmed up file is served without downloading it again
+	downloaded := atomic.LoadInt32(&downloads)
+	resp, err := http.Get(ts.URL + "/tasks/" + tasks[0].ID + "/content")
+	c.Assert(err, check.IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Check(atomic.LoadInt32(&downloads), check.Equals, downloaded)
+}
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/dragonflyoss/Dragonfly/pkg/fileutils"
 	statutils "github.com/dragonflyoss/Dragonfly/pkg/stat"
@@ -210,7 +211,12 @@ func (ls *localStorage) PutBytes(ctx context.Context, raw *Raw, data []byte) err
 	lock(path, raw.Offset, false)
 	defer unLock(path, raw.Offset, false)
 
-	f, err := fileutils.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_SYNC, 0644)
+	// the whole content replaces the previous one which may be longer.
+	flag := os.O_WRONLY | os.O_CREATE | os.O_SYNC
+	if raw.Offset == 0 && raw.Length == 0 {
+		flag |= os.O_TRUNC
+	}
+	f, err := fileutils.OpenFile(path, flag, 0644)
 	if err != nil {
 		return err
 	}
@@ -230,6 +236,18 @@ func (ls *localStorage) PutBytes(ctx context.Context, raw *Raw, data []byte) err
 	return nil
 }
 
+// Open opens the file of key for reading.
+//
+// NOTE: the file is not locked, so the caller should not read the range
+// that is being written by the others.
+func (ls *localStorage) Open(ctx context.Context, raw *Raw) (*os.File, error) {
+	path, _, err := ls.statPath(raw.Bucket, raw.Key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
 // Stat determine whether the file exists.
 func (ls *localStorage) Stat(ctx context.Context, raw *Raw) (*StorageInfo, error) {
 	_, fileInfo, err := ls.statPath(raw.Bucket, raw.Key)
@@ -262,6 +280,72 @@ func (ls *localStorage) Remove(ctx context.Context, raw *Raw) error {
 	return os.RemoveAll(path)
 }
 
+// Link makes the file of dst a hard link to the file of src.
+// The link is created aside and renamed to dst, so the file of dst which
+// has been opened by the readers is kept until they close it.
+func (ls *localStorage) Link(ctx context.Context, src, dst *Raw) error {
+	srcPath, _, err := ls.statPath(src.Bucket, src.Key)
+	if err != nil {
+		return err
+	}
+	dstPath, err := ls.preparePath(dst.Bucket, dst.Key)
+	if err != nil {
+		return err
+	}
+	if err := fileutils.CreateDirectory(path.Dir(dstPath)); err != nil {
+		return err
+	}
+
+	lock(dstPath, -1, false)
+	defer unLock(dstPath, -1, false)
+
+	tmpPath := dstPath + ".link"
+	if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(srcPath, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// Walk calls fn for each file under the dir of raw.Key in the bucket.
+// Nothing is visited if the dir doesn't exist.
+func (ls *localStorage) Walk(ctx context.Context, raw *Raw, fn WalkFunc) error {
+	bucketDir := path.Join(ls.BaseDir, raw.Bucket)
+	root := path.Join(bucketDir, raw.Key)
+	err := filepath.Walk(root, func(filePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !fileInfo.Mode().IsRegular() {
+			return nil
+		}
+
+		key, err := filepath.Rel(bucketDir, filePath)
+		if err != nil {
+			return err
+		}
+		info := &StorageInfo{
+			Path:    path.Join(raw.Bucket, key),
+			Size:    fileInfo.Size(),
+			ModTime: fileInfo.ModTime(),
+		}
+		if sys, ok := fileutils.GetSys(fileInfo); ok {
+			info.CreateTime = statutils.Ctime(sys)
+		}
+		return fn(filepath.ToSlash(key), info)
+	})
+	return err
+}
+
 // helper function
 
 // preparePath gets the target path and creates the upper directory if it does not exist.
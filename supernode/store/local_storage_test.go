@@ -176,6 +176,23 @@ func (s *LocalStorageSuite) TestGetPutBytes(c *check.C) {
 
 }
 
+func (s *LocalStorageSuite) TestPutBytesReplacesLongerContent(c *check.C) {
+	raw := &Raw{Key: "shrink"}
+	defer s.checkRemove(raw, c)
+	c.Assert(s.storeLocal.PutBytes(context.Background(), raw, []byte("hello dragonfly")), check.IsNil)
+
+	// the whole content replaces the longer one
+	c.Assert(s.storeLocal.PutBytes(context.Background(), raw, []byte("hello")), check.IsNil)
+	result, err := s.storeLocal.GetBytes(context.Background(), raw)
+	c.Assert(err, check.IsNil)
+	c.Check(string(result), check.Equals, "hello")
+
+	// while the content written at the offset overwrites the part of it
+	c.Assert(s.storeLocal.PutBytes(context.Background(), &Raw{Key: "shrink", Offset: 1}, []byte("E")), check.IsNil)
+	result, err = s.storeLocal.GetBytes(context.Background(), raw)
+	c.Assert(err, check.IsNil)
+	c.Check(string(result), check.Equals, "hEllo")
+}
 func (s *LocalStorageSuite) TestGetPut(c *check.C) {
 	var cases = []struct {
 		putRaw      *Raw
@@ -364,3 +381,105 @@ func (s *LocalStorageSuite) checkRemove(raw *Raw, c *check.C) {
 	_, err = s.storeLocal.Stat(context.Background(), raw)
 	c.Assert(IsKeyNotFound(err), check.Equals, true)
 }
+
+// copyOnlyDriver hides the FileDriver implementation of the underlying driver.
+type copyOnlyDriver struct {
+	StorageDriver
+}
+
+func (s *LocalStorageSuite) TestOpen(c *check.C) {
+	raw := &Raw{Bucket: "open", Key: "foo"}
+	c.Assert(s.storeLocal.PutBytes(context.TODO(), raw, []byte("hello dragonfly")), check.IsNil)
+
+	copyStore, err := NewStore("copy", func(conf string) (StorageDriver, error) {
+		return &copyOnlyDriver{s.storeLocal.driver}, nil
+	}, "")
+	c.Assert(err, check.IsNil)
+
+	for _, st := range []*Store{s.storeLocal, copyStore} {
+		f, err := st.Open(context.TODO(), raw)
+		c.Assert(err, check.IsNil)
+		_, isFile := f.(*os.File)
+		c.Check(isFile, check.Equals, st == s.storeLocal)
+
+		buf := make([]byte, 9)
+		n, err := f.ReadAt(buf, 6)
+		c.Check(err, check.IsNil)
+		c.Check(string(buf[:n]), check.Equals, "dragonfly")
+
+		pos, err := f.Seek(-3, io.SeekEnd)
+		c.Check(err, check.IsNil)
+		c.Check(pos, check.Equals, int64(12))
+		data, err := ioutil.ReadAll(f)
+		c.Check(err, check.IsNil)
+		c.Check(string(data), check.Equals, "fly")
+		c.Check(f.Close(), check.IsNil)
+
+		_, err = st.Open(context.TODO(), &Raw{Bucket: "open", Key: "bar"})
+		c.Check(IsKeyNotFound(err), check.Equals, true)
+	}
+}
+
+func (s *LocalStorageSuite) TestLink(c *check.C) {
+	src := &Raw{Bucket: "link", Key: "src/foo"}
+	dst := &Raw{Bucket: "link", Key: "dst/foo"}
+	c.Assert(s.storeLocal.PutBytes(context.TODO(), src, []byte("hello dragonfly")), check.IsNil)
+	c.Assert(s.storeLocal.PutBytes(context.TODO(), dst, []byte("hello supernode")), check.IsNil)
+
+	opened, err := s.storeLocal.Open(context.TODO(), dst)
+	c.Assert(err, check.IsNil)
+	defer opened.Close()
+
+	c.Assert(s.storeLocal.Link(context.TODO(), src, dst), check.IsNil)
+	data, err := s.storeLocal.GetBytes(context.TODO(), dst)
+	c.Check(err, check.IsNil)
+	c.Check(string(data), check.Equals, "hello dragonfly")
+
+	// the readers which have opened dst are not affected
+	data, err = ioutil.ReadAll(opened)
+	c.Check(err, check.IsNil)
+	c.Check(string(data), check.Equals, "hello supernode")
+
+	// dst is kept after src is removed
+	c.Assert(s.storeLocal.Remove(context.TODO(), src), check.IsNil)
+	data, err = s.storeLocal.GetBytes(context.TODO(), dst)
+	c.Check(err, check.IsNil)
+	c.Check(string(data), check.Equals, "hello dragonfly")
+
+	err = s.storeLocal.Link(context.TODO(), src, dst)
+	c.Check(IsKeyNotFound(err), check.Equals, true)
+
+	copyStore, err := NewStore("copy", func(conf string) (StorageDriver, error) {
+		return &copyOnlyDriver{s.storeLocal.driver}, nil
+	}, "")
+	c.Assert(err, check.IsNil)
+	err = copyStore.Link(context.TODO(), dst, src)
+	c.Check(IsNotSupported(err), check.Equals, true)
+}
+
+func (s *LocalStorageSuite) TestWalk(c *check.C) {
+	for _, key := range []string{"a/foo", "a/bar", "b/foo"} {
+		c.Assert(s.storeLocal.PutBytes(context.TODO(), &Raw{Bucket: "walk", Key: key}, []byte(key)), check.IsNil)
+	}
+
+	walk := func(raw *Raw) map[string]int64 {
+		visited := make(map[string]int64)
+		err := s.storeLocal.Walk(context.TODO(), raw, func(key string, info *StorageInfo) error {
+			c.Check(info.Path, check.Equals, path.Join(raw.Bucket, key))
+			visited[key] = info.Size
+			return nil
+		})
+		c.Assert(err, check.IsNil)
+		return visited
+	}
+	c.Check(walk(&Raw{Bucket: "walk"}), check.DeepEquals, map[string]int64{"a/foo": 5, "a/bar": 5, "b/foo": 5})
+	c.Check(walk(&Raw{Bucket: "walk", Key: "a"}), check.DeepEquals, map[string]int64{"a/foo": 5, "a/bar": 5})
+	c.Check(walk(&Raw{Bucket: "walk", Key: "c"}), check.DeepEquals, map[string]int64{})
+
+	copyStore, err := NewStore("copy", func(conf string) (StorageDriver, error) {
+		return &copyOnlyDriver{s.storeLocal.driver}, nil
+	}, "")
+	c.Assert(err, check.IsNil)
+	err = copyStore.Walk(context.TODO(), &Raw{Bucket: "walk"}, func(key string, info *StorageInfo) error { return nil })
+	c.Check(IsNotSupported(err), check.Equals, true)
+}
@@ -19,6 +19,7 @@ package store
 import (
 	"context"
 	"io"
+	"os"
 	"time"
 )
 
@@ -59,6 +60,46 @@ type StorageDriver interface {
 	Stat(ctx context.Context, raw *Raw) (*StorageInfo, error)
 }
 
+// FileDriver is an optional interface implemented by the storage driver
+// which stores the data in local files.
+//
+// The data opened as a file can be read at random offsets directly,
+// and be sent to the network with sendfile without copying through the user space.
+type FileDriver interface {
+	// Open opens the file which holds the data identified by raw.Bucket and raw.Key for reading.
+	// The raw.Offset and raw.Length are ignored.
+	Open(ctx context.Context, raw *Raw) (*os.File, error)
+}
+
+// LinkDriver is an optional interface implemented by the storage driver
+// which can share the same data between the keys without copying it.
+type LinkDriver interface {
+	// Link makes the data identified by dst share the data identified by src.
+	// The existing data of dst is replaced atomically, so that the readers
+	// which have opened it are not affected.
+	Link(ctx context.Context, src, dst *Raw) error
+}
+
+// WalkFunc is called for each data visited by the Walk with the key of the data
+// relative to the bucket. The walk stops if it returns an error.
+type WalkFunc func(key string, info *StorageInfo) error
+
+// WalkDriver is an optional interface implemented by the storage driver
+// which can enumerate the data stored in it.
+type WalkDriver interface {
+	// Walk calls fn for each data in raw.Bucket whose key is under raw.Key,
+	// and all the data in the bucket are visited if raw.Key is empty.
+	Walk(ctx context.Context, raw *Raw, fn WalkFunc) error
+}
+
+// File is the data opened for reading at random offsets.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
 // Raw identifies a piece of data uniquely.
 // If the length<=0, it represents all data.
 type Raw struct {
@@ -117,6 +117,60 @@ func (s *Store) Stat(ctx context.Context, raw *Raw) (*StorageInfo, error) {
 	return s.driver.Stat(ctx, raw)
 }
 
+// Link makes the data identified by dst share the data identified by src,
+// and it returns ErrNotSupported if the driver doesn't implement the LinkDriver.
+func (s *Store) Link(ctx context.Context, src, dst *Raw) error {
+	if err := checkEmptyKey(src); err != nil {
+		return err
+	}
+	if err := checkEmptyKey(dst); err != nil {
+		return err
+	}
+	ld, ok := s.driver.(LinkDriver)
+	if !ok {
+		return errors.Wrapf(ErrNotSupported, "link of the driver %s", s.driverName)
+	}
+	return ld.Link(ctx, src, dst)
+}
+
+// Open opens the data identified by raw.Bucket and raw.Key for reading at random offsets.
+// The file of the driver will be returned if the driver implements the FileDriver,
+// otherwise the data will be read from the driver with GetBytes and copied.
+// The caller should close the returned File after reading.
+func (s *Store) Open(ctx context.Context, raw *Raw) (File, error) {
+	if err := checkEmptyKey(raw); err != nil {
+		return nil, err
+	}
+	if fd, ok := s.driver.(FileDriver); ok {
+		return fd.Open(ctx, raw)
+	}
+
+	info, err := s.driver.Stat(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &copyFile{
+		ctx:    ctx,
+		driver: s.driver,
+		bucket: raw.Bucket,
+		key:    raw.Key,
+		size:   info.Size,
+	}, nil
+}
+
+// Walk calls fn for each data in raw.Bucket whose key is under raw.Key,
+// and it returns ErrNotSupported if the driver doesn't implement the WalkDriver.
+func (s *Store) Walk(ctx context.Context, raw *Raw, fn WalkFunc) error {
+	if raw == nil || stringutils.IsEmptyStr(raw.Bucket) {
+		return errors.Wrapf(ErrEmptyKey, "cannot walk with the bucket empty")
+	}
+	wd, ok := s.driver.(WalkDriver)
+	if !ok {
+		return errors.Wrapf(ErrNotSupported, "walk of the driver %s", s.driverName)
+	}
+	return wd.Walk(ctx, raw, fn)
+}
+
 func checkEmptyKey(raw *Raw) error {
 	if raw == nil || stringutils.IsEmptyStr(raw.Key) {
 		return ErrEmptyKey
@@ -124,3 +178,72 @@ func checkEmptyKey(raw *Raw) error {
 
 	return nil
 }
+
+// copyFile implements the File by reading the data from the driver with GetBytes,
+// which is used for the drivers that don't implement the FileDriver.
+type copyFile struct {
+	ctx    context.Context
+	driver StorageDriver
+	bucket string
+	key    string
+	size   int64
+	offset int64
+}
+
+func (f *copyFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *copyFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.Wrapf(ErrInvalidValue, "negative offset: %d", off)
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+
+	length := int64(len(p))
+	if remain := f.size - off; length > remain {
+		length = remain
+	}
+	if length == 0 {
+		return 0, nil
+	}
+	data, err := f.driver.GetBytes(f.ctx, &Raw{
+		Bucket: f.bucket,
+		Key:    f.key,
+		Offset: off,
+		Length: length,
+	})
+	n := copy(p, data)
+	if err != nil {
+		return n, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *copyFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.Wrapf(ErrInvalidValue, "whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.Wrapf(ErrInvalidValue, "negative position: %d", offset)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *copyFile) Close() error {
+	return nil
+}
@@ -86,3 +86,20 @@ func CalculatePieceRange(pieceNum int, pieceSize int32) string {
 	endIndex := startIndex + int64(pieceSize) - 1
 	return strconv.FormatInt(startIndex, 10) + separator + strconv.FormatInt(endIndex, 10)
 }
+
+// ParseRange parses the range string in the form of "start-end"
+// and returns the start and the end, which are both inclusive.
+func ParseRange(rangeStr string) (start, end int64, err error) {
+	ranges := strings.Split(rangeStr, separator)
+	if len(ranges) != 2 {
+		return 0, 0, fmt.Errorf("range %s is not in the form of start-end", rangeStr)
+	}
+
+	if start, err = strconv.ParseInt(ranges[0], 10, 64); err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("start of range %s is illegal", rangeStr)
+	}
+	if end, err = strconv.ParseInt(ranges[1], 10, 64); err != nil || end < start {
+		return 0, 0, fmt.Errorf("end of range %s is illegal", rangeStr)
+	}
+	return start, end, nil
+}
@@ -135,3 +135,26 @@ func (suite *RangeUtilSuite) TestCalculatePieceRange(c *check.C) {
 		c.Assert(result, check.Equals, v.expected)
 	}
 }
+
+func (suite *RangeUtilSuite) TestParseRange(c *check.C) {
+	var cases = []struct {
+		rangeStr string
+		start    int64
+		end      int64
+		hasErr   bool
+	}{
+		{rangeStr: "foo", hasErr: true},
+		{rangeStr: "aaa-bbb", hasErr: true},
+		{rangeStr: "3-2", hasErr: true},
+		{rangeStr: "-1-2", hasErr: true},
+		{rangeStr: "0-0", start: 0, end: 0},
+		{rangeStr: "1024-4095", start: 1024, end: 4095},
+	}
+
+	for _, v := range cases {
+		start, end, err := ParseRange(v.rangeStr)
+		c.Check(err != nil, check.Equals, v.hasErr, check.Commentf("range: %s", v.rangeStr))
+		c.Check(start, check.Equals, v.start)
+		c.Check(end, check.Equals, v.end)
+	}
+}